@@ -1,47 +1,74 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/zeek-r/go-conductor/internal/config"
 	"github.com/zeek-r/go-conductor/internal/logger"
 	"github.com/zeek-r/go-conductor/internal/proxy"
 )
 
+// diagnosticsTimeout bounds how long backend hosts are resolved for the diagnostics report
+const diagnosticsTimeout = 5 * time.Second
+
 // Run starts the go-conductor application with the given command line arguments
 func Run() {
 	configFile := flag.String("config", "config.yaml", "Path to configuration file")
 	verboseFlag := flag.Bool("verbose", false, "Enable verbose logging (overrides config file setting)")
+	impactFlag := flag.String("impact", "", "Print the routes affected if the given backend service or host goes down, then exit")
+	diagnosticsFlag := flag.Bool("print-diagnostics", false, "Print the startup diagnostics report as JSON, then exit (1 if a backend host does not resolve)")
 	flag.Parse()
 
 	// Load configuration
-	cfg, err := config.Load(*configFile)
+	cfg, err := loadConfig(*configFile, *verboseFlag)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Initialize logger with configuration
-	// If verbose flag is set, override the log level
-	if *verboseFlag && cfg.Logging.Level != logger.LevelDebug {
-		cfg.Logging.Level = logger.LevelDebug
+	// Answer which routes depend on a backend without starting the server
+	if *impactFlag != "" {
+		os.Exit(printImpact(cfg, *impactFlag))
 	}
 
-	// If logging is not configured, use defaults with info level
-	if cfg.Logging.Level == "" {
-		cfg.Logging.Level = logger.LevelInfo
+	// Report how the configuration would be served without starting the server
+	if *diagnosticsFlag {
+		os.Exit(printDiagnostics(cfg))
 	}
 
+	// Initialize logger with configuration
 	logger.Initialize(cfg.Logging)
 
 	// Create proxy conductor
 	conductor := proxy.NewConductor(cfg)
 
+	// Report listeners, routes, backends and subsystems in a single entry, without
+	// holding up startup while backend hosts resolve
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+		defer cancel()
+		logger.InfoWithFields("Startup diagnostics", map[string]interface{}{
+			"diagnostics": proxy.NewDiagnostics(ctx, cfg),
+		})
+	}()
+
+	// Terminate TLS on every listener if a certificate is configured
+	tlsConfig, err := proxy.NewServerTLSConfig(cfg.TLS)
+	if err != nil {
+		logger.Fatal("Failed to configure TLS", err)
+	}
+
 	// Setup main server mux
 	mainMux := http.NewServeMux()
 
@@ -57,25 +84,121 @@ func Run() {
 		})
 	}
 
+	// Push metrics to a Pushgateway if configured
+	stopMetricsPush := proxy.StartMetricsPush(conductor)
+
+	// Setup SLO endpoint if enabled
+	proxy.SetupSLOEndpoint(mainMux, conductor)
+
+	// Setup readiness endpoint if enabled
+	proxy.SetupReadinessEndpoint(mainMux, conductor)
+
+	// Setup admin endpoints if enabled, on their own listener if one is configured so they
+	// can be kept off the proxy's port
+	if cfg.Admin.Enabled && cfg.Admin.Listen != "" {
+		adminMux := http.NewServeMux()
+		proxy.SetupAdminEndpoints(adminMux, conductor)
+		adminServer := &http.Server{
+			Addr:              cfg.Admin.Listen,
+			Handler:           adminMux,
+			ReadHeaderTimeout: time.Duration(cfg.HandlerTimeout) * time.Second,
+			TLSConfig:         tlsConfig,
+		}
+		go func() {
+			logger.Info(fmt.Sprintf("Starting admin server on %s", cfg.Admin.Listen))
+			if err := listenAndServe(adminServer); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Admin server error", err)
+			}
+		}()
+	} else {
+		proxy.SetupAdminEndpoints(mainMux, conductor)
+	}
+
 	// Setup the server with our mux that includes both proxy and metrics
+	// Slow clients are cut off once the handler timeout has passed, headers included
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: mainMux,
+		Addr:              cfg.Listen,
+		Handler:           mainMux,
+		ReadHeaderTimeout: time.Duration(cfg.HandlerTimeout) * time.Second,
+		TLSConfig:         tlsConfig,
 	}
 
 	// Start the server in a goroutine
 	go func() {
-		logger.Info(fmt.Sprintf("Starting go-conductor on port %d", cfg.Port))
+		logger.InfoWithFields(fmt.Sprintf("Starting go-conductor on %s", cfg.Listen), map[string]interface{}{
+			"tls": tlsConfig != nil,
+		})
 		logger.InfoWithFields(fmt.Sprintf("Configured to proxy requests to %d services with %d second timeout",
 			len(cfg.Services), cfg.Timeout), map[string]interface{}{
 			"services_count": len(cfg.Services),
 			"timeout":        cfg.Timeout,
 		})
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listenAndServe(server); err != nil && err != http.ErrServerClosed {
 			logger.Fatal("Server error", err)
 		}
 	}()
 
+	// Serve the same mux on every additional listener, tagging requests with its name so
+	// services bound to other listeners are not routed
+	for _, listener := range cfg.Listeners {
+		listenerServer := &http.Server{
+			Addr:              listener.Address,
+			Handler:           mainMux,
+			ReadHeaderTimeout: time.Duration(cfg.HandlerTimeout) * time.Second,
+			TLSConfig:         tlsConfig,
+			BaseContext: func(net.Listener) context.Context {
+				return proxy.WithListener(context.Background(), listener.Name)
+			},
+		}
+		go func() {
+			logger.InfoWithFields(fmt.Sprintf("Starting listener %s on %s", listener.Name, listener.Address), map[string]interface{}{
+				"listener": listener.Name,
+				"address":  listener.Address,
+			})
+			if err := listenAndServe(listenerServer); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Server error", err)
+			}
+		}()
+	}
+
+	// Redirect plain HTTP requests to HTTPS if configured
+	if tlsConfig != nil && cfg.TLS.RedirectHTTP != "" {
+		redirectServer := &http.Server{
+			Addr:              cfg.TLS.RedirectHTTP,
+			Handler:           proxy.HTTPSRedirectHandler(cfg.Listen),
+			ReadHeaderTimeout: time.Duration(cfg.HandlerTimeout) * time.Second,
+		}
+		go func() {
+			logger.Info(fmt.Sprintf("Redirecting HTTP on %s to HTTPS", cfg.TLS.RedirectHTTP))
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Redirect server error", err)
+			}
+		}()
+	}
+
+	// Reload services on SIGHUP, and when the configuration file changes if watched
+	reload := func(trigger string) {
+		next, err := loadConfig(*configFile, *verboseFlag)
+		if err == nil {
+			err = conductor.Reload(next)
+		}
+		if err != nil {
+			logger.ErrorWithFields("Failed to reload configuration, keeping the current one", err, map[string]interface{}{
+				"trigger": trigger,
+			})
+		}
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			reload("sighup")
+		}
+	}()
+	if cfg.Reload.Watch {
+		go watchConfig(*configFile, time.Duration(cfg.Reload.Interval)*time.Second, func() { reload("file") })
+	}
+
 	// Setup graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
@@ -83,4 +206,99 @@ func Run() {
 	// Wait for interrupt signal
 	<-stop
 	logger.Info("Shutting down server...")
+	conductor.Close()
+	if stopMetricsPush != nil {
+		stopMetricsPush()
+	}
+	logger.Close()
+}
+
+// listenAndServe serves HTTPS if the server has TLS settings, plain HTTP otherwise
+func listenAndServe(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// loadConfig loads the configuration file, raising the log level to debug if verbose
+func loadConfig(path string, verbose bool) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// If verbose flag is set, override the log level
+	if verbose && cfg.Logging.Level != logger.LevelDebug {
+		cfg.Logging.Level = logger.LevelDebug
+	}
+
+	// If logging is not configured, use defaults with info level
+	if cfg.Logging.Level == "" {
+		cfg.Logging.Level = logger.LevelInfo
+	}
+	return cfg, nil
+}
+
+// watchConfig calls reload whenever the configuration file's modification time or size
+// changes, checking on every interval. Editors that replace the file are handled, as the
+// path is checked rather than the file first opened.
+func watchConfig(path string, interval time.Duration, reload func()) {
+	last, _ := os.Stat(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		info, err := os.Stat(path)
+		if err != nil {
+			// The file may be between a delete and a rename, try again next time
+			continue
+		}
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		last = info
+		reload()
+	}
+}
+
+// printImpact prints how losing a backend affects each route depending on it and returns
+// the exit code: 1 if no route depends on the backend
+func printImpact(cfg *config.Config, backend string) int {
+	routes, ok := proxy.NewDependencyGraph(cfg).Impact(backend)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "No route depends on backend %s\n", backend)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROUTE\tMATCH\tROLE\tIMPACT\tFALLBACK")
+	for _, route := range routes {
+		fallback := strings.Join(route.Fallback, ",")
+		if route.ReadsOnly {
+			fallback += " (reads only)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", route.Route, route.Match, route.Role, route.Impact, fallback)
+	}
+	tw.Flush()
+	return 0
+}
+
+// printDiagnostics prints the diagnostics report as JSON and returns the exit code: 1 if
+// a backend host could not be resolved
+func printDiagnostics(cfg *config.Config) int {
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+	diagnostics := proxy.NewDiagnostics(ctx, cfg)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(diagnostics); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print diagnostics: %v\n", err)
+		return 1
+	}
+	if unresolved := diagnostics.Unresolved(); len(unresolved) > 0 {
+		fmt.Fprintf(os.Stderr, "Unresolved backends: %s\n", strings.Join(unresolved, ", "))
+		return 1
+	}
+	return 0
 }
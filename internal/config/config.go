@@ -1,8 +1,17 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"mime"
+	"net"
+	"net/textproto"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/zeek-r/go-conductor/internal/logger"
 	"gopkg.in/yaml.v3"
@@ -10,30 +19,716 @@ import (
 
 // Config holds the main application configuration
 type Config struct {
-	Port     int           `yaml:"port"`
-	Services []Service     `yaml:"services"`
-	Timeout  int           `yaml:"timeout,omitempty"` // Timeout in seconds for requests
-	Logging  logger.Config `yaml:"logging,omitempty"` // Logging configuration
-	Metrics  MetricsConfig `yaml:"metrics,omitempty"` // Metrics configuration
+	Listen           string                `yaml:"listen,omitempty"`    // Address to listen on, e.g. 127.0.0.1:8080 or [::]:8443
+	Port             int                   `yaml:"port"`                // Deprecated: use Listen
+	Listeners        []ListenerConfig      `yaml:"listeners,omitempty"` // Additional named listeners services can be bound to
+	TLS              TLSConfig             `yaml:"tls,omitempty"`       // HTTPS termination on the listeners
+	Services         []Service             `yaml:"services"`
+	Timeout          int                   `yaml:"timeout,omitempty"`          // Total budget in seconds for a request, including all attempts
+	AttemptTimeout   int                   `yaml:"attemptTimeout,omitempty"`   // Timeout in seconds for a single upstream attempt
+	HandlerTimeout   int                   `yaml:"handlerTimeout,omitempty"`   // Seconds the conductor spends on a request, reading its headers and body included
+	DeadlineHeader   string                `yaml:"deadlineHeader,omitempty"`   // Header carrying the remaining budget in milliseconds to backends
+	DeadlineMarginMs int                   `yaml:"deadlineMarginMs,omitempty"` // Milliseconds subtracted from the advertised budget for network and proxy overhead
+	Logging          logger.Config         `yaml:"logging,omitempty"`          // Logging configuration
+	Metrics          MetricsConfig         `yaml:"metrics,omitempty"`          // Metrics configuration
+	ErrorMapping     ErrorMappingConfig    `yaml:"errorMapping,omitempty"`     // Status codes for upstream failures
+	DNS              DNSConfig             `yaml:"dns,omitempty"`              // Backend hostname resolution caching
+	BodySpool        BodySpoolConfig       `yaml:"bodySpool,omitempty"`        // Spooling of large request bodies to disk
+	SLO              SLOConfig             `yaml:"slo,omitempty"`              // Rolling latency percentiles and SLO tracking
+	Dedup            DedupConfig           `yaml:"dedup,omitempty"`            // Coalescing of duplicate requests by idempotency key
+	Bandwidth        []BandwidthLimit      `yaml:"bandwidth,omitempty"`        // Byte-rate limits by route name
+	Health           HealthConfig          `yaml:"health,omitempty"`           // Passive backend health tracking
+	Failover         []FailoverConfig      `yaml:"failover,omitempty"`         // Remote clusters by route name
+	Comparison       ComparisonConfig      `yaml:"comparison,omitempty"`       // Background comparison of shadow responses
+	Admin            AdminConfig           `yaml:"admin,omitempty"`            // Runtime admin endpoints
+	Budgets          []RouteBudget         `yaml:"budgets,omitempty"`          // Size and latency budgets by route name
+	Overload         OverloadConfig        `yaml:"overload,omitempty"`         // Global cap on in-flight requests
+	HeaderLimits     HeaderLimitsConfig    `yaml:"headerLimits,omitempty"`     // Limits on request headers before proxying
+	Quota            QuotaConfig           `yaml:"quota,omitempty"`            // Per-tenant usage accounting and quotas
+	Compression      CompressionConfig     `yaml:"compression,omitempty"`      // Gzip handling between conductor, backends and clients
+	DisableVia       bool                  `yaml:"disableVia,omitempty"`       // Do not add the Via header to requests and responses
+	LoopDetection    LoopDetectionConfig   `yaml:"loopDetection,omitempty"`    // Rejection of requests looping back to the conductor
+	Auth             AuthConfig            `yaml:"auth,omitempty"`             // Per-route authentication requirements
+	Cache            CacheConfig           `yaml:"cache,omitempty"`            // Shared cache of backend responses
+	MethodOverride   MethodOverrideConfig  `yaml:"methodOverride,omitempty"`   // Method override header for clients limited to POST
+	Readiness        ReadinessConfig       `yaml:"readiness,omitempty"`        // Readiness endpoint combining the health of routes
+	CORS             []CORSConfig          `yaml:"cors,omitempty"`             // Cross-origin access policies by route name
+	Signatures       []SignatureConfig     `yaml:"signatures,omitempty"`       // Inbound request signature verification by route name
+	Faults           FaultConfig           `yaml:"faults,omitempty"`           // Artificial backend faults for chaos testing
+	MirrorGuard      MirrorGuardConfig     `yaml:"mirrorGuard,omitempty"`      // Automatic disabling of shadow services over their error budget
+	SelectionHints   SelectionHintConfig   `yaml:"selectionHints,omitempty"`   // Response headers backends demote their own responses with
+	OnDemandMirror   OnDemandMirrorConfig  `yaml:"onDemandMirror,omitempty"`   // Mirroring of single requests to a named service on demand
+	ContentTypes     []RouteContentTypes   `yaml:"contentTypes,omitempty"`     // Allowed request body content types by route name
+	MirrorShaping    []MirrorShape         `yaml:"mirrorShaping,omitempty"`    // Rate shaping of shadow traffic by service name
+	BodyPeekBytes    int                   `yaml:"bodyPeekBytes,omitempty"`    // Request body bytes read to evaluate service match predicates (default: 65536)
+	ReadYourWrites   ReadYourWritesConfig  `yaml:"readYourWrites,omitempty"`   // Pinning of reads to the backend of the client's last write
+	Assertions       []RouteAssertion      `yaml:"assertions,omitempty"`       // Contracts selected responses must satisfy by route name
+	Streaming        StreamingConfig       `yaml:"streaming,omitempty"`        // Streaming of primary responses to clients instead of buffering them
+	PartialResults   PartialResultsConfig  `yaml:"partialResults,omitempty"`   // Use of the best response received when the deadline expires before the primary responds
+	ResponseHeaders  ResponseHeadersConfig `yaml:"responseHeaders,omitempty"`  // Resolution of conflicting values of response headers
+	Reload           ReloadConfig          `yaml:"reload,omitempty"`           // Reloading of services when the configuration file changes
+	Flags            FlagsConfig           `yaml:"flags,omitempty"`            // Mirroring of routes driven by a feature flag provider
+	PostProcessing   PostProcessingConfig  `yaml:"postProcessing,omitempty"`   // Sampled data quality checks of the responses sent to clients
+	FanOut           []RouteFanOut         `yaml:"fanOut,omitempty"`           // Parallelism of shadow requests by route name
+	DeferredMirrors  DeferredMirrorsConfig `yaml:"deferredMirrors,omitempty"`  // Sending of shadow requests from a background queue once the primary answered
+	RouteCache       RouteCacheConfig      `yaml:"routeCache,omitempty"`       // Caching of the services matched by recent request paths
+	AccessLog        AccessLogConfig       `yaml:"accessLog,omitempty"`        // One line per answered request, apart from the application logs
+	Authz            []RouteAuthz          `yaml:"authz,omitempty"`            // Access control decided by static rules or a policy engine, by route name
+	Annotations      AnnotationsConfig     `yaml:"annotations,omitempty"`      // Headers describing the conductor's decisions to backends and clients
+	Capture          CaptureConfig         `yaml:"capture,omitempty"`          // Export of mirrored requests and responses for offline analysis
+	WebSocket        WebSocketConfig       `yaml:"webSocket,omitempty"`        // Connections upgraded to WebSocket, tunneled to the primary
+	AdaptiveTimeout  AdaptiveTimeoutConfig `yaml:"adaptiveTimeout,omitempty"`  // Attempt timeouts of primaries following each route's observed latency
 }
 
 // Service defines a backend service to proxy to
 type Service struct {
-	Name       string            `yaml:"name"`
-	URL        string            `yaml:"url"`
-	Path       string            `yaml:"path"`
-	PathPrefix string            `yaml:"pathPrefix,omitempty"`
-	PathExact  string            `yaml:"pathExact,omitempty"`
-	Primary    bool              `yaml:"primary,omitempty"`
-	Headers    map[string]string `yaml:"headers,omitempty"`
-	Weight     int               `yaml:"weight,omitempty"` // For future use with load balancing
+	Name                string             `yaml:"name"`
+	URL                 string             `yaml:"url"`
+	Path                string             `yaml:"path"`
+	PathPrefix          string             `yaml:"pathPrefix,omitempty"`
+	PathExact           string             `yaml:"pathExact,omitempty"`
+	PathRegex           string             `yaml:"pathRegex,omitempty"` // Regular expression the whole request path must match; named groups become variables, e.g. /users/(?P<id>[^/]+)/orders
+	Primary             bool               `yaml:"primary,omitempty"`
+	Headers             map[string]string  `yaml:"headers,omitempty"`
+	Weight              int                `yaml:"weight,omitempty"`              // For future use with load balancing
+	PreserveHost        bool               `yaml:"preserveHost,omitempty"`        // Send the client's Host header upstream
+	MirrorUnsafeMethods bool               `yaml:"mirrorUnsafeMethods,omitempty"` // Mirror non-idempotent methods (POST, DELETE, ...) to this non-primary service
+	Proxy               string             `yaml:"proxy,omitempty"`               // Egress proxy: "environment" (default), "none", or a proxy URL
+	Route               string             `yaml:"route,omitempty"`               // Route name used in metric labels (default: the path pattern)
+	HealthCheck         *HealthCheckConfig `yaml:"healthCheck,omitempty"`         // Active health check, in addition to passive tracking
+	Dial                *DialConfig        `yaml:"dial,omitempty"`                // Connection settings for this backend
+	UserAgent           string             `yaml:"userAgent,omitempty"`           // User-Agent sent to this backend (default: the client's)
+	DeadlineHeader      string             `yaml:"deadlineHeader,omitempty"`      // Header carrying this backend's budget in milliseconds (default: the top-level deadlineHeader)
+	ForwardHeaders      []string           `yaml:"forwardHeaders,omitempty"`      // Client headers forwarded to this backend, * suffix for prefixes (default: all)
+	DropHeaders         []string           `yaml:"dropHeaders,omitempty"`         // Client headers never forwarded to this backend, * suffix for prefixes
+	PathParams          string             `yaml:"pathParams,omitempty"`          // Path pattern whose {name} segments become variables, e.g. /api/users/{id}
+	Variables           []VariableConfig   `yaml:"variables,omitempty"`           // Request values extracted into variables for ${name} templates
+	RewritePath         string             `yaml:"rewritePath,omitempty"`         // Path sent to this backend, a template such as /v2/users/${id} (default: the request path)
+	Listeners           []string           `yaml:"listeners,omitempty"`           // Listeners the service is served on, "default" for listen (default: all)
+	Match               string             `yaml:"match,omitempty"`               // Predicate over JSON body fields, e.g. $.type == "refund"; matching services replace the route's others
+	MatchHeaders        map[string]string  `yaml:"matchHeaders,omitempty"`        // Request headers and the values they must carry, "*" for any, e.g. X-Beta: "true"; matching services replace the route's others
+	MatchCookies        map[string]string  `yaml:"matchCookies,omitempty"`        // Request cookies and the values they must carry, "*" for any; matching services replace the route's others
+	Stream              bool               `yaml:"stream,omitempty"`              // Stream this service's responses to the client when it is the primary instead of buffering them
+	Mirror              bool               `yaml:"mirror,omitempty"`              // Send requests to this non-primary service in the background, never waiting for or serving its responses
+	MirrorTimeout       int                `yaml:"mirrorTimeout,omitempty"`       // Seconds a background mirror request may take (default: timeout)
+	MirrorPercent       *float64           `yaml:"mirrorPercent,omitempty"`       // Percentage of the route's requests sent to this non-primary service, up to 100, 0 for none (default: 100)
+	MirrorSampleHeader  string             `yaml:"mirrorSampleHeader,omitempty"`  // Request header whose value picks the sampled requests, so a value is always or never mirrored (default: random)
+	Retries             int                `yaml:"retries,omitempty"`             // Attempts repeated after a retryable failure of an idempotent request (default: 0)
+	RetryBackoff        int                `yaml:"retryBackoff,omitempty"`        // Milliseconds before the first retry, doubled for each further one and jittered (default: 100)
+	RetryOn             []string           `yaml:"retryOn,omitempty"`             // Failures retried: status codes such as 503, classes such as 5xx, "connection" or "timeout" (default: connection, 502, 503, 504)
+	MaxResponseBytes    int64              `yaml:"maxResponseBytes,omitempty"`    // Largest response body read from this backend, larger ones fail the request (default: unbounded)
+	Credentials         *CredentialsConfig `yaml:"credentials,omitempty"`         // Token the conductor obtains, refreshes and sends to this backend
+}
+
+// CredentialsConfig defines a token a backend requires, obtained and refreshed by the
+// conductor rather than configured as a static header value that expires
+type CredentialsConfig struct {
+	Type            string   `yaml:"type"`                      // "oauth2" for the client credentials grant, or "file" for a token rotated on disk
+	TokenURL        string   `yaml:"tokenURL,omitempty"`        // oauth2: token endpoint
+	ClientID        string   `yaml:"clientID,omitempty"`        // oauth2: client identifier
+	ClientSecret    string   `yaml:"clientSecret,omitempty"`    // oauth2: client secret
+	ClientAuth      string   `yaml:"clientAuth,omitempty"`      // oauth2: "basic" to send the client credentials in the Authorization header, or "body" in the form (default: basic)
+	Scopes          []string `yaml:"scopes,omitempty"`          // oauth2: scopes requested
+	Audience        string   `yaml:"audience,omitempty"`        // oauth2: audience requested, for providers that require one
+	File            string   `yaml:"file,omitempty"`            // file: path of the token, re-read as it is rotated
+	Header          string   `yaml:"header,omitempty"`          // Header carrying the token (default: Authorization)
+	Scheme          string   `yaml:"scheme,omitempty"`          // Scheme before the token, "none" for the bare token (default: Bearer in Authorization, none otherwise)
+	RefreshBefore   int      `yaml:"refreshBefore,omitempty"`   // oauth2: seconds before expiry a new token is requested (default: 60)
+	RefreshInterval int      `yaml:"refreshInterval,omitempty"` // Seconds a token without an expiry is used before it is obtained again (default: 300 for oauth2, 30 for file)
+}
+
+// TLSConfig defines HTTPS termination on listen, the additional listeners and the admin
+// listener. Setting a certificate turns every listener from plain HTTP to HTTPS.
+type TLSConfig struct {
+	CertFile     string   `yaml:"certFile,omitempty"`     // PEM certificate chain presented to clients
+	KeyFile      string   `yaml:"keyFile,omitempty"`      // PEM private key of the certificate
+	MinVersion   string   `yaml:"minVersion,omitempty"`   // Oldest protocol version accepted, "1.2" or "1.3" (default: 1.2)
+	CipherSuites []string `yaml:"cipherSuites,omitempty"` // TLS 1.2 cipher suites by name, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (default: Go's secure suites)
+	ClientCAFile string   `yaml:"clientCAFile,omitempty"` // PEM CAs verifying client certificates when presented, for mtls auth (default: none requested)
+	RedirectHTTP string   `yaml:"redirectHTTP,omitempty"` // Address of a plain HTTP listener redirecting to HTTPS, e.g. :80 (default: none)
+}
+
+// ListenerConfig defines an additional listener, so routes can be served on some
+// addresses only, such as internal routes on a private interface
+type ListenerConfig struct {
+	Name    string `yaml:"name"`    // Name services refer to in their listeners
+	Address string `yaml:"address"` // Address to listen on, e.g. 10.0.0.5:8081
+}
+
+// VariableConfig extracts a value from the request into a named variable. Variables are
+// substituted for ${name} in the service URL, header values and rewritePath.
+type VariableConfig struct {
+	Name    string `yaml:"name"`              // Variable name, letters, digits and underscores
+	From    string `yaml:"from"`              // "header", "query" or "claim"
+	Key     string `yaml:"key"`               // Header name, query parameter or JWT claim
+	Auth    string `yaml:"auth,omitempty"`    // claim: jwt auth method that verifies the token
+	Default string `yaml:"default,omitempty"` // Value used when the request does not carry one
+}
+
+// DialConfig defines how new connections to a backend are established
+type DialConfig struct {
+	ConnectTimeoutMs int `yaml:"connectTimeoutMs,omitempty"` // Connect timeout in milliseconds (default: 30000)
+	KeepAlive        int `yaml:"keepAlive,omitempty"`        // Seconds between TCP keep-alive probes, negative to disable (default: 30)
+	FallbackDelayMs  int `yaml:"fallbackDelayMs,omitempty"`  // Happy Eyeballs delay before falling back to IPv4, negative to disable (default: 300)
+	MaxRequests      int `yaml:"maxRequests,omitempty"`      // Requests sent over a keep-alive connection before it is closed (default: no limit)
+	MaxAge           int `yaml:"maxAge,omitempty"`           // Seconds a keep-alive connection is reused before it is closed (default: no limit)
+}
+
+// HealthCheckConfig defines how a service is actively probed
+type HealthCheckConfig struct {
+	Type     string `yaml:"type,omitempty"`     // "http" (default) or "grpc" for the grpc.health.v1 protocol
+	Path     string `yaml:"path,omitempty"`     // Path requested by HTTP checks (default: /health)
+	Service  string `yaml:"service,omitempty"`  // Service name sent in gRPC checks (default: empty, the whole server)
+	Interval int    `yaml:"interval,omitempty"` // Seconds between checks (default: 10)
+	Timeout  int    `yaml:"timeout,omitempty"`  // Seconds before a check fails (default: 2)
+	History  int    `yaml:"history,omitempty"`  // Recent check results kept for the admin API (default: 100)
 }
 
 // MetricsConfig defines how metrics are collected and exposed
 type MetricsConfig struct {
-	Enabled          bool   `yaml:"enabled"`          // Whether metrics collection is enabled
-	Endpoint         string `yaml:"endpoint"`         // Endpoint path to expose metrics (e.g., /metrics)
-	EnablePrometheus bool   `yaml:"enablePrometheus"` // Enable Prometheus format metrics
+	Enabled          bool       `yaml:"enabled"`                  // Whether metrics collection is enabled
+	Endpoint         string     `yaml:"endpoint"`                 // Endpoint path to expose metrics (e.g., /metrics)
+	EnablePrometheus bool       `yaml:"enablePrometheus"`         // Enable Prometheus format metrics
+	MaxLabelValues   int        `yaml:"maxLabelValues,omitempty"` // Distinct values allowed per label beyond configured services and routes (default: 100)
+	Push             PushConfig `yaml:"push,omitempty"`           // Push metrics to a Pushgateway instead of waiting to be scraped
+}
+
+// PushConfig defines how Prometheus metrics are pushed to a Pushgateway
+type PushConfig struct {
+	URL      string `yaml:"url"`                // Pushgateway base URL, pushing is disabled if empty
+	Protocol string `yaml:"protocol,omitempty"` // Only "pushgateway"; Prometheus remote-write is not supported (default: pushgateway)
+	Job      string `yaml:"job,omitempty"`      // Job label for pushed metrics (default: go-conductor)
+	Instance string `yaml:"instance,omitempty"` // Instance grouping label (default: hostname)
+	Interval int    `yaml:"interval,omitempty"` // Seconds between pushes (default: 15)
+}
+
+// ErrorMappingConfig defines which status codes are returned when all upstream requests fail
+type ErrorMappingConfig struct {
+	Timeout    int `yaml:"timeout,omitempty"`    // Status when upstream requests exceed the deadline (default: 504)
+	Connection int `yaml:"connection,omitempty"` // Status for connection or protocol errors (default: 502)
+}
+
+// DNSConfig defines how backend hostnames are resolved and cached
+type DNSConfig struct {
+	Enabled     bool `yaml:"enabled"`               // Whether resolved addresses are cached
+	TTL         int  `yaml:"ttl,omitempty"`         // Seconds to cache successful lookups (default: 60)
+	NegativeTTL int  `yaml:"negativeTtl,omitempty"` // Seconds to cache failed lookups (default: 5)
+}
+
+// BodySpoolConfig defines when request bodies are spooled to disk instead of held in memory
+type BodySpoolConfig struct {
+	ThresholdMB int    `yaml:"thresholdMb,omitempty"` // Bodies larger than this many MB are spooled (0 disables spooling)
+	Dir         string `yaml:"dir,omitempty"`         // Directory for spool files (default: system temp dir)
+}
+
+// AuthConfig defines named authentication methods and the routes requiring them
+type AuthConfig struct {
+	Methods map[string]AuthMethodConfig `yaml:"methods,omitempty"` // Authentication methods by name
+	Routes  []RouteAuth                 `yaml:"routes,omitempty"`  // Requirements by route name, other routes are open
+}
+
+// AuthMethodConfig defines a single authentication method
+type AuthMethodConfig struct {
+	Type          string   `yaml:"type"`                    // "apiKey", "ipAllowlist", "jwt" or "mtls"
+	Header        string   `yaml:"header,omitempty"`        // apiKey: header carrying the key (default: X-API-Key)
+	Keys          []string `yaml:"keys,omitempty"`          // apiKey: accepted keys
+	CIDRs         []string `yaml:"cidrs,omitempty"`         // ipAllowlist: allowed client networks or addresses
+	Secret        string   `yaml:"secret,omitempty"`        // jwt: HS256 signing secret
+	PublicKeyFile string   `yaml:"publicKeyFile,omitempty"` // jwt: PEM file with the RS256 public key
+	Issuer        string   `yaml:"issuer,omitempty"`        // jwt: required iss claim (default: any)
+	Audience      string   `yaml:"audience,omitempty"`      // jwt: required aud claim (default: any)
+	Subjects      []string `yaml:"subjects,omitempty"`      // mtls: allowed certificate common names (default: any verified certificate)
+}
+
+// RouteAuth defines the authentication a route requires
+type RouteAuth struct {
+	Route   string `yaml:"route"`   // Route name, as used in metric labels
+	Require string `yaml:"require"` // Expression over method names, e.g. "sso OR (partnerKey AND office)"
+}
+
+// RouteAuthz defines who may use a route, decided after authentication by static rules
+// or by an external policy engine such as OPA
+type RouteAuthz struct {
+	Route     string            `yaml:"route"`               // Route name, as used in metric labels
+	Type      string            `yaml:"type"`                // "static" or "http"
+	Rules     []AuthzRule       `yaml:"rules,omitempty"`     // static: rules in order, the first one matching the request decides
+	Default   string            `yaml:"default,omitempty"`   // static: "allow" or "deny" when no rule matches (default: deny)
+	URL       string            `yaml:"url,omitempty"`       // http: endpoint decisions are asked from, e.g. http://opa:8181/v1/data/conductor/allow
+	Headers   map[string]string `yaml:"headers,omitempty"`   // http: headers sent with decision requests, such as Authorization
+	TimeoutMs int               `yaml:"timeoutMs,omitempty"` // http: milliseconds a decision may take (default: 500)
+	FailOpen  bool              `yaml:"failOpen,omitempty"`  // http: allow requests when no decision is received (default: deny)
+}
+
+// AuthzRule allows or denies the requests it matches. Claims and subjects come from
+// verified credentials; headers are sent by the client, so header rules only hold when a
+// trusted edge sets or strips the headers they check.
+type AuthzRule struct {
+	Effect     string            `yaml:"effect"`               // "allow" or "deny"
+	Methods    []string          `yaml:"methods,omitempty"`    // Methods matched (default: any)
+	PathPrefix string            `yaml:"pathPrefix,omitempty"` // Path prefix matched (default: any)
+	Auth       string            `yaml:"auth,omitempty"`       // jwt auth method verifying the token whose claims are matched
+	Claims     map[string]string `yaml:"claims,omitempty"`     // Claims of the verified token and the values they must carry, "*" for any
+	Subjects   []string          `yaml:"subjects,omitempty"`   // Common names of the verified client certificate matched (default: any)
+	Headers    map[string]string `yaml:"headers,omitempty"`    // Request headers and the values they must carry, "*" for any; only trusted behind an edge that sets them
+}
+
+// SignatureConfig defines how signed webhook-style requests to a route are verified
+type SignatureConfig struct {
+	Route           string `yaml:"route"`                     // Route name, as used in the route metric label
+	Scheme          string `yaml:"scheme"`                    // "github", "stripe", "hmac" or "ed25519"
+	Secret          string `yaml:"secret,omitempty"`          // github, stripe, hmac: shared HMAC-SHA256 secret
+	PublicKey       string `yaml:"publicKey,omitempty"`       // ed25519: public key, hex or base64
+	Header          string `yaml:"header,omitempty"`          // Header carrying the signature (default: the scheme's)
+	TimestampHeader string `yaml:"timestampHeader,omitempty"` // hmac, ed25519: header with a timestamp signed ahead of the body (default: none)
+	Tolerance       int    `yaml:"tolerance,omitempty"`       // Seconds a signed timestamp may differ from now (default: 300)
+}
+
+// FaultConfig defines artificial faults injected into backend requests, to rehearse how
+// response selection and fallback behave before a real incident
+type FaultConfig struct {
+	Enabled bool        `yaml:"enabled"`         // Whether faults are injected from startup; admin endpoints toggle them at runtime
+	Rules   []FaultRule `yaml:"rules,omitempty"` // Faults by service name
+}
+
+// FaultRule defines the faults injected into requests to one service
+type FaultRule struct {
+	Service   string  `yaml:"service"`             // Service name
+	Rate      float64 `yaml:"rate"`                // Fraction of requests affected, from 0 to 1
+	LatencyMs int     `yaml:"latencyMs,omitempty"` // Delay added before the request is sent
+	Status    int     `yaml:"status,omitempty"`    // Status returned without calling the backend (default: none)
+	Drop      bool    `yaml:"drop,omitempty"`      // Send the request but drop the response, as if the connection was lost
+}
+
+// MirrorGuardConfig defines the budget shadow services must stay within to keep receiving
+// mirrored traffic
+type MirrorGuardConfig struct {
+	Enabled     bool    `yaml:"enabled"`               // Whether shadow services over budget are disabled automatically
+	ErrorRate   float64 `yaml:"errorRate,omitempty"`   // Fraction of failed shadow requests in a window that disables mirroring (default: 0.5)
+	LatencyMs   int     `yaml:"latencyMs,omitempty"`   // Average shadow latency in a window that disables mirroring (default: not budgeted)
+	Window      int     `yaml:"window,omitempty"`      // Seconds of traffic judged at once, so only sustained problems count (default: 60)
+	MinRequests int     `yaml:"minRequests,omitempty"` // Requests a window needs to be judged (default: 20)
+	CoolDown    int     `yaml:"coolDown,omitempty"`    // Seconds before mirroring resumes automatically (default: 300)
+	Webhook     string  `yaml:"webhook,omitempty"`     // URL receiving a JSON POST when mirroring to a service is disabled or resumes
+}
+
+// SelectionHintConfig lets backends demote their own responses in selection, so a
+// degraded backend can ask for a healthy peer's response to be preferred
+type SelectionHintConfig struct {
+	Enabled bool   `yaml:"enabled"`          // Whether backends' selection hints are honored
+	Header  string `yaml:"header,omitempty"` // Response header demoting the response when false, 0 or no (default: X-Conductor-Prefer)
+}
+
+// OnDemandMirrorConfig lets authorized clients mirror a single request to a named service
+// and get a summary of the comparison back
+type OnDemandMirrorConfig struct {
+	Enabled       bool   `yaml:"enabled"`                 // Whether requests can ask to be mirrored
+	Header        string `yaml:"header,omitempty"`        // Request header naming the service to mirror to (default: X-Conductor-Mirror-To)
+	SummaryHeader string `yaml:"summaryHeader,omitempty"` // Response header carrying the comparison summary (default: X-Conductor-Mirror-Diff)
+	Require       string `yaml:"require"`                 // Expression over auth methods requests must satisfy, e.g. "developers"
+}
+
+// RouteContentTypes defines the content types request bodies sent to a route may have
+type RouteContentTypes struct {
+	Route string   `yaml:"route"` // Route name, as used in the route metric label
+	Allow []string `yaml:"allow"` // Allowed media types, e.g. "application/json" or "text/*"
+}
+
+// MirrorShape defines the rate at which shadow requests are sent to a service. Requests
+// over the rate are queued for a while, then dropped.
+type MirrorShape struct {
+	Service           string  `yaml:"service"`              // Service name
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"`    // Sustained rate of shadow requests
+	Burst             int     `yaml:"burst,omitempty"`      // Requests sent at once after an idle period (default: the rate, at least 1)
+	MaxQueueMs        int     `yaml:"maxQueueMs,omitempty"` // Longest wait for a turn before a request is dropped (default: 0, drop at once)
+}
+
+// ReadYourWritesConfig defines how a client's reads are pinned to the backend that handled
+// its last write, for dual-write migrations where replicas lag
+type ReadYourWritesConfig struct {
+	Enabled bool     `yaml:"enabled"`          // Whether reads are pinned after writes
+	Routes  []string `yaml:"routes,omitempty"` // Route names whose reads are pinned (default: all)
+	TTL     int      `yaml:"ttl,omitempty"`    // Seconds reads stay pinned after a write (default: 5)
+	Cookie  string   `yaml:"cookie,omitempty"` // Cookie carrying the pin token (default: conductor_pin)
+	Header  string   `yaml:"header,omitempty"` // Header carrying the pin token, for clients without cookies (default: X-Conductor-Pin)
+	Secret  string   `yaml:"secret"`           // Key signing pin tokens, shared by every instance (required)
+}
+
+// RouteAssertion defines a contract the selected response of a route must satisfy, and
+// what happens to responses that do not
+type RouteAssertion struct {
+	Route       string   `yaml:"route"`                 // Route name, as used in the route metric label
+	Status      []int    `yaml:"status,omitempty"`      // Allowed status codes (default: any)
+	Headers     []string `yaml:"headers,omitempty"`     // Headers the response must carry
+	Body        string   `yaml:"body,omitempty"`        // Predicate over JSON body fields that must hold, e.g. $.data != null
+	Action      string   `yaml:"action,omitempty"`      // "log" (default), "count" or "error"
+	ErrorStatus int      `yaml:"errorStatus,omitempty"` // Status answered instead of failing responses with the error action (default: 502)
+}
+
+// StreamingConfig defines how large or slow responses are passed through without being
+// held in memory
+type StreamingConfig struct {
+	Enabled      bool `yaml:"enabled"`                // Stream the responses of every primary service
+	DrainShadows bool `yaml:"drainShadows,omitempty"` // Read shadow response bodies and discard them instead of buffering them
+}
+
+// PartialResultsConfig defines whether a request whose deadline expires before the primary
+// responds is answered with the best response received so far instead of an error
+type PartialResultsConfig struct {
+	Enabled bool   `yaml:"enabled"`          // Whether the best response received by the deadline is used
+	Header  string `yaml:"header,omitempty"` // Response header marking partial selections (default: X-Conductor-Partial)
+}
+
+// ResponseHeadersConfig defines how a response header carrying several values is reduced
+// before it reaches the client. Policies override the defaults, which keep the first value
+// of headers allowed only once, such as Content-Type and Date, and merge Vary and
+// Cache-Control.
+type ResponseHeadersConfig struct {
+	Policies []HeaderPolicy `yaml:"policies,omitempty"` // Policies by header name
+}
+
+// HeaderPolicy sets how the values of one response header are reduced
+type HeaderPolicy struct {
+	Header string `yaml:"header"` // Header name, case-insensitive
+	Policy string `yaml:"policy"` // first, last, merge into one comma-separated value, or keep every value
+}
+
+// ReloadConfig defines whether the configuration file is watched for changes. Services and
+// failover clusters are also reloaded on SIGHUP, watched or not.
+type ReloadConfig struct {
+	Watch             bool   `yaml:"watch"`                       // Reload when the configuration file changes, polled with stat every interval
+	Interval          int    `yaml:"interval,omitempty"`          // Seconds between checks of the configuration file (default: 5)
+	GracePeriod       int    `yaml:"gracePeriod,omitempty"`       // Seconds removed services keep answering routes no remaining service serves (default: 0, removed at once)
+	History           int    `yaml:"history,omitempty"`           // Applied configurations kept for rollback through the admin endpoints (default: 10)
+	SnapshotDirectory string `yaml:"snapshotDirectory,omitempty"` // Directory each applied configuration is written to, so the history survives restarts (default: none, kept in memory)
+}
+
+// FlagsConfig defines the feature flag provider that turns mirroring of routes on and off
+// and sets the share of their traffic mirrored, instead of configuration edits
+type FlagsConfig struct {
+	Provider string            `yaml:"provider,omitempty"` // "openfeature" for an OpenFeature remote evaluation (OFREP) endpoint such as flagd (default: none)
+	URL      string            `yaml:"url,omitempty"`      // Base URL of the provider, e.g. http://flagd:8016
+	Headers  map[string]string `yaml:"headers,omitempty"`  // Headers sent with evaluations, such as Authorization
+	Interval int               `yaml:"interval,omitempty"` // Seconds between flag evaluations (default: 30)
+	Routes   []RouteFlags      `yaml:"routes,omitempty"`   // Flags controlling each route
+}
+
+// RouteFlags names the flags controlling a route's shadow traffic. A flag the provider
+// does not know or fails to evaluate leaves the route as configured.
+type RouteFlags struct {
+	Route         string `yaml:"route"`                   // Route name
+	Mirror        string `yaml:"mirror,omitempty"`        // Boolean flag; false sends the route's requests to its primary only
+	MirrorPercent string `yaml:"mirrorPercent,omitempty"` // Numeric flag, percentage of the route's requests sent to its shadows
+}
+
+// PostProcessingConfig defines checks run in the background on a sample of the responses
+// sent to clients, such as schema drift detection and PII scanning
+type PostProcessingConfig struct {
+	Workers    int             `yaml:"workers,omitempty"`    // Number of background workers (default: 2)
+	QueueSize  int             `yaml:"queueSize,omitempty"`  // Responses waiting for a worker before new ones are dropped (default: 100)
+	Webhook    string          `yaml:"webhook,omitempty"`    // URL findings are posted to as JSON events (default: none)
+	Processors []PostProcessor `yaml:"processors,omitempty"` // Checks run on each route's responses
+}
+
+// PostProcessor defines a check run on a sample of a route's responses
+type PostProcessor struct {
+	Route      string  `yaml:"route"`                // Route name
+	Type       string  `yaml:"type"`                 // "schema" reports JSON fields appearing, disappearing or changing type; "pii" reports personal data
+	SampleRate float64 `yaml:"sampleRate,omitempty"` // Fraction of responses checked, from 0 to 1 (default: 0.01)
+}
+
+// RouteFanOut bounds how many of a route's shadow and mirror requests are in flight at
+// once for a client request, so hot routes do not hit every backend at the same instant
+type RouteFanOut struct {
+	Route        string `yaml:"route"`                  // Route name, as used in the route metric label
+	MaxParallel  int    `yaml:"maxParallel,omitempty"`  // Shadow and mirror requests sent at once, the others waiting for their turn; 1 sends them one after another (default: all at once)
+	AfterPrimary bool   `yaml:"afterPrimary,omitempty"` // Hold background mirrors until the primary has answered
+}
+
+// DeferredMirrorsConfig defines how shadow requests are held back until the primary has
+// answered and then sent from a bounded background queue, so mirroring never adds to the
+// latency of client requests
+type DeferredMirrorsConfig struct {
+	Enabled   bool `yaml:"enabled"`             // Whether shadow requests are deferred
+	Workers   int  `yaml:"workers,omitempty"`   // Number of background workers sending deferred requests (default: 4)
+	QueueSize int  `yaml:"queueSize,omitempty"` // Requests waiting for a worker before new ones are dropped (default: 100)
+}
+
+// RouteCacheConfig defines the cache of the services matched by the most recently requested
+// paths, so hot endpoints skip evaluating regular expression and prefix routes
+type RouteCacheConfig struct {
+	Enabled    bool `yaml:"enabled"`              // Whether route matches are cached
+	MaxEntries int  `yaml:"maxEntries,omitempty"` // Paths kept, least recently requested evicted first (default: 1000)
+}
+
+// AccessLogConfig defines the access log, written apart from the application logs so it
+// can be collected and parsed with common web server tooling
+type AccessLogConfig struct {
+	Enabled bool   `yaml:"enabled"`          // Whether answered requests are logged
+	Format  string `yaml:"format,omitempty"` // "common", "combined" or "json" (default: combined)
+	Output  string `yaml:"output,omitempty"` // "stdout", "stderr" or "file" (default: stdout)
+	File    string `yaml:"file,omitempty"`   // Path appended to when output is "file"
+}
+
+// AnnotationsConfig defines the headers describing the conductor's decisions, so backends
+// and support engineers can see how a request was handled
+type AnnotationsConfig struct {
+	Backend bool   `yaml:"backend"`          // Send the route, the service's role and the attempt number to backends
+	Client  bool   `yaml:"client"`           // Send the service whose response was used and the cache result to clients
+	Prefix  string `yaml:"prefix,omitempty"` // Prefix of the header names (default: X-Conductor-)
+}
+
+// CaptureConfig defines the export of shadow and mirror requests with the responses they
+// got, written in batches to a directory or posted to an HTTP sink
+type CaptureConfig struct {
+	Enabled       bool     `yaml:"enabled"`                 // Whether mirrored exchanges are exported
+	Format        string   `yaml:"format,omitempty"`        // "har" for HTTP Archive 1.2 documents or "raw" for HTTP/1.1 messages (default: har)
+	Directory     string   `yaml:"directory,omitempty"`     // Directory each batch is written to as a file
+	URL           string   `yaml:"url,omitempty"`           // HTTP sink each batch is posted to
+	Routes        []string `yaml:"routes,omitempty"`        // Route names captured (default: all)
+	MaxBodyBytes  int      `yaml:"maxBodyBytes,omitempty"`  // Bytes of each body kept, longer ones truncated (default: 65536)
+	BatchSize     int      `yaml:"batchSize,omitempty"`     // Exchanges per file or post (default: 100)
+	FlushInterval int      `yaml:"flushInterval,omitempty"` // Seconds before a partial batch is exported (default: 10)
+	QueueSize     int      `yaml:"queueSize,omitempty"`     // Exchanges waiting to be exported, further ones dropped (default: 1000)
+}
+
+// WebSocketConfig defines how WebSocket connections tunneled to a route's primary are kept
+type WebSocketConfig struct {
+	IdleTimeout int `yaml:"idleTimeout,omitempty"` // Seconds without a frame in either direction before the tunnel is closed (default: never)
+}
+
+// AdaptiveTimeoutConfig defines attempt timeouts tracking each route's observed latency:
+// a primary's attempts are bounded by a multiple of the route's rolling p99, kept between
+// a floor and a ceiling
+type AdaptiveTimeoutConfig struct {
+	Enabled    bool     `yaml:"enabled"`              // Whether attempt timeouts adapt to observed latency
+	Multiplier float64  `yaml:"multiplier,omitempty"` // Multiple of the rolling p99 attempts may take (default: 3)
+	FloorMs    int      `yaml:"floorMs,omitempty"`    // Shortest timeout in milliseconds (default: 100)
+	CeilingMs  int      `yaml:"ceilingMs,omitempty"`  // Longest timeout in milliseconds (default: timeout)
+	Window     int      `yaml:"window,omitempty"`     // Rolling window in seconds the p99 is computed over (default: 300)
+	MinSamples int      `yaml:"minSamples,omitempty"` // Attempts observed in the window before the timeout adapts (default: 100)
+	Routes     []string `yaml:"routes,omitempty"`     // Route names whose timeouts adapt (default: all)
+}
+
+// CORSConfig defines how browsers on other origins may call a route
+type CORSConfig struct {
+	Route               string   `yaml:"route"`                         // Route name, as used in the route metric label
+	AllowOrigins        []string `yaml:"allowOrigins"`                  // Origins allowed to call the route, "*" for any
+	AllowMethods        []string `yaml:"allowMethods,omitempty"`        // Methods allowed by preflights (default: GET, HEAD, POST)
+	AllowHeaders        []string `yaml:"allowHeaders,omitempty"`        // Request headers allowed by preflights (default: those requested)
+	ExposeHeaders       []string `yaml:"exposeHeaders,omitempty"`       // Response headers scripts may read
+	AllowCredentials    bool     `yaml:"allowCredentials,omitempty"`    // Allow cookies and other credentials
+	MaxAge              int      `yaml:"maxAge,omitempty"`              // Seconds browsers may cache a preflight (default: the browser's)
+	AllowPrivateNetwork bool     `yaml:"allowPrivateNetwork,omitempty"` // Allow Private Network Access from public sites
+}
+
+// ReadinessConfig defines the readiness endpoint used by orchestrators
+type ReadinessConfig struct {
+	Enabled  bool   `yaml:"enabled"`            // Whether the readiness endpoint is served
+	Endpoint string `yaml:"endpoint,omitempty"` // Endpoint path (default: /readyz)
+	Require  string `yaml:"require,omitempty"`  // Expression over route health, e.g. "/api AND any:/search" (default: every route's primary healthy)
+}
+
+// MethodOverrideConfig defines how POST requests declare the method they stand for
+type MethodOverrideConfig struct {
+	Enabled bool     `yaml:"enabled"`           // Whether the override header is honored
+	Header  string   `yaml:"header,omitempty"`  // Header naming the intended method (default: X-HTTP-Method-Override)
+	Methods []string `yaml:"methods,omitempty"` // Methods a POST may be overridden to (default: PUT, PATCH, DELETE)
+}
+
+// LoopDetectionConfig defines how requests looping back to the conductor are detected
+type LoopDetectionConfig struct {
+	Enabled    bool   `yaml:"enabled"`              // Whether looping requests are rejected
+	Header     string `yaml:"header,omitempty"`     // Marker header added to outgoing requests (default: X-Conductor-Loop)
+	Secret     string `yaml:"secret,omitempty"`     // Key signing the marker so it does not reveal the instance ID (default: unsigned)
+	InstanceID string `yaml:"instanceId,omitempty"` // Identifies this conductor in markers (default: random per process)
+	MaxHops    int    `yaml:"maxHops,omitempty"`    // Reject requests whose Via header lists this many go-conductor hops (default: 10, -1 to disable)
+}
+
+// CompressionConfig defines how gzip is handled between the conductor, backends and clients
+type CompressionConfig struct {
+	Enabled              bool  `yaml:"enabled"`                        // Request gzip from backends, decompress it, and compress toward clients
+	MinSize              int   `yaml:"minSize,omitempty"`              // Smallest response body in bytes compressed toward clients (default: 1024)
+	MaxDecompressedBytes int64 `yaml:"maxDecompressedBytes,omitempty"` // Largest decompressed backend response of services without maxResponseBytes (default: 67108864)
+}
+
+// QuotaConfig defines how usage is accounted per tenant
+type QuotaConfig struct {
+	Enabled          bool            `yaml:"enabled"`                    // Whether usage is accounted per tenant
+	Identity         *IdentityConfig `yaml:"identity,omitempty"`         // How the tenant is identified from verified credentials (default: none, by header)
+	Header           string          `yaml:"header,omitempty"`           // Header identifying the tenant without an identity, only trusted behind an edge that sets it (default: X-Tenant-ID)
+	DefaultTenant    string          `yaml:"defaultTenant,omitempty"`    // Tenant for requests that are not identified (default: anonymous)
+	Mode             string          `yaml:"mode,omitempty"`             // "track" (default) to only account usage, or "enforce" to reject tenants over quota
+	Tenants          []TenantQuota   `yaml:"tenants,omitempty"`          // Quotas by tenant, other tenants are unlimited
+	RateLimitHeaders bool            `yaml:"rateLimitHeaders,omitempty"` // Tell clients their remaining request quota in RateLimit headers when enforced
+}
+
+// TenantQuota defines a tenant's daily and monthly quotas, zero meaning unlimited
+type TenantQuota struct {
+	Tenant          string `yaml:"tenant" json:"tenant"`
+	DailyRequests   int64  `yaml:"dailyRequests,omitempty" json:"daily_requests,omitempty"`     // Requests per UTC day
+	MonthlyRequests int64  `yaml:"monthlyRequests,omitempty" json:"monthly_requests,omitempty"` // Requests per UTC month
+	DailyBytes      int64  `yaml:"dailyBytes,omitempty" json:"daily_bytes,omitempty"`           // Request and response body bytes per UTC day
+	MonthlyBytes    int64  `yaml:"monthlyBytes,omitempty" json:"monthly_bytes,omitempty"`       // Request and response body bytes per UTC month
+}
+
+// HeaderLimitsConfig defines the largest request header sets passed to backends
+type HeaderLimitsConfig struct {
+	MaxBytes int `yaml:"maxBytes,omitempty"` // Total size of header names and values (0 for unlimited)
+	MaxCount int `yaml:"maxCount,omitempty"` // Number of header fields, counting repeated headers once per value (0 for unlimited)
+}
+
+// OverloadConfig defines how many requests may be in flight before new ones are shed
+type OverloadConfig struct {
+	MaxInFlight int `yaml:"maxInFlight,omitempty"` // Requests processed at once before answering 503 (0 for unlimited)
+	RetryAfter  int `yaml:"retryAfter,omitempty"`  // Seconds sent in the Retry-After header of shed requests (default: 1)
+}
+
+// RouteBudget defines the size and latency budgets of a route and how violations are handled
+type RouteBudget struct {
+	Route            string `yaml:"route"`                      // Route name, as used in metric labels
+	MaxRequestBytes  int64  `yaml:"maxRequestBytes,omitempty"`  // Largest request body (0 for unlimited)
+	MaxResponseBytes int64  `yaml:"maxResponseBytes,omitempty"` // Largest backend response body (0 for unlimited)
+	MaxLatencyMs     int    `yaml:"maxLatencyMs,omitempty"`     // Slowest backend response in milliseconds (0 for unlimited)
+	Action           string `yaml:"action,omitempty"`           // "log" (default), "count" or "enforce"
+}
+
+// AdminConfig defines the runtime admin endpoints
+type AdminConfig struct {
+	Enabled  bool   `yaml:"enabled"`            // Whether admin endpoints are exposed
+	Endpoint string `yaml:"endpoint,omitempty"` // Path prefix for admin endpoints (default: /admin)
+	Token    string `yaml:"token,omitempty"`    // Bearer token required by admin endpoints (default: none)
+	Username string `yaml:"username,omitempty"` // Basic auth user accepted by admin endpoints, with password (default: none)
+	Password string `yaml:"password,omitempty"` // Basic auth password of username
+	Listen   string `yaml:"listen,omitempty"`   // Address of a separate admin server, e.g. 127.0.0.1:9090 (default: served with the proxy)
+}
+
+// CacheConfig defines the shared response cache. Only GET responses that HTTP caching
+// rules allow a shared cache to store are cached.
+type CacheConfig struct {
+	Enabled      bool         `yaml:"enabled"`                // Whether backend responses are cached
+	MaxEntries   int          `yaml:"maxEntries,omitempty"`   // Responses kept, least recently used evicted first (default: 1000)
+	MaxBodyBytes int64        `yaml:"maxBodyBytes,omitempty"` // Largest response body cached (default: 1048576)
+	DefaultTTL   int          `yaml:"defaultTtl,omitempty"`   // Seconds responses without explicit freshness are fresh (default: 0, revalidate every use)
+	Routes       []CacheRoute `yaml:"routes,omitempty"`       // Stale serving by route name
+}
+
+// CacheRoute defines when a route may be served stale cached responses
+type CacheRoute struct {
+	Route                string `yaml:"route"`                          // Route name, as used in the route metric label
+	StaleWhileRevalidate int    `yaml:"staleWhileRevalidate,omitempty"` // Seconds after expiry a stale response is served while refreshed in the background
+	StaleIfError         int    `yaml:"staleIfError,omitempty"`         // Seconds after expiry a stale response is served when the backend fails
+}
+
+// ComparisonConfig defines how shadow responses are compared against the primary response
+type ComparisonConfig struct {
+	Enabled        bool               `yaml:"enabled"`                  // Whether shadow responses are compared
+	Workers        int                `yaml:"workers,omitempty"`        // Number of background comparison workers (default: 2)
+	QueueSize      int                `yaml:"queueSize,omitempty"`      // Comparisons waiting for a worker before new ones are dropped (default: 1000)
+	Normalize      NormalizeConfig    `yaml:"normalize,omitempty"`      // Rules applied to both bodies before comparing
+	Sampling       ComparisonSampling `yaml:"sampling,omitempty"`       // Bounded comparison of large bodies
+	AcceptEncoding string             `yaml:"acceptEncoding,omitempty"` // Accept-Encoding sent to every service of mirrored requests, e.g. identity (default: the client's)
+	Headers        []string           `yaml:"headers,omitempty"`        // Response headers compared in addition to the status code and body, e.g. Content-Type, or * for all (default: none)
+	IgnoreHeaders  []string           `yaml:"ignoreHeaders,omitempty"`  // Response headers never compared, e.g. Date when comparing all headers
+	Pairs          []ComparisonPair   `yaml:"pairs,omitempty"`          // Rules replacing the ones above when comparing a shadow service with a primary
+}
+
+// ComparisonPair sets the comparison rules of one shadow service. Rules left unset are
+// inherited from the comparison settings.
+type ComparisonPair struct {
+	Primary       string           `yaml:"primary,omitempty"`       // Primary service name (default: any)
+	Shadow        string           `yaml:"shadow"`                  // Shadow service name
+	Normalize     *NormalizeConfig `yaml:"normalize,omitempty"`     // Rules applied to both bodies before comparing
+	Headers       []string         `yaml:"headers,omitempty"`       // Response headers compared, or * for all
+	IgnoreHeaders []string         `yaml:"ignoreHeaders,omitempty"` // Response headers never compared
+}
+
+// ComparisonSampling defines how bodies too large to compare in full are sampled. Only the
+// sample is compared; a hash of the rest is logged with mismatches.
+type ComparisonSampling struct {
+	MaxBytes       int    `yaml:"maxBytes"`                 // Bodies larger than this are sampled (default: 0, every body is compared in full)
+	Mode           string `yaml:"mode,omitempty"`           // "prefix" compares the first maxBytes bytes and the length; "structure" samples JSON arrays (default: prefix)
+	SampleItems    int    `yaml:"sampleItems,omitempty"`    // structure: items of each array compared in full, later items only by shape (default: 3)
+	MaxDecodeBytes int    `yaml:"maxDecodeBytes,omitempty"` // Bodies larger than this are sampled by prefix as received, without normalizing or decoding them (default: 16777216)
+}
+
+// NormalizeConfig defines how response bodies are normalized before comparison, so
+// differences that do not matter are not reported as mismatches
+type NormalizeConfig struct {
+	SortKeys         bool             `yaml:"sortKeys,omitempty"`         // Compare JSON objects regardless of key order
+	IgnoreArrayOrder bool             `yaml:"ignoreArrayOrder,omitempty"` // Compare JSON arrays regardless of element order
+	IgnorePaths      []string         `yaml:"ignorePaths,omitempty"`      // JSONPath expressions of fields removed before comparing, e.g. $..timestamp
+	FloatPrecision   *int             `yaml:"floatPrecision,omitempty"`   // Decimal places JSON fractional numbers are rounded to (default: exact)
+	Whitespace       bool             `yaml:"whitespace,omitempty"`       // Ignore insignificant whitespace in JSON and runs of whitespace in other bodies
+	XML              XMLCompareConfig `yaml:"xml,omitempty"`              // Structural comparison of XML bodies, such as SOAP responses
+	Codecs           []BodyCodec      `yaml:"codecs,omitempty"`           // Codecs decoding bodies by content type, in addition to the built-in JSON, XML and form codecs
+}
+
+// XMLCompareConfig defines how XML bodies are converted to their JSON equivalent before
+// comparison, so XML can be compared with XML or JSON structurally
+type XMLCompareConfig struct {
+	Enabled     bool     `yaml:"enabled"`               // Whether XML bodies are compared structurally
+	IgnorePaths []string `yaml:"ignorePaths,omitempty"` // XPath expressions of elements and attributes removed before comparing, e.g. //Timestamp
+	Root        string   `yaml:"root,omitempty"`        // XPath of the element compared, e.g. /Envelope/Body/GetUserResponse (default: the whole document)
+	Namespaces  bool     `yaml:"namespaces,omitempty"`  // Also compare namespace URIs, not only local names
+	Arrays      []string `yaml:"arrays,omitempty"`      // Element names always treated as repeated, so a single element matches a one-item JSON array
+}
+
+// BodyCodec maps a content type to the codec its bodies are decoded with for comparison
+type BodyCodec struct {
+	ContentType string `yaml:"contentType"`           // Media type of the bodies, e.g. application/x-protobuf
+	Codec       string `yaml:"codec"`                 // json, xml, form or protobuf
+	Descriptors string `yaml:"descriptors,omitempty"` // protobuf: file descriptor set, as written by protoc --descriptor_set_out
+	Message     string `yaml:"message,omitempty"`     // protobuf: full name of the body's message, e.g. users.v1.User
+}
+
+// HealthConfig defines how backend health is inferred from proxied requests
+type HealthConfig struct {
+	FailureThreshold int `yaml:"failureThreshold,omitempty"` // Consecutive failures before a backend is unhealthy (default: 3)
+	RetryAfter       int `yaml:"retryAfter,omitempty"`       // Seconds before an unhealthy backend is tried again (default: 30)
+}
+
+// FailoverConfig defines a remote cluster used when every local backend of a route is unhealthy
+type FailoverConfig struct {
+	Route string   `yaml:"route"` // Route name, as used in metric labels
+	URLs  []string `yaml:"urls"`  // Base URLs of the remote cluster, the first is primary
+}
+
+// BandwidthLimit caps the byte rate of request and response bodies on a route
+type BandwidthLimit struct {
+	Route                  string `yaml:"route"`                            // Route name, as used in metric labels
+	RequestBytesPerSecond  int    `yaml:"requestBytesPerSecond,omitempty"`  // Upload rate limit (0 for unlimited)
+	ResponseBytesPerSecond int    `yaml:"responseBytesPerSecond,omitempty"` // Download rate limit (0 for unlimited)
+	PerClient              bool   `yaml:"perClient,omitempty"`              // Apply the limits to each client address instead of the route as a whole
+}
+
+// DedupConfig defines how concurrent duplicate requests are coalesced
+type DedupConfig struct {
+	Enabled  bool           `yaml:"enabled"`            // Whether duplicate requests are coalesced
+	Header   string         `yaml:"header,omitempty"`   // Header carrying the idempotency key (default: Idempotency-Key)
+	Identity IdentityConfig `yaml:"identity,omitempty"` // How the client whose requests are coalesced is identified
+}
+
+// IdentityConfig defines how the client sending a request is identified from verified
+// credentials rather than from headers it sets itself: by a claim of a bearer token
+// verified by a jwt auth method, or else by the common name of a verified client certificate
+type IdentityConfig struct {
+	Auth  string `yaml:"auth,omitempty"`  // jwt auth method verifying the token the claim is read from (default: none, client certificates only)
+	Claim string `yaml:"claim,omitempty"` // Claim of the verified token identifying the client (default: sub)
+}
+
+// SLOConfig defines rolling latency percentile and SLO burn-rate tracking per route
+type SLOConfig struct {
+	Enabled  bool        `yaml:"enabled"`            // Whether latency and SLO tracking is enabled
+	Endpoint string      `yaml:"endpoint,omitempty"` // Endpoint path to expose the SLO report (default: /slo)
+	Window   int         `yaml:"window,omitempty"`   // Rolling window in seconds (default: 300)
+	Targets  []SLOTarget `yaml:"targets,omitempty"`  // SLO targets by route name
+}
+
+// SLOTarget defines the objective for a single route
+type SLOTarget struct {
+	Route     string  `yaml:"route"`               // Route name, as used in metric labels
+	Objective float64 `yaml:"objective"`           // Fraction of requests that must be good, e.g. 0.999
+	LatencyMs int     `yaml:"latencyMs,omitempty"` // Requests slower than this count against the objective
 }
 
 // Load reads the configuration from the specified file
@@ -48,9 +743,66 @@ func Load(filename string) (*Config, error) {
 		return nil, fmt.Errorf("error parsing config file: %w", err)
 	}
 
-	// Set default port if not specified
-	if config.Port == 0 {
-		config.Port = 8080
+	// Derive the listen address from the legacy port setting if not specified
+	if config.Listen == "" {
+		if config.Port == 0 {
+			config.Port = 8080
+		}
+		config.Listen = fmt.Sprintf(":%d", config.Port)
+	}
+	if _, _, err := net.SplitHostPort(config.Listen); err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %w", config.Listen, err)
+	}
+
+	// Refuse listeners that cannot be told apart or bound
+	listeners := map[string]bool{"default": true}
+	for _, listener := range config.Listeners {
+		if listener.Name == "" || listeners[listener.Name] {
+			return nil, fmt.Errorf("invalid listener name %q: must be unique and not default", listener.Name)
+		}
+		if _, _, err := net.SplitHostPort(listener.Address); err != nil {
+			return nil, fmt.Errorf("invalid address %q for listener %q: %w", listener.Address, listener.Name, err)
+		}
+		listeners[listener.Name] = true
+	}
+	for _, service := range config.Services {
+		for _, name := range service.Listeners {
+			if !listeners[name] {
+				return nil, fmt.Errorf("unknown listener %q for service %q", name, service.Name)
+			}
+		}
+	}
+
+	// Set the default TLS version and refuse incomplete or weak TLS settings
+	if tlsConfig := &config.TLS; tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" {
+		if tlsConfig.CertFile == "" || tlsConfig.KeyFile == "" {
+			return nil, fmt.Errorf("invalid tls: certFile and keyFile must be set together")
+		}
+		if tlsConfig.MinVersion == "" {
+			tlsConfig.MinVersion = "1.2"
+		}
+		if tlsConfig.MinVersion != "1.2" && tlsConfig.MinVersion != "1.3" {
+			return nil, fmt.Errorf("invalid tls minVersion %q: must be 1.2 or 1.3", tlsConfig.MinVersion)
+		}
+		if len(tlsConfig.CipherSuites) > 0 && tlsConfig.MinVersion == "1.3" {
+			return nil, fmt.Errorf("invalid tls cipherSuites: only apply to TLS 1.2, TLS 1.3 suites are not configurable")
+		}
+		secure := make(map[string]bool)
+		for _, suite := range tls.CipherSuites() {
+			secure[suite.Name] = slices.Contains(suite.SupportedVersions, tls.VersionTLS12)
+		}
+		for _, suite := range tlsConfig.CipherSuites {
+			if !secure[suite] {
+				return nil, fmt.Errorf("invalid tls cipher suite %q: must be a secure TLS 1.2 suite", suite)
+			}
+		}
+		if tlsConfig.RedirectHTTP != "" {
+			if _, _, err := net.SplitHostPort(tlsConfig.RedirectHTTP); err != nil {
+				return nil, fmt.Errorf("invalid tls redirectHTTP address %q: %w", tlsConfig.RedirectHTTP, err)
+			}
+		}
+	} else if config.TLS.ClientCAFile != "" || config.TLS.RedirectHTTP != "" || len(config.TLS.CipherSuites) > 0 || config.TLS.MinVersion != "" {
+		return nil, fmt.Errorf("invalid tls: certFile and keyFile are required")
 	}
 
 	// Set default timeout if not specified
@@ -58,11 +810,722 @@ func Load(filename string) (*Config, error) {
 		config.Timeout = 30 // 30 seconds
 	}
 
+	// Refuse a negative handler timeout, zero leaves requests bounded by timeout alone
+	if config.HandlerTimeout < 0 {
+		return nil, fmt.Errorf("invalid handlerTimeout %d: must not be negative", config.HandlerTimeout)
+	}
+
+	// Set default error mapping if not specified
+	if config.ErrorMapping.Timeout == 0 {
+		config.ErrorMapping.Timeout = 504
+	}
+	if config.ErrorMapping.Connection == 0 {
+		config.ErrorMapping.Connection = 502
+	}
+
+	// Set default DNS cache settings if enabled but not configured
+	if config.DNS.Enabled {
+		if config.DNS.TTL == 0 {
+			config.DNS.TTL = 60
+		}
+		if config.DNS.NegativeTTL == 0 {
+			config.DNS.NegativeTTL = 5
+		}
+	}
+
+	// Set default signature headers and refuse unknown schemes
+	for i := range config.Signatures {
+		signature := &config.Signatures[i]
+		defaultHeader, ok := map[string]string{
+			"github":  "X-Hub-Signature-256",
+			"stripe":  "Stripe-Signature",
+			"hmac":    "X-Signature",
+			"ed25519": "X-Signature-Ed25519",
+		}[signature.Scheme]
+		if !ok {
+			return nil, fmt.Errorf("invalid signature scheme %q for route %q: must be github, stripe, hmac or ed25519", signature.Scheme, signature.Route)
+		}
+		if signature.Header == "" {
+			signature.Header = defaultHeader
+		}
+		if signature.Tolerance == 0 {
+			signature.Tolerance = 300
+		}
+	}
+
+	// Refuse fault rules that cannot apply
+	for _, rule := range config.Faults.Rules {
+		if rule.Rate < 0 || rule.Rate > 1 {
+			return nil, fmt.Errorf("invalid fault rate %v for service %q: must be between 0 and 1", rule.Rate, rule.Service)
+		}
+		if rule.LatencyMs < 0 {
+			return nil, fmt.Errorf("invalid fault latencyMs %d for service %q: must not be negative", rule.LatencyMs, rule.Service)
+		}
+		if rule.Status != 0 && (rule.Status < 100 || rule.Status > 599) {
+			return nil, fmt.Errorf("invalid fault status %d for service %q", rule.Status, rule.Service)
+		}
+		if rule.Status != 0 && rule.Drop {
+			return nil, fmt.Errorf("invalid fault for service %q: status and drop are exclusive", rule.Service)
+		}
+		if rule.LatencyMs == 0 && rule.Status == 0 && !rule.Drop {
+			return nil, fmt.Errorf("invalid fault for service %q: needs latencyMs, status or drop", rule.Service)
+		}
+	}
+
+	// Set default mirror guard budget if enabled but not configured
+	if guard := &config.MirrorGuard; guard.Enabled {
+		if guard.ErrorRate == 0 {
+			guard.ErrorRate = 0.5
+		}
+		if guard.ErrorRate < 0 || guard.ErrorRate > 1 {
+			return nil, fmt.Errorf("invalid mirrorGuard errorRate %v: must be between 0 and 1", guard.ErrorRate)
+		}
+		if guard.Window == 0 {
+			guard.Window = 60
+		}
+		if guard.MinRequests == 0 {
+			guard.MinRequests = 20
+		}
+		if guard.CoolDown == 0 {
+			guard.CoolDown = 300
+		}
+		if guard.LatencyMs < 0 || guard.Window < 0 || guard.MinRequests < 0 || guard.CoolDown < 0 {
+			return nil, fmt.Errorf("invalid mirrorGuard: latencyMs, window, minRequests and coolDown must not be negative")
+		}
+	}
+
+	// Set default selection hint header if enabled but not configured
+	if config.SelectionHints.Enabled && config.SelectionHints.Header == "" {
+		config.SelectionHints.Header = "X-Conductor-Prefer"
+	}
+
+	// Set default partial results header if enabled but not configured
+	if config.PartialResults.Enabled && config.PartialResults.Header == "" {
+		config.PartialResults.Header = "X-Conductor-Partial"
+	}
+
+	// Set default configuration file watch interval if enabled but not configured
+	if config.Reload.Watch && config.Reload.Interval == 0 {
+		config.Reload.Interval = 5
+	}
+	if config.Reload.Interval < 0 {
+		return nil, fmt.Errorf("invalid reload interval %d: must not be negative", config.Reload.Interval)
+	}
+	if config.Reload.GracePeriod < 0 {
+		return nil, fmt.Errorf("invalid reload gracePeriod %d: must not be negative", config.Reload.GracePeriod)
+	}
+	if config.Reload.History == 0 {
+		config.Reload.History = 10
+	}
+	if config.Reload.History < 0 {
+		return nil, fmt.Errorf("invalid reload history %d: must not be negative", config.Reload.History)
+	}
+
+	// Set default flag settings if a provider is configured and refuse incomplete ones
+	if flags := &config.Flags; flags.Provider != "" || len(flags.Routes) > 0 {
+		if flags.Provider != "openfeature" {
+			return nil, fmt.Errorf("invalid flags provider %q: must be openfeature", flags.Provider)
+		}
+		if flags.URL == "" {
+			return nil, fmt.Errorf("invalid flags configuration: url is required")
+		}
+		if flags.Interval == 0 {
+			flags.Interval = 30
+		}
+		if flags.Interval < 0 {
+			return nil, fmt.Errorf("invalid flags interval %d: must be positive", flags.Interval)
+		}
+		for _, route := range flags.Routes {
+			if route.Route == "" || (route.Mirror == "" && route.MirrorPercent == "") {
+				return nil, fmt.Errorf("invalid flags for route %q: route and a mirror or mirrorPercent flag are required", route.Route)
+			}
+		}
+	}
+
+	// Set default post-processing settings if checks are configured and refuse unknown ones
+	if processing := &config.PostProcessing; len(processing.Processors) > 0 {
+		if processing.Workers == 0 {
+			processing.Workers = 2
+		}
+		if processing.QueueSize == 0 {
+			processing.QueueSize = 100
+		}
+		if processing.Workers < 0 || processing.QueueSize < 0 {
+			return nil, fmt.Errorf("invalid postProcessing: workers and queueSize must be positive")
+		}
+		for i := range processing.Processors {
+			processor := &processing.Processors[i]
+			if processor.Type != "schema" && processor.Type != "pii" {
+				return nil, fmt.Errorf("invalid post-processor type %q for route %q: must be schema or pii", processor.Type, processor.Route)
+			}
+			if processor.SampleRate == 0 {
+				processor.SampleRate = 0.01
+			}
+			if processor.SampleRate < 0 || processor.SampleRate > 1 {
+				return nil, fmt.Errorf("invalid post-processor sampleRate %v for route %q: must be between 0 and 1", processor.SampleRate, processor.Route)
+			}
+		}
+	}
+
+	// Set default deferred mirror settings if enabled
+	if deferred := &config.DeferredMirrors; deferred.Enabled {
+		if deferred.Workers == 0 {
+			deferred.Workers = 4
+		}
+		if deferred.QueueSize == 0 {
+			deferred.QueueSize = 100
+		}
+		if deferred.Workers < 0 || deferred.QueueSize < 0 {
+			return nil, fmt.Errorf("invalid deferredMirrors: workers and queueSize must be positive")
+		}
+	}
+
+	// Set default route cache size if enabled
+	if config.RouteCache.Enabled {
+		if config.RouteCache.MaxEntries == 0 {
+			config.RouteCache.MaxEntries = 1000
+		}
+		if config.RouteCache.MaxEntries < 0 {
+			return nil, fmt.Errorf("invalid routeCache maxEntries %d: must be positive", config.RouteCache.MaxEntries)
+		}
+	}
+
+	// Set default access log settings if enabled and refuse unknown formats and outputs
+	if accessLog := &config.AccessLog; accessLog.Enabled {
+		if accessLog.Format == "" {
+			accessLog.Format = "combined"
+		}
+		if accessLog.Output == "" {
+			accessLog.Output = "stdout"
+		}
+		switch accessLog.Format {
+		case "common", "combined", "json":
+		default:
+			return nil, fmt.Errorf("invalid accessLog format %q: must be common, combined or json", accessLog.Format)
+		}
+		switch accessLog.Output {
+		case "stdout", "stderr":
+		case "file":
+			if accessLog.File == "" {
+				return nil, fmt.Errorf("invalid accessLog: file is required when output is file")
+			}
+		default:
+			return nil, fmt.Errorf("invalid accessLog output %q: must be stdout, stderr or file", accessLog.Output)
+		}
+	}
+
+	// Refuse log outputs the logger cannot write to, rather than falling back to stdout
+	switch strings.ToLower(config.Logging.Output) {
+	case "", "stdout", "stderr", "file", "fluentd":
+	case "kafka":
+		return nil, fmt.Errorf("invalid logging output %q: shipping logs to Kafka is not supported, use fluentd with a collector forwarding to Kafka", config.Logging.Output)
+	default:
+		return nil, fmt.Errorf("invalid logging output %q: must be stdout, stderr, file or fluentd", config.Logging.Output)
+	}
+
+	// Set default authorizer settings and refuse unknown types and effects
+	for i := range config.Authz {
+		authz := &config.Authz[i]
+		switch authz.Type {
+		case "static":
+			if authz.Default == "" {
+				authz.Default = "deny"
+			}
+			if authz.Default != "allow" && authz.Default != "deny" {
+				return nil, fmt.Errorf("invalid authz default %q for route %q: must be allow or deny", authz.Default, authz.Route)
+			}
+			for _, rule := range authz.Rules {
+				if rule.Effect != "allow" && rule.Effect != "deny" {
+					return nil, fmt.Errorf("invalid authz rule effect %q for route %q: must be allow or deny", rule.Effect, authz.Route)
+				}
+				if len(rule.Claims) > 0 && rule.Auth == "" {
+					return nil, fmt.Errorf("invalid authz rule for route %q: claims require an auth method", authz.Route)
+				}
+			}
+		case "http":
+			if authz.URL == "" {
+				return nil, fmt.Errorf("invalid authz for route %q: url is required", authz.Route)
+			}
+			if authz.TimeoutMs == 0 {
+				authz.TimeoutMs = 500
+			}
+			if authz.TimeoutMs < 0 {
+				return nil, fmt.Errorf("invalid authz timeoutMs %d for route %q: must not be negative", authz.TimeoutMs, authz.Route)
+			}
+		default:
+			return nil, fmt.Errorf("invalid authz type %q for route %q: must be static or http", authz.Type, authz.Route)
+		}
+	}
+
+	// Set the default annotation header prefix if annotations are enabled
+	if (config.Annotations.Backend || config.Annotations.Client) && config.Annotations.Prefix == "" {
+		config.Annotations.Prefix = "X-Conductor-"
+	}
+
+	// Set default capture settings if enabled and refuse incomplete ones
+	if capture := &config.Capture; capture.Enabled {
+		if capture.Format == "" {
+			capture.Format = "har"
+		}
+		if capture.Format != "har" && capture.Format != "raw" {
+			return nil, fmt.Errorf("invalid capture format %q: must be har or raw", capture.Format)
+		}
+		if capture.Directory == "" && capture.URL == "" {
+			return nil, fmt.Errorf("invalid capture configuration: directory or url is required")
+		}
+		if capture.MaxBodyBytes == 0 {
+			capture.MaxBodyBytes = 65536
+		}
+		if capture.BatchSize == 0 {
+			capture.BatchSize = 100
+		}
+		if capture.FlushInterval == 0 {
+			capture.FlushInterval = 10
+		}
+		if capture.QueueSize == 0 {
+			capture.QueueSize = 1000
+		}
+		if capture.MaxBodyBytes < 0 || capture.BatchSize < 0 || capture.FlushInterval < 0 || capture.QueueSize < 0 {
+			return nil, fmt.Errorf("invalid capture configuration: maxBodyBytes, batchSize, flushInterval and queueSize must be positive")
+		}
+	}
+
+	// Set default adaptive timeout settings if enabled and refuse inconsistent ones
+	if adaptive := &config.AdaptiveTimeout; adaptive.Enabled {
+		if adaptive.Multiplier == 0 {
+			adaptive.Multiplier = 3
+		}
+		if adaptive.FloorMs == 0 {
+			adaptive.FloorMs = 100
+		}
+		if adaptive.CeilingMs == 0 {
+			adaptive.CeilingMs = config.Timeout * 1000
+		}
+		if adaptive.Window == 0 {
+			adaptive.Window = 300
+		}
+		if adaptive.MinSamples == 0 {
+			adaptive.MinSamples = 100
+		}
+		if adaptive.Multiplier < 1 {
+			return nil, fmt.Errorf("invalid adaptiveTimeout multiplier %v: must be at least 1", adaptive.Multiplier)
+		}
+		if adaptive.FloorMs < 0 || adaptive.Window < 0 || adaptive.MinSamples < 0 {
+			return nil, fmt.Errorf("invalid adaptiveTimeout configuration: floorMs, window and minSamples must not be negative")
+		}
+		if adaptive.CeilingMs < adaptive.FloorMs {
+			return nil, fmt.Errorf("invalid adaptiveTimeout ceilingMs %d: must not be below floorMs %d", adaptive.CeilingMs, adaptive.FloorMs)
+		}
+	}
+
+	// Refuse a negative WebSocket idle timeout
+	if config.WebSocket.IdleTimeout < 0 {
+		return nil, fmt.Errorf("invalid webSocket idleTimeout %d: must not be negative", config.WebSocket.IdleTimeout)
+	}
+
+	// Refuse negative fan-out parallelism
+	for _, fanOut := range config.FanOut {
+		if fanOut.MaxParallel < 0 {
+			return nil, fmt.Errorf("invalid fanOut maxParallel %d for route %q: must not be negative", fanOut.MaxParallel, fanOut.Route)
+		}
+	}
+
+	// Refuse unknown response header policies, and merged cookies which cannot be split again
+	for _, policy := range config.ResponseHeaders.Policies {
+		if policy.Header == "" {
+			return nil, fmt.Errorf("invalid response header policy: header is required")
+		}
+		switch policy.Policy {
+		case "first", "last", "keep":
+		case "merge":
+			if strings.EqualFold(policy.Header, "Set-Cookie") {
+				return nil, fmt.Errorf("invalid response header policy for Set-Cookie: cookies cannot be merged")
+			}
+		default:
+			return nil, fmt.Errorf("invalid response header policy %q for %q: must be first, last, merge or keep", policy.Policy, policy.Header)
+		}
+	}
+
+	// Set default on-demand mirror headers and require authorization if enabled
+	if mirror := &config.OnDemandMirror; mirror.Enabled {
+		if mirror.Header == "" {
+			mirror.Header = "X-Conductor-Mirror-To"
+		}
+		if mirror.SummaryHeader == "" {
+			mirror.SummaryHeader = "X-Conductor-Mirror-Diff"
+		}
+		if mirror.Require == "" {
+			return nil, fmt.Errorf("invalid onDemandMirror: require must name the auth methods allowed to mirror requests")
+		}
+	}
+
+	// Refuse content type allowlists that would reject every body
+	for _, route := range config.ContentTypes {
+		if len(route.Allow) == 0 {
+			return nil, fmt.Errorf("invalid contentTypes for route %q: allow must list at least one media type", route.Route)
+		}
+		for _, mediaType := range route.Allow {
+			if _, _, err := mime.ParseMediaType(mediaType); err != nil || !strings.Contains(mediaType, "/") {
+				return nil, fmt.Errorf("invalid content type %q for route %q", mediaType, route.Route)
+			}
+		}
+	}
+
+	// Set default mirror shaping bursts and refuse rates that cannot apply
+	for i := range config.MirrorShaping {
+		shape := &config.MirrorShaping[i]
+		if shape.RequestsPerSecond <= 0 {
+			return nil, fmt.Errorf("invalid mirrorShaping requestsPerSecond %v for service %q: must be positive", shape.RequestsPerSecond, shape.Service)
+		}
+		if shape.Burst < 0 || shape.MaxQueueMs < 0 {
+			return nil, fmt.Errorf("invalid mirrorShaping for service %q: burst and maxQueueMs must not be negative", shape.Service)
+		}
+		if shape.Burst == 0 {
+			shape.Burst = max(1, int(shape.RequestsPerSecond))
+		}
+	}
+
+	// Set default body peek limit for match predicates
+	if config.BodyPeekBytes < 0 {
+		return nil, fmt.Errorf("invalid bodyPeekBytes %d: must not be negative", config.BodyPeekBytes)
+	}
+	if config.BodyPeekBytes == 0 {
+		config.BodyPeekBytes = 64 << 10
+	}
+
+	// Set default read pinning settings and require a signing key if enabled
+	if pinning := &config.ReadYourWrites; pinning.Enabled {
+		if pinning.Secret == "" {
+			return nil, fmt.Errorf("invalid readYourWrites: secret is required to sign pin tokens")
+		}
+		if pinning.TTL < 0 {
+			return nil, fmt.Errorf("invalid readYourWrites ttl %d: must not be negative", pinning.TTL)
+		}
+		if pinning.TTL == 0 {
+			pinning.TTL = 5
+		}
+		if pinning.Cookie == "" {
+			pinning.Cookie = "conductor_pin"
+		}
+		if pinning.Header == "" {
+			pinning.Header = "X-Conductor-Pin"
+		}
+	}
+
+	// Set default assertion actions and refuse unknown ones
+	for i := range config.Assertions {
+		assertion := &config.Assertions[i]
+		if assertion.Action == "" {
+			assertion.Action = "log"
+		}
+		if assertion.Action != "log" && assertion.Action != "count" && assertion.Action != "error" {
+			return nil, fmt.Errorf("invalid assertion action %q for route %q: must be log, count or error", assertion.Action, assertion.Route)
+		}
+		if assertion.ErrorStatus == 0 {
+			assertion.ErrorStatus = 502
+		}
+		if assertion.ErrorStatus < 400 || assertion.ErrorStatus > 599 {
+			return nil, fmt.Errorf("invalid assertion errorStatus %d for route %q: must be an error status", assertion.ErrorStatus, assertion.Route)
+		}
+	}
+
+	// Set default CORS methods and refuse negative preflight lifetimes
+	for i := range config.CORS {
+		cors := &config.CORS[i]
+		if len(cors.AllowMethods) == 0 {
+			cors.AllowMethods = []string{"GET", "HEAD", "POST"}
+		}
+		if cors.MaxAge < 0 {
+			return nil, fmt.Errorf("invalid CORS maxAge %d for route %q: must not be negative", cors.MaxAge, cors.Route)
+		}
+		// Echoing any origin with credentials would let every site read responses as the user
+		if cors.AllowCredentials && slices.Contains(cors.AllowOrigins, "*") {
+			return nil, fmt.Errorf("invalid CORS for route %q: allowCredentials requires listed origins, not \"*\"", cors.Route)
+		}
+	}
+
+	// Set default readiness endpoint if enabled but not configured
+	if config.Readiness.Enabled && config.Readiness.Endpoint == "" {
+		config.Readiness.Endpoint = "/readyz"
+	}
+
+	// Set default method override settings if enabled but not configured
+	if config.MethodOverride.Enabled {
+		if config.MethodOverride.Header == "" {
+			config.MethodOverride.Header = "X-HTTP-Method-Override"
+		}
+		if len(config.MethodOverride.Methods) == 0 {
+			config.MethodOverride.Methods = []string{"PUT", "PATCH", "DELETE"}
+		}
+	}
+
+	// Set default loop detection settings if enabled but not configured
+	if config.LoopDetection.Enabled {
+		if config.LoopDetection.Header == "" {
+			config.LoopDetection.Header = "X-Conductor-Loop"
+		}
+		if config.LoopDetection.MaxHops == 0 {
+			config.LoopDetection.MaxHops = 10
+		}
+	}
+
+	// Set default compression threshold if enabled but not configured
+	if config.Compression.Enabled && config.Compression.MinSize == 0 {
+		config.Compression.MinSize = 1024
+	}
+	if config.Compression.Enabled && config.Compression.MaxDecompressedBytes == 0 {
+		config.Compression.MaxDecompressedBytes = 64 << 20
+	}
+	if config.Compression.MaxDecompressedBytes < 0 {
+		return nil, fmt.Errorf("invalid compression maxDecompressedBytes %d: must not be negative", config.Compression.MaxDecompressedBytes)
+	}
+
+	// Set default quota settings if enabled but not configured
+	if config.Quota.Enabled {
+		if config.Quota.Header == "" {
+			config.Quota.Header = "X-Tenant-ID"
+		}
+		if config.Quota.DefaultTenant == "" {
+			config.Quota.DefaultTenant = "anonymous"
+		}
+		if config.Quota.Mode == "" {
+			config.Quota.Mode = "track"
+		}
+		if config.Quota.Mode != "track" && config.Quota.Mode != "enforce" {
+			return nil, fmt.Errorf("invalid quota mode %q: must be track or enforce", config.Quota.Mode)
+		}
+		if identity := config.Quota.Identity; identity != nil && identity.Auth != "" && identity.Claim == "" {
+			identity.Claim = "sub"
+		}
+	}
+
+	// Set default Retry-After for shed requests if a cap is configured
+	if config.Overload.MaxInFlight > 0 && config.Overload.RetryAfter == 0 {
+		config.Overload.RetryAfter = 1
+	}
+
+	// Set default budget action and refuse unknown ones
+	for i := range config.Budgets {
+		budget := &config.Budgets[i]
+		if budget.Action == "" {
+			budget.Action = "log"
+		}
+		if budget.Action != "log" && budget.Action != "count" && budget.Action != "enforce" {
+			return nil, fmt.Errorf("invalid budget action %q for route %q: must be log, count or enforce", budget.Action, budget.Route)
+		}
+	}
+
+	// Set default admin endpoint if enabled but not configured
+	if config.Admin.Enabled && config.Admin.Endpoint == "" {
+		config.Admin.Endpoint = "/admin"
+	}
+	if (config.Admin.Username == "") != (config.Admin.Password == "") {
+		return nil, fmt.Errorf("invalid admin: username and password must be set together")
+	}
+	// Admin endpoints change routing and inject faults, so they are never left open
+	if config.Admin.Enabled && config.Admin.Token == "" && config.Admin.Username == "" {
+		return nil, fmt.Errorf("invalid admin: enabled admin endpoints require a token or username and password")
+	}
+
+	// Set default response cache settings if enabled but not configured
+	if config.Cache.Enabled {
+		if config.Cache.MaxEntries == 0 {
+			config.Cache.MaxEntries = 1000
+		}
+		if config.Cache.MaxBodyBytes == 0 {
+			config.Cache.MaxBodyBytes = 1 << 20
+		}
+	}
+	for _, route := range config.Cache.Routes {
+		if route.StaleWhileRevalidate < 0 || route.StaleIfError < 0 {
+			return nil, fmt.Errorf("invalid cache stale windows for route %q: must not be negative", route.Route)
+		}
+	}
+
+	// Set default comparison settings if enabled but not configured
+	if config.Comparison.Enabled {
+		if config.Comparison.Workers == 0 {
+			config.Comparison.Workers = 2
+		}
+		if config.Comparison.QueueSize == 0 {
+			config.Comparison.QueueSize = 1000
+		}
+	}
+	if sampling := &config.Comparison.Sampling; sampling.MaxBytes > 0 {
+		if sampling.Mode == "" {
+			sampling.Mode = "prefix"
+		}
+		if sampling.Mode != "prefix" && sampling.Mode != "structure" {
+			return nil, fmt.Errorf("invalid comparison sampling mode %q: must be prefix or structure", sampling.Mode)
+		}
+		if sampling.SampleItems < 0 {
+			return nil, fmt.Errorf("invalid comparison sampleItems %d: must not be negative", sampling.SampleItems)
+		}
+		if sampling.SampleItems == 0 {
+			sampling.SampleItems = 3
+		}
+		if sampling.MaxDecodeBytes < 0 {
+			return nil, fmt.Errorf("invalid comparison maxDecodeBytes %d: must not be negative", sampling.MaxDecodeBytes)
+		}
+		if sampling.MaxDecodeBytes == 0 {
+			sampling.MaxDecodeBytes = 16 << 20
+		}
+	}
+	if err := validateNormalize(config.Comparison.Normalize); err != nil {
+		return nil, err
+	}
+	for _, pair := range config.Comparison.Pairs {
+		if pair.Shadow == "" {
+			return nil, fmt.Errorf("invalid comparison pair: shadow is required")
+		}
+		if pair.Normalize != nil {
+			if err := validateNormalize(*pair.Normalize); err != nil {
+				return nil, fmt.Errorf("comparison pair for %q: %w", pair.Shadow, err)
+			}
+		}
+	}
+
+	// Set default health tracking settings if not configured
+	if config.Health.FailureThreshold == 0 {
+		config.Health.FailureThreshold = 3
+	}
+	if config.Health.RetryAfter == 0 {
+		config.Health.RetryAfter = 30
+	}
+
+	// Set default active health check settings for services that configure one
+	for _, service := range config.Services {
+		check := service.HealthCheck
+		if check == nil {
+			continue
+		}
+		if check.Type == "" {
+			check.Type = "http"
+		}
+		if check.Type != "http" && check.Type != "grpc" {
+			return nil, fmt.Errorf("invalid health check type %q for service %q: must be http or grpc", check.Type, service.Name)
+		}
+		if check.Type == "http" && check.Path == "" {
+			check.Path = "/health"
+		}
+		if check.Interval == 0 {
+			check.Interval = 10
+		}
+		if check.Timeout == 0 {
+			check.Timeout = 2
+		}
+		if check.History == 0 {
+			check.History = 100
+		}
+		if check.History < 0 {
+			return nil, fmt.Errorf("invalid health check history %d for service %q: must be positive", check.History, service.Name)
+		}
+	}
+	for _, service := range config.Services {
+		if dial := service.Dial; dial != nil && (dial.MaxRequests < 0 || dial.MaxAge < 0) {
+			return nil, fmt.Errorf("invalid connection recycling for service %q: maxRequests and maxAge must not be negative", service.Name)
+		}
+	}
+
+	// Set default retry settings for services that retry and refuse unknown failures
+	for i := range config.Services {
+		service := &config.Services[i]
+		if service.Retries < 0 || service.RetryBackoff < 0 {
+			return nil, fmt.Errorf("invalid retries for service %q: retries and retryBackoff must not be negative", service.Name)
+		}
+		if service.Retries == 0 {
+			continue
+		}
+		if service.RetryBackoff == 0 {
+			service.RetryBackoff = 100
+		}
+		if len(service.RetryOn) == 0 {
+			service.RetryOn = []string{"connection", "502", "503", "504"}
+		}
+		for _, failure := range service.RetryOn {
+			if !validRetryOn(failure) {
+				return nil, fmt.Errorf("invalid retryOn %q for service %q: must be a status code, a class such as 5xx, connection or timeout", failure, service.Name)
+			}
+		}
+	}
+
+	// Set default credentials settings for services that obtain tokens
+	for i := range config.Services {
+		credentials := config.Services[i].Credentials
+		if credentials == nil {
+			continue
+		}
+		if credentials.Header == "" {
+			credentials.Header = "Authorization"
+		}
+		if credentials.Scheme == "" && strings.EqualFold(credentials.Header, "Authorization") {
+			credentials.Scheme = "Bearer"
+		}
+		if credentials.Type == "oauth2" && credentials.ClientAuth == "" {
+			credentials.ClientAuth = "basic"
+		}
+		if credentials.Type == "oauth2" && credentials.RefreshBefore == 0 {
+			credentials.RefreshBefore = 60
+		}
+		if credentials.RefreshInterval == 0 {
+			credentials.RefreshInterval = 300
+			if credentials.Type == "file" {
+				credentials.RefreshInterval = 30
+			}
+		}
+	}
+
+	// Set default dedup header if enabled but not configured
+	if config.Dedup.Enabled && config.Dedup.Header == "" {
+		config.Dedup.Header = "Idempotency-Key"
+	}
+	if config.Dedup.Identity.Auth != "" && config.Dedup.Identity.Claim == "" {
+		config.Dedup.Identity.Claim = "sub"
+	}
+
+	// Set default SLO settings if enabled but not configured
+	if config.SLO.Enabled {
+		if config.SLO.Endpoint == "" {
+			config.SLO.Endpoint = "/slo"
+		}
+		if config.SLO.Window == 0 {
+			config.SLO.Window = 300
+		}
+		for _, target := range config.SLO.Targets {
+			if target.Objective <= 0 || target.Objective >= 1 {
+				return nil, fmt.Errorf("invalid SLO objective %v for route %q: must be between 0 and 1", target.Objective, target.Route)
+			}
+		}
+	}
+
+	// Refuse push protocols other than the Pushgateway's, rather than pushing to a
+	// remote-write endpoint that cannot accept it
+	switch config.Metrics.Push.Protocol {
+	case "":
+		config.Metrics.Push.Protocol = "pushgateway"
+	case "pushgateway":
+	case "remoteWrite", "remote-write", "remote_write":
+		return nil, fmt.Errorf("invalid metrics push protocol %q: Prometheus remote-write is not supported, push to a Pushgateway or let Prometheus scrape the metrics endpoint", config.Metrics.Push.Protocol)
+	default:
+		return nil, fmt.Errorf("invalid metrics push protocol %q: must be pushgateway", config.Metrics.Push.Protocol)
+	}
+
 	// Set default metrics settings if enabled but not configured
 	if config.Metrics.Enabled {
 		if config.Metrics.Endpoint == "" {
 			config.Metrics.Endpoint = "/metrics"
 		}
+		if config.Metrics.Push.URL != "" {
+			if config.Metrics.Push.Job == "" {
+				config.Metrics.Push.Job = "go-conductor"
+			}
+			if config.Metrics.Push.Instance == "" {
+				config.Metrics.Push.Instance, _ = os.Hostname()
+			}
+			if config.Metrics.Push.Interval == 0 {
+				config.Metrics.Push.Interval = 15
+			}
+		}
 	}
 
 	// Validate that at least one service is marked as primary
@@ -79,5 +1542,204 @@ func Load(filename string) (*Config, error) {
 		config.Services[0].Primary = true
 	}
 
+	// Refuse to start with duplicate names or ambiguous routes
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
+
+// validateNormalize refuses comparison normalization rules that cannot be applied
+func validateNormalize(normalize NormalizeConfig) error {
+	if precision := normalize.FloatPrecision; precision != nil && *precision < 0 {
+		return fmt.Errorf("invalid comparison floatPrecision %d: must not be negative", *precision)
+	}
+	for _, codec := range normalize.Codecs {
+		if _, _, err := mime.ParseMediaType(codec.ContentType); err != nil {
+			return fmt.Errorf("invalid codec content type %q: %w", codec.ContentType, err)
+		}
+		switch codec.Codec {
+		case "json", "xml", "form":
+		case "protobuf":
+			if codec.Descriptors == "" || codec.Message == "" {
+				return fmt.Errorf("invalid protobuf codec for %q: descriptors and message are required", codec.ContentType)
+			}
+		default:
+			return fmt.Errorf("invalid codec %q for %q: must be json, xml, form or protobuf", codec.Codec, codec.ContentType)
+		}
+	}
+	return nil
+}
+
+// validRetryOn reports whether a retryOn entry names a status code, a status class such
+// as 5xx, or a kind of request failure
+func validRetryOn(failure string) bool {
+	switch {
+	case failure == "connection" || failure == "timeout":
+		return true
+	case len(failure) == 3 && failure[1:] == "xx":
+		return failure[0] >= '1' && failure[0] <= '5'
+	default:
+		code, err := strconv.Atoi(failure)
+		return err == nil && code >= 100 && code <= 599
+	}
+}
+
+// routeKey identifies the route a service registers, mirroring the precedence used by the proxy
+func (s Service) routeKey() (kind string, path string) {
+	switch {
+	case s.PathExact != "":
+		return "pathExact", s.PathExact
+	case s.PathRegex != "":
+		return "pathRegex", s.PathRegex
+	case s.PathPrefix != "":
+		return "pathPrefix", s.PathPrefix
+	case s.Path != "":
+		return "path", s.Path
+	default:
+		return "", ""
+	}
+}
+
+// MatchCondition describes the request predicates of a service, empty if it has none.
+// Services with the same predicates describe them alike.
+func (s Service) MatchCondition() string {
+	var terms []string
+	if s.Match != "" {
+		terms = append(terms, s.Match)
+	}
+	var predicates []string
+	for name, value := range s.MatchHeaders {
+		predicates = append(predicates, fmt.Sprintf("header %s: %s", textproto.CanonicalMIMEHeaderKey(name), value))
+	}
+	for name, value := range s.MatchCookies {
+		predicates = append(predicates, fmt.Sprintf("cookie %s=%s", name, value))
+	}
+	sort.Strings(predicates)
+	return strings.Join(append(terms, predicates...), " AND ")
+}
+
+// variableName matches valid template variable names
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks the service definitions for duplicate names, invalid variables and routes
+// claimed by more than one primary service, reporting every problem found
+func (c *Config) Validate() error {
+	var problems []string
+
+	// Service names must be unique
+	namesSeen := make(map[string]bool)
+	for _, service := range c.Services {
+		if service.Name == "" {
+			continue
+		}
+		if namesSeen[service.Name] {
+			problems = append(problems, fmt.Sprintf("duplicate service name %q", service.Name))
+		}
+		namesSeen[service.Name] = true
+	}
+
+	// Variables must name a known source
+	for _, service := range c.Services {
+		for _, variable := range service.Variables {
+			switch {
+			case !variableName.MatchString(variable.Name):
+				problems = append(problems, fmt.Sprintf("service %q: invalid variable name %q", service.Name, variable.Name))
+			case variable.From != "header" && variable.From != "query" && variable.From != "claim":
+				problems = append(problems, fmt.Sprintf("service %q: variable %q has invalid source %q: must be header, query or claim", service.Name, variable.Name, variable.From))
+			case variable.Key == "":
+				problems = append(problems, fmt.Sprintf("service %q: variable %q has no key", service.Name, variable.Name))
+			case variable.From == "claim" && c.Auth.Methods[variable.Auth].Type != "jwt":
+				problems = append(problems, fmt.Sprintf("service %q: variable %q must name a jwt auth method", service.Name, variable.Name))
+			}
+		}
+	}
+
+	// Path regular expressions must compile, and their named groups become variables
+	for _, service := range c.Services {
+		if service.PathRegex == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(service.PathRegex)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("service %q: invalid pathRegex: %v", service.Name, err))
+			continue
+		}
+		for _, name := range pattern.SubexpNames() {
+			if name != "" && !variableName.MatchString(name) {
+				problems = append(problems, fmt.Sprintf("service %q: pathRegex group %q is not a valid variable name", service.Name, name))
+			}
+		}
+	}
+
+	// Mirrors run in the background, so they cannot answer the client
+	for _, service := range c.Services {
+		if service.Mirror && service.Primary {
+			problems = append(problems, fmt.Sprintf("service %q: a primary service cannot be a mirror", service.Name))
+		}
+		if service.MirrorTimeout < 0 {
+			problems = append(problems, fmt.Sprintf("service %q: mirrorTimeout must not be negative", service.Name))
+		}
+		if percent := service.MirrorPercent; percent != nil && (*percent < 0 || *percent > 100) {
+			problems = append(problems, fmt.Sprintf("service %q: mirrorPercent must be between 0 and 100", service.Name))
+		}
+		if service.Primary && (service.MirrorPercent != nil || service.MirrorSampleHeader != "") {
+			problems = append(problems, fmt.Sprintf("service %q: mirrorPercent and mirrorSampleHeader only apply to non-primary services", service.Name))
+		}
+		if service.MaxResponseBytes < 0 {
+			problems = append(problems, fmt.Sprintf("service %q: maxResponseBytes must not be negative", service.Name))
+		}
+	}
+
+	// Credentials must say where the token comes from
+	for _, service := range c.Services {
+		credentials := service.Credentials
+		if credentials == nil {
+			continue
+		}
+		switch {
+		case credentials.Type != "oauth2" && credentials.Type != "file":
+			problems = append(problems, fmt.Sprintf("service %q: invalid credentials type %q: must be oauth2 or file", service.Name, credentials.Type))
+		case credentials.Type == "oauth2" && (credentials.TokenURL == "" || credentials.ClientID == ""):
+			problems = append(problems, fmt.Sprintf("service %q: oauth2 credentials require tokenURL and clientID", service.Name))
+		case credentials.Type == "oauth2" && credentials.ClientAuth != "" && credentials.ClientAuth != "basic" && credentials.ClientAuth != "body":
+			problems = append(problems, fmt.Sprintf("service %q: invalid credentials clientAuth %q: must be basic or body", service.Name, credentials.ClientAuth))
+		case credentials.Type == "file" && credentials.File == "":
+			problems = append(problems, fmt.Sprintf("service %q: file credentials require a file", service.Name))
+		case credentials.RefreshBefore < 0 || credentials.RefreshInterval < 0:
+			problems = append(problems, fmt.Sprintf("service %q: credentials refreshBefore and refreshInterval must not be negative", service.Name))
+		}
+	}
+
+	// Each route may have at most one primary service, counting services with the same
+	// match predicates separately since they replace the others
+	type route struct{ kind, path, match string }
+	var routes []route
+	primaries := make(map[route][]string)
+	for _, service := range c.Services {
+		kind, path := service.routeKey()
+		if kind == "" || !service.Primary {
+			continue
+		}
+		key := route{kind, path, service.MatchCondition()}
+		if _, ok := primaries[key]; !ok {
+			routes = append(routes, key)
+		}
+		primaries[key] = append(primaries[key], service.Name)
+	}
+	for _, key := range routes {
+		if names := primaries[key]; len(names) > 1 {
+			where := fmt.Sprintf("%s %q", key.kind, key.path)
+			if key.match != "" {
+				where += fmt.Sprintf(" matching %q", key.match)
+			}
+			problems = append(problems, fmt.Sprintf("%s has multiple primary services: %s", where, strings.Join(names, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid service configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
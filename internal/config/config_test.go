@@ -0,0 +1,315 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes the given YAML to a temporary config file and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadListenAddress(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		expectListen string
+		expectError  bool
+	}{
+		{
+			name:         "default",
+			content:      "services: []\n",
+			expectListen: ":8080",
+		},
+		{
+			name:         "legacy port",
+			content:      "port: 9090\n",
+			expectListen: ":9090",
+		},
+		{
+			name:         "loopback",
+			content:      "listen: \"127.0.0.1:8080\"\n",
+			expectListen: "127.0.0.1:8080",
+		},
+		{
+			name:         "ipv6",
+			content:      "listen: \"[::]:8443\"\nport: 9090\n",
+			expectListen: "[::]:8443",
+		},
+		{
+			name:        "missing port",
+			content:     "listen: \"127.0.0.1\"\n",
+			expectError: true,
+		},
+		{
+			name:         "named listener",
+			content:      "listeners:\n  - name: private\n    address: \"10.0.0.5:8081\"\nservices:\n  - name: admin\n    url: http://admin\n    pathPrefix: /internal\n    listeners: [private]\n",
+			expectListen: ":8080",
+		},
+		{
+			name:        "unknown listener",
+			content:     "services:\n  - name: admin\n    url: http://admin\n    pathPrefix: /internal\n    listeners: [private]\n",
+			expectError: true,
+		},
+		{
+			name:        "listener named default",
+			content:     "listeners:\n  - name: default\n    address: \":8081\"\n",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, test.content))
+			if test.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got: %v", err)
+			}
+
+			if cfg.Listen != test.expectListen {
+				t.Errorf("Expected listen address %s, got %s", test.expectListen, cfg.Listen)
+			}
+		})
+	}
+}
+
+func TestLoadAdminCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectError bool
+	}{
+		{name: "disabled", content: "admin:\n  enabled: false\n"},
+		{name: "token", content: "admin:\n  enabled: true\n  token: secret\n"},
+		{name: "basic auth", content: "admin:\n  enabled: true\n  username: ops\n  password: secret\n"},
+		{name: "no credentials", content: "admin:\n  enabled: true\n  listen: \"127.0.0.1:9090\"\n", expectError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, test.content))
+			if test.expectError && err == nil {
+				t.Errorf("Expected error, but got nil")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("Expected no error, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadLoggingOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectError string
+	}{
+		{name: "default", content: "services: []\n"},
+		{name: "fluentd", content: "logging:\n  output: fluentd\n  fluentd:\n    address: \"fluent-bit:24224\"\n"},
+		{name: "kafka", content: "logging:\n  output: kafka\n", expectError: "Kafka is not supported"},
+		{name: "unknown", content: "logging:\n  output: syslog\n", expectError: "must be stdout, stderr, file or fluentd"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, test.content))
+			if test.expectError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, but got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectError) {
+				t.Errorf("Expected an error containing %q, got %v", test.expectError, err)
+			}
+		})
+	}
+}
+
+func TestLoadMetricsPushProtocol(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectError string
+	}{
+		{name: "default", content: "metrics:\n  enabled: true\n  push:\n    url: http://pushgateway:9091\n"},
+		{name: "pushgateway", content: "metrics:\n  enabled: true\n  push:\n    url: http://pushgateway:9091\n    protocol: pushgateway\n"},
+		{name: "remote-write", content: "metrics:\n  enabled: true\n  push:\n    url: http://prometheus:9090/api/v1/write\n    protocol: remoteWrite\n",
+			expectError: "remote-write is not supported"},
+		{name: "unknown", content: "metrics:\n  push:\n    protocol: otlp\n", expectError: "must be pushgateway"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, test.content))
+			if test.expectError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, but got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectError) {
+				t.Errorf("Expected an error containing %q, got %v", test.expectError, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	overHundred := 150.0
+	tests := []struct {
+		name        string
+		services    []Service
+		expectError []string
+	}{
+		{
+			name: "valid routes",
+			services: []Service{
+				{Name: "api-primary", PathPrefix: "/api", Primary: true},
+				{Name: "api-shadow", PathPrefix: "/api"},
+				{Name: "web", PathPrefix: "/web", Primary: true},
+			},
+		},
+		{
+			name: "duplicate names",
+			services: []Service{
+				{Name: "api", PathPrefix: "/api", Primary: true},
+				{Name: "api", PathPrefix: "/web", Primary: true},
+			},
+			expectError: []string{`duplicate service name "api"`},
+		},
+		{
+			name: "conflicting exact primaries",
+			services: []Service{
+				{Name: "a", PathExact: "/health", Primary: true},
+				{Name: "b", PathExact: "/health", Primary: true},
+			},
+			expectError: []string{`pathExact "/health" has multiple primary services: a, b`},
+		},
+		{
+			name: "conflicting prefix primaries",
+			services: []Service{
+				{Name: "a", PathPrefix: "/api", Primary: true},
+				{Name: "b", PathPrefix: "/api", Primary: true},
+				{Name: "b", PathPrefix: "/web", Primary: true},
+			},
+			expectError: []string{
+				`duplicate service name "b"`,
+				`pathPrefix "/api" has multiple primary services: a, b`,
+			},
+		},
+		{
+			name: "conditional primaries",
+			services: []Service{
+				{Name: "a", PathPrefix: "/payments", Primary: true},
+				{Name: "b", PathPrefix: "/payments", Primary: true, Match: `$.type == "refund"`},
+				{Name: "c", PathPrefix: "/payments", Primary: true, Match: `$.type == "refund"`},
+			},
+			expectError: []string{`pathPrefix "/payments" matching "$.type == \"refund\"" has multiple primary services: b, c`},
+		},
+		{
+			name: "invalid variables",
+			services: []Service{
+				{Name: "a", PathPrefix: "/api", Primary: true, Variables: []VariableConfig{
+					{Name: "user-id", From: "header", Key: "X-User"},
+					{Name: "region", From: "cookie", Key: "region"},
+					{Name: "tenant", From: "claim", Key: "tenant", Auth: "missing"},
+				}},
+			},
+			expectError: []string{
+				`service "a": invalid variable name "user-id"`,
+				`service "a": variable "region" has invalid source "cookie"`,
+				`service "a": variable "tenant" must name a jwt auth method`,
+			},
+		},
+		{
+			name: "header and cookie primaries",
+			services: []Service{
+				{Name: "a", PathPrefix: "/api", Primary: true},
+				{Name: "b", PathPrefix: "/api", Primary: true, MatchHeaders: map[string]string{"X-Beta": "true"}},
+				{Name: "c", PathPrefix: "/api", Primary: true, MatchCookies: map[string]string{"canary": "*"}},
+				{Name: "d", PathPrefix: "/api", Primary: true, MatchHeaders: map[string]string{"x-beta": "true"}},
+			},
+			expectError: []string{`pathPrefix "/api" matching "header X-Beta: true" has multiple primary services: b, d`},
+		},
+		{
+			name: "invalid path regex",
+			services: []Service{
+				{Name: "a", PathRegex: `/users/(?P<id>[0-9]+`, Primary: true},
+				{Name: "b", PathRegex: `/orders/(?P<1st>[0-9]+)`, Primary: true},
+				{Name: "c", PathRegex: `/items/(?P<id>[0-9]+)`, Primary: true},
+				{Name: "d", PathRegex: `/items/(?P<id>[0-9]+)`, Primary: true},
+			},
+			expectError: []string{
+				`service "a": invalid pathRegex`,
+				`service "b": pathRegex group "1st" is not a valid variable name`,
+				`pathRegex "/items/(?P<id>[0-9]+)" has multiple primary services: c, d`,
+			},
+		},
+		{
+			name: "primary mirror",
+			services: []Service{
+				{Name: "a", PathPrefix: "/api", Primary: true, Mirror: true},
+				{Name: "b", PathPrefix: "/api", Mirror: true, MirrorTimeout: -1, MaxResponseBytes: -1},
+				{Name: "c", PathPrefix: "/users", Primary: true, MirrorSampleHeader: "X-User-ID"},
+				{Name: "d", PathPrefix: "/users", MirrorPercent: &overHundred},
+			},
+			expectError: []string{
+				`service "a": a primary service cannot be a mirror`,
+				`service "b": mirrorTimeout must not be negative`,
+				`service "c": mirrorPercent and mirrorSampleHeader only apply to non-primary services`,
+				`service "d": mirrorPercent must be between 0 and 100`,
+				`service "b": maxResponseBytes must not be negative`,
+			},
+		},
+		{
+			name: "invalid credentials",
+			services: []Service{
+				{Name: "a", PathPrefix: "/a", Primary: true, Credentials: &CredentialsConfig{Type: "vault"}},
+				{Name: "b", PathPrefix: "/b", Primary: true, Credentials: &CredentialsConfig{Type: "oauth2", ClientID: "conductor"}},
+				{Name: "c", PathPrefix: "/c", Primary: true, Credentials: &CredentialsConfig{Type: "file"}},
+				{Name: "d", PathPrefix: "/d", Primary: true, Credentials: &CredentialsConfig{Type: "file", File: "/run/token"}},
+			},
+			expectError: []string{
+				`service "a": invalid credentials type "vault"`,
+				`service "b": oauth2 credentials require tokenURL and clientID`,
+				`service "c": file credentials require a file`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &Config{Services: test.services}
+			err := cfg.Validate()
+
+			if len(test.expectError) == 0 {
+				if err != nil {
+					t.Errorf("Expected no error, but got: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected error, but got nil")
+			}
+			for _, expected := range test.expectError {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected error to contain %q, got: %v", expected, err)
+				}
+			}
+		})
+	}
+}
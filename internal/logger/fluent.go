@@ -0,0 +1,274 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// FluentConfig defines how logs are shipped with the Fluentd forward protocol
+type FluentConfig struct {
+	// Address is the host:port of the Fluentd or Fluent Bit forward input
+	Address string `yaml:"address"`
+	// Tag is attached to every shipped record
+	Tag string `yaml:"tag,omitempty"`
+	// BufferSize is the number of records held while the collector is unreachable
+	BufferSize int `yaml:"bufferSize,omitempty"`
+	// DropWhenFull discards new records when the buffer is full instead of blocking the caller
+	DropWhenFull bool `yaml:"dropWhenFull,omitempty"`
+}
+
+// Fluent forward defaults
+const (
+	defaultFluentTag        = "go-conductor"
+	defaultFluentBufferSize = 8192
+	fluentDialTimeout       = 5 * time.Second
+	fluentMaxBackoff        = 30 * time.Second
+	fluentFlushTimeout      = 5 * time.Second
+)
+
+// errFluentClosed is returned for writes after the writer has been closed
+var errFluentClosed = errors.New("fluent writer closed")
+
+// fluentWriter ships each log line to a Fluentd forward input. Records are queued in
+// a bounded buffer and sent by a background goroutine that reconnects with backoff;
+// when the buffer is full writes block, or are dropped if so configured.
+type fluentWriter struct {
+	address      string
+	tag          string
+	dropWhenFull bool
+	queue        chan []byte
+	done         chan struct{} // Closed when no more records are accepted
+	stopped      chan struct{} // Closed when the sender has exited
+	closeOnce    sync.Once
+	dial         func(address string) (net.Conn, error)
+}
+
+// newFluentWriter creates a writer and starts its sender
+func newFluentWriter(cfg FluentConfig) (*fluentWriter, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("fluentd output requires an address")
+	}
+	if cfg.Tag == "" {
+		cfg.Tag = defaultFluentTag
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultFluentBufferSize
+	}
+
+	w := &fluentWriter{
+		address:      cfg.Address,
+		tag:          cfg.Tag,
+		dropWhenFull: cfg.DropWhenFull,
+		queue:        make(chan []byte, cfg.BufferSize),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+		dial: func(address string) (net.Conn, error) {
+			return net.DialTimeout("tcp", address, fluentDialTimeout)
+		},
+	}
+	go w.run()
+	return w, nil
+}
+
+// Write encodes a JSON log line as a forward protocol message and queues it
+func (w *fluentWriter) Write(p []byte) (int, error) {
+	var record map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	writeMsgpack(&buf, []interface{}{w.tag, time.Now().Unix(), record})
+	msg := buf.Bytes()
+
+	select {
+	case <-w.done:
+		return 0, errFluentClosed
+	default:
+	}
+
+	if w.dropWhenFull {
+		select {
+		case w.queue <- msg:
+		default:
+		}
+		return len(p), nil
+	}
+
+	select {
+	case w.queue <- msg:
+		return len(p), nil
+	case <-w.done:
+		return 0, errFluentClosed
+	}
+}
+
+// Close stops accepting records and waits briefly for the buffer to drain
+func (w *fluentWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+
+	select {
+	case <-w.stopped:
+	case <-time.After(fluentFlushTimeout):
+	}
+	return nil
+}
+
+// run sends queued records, reconnecting with exponential backoff on failure. Once
+// closed, it drains the buffer and exits, giving up if the collector is unreachable.
+func (w *fluentWriter) run() {
+	defer close(w.stopped)
+
+	var conn net.Conn
+	var pending []byte
+	backoff := 100 * time.Millisecond
+
+	for {
+		if pending == nil {
+			select {
+			case pending = <-w.queue:
+			case <-w.done:
+				select {
+				case pending = <-w.queue:
+				default:
+					if conn != nil {
+						conn.Close()
+					}
+					return
+				}
+			}
+		}
+
+		if conn == nil {
+			var err error
+			conn, err = w.dial(w.address)
+			if err != nil {
+				conn = nil
+				if !w.sleep(backoff) {
+					return
+				}
+				backoff = min(backoff*2, fluentMaxBackoff)
+				continue
+			}
+			backoff = 100 * time.Millisecond
+		}
+
+		if _, err := conn.Write(pending); err != nil {
+			conn.Close()
+			conn = nil
+			continue
+		}
+		pending = nil
+	}
+}
+
+// sleep waits for d, returning false if the writer was closed in the meantime
+func (w *fluentWriter) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// writeMsgpack encodes the JSON-decoded value v in MessagePack format
+func writeMsgpack(buf *bytes.Buffer, v interface{}) {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if val {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			writeMsgpackInt(buf, i)
+		} else if f, err := val.Float64(); err == nil {
+			writeMsgpackFloat(buf, f)
+		} else {
+			writeMsgpackString(buf, val.String())
+		}
+	case int64:
+		writeMsgpackInt(buf, val)
+	case float64:
+		writeMsgpackFloat(buf, val)
+	case string:
+		writeMsgpackString(buf, val)
+	case []interface{}:
+		writeMsgpackHeader(buf, len(val), 0x90, 0xdc, 0xdd)
+		for _, item := range val {
+			writeMsgpack(buf, item)
+		}
+	case map[string]interface{}:
+		writeMsgpackHeader(buf, len(val), 0x80, 0xde, 0xdf)
+		for k, item := range val {
+			writeMsgpackString(buf, k)
+			writeMsgpack(buf, item)
+		}
+	default:
+		writeMsgpackString(buf, fmt.Sprint(val))
+	}
+}
+
+// writeMsgpackHeader writes an array or map header using the fix, 16 or 32 bit form
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix byte, code16 byte, code32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(code32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// writeMsgpackString writes a str value
+func writeMsgpackString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+// writeMsgpackInt writes an integer, always as int64 for simplicity
+func writeMsgpackInt(buf *bytes.Buffer, i int64) {
+	if i >= 0 && i < 128 {
+		buf.WriteByte(byte(i))
+		return
+	}
+	buf.WriteByte(0xd3)
+	binary.Write(buf, binary.BigEndian, i)
+}
+
+// writeMsgpackFloat writes a float64 value
+func writeMsgpackFloat(buf *bytes.Buffer, f float64) {
+	buf.WriteByte(0xcb)
+	binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+}
@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestFluentWriter tests that log lines are shipped as forward protocol messages
+func TestFluentWriter(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 256)
+		n, _ := io.ReadAtLeast(conn, buf, 1)
+		received <- buf[:n]
+	}()
+
+	writer, err := newFluentWriter(FluentConfig{Address: listener.Addr().String(), Tag: "conductor"})
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	defer writer.Close()
+
+	if _, err := writer.Write([]byte(`{"level":"info","message":"hello","count":3}` + "\n")); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		// [tag, time, record] is a fixarray of three elements starting with the tag
+		if !bytes.HasPrefix(msg, []byte{0x93, 0xa9, 'c', 'o', 'n', 'd', 'u', 'c', 't', 'o', 'r'}) {
+			t.Errorf("Expected forward message for tag conductor, got %x", msg)
+		}
+		if !bytes.Contains(msg, []byte("hello")) {
+			t.Errorf("Expected record to contain the message, got %x", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for shipped record")
+	}
+}
+
+// TestFluentWriterDropWhenFull tests that writes do not block when dropping is enabled
+func TestFluentWriterDropWhenFull(t *testing.T) {
+	writer, err := newFluentWriter(FluentConfig{Address: "127.0.0.1:1", BufferSize: 1, DropWhenFull: true})
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	defer writer.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			writer.Write([]byte(`{"message":"dropped"}`))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected writes to be dropped instead of blocking")
+	}
+}
@@ -3,7 +3,9 @@ package logger
 
 import (
 	"io"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -37,18 +39,30 @@ type Config struct {
 	Level Level `yaml:"level"`
 	// Format defines the output format (json, pretty)
 	Format Format `yaml:"format"`
-	// Output defines where logs are written (stdout, stderr, file)
+	// Output defines where logs are written (stdout, stderr, file, fluentd)
 	Output string `yaml:"output"`
 	// File is the file path when Output is set to "file"
 	File string `yaml:"file,omitempty"`
+	// Fluentd configures the forward protocol collector when Output is set to "fluentd"
+	Fluentd FluentConfig `yaml:"fluentd,omitempty"`
 	// IncludeCaller adds caller information to log entries
 	IncludeCaller bool `yaml:"includeCaller"`
 	// TimeFormat specifies the time format for logs
 	TimeFormat string `yaml:"timeFormat,omitempty"`
 	// DisableTimestamp disables adding timestamp to logs
 	DisableTimestamp bool `yaml:"disableTimestamp,omitempty"`
+	// Overrides sets the log level for individual services by name
+	Overrides map[string]Level `yaml:"overrides,omitempty"`
+	// RedactHeaders lists additional headers whose values are masked wherever headers are logged
+	RedactHeaders []string `yaml:"redactHeaders,omitempty"`
 }
 
+// redactedValue replaces the values of sensitive headers
+const redactedValue = "[REDACTED]"
+
+// defaultRedactHeaders are always masked, regardless of configuration
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
 var (
 	// Default configuration
 	defaultConfig = Config{
@@ -62,6 +76,15 @@ var (
 	// Instance of the zerolog logger
 	instance zerolog.Logger
 
+	// Loggers for services with a level override, keyed by service name
+	serviceInstances map[string]zerolog.Logger
+
+	// Canonical names of headers whose values are masked
+	redactHeaders map[string]bool
+
+	// Log shipping writer that must be flushed on shutdown, nil for local outputs
+	shipper io.Closer
+
 	// Flag to track initialization
 	initialized bool
 )
@@ -82,29 +105,36 @@ func Initialize(cfg Config) {
 		cfg.TimeFormat = defaultConfig.TimeFormat
 	}
 
-	// Set up the zerolog level
-	var level zerolog.Level
-	switch strings.ToLower(string(cfg.Level)) {
-	case string(LevelDebug):
-		level = zerolog.DebugLevel
-	case string(LevelInfo):
-		level = zerolog.InfoLevel
-	case string(LevelWarn):
-		level = zerolog.WarnLevel
-	case string(LevelError):
-		level = zerolog.ErrorLevel
-	case string(LevelFatal):
-		level = zerolog.FatalLevel
-	default:
-		level = zerolog.InfoLevel
+	// Set up the zerolog level. The global level is the most verbose of the base level
+	// and any service override, each logger then filters to its own level.
+	level := parseLevel(cfg.Level)
+	globalLevel := level
+	for _, override := range cfg.Overrides {
+		if l := parseLevel(override); l < globalLevel {
+			globalLevel = l
+		}
 	}
-	zerolog.SetGlobalLevel(level)
+	zerolog.SetGlobalLevel(globalLevel)
+
+	// Flush any shipping writer from a previous initialization
+	Close()
 
 	// Configure output writer
 	var output io.Writer
 	switch strings.ToLower(cfg.Output) {
 	case "stderr":
 		output = os.Stderr
+	case "fluentd":
+		writer, err := newFluentWriter(cfg.Fluentd)
+		if err != nil {
+			// If the collector is not configured, fall back to stdout
+			output = os.Stdout
+			tmpLogger := zerolog.New(output)
+			tmpLogger.Error().Err(err).Msg("Failed to configure fluentd output, using stdout")
+		} else {
+			output = writer
+			shipper = writer
+		}
 	case "file":
 		if cfg.File != "" {
 			file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
@@ -149,13 +179,47 @@ func Initialize(cfg Config) {
 		contextLogger = contextLogger.With().Caller().Logger()
 	}
 
-	instance = contextLogger
+	instance = contextLogger.Level(level)
+	serviceInstances = make(map[string]zerolog.Logger, len(cfg.Overrides))
+	for name, override := range cfg.Overrides {
+		serviceInstances[name] = contextLogger.Level(parseLevel(override))
+	}
+	redactHeaders = make(map[string]bool, len(defaultRedactHeaders)+len(cfg.RedactHeaders))
+	for _, name := range append(defaultRedactHeaders, cfg.RedactHeaders...) {
+		redactHeaders[http.CanonicalHeaderKey(name)] = true
+	}
 	initialized = true
 
 	// Log the initialization at debug level
 	instance.Debug().Str("level", string(cfg.Level)).Str("format", string(cfg.Format)).Msg("Logger initialized")
 }
 
+// parseLevel converts a configured level to a zerolog level, defaulting to info
+func parseLevel(level Level) zerolog.Level {
+	switch strings.ToLower(string(level)) {
+	case string(LevelDebug):
+		return zerolog.DebugLevel
+	case string(LevelInfo):
+		return zerolog.InfoLevel
+	case string(LevelWarn):
+		return zerolog.WarnLevel
+	case string(LevelError):
+		return zerolog.ErrorLevel
+	case string(LevelFatal):
+		return zerolog.FatalLevel
+	default:
+		return zerolog.InfoLevel
+	}
+}
+
+// Close flushes buffered records of a log shipping output. Local outputs need no flushing.
+func Close() {
+	if shipper != nil {
+		shipper.Close()
+		shipper = nil
+	}
+}
+
 // ensureInitialized makes sure the logger is initialized
 func ensureInitialized() {
 	if !initialized {
@@ -262,3 +326,76 @@ func FatalWithFields(msg string, err error, fields map[string]interface{}) {
 	}
 	event.Msg(msg)
 }
+
+// RedactHeaders returns a copy of the headers with sensitive values masked, suitable for
+// logging or capturing. Extra names are masked in addition to the configured ones.
+func RedactHeaders(header http.Header, extra ...string) http.Header {
+	ensureInitialized()
+	redacted := make(http.Header, len(header))
+	for k, values := range header {
+		if redactHeaders[http.CanonicalHeaderKey(k)] || slices.ContainsFunc(extra, func(name string) bool { return strings.EqualFold(name, k) }) {
+			masked := make([]string, len(values))
+			for i := range masked {
+				masked[i] = redactedValue
+			}
+			redacted[k] = masked
+			continue
+		}
+		redacted[k] = append([]string(nil), values...)
+	}
+	return redacted
+}
+
+// ServiceLogger logs on behalf of a single service, honoring its level override
+type ServiceLogger struct {
+	logger *zerolog.Logger
+}
+
+// ForService returns a logger for the named service. Services without an override
+// log at the base level.
+func ForService(name string) ServiceLogger {
+	ensureInitialized()
+	if l, ok := serviceInstances[name]; ok {
+		return ServiceLogger{logger: &l}
+	}
+	return ServiceLogger{logger: &instance}
+}
+
+// DebugWithFields logs a message at debug level with additional fields
+func (s ServiceLogger) DebugWithFields(msg string, fields map[string]interface{}) {
+	event := s.logger.Debug()
+	for k, v := range fields {
+		event.Interface(k, v)
+	}
+	event.Msg(msg)
+}
+
+// InfoWithFields logs a message at info level with additional fields
+func (s ServiceLogger) InfoWithFields(msg string, fields map[string]interface{}) {
+	event := s.logger.Info()
+	for k, v := range fields {
+		event.Interface(k, v)
+	}
+	event.Msg(msg)
+}
+
+// WarnWithFields logs a message at warn level with additional fields
+func (s ServiceLogger) WarnWithFields(msg string, fields map[string]interface{}) {
+	event := s.logger.Warn()
+	for k, v := range fields {
+		event.Interface(k, v)
+	}
+	event.Msg(msg)
+}
+
+// ErrorWithFields logs a message at error level with additional fields
+func (s ServiceLogger) ErrorWithFields(msg string, err error, fields map[string]interface{}) {
+	event := s.logger.Error()
+	if err != nil {
+		event.Err(err)
+	}
+	for k, v := range fields {
+		event.Interface(k, v)
+	}
+	event.Msg(msg)
+}
@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestServiceOverrides tests that per-service levels apply only to that service
+func TestServiceOverrides(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "conductor.log")
+	Initialize(Config{
+		Level:     LevelInfo,
+		Output:    "file",
+		File:      file,
+		Overrides: map[string]Level{"noisy-service": LevelDebug},
+	})
+	defer Initialize(defaultConfig)
+
+	Debug("base debug")
+	ForService("quiet-service").DebugWithFields("quiet debug", nil)
+	ForService("noisy-service").DebugWithFields("noisy debug", nil)
+	ForService("quiet-service").InfoWithFields("quiet info", nil)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	output := string(data)
+
+	for _, msg := range []string{"noisy debug", "quiet info"} {
+		if !strings.Contains(output, msg) {
+			t.Errorf("Expected log output to contain %q, got: %s", msg, output)
+		}
+	}
+	for _, msg := range []string{"base debug", "quiet debug"} {
+		if strings.Contains(output, msg) {
+			t.Errorf("Expected log output not to contain %q, got: %s", msg, output)
+		}
+	}
+}
+
+// TestRedactHeaders tests that default and configured sensitive headers are masked
+func TestRedactHeaders(t *testing.T) {
+	Initialize(Config{RedactHeaders: []string{"x-api-key"}})
+	defer Initialize(defaultConfig)
+
+	header := http.Header{
+		"Authorization": []string{"Bearer secret"},
+		"Cookie":        []string{"session=secret"},
+		"X-Api-Key":     []string{"secret"},
+		"Accept":        []string{"application/json"},
+	}
+	redacted := RedactHeaders(header)
+
+	for _, name := range []string{"Authorization", "Cookie", "X-Api-Key"} {
+		if got := redacted.Get(name); got != redactedValue {
+			t.Errorf("Expected %s to be redacted, got %q", name, got)
+		}
+	}
+	if got := redacted.Get("Accept"); got != "application/json" {
+		t.Errorf("Expected Accept to be kept, got %q", got)
+	}
+	if header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Expected original headers to be left untouched")
+	}
+}
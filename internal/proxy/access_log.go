@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Access log formats
+const (
+	accessLogCommon   = "common"   // NCSA Common Log Format
+	accessLogCombined = "combined" // Common Log Format with the referer and user agent
+	accessLogJSON     = "json"     // One JSON object per request, with the service and upstream latency
+)
+
+// clfTimeFormat is the timestamp layout of the Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLog writes one line per answered request
+type accessLog struct {
+	mu     sync.Mutex
+	format string
+	out    io.Writer
+	file   *os.File // Closed with the conductor, nil for standard streams
+}
+
+// newAccessLog opens the access log's destination
+func newAccessLog(cfg config.AccessLogConfig) (*accessLog, error) {
+	a := &accessLog{format: cfg.Format}
+	switch cfg.Output {
+	case "stderr":
+		a.out = os.Stderr
+	case "file":
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		a.out, a.file = file, file
+	default:
+		a.out = os.Stdout
+	}
+	return a, nil
+}
+
+// Close closes the access log file, if any
+func (a *accessLog) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// accessLogEntry collects what is logged about a request while it is handled
+type accessLogEntry struct {
+	start     time.Time
+	remote    string
+	method    string
+	uri       string
+	proto     string
+	referer   string
+	userAgent string
+	requestID string
+	service   string        // Service whose response was sent, empty if the conductor answered itself
+	upstream  time.Duration // Time the service took to respond, zero if the response was not requested from it
+	writer    *accessLogWriter
+}
+
+// accessLogRecord is a request in the json access log format
+type accessLogRecord struct {
+	Time       string `json:"time"`
+	RemoteAddr string `json:"remote_addr"`
+	Method     string `json:"method"`
+	URI        string `json:"uri"`
+	Proto      string `json:"proto"`
+	Status     int    `json:"status"`
+	Bytes      int64  `json:"bytes"`
+	DurationMs int64  `json:"duration_ms"`
+	Service    string `json:"service,omitempty"`
+	UpstreamMs *int64 `json:"upstream_ms,omitempty"`
+	Referer    string `json:"referer,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+// Write writes an entry in the access log's format
+func (a *accessLog) Write(entry *accessLogEntry) {
+	line := a.line(entry)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.out.Write(line); err != nil {
+		logger.Error("Failed to write access log", err)
+	}
+}
+
+// line formats an entry, newline included
+func (a *accessLog) line(entry *accessLogEntry) []byte {
+	status := entry.writer.Status()
+	if a.format == accessLogJSON {
+		record := accessLogRecord{
+			Time:       entry.start.Format(time.RFC3339Nano),
+			RemoteAddr: entry.remote,
+			Method:     entry.method,
+			URI:        entry.uri,
+			Proto:      entry.proto,
+			Status:     status,
+			Bytes:      entry.writer.bytes,
+			DurationMs: time.Since(entry.start).Milliseconds(),
+			Service:    entry.service,
+			Referer:    entry.referer,
+			UserAgent:  entry.userAgent,
+			RequestID:  entry.requestID,
+		}
+		if entry.upstream > 0 {
+			upstreamMs := entry.upstream.Milliseconds()
+			record.UpstreamMs = &upstreamMs
+		}
+		line, _ := json.Marshal(record)
+		return append(line, '\n')
+	}
+
+	size := "-"
+	if entry.writer.bytes > 0 {
+		size = strconv.FormatInt(entry.writer.bytes, 10)
+	}
+	line := fmt.Sprintf("%s - - [%s] %s %d %s", entry.remote, entry.start.Format(clfTimeFormat),
+		strconv.Quote(entry.method+" "+entry.uri+" "+entry.proto), status, size)
+	if a.format == accessLogCombined {
+		line += " " + quoteOrDash(entry.referer) + " " + quoteOrDash(entry.userAgent)
+	}
+	return []byte(line + "\n")
+}
+
+// quoteOrDash quotes a Common Log Format field, or returns a dash if it is empty
+func quoteOrDash(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
+
+// accessLogWriter records the status and body size of a response
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements io.Writer
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, so streamed responses are still sent as they arrive
+func (w *accessLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the response status, 200 if nothing was written as the server sends then
+func (w *accessLogWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// accessLogKey is the context key of a request's access log entry
+type accessLogKey struct{}
+
+// startAccessLog starts recording a request for the access log. It returns the writer and
+// request to use and a function writing the entry once the request is answered.
+func (c *Conductor) startAccessLog(w http.ResponseWriter, r *http.Request, requestStart time.Time) (http.ResponseWriter, *http.Request, func()) {
+	if c.accessLog == nil {
+		return w, r, func() {}
+	}
+
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	writer := &accessLogWriter{ResponseWriter: w}
+	entry := &accessLogEntry{
+		start:     requestStart,
+		remote:    remote,
+		method:    r.Method,
+		uri:       r.RequestURI,
+		proto:     r.Proto,
+		referer:   r.Referer(),
+		userAgent: r.UserAgent(),
+		requestID: r.Header.Get(requestIDHeader),
+		writer:    writer,
+	}
+	if entry.uri == "" {
+		entry.uri = r.URL.RequestURI()
+	}
+	r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, entry))
+	return writer, r, func() { c.accessLog.Write(entry) }
+}
+
+// noteAccessResult records the service whose response is sent to the client and how long
+// it took to respond
+func noteAccessResult(r *http.Request, result *serviceResult) {
+	entry, ok := r.Context().Value(accessLogKey{}).(*accessLogEntry)
+	if !ok {
+		return
+	}
+	entry.service = result.service.Name
+	entry.upstream = result.duration
+}
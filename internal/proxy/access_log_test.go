@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestAccessLog tests that answered requests are written in the configured format, with
+// the service whose response was sent
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		path   string
+		want   string // Pattern the common and combined lines must match
+	}{
+		{name: "common", format: "common", path: "/api/users?page=2", want: `^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /api/users\?page=2 HTTP/1\.1" 200 2$`},
+		{name: "combined", format: "combined", path: "/missing", want: `^192\.0\.2\.1 - - \[.+\] "GET /missing HTTP/1\.1" 404 \d+ "https://example\.com/" "test-agent/1\.0"$`},
+		{name: "json", format: "json", path: "/api/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "access.log")
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+				},
+				AccessLog: config.AccessLogConfig{Enabled: true, Format: tt.format, Output: "file", File: file},
+			}
+			conductor := NewConductor(cfg)
+			conductor.client = &http.Client{Transport: &recordingTransport{}}
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Referer", "https://example.com/")
+			req.Header.Set("User-Agent", "test-agent/1.0")
+			conductor.ServeHTTP(httptest.NewRecorder(), req)
+			conductor.Close()
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read access log: %v", err)
+			}
+			line := strings.TrimSuffix(string(data), "\n")
+			if strings.Contains(line, "\n") {
+				t.Fatalf("Expected a single line, got %q", line)
+			}
+
+			if tt.format != "json" {
+				if !regexp.MustCompile(tt.want).MatchString(line) {
+					t.Errorf("Expected a line matching %s, got %q", tt.want, line)
+				}
+				return
+			}
+			var record accessLogRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				t.Fatalf("Expected a JSON line, got %q: %v", line, err)
+			}
+			if record.Status != http.StatusOK || record.Bytes != 2 || record.Service != "api" || record.UpstreamMs == nil {
+				t.Errorf("Expected status 200, 2 bytes and the upstream latency of api, got %+v", record)
+			}
+			if record.Method != "GET" || record.URI != "/api/users" || record.UserAgent != "test-agent/1.0" || record.RequestID == "" {
+				t.Errorf("Expected the request line, user agent and request ID, got %+v", record)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// adaptiveRefresh is how often a route's adaptive timeout is recomputed from its window
+const adaptiveRefresh = time.Second
+
+// adaptiveRoute is the rolling latency of a route's primary attempts and the timeout
+// last computed from it
+type adaptiveRoute struct {
+	buckets  [sloWindowBuckets]sloBucket
+	timeout  time.Duration // Zero until enough attempts were observed
+	computed time.Time
+}
+
+// adaptiveTimeouts bounds the attempts of each route's primaries by a multiple of the
+// route's rolling p99, so timeouts follow how the backends actually behave. The timeout
+// is kept between the floor and the ceiling, and routes with too few attempts in the
+// window keep the static timeouts.
+type adaptiveTimeouts struct {
+	mu             sync.Mutex
+	cfg            config.AdaptiveTimeoutConfig
+	bucketDuration time.Duration
+	routes         map[string]*adaptiveRoute
+	tracked        map[string]bool // Routes whose timeouts adapt, nil for all
+	now            func() time.Time
+}
+
+// newAdaptiveTimeouts creates a tracker for the given configuration
+func newAdaptiveTimeouts(cfg config.AdaptiveTimeoutConfig) *adaptiveTimeouts {
+	a := &adaptiveTimeouts{
+		cfg:            cfg,
+		bucketDuration: time.Duration(cfg.Window) * time.Second / sloWindowBuckets,
+		routes:         make(map[string]*adaptiveRoute),
+		now:            time.Now,
+	}
+	if len(cfg.Routes) > 0 {
+		a.tracked = make(map[string]bool, len(cfg.Routes))
+		for _, route := range cfg.Routes {
+			a.tracked[route] = true
+		}
+	}
+	return a
+}
+
+// Record adds the duration of a primary attempt to the route's rolling window
+func (a *adaptiveTimeouts) Record(route string, duration time.Duration) {
+	if a == nil || (a.tracked != nil && !a.tracked[route]) {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ar, ok := a.routes[route]
+	if !ok {
+		ar = &adaptiveRoute{}
+		a.routes[route] = ar
+	}
+	start := a.now().Truncate(a.bucketDuration)
+	bucket := &ar.buckets[(start.UnixNano()/int64(a.bucketDuration))%sloWindowBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = sloBucket{start: start, digest: newTDigest(defaultCompression)}
+	}
+	bucket.digest.Add(float64(duration) / float64(time.Millisecond))
+	bucket.total++
+}
+
+// Timeout returns the route's adaptive timeout, or zero while too few attempts were
+// observed for it to adapt
+func (a *adaptiveTimeouts) Timeout(route string) time.Duration {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ar, ok := a.routes[route]
+	if !ok {
+		return 0
+	}
+	now := a.now()
+	if now.Sub(ar.computed) < adaptiveRefresh {
+		return ar.timeout
+	}
+	ar.computed = now
+
+	digest := newTDigest(defaultCompression)
+	var samples int64
+	cutoff := now.Add(-time.Duration(a.cfg.Window) * time.Second)
+	for i := range ar.buckets {
+		bucket := &ar.buckets[i]
+		if bucket.digest == nil || !bucket.start.After(cutoff) {
+			continue
+		}
+		digest.Merge(bucket.digest)
+		samples += bucket.total
+	}
+
+	previous := ar.timeout
+	ar.timeout = 0
+	if samples >= int64(a.cfg.MinSamples) && samples > 0 {
+		timeout := time.Duration(digest.Quantile(0.99) * a.cfg.Multiplier * float64(time.Millisecond))
+		floor := time.Duration(a.cfg.FloorMs) * time.Millisecond
+		ceiling := time.Duration(a.cfg.CeilingMs) * time.Millisecond
+		ar.timeout = min(max(timeout, floor), ceiling)
+	}
+	if ar.timeout != previous {
+		logger.DebugWithFields("Adapted route timeout", map[string]interface{}{
+			"route":      route,
+			"timeout_ms": ar.timeout.Milliseconds(),
+			"samples":    samples,
+		})
+	}
+	return ar.timeout
+}
+
+// attemptTimeoutFor returns the bound of a single attempt to the service: the route's
+// adaptive timeout for primaries once it adapted, otherwise the static attempt timeout
+func (c *Conductor) attemptTimeoutFor(svc *Service) time.Duration {
+	if svc.Primary {
+		if timeout := c.adaptiveTimeouts.Timeout(svc.Route); timeout > 0 {
+			return timeout
+		}
+	}
+	return c.attemptTimeout
+}
+
+// recordAttemptLatency adds a primary attempt to its route's adaptive timeout. Only
+// attempts that got a response are latencies: fast failures, cancellations and attempts
+// cut off at the timeout say nothing about how long the backend takes to answer.
+func (c *Conductor) recordAttemptLatency(svc *Service, result *serviceResult) {
+	if svc.Primary && result.err == nil && result.resp != nil {
+		c.adaptiveTimeouts.Record(svc.Route, result.duration)
+	}
+}
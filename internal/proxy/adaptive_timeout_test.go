@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestAdaptiveTimeouts tests that a route's timeout is a multiple of its rolling p99, kept
+// between the floor and the ceiling once enough attempts were observed
+func TestAdaptiveTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  int
+		latency  time.Duration
+		expected time.Duration
+	}{
+		{name: "too few attempts", samples: 9, latency: 200 * time.Millisecond, expected: 0},
+		{name: "multiple of p99", samples: 10, latency: 200 * time.Millisecond, expected: 600 * time.Millisecond},
+		{name: "floor", samples: 10, latency: 10 * time.Millisecond, expected: 100 * time.Millisecond},
+		{name: "ceiling", samples: 10, latency: time.Second, expected: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adaptive := newAdaptiveTimeouts(config.AdaptiveTimeoutConfig{
+				Enabled: true, Multiplier: 3, FloorMs: 100, CeilingMs: 2000, Window: 60, MinSamples: 10,
+			})
+			now := time.Now()
+			adaptive.now = func() time.Time { return now }
+
+			for range tt.samples {
+				adaptive.Record("/api", tt.latency)
+			}
+			if timeout := adaptive.Timeout("/api"); timeout != tt.expected {
+				t.Errorf("Expected timeout %v, got %v", tt.expected, timeout)
+			}
+
+			// Attempts age out of the window
+			now = now.Add(61 * time.Second)
+			if timeout := adaptive.Timeout("/api"); timeout != 0 {
+				t.Errorf("Expected the static timeout once attempts aged out, got %v", timeout)
+			}
+		})
+	}
+
+	adaptive := newAdaptiveTimeouts(config.AdaptiveTimeoutConfig{Enabled: true, Multiplier: 3, CeilingMs: 2000, Window: 60, MinSamples: 1, Routes: []string{"/api"}})
+	adaptive.Record("/web", time.Second)
+	if timeout := adaptive.Timeout("/web"); timeout != 0 {
+		t.Errorf("Expected routes not listed to keep the static timeout, got %v", timeout)
+	}
+}
+
+// TestAdaptiveTimeoutAttempts tests that a primary slower than its route's adapted timeout
+// is cut off
+func TestAdaptiveTimeoutAttempts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Timeout:  5,
+		Services: []config.Service{{Name: "api", URL: backend.URL, PathPrefix: "/api", Primary: true}},
+		AdaptiveTimeout: config.AdaptiveTimeoutConfig{
+			Enabled: true, Multiplier: 2, FloorMs: 50, CeilingMs: 5000, Window: 60, MinSamples: 5,
+		},
+	}
+	conductor := NewConductor(cfg)
+	defer conductor.Close()
+	now := time.Now()
+	conductor.adaptiveTimeouts.now = func() time.Time { return now }
+
+	get := func(target string) int {
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, httptest.NewRequest("GET", target, nil))
+		return recorder.Code
+	}
+
+	for range 10 {
+		get("/api/items")
+	}
+	now = now.Add(2 * adaptiveRefresh)
+
+	start := time.Now()
+	if status := get("/api/items?slow=1"); status != http.StatusGatewayTimeout {
+		t.Errorf("Expected the adapted timeout to cut off a slow request, got %d", status)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("Expected the request cut off at the adapted timeout, took %v", elapsed)
+	}
+}
+
+// TestAdaptiveTimeoutFailures tests that attempts without a response, such as fast
+// connection errors, do not shrink the adapted timeout
+func TestAdaptiveTimeoutFailures(t *testing.T) {
+	cfg := &config.Config{
+		Timeout:  5,
+		Services: []config.Service{{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true}},
+		AdaptiveTimeout: config.AdaptiveTimeoutConfig{
+			Enabled: true, Multiplier: 3, FloorMs: 10, CeilingMs: 5000, Window: 60, MinSamples: 10,
+		},
+	}
+	conductor := NewConductor(cfg)
+	defer conductor.Close()
+	now := time.Now()
+	conductor.adaptiveTimeouts.now = func() time.Time { return now }
+	svc := conductor.services[0]
+
+	for range 10 {
+		conductor.recordAttemptLatency(svc, &serviceResult{service: svc, resp: &http.Response{StatusCode: 200}, duration: 200 * time.Millisecond})
+	}
+	for range 1000 {
+		conductor.recordAttemptLatency(svc, &serviceResult{service: svc, err: errors.New("connection refused"), duration: time.Millisecond})
+	}
+	if timeout := conductor.adaptiveTimeouts.Timeout("/api"); timeout != 600*time.Millisecond {
+		t.Errorf("Expected failed attempts to leave the timeout at 600ms, got %v", timeout)
+	}
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// mirrorPauses tracks the routes whose shadow traffic is paused at runtime
+type mirrorPauses struct {
+	mu     sync.RWMutex
+	paused map[string]bool
+}
+
+// newMirrorPauses creates a tracker with mirroring active on every route
+func newMirrorPauses() *mirrorPauses {
+	return &mirrorPauses{paused: make(map[string]bool)}
+}
+
+// Set pauses or resumes mirroring for the route
+func (m *mirrorPauses) Set(route string, paused bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if paused {
+		m.paused[route] = true
+	} else {
+		delete(m.paused, route)
+	}
+}
+
+// Paused reports whether mirroring is paused for the route
+func (m *mirrorPauses) Paused(route string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.paused[route]
+}
+
+// Routes returns the paused routes in sorted order
+func (m *mirrorPauses) Routes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	routes := make([]string, 0, len(m.paused))
+	for route := range m.paused {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// skipPausedMirrors drops the non-primary services when mirroring is paused for the route
+func (c *Conductor) skipPausedMirrors(route string, services []*Service) []*Service {
+	if c.mirrorPauses == nil || !c.mirrorPauses.Paused(route) {
+		return services
+	}
+
+	for _, svc := range services {
+		if svc.Primary {
+			return []*Service{svc}
+		}
+	}
+	return services
+}
+
+// mirroringStatus is the response body of the mirroring admin endpoints
+type mirroringStatus struct {
+	PausedRoutes []string `json:"paused_routes"`
+}
+
+// MirroringStatusHandler creates an admin handler listing the routes with paused mirroring
+func MirroringStatusHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+		c.writeMirroringStatus(w)
+	}
+}
+
+// MirroringControlHandler creates an admin handler that pauses or resumes mirroring for the
+// route given in the "route" query parameter
+func MirroringControlHandler(c *Conductor, paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodPost) {
+			return
+		}
+
+		route := r.URL.Query().Get("route")
+		if route == "" {
+			http.Error(w, "Missing route parameter", http.StatusBadRequest)
+			return
+		}
+		c.mirrorPauses.Set(route, paused)
+
+		message := "Resumed mirroring"
+		if paused {
+			message = "Paused mirroring"
+		}
+		logger.InfoWithFields(message, map[string]interface{}{
+			"route":       route,
+			"remote_addr": r.RemoteAddr,
+		})
+		c.writeMirroringStatus(w)
+	}
+}
+
+// writeMirroringStatus writes the paused routes as JSON
+func (c *Conductor) writeMirroringStatus(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(mirroringStatus{PausedRoutes: c.mirrorPauses.Routes()}); err != nil {
+		http.Error(w, "Failed to encode mirroring status: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// checkAdminRequest rejects admin requests when the endpoints are disabled, the method is
+// wrong or the token does not match, reporting whether the request may proceed
+func (c *Conductor) checkAdminRequest(w http.ResponseWriter, r *http.Request, method string) bool {
+	if !c.config.Admin.Enabled {
+		http.Error(w, "Admin endpoints not enabled", http.StatusNotFound)
+		return false
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !c.authorizeAdmin(r) {
+		if c.config.Admin.Username != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="go-conductor admin"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// authorizeAdmin checks the bearer token or basic auth credentials of an admin request,
+// accepting either when both are configured and no request when neither is
+func (c *Conductor) authorizeAdmin(r *http.Request) bool {
+	admin := c.config.Admin
+	if provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && admin.Token != "" &&
+		subtle.ConstantTimeCompare([]byte(provided), []byte(admin.Token)) == 1 {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	return ok && admin.Username != "" &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(admin.Username))&
+			subtle.ConstantTimeCompare([]byte(password), []byte(admin.Password)) == 1
+}
+
+// SetupAdminEndpoints registers the admin endpoints if they are enabled
+func SetupAdminEndpoints(mux *http.ServeMux, c *Conductor) {
+	if !c.config.Admin.Enabled {
+		return
+	}
+
+	endpoint := strings.TrimSuffix(c.config.Admin.Endpoint, "/")
+	logger.InfoWithFields("Enabling admin endpoints", map[string]interface{}{
+		"endpoint": endpoint,
+	})
+	mux.HandleFunc(endpoint+"/mirroring", MirroringStatusHandler(c))
+	mux.HandleFunc(endpoint+"/mirroring/pause", MirroringControlHandler(c, true))
+	mux.HandleFunc(endpoint+"/mirroring/resume", MirroringControlHandler(c, false))
+	mux.HandleFunc(endpoint+"/mirroring/guard", MirrorGuardStatusHandler(c))
+	mux.HandleFunc(endpoint+"/mirroring/guard/enable", MirrorGuardEnableHandler(c))
+	mux.HandleFunc(endpoint+"/quotas", QuotaReportHandler(c))
+	mux.HandleFunc(endpoint+"/health", HealthHistoryHandler(c))
+	mux.HandleFunc(endpoint+"/faults", FaultStatusHandler(c))
+	mux.HandleFunc(endpoint+"/faults/start", FaultControlHandler(c, true))
+	mux.HandleFunc(endpoint+"/faults/stop", FaultControlHandler(c, false))
+	mux.HandleFunc(endpoint+"/dependencies", DependencyGraphHandler(c))
+	mux.HandleFunc(endpoint+"/impact", ImpactHandler(c))
+	mux.HandleFunc(endpoint+"/flags", FlagsHandler(c))
+	mux.HandleFunc(endpoint+"/cache", CachePurgeHandler(c))
+	mux.HandleFunc(endpoint+"/cache/keys", CacheKeysHandler(c))
+	mux.HandleFunc(endpoint+"/cache/entry", CacheEntryHandler(c))
+	mux.HandleFunc(endpoint+"/routes", RoutesHandler(c))
+	mux.HandleFunc(endpoint+"/routes/freeze", RouteFreezeHandler(c, true))
+	mux.HandleFunc(endpoint+"/routes/unfreeze", RouteFreezeHandler(c, false))
+	mux.HandleFunc(endpoint+"/services/enable", ServiceControlHandler(c, serviceActionEnable))
+	mux.HandleFunc(endpoint+"/services/disable", ServiceControlHandler(c, serviceActionDisable))
+	mux.HandleFunc(endpoint+"/services/primary", ServiceControlHandler(c, serviceActionPrimary))
+	mux.HandleFunc(endpoint+"/config/snapshots", SnapshotsHandler(c))
+	mux.HandleFunc(endpoint+"/config/rollback", RollbackHandler(c))
+}
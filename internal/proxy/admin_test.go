@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// countingTransport counts requests per backend host
+type countingTransport struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (ct *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ct.mu.Lock()
+	ct.counts[req.URL.Host]++
+	ct.mu.Unlock()
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("ok")),
+	}, nil
+}
+
+func (ct *countingTransport) count(host string) int {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.counts[host]
+}
+
+// adminRequest creates an admin request carrying the token the admin tests configure
+func adminRequest(method string, target string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
+// TestPauseMirroring tests pausing and resuming shadow traffic through the admin endpoints
+func TestPauseMirroring(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://primary.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "api-shadow", URL: "http://shadow.example.com", PathPrefix: "/api"},
+		},
+		Admin: config.AdminConfig{Enabled: true, Endpoint: "/admin", Token: "secret"},
+	}
+	conductor := NewConductor(cfg)
+	transport := &countingTransport{counts: make(map[string]int)}
+	conductor.client = &http.Client{Transport: transport}
+
+	mux := http.NewServeMux()
+	SetupAdminEndpoints(mux, conductor)
+
+	admin := func(method string, target string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		return recorder
+	}
+	proxy := func() {
+		conductor.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/api/users", nil))
+	}
+
+	// Admin requests need the token and the right method
+	if recorder := admin("POST", "/admin/mirroring/pause?route=/api", ""); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without token, got %d", recorder.Code)
+	}
+	if recorder := admin("GET", "/admin/mirroring/pause?route=/api", "secret"); recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected 405 for GET, got %d", recorder.Code)
+	}
+
+	// Paused routes only reach the primary
+	recorder := admin("POST", "/admin/mirroring/pause?route=/api", "secret")
+	if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), `"paused_routes":["/api"]`) {
+		t.Fatalf("Expected pause to succeed, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	proxy()
+	if transport.count("primary.example.com") != 1 || transport.count("shadow.example.com") != 0 {
+		t.Fatalf("Expected only the primary while paused, got %v", transport.counts)
+	}
+
+	// Resumed routes are mirrored again
+	recorder = admin("POST", "/admin/mirroring/resume?route=/api", "secret")
+	if recorder.Code != 200 || !strings.Contains(recorder.Body.String(), `"paused_routes":[]`) {
+		t.Fatalf("Expected resume to succeed, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if services := conductor.skipPausedMirrors("/api", conductor.services); len(services) != 2 {
+		t.Fatalf("Expected primary and shadow after resume, got %v", getServiceNames(services))
+	}
+}
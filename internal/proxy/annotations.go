@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// annotations sets headers describing the conductor's decisions on backend requests and
+// client responses
+type annotations struct {
+	backend bool
+	client  bool
+	prefix  string
+}
+
+// newAnnotations creates the annotations for the configuration, nil if none are enabled
+func newAnnotations(cfg config.AnnotationsConfig) *annotations {
+	if !cfg.Backend && !cfg.Client {
+		return nil
+	}
+	return &annotations{backend: cfg.Backend, client: cfg.Client, prefix: cfg.Prefix}
+}
+
+// annotateRequest tells a backend which route the request was matched to, the role its
+// service plays on the route and which attempt this is, replacing any values sent by the
+// client
+func (a *annotations) annotateRequest(req *http.Request, svc *Service, attempt int) {
+	if a == nil || !a.backend {
+		return
+	}
+	req.Header.Set(a.prefix+"Route", svc.Route)
+	req.Header.Set(a.prefix+"Role", serviceRole(svc))
+	req.Header.Set(a.prefix+"Attempt", strconv.Itoa(attempt))
+}
+
+// annotateResponse tells the client which service's response it receives and how the
+// response cache produced it, if it was looked up
+func (a *annotations) annotateResponse(header http.Header, result *serviceResult) {
+	if a == nil || !a.client {
+		return
+	}
+	header.Set(a.prefix+"Service", result.service.Name)
+	if result.cache != "" {
+		header.Set(a.prefix+"Cache", result.cache)
+	} else {
+		header.Del(a.prefix + "Cache")
+	}
+}
+
+// serviceRole returns the role a service plays on its route
+func serviceRole(svc *Service) string {
+	switch {
+	case svc.Primary:
+		return rolePrimary
+	case svc.Config.Mirror:
+		return roleMirror
+	default:
+		return roleShadow
+	}
+}
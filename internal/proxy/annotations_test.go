@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestAnnotations tests the headers describing the route, role and attempt sent to
+// backends, and the service and cache result sent to clients
+func TestAnnotations(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true,
+				Retries: 1, RetryBackoff: 1, RetryOn: []string{"5xx"}},
+			{Name: "api-shadow", URL: "http://shadow.example.com", PathPrefix: "/api"},
+		},
+		Cache:       config.CacheConfig{Enabled: true, MaxEntries: 10, MaxBodyBytes: 1024},
+		Annotations: config.AnnotationsConfig{Backend: true, Client: true, Prefix: "X-Conductor-"},
+	}
+	conductor := NewConductor(cfg)
+	origin := &originTransport{version: "v1", cacheControl: "max-age=60"}
+	conductor.client = &http.Client{Transport: origin}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("X-Conductor-Role", "spoofed")
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, req)
+		return recorder
+	}
+	// sent returns the headers of the backend requests by host and attempt, once the wanted
+	// ones arrived as shadow requests may still be in flight
+	sent := func(want ...string) map[string]http.Header {
+		headers := make(map[string]http.Header)
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+			origin.mu.Lock()
+			for _, req := range origin.requests {
+				headers[req.URL.Host+" "+req.Header.Get("X-Conductor-Attempt")] = req.Header
+			}
+			origin.requests = nil
+			origin.mu.Unlock()
+
+			missing := false
+			for _, key := range want {
+				missing = missing || headers[key] == nil
+			}
+			if !missing {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return headers
+	}
+
+	recorder := get("/api/items")
+	if recorder.Header().Get("X-Conductor-Service") != "api" || recorder.Header().Get("X-Conductor-Cache") != cacheMiss {
+		t.Errorf("Expected the primary's response on a cache miss, got %v", recorder.Header())
+	}
+	headers := sent("api.example.com 1", "shadow.example.com 1")
+	if primary := headers["api.example.com 1"]; primary == nil || primary.Get("X-Conductor-Route") != "/api" || primary.Get("X-Conductor-Role") != rolePrimary {
+		t.Errorf("Expected the route and primary role sent to api, got %v", headers)
+	}
+	if shadow := headers["shadow.example.com 1"]; shadow == nil || shadow.Get("X-Conductor-Role") != roleShadow {
+		t.Errorf("Expected the shadow role sent to api-shadow, got %v", headers)
+	}
+
+	recorder = get("/api/items")
+	if recorder.Header().Get("X-Conductor-Service") != "api" || recorder.Header().Get("X-Conductor-Cache") != cacheHit {
+		t.Errorf("Expected a cache hit, got %v", recorder.Header())
+	}
+
+	// Retries are numbered
+	origin.mu.Lock()
+	origin.failing = true
+	origin.mu.Unlock()
+	recorder = get("/api/orders")
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("X-Conductor-Cache") != cacheMiss {
+		t.Errorf("Expected the failed response on a cache miss, got %d %v", recorder.Code, recorder.Header())
+	}
+	if headers := sent("api.example.com 1", "api.example.com 2"); headers["api.example.com 1"] == nil || headers["api.example.com 2"] == nil {
+		t.Errorf("Expected attempts 1 and 2 sent to api, got %v", headers)
+	}
+}
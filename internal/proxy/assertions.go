@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Actions taken when a response fails an assertion
+const (
+	assertionActionLog   = "log"   // Log and count the failure
+	assertionActionCount = "count" // Only count the failure
+	assertionActionError = "error" // Log, count and answer with an error instead
+)
+
+// Assertion kinds used in logs and the response_assertion_failures_total metric
+const (
+	assertionStatus = "status"
+	assertionHeader = "header"
+	assertionBody   = "body"
+)
+
+// responseAssertion is a contract the selected response of a route must satisfy
+type responseAssertion struct {
+	config config.RouteAssertion
+	body   bodyMatch // Predicate over JSON body fields, nil if the body is not checked
+}
+
+// newResponseAssertions parses the assertions of every route
+func newResponseAssertions(assertions []config.RouteAssertion) (map[string][]*responseAssertion, error) {
+	byRoute := make(map[string][]*responseAssertion)
+	for _, cfg := range assertions {
+		assertion := &responseAssertion{config: cfg}
+		if cfg.Body != "" {
+			body, err := parseBodyMatch(cfg.Body)
+			if err != nil {
+				return nil, fmt.Errorf("assertion for route %q: %w", cfg.Route, err)
+			}
+			assertion.body = body
+		}
+		byRoute[cfg.Route] = append(byRoute[cfg.Route], assertion)
+	}
+	return byRoute, nil
+}
+
+// Check returns the kind of the first expectation the response does not meet and why, or
+// empty strings if it meets them all. Streamed bodies are not checked.
+func (a *responseAssertion) Check(result *serviceResult) (string, string) {
+	if len(a.config.Status) > 0 && !slices.Contains(a.config.Status, result.resp.StatusCode) {
+		return assertionStatus, fmt.Sprintf("status %d not in %v", result.resp.StatusCode, a.config.Status)
+	}
+	for _, header := range a.config.Headers {
+		if result.resp.Header.Get(header) == "" {
+			return assertionHeader, fmt.Sprintf("header %s missing", header)
+		}
+	}
+	if a.body != nil && result.stream == nil {
+		doc := &bodyDocument{}
+		doc.ok = json.Unmarshal(result.body, &doc.value) == nil
+		if !a.body.Eval(doc) {
+			return assertionBody, fmt.Sprintf("body does not satisfy %s", a.config.Body)
+		}
+	}
+	return "", ""
+}
+
+// checkAssertions evaluates the route's assertions against the selected response, logging
+// and counting failures. It returns the assertion the response must be rejected for, or
+// nil if it may be sent.
+func (c *Conductor) checkAssertions(route string, r *http.Request, result *serviceResult) *responseAssertion {
+	var rejected *responseAssertion
+	for _, assertion := range c.assertions[route] {
+		kind, reason := assertion.Check(result)
+		if kind == "" {
+			continue
+		}
+
+		if c.prometheusMetrics != nil {
+			c.prometheusMetrics.RecordAssertionFailure(route, kind)
+		}
+		if assertion.config.Action != assertionActionCount {
+			logger.ForService(result.service.Name).WarnWithFields("Response failed route assertion", map[string]interface{}{
+				"service":     result.service.Name,
+				"route":       route,
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"status_code": result.resp.StatusCode,
+				"assertion":   kind,
+				"reason":      reason,
+				"action":      assertion.config.Action,
+			})
+		}
+		if assertion.config.Action == assertionActionError && rejected == nil {
+			rejected = assertion
+		}
+	}
+	return rejected
+}
+
+// handleAssertionFailed answers with the assertion's error instead of the response
+func (c *Conductor) handleAssertionFailed(w http.ResponseWriter, r *http.Request, route string, assertion *responseAssertion, requestStart time.Time, traceID string) {
+	status := assertion.config.ErrorStatus
+	writeError(w, r, status, ErrCodeAssertionFailed, "Backend response failed the route's assertions")
+
+	// Record rejected response in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", route, "assertion_failed")
+		c.prometheusMetrics.RecordRequest("conductor", route, r.Method, fmt.Sprintf("%d", status), time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, true)
+	}
+	c.recordSLO(route, status, time.Since(requestStart))
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestResponseAssertion tests checking responses against status, header and body expectations
+func TestResponseAssertion(t *testing.T) {
+	tests := []struct {
+		name      string
+		assertion config.RouteAssertion
+		status    int
+		header    http.Header
+		body      string
+		wantKind  string
+	}{
+		{name: "status allowed", assertion: config.RouteAssertion{Status: []int{200, 404}}, status: 404},
+		{name: "status not allowed", assertion: config.RouteAssertion{Status: []int{200, 404}}, status: 500, wantKind: assertionStatus},
+		{name: "header present", assertion: config.RouteAssertion{Headers: []string{"X-Version"}}, status: 200, header: http.Header{"X-Version": {"2"}}},
+		{name: "header missing", assertion: config.RouteAssertion{Headers: []string{"X-Version"}}, status: 200, wantKind: assertionHeader},
+		{name: "body field present", assertion: config.RouteAssertion{Body: `$.data.id AND $.status == "ok"`}, status: 200, body: `{"status":"ok","data":{"id":7}}`},
+		{name: "body field missing", assertion: config.RouteAssertion{Body: `$.data.id`}, status: 200, body: `{"data":{}}`, wantKind: assertionBody},
+		{name: "body not json", assertion: config.RouteAssertion{Body: `$.data`}, status: 200, body: "<html>", wantKind: assertionBody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertions, err := newResponseAssertions([]config.RouteAssertion{tt.assertion})
+			if err != nil {
+				t.Fatalf("Failed to create assertion: %v", err)
+			}
+			if tt.header == nil {
+				tt.header = http.Header{}
+			}
+			result := &serviceResult{
+				service: &Service{Name: "api"},
+				resp:    &http.Response{StatusCode: tt.status, Header: tt.header},
+				body:    []byte(tt.body),
+			}
+
+			if kind, reason := assertions[""][0].Check(result); kind != tt.wantKind {
+				t.Errorf("Expected failure %q, got %q (%s)", tt.wantKind, kind, reason)
+			}
+		})
+	}
+
+	if _, err := newResponseAssertions([]config.RouteAssertion{{Route: "/api", Body: "data"}}); err == nil {
+		t.Error("Expected an error for an invalid body predicate")
+	}
+}
+
+// TestAssertionActions tests that only the error action replaces failing responses
+func TestAssertionActions(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		wantStatus int
+	}{
+		{name: "log", action: "log", wantStatus: 200},
+		{name: "count", action: "count", wantStatus: 200},
+		{name: "error", action: "error", wantStatus: 503},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+				},
+				Assertions: []config.RouteAssertion{
+					{Route: "/api", Status: []int{200}},
+					{Route: "/api", Headers: []string{"X-Version"}, Action: tt.action, ErrorStatus: 503},
+				},
+			}
+			conductor := NewConductor(cfg)
+			conductor.client = &http.Client{Transport: &recordingTransport{}}
+
+			req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus != 200 && !strings.Contains(recorder.Body.String(), ErrCodeAssertionFailed) {
+				t.Errorf("Expected %s error code, got %s", ErrCodeAssertionFailed, recorder.Body.String())
+			}
+		})
+	}
+}
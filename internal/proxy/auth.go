@@ -0,0 +1,450 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Authentication method types
+const (
+	authTypeAPIKey      = "apiKey"
+	authTypeIPAllowlist = "ipAllowlist"
+	authTypeJWT         = "jwt"
+	authTypeMTLS        = "mtls"
+)
+
+// authMethod checks whether a request satisfies one authentication method
+type authMethod interface {
+	Authenticate(r *http.Request) bool
+}
+
+// newAuthMethod builds an authentication method from its configuration
+func newAuthMethod(name string, cfg config.AuthMethodConfig) (authMethod, error) {
+	switch cfg.Type {
+	case authTypeAPIKey:
+		header := cfg.Header
+		if header == "" {
+			header = "X-API-Key"
+		}
+		if len(cfg.Keys) == 0 {
+			return nil, fmt.Errorf("auth method %q has no keys", name)
+		}
+		return &apiKeyAuth{header: header, keys: cfg.Keys}, nil
+
+	case authTypeIPAllowlist:
+		allow := &ipAllowlistAuth{}
+		for _, cidr := range cfg.CIDRs {
+			if !strings.Contains(cidr, "/") {
+				if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("auth method %q: %w", name, err)
+			}
+			allow.networks = append(allow.networks, network)
+		}
+		return allow, nil
+
+	case authTypeJWT:
+		auth := &jwtAuth{issuer: cfg.Issuer, audience: cfg.Audience}
+		if cfg.Secret != "" {
+			auth.secret = []byte(cfg.Secret)
+		}
+		if cfg.PublicKeyFile != "" {
+			key, err := loadRSAPublicKey(cfg.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("auth method %q: %w", name, err)
+			}
+			auth.publicKey = key
+		}
+		if auth.secret == nil && auth.publicKey == nil {
+			return nil, fmt.Errorf("auth method %q needs a secret or publicKeyFile", name)
+		}
+		return auth, nil
+
+	case authTypeMTLS:
+		auth := &mtlsAuth{subjects: make(map[string]bool)}
+		for _, subject := range cfg.Subjects {
+			auth.subjects[subject] = true
+		}
+		return auth, nil
+
+	default:
+		return nil, fmt.Errorf("auth method %q has unknown type %q", name, cfg.Type)
+	}
+}
+
+// apiKeyAuth accepts requests carrying one of the configured keys in a header
+type apiKeyAuth struct {
+	header string
+	keys   []string
+}
+
+// Authenticate implements authMethod
+func (a *apiKeyAuth) Authenticate(r *http.Request) bool {
+	provided := r.Header.Get(a.header)
+	if provided == "" {
+		return false
+	}
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAllowlistAuth accepts requests from client addresses in the configured networks
+type ipAllowlistAuth struct {
+	networks []*net.IPNet
+}
+
+// Authenticate implements authMethod
+func (a *ipAllowlistAuth) Authenticate(r *http.Request) bool {
+	ip := net.ParseIP(clientAddress(r))
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// mtlsAuth accepts requests with a verified client certificate, optionally restricted to
+// certificates with one of the configured subject common names
+type mtlsAuth struct {
+	subjects map[string]bool
+}
+
+// Authenticate implements authMethod
+func (a *mtlsAuth) Authenticate(r *http.Request) bool {
+	subject, ok := verifiedSubject(r)
+	return ok && (len(a.subjects) == 0 || a.subjects[subject])
+}
+
+// verifiedSubject returns the subject common name of the request's verified client
+// certificate, or false if the client did not present one that verified
+func verifiedSubject(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// jwtAuth accepts requests with a valid bearer JWT signed with HS256 or RS256
+type jwtAuth struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+	issuer    string
+	audience  string
+}
+
+// jwtClaims holds the registered claims checked by jwtAuth
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+// Authenticate implements authMethod
+func (a *jwtAuth) Authenticate(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return a.verify(token, time.Now()) == nil
+}
+
+// Claim returns a scalar claim of the request's bearer token, provided the token verifies
+func (a *jwtAuth) Claim(r *http.Request, name string) (string, bool) {
+	claims, ok := a.Claims(r)
+	if !ok {
+		return "", false
+	}
+	return claimString(claims[name])
+}
+
+// Claims returns the claims of the request's bearer token, provided the token verifies
+func (a *jwtAuth) Claims(r *http.Request) (map[string]interface{}, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || a.verify(token, time.Now()) != nil {
+		return nil, false
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(strings.Split(token, ".")[1], &claims); err != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+// claimString formats a scalar claim value, or returns false for objects and arrays
+func claimString(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(value), true
+	}
+	return "", false
+}
+
+// verify checks the token's signature and registered claims
+func (a *jwtAuth) verify(token string, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Algorithm == "HS256" && a.secret != nil:
+		mac := hmac.New(sha256.New, a.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("invalid signature")
+		}
+	case header.Algorithm == "RS256" && a.publicKey != nil:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(a.publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", header.Algorithm)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return err
+	}
+	unix := float64(now.Unix())
+	if claims.ExpiresAt != nil && unix >= *claims.ExpiresAt {
+		return errors.New("token expired")
+	}
+	if claims.NotBefore != nil && unix < *claims.NotBefore {
+		return errors.New("token not yet valid")
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return errors.New("unexpected issuer")
+	}
+	if a.audience != "" && !audienceContains(claims.Audience, a.audience) {
+		return errors.New("unexpected audience")
+	}
+	return nil
+}
+
+// decodeJWTSegment decodes a base64url JSON segment of a token
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains reports whether an aud claim, a string or an array of strings,
+// contains the audience
+func audienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		for _, aud := range list {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadRSAPublicKey reads a PEM-encoded RSA public key
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key in %s is not an RSA public key", path)
+	}
+	return rsaKey, nil
+}
+
+// authExpr is a parsed authentication requirement
+type authExpr = boolExpr[*http.Request]
+
+// authRef requires a single named method
+type authRef struct {
+	method authMethod
+}
+
+// Eval implements authExpr
+func (a authRef) Eval(r *http.Request) bool { return a.method.Authenticate(r) }
+
+// parseAuthExpr parses a requirement expression over the named methods, such as
+// "jwt OR (apiKey AND office)"
+func parseAuthExpr(expr string, methods map[string]authMethod) (authExpr, error) {
+	return parseBoolExpr(expr, "auth requirement", func(name string) (authExpr, error) {
+		method, ok := methods[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown auth method %q", name)
+		}
+		return authRef{method: method}, nil
+	})
+}
+
+// newAuthMethods builds the configured authentication methods by name
+func newAuthMethods(cfg config.AuthConfig) (map[string]authMethod, error) {
+	methods := make(map[string]authMethod)
+	for name, methodConfig := range cfg.Methods {
+		method, err := newAuthMethod(name, methodConfig)
+		if err != nil {
+			return nil, err
+		}
+		methods[name] = method
+	}
+	return methods, nil
+}
+
+// newJWTMethod builds the named authentication method, which must be a jwt method, so
+// claims of the tokens it verifies can be read
+func newJWTMethod(name string, cfg config.AuthConfig) (*jwtAuth, error) {
+	method, err := newAuthMethod(name, cfg.Methods[name])
+	if err != nil {
+		return nil, err
+	}
+	jwt, ok := method.(*jwtAuth)
+	if !ok {
+		return nil, fmt.Errorf("auth method %q is not a jwt method", name)
+	}
+	return jwt, nil
+}
+
+// clientIdentity identifies the client sending a request from its verified credentials
+type clientIdentity struct {
+	jwt   *jwtAuth // Verifies the token the claim is read from, nil to only use client certificates
+	claim string
+}
+
+// newClientIdentity builds the identification of clients from its configuration
+func newClientIdentity(cfg config.IdentityConfig, auth config.AuthConfig) (*clientIdentity, error) {
+	identity := &clientIdentity{claim: cfg.Claim}
+	if cfg.Auth != "" {
+		jwt, err := newJWTMethod(cfg.Auth, auth)
+		if err != nil {
+			return nil, err
+		}
+		identity.jwt = jwt
+	}
+	return identity, nil
+}
+
+// Identify returns who the request comes from: the claim of its verified bearer token,
+// or else the subject of its verified client certificate. Requests carrying neither are
+// not identified.
+func (i *clientIdentity) Identify(r *http.Request) (string, bool) {
+	if i.jwt != nil {
+		if value, ok := i.jwt.Claim(r, i.claim); ok && value != "" {
+			return value, true
+		}
+	}
+	return verifiedSubject(r)
+}
+
+// newRouteAuth builds the authentication requirement of each configured route
+func newRouteAuth(cfg config.AuthConfig) (map[string]authExpr, error) {
+	methods, err := newAuthMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	requirements := make(map[string]authExpr)
+	for _, route := range cfg.Routes {
+		expr, err := parseAuthExpr(route.Require, methods)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", route.Route, err)
+		}
+		requirements[route.Route] = expr
+	}
+	return requirements, nil
+}
+
+// authorize reports whether the request satisfies its route's authentication requirement
+func (c *Conductor) authorize(route string, r *http.Request) bool {
+	expr, ok := c.auth[route]
+	return !ok || expr.Eval(r)
+}
+
+// handleUnauthorized rejects a request that does not satisfy its route's requirement
+func (c *Conductor) handleUnauthorized(w http.ResponseWriter, r *http.Request, route string, requestStart time.Time, traceID string) {
+	logger.WarnWithFields("Request does not satisfy route authentication", map[string]interface{}{
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"route":       route,
+		"remote_addr": r.RemoteAddr,
+	})
+	writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "Authentication required")
+
+	// Record rejected request in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", route, "unauthorized")
+		c.prometheusMetrics.RecordRequest("conductor", route, r.Method, "401", time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, true)
+	}
+	c.recordSLO(route, http.StatusUnauthorized, time.Since(requestStart))
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// signJWT builds an HS256 or RS256 token with the given claims
+func signJWT(t *testing.T, alg string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// TestJWTAuth tests JWT signature and claim validation
+func TestJWTAuth(t *testing.T) {
+	secret := []byte("shared-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	auth := &jwtAuth{secret: secret, publicKey: &rsaKey.PublicKey, issuer: "sso", audience: "conductor"}
+	now := time.Unix(1700000000, 0)
+	valid := map[string]interface{}{"iss": "sso", "aud": []string{"other", "conductor"}, "exp": now.Unix() + 60}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid HS256", token: signJWT(t, "HS256", secret, valid)},
+		{name: "valid RS256", token: signJWT(t, "RS256", rsaKey, valid)},
+		{name: "wrong secret", token: signJWT(t, "HS256", []byte("guess"), valid), wantErr: true},
+		{name: "alg none", token: signJWT(t, "none", nil, valid), wantErr: true},
+		{name: "expired", token: signJWT(t, "HS256", secret, map[string]interface{}{"iss": "sso", "aud": "conductor", "exp": now.Unix()}), wantErr: true},
+		{name: "not yet valid", token: signJWT(t, "HS256", secret, map[string]interface{}{"iss": "sso", "aud": "conductor", "nbf": now.Unix() + 60}), wantErr: true},
+		{name: "wrong issuer", token: signJWT(t, "HS256", secret, map[string]interface{}{"iss": "other", "aud": "conductor"}), wantErr: true},
+		{name: "wrong audience", token: signJWT(t, "HS256", secret, map[string]interface{}{"iss": "sso", "aud": "other"}), wantErr: true},
+		{name: "malformed", token: "not-a-token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := auth.verify(tt.token, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestParseAuthExpr tests requirement expressions combining methods
+func TestParseAuthExpr(t *testing.T) {
+	methods, err := newRouteAuth(config.AuthConfig{})
+	if err != nil || len(methods) != 0 {
+		t.Fatalf("Expected no requirements, got %v (err: %v)", methods, err)
+	}
+
+	key, _ := newAuthMethod("key", config.AuthMethodConfig{Type: "apiKey", Keys: []string{"k1"}})
+	office, _ := newAuthMethod("office", config.AuthMethodConfig{Type: "ipAllowlist", CIDRs: []string{"10.0.0.0/8", "192.0.2.1"}})
+	mtls, _ := newAuthMethod("mtls", config.AuthMethodConfig{Type: "mtls", Subjects: []string{"billing"}})
+	named := map[string]authMethod{"key": key, "office": office, "mtls": mtls}
+
+	tests := []struct {
+		name     string
+		expr     string
+		apiKey   string
+		addr     string
+		clientCN string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "AND satisfied", expr: "key AND office", apiKey: "k1", addr: "10.1.2.3:1234", want: true},
+		{name: "AND missing key", expr: "key AND office", addr: "10.1.2.3:1234", want: false},
+		{name: "OR with certificate", expr: "mtls OR key", clientCN: "billing", addr: "203.0.113.1:1", want: true},
+		{name: "OR with wrong certificate", expr: "mtls || key", clientCN: "search", addr: "203.0.113.1:1", want: false},
+		{name: "AND binds tighter", expr: "mtls or key and office", apiKey: "k1", addr: "192.0.2.1:1", want: true},
+		{name: "parentheses", expr: "(mtls || key) && office", apiKey: "k1", addr: "203.0.113.1:1", want: false},
+		{name: "unknown method", expr: "key OR sso", wantErr: true},
+		{name: "dangling operator", expr: "key AND", wantErr: true},
+		{name: "unbalanced", expr: "(key OR office", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parseAuthExpr(tt.expr, named)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			req.RemoteAddr = tt.addr
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			if tt.clientCN != "" {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.clientCN}}
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
+			if got := expr.Eval(req); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestRouteAuthentication tests that only configured routes require authentication
+func TestRouteAuthentication(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "admin", URL: "http://admin.example.com", PathPrefix: "/admin", Primary: true},
+			{Name: "public", URL: "http://public.example.com", PathPrefix: "/public", Primary: true},
+		},
+		Auth: config.AuthConfig{
+			Methods: map[string]config.AuthMethodConfig{"key": {Type: "apiKey", Keys: []string{"k1"}}},
+			Routes:  []config.RouteAuth{{Route: "/admin", Require: "key"}},
+		},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: &recordingTransport{}}
+
+	get := func(path string, apiKey string) int {
+		req := httptest.NewRequest("GET", "http://example.com"+path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if code := get("/admin/users", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a key, got %d", code)
+	}
+	if code := get("/admin/users", "k1"); code != http.StatusOK {
+		t.Errorf("Expected 200 with a key, got %d", code)
+	}
+	if code := get("/public/users", ""); code != http.StatusOK {
+		t.Errorf("Expected open route to need no key, got %d", code)
+	}
+}
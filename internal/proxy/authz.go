@@ -0,0 +1,315 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Authorizer types
+const (
+	authzTypeStatic = "static"
+	authzTypeHTTP   = "http"
+)
+
+// Decision is an authorizer's answer for a request
+type Decision struct {
+	Allow  bool
+	Reason string // Why the request was decided so, logged but never sent to the client
+}
+
+// Authorizer decides whether an authenticated request may reach a route's services, so
+// access can be governed by a central policy engine
+type Authorizer interface {
+	Authorize(ctx context.Context, r *http.Request, route string) Decision
+}
+
+// staticAuthorizer decides by the first of its rules matching the request
+type staticAuthorizer struct {
+	rules []staticAuthzRule
+	allow bool // Decision when no rule matches
+}
+
+// staticAuthzRule allows or denies the requests matching its method, path, verified
+// claims and subject, and headers
+type staticAuthzRule struct {
+	allow    bool
+	methods  map[string]bool // Nil for any method
+	prefix   string
+	jwt      *jwtAuth          // Verifies the token whose claims are matched, nil if claims are not matched
+	claims   map[string]string // Claim values required, "*" for any
+	subjects map[string]bool   // Nil for any client certificate, or none
+	match    *requestMatch     // Nil if headers are not matched
+}
+
+// newStaticAuthorizer builds the static authorizer of a route
+func newStaticAuthorizer(cfg config.RouteAuthz, auth config.AuthConfig) (*staticAuthorizer, error) {
+	a := &staticAuthorizer{allow: cfg.Default == "allow"}
+	for i, rule := range cfg.Rules {
+		r := staticAuthzRule{allow: rule.Effect == "allow", prefix: rule.PathPrefix, claims: rule.Claims, match: newRequestMatch(rule.Headers, nil)}
+		if len(rule.Methods) > 0 {
+			r.methods = make(map[string]bool, len(rule.Methods))
+			for _, method := range rule.Methods {
+				r.methods[strings.ToUpper(method)] = true
+			}
+		}
+		if len(rule.Claims) > 0 {
+			jwt, err := newJWTMethod(rule.Auth, auth)
+			if err != nil {
+				return nil, fmt.Errorf("authz rule %d for route %q: %w", i+1, cfg.Route, err)
+			}
+			r.jwt = jwt
+		}
+		if len(rule.Subjects) > 0 {
+			r.subjects = make(map[string]bool, len(rule.Subjects))
+			for _, subject := range rule.Subjects {
+				r.subjects[subject] = true
+			}
+		}
+		a.rules = append(a.rules, r)
+	}
+	return a, nil
+}
+
+// Authorize implements Authorizer
+func (a *staticAuthorizer) Authorize(ctx context.Context, r *http.Request, route string) Decision {
+	for i, rule := range a.rules {
+		if rule.methods != nil && !rule.methods[r.Method] {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, rule.prefix) {
+			continue
+		}
+		if rule.jwt != nil && !rule.matchesClaims(r) {
+			continue
+		}
+		if rule.subjects != nil {
+			if subject, ok := verifiedSubject(r); !ok || !rule.subjects[subject] {
+				continue
+			}
+		}
+		if rule.match != nil && !rule.match.Matches(r) {
+			continue
+		}
+		return Decision{Allow: rule.allow, Reason: fmt.Sprintf("rule %d", i+1)}
+	}
+	return Decision{Allow: a.allow, Reason: "default"}
+}
+
+// matchesClaims reports whether the request carries a token verified by the rule's auth
+// method with every claim it requires
+func (rule staticAuthzRule) matchesClaims(r *http.Request) bool {
+	claims, ok := rule.jwt.Claims(r)
+	if !ok {
+		return false
+	}
+	for name, want := range rule.claims {
+		value, ok := claimString(claims[name])
+		if !ok || want != "*" && value != want {
+			return false
+		}
+	}
+	return true
+}
+
+// httpAuthorizer asks an external policy engine for each decision, posting the request's
+// attributes as an OPA-style input document
+type httpAuthorizer struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	failOpen bool
+}
+
+// authzInput describes a request to an external authorizer
+type authzInput struct {
+	Route      string            `json:"route"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Query      string            `json:"query,omitempty"`
+	Headers    map[string]string `json:"headers"`
+	RemoteAddr string            `json:"remote_addr"`
+	RequestID  string            `json:"request_id,omitempty"`
+}
+
+// NewHTTPAuthorizer creates an authorizer posting {"input": {...}} describing the request
+// to the given URL, such as an OPA decision endpoint, and accepting {"result": true} or
+// {"result": {"allow": true, "reason": "..."}}. Requests are allowed when no decision is
+// received in time only if failOpen is set.
+func NewHTTPAuthorizer(url string, headers map[string]string, timeout time.Duration, failOpen bool) Authorizer {
+	return &httpAuthorizer{
+		url:      url,
+		headers:  headers,
+		client:   &http.Client{Timeout: timeout},
+		failOpen: failOpen,
+	}
+}
+
+// Authorize implements Authorizer
+func (a *httpAuthorizer) Authorize(ctx context.Context, r *http.Request, route string) Decision {
+	decision, err := a.decide(ctx, r, route)
+	if err != nil {
+		return Decision{Allow: a.failOpen, Reason: "authorizer unavailable: " + err.Error()}
+	}
+	return decision
+}
+
+// decide asks the policy engine for a decision
+func (a *httpAuthorizer) decide(ctx context.Context, r *http.Request, route string) (Decision, error) {
+	input := authzInput{
+		Route:      route,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Headers:    make(map[string]string, len(r.Header)),
+		RemoteAddr: r.RemoteAddr,
+		RequestID:  r.Header.Get(requestIDHeader),
+	}
+	for name, values := range r.Header {
+		input.Headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	body, err := json.Marshal(map[string]authzInput{"input": input})
+	if err != nil {
+		return Decision{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range a.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return Decision{}, fmt.Errorf("authorizer returned status %d", resp.StatusCode)
+	}
+
+	var answer struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return Decision{}, fmt.Errorf("invalid authorizer response: %w", err)
+	}
+
+	// A policy that is not defined for the input leaves the result out, which denies
+	var allow bool
+	if len(answer.Result) == 0 || json.Unmarshal(answer.Result, &allow) == nil {
+		return Decision{Allow: allow, Reason: "policy"}, nil
+	}
+	var result struct {
+		Allow  bool   `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(answer.Result, &result); err != nil {
+		return Decision{}, fmt.Errorf("invalid authorizer result: %w", err)
+	}
+	if result.Reason == "" {
+		result.Reason = "policy"
+	}
+	return Decision{Allow: result.Allow, Reason: result.Reason}, nil
+}
+
+// newRouteAuthorizers builds the authorizers of the configured routes, which must exist
+func newRouteAuthorizers(cfg []config.RouteAuthz, auth config.AuthConfig, services []*Service) (map[string]Authorizer, error) {
+	known := make(map[string]bool)
+	for _, svc := range services {
+		known[svc.Route] = true
+	}
+
+	authorizers := make(map[string]Authorizer)
+	for _, authz := range cfg {
+		if !known[authz.Route] {
+			return nil, fmt.Errorf("authorizer for unknown route %q", authz.Route)
+		}
+		switch authz.Type {
+		case authzTypeStatic:
+			authorizer, err := newStaticAuthorizer(authz, auth)
+			if err != nil {
+				return nil, err
+			}
+			authorizers[authz.Route] = authorizer
+		case authzTypeHTTP:
+			authorizers[authz.Route] = NewHTTPAuthorizer(authz.URL, authz.Headers, time.Duration(authz.TimeoutMs)*time.Millisecond, authz.FailOpen)
+		default:
+			return nil, fmt.Errorf("authorizer for route %q has unknown type %q", authz.Route, authz.Type)
+		}
+	}
+	return authorizers, nil
+}
+
+// WithAuthorizer governs access to the route with the given authorizer instead of the
+// configured one, such as an adapter for a policy engine without an HTTP decision API.
+// It must be called before the conductor serves requests.
+func WithAuthorizer(c *Conductor, route string, authorizer Authorizer) {
+	c.routesMu.Lock()
+	defer c.routesMu.Unlock()
+	if c.authorizers == nil {
+		c.authorizers = make(map[string]Authorizer)
+	}
+	c.authorizers[route] = authorizer
+}
+
+// carryAuthorizers keeps the authorizers of routes that remain, so a reload reuses their
+// clients and keeps those installed with WithAuthorizer
+func carryAuthorizers(authorizers map[string]Authorizer, previous map[string]Authorizer, services []*Service) map[string]Authorizer {
+	known := make(map[string]bool)
+	for _, svc := range services {
+		known[svc.Route] = true
+	}
+	for route, authorizer := range previous {
+		if known[route] {
+			authorizers[route] = authorizer
+		}
+	}
+	return authorizers
+}
+
+// authorizeAccess asks the route's authorizer whether the request may proceed. Routes
+// without an authorizer are open to every authenticated request.
+func (c *Conductor) authorizeAccess(route string, r *http.Request) Decision {
+	authorizer, ok := c.currentAuthorizer(route)
+	if !ok {
+		return Decision{Allow: true}
+	}
+	return authorizer.Authorize(r.Context(), r, route)
+}
+
+// handleForbidden rejects a request the route's authorizer denied
+func (c *Conductor) handleForbidden(w http.ResponseWriter, r *http.Request, route string, decision Decision, requestStart time.Time, traceID string) {
+	logger.WarnWithFields("Request denied by route authorizer", map[string]interface{}{
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"route":       route,
+		"reason":      decision.Reason,
+		"remote_addr": r.RemoteAddr,
+	})
+	writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "Access denied")
+
+	// Record rejected request in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", route, "forbidden")
+		c.prometheusMetrics.RecordRequest("conductor", route, r.Method, "403", time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, true)
+	}
+	c.recordSLO(route, http.StatusForbidden, time.Since(requestStart))
+}
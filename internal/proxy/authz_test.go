@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestStaticAuthorizer tests that the first matching rule decides, and the default otherwise
+func TestStaticAuthorizer(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+		Authz: []config.RouteAuthz{{
+			Route: "/api",
+			Type:  "static",
+			Rules: []config.AuthzRule{
+				{Effect: "deny", PathPrefix: "/api/admin", Headers: map[string]string{"X-Role": "viewer"}},
+				{Effect: "allow", Methods: []string{"get"}},
+				{Effect: "allow", Headers: map[string]string{"X-Role": "editor"}},
+			},
+			Default: "deny",
+		}},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: &recordingTransport{}}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		role       string
+		wantStatus int
+	}{
+		{name: "read", method: "GET", path: "/api/items", role: "viewer", wantStatus: http.StatusOK},
+		{name: "denied before allowed", method: "GET", path: "/api/admin/users", role: "viewer", wantStatus: http.StatusForbidden},
+		{name: "write by editor", method: "POST", path: "/api/items", role: "editor", wantStatus: http.StatusOK},
+		{name: "write by viewer", method: "POST", path: "/api/items", role: "viewer", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-Role", tt.role)
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+// TestStaticAuthorizerPrincipal tests rules matching the claims of a verified token and
+// the subject of a verified client certificate, which clients cannot assert themselves
+func TestStaticAuthorizerPrincipal(t *testing.T) {
+	secret := []byte("sso-secret")
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+		Auth: config.AuthConfig{Methods: map[string]config.AuthMethodConfig{
+			"sso": {Type: "jwt", Secret: string(secret)},
+		}},
+		Authz: []config.RouteAuthz{{
+			Route: "/api",
+			Type:  "static",
+			Rules: []config.AuthzRule{
+				{Effect: "allow", Auth: "sso", Claims: map[string]string{"role": "editor"}},
+				{Effect: "allow", Subjects: []string{"billing"}},
+			},
+			Default: "deny",
+		}},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: &recordingTransport{}}
+
+	tests := []struct {
+		name       string
+		token      string
+		clientCN   string
+		wantStatus int
+	}{
+		{name: "verified claim", token: signJWT(t, "HS256", secret, map[string]interface{}{"role": "editor"}), wantStatus: http.StatusOK},
+		{name: "other claim", token: signJWT(t, "HS256", secret, map[string]interface{}{"role": "viewer"}), wantStatus: http.StatusForbidden},
+		{name: "forged claim", token: signJWT(t, "HS256", []byte("guess"), map[string]interface{}{"role": "editor"}), wantStatus: http.StatusForbidden},
+		{name: "verified subject", clientCN: "billing", wantStatus: http.StatusOK},
+		{name: "other subject", clientCN: "search", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/items", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.clientCN != "" {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.clientCN}}
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+// TestHTTPAuthorizer tests decisions taken by an OPA-style policy endpoint, and the
+// fallback when it cannot answer
+func TestHTTPAuthorizer(t *testing.T) {
+	policy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input authzInput `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch body.Input.Headers["x-user"] {
+		case "alice":
+			w.Write([]byte(`{"result": true}`))
+		case "bob":
+			w.Write([]byte(`{"result": {"allow": false, "reason": "not in group"}}`))
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{"result": true}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer policy.Close()
+
+	tests := []struct {
+		name      string
+		user      string
+		failOpen  bool
+		wantAllow bool
+	}{
+		{name: "allowed", user: "alice", wantAllow: true},
+		{name: "denied with reason", user: "bob"},
+		{name: "undefined result", user: "carol"},
+		{name: "timeout fails closed", user: "slow"},
+		{name: "timeout fails open", user: "slow", failOpen: true, wantAllow: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorizer := NewHTTPAuthorizer(policy.URL, nil, 50*time.Millisecond, tt.failOpen)
+			req := httptest.NewRequest("GET", "/api/items", nil)
+			req.Header.Set("X-User", tt.user)
+
+			decision := authorizer.Authorize(context.Background(), req, "/api")
+			if decision.Allow != tt.wantAllow {
+				t.Errorf("Expected allow %v, got %+v", tt.wantAllow, decision)
+			}
+			if tt.user == "bob" && decision.Reason != "not in group" {
+				t.Errorf("Expected the policy's reason, got %q", decision.Reason)
+			}
+		})
+	}
+}
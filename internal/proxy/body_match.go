@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// matchLiteral matches the string literals of a match predicate
+var matchLiteral = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// matchOperator matches comparison operators along with the spaces around them
+var matchOperator = regexp.MustCompile(`\s*(==|!=)\s*`)
+
+// bodyDocument is a request body decoded for match predicates. Bodies that are not JSON
+// or exceed the peek limit are not ok, and satisfy no comparison.
+type bodyDocument struct {
+	value any
+	ok    bool
+}
+
+// bodyMatch is a match predicate over JSON body fields
+type bodyMatch = boolExpr[*bodyDocument]
+
+// bodyComparison is a term of a match predicate: a field compared with a JSON literal, or
+// a field that must be present and neither null nor false
+type bodyComparison struct {
+	path     []any // Object keys and array indexes from the document root
+	operator string
+	value    any
+}
+
+// Eval implements boolExpr
+func (m *bodyComparison) Eval(doc *bodyDocument) bool {
+	if !doc.ok {
+		return false
+	}
+	value, found := lookupField(doc.value, m.path)
+	switch m.operator {
+	case "==":
+		return found && reflect.DeepEqual(value, m.value)
+	case "!=":
+		return !found || !reflect.DeepEqual(value, m.value)
+	default:
+		return found && value != nil && value != false
+	}
+}
+
+// lookupField follows a path of keys and indexes into a decoded JSON value
+func lookupField(value any, path []any) (any, bool) {
+	for _, step := range path {
+		switch step := step.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[step]; !ok {
+				return nil, false
+			}
+		case int:
+			array, ok := value.([]any)
+			if !ok || step >= len(array) {
+				return nil, false
+			}
+			value = array[step]
+		}
+	}
+	return value, true
+}
+
+// parseBodyMatch parses a match predicate such as `$.type == "refund" AND $.amount != 0`.
+// Terms compare a field with a JSON literal using == or !=, or name a field alone.
+func parseBodyMatch(expr string) (bodyMatch, error) {
+	// Hide literals from the tokenizer and join comparisons into single terms
+	var literals []string
+	prepared := matchLiteral.ReplaceAllStringFunc(expr, func(literal string) string {
+		literals = append(literals, literal)
+		return fmt.Sprintf("\x00%d\x00", len(literals)-1)
+	})
+	prepared = matchOperator.ReplaceAllString(prepared, "$1")
+
+	restore := func(term string) string {
+		for i, literal := range literals {
+			term = strings.ReplaceAll(term, fmt.Sprintf("\x00%d\x00", i), literal)
+		}
+		return term
+	}
+	return parseBoolExpr(prepared, "match predicate", func(term string) (bodyMatch, error) {
+		field, literal, operator := term, "", ""
+		for _, op := range []string{"==", "!="} {
+			if before, after, ok := strings.Cut(term, op); ok {
+				field, literal, operator = before, restore(after), op
+				break
+			}
+		}
+
+		path, err := parseFieldPath(field)
+		if err != nil {
+			return nil, err
+		}
+		comparison := &bodyComparison{path: path, operator: operator}
+		if operator != "" {
+			if err := json.Unmarshal([]byte(literal), &comparison.value); err != nil {
+				return nil, fmt.Errorf("invalid value %q in match predicate: must be a JSON literal", literal)
+			}
+		}
+		return comparison, nil
+	})
+}
+
+// parseFieldPath parses a field path such as $.order.items[0].sku
+func parseFieldPath(field string) ([]any, error) {
+	rest, ok := strings.CutPrefix(field, "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid field %q in match predicate: must start with $", field)
+	}
+
+	var path []any
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("invalid field %q in match predicate: empty key", field)
+			}
+			path = append(path, key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field %q in match predicate: missing ]", field)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid field %q in match predicate: bad index %q", field, rest[1:end])
+			}
+			path = append(path, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid field %q in match predicate", field)
+		}
+	}
+	return path, nil
+}
+
+// peekedBody replays the peeked bytes of a request body before the rest of it
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// peekJSONBody decodes up to the peek limit of the request body, leaving the body intact
+// for the backends
+func (c *Conductor) peekJSONBody(r *http.Request) *bodyDocument {
+	if r.Body == nil || r.Body == http.NoBody {
+		return &bodyDocument{}
+	}
+
+	limit := int64(c.config.BodyPeekBytes)
+	peeked, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	r.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(peeked), r.Body), Closer: r.Body}
+	if err != nil || int64(len(peeked)) > limit {
+		logger.DebugWithFields("Request body too large to evaluate match predicates", map[string]interface{}{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"peek_bytes": limit,
+		})
+		return &bodyDocument{}
+	}
+
+	doc := &bodyDocument{}
+	doc.ok = json.Unmarshal(peeked, &doc.value) == nil
+	return doc
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestBodyMatch tests evaluating match predicates over JSON request bodies
+func TestBodyMatch(t *testing.T) {
+	body := `{"type":"refund","amount":25,"note":"a == b","order":{"items":[{"sku":"A-1"}]},"test":false}`
+
+	tests := []struct {
+		name    string
+		expr    string
+		body    string
+		want    bool
+		wantErr bool
+	}{
+		{name: "string equals", expr: `$.type == "refund"`, body: body, want: true},
+		{name: "string differs", expr: `$.type == "charge"`, body: body},
+		{name: "number", expr: `$.amount==25`, body: body, want: true},
+		{name: "nested index", expr: `$.order.items[0].sku == "A-1"`, body: body, want: true},
+		{name: "index out of range", expr: `$.order.items[3].sku == "A-1"`, body: body},
+		{name: "literal with operator", expr: `$.note == "a == b"`, body: body, want: true},
+		{name: "not equal missing field", expr: `$.currency != "EUR"`, body: body, want: true},
+		{name: "present", expr: `$.order`, body: body, want: true},
+		{name: "false is not present", expr: `$.test`, body: body},
+		{name: "and or", expr: `$.type == "charge" OR ($.type == "refund" AND $.amount != 0)`, body: body, want: true},
+		{name: "not json", expr: `$.type != "refund"`, body: "type=refund"},
+		{name: "missing dollar", expr: `type == "refund"`, wantErr: true},
+		{name: "bad literal", expr: `$.type == refund`, wantErr: true},
+		{name: "bad index", expr: `$.items[x]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := parseBodyMatch(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			conductor := &Conductor{config: &config.Config{BodyPeekBytes: 1024}}
+			req := httptest.NewRequest("POST", "http://example.com/payments", strings.NewReader(tt.body))
+			if got := match.Eval(conductor.peekJSONBody(req)); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			if replayed, _ := io.ReadAll(req.Body); string(replayed) != tt.body {
+				t.Errorf("Expected the body to be replayed, got %q", replayed)
+			}
+		})
+	}
+}
+
+// TestBodyRouting tests that services whose predicate matches replace the route's others
+func TestBodyRouting(t *testing.T) {
+	cfg := &config.Config{
+		Timeout:       5,
+		BodyPeekBytes: 64,
+		Services: []config.Service{
+			{Name: "payments", URL: "http://payments.example.com", PathPrefix: "/payments", Primary: true},
+			{Name: "payments-v2", URL: "http://payments-v2.example.com", PathPrefix: "/payments", Primary: true, Match: `$.type == "refund"`},
+			{Name: "payments-eu", URL: "http://payments-eu.example.com", PathPrefix: "/payments", Primary: true, Match: `$.region == "eu"`},
+		},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantHost string
+	}{
+		{name: "matching body", body: `{"type":"refund"}`, wantHost: "payments-v2.example.com"},
+		{name: "other body", body: `{"type":"charge"}`, wantHost: "payments.example.com"},
+		{name: "second predicate", body: `{"type":"charge","region":"eu"}`, wantHost: "payments-eu.example.com"},
+		{name: "both predicates", body: `{"type":"refund","region":"eu"}`, wantHost: "payments-v2.example.com"},
+		{name: "body over the peek limit", body: `{"type":"refund","note":"` + strings.Repeat("x", 64) + `"}`, wantHost: "payments.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport.requests = nil
+			req := httptest.NewRequest("POST", "http://example.com/payments/charges", strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if len(transport.requests) != 1 {
+				t.Fatalf("Expected 1 backend request, got %d", len(transport.requests))
+			}
+			sent := transport.requests[0]
+			if sent.URL.Host != tt.wantHost {
+				t.Errorf("Expected request to %s, got %s", tt.wantHost, sent.URL.Host)
+			}
+			if body, _ := io.ReadAll(sent.Body); string(body) != tt.body {
+				t.Errorf("Expected the full body to be forwarded, got %q", body)
+			}
+		})
+	}
+}
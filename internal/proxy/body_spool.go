@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// requestBody holds a request body that can be replayed to every matching backend.
+// Small bodies are kept in memory, larger ones are spooled to a temp file and
+// streamed independently to each backend.
+type requestBody struct {
+	data      []byte   // In-memory body, nil when spooled
+	file      *os.File // Spooled body, nil when held in memory
+	size      int64
+	closeOnce sync.Once
+}
+
+// spoolBody reads body into memory, switching to a temp file in dir once more than
+// threshold bytes have been read. A threshold of zero or less never spools.
+func spoolBody(body io.Reader, threshold int64, dir string) (*requestBody, error) {
+	if threshold <= 0 {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return &requestBody{data: data, size: int64(len(data))}, nil
+	}
+
+	// Read one byte past the threshold to find out whether the body fits in memory
+	data, err := io.ReadAll(io.LimitReader(body, threshold+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) <= threshold {
+		return &requestBody{data: data, size: int64(len(data))}, nil
+	}
+
+	file, err := os.CreateTemp(dir, "go-conductor-body-*")
+	if err != nil {
+		return nil, err
+	}
+	spooled := &requestBody{file: file}
+
+	size, err := io.Copy(file, io.MultiReader(bytes.NewReader(data), body))
+	if err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	spooled.size = size
+	return spooled, nil
+}
+
+// Reader returns a new reader positioned at the start of the body. Readers are
+// independent, so each backend can consume the body at its own pace.
+func (b *requestBody) Reader() io.Reader {
+	if b == nil {
+		return bytes.NewReader(nil)
+	}
+	if b.file != nil {
+		return io.NewSectionReader(b.file, 0, b.size)
+	}
+	return bytes.NewReader(b.data)
+}
+
+// Len returns the body size in bytes
+func (b *requestBody) Len() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.size
+}
+
+// Spooled reports whether the body is stored on disk
+func (b *requestBody) Spooled() bool {
+	return b != nil && b.file != nil
+}
+
+// Close removes the spool file, if any. It is safe to call more than once.
+func (b *requestBody) Close() error {
+	if b == nil || b.file == nil {
+		return nil
+	}
+
+	var err error
+	b.closeOnce.Do(func() {
+		b.file.Close()
+		err = os.Remove(b.file.Name())
+	})
+	return err
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSpoolBody tests that bodies above the threshold are spooled to disk and replayable
+func TestSpoolBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		threshold   int64
+		expectSpool bool
+	}{
+		{
+			name:        "spooling disabled",
+			body:        "0123456789",
+			threshold:   0,
+			expectSpool: false,
+		},
+		{
+			name:        "body at threshold stays in memory",
+			body:        "0123456789",
+			threshold:   10,
+			expectSpool: false,
+		},
+		{
+			name:        "body above threshold is spooled",
+			body:        "0123456789abcdef",
+			threshold:   10,
+			expectSpool: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := spoolBody(strings.NewReader(test.body), test.threshold, t.TempDir())
+			if err != nil {
+				t.Fatalf("Expected no error, but got: %v", err)
+			}
+
+			if body.Spooled() != test.expectSpool {
+				t.Errorf("Expected spooled: %v, got %v", test.expectSpool, body.Spooled())
+			}
+			if body.Len() != int64(len(test.body)) {
+				t.Errorf("Expected length %d, got %d", len(test.body), body.Len())
+			}
+
+			// Every reader must see the full body
+			for i := 0; i < 2; i++ {
+				data, err := io.ReadAll(body.Reader())
+				if err != nil || string(data) != test.body {
+					t.Errorf("Expected body %q, got %q (err: %v)", test.body, data, err)
+				}
+			}
+
+			var path string
+			if body.file != nil {
+				path = body.file.Name()
+			}
+			if err := body.Close(); err != nil {
+				t.Errorf("Expected no error on close, but got: %v", err)
+			}
+			if path != "" {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("Expected spool file %s to be removed", path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Actions taken when a route budget is exceeded
+const (
+	budgetActionLog     = "log"     // Log and count the violation
+	budgetActionCount   = "count"   // Only count the violation
+	budgetActionEnforce = "enforce" // Log, count and reject or abort the request
+)
+
+// Budget kinds used in logs and the budget_violations_total metric
+const (
+	budgetRequestBytes  = "request_bytes"
+	budgetResponseBytes = "response_bytes"
+	budgetLatency       = "latency"
+)
+
+// errResponseBudgetExceeded is returned for backend responses larger than an enforced budget
+var errResponseBudgetExceeded = errors.New("response exceeds the route's size budget")
+
+// budgetFor returns the budget configured for the route, if any
+func (c *Conductor) budgetFor(route string) (config.RouteBudget, bool) {
+	budget, ok := c.budgets[route]
+	return budget, ok
+}
+
+// checkRequestBudget reports a request body larger than the route's budget, returning
+// false if the request must be rejected
+func (c *Conductor) checkRequestBudget(route string, r *http.Request, size int64) bool {
+	budget, ok := c.budgetFor(route)
+	if !ok || budget.MaxRequestBytes == 0 || size <= budget.MaxRequestBytes {
+		return true
+	}
+
+	c.budgetViolation(budget, "conductor", budgetRequestBytes, map[string]interface{}{
+		"method":    r.Method,
+		"path":      r.URL.Path,
+		"body_len":  size,
+		"max_bytes": budget.MaxRequestBytes,
+	})
+	return budget.Action != budgetActionEnforce
+}
+
+// responseReadLimit returns how many response bytes to read from a service before giving
+// up, or zero to read the whole response
+func (c *Conductor) responseReadLimit(svc *Service) int64 {
+	budget, ok := c.budgetFor(svc.Route)
+	if !ok || budget.MaxResponseBytes == 0 || budget.Action != budgetActionEnforce {
+		return 0
+	}
+	// Read one byte past the budget so an oversized response can be detected
+	return budget.MaxResponseBytes + 1
+}
+
+// checkResponseBudget reports a response body larger than the route's budget, returning an
+// error if the response must be discarded
+func (c *Conductor) checkResponseBudget(svc *Service, size int64) error {
+	budget, ok := c.budgetFor(svc.Route)
+	if !ok || budget.MaxResponseBytes == 0 || size <= budget.MaxResponseBytes {
+		return nil
+	}
+
+	c.budgetViolation(budget, svc.Name, budgetResponseBytes, map[string]interface{}{
+		"service":      svc.Name,
+		"response_len": size,
+		"max_bytes":    budget.MaxResponseBytes,
+	})
+	if budget.Action == budgetActionEnforce {
+		return errResponseBudgetExceeded
+	}
+	return nil
+}
+
+// latencyLimit returns the enforced latency budget for a service's route, or zero if the
+// service's latency is not bounded by a budget
+func (c *Conductor) latencyLimit(svc *Service) time.Duration {
+	budget, ok := c.budgetFor(svc.Route)
+	if !ok || budget.Action != budgetActionEnforce {
+		return 0
+	}
+	return time.Duration(budget.MaxLatencyMs) * time.Millisecond
+}
+
+// checkLatencyBudget reports a service request slower than the route's budget
+func (c *Conductor) checkLatencyBudget(svc *Service, duration time.Duration) {
+	budget, ok := c.budgetFor(svc.Route)
+	if !ok || budget.MaxLatencyMs == 0 || duration <= time.Duration(budget.MaxLatencyMs)*time.Millisecond {
+		return
+	}
+
+	c.budgetViolation(budget, svc.Name, budgetLatency, map[string]interface{}{
+		"service":        svc.Name,
+		"duration_ms":    duration.Milliseconds(),
+		"max_latency_ms": budget.MaxLatencyMs,
+	})
+}
+
+// budgetViolation logs and counts a budget violation according to the budget's action
+func (c *Conductor) budgetViolation(budget config.RouteBudget, service string, kind string, fields map[string]interface{}) {
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordBudgetViolation(service, budget.Route, kind)
+	}
+	if budget.Action == budgetActionCount {
+		return
+	}
+
+	fields["route"] = budget.Route
+	fields["budget"] = kind
+	fields["action"] = budget.Action
+	logger.ForService(service).WarnWithFields("Route budget exceeded", fields)
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestRouteBudgets tests that budget violations are only enforced when configured to be
+func TestRouteBudgets(t *testing.T) {
+	tests := []struct {
+		name       string
+		budget     config.RouteBudget
+		body       string
+		transport  http.RoundTripper
+		wantStatus int
+	}{
+		{
+			name:       "response over budget is logged",
+			budget:     config.RouteBudget{MaxResponseBytes: 1, Action: "log"},
+			transport:  &recordingTransport{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "response over budget is aborted",
+			budget:     config.RouteBudget{MaxResponseBytes: 1, Action: "enforce"},
+			transport:  &recordingTransport{},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "response within budget",
+			budget:     config.RouteBudget{MaxResponseBytes: 2, Action: "enforce"},
+			transport:  &recordingTransport{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "request over budget is counted",
+			budget:     config.RouteBudget{MaxRequestBytes: 3, Action: "count"},
+			body:       "hello",
+			transport:  &recordingTransport{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "request over budget is rejected",
+			budget:     config.RouteBudget{MaxRequestBytes: 3, Action: "enforce"},
+			body:       "hello",
+			transport:  &recordingTransport{},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "slow response is aborted",
+			budget:     config.RouteBudget{MaxLatencyMs: 50, Action: "enforce"},
+			transport:  &blockingTransport{},
+			wantStatus: http.StatusGatewayTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.budget.Route = "/api"
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+				},
+				Budgets: []config.RouteBudget{tt.budget},
+			}
+			conductor := NewConductor(cfg)
+			conductor.client = &http.Client{Transport: tt.transport}
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "http://example.com/api/users", strings.NewReader(tt.body))
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
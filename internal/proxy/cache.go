@@ -0,0 +1,571 @@
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Results of response cache lookups reported in metrics
+const (
+	cacheHit         = "hit"         // Served from the cache without contacting a backend
+	cacheMiss        = "miss"        // Not cached, or the backend returned a new response
+	cacheRevalidated = "revalidated" // Stale entry confirmed unchanged by the backend with a 304
+	cacheStale       = "stale"       // Stale entry served while refreshed in the background
+	cacheStaleError  = "stale_error" // Stale entry served because the backend failed
+)
+
+// cacheEntry is a cached backend response
+type cacheEntry struct {
+	key                  string
+	route                string
+	service              *Service
+	status               int
+	header               http.Header
+	body                 []byte
+	vary                 map[string]string // Request header values the response varies on
+	stored               time.Time
+	expires              time.Time
+	staleWhileRevalidate time.Duration // How long after expiry the entry is served while refreshed
+	staleIfError         time.Duration // How long after expiry the entry is served when the backend fails
+	hits                 *atomic.Int64 // Times the entry was served, shared with its refreshed replacements
+	element              *list.Element
+}
+
+// Fresh reports whether the entry may be served without revalidation
+func (e *cacheEntry) Fresh(now time.Time) bool {
+	return now.Before(e.expires)
+}
+
+// StaleWhileRevalidate reports whether the stale entry may be served while it is refreshed
+func (e *cacheEntry) StaleWhileRevalidate(now time.Time) bool {
+	return now.Before(e.expires.Add(e.staleWhileRevalidate))
+}
+
+// StaleIfError reports whether the stale entry may be served in place of a failure
+func (e *cacheEntry) StaleIfError(now time.Time) bool {
+	return now.Before(e.expires.Add(e.staleIfError))
+}
+
+// result returns the entry as a service result that can be written to a client, counting
+// it as a hit
+func (e *cacheEntry) result(now time.Time) *serviceResult {
+	e.hits.Add(1)
+	header := e.header.Clone()
+	age := int64(now.Sub(e.stored).Seconds())
+	if upstream, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil {
+		age += upstream
+	}
+	header.Set("Age", strconv.FormatInt(age, 10))
+
+	return &serviceResult{
+		service: e.service,
+		resp:    &http.Response{StatusCode: e.status, Header: header, ProtoMajor: 1, ProtoMinor: 1},
+		body:    e.body,
+	}
+}
+
+// hasValidators reports whether the entry can be revalidated with a conditional request
+func (e *cacheEntry) hasValidators() bool {
+	return e.header.Get("ETag") != "" || e.header.Get("Last-Modified") != ""
+}
+
+// setConditions turns an outgoing request into a conditional request validating the entry,
+// replacing any conditions sent by the client
+func (e *cacheEntry) setConditions(header http.Header) {
+	header.Del("If-None-Match")
+	header.Del("If-Modified-Since")
+	if etag := e.header.Get("ETag"); etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if modified := e.header.Get("Last-Modified"); modified != "" {
+		header.Set("If-Modified-Since", modified)
+	}
+}
+
+// responseCache is a size-bounded LRU cache of backend responses following the HTTP
+// caching rules for shared caches
+type responseCache struct {
+	mu         sync.Mutex
+	config     config.CacheConfig
+	routes     map[string]config.CacheRoute // Stale serving by route
+	entries    map[string]*cacheEntry
+	lru        *list.List      // Most recently used at the front
+	refreshing map[string]bool // Keys being refreshed in the background
+	now        func() time.Time
+}
+
+// newResponseCache creates an empty cache
+func newResponseCache(cfg config.CacheConfig) *responseCache {
+	rc := &responseCache{
+		config:     cfg,
+		routes:     make(map[string]config.CacheRoute),
+		entries:    make(map[string]*cacheEntry),
+		lru:        list.New(),
+		refreshing: make(map[string]bool),
+		now:        time.Now,
+	}
+	for _, route := range cfg.Routes {
+		rc.routes[route.Route] = route
+	}
+	return rc
+}
+
+// cacheKey identifies a request's response within a route
+func cacheKey(route string, r *http.Request) string {
+	return route + " " + r.URL.RequestURI()
+}
+
+// Get returns the entry for a request, or nil if none matches its varying headers
+func (rc *responseCache) Get(key string, r *http.Request) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok {
+		return nil
+	}
+	for name, value := range entry.vary {
+		if r.Header.Get(name) != value {
+			return nil
+		}
+	}
+	rc.lru.MoveToFront(entry.element)
+	return entry
+}
+
+// Store caches a response if HTTP caching rules allow it, replacing any previous entry
+func (rc *responseCache) Store(route string, key string, r *http.Request, result *serviceResult) {
+	resp := result.resp
+	if resp.StatusCode != http.StatusOK || result.stream != nil || result.partial || int64(len(result.body)) > rc.config.MaxBodyBytes ||
+		resp.Header.Get("Set-Cookie") != "" {
+		return
+	}
+	directives := parseCacheControl(resp.Header)
+	if _, ok := directives["no-store"]; ok {
+		return
+	}
+	if _, ok := directives["private"]; ok {
+		return
+	}
+
+	vary := make(map[string]string)
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return
+			}
+			if name != "" {
+				vary[http.CanonicalHeaderKey(name)] = r.Header.Get(name)
+			}
+		}
+	}
+
+	now := rc.now()
+	lifetime := rc.freshness(resp.Header, directives, now)
+	staleWhileRevalidate, staleIfError := rc.staleWindows(route, directives)
+	if lifetime <= 0 && staleIfError <= 0 && resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" {
+		// Neither fresh, revalidatable nor usable on errors, so the entry could never be used
+		return
+	}
+
+	entry := &cacheEntry{
+		key:                  key,
+		route:                route,
+		service:              result.service,
+		status:               resp.StatusCode,
+		header:               resp.Header.Clone(),
+		body:                 result.body,
+		vary:                 vary,
+		stored:               now,
+		expires:              now.Add(lifetime),
+		staleWhileRevalidate: staleWhileRevalidate,
+		staleIfError:         staleIfError,
+		hits:                 new(atomic.Int64),
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.removeLocked(key)
+	entry.element = rc.lru.PushFront(entry)
+	rc.entries[key] = entry
+	for rc.lru.Len() > rc.config.MaxEntries {
+		rc.removeLocked(rc.lru.Back().Value.(*cacheEntry).key)
+	}
+}
+
+// Refresh replaces a stale entry after the backend confirmed it unchanged with a 304 and
+// returns the replacement. Entries are never modified once stored, so requests still
+// holding the stale entry are unaffected.
+func (rc *responseCache) Refresh(stale *cacheEntry, notModified *http.Response) *cacheEntry {
+	// The 304 carries the current metadata, such as a new Cache-Control or Date
+	header := stale.header.Clone()
+	for name, values := range notModified.Header {
+		header[name] = values
+	}
+	header.Del("Age")
+
+	now := rc.now()
+	directives := parseCacheControl(header)
+	entry := *stale
+	entry.header = header
+	entry.stored = now
+	entry.expires = now.Add(rc.freshness(header, directives, now))
+	entry.staleWhileRevalidate, entry.staleIfError = rc.staleWindows(stale.route, directives)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if current, ok := rc.entries[stale.key]; ok && current == stale {
+		rc.lru.Remove(stale.element)
+		entry.element = rc.lru.PushFront(&entry)
+		rc.entries[stale.key] = &entry
+	}
+	return &entry
+}
+
+// Invalidate removes the entry for a key, after a request that may have changed the resource
+func (rc *responseCache) Invalidate(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.removeLocked(key)
+}
+
+// removeLocked removes an entry. Callers must hold rc.mu.
+func (rc *responseCache) removeLocked(key string) {
+	if entry, ok := rc.entries[key]; ok {
+		rc.lru.Remove(entry.element)
+		delete(rc.entries, key)
+	}
+}
+
+// freshness returns how long a response may be served without revalidation, from
+// s-maxage, max-age or Expires, falling back to the configured default
+func (rc *responseCache) freshness(header http.Header, directives map[string]string, now time.Time) time.Duration {
+	if _, ok := directives["no-cache"]; ok {
+		return 0
+	}
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return 0
+			}
+			age, _ := strconv.Atoi(header.Get("Age"))
+			return time.Duration(seconds-age) * time.Second
+		}
+	}
+	if value := header.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			return 0
+		}
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			return expires.Sub(date)
+		}
+		return expires.Sub(now)
+	}
+	return time.Duration(rc.config.DefaultTTL) * time.Second
+}
+
+// staleWindows returns how long after expiry a response may be served while refreshed and
+// when the backend fails. The route's configuration takes precedence over the response's
+// stale-while-revalidate and stale-if-error directives, and must-revalidate forbids both.
+func (rc *responseCache) staleWindows(route string, directives map[string]string) (time.Duration, time.Duration) {
+	for _, name := range []string{"must-revalidate", "proxy-revalidate", "no-cache"} {
+		if _, ok := directives[name]; ok {
+			return 0, 0
+		}
+	}
+
+	window := func(configured int, directive string) time.Duration {
+		if configured > 0 {
+			return time.Duration(configured) * time.Second
+		}
+		seconds, _ := strconv.Atoi(directives[directive])
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	cfg := rc.routes[route]
+	return window(cfg.StaleWhileRevalidate, "stale-while-revalidate"), window(cfg.StaleIfError, "stale-if-error")
+}
+
+// startRefresh marks a key as being refreshed, reporting false if it already is
+func (rc *responseCache) startRefresh(key string) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.refreshing[key] {
+		return false
+	}
+	rc.refreshing[key] = true
+	return true
+}
+
+// endRefresh clears a key's refresh mark
+func (rc *responseCache) endRefresh(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	delete(rc.refreshing, key)
+}
+
+// parseCacheControl returns the Cache-Control directives of a header, lowercased, with
+// their unquoted arguments
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// cacheable reports whether a request may be answered from the cache
+func cacheable(r *http.Request) bool {
+	if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+		return false
+	}
+	_, noStore := parseCacheControl(r.Header)["no-store"]
+	return !noStore
+}
+
+// mustRevalidate reports whether the client asked for a response validated with the backend
+func mustRevalidate(r *http.Request) bool {
+	directives := parseCacheControl(r.Header)
+	_, noCache := directives["no-cache"]
+	return noCache || directives["max-age"] == "0" || r.Header.Get("Pragma") == "no-cache"
+}
+
+// notModified reports whether the client's conditional headers match a response, so a
+// 304 can be sent instead of the body
+func notModified(r *http.Request, header http.Header) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// notModifiedResult turns a result into a 304 carrying only the headers a 304 may include
+func notModifiedResult(result *serviceResult) *serviceResult {
+	header := make(http.Header)
+	for _, name := range []string{"Age", "Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary"} {
+		if values := result.resp.Header.Values(name); len(values) > 0 {
+			header[name] = values
+		}
+	}
+	resp := &http.Response{StatusCode: http.StatusNotModified, Header: header,
+		ProtoMajor: result.resp.ProtoMajor, ProtoMinor: result.resp.ProtoMinor}
+	return &serviceResult{service: result.service, resp: resp, cache: result.cache}
+}
+
+// revalidationKey is the request context key of the stale entry being revalidated
+type revalidationKey struct{}
+
+// revalidating returns the stale entry the request revalidates, if any
+func revalidating(ctx context.Context) *cacheEntry {
+	entry, _ := ctx.Value(revalidationKey{}).(*cacheEntry)
+	return entry
+}
+
+// cacheableRoute reports whether a request may be answered from and stored in the cache.
+// Routes verifying signatures check every request, on-demand mirrors need a fresh response
+// to compare, pinned reads must see the client's last write, and requests routed by header
+// or cookie get other responses than the route's usual ones, so they never use the cache.
+// Neither do routes requiring authentication or authorization: their responses may be
+// meant for one principal only, whatever credentials identified it, and the cache is keyed
+// by URI alone.
+func (c *Conductor) cacheableRoute(route string, r *http.Request) bool {
+	_, signed := c.signatures[route]
+	_, authenticated := c.auth[route]
+	_, authorized := c.currentAuthorizer(route)
+	return !signed && !authenticated && !authorized && onDemandOf(r) == nil && pinnedTo(r) == "" && !routedByRequestMatch(r) && cacheable(r)
+}
+
+// lookupCache returns the cached entry for a request and, if it can be served as is, the
+// lookup result: a hit when it is fresh, or stale when it may be served stale while
+// refreshed in the background. Other stale entries are returned without a result so the
+// request can revalidate them with their backend, or fall back to them if the backend fails.
+func (c *Conductor) lookupCache(route string, r *http.Request) (*cacheEntry, string) {
+	if c.cache == nil || !c.cacheableRoute(route, r) {
+		return nil, ""
+	}
+
+	entry := c.cache.Get(cacheKey(route, r), r)
+	if entry == nil {
+		return nil, ""
+	}
+	if mustRevalidate(r) {
+		return entry, ""
+	}
+
+	now := c.cache.now()
+	if entry.Fresh(now) {
+		c.recordCacheLookup(route, cacheHit)
+		return entry, cacheHit
+	}
+	if entry.StaleWhileRevalidate(now) {
+		c.recordCacheLookup(route, cacheStale)
+		c.refreshInBackground(r, entry)
+		return entry, cacheStale
+	}
+	return entry, ""
+}
+
+// refreshInBackground revalidates a stale entry with the service that produced it without
+// holding up the client, unless the entry is already being refreshed
+func (c *Conductor) refreshInBackground(r *http.Request, entry *cacheEntry) {
+	if !c.cache.startRefresh(entry.key) {
+		return
+	}
+
+	// The refresh must outlive the client request and only reaches the entry's service
+	ctx := context.WithValue(context.WithoutCancel(r.Context()), revalidationKey{}, entry)
+	req := r.Clone(ctx)
+	go func() {
+		defer c.cache.endRefresh(entry.key)
+		ctx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+
+		result := c.makeServiceRequest(ctx, entry.service, req, nil)
+		if result.err != nil {
+			logger.ForService(entry.service.Name).WarnWithFields("Background cache refresh failed", map[string]interface{}{
+				"route": entry.route,
+				"path":  req.URL.Path,
+				"error": result.err.Error(),
+			})
+			return
+		}
+		c.cacheResult(entry.route, req, entry, result)
+	}()
+}
+
+// cacheResult stores or refreshes the cache with a backend result and returns the result
+// to send to the client, which is the cached entry when a stale entry was confirmed
+// unchanged and a 304 when the client's own conditions match
+func (c *Conductor) cacheResult(route string, r *http.Request, stale *cacheEntry, result *serviceResult) *serviceResult {
+	if c.cache == nil {
+		return result
+	}
+
+	key := cacheKey(route, r)
+	switch {
+	case r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions:
+		// Unsafe methods may change the resource, so drop what is cached for it
+		if result.resp.StatusCode < 400 {
+			c.cache.Invalidate(key)
+		}
+		return result
+	case !c.cacheableRoute(route, r):
+		return result
+	case stale != nil && result.resp.StatusCode >= 500 && stale.StaleIfError(c.cache.now()):
+		return c.staleOnError(route, r, stale)
+	case stale != nil && result.service == stale.service && result.resp.StatusCode == http.StatusNotModified:
+		refreshed := c.cache.Refresh(stale, result.resp)
+		c.recordCacheLookup(route, cacheRevalidated)
+		logger.ForService(result.service.Name).DebugWithFields("Cached response revalidated", map[string]interface{}{
+			"route": route,
+			"path":  r.URL.Path,
+		})
+		result = refreshed.result(c.cache.now())
+		result.cache = cacheRevalidated
+	default:
+		c.cache.Store(route, key, r, result)
+		c.recordCacheLookup(route, cacheMiss)
+		// The result may be shared by coalesced requests, so it is copied rather than changed
+		missed := *result
+		missed.cache = cacheMiss
+		result = &missed
+	}
+
+	if result.resp.StatusCode == http.StatusOK && notModified(r, result.resp.Header) {
+		return notModifiedResult(result)
+	}
+	return result
+}
+
+// staleOnError returns a stale entry to serve in place of a failed backend response
+func (c *Conductor) staleOnError(route string, r *http.Request, stale *cacheEntry) *serviceResult {
+	c.recordCacheLookup(route, cacheStaleError)
+	logger.ForService(stale.service.Name).WarnWithFields("Backend failed, serving stale cached response", map[string]interface{}{
+		"route": route,
+		"path":  r.URL.Path,
+	})
+
+	result := stale.result(c.cache.now())
+	result.cache = cacheStaleError
+	if notModified(r, result.resp.Header) {
+		return notModifiedResult(result)
+	}
+	return result
+}
+
+// serveStaleOnError answers a request whose backends all failed from a stale cache entry,
+// reporting whether the entry could be used
+func (c *Conductor) serveStaleOnError(w http.ResponseWriter, r *http.Request, route string, stale *cacheEntry, requestStart time.Time, traceID string) bool {
+	if stale == nil || !stale.StaleIfError(c.cache.now()) {
+		return false
+	}
+	c.writeCached(w, r, route, c.staleOnError(route, r, stale), requestStart, traceID)
+	return true
+}
+
+// serveCached answers a request from a fresh cache entry, or a stale one being refreshed,
+// as the lookup found
+func (c *Conductor) serveCached(w http.ResponseWriter, r *http.Request, route string, entry *cacheEntry, lookup string, requestStart time.Time, traceID string) {
+	result := entry.result(c.cache.now())
+	result.cache = lookup
+	if notModified(r, result.resp.Header) {
+		result = notModifiedResult(result)
+	}
+	c.writeCached(w, r, route, result, requestStart, traceID)
+}
+
+// writeCached writes a result taken from the cache and records it like a proxied request
+func (c *Conductor) writeCached(w http.ResponseWriter, r *http.Request, route string, result *serviceResult, requestStart time.Time, traceID string) {
+	c.writeResponse(w, result, r, requestStart)
+
+	// Record cached request in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		status := strconv.Itoa(result.resp.StatusCode)
+		c.prometheusMetrics.RecordRequest(result.service.Name, route, r.Method, status, time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, false)
+	}
+	c.recordSLO(route, result.resp.StatusCode, time.Since(requestStart))
+}
+
+// recordCacheLookup reports the result of a response cache lookup
+func (c *Conductor) recordCacheLookup(route string, result string) {
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordCacheLookup(route, result)
+	}
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// cacheEntryInfo describes a cached response for the cache admin endpoints
+type cacheEntryInfo struct {
+	Key        string            `json:"key"`
+	Route      string            `json:"route"`
+	Service    string            `json:"service"`
+	Status     int               `json:"status"`
+	AgeSeconds int64             `json:"age_seconds"`
+	SizeBytes  int               `json:"size_bytes"`
+	Hits       int64             `json:"hits"`
+	Fresh      bool              `json:"fresh"`
+	Stored     time.Time         `json:"stored"`
+	Expires    time.Time         `json:"expires"`
+	Vary       map[string]string `json:"vary,omitempty"`
+	Header     http.Header       `json:"header,omitempty"` // Only reported when inspecting a single entry
+}
+
+// info describes the entry as of the given time
+func (e *cacheEntry) info(now time.Time) cacheEntryInfo {
+	return cacheEntryInfo{
+		Key:        e.key,
+		Route:      e.route,
+		Service:    e.service.Name,
+		Status:     e.status,
+		AgeSeconds: int64(now.Sub(e.stored).Seconds()),
+		SizeBytes:  len(e.body),
+		Hits:       e.hits.Load(),
+		Fresh:      e.Fresh(now),
+		Stored:     e.stored,
+		Expires:    e.expires,
+		Vary:       e.vary,
+	}
+}
+
+// Entries describes the cached entries of a route, or of every route if empty, by key
+func (rc *responseCache) Entries(route string) []cacheEntryInfo {
+	now := rc.now()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entries := make([]cacheEntryInfo, 0, len(rc.entries))
+	for _, entry := range rc.entries {
+		if route == "" || entry.route == route {
+			entries = append(entries, entry.info(now))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// Inspect describes the entry for a key with its response headers, reporting false if
+// nothing is cached for it
+func (rc *responseCache) Inspect(key string) (cacheEntryInfo, bool) {
+	now := rc.now()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok {
+		return cacheEntryInfo{}, false
+	}
+	info := entry.info(now)
+	info.Header = entry.header.Clone()
+	return info, true
+}
+
+// Purge removes the entry for a key, or else every entry of a route, or else every entry,
+// and returns how many were removed. Requests already holding a purged entry still
+// serve it, but no later request will.
+func (rc *responseCache) Purge(route string, key string) int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if key != "" {
+		if _, ok := rc.entries[key]; !ok {
+			return 0
+		}
+		rc.removeLocked(key)
+		return 1
+	}
+
+	purged := 0
+	for key, entry := range rc.entries {
+		if route == "" || entry.route == route {
+			rc.removeLocked(key)
+			purged++
+		}
+	}
+	return purged
+}
+
+// cacheKeysReport is the response body of the cache keys admin endpoint
+type cacheKeysReport struct {
+	Entries []cacheEntryInfo `json:"entries"`
+}
+
+// cachePurgeReport is the response body of the cache purge admin endpoint
+type cachePurgeReport struct {
+	Purged int `json:"purged"`
+}
+
+// CacheKeysHandler creates an admin handler listing the cached entries with their age,
+// size and hit count, limited to the route given in the "route" query parameter if any
+func CacheKeysHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+		if c.cache == nil {
+			http.Error(w, "Response cache not enabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		report := cacheKeysReport{Entries: c.cache.Entries(r.URL.Query().Get("route"))}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			http.Error(w, "Failed to encode cache keys: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// CacheEntryHandler creates an admin handler describing the cached entry for the key given
+// in the "key" query parameter, including its response headers
+func CacheEntryHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+		if c.cache == nil {
+			http.Error(w, "Response cache not enabled", http.StatusNotFound)
+			return
+		}
+
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "Missing key parameter", http.StatusBadRequest)
+			return
+		}
+		info, ok := c.cache.Inspect(key)
+		if !ok {
+			http.Error(w, "No cached entry for key "+key, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			http.Error(w, "Failed to encode cache entry: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// CachePurgeHandler creates an admin handler removing the cached entry for the key given in
+// the "key" query parameter, or else the entries of the route given in the "route" query
+// parameter, or else the whole cache
+func CachePurgeHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodDelete) {
+			return
+		}
+		if c.cache == nil {
+			http.Error(w, "Response cache not enabled", http.StatusNotFound)
+			return
+		}
+
+		route, key := r.URL.Query().Get("route"), r.URL.Query().Get("key")
+		purged := c.cache.Purge(route, key)
+		logger.InfoWithFields("Purged response cache", map[string]interface{}{
+			"route":       route,
+			"key":         key,
+			"purged":      purged,
+			"remote_addr": r.RemoteAddr,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cachePurgeReport{Purged: purged}); err != nil {
+			http.Error(w, "Failed to encode purge report: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
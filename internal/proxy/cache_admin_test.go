@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestCacheAdminEndpoints tests listing, inspecting and purging cached entries
+func TestCacheAdminEndpoints(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "web", URL: "http://web.example.com", PathPrefix: "/web", Primary: true},
+		},
+		Cache: config.CacheConfig{Enabled: true, MaxEntries: 10, MaxBodyBytes: 1024},
+		Admin: config.AdminConfig{Enabled: true, Endpoint: "/admin", Token: "secret"},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: &originTransport{version: "v1", cacheControl: "max-age=60"}}
+	mux := http.NewServeMux()
+	SetupAdminEndpoints(mux, conductor)
+
+	for _, path := range []string{"/api/a", "/api/a", "/api/a", "/api/b", "/web/a"} {
+		conductor.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com"+path, nil))
+	}
+	admin := func(method string, target string, body interface{}) int {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, adminRequest(method, target))
+		if body != nil && recorder.Code == http.StatusOK {
+			if err := json.Unmarshal(recorder.Body.Bytes(), body); err != nil {
+				t.Fatalf("Invalid response from %s: %v", target, err)
+			}
+		}
+		return recorder.Code
+	}
+
+	var keys cacheKeysReport
+	if code := admin(http.MethodGet, "/admin/cache/keys?route=/api", &keys); code != http.StatusOK {
+		t.Fatalf("Expected status 200 listing keys, got %d", code)
+	}
+	if len(keys.Entries) != 2 || keys.Entries[0].Key != "/api /api/a" || keys.Entries[1].Key != "/api /api/b" {
+		t.Fatalf("Expected the two /api entries, got %+v", keys.Entries)
+	}
+	if entry := keys.Entries[0]; entry.Hits != 2 || entry.SizeBytes != len("body v1") || !entry.Fresh || entry.Service != "api" {
+		t.Errorf("Expected a fresh api entry of 7 bytes hit twice, got %+v", entry)
+	}
+
+	var entry cacheEntryInfo
+	if code := admin(http.MethodGet, "/admin/cache/entry?key="+url.QueryEscape("/api /api/a"), &entry); code != http.StatusOK {
+		t.Fatalf("Expected status 200 inspecting an entry, got %d", code)
+	}
+	if entry.Header.Get("ETag") != `"v1"` {
+		t.Errorf("Expected the entry's headers, got %v", entry.Header)
+	}
+	if code := admin(http.MethodGet, "/admin/cache/entry?key=unknown", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown key, got %d", code)
+	}
+
+	var purge cachePurgeReport
+	if code := admin(http.MethodGet, "/admin/cache?route=/api", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 purging with GET, got %d", code)
+	}
+	if admin(http.MethodDelete, "/admin/cache?key="+url.QueryEscape("/api /api/b"), &purge); purge.Purged != 1 {
+		t.Errorf("Expected one entry purged by key, got %d", purge.Purged)
+	}
+	if admin(http.MethodDelete, "/admin/cache?route=/api", &purge); purge.Purged != 1 {
+		t.Errorf("Expected one entry purged by route, got %d", purge.Purged)
+	}
+	if admin(http.MethodGet, "/admin/cache/keys", &keys); len(keys.Entries) != 1 || keys.Entries[0].Route != "/web" {
+		t.Errorf("Expected only the /web entry left, got %+v", keys.Entries)
+	}
+	if admin(http.MethodDelete, "/admin/cache", &purge); purge.Purged != 1 {
+		t.Errorf("Expected the remaining entry purged, got %d", purge.Purged)
+	}
+}
@@ -0,0 +1,357 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// originTransport serves a versioned resource with an ETag and answers matching
+// conditional requests with 304
+type originTransport struct {
+	mu           sync.Mutex
+	version      string
+	cacheControl string
+	failing      bool // Answer every request with 503
+	noValidators bool // Answer without an ETag
+	requests     []*http.Request
+}
+
+func (o *originTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.requests = append(o.requests, req)
+	if o.failing {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("down"))}, nil
+	}
+
+	header := http.Header{}
+	if !o.noValidators {
+		header.Set("ETag", `"`+o.version+`"`)
+	}
+	header.Set("Cache-Control", o.cacheControl)
+	if req.Header.Get("If-None-Match") == `"`+o.version+`"` {
+		return &http.Response{StatusCode: http.StatusNotModified, Header: header, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader("body " + o.version))}, nil
+}
+
+// TestResponseCache tests serving fresh entries, revalidating stale ones and answering
+// conditional client requests
+func TestResponseCache(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+		Cache: config.CacheConfig{Enabled: true, MaxEntries: 10, MaxBodyBytes: 1024},
+	}
+	conductor := NewConductor(cfg)
+	origin := &originTransport{version: "v1", cacheControl: "max-age=60"}
+	conductor.client = &http.Client{Transport: origin}
+	now := time.Now()
+	conductor.cache.now = func() time.Time { return now }
+
+	get := func(method string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://example.com/api/items?page=1", nil)
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		header       map[string]string
+		advance      time.Duration
+		version      string
+		wantStatus   int
+		wantBody     string
+		wantUpstream int    // Total backend requests so far
+		wantCondHdr  string // If-None-Match sent on the latest backend request
+	}{
+		{name: "miss", method: "GET", wantStatus: 200, wantBody: "body v1", wantUpstream: 1},
+		{name: "fresh hit", method: "GET", advance: 30 * time.Second, wantStatus: 200, wantBody: "body v1", wantUpstream: 1},
+		{name: "client conditional from cache", method: "GET", header: map[string]string{"If-None-Match": `"v1"`}, wantStatus: 304, wantUpstream: 1},
+		{name: "client forces revalidation", method: "GET", header: map[string]string{"Cache-Control": "no-cache"}, wantStatus: 200, wantBody: "body v1", wantUpstream: 2, wantCondHdr: `"v1"`},
+		{name: "stale revalidated", method: "GET", advance: 61 * time.Second, wantStatus: 200, wantBody: "body v1", wantUpstream: 3, wantCondHdr: `"v1"`},
+		{name: "stale changed", method: "GET", advance: 61 * time.Second, version: "v2", wantStatus: 200, wantBody: "body v2", wantUpstream: 4, wantCondHdr: `"v1"`},
+		{name: "fresh after change", method: "GET", wantStatus: 200, wantBody: "body v2", wantUpstream: 4},
+		{name: "unsafe method invalidates", method: "POST", wantStatus: 200, wantBody: "body v2", wantUpstream: 5},
+		{name: "miss after invalidation", method: "GET", wantStatus: 200, wantBody: "body v2", wantUpstream: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			if tt.version != "" {
+				origin.mu.Lock()
+				origin.version = tt.version
+				origin.mu.Unlock()
+			}
+
+			recorder := get(tt.method, tt.header)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if recorder.Body.String() != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, recorder.Body.String())
+			}
+
+			origin.mu.Lock()
+			defer origin.mu.Unlock()
+			if len(origin.requests) != tt.wantUpstream {
+				t.Fatalf("Expected %d backend requests, got %d", tt.wantUpstream, len(origin.requests))
+			}
+			if got := origin.requests[len(origin.requests)-1].Header.Get("If-None-Match"); tt.wantCondHdr != "" && got != tt.wantCondHdr {
+				t.Errorf("Expected backend If-None-Match %q, got %q", tt.wantCondHdr, got)
+			}
+		})
+	}
+}
+
+// TestResponseCacheRevalidationComparison tests that stale entries without validators are
+// fetched in full and compared with shadows, while entries with an ETag are revalidated
+// without comparison
+func TestResponseCacheRevalidationComparison(t *testing.T) {
+	for _, noValidators := range []bool{false, true} {
+		cfg := &config.Config{
+			Timeout: 5,
+			Services: []config.Service{
+				{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+				{Name: "api-shadow", URL: "http://api-shadow.example.com", PathPrefix: "/api"},
+			},
+			Cache: config.CacheConfig{Enabled: true, MaxEntries: 10, MaxBodyBytes: 1024},
+		}
+		conductor := NewConductor(cfg)
+		conductor.client = &http.Client{Transport: &originTransport{version: "v1", cacheControl: "max-age=60", noValidators: noValidators}}
+		now := time.Now()
+		conductor.cache.now = func() time.Time { return now }
+		compared := make(chan string, 10)
+		conductor.comparison = newComparisonPipeline(1, 10, &comparisonRules{}, nil, nil, func(route string, service string, outcome string, differences []string) {
+			compared <- service
+		})
+
+		// The first request always compares, the stale one only without validators
+		for i, wantCompared := range []bool{true, noValidators} {
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/items", nil))
+			if recorder.Code != http.StatusOK || recorder.Body.String() != "body v1" {
+				t.Fatalf("Expected the cached resource, got %d %q", recorder.Code, recorder.Body.String())
+			}
+			select {
+			case <-compared:
+				if !wantCompared {
+					t.Errorf("Expected request %d with validators not to be compared", i)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if wantCompared {
+					t.Errorf("Expected request %d without validators=%v to be compared", i, noValidators)
+				}
+			}
+			now = now.Add(61 * time.Second)
+		}
+		conductor.comparison.Close()
+	}
+}
+
+// principalTransport answers with the API key of the request and a public max-age, as a
+// backend leaving out Cache-Control: private would
+type principalTransport struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (p *principalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests++
+	header := http.Header{"Cache-Control": {"max-age=60"}}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader("account of " + req.Header.Get("X-API-Key")))}, nil
+}
+
+// TestResponseCachePrincipals tests that routes requiring authentication or authorization
+// never share cached responses between principals
+func TestResponseCachePrincipals(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "accounts", URL: "http://accounts.example.com", PathPrefix: "/accounts", Primary: true},
+			{Name: "reports", URL: "http://reports.example.com", PathPrefix: "/reports", Primary: true},
+			{Name: "public", URL: "http://public.example.com", PathPrefix: "/public", Primary: true},
+		},
+		Auth: config.AuthConfig{
+			Methods: map[string]config.AuthMethodConfig{"key": {Type: "apiKey", Keys: []string{"k1", "k2"}}},
+			Routes:  []config.RouteAuth{{Route: "/accounts", Require: "key"}},
+		},
+		Authz: []config.RouteAuthz{{Route: "/reports", Type: "static", Default: "allow"}},
+		Cache: config.CacheConfig{Enabled: true, MaxEntries: 10, MaxBodyBytes: 1024},
+	}
+
+	tests := []struct {
+		path         string
+		wantUpstream int
+	}{
+		{path: "/accounts/me", wantUpstream: 2},
+		{path: "/reports/me", wantUpstream: 2},
+		{path: "/public/me", wantUpstream: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			conductor := NewConductor(cfg)
+			backend := &principalTransport{}
+			conductor.client = &http.Client{Transport: backend}
+
+			for _, key := range []string{"k1", "k2"} {
+				req := httptest.NewRequest("GET", "http://example.com"+tt.path, nil)
+				req.Header.Set("X-API-Key", key)
+				recorder := httptest.NewRecorder()
+				conductor.ServeHTTP(recorder, req)
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("Expected 200 for %s, got %d", key, recorder.Code)
+				}
+				if tt.wantUpstream > 1 && recorder.Body.String() != "account of "+key {
+					t.Errorf("Expected the response for %s, got %q", key, recorder.Body.String())
+				}
+			}
+			if backend.requests != tt.wantUpstream {
+				t.Errorf("Expected %d backend requests, got %d", tt.wantUpstream, backend.requests)
+			}
+		})
+	}
+}
+
+// TestResponseCacheStale tests serving stale entries while they are refreshed in the
+// background and in place of backend failures
+func TestResponseCacheStale(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+		Cache: config.CacheConfig{
+			Enabled:      true,
+			MaxEntries:   10,
+			MaxBodyBytes: 1024,
+			Routes:       []config.CacheRoute{{Route: "/api", StaleWhileRevalidate: 30}},
+		},
+	}
+	conductor := NewConductor(cfg)
+	origin := &originTransport{version: "v1", cacheControl: "max-age=60, stale-if-error=120"}
+	conductor.client = &http.Client{Transport: origin}
+	var clock sync.Mutex
+	now := time.Now()
+	conductor.cache.now = func() time.Time {
+		clock.Lock()
+		defer clock.Unlock()
+		return now
+	}
+
+	// waitForRefresh waits until no background refresh is in flight
+	waitForRefresh := func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			conductor.cache.mu.Lock()
+			pending := len(conductor.cache.refreshing)
+			conductor.cache.mu.Unlock()
+			if pending == 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatal("Background refresh did not finish")
+	}
+
+	tests := []struct {
+		name         string
+		advance      time.Duration
+		version      string
+		failing      bool
+		wantStatus   int
+		wantBody     string
+		wantUpstream int // Total backend requests so far, including background refreshes
+	}{
+		{name: "miss", wantStatus: 200, wantBody: "body v1", wantUpstream: 1},
+		{name: "stale while revalidating", advance: 70 * time.Second, version: "v2", wantStatus: 200, wantBody: "body v1", wantUpstream: 2},
+		{name: "refreshed in background", wantStatus: 200, wantBody: "body v2", wantUpstream: 2},
+		{name: "stale if error", advance: 100 * time.Second, failing: true, wantStatus: 200, wantBody: "body v2", wantUpstream: 3},
+		{name: "error beyond stale window", advance: 100 * time.Second, failing: true, wantStatus: 503, wantBody: "down", wantUpstream: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Lock()
+			now = now.Add(tt.advance)
+			clock.Unlock()
+			origin.mu.Lock()
+			if tt.version != "" {
+				origin.version = tt.version
+			}
+			origin.failing = tt.failing
+			origin.mu.Unlock()
+
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/items", nil))
+			waitForRefresh()
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if recorder.Body.String() != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, recorder.Body.String())
+			}
+			origin.mu.Lock()
+			defer origin.mu.Unlock()
+			if len(origin.requests) != tt.wantUpstream {
+				t.Errorf("Expected %d backend requests, got %d", tt.wantUpstream, len(origin.requests))
+			}
+		})
+	}
+}
+
+// TestResponseCacheStore tests which responses a shared cache may store
+func TestResponseCacheStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		header    map[string]string
+		wantStore bool
+	}{
+		{name: "max-age", status: 200, header: map[string]string{"Cache-Control": "max-age=60"}, wantStore: true},
+		{name: "validator only", status: 200, header: map[string]string{"ETag": `"a"`}, wantStore: true},
+		{name: "no freshness or validator", status: 200, wantStore: false},
+		{name: "no-store", status: 200, header: map[string]string{"Cache-Control": "no-store", "ETag": `"a"`}, wantStore: false},
+		{name: "private", status: 200, header: map[string]string{"Cache-Control": "private, max-age=60"}, wantStore: false},
+		{name: "set-cookie", status: 200, header: map[string]string{"Cache-Control": "max-age=60", "Set-Cookie": "a=b"}, wantStore: false},
+		{name: "vary star", status: 200, header: map[string]string{"Cache-Control": "max-age=60", "Vary": "*"}, wantStore: false},
+		{name: "stale-if-error only", status: 200, header: map[string]string{"Cache-Control": "max-age=0, stale-if-error=60"}, wantStore: true},
+		{name: "error status", status: 500, header: map[string]string{"Cache-Control": "max-age=60"}, wantStore: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newResponseCache(config.CacheConfig{MaxEntries: 10, MaxBodyBytes: 1024})
+			header := http.Header{}
+			for name, value := range tt.header {
+				header.Set(name, value)
+			}
+			req := httptest.NewRequest("GET", "http://example.com/a", nil)
+			result := &serviceResult{service: &Service{Name: "api"}, resp: &http.Response{StatusCode: tt.status, Header: header}, body: []byte("ok")}
+
+			cache.Store("/api", "key", req, result)
+			if stored := cache.Get("key", req) != nil; stored != tt.wantStore {
+				t.Errorf("Expected stored=%v, got %v", tt.wantStore, stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+	"github.com/zeek-r/go-conductor/internal/version"
+)
+
+// Capture formats
+const (
+	captureHAR = "har" // HTTP Archive 1.2 documents, importable into browsers, Postman and mitmproxy
+	captureRaw = "raw" // HTTP/1.1 messages as sent on the wire, each exchange preceded by a comment line
+)
+
+// captureExchange is a shadow or mirror request and the response it got
+type captureExchange struct {
+	started    time.Time
+	duration   time.Duration
+	route      string
+	service    string
+	role       string
+	method     string
+	url        string
+	host       string
+	reqHeader  http.Header
+	reqBody    []byte
+	reqSize    int64
+	status     int
+	proto      string
+	respHeader http.Header
+	respBody   []byte
+	respSize   int64 // Size of the response body, -1 if it was streamed and not kept
+	err        string
+}
+
+// captureSink exports mirrored exchanges in batches from a background worker. Exchanges are
+// queued without blocking and dropped when the queue is full, so capturing never holds up
+// requests.
+type captureSink struct {
+	mu       sync.RWMutex
+	closed   bool
+	cfg      config.CaptureConfig
+	routes   map[string]bool // Captured routes, nil for all
+	queue    chan *captureExchange
+	client   *http.Client
+	sequence int // Files written, so names stay unique within a clock tick
+	dropped  atomic.Int64
+	done     chan struct{}
+}
+
+// newCaptureSink creates the capture directory if one is configured and starts the worker
+func newCaptureSink(cfg config.CaptureConfig) (*captureSink, error) {
+	if cfg.Directory != "" {
+		if err := os.MkdirAll(cfg.Directory, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &captureSink{
+		cfg:    cfg,
+		queue:  make(chan *captureExchange, cfg.QueueSize),
+		client: &http.Client{Timeout: 10 * time.Second},
+		done:   make(chan struct{}),
+	}
+	if len(cfg.Routes) > 0 {
+		s.routes = make(map[string]bool, len(cfg.Routes))
+		for _, route := range cfg.Routes {
+			s.routes[route] = true
+		}
+	}
+	go s.run()
+	return s, nil
+}
+
+// Captures reports whether exchanges of the route are captured
+func (s *captureSink) Captures(route string) bool {
+	return s.routes == nil || s.routes[route]
+}
+
+// Submit queues an exchange, dropping it if the queue is full or the sink closed
+func (s *captureSink) Submit(exchange *captureExchange) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.queue <- exchange:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Close stops accepting exchanges and waits for the queued ones to be exported
+func (s *captureSink) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// run exports a batch whenever it is full or the flush interval passed, until closed
+func (s *captureSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(time.Duration(s.cfg.FlushInterval) * time.Second)
+	defer ticker.Stop()
+
+	var batch []*captureExchange
+	for {
+		select {
+		case exchange, ok := <-s.queue:
+			if !ok {
+				s.export(batch)
+				return
+			}
+			batch = append(batch, exchange)
+			if len(batch) >= s.cfg.BatchSize {
+				s.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			s.export(batch)
+			batch = nil
+		}
+	}
+}
+
+// export writes a batch to the directory and posts it to the sink, as configured
+func (s *captureSink) export(batch []*captureExchange) {
+	if len(batch) == 0 {
+		return
+	}
+	if dropped := s.dropped.Swap(0); dropped > 0 {
+		logger.WarnWithFields("Capture queue full, dropped mirrored exchanges", map[string]interface{}{
+			"dropped": dropped,
+		})
+	}
+
+	data, contentType, extension := encodeHAR(batch), "application/json", "har"
+	if s.cfg.Format == captureRaw {
+		data, contentType, extension = encodeRaw(batch), "text/plain; charset=utf-8", "http"
+	}
+
+	if s.cfg.Directory != "" {
+		if err := s.writeFile(data, extension); err != nil {
+			logger.ErrorWithFields("Failed to write capture file", err, map[string]interface{}{
+				"directory": s.cfg.Directory,
+				"exchanges": len(batch),
+			})
+		}
+	}
+	if s.cfg.URL != "" {
+		if err := s.post(data, contentType); err != nil {
+			logger.ErrorWithFields("Failed to post capture batch", err, map[string]interface{}{
+				"url":       s.cfg.URL,
+				"exchanges": len(batch),
+			})
+		}
+	}
+}
+
+// writeFile writes a batch to a new file, renaming it into place once complete so
+// collectors never read a partial file
+func (s *captureSink) writeFile(data []byte, extension string) error {
+	s.sequence++
+	name := fmt.Sprintf("capture-%s-%d.%s", time.Now().UTC().Format("20060102T150405.000Z"), s.sequence, extension)
+	path := filepath.Join(s.cfg.Directory, name)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// post sends a batch to the HTTP sink
+func (s *captureSink) post(data []byte, contentType string) error {
+	resp, err := s.client.Post(s.cfg.URL, contentType, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("capture sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// captureMirror queues a shadow or mirror request and the response it got for export.
+// Bodies are kept up to the configured size. Sensitive headers are redacted as in logs,
+// along with the headers carrying the service's configured values and credentials and
+// the clients' API keys, and query values are masked.
+func (c *Conductor) captureMirror(svc *Service, req *http.Request, requestBody *requestBody, result *serviceResult, started time.Time) {
+	if c.capture == nil || svc.Primary || !c.capture.Captures(svc.Route) {
+		return
+	}
+
+	limit := int64(c.capture.cfg.MaxBodyBytes)
+	reqBody, _ := io.ReadAll(io.LimitReader(requestBody.Reader(), limit))
+	exchange := &captureExchange{
+		started:   started,
+		duration:  result.duration,
+		route:     svc.Route,
+		service:   svc.Name,
+		role:      serviceRole(svc),
+		method:    req.Method,
+		url:       redactQuery(req.URL),
+		host:      req.Host,
+		reqHeader: logger.RedactHeaders(req.Header, c.secretHeaders(svc)...),
+		reqBody:   reqBody,
+		reqSize:   requestBody.Len(),
+		respSize:  -1,
+	}
+	if exchange.host == "" {
+		exchange.host = req.URL.Host
+	}
+	if result.err != nil {
+		exchange.err = result.err.Error()
+	}
+	if result.resp != nil {
+		exchange.status = result.resp.StatusCode
+		exchange.proto = fmt.Sprintf("HTTP/%d.%d", result.resp.ProtoMajor, result.resp.ProtoMinor)
+		exchange.respHeader = logger.RedactHeaders(result.resp.Header)
+		if result.stream == nil {
+			exchange.respSize = int64(len(result.body))
+			exchange.respBody = bytes.Clone(result.body[:min(int64(len(result.body)), limit)])
+		}
+	}
+	c.capture.Submit(exchange)
+}
+
+// secretHeaders lists the request headers that may carry secrets of a service request
+// besides the ones redacted in logs: the service's configured headers, the header of its
+// credentials and the headers clients send API keys in
+func (c *Conductor) secretHeaders(svc *Service) []string {
+	names := make([]string, 0, len(svc.Config.Headers)+1)
+	for name := range svc.Config.Headers {
+		names = append(names, name)
+	}
+	if creds := svc.Config.Credentials; creds != nil && creds.Header != "" {
+		names = append(names, creds.Header)
+	}
+	for _, method := range c.config.Auth.Methods {
+		if method.Type == "apiKey" {
+			names = append(names, cmp.Or(method.Header, "X-API-Key"))
+		}
+	}
+	return names
+}
+
+// redactQuery returns the URL with the value of every query parameter masked, keeping
+// the parameter names
+func redactQuery(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	masked := *u
+	pairs := strings.Split(u.RawQuery, "&")
+	for i, pair := range pairs {
+		if name, _, ok := strings.Cut(pair, "="); ok {
+			pairs[i] = name + "=REDACTED"
+		}
+	}
+	masked.RawQuery = strings.Join(pairs, "&")
+	return masked.String()
+}
+
+// harDocument is an HTTP Archive 1.2 document
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// harEntry is an exchange, with the route, service and role it was captured for
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Route           string      `json:"_route"`
+	Service         string      `json:"_service"`
+	Role            string      `json:"_role"`
+	Error           string      `json:"_error,omitempty"` // Why no response was received
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"` // base64 for bodies that are not UTF-8 text
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// encodeHAR encodes a batch as a HAR document
+func encodeHAR(batch []*captureExchange) []byte {
+	doc := harDocument{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "go-conductor", Version: version.Version},
+		Entries: make([]harEntry, 0, len(batch)),
+	}}
+	for _, e := range batch {
+		ms := float64(e.duration.Microseconds()) / 1000
+		entry := harEntry{
+			StartedDateTime: e.started.Format(time.RFC3339Nano),
+			Time:            ms,
+			Request: harRequest{
+				Method:      e.method,
+				URL:         e.url,
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harNameValue{},
+				Headers:     harHeaders(e.reqHeader),
+				QueryString: []harNameValue{},
+				HeadersSize: -1,
+				BodySize:    e.reqSize,
+			},
+			Response: harResponse{
+				Status:      e.status,
+				StatusText:  http.StatusText(e.status),
+				HTTPVersion: e.proto,
+				Cookies:     []harNameValue{},
+				Headers:     harHeaders(e.respHeader),
+				Content:     harContent{Size: e.respSize, MimeType: e.respHeader.Get("Content-Type")},
+				HeadersSize: -1,
+				BodySize:    e.respSize,
+			},
+			Timings: harTimings{Wait: ms},
+			Route:   e.route,
+			Service: e.service,
+			Role:    e.role,
+			Error:   e.err,
+		}
+		if query := strings.SplitN(e.url, "?", 2); len(query) == 2 {
+			for _, pair := range strings.Split(query[1], "&") {
+				name, value, _ := strings.Cut(pair, "=")
+				entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: value})
+			}
+		}
+		if e.reqSize > 0 {
+			text, encoding := harText(e.reqBody)
+			entry.Request.PostData = &harPostData{MimeType: e.reqHeader.Get("Content-Type"), Text: text, Encoding: encoding,
+				Comment: truncationComment(e.reqSize, len(e.reqBody))}
+		}
+		if e.respSize > 0 {
+			entry.Response.Content.Text, entry.Response.Content.Encoding = harText(e.respBody)
+			entry.Response.Content.Comment = truncationComment(e.respSize, len(e.respBody))
+		} else if e.respSize < 0 {
+			entry.Response.Content.Comment = "streamed body not captured"
+		}
+		doc.Log.Entries = append(doc.Log.Entries, entry)
+	}
+
+	data, _ := json.MarshalIndent(doc, "", "  ")
+	return data
+}
+
+// harHeaders lists headers as HAR name and value pairs
+func harHeaders(header http.Header) []harNameValue {
+	pairs := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			pairs = append(pairs, harNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// harText returns a body as text, base64 encoded if it is not UTF-8
+func harText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// truncationComment notes a body kept only in part, empty if it was kept whole
+func truncationComment(size int64, kept int) string {
+	if int64(kept) >= size {
+		return ""
+	}
+	return fmt.Sprintf("truncated to %d of %d bytes", kept, size)
+}
+
+// encodeRaw encodes a batch as HTTP/1.1 messages, each exchange preceded by a comment line
+// describing it
+func encodeRaw(batch []*captureExchange) []byte {
+	var buf bytes.Buffer
+	for _, e := range batch {
+		fmt.Fprintf(&buf, "# %s route=%s service=%s role=%s duration_ms=%d\r\n",
+			e.started.Format(time.RFC3339Nano), e.route, e.service, e.role, e.duration.Milliseconds())
+
+		requestURI := e.url
+		if i := strings.Index(requestURI, "://"); i >= 0 {
+			requestURI = requestURI[i+3:]
+			if j := strings.IndexByte(requestURI, '/'); j >= 0 {
+				requestURI = requestURI[j:]
+			} else {
+				requestURI = "/"
+			}
+		}
+		fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\nHost: %s\r\n", e.method, requestURI, e.host)
+		e.reqHeader.Write(&buf)
+		buf.WriteString("\r\n")
+		buf.Write(e.reqBody)
+		buf.WriteString("\r\n")
+
+		if e.err != "" {
+			fmt.Fprintf(&buf, "# error: %s\r\n\r\n", e.err)
+			continue
+		}
+		fmt.Fprintf(&buf, "%s %d %s\r\n", e.proto, e.status, http.StatusText(e.status))
+		e.respHeader.Write(&buf)
+		buf.WriteString("\r\n")
+		buf.Write(e.respBody)
+		buf.WriteString("\r\n\r\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestCapture tests that mirror requests and their responses are exported as HAR files to a
+// directory and as raw HTTP messages to a sink, without the primary's exchanges
+func TestCapture(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"echo":"` + string(body) + `"}`))
+	}))
+	defer shadow.Close()
+
+	var mu sync.Mutex
+	var posted []string
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		posted = append(posted, r.Header.Get("Content-Type")+"\n"+string(body))
+		mu.Unlock()
+	}))
+	defer sink.Close()
+
+	// send requests both routes, waiting for the wanted number of batches as mirrors answer
+	// in the background
+	send := func(capture config.CaptureConfig, batches func() int, want int) {
+		cfg := &config.Config{
+			Timeout: 5,
+			Services: []config.Service{
+				{Name: "api", URL: primary.URL, PathPrefix: "/api", Primary: true},
+				{Name: "api-v2", URL: shadow.URL, PathPrefix: "/api", Mirror: true, MirrorUnsafeMethods: true,
+					Headers: map[string]string{"X-Service-Secret": "service-secret"}},
+				{Name: "web", URL: primary.URL, PathPrefix: "/", Primary: true},
+				{Name: "web-v2", URL: shadow.URL, PathPrefix: "/", Mirror: true, MirrorUnsafeMethods: true},
+			},
+			Auth: config.AuthConfig{
+				Methods: map[string]config.AuthMethodConfig{"keys": {Type: "apiKey", Keys: []string{"client-key"}}},
+			},
+			Capture: capture,
+		}
+		conductor := NewConductor(cfg)
+		defer conductor.Close()
+
+		for _, target := range []string{"/api/users?page=2", "/home"} {
+			req := httptest.NewRequest("POST", target, strings.NewReader("hello"))
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("X-API-Key", "client-key")
+			conductor.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		for deadline := time.Now().Add(2 * time.Second); batches() < want && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("HAR files", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "captures")
+		written := func() int {
+			files, _ := filepath.Glob(filepath.Join(dir, "capture-*.har"))
+			return len(files)
+		}
+		send(config.CaptureConfig{Enabled: true, Format: captureHAR, Directory: dir, Routes: []string{"/api"},
+			MaxBodyBytes: 1024, BatchSize: 1, FlushInterval: 60, QueueSize: 10}, written, 1)
+
+		files, _ := filepath.Glob(filepath.Join(dir, "capture-*.har"))
+		if len(files) != 1 {
+			t.Fatalf("Expected one HAR file for the captured route, got %v", files)
+		}
+		data, _ := os.ReadFile(files[0])
+		var doc harDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("Failed to decode HAR: %v", err)
+		}
+		if doc.Log.Version != "1.2" || len(doc.Log.Entries) != 1 {
+			t.Fatalf("Expected one entry for the captured route, got %s", data)
+		}
+		entry := doc.Log.Entries[0]
+		if entry.Service != "api-v2" || entry.Role != roleMirror || entry.Request.Method != "POST" ||
+			!strings.HasPrefix(entry.Request.URL, shadow.URL+"/users") {
+			t.Errorf("Expected the shadow request, got %+v", entry)
+		}
+		if entry.Request.PostData == nil || entry.Request.PostData.Text != "hello" ||
+			len(entry.Request.QueryString) != 1 || entry.Request.QueryString[0] != (harNameValue{Name: "page", Value: "REDACTED"}) {
+			t.Errorf("Expected the request body and masked query, got %+v", entry.Request)
+		}
+		for _, header := range entry.Request.Headers {
+			if strings.Contains(header.Value, "secret") || strings.Contains(header.Value, "client-key") {
+				t.Errorf("Expected the %s header redacted, got %q", header.Name, header.Value)
+			}
+		}
+		if info, err := os.Stat(files[0]); err != nil {
+			t.Errorf("Failed to stat capture file: %v", err)
+		} else if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected the capture file readable by its owner only, got %v", info.Mode().Perm())
+		}
+		if entry.Response.Status != 200 || entry.Response.Content.Text != `{"echo":"hello"}` ||
+			entry.Response.Content.MimeType != "application/json" {
+			t.Errorf("Expected the shadow response, got %+v", entry.Response)
+		}
+	})
+
+	t.Run("raw HTTP sink", func(t *testing.T) {
+		received := func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(posted)
+		}
+		send(config.CaptureConfig{Enabled: true, Format: captureRaw, URL: sink.URL,
+			MaxBodyBytes: 3, BatchSize: 1, FlushInterval: 60, QueueSize: 10}, received, 2)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(posted) != 2 {
+			t.Fatalf("Expected a batch posted per mirror request, got %d", len(posted))
+		}
+		for _, batch := range posted {
+			if !strings.HasPrefix(batch, "text/plain") || !strings.Contains(batch, "role=mirror") ||
+				!strings.Contains(batch, "\r\n\r\nhel\r\n") || !strings.Contains(batch, "HTTP/1.1 200 OK\r\n") {
+				t.Errorf("Expected a truncated raw exchange, got %q", batch)
+			}
+		}
+		if !strings.Contains(posted[0]+posted[1], "POST /users?page=REDACTED HTTP/1.1\r\n") {
+			t.Errorf("Expected the request line of the API mirror, got %q", posted)
+		}
+	})
+}
+
+// TestCaptureQueueFull tests that exchanges are dropped rather than blocking once the
+// queue is full
+func TestCaptureQueueFull(t *testing.T) {
+	capture := &captureSink{queue: make(chan *captureExchange, 1)}
+	done := make(chan struct{})
+	go func() {
+		capture.Submit(&captureExchange{})
+		capture.Submit(&captureExchange{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Submit not to block on a full queue")
+	}
+	if capture.dropped.Load() != 1 {
+		t.Errorf("Expected one exchange dropped, got %d", capture.dropped.Load())
+	}
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// otherLabelValue replaces label values beyond a label's cardinality limit
+const otherLabelValue = "other"
+
+// defaultMaxLabelValues bounds the distinct values of each metric label when not configured
+const defaultMaxLabelValues = 100
+
+// labelGuard bounds the number of distinct values a metric label can take. Known values
+// are always accepted, others are accepted until the limit is reached and then
+// collapsed into "other".
+type labelGuard struct {
+	mu    sync.Mutex
+	known map[string]bool
+	seen  map[string]bool
+	limit int
+}
+
+// newLabelGuard creates a guard accepting up to limit values besides the known ones
+func newLabelGuard(limit int, known ...string) *labelGuard {
+	g := &labelGuard{
+		known: make(map[string]bool),
+		seen:  make(map[string]bool),
+		limit: limit,
+	}
+	g.Allow(known...)
+	return g
+}
+
+// Allow marks values as known, so they never count against the limit
+func (g *labelGuard) Allow(values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, v := range values {
+		g.known[v] = true
+	}
+}
+
+// Value returns v if it may be used as a label value, otherwise "other"
+func (g *labelGuard) Value(v string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.known[v] || g.seen[v] {
+		return v
+	}
+	if len(g.seen) >= g.limit {
+		return otherLabelValue
+	}
+	g.seen[v] = true
+	return v
+}
+
+// methodLabel returns the method for use as a label, collapsing non-standard methods
+// that a client could otherwise invent without bound
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return otherLabelValue
+	}
+}
+
+// statusLabel returns the status for use as a label, collapsing anything outside the
+// range of valid HTTP status codes
+func statusLabel(status string) string {
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 100 || code > 599 {
+		return otherLabelValue
+	}
+	return status
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestLabelGuard tests that unknown label values are collapsed beyond the limit
+func TestLabelGuard(t *testing.T) {
+	guard := newLabelGuard(2, "known-service")
+
+	for i := 0; i < 5; i++ {
+		if got := guard.Value("known-service"); got != "known-service" {
+			t.Errorf("Expected known value to be kept, got %s", got)
+		}
+	}
+
+	expected := []string{"probe-0", "probe-1", otherLabelValue, otherLabelValue}
+	for i, want := range expected {
+		if got := guard.Value(fmt.Sprintf("probe-%d", i)); got != want {
+			t.Errorf("Expected %s for probe-%d, got %s", want, i, got)
+		}
+	}
+
+	// Values admitted before the limit was hit stay stable
+	if got := guard.Value("probe-1"); got != "probe-1" {
+		t.Errorf("Expected admitted value to be kept, got %s", got)
+	}
+}
+
+// TestMethodAndStatusLabels tests normalization of client-controlled label values
+func TestMethodAndStatusLabels(t *testing.T) {
+	tests := []struct {
+		value    string
+		label    func(string) string
+		expected string
+	}{
+		{"GET", methodLabel, "GET"},
+		{"PROPFIND", methodLabel, otherLabelValue},
+		{"get", methodLabel, otherLabelValue},
+		{"200", statusLabel, "200"},
+		{"499", statusLabel, "499"},
+		{"999", statusLabel, otherLabelValue},
+		{"abc", statusLabel, otherLabelValue},
+	}
+
+	for _, test := range tests {
+		if got := test.label(test.value); got != test.expected {
+			t.Errorf("Expected label %s for %s, got %s", test.expected, test.value, got)
+		}
+	}
+}
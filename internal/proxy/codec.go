@@ -0,0 +1,332 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"mime"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// bodyCodec converts bodies of a content type to and from the JSON document they are
+// equivalent to, and compares documents by the rules of the content type. Documents of
+// every codec share the JSON form, so a protobuf or XML shadow can be compared with a
+// JSON primary.
+type bodyCodec interface {
+	Decode(body []byte) (interface{}, error)
+	Encode(document interface{}) ([]byte, error)
+	Compare(a, b interface{}) bool
+}
+
+// codecRegistry finds the codec of a body by its content type
+type codecRegistry struct {
+	codecs     map[string]bodyCodec // Codecs by media type, without parameters
+	configured bool                 // Codecs were configured beyond the built-in ones
+}
+
+// newCodecRegistry creates a registry of the built-in JSON and form codecs, the XML codec
+// when XML comparison is enabled, and the configured codecs, which take precedence
+func newCodecRegistry(codecs []config.BodyCodec, xml *xmlConverter) (*codecRegistry, error) {
+	r := &codecRegistry{codecs: make(map[string]bodyCodec), configured: len(codecs) > 0}
+	r.Register("application/json", jsonCodec{})
+	r.Register("application/x-www-form-urlencoded", formCodec{})
+	if xml != nil {
+		r.Register("application/xml", xmlCodec{xml})
+		r.Register("text/xml", xmlCodec{xml})
+	}
+
+	for _, cfg := range codecs {
+		var codec bodyCodec
+		switch cfg.Codec {
+		case "json":
+			codec = jsonCodec{}
+		case "form":
+			codec = formCodec{}
+		case "xml":
+			converter := xml
+			if converter == nil {
+				converter, _ = newXMLConverter(config.XMLCompareConfig{})
+			}
+			codec = xmlCodec{converter}
+		case "protobuf":
+			protobuf, err := newProtobufCodec(cfg.Descriptors, cfg.Message)
+			if err != nil {
+				return nil, fmt.Errorf("codec for %q: %w", cfg.ContentType, err)
+			}
+			codec = protobuf
+		default:
+			return nil, fmt.Errorf("codec for %q: unknown codec %q", cfg.ContentType, cfg.Codec)
+		}
+		if err := r.Register(cfg.ContentType, codec); err != nil {
+			return nil, fmt.Errorf("codec for %q: %w", cfg.ContentType, err)
+		}
+	}
+	return r, nil
+}
+
+// Register sets the codec of a content type, replacing the one registered before.
+// Parameters such as charset are ignored, as codecs are found by media type.
+func (r *codecRegistry) Register(contentType string, codec bodyCodec) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+	r.codecs[mediaType] = codec
+	return nil
+}
+
+// Lookup returns the codec of a content type, or nil if none is registered. Media types
+// with a structured syntax suffix, such as application/problem+json, fall back to the
+// codec of the suffix.
+func (r *codecRegistry) Lookup(contentType string) bodyCodec {
+	if r == nil || contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	if codec, ok := r.codecs[mediaType]; ok {
+		return codec
+	}
+	if plus := strings.LastIndex(mediaType, "+"); plus >= 0 {
+		return r.codecs["application/"+mediaType[plus+1:]]
+	}
+	return nil
+}
+
+// jsonCodec decodes JSON bodies, keeping numbers exact
+type jsonCodec struct{}
+
+// Decode implements bodyCodec
+func (jsonCodec) Decode(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+	return document, nil
+}
+
+// Encode implements bodyCodec
+func (jsonCodec) Encode(document interface{}) ([]byte, error) {
+	return json.Marshal(document)
+}
+
+// Compare implements bodyCodec
+func (jsonCodec) Compare(a, b interface{}) bool {
+	return equalDocuments(a, b)
+}
+
+// equalDocuments reports whether two decoded JSON documents are equal. Numbers are
+// compared by value, so 1.0 equals 1 and 1e2 equals 100.
+func equalDocuments(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equalDocuments(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equalDocuments(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okA := new(big.Rat).SetString(string(a))
+		y, okB := new(big.Rat).SetString(string(b))
+		if !okA || !okB {
+			return a == b
+		}
+		return x.Cmp(y) == 0
+	default:
+		return a == b
+	}
+}
+
+// xmlCodec converts XML bodies with the converter used for XML comparison
+type xmlCodec struct {
+	converter *xmlConverter
+}
+
+// Decode implements bodyCodec
+func (c xmlCodec) Decode(body []byte) (interface{}, error) {
+	return c.converter.Convert(body)
+}
+
+// Encode implements bodyCodec
+func (c xmlCodec) Encode(document interface{}) ([]byte, error) {
+	return encodeXML(document)
+}
+
+// Compare implements bodyCodec
+func (c xmlCodec) Compare(a, b interface{}) bool {
+	return equalDocuments(a, b)
+}
+
+// formCodec converts form-encoded bodies to and from an object of their fields. Fields repeated
+// in the body become arrays of their values, in order.
+type formCodec struct{}
+
+// Decode implements bodyCodec
+func (formCodec) Decode(body []byte) (interface{}, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	document := make(map[string]interface{}, len(values))
+	for key, fieldValues := range values {
+		if len(fieldValues) == 1 {
+			document[key] = fieldValues[0]
+			continue
+		}
+		items := make([]interface{}, len(fieldValues))
+		for i, value := range fieldValues {
+			items[i] = value
+		}
+		document[key] = items
+	}
+	return document, nil
+}
+
+// Encode implements bodyCodec. Fields are written in key order.
+func (formCodec) Encode(document interface{}) ([]byte, error) {
+	object, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("form bodies must be objects, got %T", document)
+	}
+	values := make(url.Values, len(object))
+	for key, value := range object {
+		items, repeated := value.([]interface{})
+		if !repeated {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			switch item := item.(type) {
+			case nil:
+				values.Add(key, "")
+			case map[string]interface{}, []interface{}:
+				return nil, fmt.Errorf("form field %q cannot hold nested values", key)
+			default:
+				values.Add(key, fmt.Sprint(item))
+			}
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+// Compare implements bodyCodec
+func (formCodec) Compare(a, b interface{}) bool {
+	return equalDocuments(a, b)
+}
+
+// protobufCodec converts protobuf bodies of one message type, described by a file
+// descriptor set, to and from the message's canonical JSON mapping
+type protobufCodec struct {
+	message protoreflect.MessageDescriptor
+}
+
+// newProtobufCodec loads the message type from a file descriptor set, as written by
+// protoc --descriptor_set_out
+func newProtobufCodec(descriptors string, message string) (*protobufCodec, error) {
+	data, err := os.ReadFile(descriptors)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %w", descriptors, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %w", descriptors, err)
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return nil, fmt.Errorf("message %s: %w", message, err)
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", message)
+	}
+	return &protobufCodec{message: messageDescriptor}, nil
+}
+
+// Decode implements bodyCodec
+func (c *protobufCodec) Decode(body []byte) (interface{}, error) {
+	message := dynamicpb.NewMessage(c.message)
+	if err := proto.Unmarshal(body, message); err != nil {
+		return nil, err
+	}
+	data, err := protojson.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return jsonCodec{}.Decode(data)
+}
+
+// Encode implements bodyCodec, writing fields in a deterministic order
+func (c *protobufCodec) Encode(document interface{}) ([]byte, error) {
+	message, err := c.toMessage(document)
+	if err != nil {
+		return nil, err
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(message)
+}
+
+// Compare implements bodyCodec. Documents are compared as messages, so a field set to its
+// default value equals a field left out; documents that are not messages of the type are
+// compared as JSON.
+func (c *protobufCodec) Compare(a, b interface{}) bool {
+	x, errA := c.toMessage(a)
+	y, errB := c.toMessage(b)
+	if errA != nil || errB != nil {
+		return equalDocuments(a, b)
+	}
+	return proto.Equal(x, y)
+}
+
+// toMessage converts a document in the message's JSON mapping to the message
+func (c *protobufCodec) toMessage(document interface{}) (*dynamicpb.Message, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	message := dynamicpb.NewMessage(c.message)
+	if err := protojson.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
@@ -0,0 +1,272 @@
+package proxy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// writeDescriptorSet writes a descriptor set declaring users.v1.User and returns its path
+func writeDescriptorSet(t *testing.T) string {
+	t.Helper()
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("users.proto"),
+		Package: proto.String("users.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("id"), JsonName: proto.String("id"), Number: proto.Int32(1), Label: optional,
+					Type: descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()},
+				{Name: proto.String("name"), JsonName: proto.String("name"), Number: proto.Int32(2), Label: optional,
+					Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()},
+			},
+		}},
+	}}}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("Failed to marshal descriptor set: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "users.pb")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to write descriptor set: %v", err)
+	}
+	return path
+}
+
+// TestCodecRegistry tests that codecs are found by content type
+func TestCodecRegistry(t *testing.T) {
+	converter, _ := newXMLConverter(config.XMLCompareConfig{})
+	registry, err := newCodecRegistry([]config.BodyCodec{
+		{ContentType: "application/vnd.users+json", Codec: "form"},
+		{ContentType: "application/x-protobuf", Codec: "protobuf", Descriptors: writeDescriptorSet(t), Message: "users.v1.User"},
+	}, converter)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	tests := []struct {
+		contentType string
+		want        bodyCodec
+	}{
+		{contentType: "application/json; charset=utf-8", want: jsonCodec{}},
+		{contentType: "application/problem+json", want: jsonCodec{}},
+		{contentType: "application/vnd.users+json", want: formCodec{}},
+		{contentType: "application/x-www-form-urlencoded", want: formCodec{}},
+		{contentType: "text/xml", want: xmlCodec{converter}},
+		{contentType: "application/soap+xml", want: xmlCodec{converter}},
+		{contentType: "text/plain"},
+		{contentType: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := registry.Lookup(tt.contentType); got != tt.want {
+				t.Errorf("Expected codec %T, got %T", tt.want, got)
+			}
+		})
+	}
+	if _, ok := registry.Lookup("application/x-protobuf").(*protobufCodec); !ok {
+		t.Error("Expected the configured protobuf codec")
+	}
+
+	// Registered codecs replace the built-in ones and are found by media type
+	if err := registry.Register("application/json; charset=utf-8", formCodec{}); err != nil {
+		t.Fatalf("Failed to register codec: %v", err)
+	}
+	if got := registry.Lookup("application/json"); got != (formCodec{}) {
+		t.Errorf("Expected the registered codec, got %T", got)
+	}
+	if err := registry.Register("not a content type;", jsonCodec{}); err == nil {
+		t.Error("Expected an error for an invalid content type")
+	}
+
+	// Descriptor sets must declare the message
+	_, err = newCodecRegistry([]config.BodyCodec{
+		{ContentType: "application/x-protobuf", Codec: "protobuf", Descriptors: writeDescriptorSet(t), Message: "users.v1.Order"},
+	}, nil)
+	if err == nil {
+		t.Error("Expected an error for a message missing from the descriptor set")
+	}
+}
+
+// encodeUser encodes a users.v1.User from its JSON mapping, as a protobuf backend would
+func encodeUser(t *testing.T, codec *protobufCodec, document string) []byte {
+	t.Helper()
+	message := dynamicpb.NewMessage(codec.message)
+	if err := protojson.Unmarshal([]byte(document), message); err != nil {
+		t.Fatalf("Invalid test user: %v", err)
+	}
+	body, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatalf("Failed to encode user: %v", err)
+	}
+	return body
+}
+
+// TestCodecDecode tests that bodies decode to the JSON document they are equivalent to
+func TestCodecDecode(t *testing.T) {
+	converter, _ := newXMLConverter(config.XMLCompareConfig{})
+	protobuf, err := newProtobufCodec(writeDescriptorSet(t), "users.v1.User")
+	if err != nil {
+		t.Fatalf("Failed to create protobuf codec: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		codec bodyCodec
+		body  string
+		want  string
+	}{
+		{name: "json", codec: jsonCodec{}, body: `{"id":12345678901234567890,"tags":["a","b"]}`, want: `{"id":12345678901234567890,"tags":["a","b"]}`},
+		{name: "form", codec: formCodec{}, body: "tag=a&id=42&tag=b", want: `{"id":"42","tag":["a","b"]}`},
+		{name: "xml", codec: xmlCodec{converter}, body: `<User id="42"><Name>Ada &amp; Co</Name><Tag>a</Tag><Tag>b</Tag></User>`, want: `{"User":{"@id":42,"Name":"Ada \u0026 Co","Tag":["a","b"]}}`},
+		{name: "protobuf", codec: protobuf, body: string(encodeUser(t, protobuf, `{"id":"42","name":"Ada"}`)), want: `{"id":"42","name":"Ada"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := tt.codec.Decode([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to decode %q: %v", tt.body, err)
+			}
+			if canonical, _ := json.Marshal(decoded); string(canonical) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, canonical)
+			}
+		})
+	}
+}
+
+// TestCodecRoundTrip tests that encoded documents decode to the same document
+func TestCodecRoundTrip(t *testing.T) {
+	converter, _ := newXMLConverter(config.XMLCompareConfig{})
+	protobuf, err := newProtobufCodec(writeDescriptorSet(t), "users.v1.User")
+	if err != nil {
+		t.Fatalf("Failed to create protobuf codec: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		codec    bodyCodec
+		document string
+	}{
+		{name: "json", codec: jsonCodec{}, document: `{"id":12345678901234567890,"tags":["a","b"]}`},
+		{name: "form", codec: formCodec{}, document: `{"id":"42","tag":["a","b"]}`},
+		{name: "xml", codec: xmlCodec{converter}, document: `{"User":{"@id":42,"Name":"Ada & Co","Tag":["a","b"]}}`},
+		{name: "protobuf", codec: protobuf, document: `{"id":"42","name":"Ada"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := jsonCodec{}.Decode([]byte(tt.document))
+			if err != nil {
+				t.Fatalf("Invalid test document: %v", err)
+			}
+			body, err := tt.codec.Encode(document)
+			if err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+			decoded, err := tt.codec.Decode(body)
+			if err != nil {
+				t.Fatalf("Failed to decode %q: %v", body, err)
+			}
+			if !tt.codec.Compare(document, decoded) {
+				canonical, _ := json.Marshal(decoded)
+				t.Errorf("Expected %s after a round trip, got %s", tt.document, canonical)
+			}
+		})
+	}
+}
+
+// TestCodecCompare tests that documents are compared by the rules of their codec
+func TestCodecCompare(t *testing.T) {
+	protobuf, err := newProtobufCodec(writeDescriptorSet(t), "users.v1.User")
+	if err != nil {
+		t.Fatalf("Failed to create protobuf codec: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		codec bodyCodec
+		a     string
+		b     string
+		want  bool
+	}{
+		{name: "json key order", codec: jsonCodec{}, a: `{"a":1,"b":[1,2]}`, b: `{"b":[1,2],"a":1}`, want: true},
+		{name: "json number forms", codec: jsonCodec{}, a: `{"n":1.0,"m":1e2}`, b: `{"n":1,"m":100}`, want: true},
+		{name: "json large integers", codec: jsonCodec{}, a: `12345678901234567890`, b: `12345678901234567891`, want: false},
+		{name: "json array order", codec: jsonCodec{}, a: `[1,2]`, b: `[2,1]`, want: false},
+		{name: "json string and number", codec: jsonCodec{}, a: `{"id":"42"}`, b: `{"id":42}`, want: false},
+		{name: "form", codec: formCodec{}, a: `{"a":"1"}`, b: `{"a":"2"}`, want: false},
+		{name: "protobuf default field", codec: protobuf, a: `{"id":"42","name":""}`, b: `{"id":"42"}`, want: true},
+		{name: "protobuf int64 forms", codec: protobuf, a: `{"id":42}`, b: `{"id":"42"}`, want: true},
+		{name: "protobuf differing field", codec: protobuf, a: `{"id":"42","name":"Ada"}`, b: `{"id":"42"}`, want: false},
+		{name: "protobuf unknown field", codec: protobuf, a: `{"email":"a@b.c"}`, b: `{"email":"a@b.c"}`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := jsonCodec{}.Decode([]byte(tt.a))
+			b, _ := jsonCodec{}.Decode([]byte(tt.b))
+			if got := tt.codec.Compare(a, b); got != tt.want {
+				t.Errorf("Expected %v comparing %s with %s, got %v", tt.want, tt.a, tt.b, got)
+			}
+		})
+	}
+}
+
+// TestNormalizeByContentType tests that bodies are compared in the form their content type
+// decodes to
+func TestNormalizeByContentType(t *testing.T) {
+	descriptors := writeDescriptorSet(t)
+	protobuf, err := newProtobufCodec(descriptors, "users.v1.User")
+	if err != nil {
+		t.Fatalf("Failed to create protobuf codec: %v", err)
+	}
+	userProtobuf := encodeUser(t, protobuf, `{"id":"42","name":"Ada"}`)
+
+	normalizer, err := newBodyNormalizer(config.NormalizeConfig{Codecs: []config.BodyCodec{
+		{ContentType: "application/x-protobuf", Codec: "protobuf", Descriptors: descriptors, Message: "users.v1.User"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		primary     string
+		primaryType string
+		shadow      string
+		shadowType  string
+		wantEqual   bool
+	}{
+		{name: "protobuf and JSON", primary: `{"name":"Ada","id":"42"}`, primaryType: "application/json",
+			shadow: string(userProtobuf), shadowType: "application/x-protobuf", wantEqual: true},
+		{name: "form field order", primary: "b=2&a=1&a=3", primaryType: "application/x-www-form-urlencoded",
+			shadow: "a=1&b=2&a=3", shadowType: "application/x-www-form-urlencoded", wantEqual: true},
+		{name: "form repeated field order", primary: "a=1&a=3", primaryType: "application/x-www-form-urlencoded",
+			shadow: "a=3&a=1", shadowType: "application/x-www-form-urlencoded", wantEqual: false},
+		{name: "unregistered content type", primary: `{"b":1,"a":2}`, primaryType: "text/plain",
+			shadow: `{"a":2,"b":1}`, shadowType: "text/plain", wantEqual: true},
+		{name: "number forms", primary: `{"price":10.50}`, primaryType: "application/json",
+			shadow: `{"price":10.5}`, shadowType: "application/json", wantEqual: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := normalizer.NormalizeAs([]byte(tt.primary), tt.primaryType)
+			shadow := normalizer.NormalizeAs([]byte(tt.shadow), tt.shadowType)
+			if normalizer.Equal(primary, tt.primaryType, shadow, tt.shadowType) != tt.wantEqual {
+				t.Errorf("Expected equal=%v, got primary %q and shadow %q", tt.wantEqual, primary, shadow)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Outcomes of comparing a shadow response against the primary response
+const (
+	comparisonMatch    = "match"
+	comparisonMismatch = "mismatch"
+	comparisonError    = "error" // Either side failed, so there was nothing to compare
+)
+
+// Parts of a shadow response that can differ from the primary response. Header
+// differences are reported as "header:<name>".
+const (
+	differenceStatus = "status"
+	differenceHeader = "header"
+	differenceBody   = "body"
+)
+
+// comparisonJob holds every service result for one proxied request
+type comparisonJob struct {
+	route   string
+	method  string
+	path    string
+	results []*serviceResult
+}
+
+// comparisonRules are how a shadow service's responses are compared with the primary's
+type comparisonRules struct {
+	normalizer    *bodyNormalizer // Nil compares bodies byte for byte
+	headers       []string        // Response headers compared, "*" for all, nil for none
+	ignoreHeaders map[string]bool // Canonical names of headers never compared
+}
+
+// comparisonPair holds the rules replacing the default ones for a shadow service
+type comparisonPair struct {
+	primary string // Primary service name, empty for any
+	shadow  string
+	rules   *comparisonRules
+}
+
+// newComparisonRules creates the default comparison rules and the rules of every
+// configured service pair, which inherit the defaults they leave unset
+func newComparisonRules(cfg config.ComparisonConfig) (*comparisonRules, []comparisonPair, error) {
+	build := func(normalize config.NormalizeConfig, headers []string, ignore []string) (*comparisonRules, error) {
+		normalizer, err := newBodyNormalizer(normalize)
+		if err != nil {
+			return nil, err
+		}
+		rules := &comparisonRules{normalizer: normalizer, headers: headers, ignoreHeaders: make(map[string]bool, len(ignore))}
+		for _, name := range ignore {
+			rules.ignoreHeaders[http.CanonicalHeaderKey(name)] = true
+		}
+		return rules, nil
+	}
+
+	rules, err := build(cfg.Normalize, cfg.Headers, cfg.IgnoreHeaders)
+	if err != nil {
+		return nil, nil, err
+	}
+	pairs := make([]comparisonPair, 0, len(cfg.Pairs))
+	for _, pair := range cfg.Pairs {
+		normalize, headers, ignore := cfg.Normalize, cfg.Headers, cfg.IgnoreHeaders
+		if pair.Normalize != nil {
+			normalize = *pair.Normalize
+		}
+		if pair.Headers != nil {
+			headers = pair.Headers
+		}
+		if pair.IgnoreHeaders != nil {
+			ignore = pair.IgnoreHeaders
+		}
+		pairRules, err := build(normalize, headers, ignore)
+		if err != nil {
+			return nil, nil, fmt.Errorf("comparison pair for %s: %w", pair.Shadow, err)
+		}
+		pairs = append(pairs, comparisonPair{primary: pair.Primary, shadow: pair.Shadow, rules: pairRules})
+	}
+	return rules, pairs, nil
+}
+
+// comparedHeaders returns the names of the headers compared between two responses
+func (r *comparisonRules) comparedHeaders(primary http.Header, shadow http.Header) []string {
+	var names []string
+	for _, name := range r.headers {
+		if name != "*" {
+			if !r.ignoreHeaders[http.CanonicalHeaderKey(name)] {
+				names = append(names, name)
+			}
+			continue
+		}
+
+		// Every header either response carries, in a stable order
+		seen := make(map[string]bool)
+		for _, header := range []http.Header{primary, shadow} {
+			for name := range header {
+				if !seen[name] && !r.ignoreHeaders[name] {
+					seen[name] = true
+				}
+			}
+		}
+		all := make([]string, 0, len(seen))
+		for name := range seen {
+			all = append(all, name)
+		}
+		sort.Strings(all)
+		return all
+	}
+	return names
+}
+
+// comparisonPipeline compares primary and shadow responses on background workers. Jobs
+// are queued without blocking and dropped when the queue is full, so comparison never
+// adds latency to client requests.
+type comparisonPipeline struct {
+	mu       sync.RWMutex
+	closed   bool
+	queue    chan comparisonJob
+	wg       sync.WaitGroup
+	rules    *comparisonRules // Rules of shadows without a pair
+	pairs    []comparisonPair // Rules by service pair, first match wins
+	sampler  *bodySampler     // Nil compares every body in full
+	onResult func(route string, service string, outcome string, differences []string)
+}
+
+// newComparisonPipeline starts workers consuming a queue of the given size
+func newComparisonPipeline(workers int, queueSize int, rules *comparisonRules, pairs []comparisonPair, sampler *bodySampler, onResult func(route string, service string, outcome string, differences []string)) *comparisonPipeline {
+	p := &comparisonPipeline{
+		queue:    make(chan comparisonJob, queueSize),
+		rules:    rules,
+		pairs:    pairs,
+		sampler:  sampler,
+		onResult: onResult,
+	}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues a job, reporting false if the queue was full or closed and the job was dropped
+func (p *comparisonPipeline) Submit(job comparisonJob) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.queue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// rulesFor returns the rules comparing a shadow service with a primary service. A nil
+// pipeline compares bodies byte for byte and no headers.
+func (p *comparisonPipeline) rulesFor(primary string, shadow string) *comparisonRules {
+	if p == nil {
+		return &comparisonRules{}
+	}
+	for _, pair := range p.pairs {
+		if pair.shadow == shadow && (pair.primary == "" || pair.primary == primary) {
+			return pair.rules
+		}
+	}
+	return p.rules
+}
+
+// Close stops accepting jobs and waits for queued jobs to be compared
+func (p *comparisonPipeline) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// work compares jobs until the queue is closed
+func (p *comparisonPipeline) work() {
+	defer p.wg.Done()
+	for job := range p.queue {
+		p.compare(job)
+	}
+}
+
+// compare checks every shadow result of a job against the primary result
+func (p *comparisonPipeline) compare(job comparisonJob) {
+	var primary *serviceResult
+	for _, result := range job.results {
+		if result.service.Primary {
+			primary = result
+			break
+		}
+	}
+	if primary == nil {
+		return
+	}
+
+	// Normalize or sample the primary body at most once per rule set, as the shadows need it
+	primaryBodies := make(map[*bodyNormalizer][]byte)
+	var primarySample *bodySample
+
+	for _, shadow := range job.results {
+		if shadow == primary {
+			continue
+		}
+
+		rules := p.rulesFor(primary.service.Name, shadow.service.Name)
+		var headers []string
+		if primary.resp != nil && shadow.resp != nil {
+			headers = rules.comparedHeaders(primary.resp.Header, shadow.resp.Header)
+		}
+
+		var outcome string
+		var differences []string
+		var primaryBody, shadowBody []byte
+		var shadowSample bodySample
+		sampled := p.sampler.Exceeds(primary.body) || p.sampler.Exceeds(shadow.body)
+		if sampled {
+			if primarySample == nil {
+				sample := p.sampler.Sample(primary.body, responseContentType(primary))
+				primarySample = &sample
+			}
+			shadowSample = p.sampler.Sample(shadow.body, responseContentType(shadow))
+			outcome, differences = compareResults(primary, shadow, bytes.Equal(primarySample.data, shadowSample.data), headers)
+		} else {
+			var ok bool
+			if primaryBody, ok = primaryBodies[rules.normalizer]; !ok {
+				primaryBody = rules.normalizer.NormalizeAs(primary.body, responseContentType(primary))
+				primaryBodies[rules.normalizer] = primaryBody
+			}
+			shadowBody = rules.normalizer.NormalizeAs(shadow.body, responseContentType(shadow))
+			sameBody := rules.normalizer.Equal(primaryBody, responseContentType(primary), shadowBody, responseContentType(shadow))
+			outcome, differences = compareResults(primary, shadow, sameBody, headers)
+		}
+
+		if outcome == comparisonMismatch {
+			fields := map[string]interface{}{
+				"route":          job.route,
+				"method":         job.method,
+				"path":           job.path,
+				"primary":        primary.service.Name,
+				"service":        shadow.service.Name,
+				"primary_status": primary.resp.StatusCode,
+				"shadow_status":  shadow.resp.StatusCode,
+				"differences":    differences,
+			}
+			// Differing header values are logged, body contents never are
+			headerValues := make(map[string]interface{})
+			for _, difference := range differences {
+				if name, ok := strings.CutPrefix(difference, differenceHeader+":"); ok {
+					headerValues[name] = map[string]string{
+						"primary": headerValue(primary.resp.Header, name),
+						"shadow":  headerValue(shadow.resp.Header, name),
+					}
+				}
+			}
+			if len(headerValues) > 0 {
+				fields["headers"] = headerValues
+			}
+			// Paths of differing JSON fields locate the difference without logging values
+			if !sampled && slices.Contains(differences, differenceBody) {
+				logBodyDiff(fields, primaryBody, shadowBody)
+			}
+			// Hashes of the content left out of the sample tell whether the rest differs too
+			if sampled {
+				fields["sampled"] = true
+				fields["primary_tail_sha256"] = primarySample.tailHash
+				fields["shadow_tail_sha256"] = shadowSample.tailHash
+			}
+			logger.ForService(shadow.service.Name).InfoWithFields("Shadow response differs from primary", fields)
+		}
+		if p.onResult != nil {
+			p.onResult(job.route, shadow.service.Name, outcome, differences)
+		}
+	}
+}
+
+// compareResults compares the status code and headers of a shadow response with the
+// primary, given whether their bodies are the same, returning the outcome and the parts
+// that differ
+func compareResults(primary *serviceResult, shadow *serviceResult, sameBody bool, headers []string) (string, []string) {
+	if primary.err != nil || shadow.err != nil {
+		return comparisonError, nil
+	}
+
+	var differences []string
+	if primary.resp.StatusCode != shadow.resp.StatusCode {
+		differences = append(differences, differenceStatus)
+	}
+	for _, name := range headers {
+		if headerValue(primary.resp.Header, name) != headerValue(shadow.resp.Header, name) {
+			differences = append(differences, differenceHeader+":"+name)
+		}
+	}
+	if !sameBody {
+		differences = append(differences, differenceBody)
+	}
+
+	if len(differences) > 0 {
+		return comparisonMismatch, differences
+	}
+	return comparisonMatch, nil
+}
+
+// headerValue returns every value of a header joined as a single field value
+func headerValue(header http.Header, name string) string {
+	return strings.Join(header.Values(name), ", ")
+}
+
+// responseContentType returns the content type of a result's response, empty if it failed
+func responseContentType(result *serviceResult) string {
+	if result.resp == nil {
+		return ""
+	}
+	return result.resp.Header.Get("Content-Type")
+}
+
+// submitComparison queues the results of a request for comparison, if enabled. Requests
+// with streamed or drained bodies cannot be compared.
+func (c *Conductor) submitComparison(route string, method string, path string, results []*serviceResult) {
+	if c.comparison == nil || len(results) < 2 {
+		return
+	}
+	for _, result := range results {
+		if result.stream != nil || result.drained {
+			return
+		}
+	}
+
+	job := comparisonJob{route: route, method: method, path: path, results: results}
+	if !c.comparison.Submit(job) {
+		logger.WarnWithFields("Comparison queue full, dropping comparison", map[string]interface{}{
+			"route":  route,
+			"method": method,
+			"path":   path,
+		})
+		c.recordComparison(route, "all", "dropped", nil)
+	}
+}
+
+// recordComparison reports the outcome of a shadow comparison and the parts that differ
+func (c *Conductor) recordComparison(route string, service string, outcome string, differences []string) {
+	if c.prometheusMetrics == nil {
+		return
+	}
+	c.prometheusMetrics.RecordComparison(service, route, outcome)
+
+	// Count each kind of difference once, however many headers differ
+	counted := make(map[string]bool, len(differences))
+	for _, difference := range differences {
+		kind, _, _ := strings.Cut(difference, ":")
+		if !counted[kind] {
+			counted[kind] = true
+			c.prometheusMetrics.RecordMismatch(service, route, kind)
+		}
+	}
+}
+
+// Close releases background resources held by the conductor, waiting for queued work
+func (c *Conductor) Close() {
+	c.reloadMu.Lock()
+	if c.healthChecker != nil {
+		c.healthChecker.Stop()
+		c.healthChecker = nil
+	}
+	c.reloadMu.Unlock()
+	if c.flags != nil {
+		c.flags.Stop()
+	}
+	// Deferred mirrors submit comparisons and captures, so they finish first
+	if c.deferredMirrors != nil {
+		c.deferredMirrors.Close()
+	}
+	if c.capture != nil {
+		c.capture.Close()
+	}
+	if c.comparison != nil {
+		c.comparison.Close()
+	}
+	if pipeline := c.currentPostProcessing(); pipeline != nil {
+		pipeline.Close()
+	}
+	if c.accessLog != nil {
+		if err := c.accessLog.Close(); err != nil {
+			logger.Error("Failed to close access log", err)
+		}
+	}
+}
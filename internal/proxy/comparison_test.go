@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestComparisonPipeline tests that shadow results are compared against the primary in the background
+func TestComparisonPipeline(t *testing.T) {
+	var mu sync.Mutex
+	outcomes := make(map[string]string)
+	differences := make(map[string]string)
+	pipeline := newComparisonPipeline(2, 10, &comparisonRules{headers: []string{"Content-Type"}}, nil, nil, func(route string, service string, outcome string, differs []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		outcomes[service] = outcome
+		differences[service] = strings.Join(differs, ",")
+	})
+
+	result := func(name string, primary bool, status int, contentType string, body string, err error) *serviceResult {
+		r := &serviceResult{service: &Service{Name: name, Primary: primary}, body: []byte(body), err: err}
+		if err == nil {
+			r.resp = &http.Response{StatusCode: status, Header: http.Header{"Content-Type": {contentType}}}
+		}
+		return r
+	}
+
+	ok := pipeline.Submit(comparisonJob{
+		route: "/api",
+		results: []*serviceResult{
+			result("shadow-same", false, 200, "application/json", `{"id":1}`, nil),
+			result("primary", true, 200, "application/json", `{"id":1}`, nil),
+			result("shadow-body", false, 200, "application/json", `{"id":2}`, nil),
+			result("shadow-status", false, 500, "application/json", `{"id":1}`, nil),
+			result("shadow-header", false, 200, "text/plain", `{"id":3}`, nil),
+			result("shadow-failed", false, 0, "", "", errors.New("connection refused")),
+		},
+	})
+	if !ok {
+		t.Fatal("Expected job to be queued")
+	}
+	pipeline.Close()
+
+	expected := map[string]string{
+		"shadow-same":   comparisonMatch,
+		"shadow-body":   comparisonMismatch,
+		"shadow-status": comparisonMismatch,
+		"shadow-header": comparisonMismatch,
+		"shadow-failed": comparisonError,
+	}
+	for service, want := range expected {
+		if outcomes[service] != want {
+			t.Errorf("Expected %s for %s, got %q", want, service, outcomes[service])
+		}
+	}
+
+	expectedDifferences := map[string]string{
+		"shadow-same":   "",
+		"shadow-body":   "body",
+		"shadow-status": "status",
+		"shadow-header": "header:Content-Type,body",
+	}
+	for service, want := range expectedDifferences {
+		if differences[service] != want {
+			t.Errorf("Expected differences %q for %s, got %q", want, service, differences[service])
+		}
+	}
+
+	if pipeline.Submit(comparisonJob{}) {
+		t.Errorf("Expected jobs to be rejected after close")
+	}
+}
+
+// TestMirrorAcceptEncoding tests that every service of a mirrored request is asked for the
+// configured encoding, except a primary whose client does not accept it
+func TestMirrorAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           map[string]string
+	}{
+		{
+			name:           "client accepts the encoding",
+			acceptEncoding: "br, gzip",
+			want:           map[string]string{"primary.example.com": "identity", "shadow.example.com": "identity", "site.example.com": "br, gzip"},
+		},
+		{
+			name:           "client refuses the encoding",
+			acceptEncoding: "br, identity;q=0",
+			want:           map[string]string{"primary.example.com": "br, identity;q=0", "shadow.example.com": "identity", "site.example.com": "br, identity;q=0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "primary", URL: "http://primary.example.com", PathPrefix: "/api", Primary: true},
+					{Name: "shadow", URL: "http://shadow.example.com", PathPrefix: "/api"},
+					{Name: "site", URL: "http://site.example.com", PathPrefix: "/site", Primary: true},
+				},
+				Comparison: config.ComparisonConfig{AcceptEncoding: "identity"},
+			}
+			conductor := NewConductor(cfg)
+			transport := &hostRecordingTransport{requests: make(map[string]*http.Request)}
+			conductor.client = &http.Client{Transport: transport}
+
+			transport.wg.Add(3)
+			for _, path := range []string{"/api/users", "/site/index.html"} {
+				req := httptest.NewRequest("GET", "http://example.com"+path, nil)
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+				conductor.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			transport.wg.Wait()
+
+			for host, want := range tt.want {
+				if got := transport.requests[host].Header.Get("Accept-Encoding"); got != want {
+					t.Errorf("Expected Accept-Encoding %q for %s, got %q", want, host, got)
+				}
+			}
+		})
+	}
+}
+
+// TestComparisonRules tests that service pairs are compared with their own rules
+func TestComparisonRules(t *testing.T) {
+	rules, pairs, err := newComparisonRules(config.ComparisonConfig{
+		Headers:       []string{"*"},
+		IgnoreHeaders: []string{"date"},
+		Pairs: []config.ComparisonPair{
+			{Shadow: "api-v2", Normalize: &config.NormalizeConfig{IgnoreArrayOrder: true}, IgnoreHeaders: []string{"Date", "Server"}},
+			{Primary: "other", Shadow: "api-v3", Headers: []string{}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create rules: %v", err)
+	}
+	pipeline := &comparisonPipeline{rules: rules, pairs: pairs}
+
+	result := func(name string, server string, body string) *serviceResult {
+		return &serviceResult{service: &Service{Name: name}, body: []byte(body), resp: &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Date": {name}, "Server": {server}, "Content-Type": {"application/json"}},
+		}}
+	}
+	primary := result("api", "nginx", `{"ids":[1,2]}`)
+
+	tests := []struct {
+		name            string
+		shadow          *serviceResult
+		wantDifferences string
+	}{
+		{name: "defaults compare every header but Date", shadow: result("api-v1", "envoy", `{"ids":[2,1]}`), wantDifferences: "header:Server,body"},
+		{name: "pair ignores array order and Server", shadow: result("api-v2", "envoy", `{"ids":[2,1]}`)},
+		{name: "pair of another primary", shadow: result("api-v3", "envoy", `{"ids":[1,2]}`), wantDifferences: "header:Server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := pipeline.rulesFor(primary.service.Name, tt.shadow.service.Name)
+			sameBody := rules.normalizer.Equal(rules.normalizer.Normalize(primary.body), "", rules.normalizer.Normalize(tt.shadow.body), "")
+			_, differences := compareResults(primary, tt.shadow, sameBody, rules.comparedHeaders(primary.resp.Header, tt.shadow.resp.Header))
+			if got := strings.Join(differences, ","); got != tt.wantDifferences {
+				t.Errorf("Expected differences %q, got %q", tt.wantDifferences, got)
+			}
+		})
+	}
+}
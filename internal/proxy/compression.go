@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Directions of compression reported in metrics
+const (
+	compressionBackend = "backend" // Responses decompressed from backends
+	compressionClient  = "client"  // Responses compressed toward clients
+)
+
+// decompressResponse replaces a gzip-encoded backend response body with its plaintext, so
+// comparison and rewriting see the actual content. limit bounds the decompressed size the
+// same way it bounds the raw body. Services without a limit are bounded by the
+// compression's maxDecompressedBytes instead, so a small body cannot expand without end.
+func (c *Conductor) decompressResponse(svc *Service, resp *http.Response, body []byte, limit int64) ([]byte, error) {
+	if !c.config.Compression.Enabled || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return body, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	maxBytes := c.config.Compression.MaxDecompressedBytes
+	if limit == 0 && maxBytes > 0 {
+		// Read one byte past the bound so an oversized body can be detected
+		limit = maxBytes + 1
+	} else {
+		maxBytes = 0
+	}
+	var plain io.Reader = reader
+	if limit > 0 {
+		plain = io.LimitReader(reader, limit)
+	}
+	decompressed, err := io.ReadAll(plain)
+	if err != nil {
+		return nil, err
+	}
+	if maxBytes > 0 && int64(len(decompressed)) > maxBytes {
+		logger.ForService(svc.Name).ErrorWithFields("Service response decompresses past the limit, discarding it", errResponseTooLarge, map[string]interface{}{
+			"service":      svc.Name,
+			"route":        svc.Route,
+			"status_code":  resp.StatusCode,
+			"response_len": len(body),
+			"max_bytes":    maxBytes,
+		})
+		if c.prometheusMetrics != nil {
+			c.prometheusMetrics.RecordError(svc.Name, svc.Route, "response_too_large")
+		}
+		return nil, errResponseTooLarge
+	}
+
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = int64(len(decompressed))
+	resp.Uncompressed = true
+
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordCompression(svc.Name, compressionBackend, len(body), len(decompressed))
+	}
+	return decompressed, nil
+}
+
+// acceptsGzip reports whether the client accepts gzip-encoded responses
+func acceptsGzip(r *http.Request) bool {
+	return acceptsEncoding(r, "gzip")
+}
+
+// acceptsEncoding reports whether the client accepts responses in the content coding. A
+// coding named by the client takes precedence over *, and identity is accepted unless
+// the client refuses it.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	wildcard, hasWildcard := false, false
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+			name = strings.TrimSpace(name)
+			accepted := true
+			if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				q, err := strconv.ParseFloat(value, 64)
+				accepted = err == nil && q > 0
+			}
+			switch {
+			case strings.EqualFold(name, encoding):
+				return accepted
+			case name == "*":
+				wildcard, hasWildcard = accepted, true
+			}
+		}
+	}
+	if hasWildcard {
+		return wildcard
+	}
+	return strings.EqualFold(encoding, "identity")
+}
+
+// compressForClient gzips the response body for clients that accept it, updating the
+// response headers already copied to w, and returns the body to write
+func (c *Conductor) compressForClient(w http.ResponseWriter, r *http.Request, result *serviceResult) []byte {
+	body := result.body
+	cfg := c.config.Compression
+	if !cfg.Enabled || len(body) == 0 || len(body) < cfg.MinSize || r.Method == http.MethodHead ||
+		w.Header().Get("Content-Encoding") != "" || !acceptsGzip(r) {
+		return body
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		logger.Error("Failed to compress response", err)
+		return body
+	}
+	if err := writer.Close(); err != nil {
+		logger.Error("Failed to compress response", err)
+		return body
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Del("Content-Length")
+
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordCompression(result.service.Name, compressionClient, buf.Len(), len(body))
+	}
+	return buf.Bytes()
+}
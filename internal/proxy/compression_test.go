@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// gzipTransport answers with a gzip-encoded body when the request asks for gzip
+type gzipTransport struct {
+	body string
+}
+
+func (g *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") != "gzip" {
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(g.body))}, nil
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(g.body))
+	writer.Close()
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       io.NopCloser(&buf),
+	}, nil
+}
+
+// TestCompression tests decompressing backend responses and recompressing toward clients
+func TestCompression(t *testing.T) {
+	body := strings.Repeat("compressible ", 200)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{name: "client accepts gzip", acceptEncoding: "br, gzip;q=0.8", wantEncoding: "gzip"},
+		{name: "client refuses gzip", acceptEncoding: "gzip;q=0", wantEncoding: ""},
+		{name: "client sends no preference", acceptEncoding: "", wantEncoding: ""},
+		{name: "client refuses gzip but accepts any other", acceptEncoding: "*, gzip;q=0", wantEncoding: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+				},
+				Compression: config.CompressionConfig{Enabled: true, MinSize: 1024},
+			}
+			conductor := NewConductor(cfg)
+			conductor.client = &http.Client{Transport: &gzipTransport{body: body}}
+
+			// Backend responses are held in plaintext for comparison and rewriting
+			req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+			result := conductor.makeServiceRequest(req.Context(), conductor.services[0], req, &requestBody{})
+			if result.err != nil || string(result.body) != body || result.resp.Header.Get("Content-Encoding") != "" {
+				t.Fatalf("Expected decompressed backend response, got %q (err: %v)", result.body, result.err)
+			}
+
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if got := recorder.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tt.wantEncoding, got)
+			}
+			received := recorder.Body.Bytes()
+			if tt.wantEncoding == "gzip" {
+				reader, err := gzip.NewReader(recorder.Body)
+				if err != nil {
+					t.Fatalf("Expected a gzip body: %v", err)
+				}
+				received, _ = io.ReadAll(reader)
+			}
+			if string(received) != body {
+				t.Errorf("Expected the original body after decoding, got %d bytes", len(received))
+			}
+		})
+	}
+}
+
+// TestDecompressionLimit tests that a small gzip body expanding past maxDecompressedBytes is discarded
+func TestDecompressionLimit(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+		Compression: config.CompressionConfig{Enabled: true, MinSize: 1024, MaxDecompressedBytes: 4096},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: &gzipTransport{body: strings.Repeat("a", 1<<20)}}
+
+	req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+	result := conductor.makeServiceRequest(req.Context(), conductor.services[0], req, &requestBody{})
+	if result.err != errResponseTooLarge {
+		t.Fatalf("Expected errResponseTooLarge, got %v (%d bytes)", result.err, len(result.body))
+	}
+
+	conductor.client = &http.Client{Transport: &gzipTransport{body: strings.Repeat("a", 4096)}}
+	result = conductor.makeServiceRequest(req.Context(), conductor.services[0], req, &requestBody{})
+	if result.err != nil || len(result.body) != 4096 {
+		t.Fatalf("Expected a body at the limit to pass, got %d bytes (err: %v)", len(result.body), result.err)
+	}
+}
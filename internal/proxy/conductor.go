@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zeek-r/go-conductor/internal/config"
@@ -14,13 +16,62 @@ import (
 type Conductor struct {
 	services          []*Service
 	client            *http.Client
-	timeout           time.Duration
+	transport         *http.Transport // Base transport for backend connections, nil for the default
+	dnsCache          *dnsCache       // Backend hostname cache, nil if disabled
+	timeout           time.Duration   // Total budget for a request across all attempts
+	attemptTimeout    time.Duration   // Budget for a single upstream attempt, zero if unbounded
+	handlerTimeout    time.Duration   // Budget for handling a request, reading its body included, zero if bounded by timeout alone
+	routesMu          sync.RWMutex    // Guards the services, routes and failover clusters replaced on reload
+	reloadMu          sync.Mutex      // Serializes reloads and the health checker they restart
 	routesByPrefix    map[string][]*Service
 	routesByExact     map[string][]*Service
 	routesByPath      map[string][]*Service
-	metrics           *MetricsCollector  // Legacy metrics collector
-	prometheusMetrics *PrometheusMetrics // Prometheus metrics collector
-	config            *config.Config     // Reference to configuration
+	routesByRegex     []*regexRoute                   // Routes matched by path regular expression, in configuration order
+	routeCache        *routeCache                     // Services matched by recently requested paths, nil if disabled
+	accessLog         *accessLog                      // One line per answered request, nil if disabled
+	annotations       *annotations                    // Headers describing the conductor's decisions, nil if disabled
+	capture           *captureSink                    // Export of mirrored exchanges, nil if disabled
+	authorizers       map[string]Authorizer           // Access decisions by route, nil if none are configured
+	metrics           *MetricsCollector               // Legacy metrics collector
+	prometheusMetrics *PrometheusMetrics              // Prometheus metrics collector
+	sloTracker        *sloTracker                     // Rolling latency and SLO tracking, nil if disabled
+	adaptiveTimeouts  *adaptiveTimeouts               // Attempt timeouts following each route's latency, nil if disabled
+	deduper           *requestDeduper                 // Coalesces duplicate idempotent requests, nil if disabled
+	bandwidth         *bandwidthLimiters              // Byte-rate limits by route, nil if none are configured
+	failover          map[string][]*Service           // Remote cluster services by route
+	comparison        *comparisonPipeline             // Background shadow comparison, nil if disabled
+	healthChecker     *healthChecker                  // Active health probes, nil if none are configured
+	mirrorPauses      *mirrorPauses                   // Routes with shadow traffic paused, nil if admin endpoints are disabled
+	serviceOverrides  *serviceOverrides               // Services disabled at runtime, nil if admin endpoints are disabled
+	freezes           *routeFreezes                   // Routes frozen against automated changes, nil if admin endpoints are disabled
+	budgets           map[string]config.RouteBudget   // Size and latency budgets by route, nil if none are configured
+	inFlight          atomic.Int64                    // Requests currently admitted by ServeHTTP
+	quotas            *quotaTracker                   // Per-tenant usage and quotas, nil if disabled
+	loops             *loopDetector                   // Marks and recognizes looping requests, nil if disabled
+	auth              map[string]authExpr             // Authentication requirements by route, nil if none are configured
+	cache             *responseCache                  // Shared cache of backend responses, nil if disabled
+	methodOverride    *methodOverride                 // Honors the method override header, nil if disabled
+	readiness         *readiness                      // Readiness requirement over route health, nil if disabled
+	cors              map[string]*corsPolicy          // Cross-origin policies by route, nil if none are configured
+	signatures        map[string]*signatureVerifier   // Inbound signature verification by route, nil if none are configured
+	contentTypes      map[string][]string             // Allowed request body media types by route, nil if none are configured
+	faults            *faultInjector                  // Artificial faults injected into backend requests, nil if none are configured
+	mirrorGuard       *mirrorGuard                    // Disables shadow services over their error budget, nil if disabled
+	selectionHint     string                          // Response header backends demote their responses with, empty if disabled
+	partialHeader     string                          // Response header marking responses selected at the deadline, empty if disabled
+	headerPolicies    headerPolicies                  // Reduction of response headers carrying several values
+	onDemand          *onDemandMirror                 // Mirrors single requests to a named service on demand, nil if disabled
+	mirrorShaper      *mirrorShaper                   // Smooths shadow traffic bursts per service, nil if none are shaped
+	fanOut            map[string]config.RouteFanOut   // Parallelism of shadow requests by route name
+	deferredMirrors   *deferredMirrors                // Sends shadow requests once the primary answered, nil if disabled
+	flags             *routeFlags                     // Mirroring of routes driven by feature flags, nil if no provider is configured
+	postProcessing    *postProcessPipeline            // Sampled background checks of responses sent to clients, nil if none are configured
+	pinning           *readPinning                    // Pins reads to the backend of the client's last write, nil if disabled
+	assertions        map[string][]*responseAssertion // Contracts selected responses must satisfy by route, nil if none are configured
+	config            *config.Config                  // Reference to configuration
+	served            *config.Config                  // Configuration with the services currently routed, replaced on reload
+	snapshots         *configSnapshots                // Applied configurations kept for rollback, nil if disabled
+	retired           *retiredRoutes                  // Services removed by reloads within their grace period, nil if none
 }
 
 // NewConductor creates a new Conductor with the provided configuration
@@ -34,14 +85,34 @@ func NewConductor(cfg *config.Config) *Conductor {
 		services:       make([]*Service, len(cfg.Services)),
 		client:         client,
 		timeout:        timeout,
+		attemptTimeout: time.Duration(cfg.AttemptTimeout) * time.Second,
+		handlerTimeout: time.Duration(cfg.HandlerTimeout) * time.Second,
 		routesByPrefix: make(map[string][]*Service),
 		routesByExact:  make(map[string][]*Service),
 		routesByPath:   make(map[string][]*Service),
+		failover:       make(map[string][]*Service),
 		config:         cfg,
+		served:         cfg,
+	}
+
+	// Resolve backend hostnames through the DNS cache if enabled
+	if cfg.DNS.Enabled {
+		conductor.dnsCache = newDNSCache(
+			time.Duration(cfg.DNS.TTL)*time.Second,
+			time.Duration(cfg.DNS.NegativeTTL)*time.Second,
+			conductor.recordDNSFailure,
+		)
+		conductor.transport = newCachingTransport(conductor.dnsCache)
+		conductor.client.Transport = conductor.transport
 	}
 
 	// Initialize services
-	conductor.initializeServices(cfg.Services)
+	if err := conductor.initializeServices(cfg.Services, nil); err != nil {
+		logger.Fatal("Invalid service", err)
+	}
+	if err := conductor.initializeFailover(cfg.Failover); err != nil {
+		logger.Fatal("Invalid failover", err)
+	}
 
 	// Setup metrics if enabled
 	if cfg.Metrics.Enabled {
@@ -51,9 +122,266 @@ func NewConductor(cfg *config.Config) *Conductor {
 		// Initialize Prometheus metrics if configured
 		if cfg.Metrics.EnablePrometheus {
 			WithPrometheusMetrics(conductor)
+			conductor.trackConnections()
+		}
+	}
+
+	// Coalesce concurrent requests sharing an idempotency key if enabled
+	if cfg.Dedup.Enabled {
+		deduper, err := newRequestDeduper(cfg.Dedup, cfg.Auth)
+		if err != nil {
+			logger.Fatal("Invalid dedup identity", err)
+		}
+		conductor.deduper = deduper
+	}
+
+	// Compare shadow responses with the primary in the background if enabled
+	if cfg.Comparison.Enabled {
+		rules, pairs, err := newComparisonRules(cfg.Comparison)
+		if err != nil {
+			logger.Fatal("Invalid comparison normalization", err)
+		}
+		conductor.comparison = newComparisonPipeline(cfg.Comparison.Workers, cfg.Comparison.QueueSize,
+			rules, pairs, newBodySampler(cfg.Comparison.Sampling, rules.normalizer), conductor.recordComparison)
+	}
+
+	// Send shadow requests from a background queue once the primary answered if enabled
+	if cfg.DeferredMirrors.Enabled {
+		conductor.deferredMirrors = newDeferredMirrors(cfg.DeferredMirrors, conductor.sendDeferredMirrors)
+	}
+
+	// Check a sample of the responses sent to clients in the background if configured
+	if len(cfg.PostProcessing.Processors) > 0 {
+		pipeline, err := newPostProcessPipeline(cfg.PostProcessing, conductor.services,
+			conductor.recordPostProcess, postProcessNotifier(cfg.PostProcessing.Webhook))
+		if err != nil {
+			logger.Fatal("Invalid post-processing", err)
+		}
+		conductor.postProcessing = pipeline
+	}
+
+	// Throttle request and response bodies on configured routes
+	if len(cfg.Bandwidth) > 0 {
+		conductor.bandwidth = newBandwidthLimiters(cfg.Bandwidth)
+	}
+
+	// Track rolling latency percentiles and SLO burn rates if enabled
+	if cfg.SLO.Enabled {
+		conductor.sloTracker = newSLOTracker(cfg.SLO)
+		if conductor.prometheusMetrics != nil {
+			conductor.prometheusMetrics.RegisterSLOTracker(conductor.sloTracker)
+		}
+	}
+
+	// Adapt the attempt timeouts of primaries to each route's observed latency if enabled
+	if cfg.AdaptiveTimeout.Enabled {
+		conductor.adaptiveTimeouts = newAdaptiveTimeouts(cfg.AdaptiveTimeout)
+	}
+
+	// Check requests against per-route size and latency budgets
+	if len(cfg.Budgets) > 0 {
+		conductor.budgets = make(map[string]config.RouteBudget)
+		for _, budget := range cfg.Budgets {
+			conductor.budgets[budget.Route] = budget
+		}
+	}
+
+	// Require authentication on configured routes
+	if len(cfg.Auth.Routes) > 0 {
+		auth, err := newRouteAuth(cfg.Auth)
+		if err != nil {
+			logger.Fatal("Invalid auth configuration", err)
+		}
+		conductor.auth = auth
+	}
+
+	// Answer cross-origin browser requests on configured routes
+	if len(cfg.CORS) > 0 {
+		conductor.cors = newCORSPolicies(cfg.CORS)
+	}
+
+	// Let POST-only clients declare the intended method if enabled
+	if cfg.MethodOverride.Enabled {
+		conductor.methodOverride = newMethodOverride(cfg.MethodOverride)
+	}
+
+	// Restrict request body content types on configured routes
+	if len(cfg.ContentTypes) > 0 {
+		conductor.contentTypes = newContentTypeAllowlists(cfg.ContentTypes)
+	}
+
+	// Verify signed requests on configured routes
+	if len(cfg.Signatures) > 0 {
+		signatures, err := newSignatureVerifiers(cfg.Signatures)
+		if err != nil {
+			logger.Fatal("Invalid signature configuration", err)
+		}
+		conductor.signatures = signatures
+	}
+
+	// Reject requests looping back to this conductor if enabled
+	if cfg.LoopDetection.Enabled {
+		conductor.loops = newLoopDetector(cfg.LoopDetection)
+	}
+
+	// Cache backend responses if enabled
+	if cfg.Cache.Enabled {
+		conductor.cache = newResponseCache(cfg.Cache)
+	}
+
+	// Cache the services matched by hot paths if enabled
+	if cfg.RouteCache.Enabled {
+		conductor.routeCache = newRouteCache(cfg.RouteCache.MaxEntries)
+	}
+
+	// Log every answered request to the access log if enabled
+	if cfg.AccessLog.Enabled {
+		accessLog, err := newAccessLog(cfg.AccessLog)
+		if err != nil {
+			logger.Fatal("Failed to open access log", err)
+		}
+		conductor.accessLog = accessLog
+	}
+
+	// Describe the conductor's decisions in headers to backends and clients if enabled
+	conductor.annotations = newAnnotations(cfg.Annotations)
+
+	// Export mirrored requests and their responses if enabled
+	if cfg.Capture.Enabled {
+		capture, err := newCaptureSink(cfg.Capture)
+		if err != nil {
+			logger.Fatal("Failed to create capture directory", err)
+		}
+		conductor.capture = capture
+	}
+
+	// Account usage per tenant if enabled
+	if cfg.Quota.Enabled {
+		quotas, err := newQuotaTracker(cfg.Quota, cfg.Auth)
+		if err != nil {
+			logger.Fatal("Invalid quota identity", err)
+		}
+		if cfg.Quota.Identity == nil && cfg.Quota.Mode == quotaModeEnforce {
+			logger.WarnWithFields("Quota tenants are taken from a header clients set themselves; set quota.identity unless a trusted edge sets the header", map[string]interface{}{
+				"header": cfg.Quota.Header,
+			})
+		}
+		conductor.quotas = quotas
+	}
+
+	// Allow pausing mirroring at runtime through the admin endpoints if enabled
+	if cfg.Admin.Enabled {
+		conductor.mirrorPauses = newMirrorPauses()
+		conductor.serviceOverrides = newServiceOverrides()
+		conductor.freezes = newRouteFreezes()
+	}
+
+	// Keep the applied configurations for rollback through the admin endpoints if enabled
+	if cfg.Admin.Enabled && cfg.Reload.History > 0 {
+		snapshots, err := newConfigSnapshots(cfg.Reload)
+		if err != nil {
+			logger.Fatal("Failed to load configuration snapshots", err)
+		}
+		snapshots.Record(cfg, snapshotStartup)
+		conductor.snapshots = snapshots
+	}
+
+	// Disable mirroring to shadow services exceeding their error budget if enabled
+	if cfg.MirrorGuard.Enabled {
+		conductor.mirrorGuard = newMirrorGuard(cfg.MirrorGuard, mirrorGuardNotifier(cfg.MirrorGuard.Webhook))
+	}
+
+	// Let backends demote their own responses in selection if enabled
+	if cfg.SelectionHints.Enabled {
+		conductor.selectionHint = cfg.SelectionHints.Header
+	}
+
+	// Answer with the best response received when the deadline expires if enabled
+	if cfg.PartialResults.Enabled {
+		conductor.partialHeader = cfg.PartialResults.Header
+	}
+
+	// Reduce conflicting response header values before they reach clients
+	conductor.headerPolicies = newHeaderPolicies(cfg.ResponseHeaders)
+
+	// Let authorized clients mirror single requests to a named service if enabled
+	if cfg.OnDemandMirror.Enabled {
+		onDemand, err := newOnDemandMirror(cfg.OnDemandMirror, cfg.Auth)
+		if err != nil {
+			logger.Fatal("Invalid on-demand mirror", err)
+		}
+		conductor.onDemand = onDemand
+	}
+
+	// Smooth bursts of shadow traffic toward shaped services
+	if len(cfg.MirrorShaping) > 0 {
+		shaper, err := newMirrorShaper(cfg.MirrorShaping, conductor.services)
+		if err != nil {
+			logger.Fatal("Invalid mirror shaping", err)
+		}
+		conductor.mirrorShaper = shaper
+	}
+
+	// Bound the shadow requests of hot routes in flight at once
+	if len(cfg.FanOut) > 0 {
+		fanOut, err := newFanOutLimits(cfg.FanOut, conductor.services)
+		if err != nil {
+			logger.Fatal("Invalid fan-out limits", err)
+		}
+		conductor.fanOut = fanOut
+	}
+
+	// Govern access to routes with static rules or a policy engine if configured
+	if len(cfg.Authz) > 0 {
+		authorizers, err := newRouteAuthorizers(cfg.Authz, cfg.Auth, conductor.services)
+		if err != nil {
+			logger.Fatal("Invalid route authorizers", err)
+		}
+		conductor.authorizers = authorizers
+	}
+
+	// Drive mirroring of routes from the feature flag provider if configured
+	if cfg.Flags.Provider != "" {
+		if err := WithFlagProvider(conductor, NewOpenFeatureProvider(cfg.Flags.URL, cfg.Flags.Headers)); err != nil {
+			logger.Fatal("Invalid flags configuration", err)
 		}
 	}
 
+	// Pin reads to the backend of the client's last write if enabled
+	if cfg.ReadYourWrites.Enabled {
+		conductor.pinning = newReadPinning(cfg.ReadYourWrites)
+	}
+
+	// Monitor selected responses against per-route assertions
+	if len(cfg.Assertions) > 0 {
+		assertions, err := newResponseAssertions(cfg.Assertions)
+		if err != nil {
+			logger.Fatal("Invalid response assertion", err)
+		}
+		conductor.assertions = assertions
+	}
+
+	// Decide readiness from the health of the routes it depends on if enabled
+	if cfg.Readiness.Enabled {
+		readiness, err := newReadiness(cfg.Readiness, conductor.services)
+		if err != nil {
+			logger.Fatal("Invalid readiness requirement", err)
+		}
+		conductor.readiness = readiness
+	}
+
+	// Inject artificial faults into backend requests if configured
+	if len(cfg.Faults.Rules) > 0 {
+		faults, err := newFaultInjector(cfg.Faults, conductor.services)
+		if err != nil {
+			logger.Fatal("Invalid fault injection", err)
+		}
+		conductor.faults = faults
+	}
+
+	// Actively probe services with a health check configured
+	conductor.startHealthChecks()
+
 	return conductor
 }
 
@@ -61,104 +389,310 @@ func NewConductor(cfg *config.Config) *Conductor {
 func (c *Conductor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	requestStart := time.Now()
 
+	// Tag the request so errors and upstream logs can be correlated
+	ensureRequestID(r)
+	traceID := traceIDFromRequest(r)
+
+	// Log the request to the access log once it has been answered
+	w, r, logAccess := c.startAccessLog(w, r, requestStart)
+	defer logAccess()
+
+	// Bound reading the body by the handler timeout, so slow clients are cut off early
+	liftReadLimit := c.limitBodyRead(w, requestStart)
+	defer liftReadLimit()
+
+	// Shed load once the global in-flight cap is reached
+	if !c.admit() {
+		c.handleOverloaded(w, r, requestStart, traceID)
+		return
+	}
+	defer c.inFlight.Add(-1)
+
+	// Reject requests that already passed through this conductor
+	if c.loops != nil && c.loops.Looped(r) {
+		c.handleLoopDetected(w, r, requestStart, traceID)
+		return
+	}
+
+	// Reject pathological header sets before they reach any backend
+	if !c.checkHeaderLimits(r) {
+		c.handleHeadersTooLarge(w, r, requestStart, traceID)
+		return
+	}
+
+	// Account the request to its tenant, rejecting tenants over quota when enforced
+	w, recordUsage := c.accountQuota(w, r)
+	if recordUsage == nil {
+		c.handleQuotaExceeded(w, r, requestStart, traceID)
+		return
+	}
+	defer recordUsage()
+
 	// Track in-flight requests for Prometheus if enabled
 	if c.prometheusMetrics != nil {
 		c.prometheusMetrics.RequestStarted()
 		defer c.prometheusMetrics.RequestFinished()
 	}
 
+	// Route and mirror overridden requests as the method they stand for
+	if c.methodOverride != nil {
+		c.methodOverride.Apply(r)
+	}
+
 	// Find matching services
 	services := c.findMatchingServices(r)
+	r, services = c.routeByMatch(r, services)
+	if filtered := filterForMethod(services, r.Method); len(filtered) != len(services) {
+		logger.DebugWithFields("Skipping mirrors for non-idempotent method", map[string]interface{}{
+			"method":   r.Method,
+			"path":     r.URL.Path,
+			"services": getServiceNames(filtered),
+		})
+		services = filtered
+	}
 	if len(services) == 0 {
 		c.handleNoServiceFound(w, r)
 
 		// Record not found error in Prometheus metrics
 		if c.prometheusMetrics != nil {
-			c.prometheusMetrics.RecordError("none", "no_service_found")
-			c.prometheusMetrics.RecordRequest("none", r.Method, "404", time.Since(requestStart))
+			c.prometheusMetrics.RecordError("none", "none", "no_service_found")
+			c.prometheusMetrics.RecordRequest("none", "none", r.Method, "404", time.Since(requestStart), traceID)
 		}
 
 		// Record metrics for legacy collector
 		if c.metrics != nil {
-			c.RecordMetrics(requestStart, true)
+			c.RecordMetrics("none", requestStart, true)
 		}
 		return
 	}
 
+	// Label metrics with the user-facing route the request matched
+	route := services[0].Route
+
+	// Answer CORS preflights before authentication, since browsers send them without credentials
+	w, preflight := c.applyCORS(w, r, route)
+	if preflight {
+		c.recordPreflight(r, route, requestStart, traceID)
+		return
+	}
+
+	// Reject requests that do not satisfy the route's authentication requirement
+	if !c.authorize(route, r) {
+		c.handleUnauthorized(w, r, route, requestStart, traceID)
+		return
+	}
+
+	// Reject requests the route's authorizer denies
+	if decision := c.authorizeAccess(route, r); !decision.Allow {
+		c.handleForbidden(w, r, route, decision, requestStart, traceID)
+		return
+	}
+
+	// Fail over to the remote cluster if every local service is unhealthy
+	services = c.applyFailover(route, r.Method, services)
+
+	// Tunnel WebSocket connections to the primary, since their frames are not mirrored
+	if isWebSocketUpgrade(r) {
+		c.proxyWebSocket(w, r, route, services, requestStart, traceID)
+		return
+	}
+
+	// Send only to the primary while mirroring is paused for the route
+	services = c.skipPausedMirrors(route, services)
+
+	// Send only to the primary when the route's feature flags turn mirroring off
+	services = c.skipFlaggedMirrors(route, services)
+
+	// Leave out shadow services the mirror guard disabled for exceeding their error budget
+	services = c.skipDisabledMirrors(services)
+
+	// Send to services mirroring a share of the route's traffic only if the request is sampled
+	services = skipUnsampledMirrors(r, services)
+
+	// Send reads to the backend that handled the client's last write
+	r, services = c.applyPin(route, r, services)
+
+	// Add the service an authorized client asked this request to be mirrored to
+	r, services = c.applyOnDemandMirror(w, r, services)
+
+	// Apply the route's bandwidth limits to the request and response bodies
+	w = c.throttle(w, r, route)
+
 	logger.InfoWithFields(fmt.Sprintf("Found %d matching service(s)", len(services)), map[string]interface{}{
 		"method":        r.Method,
 		"path":          r.URL.Path,
+		"route":         route,
 		"service_count": len(services),
 		"services":      getServiceNames(services),
 	})
 
-	// Create a context with the configured timeout
+	// Answer from the cache when the entry is fresh or may be served stale, otherwise
+	// revalidate a stale entry with the backend that produced it. Entries without
+	// validators are fetched again in full, so the request is compared as usual.
+	cached, lookup := c.lookupCache(route, r)
+	if lookup != "" {
+		c.serveCached(w, r, route, cached, lookup, requestStart, traceID)
+		return
+	}
+	if cached != nil && cached.hasValidators() {
+		r = r.WithContext(context.WithValue(r.Context(), revalidationKey{}, cached))
+	}
+
+	// Reject bodies the route's backends do not accept before reading or fanning them out
+	if !c.allowedContentType(route, r) {
+		c.handleUnsupportedMediaType(w, r, route, requestStart, traceID)
+		return
+	}
+
+	// Create a context bounding the total request budget, and the conductor's own handling
 	ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
 	defer cancel()
+	ctx, cancelHandler := c.withHandlerTimeout(ctx, requestStart)
+	defer cancelHandler()
 
 	// Read the body once so we can send it to multiple services
 	requestBody, err := c.readRequestBody(r)
+	liftReadLimit()
+	if err != nil && c.handlerTimeout > 0 && isTimeoutError(err) {
+		c.handleRequestTimeout(w, r, route, requestStart, traceID)
+		return
+	}
 	if err != nil {
 		logger.ErrorWithFields("Failed to read request body", err, map[string]interface{}{
 			"method": r.Method,
 			"path":   r.URL.Path,
 		})
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, ErrCodeReadBodyFailed, "Failed to read request body")
 
 		// Record error in Prometheus metrics
 		if c.prometheusMetrics != nil {
-			c.prometheusMetrics.RecordError("conductor", "read_body_failed")
-			c.prometheusMetrics.RecordRequest("conductor", r.Method, "500", time.Since(requestStart))
+			c.prometheusMetrics.RecordError("conductor", route, "read_body_failed")
+			c.prometheusMetrics.RecordRequest("conductor", route, r.Method, "500", time.Since(requestStart), traceID)
 		}
 
 		// Record metrics for legacy collector
 		if c.metrics != nil {
-			c.RecordMetrics(requestStart, true)
+			c.RecordMetrics(route, requestStart, true)
 		}
+		c.recordSLO(route, http.StatusInternalServerError, time.Since(requestStart))
 		return
 	}
 
-	// Fan out requests to all matching services
-	resultChan := c.fanOutRequests(ctx, services, r, requestBody)
+	// Reject request bodies over the route's budget when it is enforced
+	if !c.checkRequestBudget(route, r, requestBody.Len()) {
+		requestBody.Close()
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Request body exceeds the route's size budget")
+
+		// Record error in Prometheus metrics
+		if c.prometheusMetrics != nil {
+			c.prometheusMetrics.RecordError("conductor", route, "request_budget_exceeded")
+			c.prometheusMetrics.RecordRequest("conductor", route, r.Method, "413", time.Since(requestStart), traceID)
+		}
+
+		// Record metrics for legacy collector
+		if c.metrics != nil {
+			c.RecordMetrics(route, requestStart, true)
+		}
+		c.recordSLO(route, http.StatusRequestEntityTooLarge, time.Since(requestStart))
+		return
+	}
+
+	// Reject forged requests to routes that verify signatures before any backend sees them
+	if !c.verifySignature(route, r, requestBody) {
+		requestBody.Close()
+		c.handleInvalidSignature(w, r, route, requestStart, traceID)
+		return
+	}
+
+	// Fan out requests to all matching services and select the appropriate response
+	resultToUse, failure := c.proxyRequest(ctx, services, r, requestBody)
+	defer resultToUse.closeStream()
+
+	// The client went away, so nobody will read the response
+	if r.Context().Err() != nil {
+		c.handleClientCanceled(r, route, requestStart)
+		return
+	}
+
+	// Report how the on-demand mirror compared with the response
+	c.reportOnDemandMirror(ctx, w, r, resultToUse)
+
+	// Serve a stale cached response rather than an error if the route allows it
+	if resultToUse == nil && c.serveStaleOnError(w, r, route, cached, requestStart, traceID) {
+		return
+	}
 
-	// Process results and select the appropriate response
-	resultToUse := c.processResults(resultChan, r)
 	if resultToUse == nil {
-		logger.ErrorWithFields("All services failed", nil, map[string]interface{}{
-			"method": r.Method,
-			"path":   r.URL.Path,
+		status := c.failureStatus(failure)
+		if handlerTimedOut(ctx) {
+			// The conductor ran out of its own budget before the upstream one
+			status = http.StatusServiceUnavailable
+		}
+		logger.ErrorWithFields("All services failed", failure, map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status_code": status,
 		})
-		http.Error(w, "All services failed", http.StatusBadGateway)
+
+		errorType := "all_services_failed"
+		if handlerTimedOut(ctx) {
+			errorType = "handler_timeout"
+			writeError(w, r, status, ErrCodeHandlerTimeout, "Request not handled in time")
+		} else if isTimeoutError(failure) {
+			errorType = "all_services_timed_out"
+			writeError(w, r, status, ErrCodeUpstreamTimeout, "All services timed out")
+		} else {
+			writeError(w, r, status, ErrCodeUpstreamFailed, "All services failed")
+		}
 
 		// Record error in Prometheus metrics
 		if c.prometheusMetrics != nil {
-			c.prometheusMetrics.RecordError("all", "all_services_failed")
-			c.prometheusMetrics.RecordRequest("all", r.Method, "502", time.Since(requestStart))
+			c.prometheusMetrics.RecordError("all", route, errorType)
+			c.prometheusMetrics.RecordRequest("all", route, r.Method, fmt.Sprintf("%d", status), time.Since(requestStart), traceID)
 		}
 
 		// Record metrics for legacy collector
 		if c.metrics != nil {
-			c.RecordMetrics(requestStart, true)
+			c.RecordMetrics(route, requestStart, true)
 		}
+		c.recordSLO(route, status, time.Since(requestStart))
+		return
+	}
+
+	// Check the response against the route's contract, rejecting it if an assertion says so
+	if assertion := c.checkAssertions(route, r, resultToUse); assertion != nil {
+		c.handleAssertionFailed(w, r, route, assertion, requestStart, traceID)
 		return
 	}
 
+	// Pin the client's next reads to the backend that handled this write
+	c.pinWrite(w, r, route, resultToUse)
+
+	// Update the cache and answer conditional requests from it
+	resultToUse = c.cacheResult(route, r, cached, resultToUse)
+
 	// Send the response back to the client
 	c.writeResponse(w, resultToUse, r, requestStart)
 
+	// Check a sample of the response in the background
+	c.submitPostProcessing(route, resultToUse)
+
 	// Record successful request in Prometheus metrics
 	if c.prometheusMetrics != nil {
 		status := fmt.Sprintf("%d", resultToUse.resp.StatusCode)
 		c.prometheusMetrics.RecordRequest(
 			resultToUse.service.Name,
+			route,
 			r.Method,
 			status,
 			time.Since(requestStart),
+			traceID,
 		)
 	}
 
 	// Record metrics for legacy collector
 	if c.metrics != nil {
-		c.RecordMetrics(requestStart, false)
+		c.RecordMetrics(route, requestStart, false)
 	}
+	c.recordSLO(route, resultToUse.resp.StatusCode, time.Since(requestStart))
 }
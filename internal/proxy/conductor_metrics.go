@@ -1,6 +1,8 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"time"
 )
 
@@ -10,13 +12,22 @@ func WithMetrics(c *Conductor) *Conductor {
 	return c
 }
 
-// RecordMetrics records metrics for a request
-func (c *Conductor) RecordMetrics(start time.Time, hasError bool) {
+// RecordMetrics records metrics for a request to the given route
+func (c *Conductor) RecordMetrics(route string, start time.Time, hasError bool) {
 	if c.metrics == nil {
 		return
 	}
 	duration := time.Since(start)
-	c.metrics.RecordRequest(duration, hasError)
+	c.metrics.RecordRequest(route, duration, hasError)
+}
+
+// recordServiceMetrics records metrics for an attempt to the service. Attempts canceled
+// once the client was answered are not counted, as the service did not fail them.
+func (c *Conductor) recordServiceMetrics(svc *Service, result *serviceResult) {
+	if c.metrics == nil || errors.Is(result.err, context.Canceled) {
+		return
+	}
+	c.metrics.RecordServiceRequest(svc.Name, result.duration, result.err != nil || result.resp.StatusCode >= 500)
 }
 
 // GetMetrics returns the metrics collector for this conductor
@@ -2,9 +2,12 @@ package proxy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -154,7 +157,7 @@ func TestCreateTargetURL(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			req := httptest.NewRequest("GET", "http://example.com"+test.path, nil)
 			service := conductor.services[test.serviceIndex]
-			targetURL := conductor.createTargetURL(service, req)
+			targetURL := conductor.createTargetURL(service, req, nil)
 
 			if !strings.Contains(targetURL, test.expectedContain) {
 				t.Errorf("Expected URL to contain %s, got %s", test.expectedContain, targetURL)
@@ -226,7 +229,7 @@ func TestServeHTTP(t *testing.T) {
 			name:         "no match",
 			path:         "/unknown",
 			expectStatus: 404,
-			expectBody:   "No service found for request\n",
+			expectBody:   `"code":"no_route"`,
 		},
 	}
 
@@ -251,3 +254,555 @@ func TestServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+// recordingTransport records each outgoing request
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.requests = append(rt.requests, req)
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("ok")),
+	}, nil
+}
+
+// TestPreserveHost tests that the client Host header is forwarded when configured
+func TestPreserveHost(t *testing.T) {
+	tests := []struct {
+		name         string
+		preserveHost bool
+		expectHost   string
+	}{
+		{
+			name:         "backend host by default",
+			preserveHost: false,
+			expectHost:   "backend.example.com",
+		},
+		{
+			name:         "client host when preserved",
+			preserveHost: true,
+			expectHost:   "client.example.com",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{
+						Name:         "vhost-service",
+						URL:          "http://backend.example.com",
+						PathPrefix:   "/",
+						Primary:      true,
+						PreserveHost: test.preserveHost,
+					},
+				},
+			}
+			conductor := NewConductor(cfg)
+			transport := &recordingTransport{}
+			conductor.client = &http.Client{Transport: transport}
+
+			req := httptest.NewRequest("GET", "http://client.example.com/resource", nil)
+			result := conductor.makeServiceRequest(context.Background(), conductor.services[0], req, nil)
+			if result.err != nil {
+				t.Fatalf("Expected no error, but got: %v", result.err)
+			}
+
+			if len(transport.requests) != 1 {
+				t.Fatalf("Expected 1 upstream request, got %d", len(transport.requests))
+			}
+			if host := transport.requests[0].Host; host != test.expectHost {
+				t.Errorf("Expected upstream host %s, got %s", test.expectHost, host)
+			}
+		})
+	}
+}
+
+// errorTransport fails every request with the configured error
+type errorTransport struct {
+	err error
+}
+
+func (e *errorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, e.err
+}
+
+// TestUpstreamFailureStatus tests that timeouts and connection errors map to distinct statuses
+func TestUpstreamFailureStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		mapping      config.ErrorMappingConfig
+		expectStatus int
+	}{
+		{
+			name:         "timeout",
+			err:          context.DeadlineExceeded,
+			expectStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:         "connection error",
+			err:          errors.New("connection refused"),
+			expectStatus: http.StatusBadGateway,
+		},
+		{
+			name:         "configured timeout status",
+			err:          context.DeadlineExceeded,
+			mapping:      config.ErrorMappingConfig{Timeout: 503},
+			expectStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:         "configured connection status",
+			err:          errors.New("connection refused"),
+			mapping:      config.ErrorMappingConfig{Connection: 503},
+			expectStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{
+						Name:       "failing-service",
+						URL:        "http://failing.example.com",
+						PathPrefix: "/",
+						Primary:    true,
+					},
+				},
+				ErrorMapping: test.mapping,
+			}
+			conductor := NewConductor(cfg)
+			conductor.client = &http.Client{Transport: &errorTransport{err: test.err}}
+
+			req := httptest.NewRequest("GET", "http://example.com/resource", nil)
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != test.expectStatus {
+				t.Errorf("Expected status %d, got %d", test.expectStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+// TestDeadlineHeader tests that the remaining budget is propagated to backends
+func TestDeadlineHeader(t *testing.T) {
+	cfg := &config.Config{
+		Timeout:        10,
+		AttemptTimeout: 2,
+		DeadlineHeader: "X-Request-Deadline",
+		Services: []config.Service{
+			{
+				Name:       "deadline-service",
+				URL:        "http://deadline.example.com",
+				PathPrefix: "/",
+				Primary:    true,
+			},
+		},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	req := httptest.NewRequest("GET", "http://example.com/resource", nil)
+	req.Header.Set("X-Request-Deadline", "999999")
+	recorder := httptest.NewRecorder()
+	conductor.ServeHTTP(recorder, req)
+
+	if len(transport.requests) != 1 {
+		t.Fatalf("Expected 1 upstream request, got %d", len(transport.requests))
+	}
+
+	// The attempt timeout is tighter than the total budget, so it bounds the header
+	remaining, err := strconv.Atoi(transport.requests[0].Header.Get("X-Request-Deadline"))
+	if err != nil {
+		t.Fatalf("Expected numeric deadline header, got error: %v", err)
+	}
+	if remaining <= 0 || remaining > 2000 {
+		t.Errorf("Expected remaining budget within attempt timeout, got %dms", remaining)
+	}
+}
+
+// TestDeadlineHeaderBudget tests that per-service headers carry the route budget minus the margin
+func TestDeadlineHeaderBudget(t *testing.T) {
+	cfg := &config.Config{
+		Timeout:          10,
+		DeadlineMarginMs: 100,
+		Services: []config.Service{
+			{
+				Name:           "timeout-service",
+				URL:            "http://timeout.example.com",
+				PathPrefix:     "/",
+				Primary:        true,
+				DeadlineHeader: "X-Timeout-Ms",
+			},
+		},
+		Budgets: []config.RouteBudget{{Route: "/", MaxLatencyMs: 500, Action: "log"}},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	recorder := httptest.NewRecorder()
+	conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/resource", nil))
+
+	if len(transport.requests) != 1 {
+		t.Fatalf("Expected 1 upstream request, got %d", len(transport.requests))
+	}
+	remaining, err := strconv.Atoi(transport.requests[0].Header.Get("X-Timeout-Ms"))
+	if err != nil {
+		t.Fatalf("Expected numeric timeout header, got error: %v", err)
+	}
+	if remaining != 400 {
+		t.Errorf("Expected the latency budget minus the margin, got %dms", remaining)
+	}
+}
+
+// TestFilterForMethod tests that unsafe methods are only mirrored to opted-in services
+func TestFilterForMethod(t *testing.T) {
+	primary := &Service{Name: "primary", Primary: true}
+	shadow := &Service{Name: "shadow"}
+	optedIn := &Service{Name: "opted-in", Config: config.Service{MirrorUnsafeMethods: true}}
+
+	tests := []struct {
+		name     string
+		method   string
+		services []*Service
+		expected []string
+	}{
+		{
+			name:     "safe method mirrors to all",
+			method:   http.MethodGet,
+			services: []*Service{primary, shadow, optedIn},
+			expected: []string{"primary", "shadow", "opted-in"},
+		},
+		{
+			name:     "unsafe method skips shadow",
+			method:   http.MethodPost,
+			services: []*Service{primary, shadow, optedIn},
+			expected: []string{"primary", "opted-in"},
+		},
+		{
+			name:     "unsafe method without primary uses first service",
+			method:   http.MethodDelete,
+			services: []*Service{shadow, {Name: "other"}},
+			expected: []string{"shadow"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := getServiceNames(filterForMethod(test.services, test.method))
+			if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("Expected services %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+// blockingTransport waits until the outgoing request is canceled
+type blockingTransport struct{}
+
+func (b *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+// TestClientCanceled tests that upstream requests are abandoned when the client disconnects
+func TestClientCanceled(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 30,
+		Services: []config.Service{
+			{
+				Name:       "slow-primary",
+				URL:        "http://slow-primary.example.com",
+				PathPrefix: "/",
+				Primary:    true,
+			},
+			{
+				Name:       "slow-shadow",
+				URL:        "http://slow-shadow.example.com",
+				PathPrefix: "/",
+			},
+		},
+	}
+	conductor := WithMetrics(NewConductor(cfg))
+	conductor.client = &http.Client{Transport: &blockingTransport{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "http://example.com/resource", nil).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan struct{})
+	go func() {
+		conductor.ServeHTTP(recorder, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeHTTP did not return after the client canceled")
+	}
+
+	if recorder.Body.Len() != 0 {
+		t.Errorf("Expected no response body for canceled client, got: %s", recorder.Body.String())
+	}
+
+	if errCount := conductor.GetMetrics().GetErrorCount(); errCount != 1 {
+		t.Errorf("Expected canceled request to be recorded, got error count %d", errCount)
+	}
+}
+
+// TestErrorResponse tests that conductor errors use the JSON envelope with the request ID
+func TestErrorResponse(t *testing.T) {
+	conductor := createTestConductor()
+
+	req := httptest.NewRequest("GET", "http://example.com/unknown", nil)
+	req.Header.Set("X-Request-ID", "test-request-id")
+	recorder := httptest.NewRecorder()
+	conductor.ServeHTTP(recorder, req)
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", contentType)
+	}
+	if requestID := recorder.Header().Get("X-Request-ID"); requestID != "test-request-id" {
+		t.Errorf("Expected request ID header to be echoed, got %s", requestID)
+	}
+
+	var data ErrorResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&data); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+
+	if data.Code != ErrCodeNoRoute {
+		t.Errorf("Expected code %s, got %s", ErrCodeNoRoute, data.Code)
+	}
+	if data.Status != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, data.Status)
+	}
+	if data.RequestID != "test-request-id" {
+		t.Errorf("Expected request ID test-request-id, got %s", data.RequestID)
+	}
+}
+
+// TestViaAndUserAgent tests the Via header on both hops and per-service User-Agent overrides
+func TestViaAndUserAgent(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true, UserAgent: "conductor-test/1.0"},
+		},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+	req.Header.Set("Via", "1.1 edge")
+	req.Header.Set("User-Agent", "curl/8.0")
+	recorder := httptest.NewRecorder()
+	conductor.ServeHTTP(recorder, req)
+
+	upstream := transport.requests[0]
+	if via := upstream.Header.Get("Via"); via != "1.1 edge, 1.1 go-conductor/dev" {
+		t.Errorf("Expected Via to append this hop, got %q", via)
+	}
+	if ua := upstream.Header.Get("User-Agent"); ua != "conductor-test/1.0" {
+		t.Errorf("Expected configured User-Agent, got %q", ua)
+	}
+	if via := recorder.Header().Get("Via"); via != "1.1 go-conductor/dev" {
+		t.Errorf("Expected Via on the response, got %q", via)
+	}
+}
+
+// TestSelectionHints tests that responses demoted by their backend lose to healthy peers
+func TestSelectionHints(t *testing.T) {
+	result := func(name string, primary bool, prefer string) *serviceResult {
+		header := http.Header{}
+		if prefer != "" {
+			header.Set("X-Conductor-Prefer", prefer)
+		}
+		return &serviceResult{service: &Service{Name: name, Primary: primary}, resp: &http.Response{StatusCode: 200, Header: header}}
+	}
+
+	tests := []struct {
+		name    string
+		results []*serviceResult
+		want    string
+	}{
+		{name: "primary without hint", results: []*serviceResult{result("primary", true, ""), result("peer", false, "")}, want: "primary"},
+		{name: "demoted primary", results: []*serviceResult{result("primary", true, "false"), result("peer", false, "")}, want: "peer"},
+		{name: "demoted primary after peer", results: []*serviceResult{result("peer", false, ""), result("primary", true, "0")}, want: "peer"},
+		{name: "explicitly preferred", results: []*serviceResult{result("primary", true, "true"), result("peer", false, "")}, want: "primary"},
+		{name: "all demoted", results: []*serviceResult{result("peer", false, "false"), result("primary", true, "false")}, want: "primary"},
+		{name: "demoted peer and failed primary", results: []*serviceResult{
+			result("peer", false, "no"),
+			{service: &Service{Name: "primary", Primary: true}, err: errors.New("connection refused")},
+		}, want: "peer"},
+	}
+
+	conductor := NewConductor(&config.Config{
+		Timeout:        5,
+		SelectionHints: config.SelectionHintConfig{Enabled: true, Header: "X-Conductor-Prefer"},
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := make(chan *serviceResult, len(tt.results))
+			for _, result := range tt.results {
+				results <- result
+			}
+			close(results)
+
+			selected, err := conductor.processResults(context.Background(), results, httptest.NewRequest("GET", "/api", nil))
+			if err != nil {
+				t.Fatalf("Expected a result, got %v", err)
+			}
+			if selected.service.Name != tt.want {
+				t.Errorf("Expected response from %s, got %s", tt.want, selected.service.Name)
+			}
+		})
+	}
+
+	// The hint is not passed on to clients
+	recorder := httptest.NewRecorder()
+	conductor.writeResponse(recorder, result("primary", true, "false"), httptest.NewRequest("GET", "/api", nil), time.Now())
+	if recorder.Header().Get("X-Conductor-Prefer") != "" {
+		t.Error("Expected the selection hint to be removed from the response")
+	}
+}
+
+// TestPartialResults tests that the best response received is used when the deadline
+// expires before the primary responds
+func TestPartialResults(t *testing.T) {
+	result := func(name string, primary bool, status int) *serviceResult {
+		return &serviceResult{service: &Service{Name: name, Primary: primary}, resp: &http.Response{StatusCode: status, Header: http.Header{}}}
+	}
+	timedOut := &serviceResult{service: &Service{Name: "primary", Primary: true}, err: context.DeadlineExceeded}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		name        string
+		enabled     bool
+		ctx         context.Context
+		results     []*serviceResult
+		want        string
+		wantPartial bool
+	}{
+		{name: "best peer at the deadline", enabled: true, ctx: expired,
+			results: []*serviceResult{result("failing", false, 503), result("healthy", false, 200), timedOut}, want: "healthy", wantPartial: true},
+		{name: "primary before the deadline", enabled: true, ctx: expired,
+			results: []*serviceResult{result("healthy", false, 200), result("primary", true, 200)}, want: "primary"},
+		{name: "primary failed before the deadline", enabled: true, ctx: context.Background(),
+			results: []*serviceResult{result("failing", false, 503), result("healthy", false, 200), timedOut}, want: "failing"},
+		{name: "disabled", ctx: expired,
+			results: []*serviceResult{result("failing", false, 503), result("healthy", false, 200), timedOut}, want: "failing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conductor := NewConductor(&config.Config{
+				Timeout:        5,
+				PartialResults: config.PartialResultsConfig{Enabled: tt.enabled, Header: "X-Conductor-Partial"},
+			})
+			results := make(chan *serviceResult, len(tt.results))
+			for _, result := range tt.results {
+				result.partial = false
+				results <- result
+			}
+			close(results)
+
+			selected, err := conductor.processResults(tt.ctx, results, httptest.NewRequest("GET", "/api", nil))
+			if err != nil {
+				t.Fatalf("Expected a result, got %v", err)
+			}
+			if selected.service.Name != tt.want {
+				t.Errorf("Expected response from %s, got %s", tt.want, selected.service.Name)
+			}
+
+			recorder := httptest.NewRecorder()
+			conductor.writeResponse(recorder, selected, httptest.NewRequest("GET", "/api", nil), time.Now())
+			if partial := recorder.Header().Get("X-Conductor-Partial") != ""; partial != tt.wantPartial {
+				t.Errorf("Expected partial header %v, got %v", tt.wantPartial, partial)
+			}
+		})
+	}
+}
+
+// TestBackgroundMirror tests that mirrors neither delay nor answer the client, and
+// complete after the response was sent
+func TestBackgroundMirror(t *testing.T) {
+	const mirrorDelay = 300 * time.Millisecond
+	mirrored := make(chan error, 2)
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(mirrorDelay):
+			w.Write([]byte("mirror"))
+			mirrored <- nil
+		case <-r.Context().Done():
+			mirrored <- r.Context().Err()
+		}
+	}))
+	defer mirror.Close()
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name       string
+		primaryURL string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "primary answers", primaryURL: primary.URL, wantStatus: http.StatusOK, wantBody: "primary"},
+		{name: "primary fails", primaryURL: down.URL, wantStatus: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conductor := NewConductor(&config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "api", URL: tt.primaryURL, PathPrefix: "/api", Primary: true},
+					{Name: "api-next", URL: mirror.URL, PathPrefix: "/api", Mirror: true, MirrorTimeout: 2},
+				},
+			})
+
+			start := time.Now()
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/users", nil))
+			if elapsed := time.Since(start); elapsed >= mirrorDelay {
+				t.Errorf("Expected the response before the mirror finished, took %v", elapsed)
+			}
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantBody != "" && recorder.Body.String() != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, recorder.Body.String())
+			}
+
+			select {
+			case err := <-mirrored:
+				if err != nil {
+					t.Errorf("Expected the mirror request to complete, got %v", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Error("Mirror request never arrived")
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Connection phases timed by the client trace
+const (
+	connPhaseDNS     = "dns"
+	connPhaseConnect = "connect"
+	connPhaseTLS     = "tls"
+)
+
+// connServiceKey carries the name of the service a backend connection is dialed for
+type connServiceKey struct{}
+
+// trackedConn is a backend connection that reports its age when it is closed
+type trackedConn struct {
+	net.Conn
+	opened    time.Time
+	closeOnce sync.Once
+	onClose   func(age time.Duration)
+}
+
+// Close closes the connection, reporting it the first time
+func (t *trackedConn) Close() error {
+	t.closeOnce.Do(func() { t.onClose(time.Since(t.opened)) })
+	return t.Conn.Close()
+}
+
+// trackConnections counts the open connections of every backend transport by service.
+// Clients using the default transport are given a copy of it so their dials can be wrapped.
+func (c *Conductor) trackConnections() {
+	if c.client.Transport == nil {
+		c.client.Transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	clients := []*http.Client{c.client}
+	for _, svc := range c.currentServices() {
+		clients = append(clients, svc.client)
+	}
+	for _, remote := range c.currentFailover() {
+		for _, svc := range remote {
+			clients = append(clients, svc.client)
+		}
+	}
+
+	// Service clients may share a transport, which must only be wrapped once
+	wrapped := make(map[*http.Transport]bool)
+	for _, client := range clients {
+		if client == nil {
+			continue
+		}
+		transport, ok := client.Transport.(*http.Transport)
+		if !ok || wrapped[transport] {
+			continue
+		}
+		wrapped[transport] = true
+		transport.DialContext = c.trackedDial(transport.DialContext)
+	}
+}
+
+// trackedDial wraps a dial function so the connections it opens are counted against the
+// service they were dialed for until they are closed, when their age is recorded
+func (c *Conductor) trackedDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = newDialer(nil).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil || c.prometheusMetrics == nil {
+			return conn, err
+		}
+
+		// The transport dials with the context of the request that needed the connection
+		service, _ := ctx.Value(connServiceKey{}).(string)
+		if service == "" {
+			service = "unknown"
+		}
+		metrics := c.prometheusMetrics
+		metrics.ConnectionOpened(service)
+		return &trackedConn{Conn: conn, opened: time.Now(), onClose: func(age time.Duration) { metrics.ConnectionClosed(service, age) }}, nil
+	}
+}
+
+// withConnTrace attaches a client trace to a backend request's context that records
+// connection reuse and DNS, connect and TLS handshake durations for the service
+func (c *Conductor) withConnTrace(ctx context.Context, svc *Service) context.Context {
+	if c.prometheusMetrics == nil {
+		return ctx
+	}
+	metrics := c.prometheusMetrics
+
+	// Connect callbacks may run concurrently when dialing several addresses
+	var mu sync.Mutex
+	var dnsStart, tlsStart time.Time
+	connectStarts := make(map[string]time.Time)
+	observe := func(phase string, start time.Time) {
+		if !start.IsZero() {
+			metrics.RecordConnectionPhase(svc.Name, phase, time.Since(start))
+		}
+	}
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			metrics.RecordConnection(svc.Name, info.Reused)
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			observe(connPhaseDNS, dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			defer mu.Unlock()
+			connectStarts[network+" "+addr] = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				observe(connPhaseConnect, connectStarts[network+" "+addr])
+			}
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				observe(connPhaseTLS, tlsStart)
+			}
+		},
+	}
+	ctx = context.WithValue(ctx, connServiceKey{}, svc.Name)
+	return httptrace.WithClientTrace(ctx, trace)
+}
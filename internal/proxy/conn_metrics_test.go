@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestConnectionMetrics tests counting open, new and reused backend connections and
+// timing the connect phase
+func TestConnectionMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: backend.URL, PathPrefix: "/api", Primary: true},
+		},
+	}
+	conductor := NewConductor(cfg)
+	registry := prometheus.NewRegistry()
+	conductor.prometheusMetrics = NewPrometheusMetrics(registry)
+	conductor.trackConnections()
+
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/items", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", recorder.Code)
+		}
+	}
+
+	// value returns the value of a metric sample matching the given labels
+	value := func(name string, labels map[string]string) float64 {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather metrics: %v", err)
+		}
+		for _, family := range families {
+			if family.GetName() != name {
+				continue
+			}
+		metrics:
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if want, ok := labels[label.GetName()]; ok && want != label.GetValue() {
+						continue metrics
+					}
+				}
+				switch {
+				case metric.GetGauge() != nil:
+					return metric.GetGauge().GetValue()
+				case metric.GetCounter() != nil:
+					return metric.GetCounter().GetValue()
+				case metric.GetHistogram() != nil:
+					return float64(metric.GetHistogram().GetSampleCount())
+				}
+			}
+		}
+		return 0
+	}
+
+	tests := []struct {
+		name   string
+		metric string
+		labels map[string]string
+		want   float64
+	}{
+		{name: "new connection", metric: "go_conductor_backend_connections_total", labels: map[string]string{"service": "api", "state": "new"}, want: 1},
+		{name: "reused connection", metric: "go_conductor_backend_connections_total", labels: map[string]string{"service": "api", "state": "reused"}, want: 1},
+		{name: "open connections", metric: "go_conductor_backend_open_connections", labels: map[string]string{"service": "api"}, want: 1},
+		{name: "connect timed", metric: "go_conductor_backend_connection_phase_duration_seconds", labels: map[string]string{"service": "api", "phase": "connect"}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := value(tt.metric, tt.labels); got != tt.want {
+				t.Errorf("Expected %s%v = %v, got %v", tt.metric, tt.labels, tt.want, got)
+			}
+		})
+	}
+
+	conductor.client.CloseIdleConnections()
+	if got := value("go_conductor_backend_open_connections", map[string]string{"service": "api"}); got != 0 {
+		t.Errorf("Expected no open connections after closing idle ones, got %v", got)
+	}
+}
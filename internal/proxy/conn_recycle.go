@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// Reasons a keep-alive connection is recycled
+const (
+	recycleRequests = "requests"
+	recycleAge      = "age"
+)
+
+// recycledConn is a backend connection that counts the requests sent over it
+type recycledConn struct {
+	net.Conn
+	opened   time.Time
+	requests atomic.Int64
+}
+
+// connRecycler retires keep-alive connections after a number of requests or once they
+// reach an age, so backends behind a connection-level load balancer are rebalanced
+type connRecycler struct {
+	maxRequests int64
+	maxAge      time.Duration
+}
+
+// newConnRecycler creates the recycler of a service's dial settings, nil if connections
+// are kept for as long as the backend allows
+func newConnRecycler(dial *config.DialConfig) *connRecycler {
+	if dial == nil || (dial.MaxRequests <= 0 && dial.MaxAge <= 0) {
+		return nil
+	}
+	return &connRecycler{
+		maxRequests: int64(dial.MaxRequests),
+		maxAge:      time.Duration(dial.MaxAge) * time.Second,
+	}
+}
+
+// recycledDial wraps a dial function so the connections it opens can be recycled
+func recycledDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &recycledConn{Conn: conn, opened: time.Now()}, nil
+	}
+}
+
+// Retire counts a request sent over a connection, returning why the connection should
+// be closed after this request or empty if it can be kept
+func (r *connRecycler) Retire(conn net.Conn) string {
+	recycled := unwrapRecycledConn(conn)
+	if recycled == nil {
+		return ""
+	}
+	requests := recycled.requests.Add(1)
+	switch {
+	case r.maxRequests > 0 && requests >= r.maxRequests:
+		return recycleRequests
+	case r.maxAge > 0 && time.Since(recycled.opened) >= r.maxAge:
+		return recycleAge
+	default:
+		return ""
+	}
+}
+
+// unwrapRecycledConn finds the recycled connection beneath TLS and tracking wrappers
+func unwrapRecycledConn(conn net.Conn) *recycledConn {
+	for {
+		switch wrapped := conn.(type) {
+		case *recycledConn:
+			return wrapped
+		case *trackedConn:
+			conn = wrapped.Conn
+		case *tls.Conn:
+			conn = wrapped.NetConn()
+		default:
+			return nil
+		}
+	}
+}
+
+// withConnRecycling retires the connection a backend request is sent over once it has
+// reached its limits. The request asks the backend to close the connection after
+// answering, so the connection is never closed under a request already sent on it.
+func (c *Conductor) withConnRecycling(req *http.Request, svc *Service) *http.Request {
+	if svc.recycler == nil {
+		return req
+	}
+	// The transport may copy the request, but the copy shares its headers
+	header := req.Header
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reason := svc.recycler.Retire(info.Conn)
+			if reason == "" {
+				return
+			}
+			header.Set("Connection", "close")
+			if c.prometheusMetrics != nil {
+				c.prometheusMetrics.RecordConnectionRecycled(svc.Name, reason)
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
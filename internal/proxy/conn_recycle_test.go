@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestConnectionRecycling tests that keep-alive connections are closed after the
+// configured number of requests and new ones are dialed
+func TestConnectionRecycling(t *testing.T) {
+	var mu sync.Mutex
+	remotes := make(map[string]int)
+	closes := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		remotes[r.RemoteAddr]++
+		if r.Close {
+			closes++
+		}
+		mu.Unlock()
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: backend.URL, PathPrefix: "/api", Primary: true, Dial: &config.DialConfig{MaxRequests: 2}},
+		},
+	}
+	conductor := NewConductor(cfg)
+
+	for i := 0; i < 5; i++ {
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/items", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", recorder.Code)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(remotes) != 3 {
+		t.Errorf("Expected 3 connections for 5 requests recycled every 2, got %d", len(remotes))
+	}
+	for remote, requests := range remotes {
+		if requests > 2 {
+			t.Errorf("Expected at most 2 requests on %s, got %d", remote, requests)
+		}
+	}
+	if closes != 2 {
+		t.Errorf("Expected 2 requests asking to close the connection, got %d", closes)
+	}
+}
+
+// TestConnRecycler tests which request retires a connection
+func TestConnRecycler(t *testing.T) {
+	if newConnRecycler(&config.DialConfig{ConnectTimeoutMs: 100}) != nil {
+		t.Error("Expected no recycler without limits")
+	}
+
+	recycler := newConnRecycler(&config.DialConfig{MaxAge: 60})
+	conn := &recycledConn{opened: time.Now().Add(-time.Hour)}
+	if reason := recycler.Retire(&trackedConn{Conn: conn}); reason != recycleAge {
+		t.Errorf("Expected an old connection to be retired for its age, got %q", reason)
+	}
+	if reason := recycler.Retire(&trackedConn{}); reason != "" {
+		t.Errorf("Expected connections dialed elsewhere to be kept, got %q", reason)
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// newContentTypeAllowlists returns the allowed media types by route, lowercased
+func newContentTypeAllowlists(routes []config.RouteContentTypes) map[string][]string {
+	allowlists := make(map[string][]string, len(routes))
+	for _, route := range routes {
+		for _, allowed := range route.Allow {
+			mediaType, _, _ := mime.ParseMediaType(allowed)
+			allowlists[route.Route] = append(allowlists[route.Route], mediaType)
+		}
+	}
+	return allowlists
+}
+
+// allowedContentType reports whether the request body's content type is in the route's
+// allowlist. Requests without a body and routes without an allowlist are always allowed.
+func (c *Conductor) allowedContentType(route string, r *http.Request) bool {
+	allowlist, ok := c.contentTypes[route]
+	if !ok || r.ContentLength == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, allowed := range allowlist {
+		if allowed == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// handleUnsupportedMediaType rejects a request whose body the route does not accept
+func (c *Conductor) handleUnsupportedMediaType(w http.ResponseWriter, r *http.Request, route string, requestStart time.Time, traceID string) {
+	logger.WarnWithFields("Rejecting request with unsupported content type", map[string]interface{}{
+		"method":       r.Method,
+		"path":         r.URL.Path,
+		"route":        route,
+		"content_type": r.Header.Get("Content-Type"),
+	})
+	writeError(w, r, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType, "Request content type is not accepted by this route")
+
+	// Record rejected request in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", route, "unsupported_media_type")
+		c.prometheusMetrics.RecordRequest("conductor", route, r.Method, "415", time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, true)
+	}
+	c.recordSLO(route, http.StatusUnsupportedMediaType, time.Since(requestStart))
+}
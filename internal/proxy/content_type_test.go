@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestContentTypeAllowlist tests rejecting request bodies the route does not accept
+// before any backend sees them
+func TestContentTypeAllowlist(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+		ContentTypes: []config.RouteContentTypes{{Route: "/api", Allow: []string{"application/json", "text/*"}}},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{name: "allowed", method: "POST", contentType: "application/json", body: `{}`, wantStatus: 200},
+		{name: "parameters and case ignored", method: "POST", contentType: "Application/JSON; charset=utf-8", body: `{}`, wantStatus: 200},
+		{name: "wildcard", method: "POST", contentType: "text/csv", body: "a,b", wantStatus: 200},
+		{name: "multipart", method: "POST", contentType: "multipart/form-data; boundary=x", body: "--x--", wantStatus: 415},
+		{name: "missing", method: "POST", body: `{}`, wantStatus: 415},
+		{name: "no body", method: "GET", wantStatus: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport.requests = nil
+			req := httptest.NewRequest(tt.method, "http://example.com/api/users", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus == 415 {
+				if !strings.Contains(recorder.Body.String(), ErrCodeUnsupportedMediaType) {
+					t.Errorf("Expected %s error code, got %s", ErrCodeUnsupportedMediaType, recorder.Body.String())
+				}
+				if len(transport.requests) != 0 {
+					t.Errorf("Expected no backend requests, got %d", len(transport.requests))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// corsPolicy decides which cross-origin browser requests a route accepts
+type corsPolicy struct {
+	origins        map[string]bool
+	anyOrigin      bool
+	methods        string
+	headers        string // Allowed request headers, empty to allow those requested
+	expose         string
+	credentials    bool
+	maxAge         int
+	privateNetwork bool
+}
+
+// newCORSPolicies builds the CORS policy of each configured route
+func newCORSPolicies(routes []config.CORSConfig) map[string]*corsPolicy {
+	policies := make(map[string]*corsPolicy)
+	for _, cfg := range routes {
+		policy := &corsPolicy{
+			origins:        make(map[string]bool),
+			methods:        strings.Join(cfg.AllowMethods, ", "),
+			headers:        strings.Join(cfg.AllowHeaders, ", "),
+			expose:         strings.Join(cfg.ExposeHeaders, ", "),
+			credentials:    cfg.AllowCredentials,
+			maxAge:         cfg.MaxAge,
+			privateNetwork: cfg.AllowPrivateNetwork,
+		}
+		for _, origin := range cfg.AllowOrigins {
+			if origin == "*" {
+				policy.anyOrigin = true
+			}
+			policy.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+		policies[cfg.Route] = policy
+	}
+	return policies
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for an origin, or an empty
+// string if the origin is not allowed. Any origin is answered with "*" and never echoed,
+// so credentials are only shared with listed origins.
+func (p *corsPolicy) allowOrigin(origin string) string {
+	if p.anyOrigin {
+		return "*"
+	}
+	if p.origins[strings.ToLower(origin)] {
+		return origin
+	}
+	return ""
+}
+
+// setHeaders sets the headers shared by preflight and actual responses for an allowed origin
+func (p *corsPolicy) setHeaders(header http.Header, allowOrigin string) {
+	header.Set("Access-Control-Allow-Origin", allowOrigin)
+	if p.credentials && allowOrigin != "*" {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// isPreflight reports whether a request is a CORS preflight
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// applyCORS handles cross-origin requests to a route with a CORS policy. Preflights are
+// answered directly and reported as handled; other requests get a writer that adds the
+// CORS response headers in place of any the backend sent.
+func (c *Conductor) applyCORS(w http.ResponseWriter, r *http.Request, route string) (http.ResponseWriter, bool) {
+	policy, ok := c.cors[route]
+	if !ok {
+		return w, false
+	}
+	origin := r.Header.Get("Origin")
+
+	if isPreflight(r) {
+		header := w.Header()
+		header.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network")
+		allowOrigin := policy.allowOrigin(origin)
+		if allowOrigin == "" {
+			logger.DebugWithFields("Rejecting CORS preflight from disallowed origin", map[string]interface{}{
+				"origin": origin,
+				"path":   r.URL.Path,
+				"route":  route,
+			})
+			w.WriteHeader(http.StatusNoContent)
+			return w, true
+		}
+
+		policy.setHeaders(header, allowOrigin)
+		header.Set("Access-Control-Allow-Methods", policy.methods)
+		if policy.headers != "" {
+			header.Set("Access-Control-Allow-Headers", policy.headers)
+		} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if policy.maxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(policy.maxAge))
+		}
+		// Private Network Access: public sites may only reach private addresses when allowed
+		if policy.privateNetwork && r.Header.Get("Access-Control-Request-Private-Network") == "true" {
+			header.Set("Access-Control-Allow-Private-Network", "true")
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return w, true
+	}
+
+	if origin == "" {
+		return w, false
+	}
+	return &corsResponseWriter{ResponseWriter: w, policy: policy, origin: origin}, false
+}
+
+// recordPreflight records a preflight answered by applyCORS
+func (c *Conductor) recordPreflight(r *http.Request, route string, requestStart time.Time, traceID string) {
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordRequest("conductor", route, r.Method, "204", time.Since(requestStart), traceID)
+	}
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, false)
+	}
+}
+
+// corsResponseWriter replaces the backend's CORS headers with the route's policy
+type corsResponseWriter struct {
+	http.ResponseWriter
+	policy      *corsPolicy
+	origin      string
+	wroteHeader bool
+}
+
+// WriteHeader sets the CORS headers before writing the status
+func (cw *corsResponseWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		header := cw.Header()
+		for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Expose-Headers"} {
+			header.Del(name)
+		}
+		header.Add("Vary", "Origin")
+		if allowOrigin := cw.policy.allowOrigin(cw.origin); allowOrigin != "" {
+			cw.policy.setHeaders(header, allowOrigin)
+			if cw.policy.expose != "" {
+				header.Set("Access-Control-Expose-Headers", cw.policy.expose)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the body, setting the CORS headers first if the status was not written
+func (cw *corsResponseWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (cw *corsResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// corsBackendTransport answers with its own permissive CORS header
+type corsBackendTransport struct {
+	requests int
+}
+
+func (b *corsBackendTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.requests++
+	header := http.Header{}
+	header.Set("Access-Control-Allow-Origin", "*")
+	return &http.Response{StatusCode: 200, Header: header, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+}
+
+// TestCORS tests answering preflights, including Private Network Access, and applying the
+// route's policy to actual responses
+func TestCORS(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "public", URL: "http://public.example.com", PathPrefix: "/public", Primary: true},
+		},
+		CORS: []config.CORSConfig{
+			{
+				Route:               "/api",
+				AllowOrigins:        []string{"https://app.example.com"},
+				AllowMethods:        []string{"GET", "PUT"},
+				ExposeHeaders:       []string{"X-Request-ID"},
+				AllowCredentials:    true,
+				MaxAge:              600,
+				AllowPrivateNetwork: true,
+			},
+			{Route: "/public", AllowOrigins: []string{"*"}, AllowMethods: []string{"GET"}},
+		},
+		Auth: config.AuthConfig{
+			Methods: map[string]config.AuthMethodConfig{"key": {Type: "apiKey", Keys: []string{"secret"}}},
+			Routes:  []config.RouteAuth{{Route: "/api", Require: "key"}},
+		},
+	}
+	conductor := NewConductor(cfg)
+	backend := &corsBackendTransport{}
+	conductor.client = &http.Client{Transport: backend}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		header       map[string]string
+		wantStatus   int
+		wantHeaders  map[string]string // Empty value means the header must be absent
+		wantUpstream bool
+	}{
+		{
+			name:   "preflight with private network access",
+			method: "OPTIONS",
+			path:   "/api/items",
+			header: map[string]string{
+				"Origin":                                 "https://app.example.com",
+				"Access-Control-Request-Method":          "PUT",
+				"Access-Control-Request-Headers":         "content-type",
+				"Access-Control-Request-Private-Network": "true",
+			},
+			wantStatus: 204,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":          "https://app.example.com",
+				"Access-Control-Allow-Methods":         "GET, PUT",
+				"Access-Control-Allow-Headers":         "content-type",
+				"Access-Control-Allow-Credentials":     "true",
+				"Access-Control-Max-Age":               "600",
+				"Access-Control-Allow-Private-Network": "true",
+			},
+		},
+		{
+			name:        "preflight from disallowed origin",
+			method:      "OPTIONS",
+			path:        "/api/items",
+			header:      map[string]string{"Origin": "https://evil.example.com", "Access-Control-Request-Method": "GET"},
+			wantStatus:  204,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Private-Network": ""},
+		},
+		{
+			name:         "actual request gets the route policy",
+			method:       "GET",
+			path:         "/api/items",
+			header:       map[string]string{"Origin": "https://app.example.com", "X-API-Key": "secret"},
+			wantStatus:   200,
+			wantHeaders:  map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Expose-Headers": "X-Request-ID"},
+			wantUpstream: true,
+		},
+		{
+			name:         "backend CORS headers removed for disallowed origin",
+			method:       "GET",
+			path:         "/api/items",
+			header:       map[string]string{"Origin": "https://evil.example.com", "X-API-Key": "secret"},
+			wantStatus:   200,
+			wantHeaders:  map[string]string{"Access-Control-Allow-Origin": ""},
+			wantUpstream: true,
+		},
+		{
+			name:        "any origin without credentials",
+			method:      "OPTIONS",
+			path:        "/public/feed",
+			header:      map[string]string{"Origin": "https://other.example.com", "Access-Control-Request-Method": "GET"},
+			wantStatus:  204,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Max-Age": "", "Access-Control-Allow-Credentials": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.requests = 0
+			req := httptest.NewRequest(tt.method, "http://example.com"+tt.path, nil)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := recorder.Header().Get(name); got != want {
+					t.Errorf("Expected %s %q, got %q", name, want, got)
+				}
+			}
+			if upstream := backend.requests > 0; upstream != tt.wantUpstream {
+				t.Errorf("Expected upstream request=%v, got %v", tt.wantUpstream, upstream)
+			}
+		})
+	}
+}
+
+// TestCORSAnyOriginCredentials tests that a policy for any origin never echoes the origin,
+// even if credentials are allowed, so no site can make credentialed reads
+func TestCORSAnyOriginCredentials(t *testing.T) {
+	policy := newCORSPolicies([]config.CORSConfig{{Route: "/api", AllowOrigins: []string{"*"}, AllowCredentials: true}})["/api"]
+	header := http.Header{}
+	policy.setHeaders(header, policy.allowOrigin("https://evil.example.com"))
+	if got := header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected any origin answered with *, got %q", got)
+	}
+	if got := header.Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Expected no credentials for any origin, got %q", got)
+	}
+}
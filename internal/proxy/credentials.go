@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Credential types
+const (
+	credentialsOAuth2 = "oauth2" // OAuth2 client credentials grant
+	credentialsFile   = "file"   // Token read from a file rotated by another process
+)
+
+// credentialsRejectAge is how old a token must be before a backend rejecting it makes
+// the conductor obtain a new one, so a backend refusing every token does not flood the
+// token endpoint
+const credentialsRejectAge = 5 * time.Second
+
+// tokenSource obtains the token a backend requires and keeps it fresh. OAuth2 tokens are
+// renewed in the background shortly before they expire, so requests rarely wait for the
+// token endpoint; tokens read from a file are re-read once their refresh interval passed.
+type tokenSource struct {
+	cfg     config.CredentialsConfig
+	service string
+	client  *http.Client
+	now     func() time.Time
+
+	mu         sync.Mutex
+	token      string
+	obtained   time.Time
+	refreshAt  time.Time // When a new token is obtained while the current one is still used
+	expiresAt  time.Time // When the current token can no longer be used
+	refreshing bool
+
+	fetchMu sync.Mutex // Serializes fetches, so requests waiting for a token share one
+}
+
+// newTokenSource creates the token source of a service's credentials
+func newTokenSource(service string, cfg config.CredentialsConfig) *tokenSource {
+	return &tokenSource{
+		cfg:     cfg,
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+	}
+}
+
+// HeaderValue returns the value of the credentials header, obtaining a token first if
+// there is none or it expired
+func (s *tokenSource) HeaderValue(ctx context.Context) (string, error) {
+	token, err := s.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	return s.format(token), nil
+}
+
+// format prefixes a token with the configured scheme
+func (s *tokenSource) format(token string) string {
+	if s.cfg.Scheme == "" || strings.EqualFold(s.cfg.Scheme, "none") {
+		return token
+	}
+	return s.cfg.Scheme + " " + token
+}
+
+// Token returns the current token, obtaining a new one first if there is none or it
+// expired, and in the background once it is due for renewal
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	now := s.now()
+	if s.token != "" && now.Before(s.expiresAt) {
+		token := s.token
+		if !now.Before(s.refreshAt) && !s.refreshing {
+			s.refreshing = true
+			go s.refresh()
+		}
+		s.mu.Unlock()
+		return token, nil
+	}
+	s.mu.Unlock()
+
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	// Another request may have obtained a token while this one waited
+	s.mu.Lock()
+	if s.token != "" && s.now().Before(s.expiresAt) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	s.mu.Unlock()
+
+	token, err := s.obtain(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain credentials for service %s: %w", s.service, err)
+	}
+	return token, nil
+}
+
+// refresh renews the token ahead of its expiry, keeping the current one if that fails
+func (s *tokenSource) refresh() {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.refreshing = false
+		s.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+	defer cancel()
+	if _, err := s.obtain(ctx); err != nil {
+		logger.WarnWithFields("Failed to refresh backend credentials, keeping the current token", map[string]interface{}{
+			"service": s.service,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// Rejected drops the token carried by a request the backend rejected as unauthorized, so
+// the next request obtains a new one. Tokens obtained moments ago are kept.
+func (s *tokenSource) Rejected(headerValue string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == "" || s.format(s.token) != headerValue || s.now().Sub(s.obtained) < credentialsRejectAge {
+		return
+	}
+	s.token = ""
+	logger.WarnWithFields("Backend rejected its credentials, obtaining a new token", map[string]interface{}{
+		"service": s.service,
+	})
+}
+
+// obtain gets a new token and stores it, with the fetch lock held
+func (s *tokenSource) obtain(ctx context.Context) (string, error) {
+	var token string
+	var lifetime time.Duration
+	var err error
+	if s.cfg.Type == credentialsOAuth2 {
+		token, lifetime, err = s.requestToken(ctx)
+	} else {
+		token, err = s.readFile()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token, s.obtained = token, now
+	if lifetime > 0 {
+		// Short-lived tokens are renewed halfway through their lifetime instead
+		refreshBefore := min(time.Duration(s.cfg.RefreshBefore)*time.Second, lifetime/2)
+		s.expiresAt = now.Add(lifetime)
+		s.refreshAt = s.expiresAt.Add(-refreshBefore)
+	} else {
+		s.expiresAt = now.Add(time.Duration(s.cfg.RefreshInterval) * time.Second)
+		s.refreshAt = s.expiresAt
+	}
+	logger.DebugWithFields("Obtained backend credentials", map[string]interface{}{
+		"service":    s.service,
+		"type":       s.cfg.Type,
+		"expires_at": s.expiresAt,
+	})
+	return token, nil
+}
+
+// readFile reads the token from its file
+func (s *tokenSource) readFile() (string, error) {
+	data, err := os.ReadFile(s.cfg.File)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", s.cfg.File)
+	}
+	return token, nil
+}
+
+// requestToken asks the token endpoint for a token with the client credentials grant,
+// returning it with its lifetime, zero if the endpoint did not say
+func (s *tokenSource) requestToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	if s.cfg.Audience != "" {
+		form.Set("audience", s.cfg.Audience)
+	}
+	if s.cfg.ClientAuth == "body" {
+		form.Set("client_id", s.cfg.ClientID)
+		form.Set("client_secret", s.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.cfg.ClientAuth != "body" {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return "", 0, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var answer struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return "", 0, fmt.Errorf("invalid token endpoint response: %w", err)
+	}
+	if answer.AccessToken == "" {
+		return "", 0, fmt.Errorf("token endpoint response has no access_token")
+	}
+	return answer.AccessToken, time.Duration(answer.ExpiresIn) * time.Second, nil
+}
+
+// setCredentials sets the header carrying the token the service requires, if any
+func (c *Conductor) setCredentials(ctx context.Context, req *http.Request, svc *Service) error {
+	if svc.credentials == nil {
+		return nil
+	}
+	value, err := svc.credentials.HeaderValue(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(svc.Config.Credentials.Header, value)
+	return nil
+}
+
+// checkCredentials drops the token of a request the service rejected as unauthorized
+func (c *Conductor) checkCredentials(svc *Service, req *http.Request, result *serviceResult) {
+	if svc.credentials != nil && result.resp != nil && result.resp.StatusCode == http.StatusUnauthorized {
+		svc.credentials.Rejected(req.Header.Get(svc.Config.Credentials.Header))
+	}
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// tokenEndpoint serves client credentials grants, numbering the tokens it issues
+func tokenEndpoint(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	var issued atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "conductor" || secret != "s3cret" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("scope") != "orders.read orders.write" {
+			t.Errorf("Unexpected token request %v", r.PostForm)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, issued.Add(1), expiresIn)
+	}))
+	return server, &issued
+}
+
+// TestCredentialsInjected tests that the token obtained from the token endpoint replaces
+// the client's Authorization header, and that one token serves many requests
+func TestCredentialsInjected(t *testing.T) {
+	tokens, issued := tokenEndpoint(t, 3600)
+	defer tokens.Close()
+	var authorization atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{{Name: "orders", URL: backend.URL, PathPrefix: "/orders", Primary: true,
+			Credentials: &config.CredentialsConfig{Type: credentialsOAuth2, TokenURL: tokens.URL, ClientID: "conductor",
+				ClientSecret: "s3cret", ClientAuth: "basic", Scopes: []string{"orders.read", "orders.write"},
+				Header: "Authorization", Scheme: "Bearer", RefreshBefore: 60, RefreshInterval: 300}}},
+	}
+	conductor := NewConductor(cfg)
+	defer conductor.Close()
+
+	for range 3 {
+		req := httptest.NewRequest("GET", "/orders/1", nil)
+		req.Header.Set("Authorization", "Bearer client-token")
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK || authorization.Load() != "Bearer token-1" {
+			t.Fatalf("Expected the obtained token sent, got %d %v", recorder.Code, authorization.Load())
+		}
+	}
+	if issued.Load() != 1 {
+		t.Errorf("Expected one token obtained, got %d", issued.Load())
+	}
+
+	// Requests fail rather than reaching the backend without credentials
+	tokens.Close()
+	svc, _ := conductor.serviceNamed("orders")
+	svc.credentials.mu.Lock()
+	svc.credentials.token = ""
+	svc.credentials.mu.Unlock()
+	recorder := httptest.NewRecorder()
+	conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "/orders/1", nil))
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("Expected a failure without a token, got %d", recorder.Code)
+	}
+}
+
+// TestCredentialsRefresh tests that tokens are renewed in the background before they
+// expire, obtained again once expired or rejected, and re-read from rotated files
+func TestCredentialsRefresh(t *testing.T) {
+	tokens, _ := tokenEndpoint(t, 120)
+	defer tokens.Close()
+
+	source := newTokenSource("orders", config.CredentialsConfig{Type: credentialsOAuth2, TokenURL: tokens.URL,
+		ClientID: "conductor", ClientSecret: "s3cret", ClientAuth: "basic", Scopes: []string{"orders.read", "orders.write"},
+		Header: "Authorization", Scheme: "Bearer", RefreshBefore: 60, RefreshInterval: 300})
+	now := time.Now()
+	var clock atomic.Int64
+	clock.Store(now.UnixNano())
+	source.now = func() time.Time { return time.Unix(0, clock.Load()) }
+	token := func() string {
+		value, err := source.HeaderValue(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to obtain token: %v", err)
+		}
+		return value
+	}
+
+	if value := token(); value != "Bearer token-1" {
+		t.Fatalf("Expected the first token, got %s", value)
+	}
+
+	// Due for renewal, the current token is used while a new one is obtained
+	clock.Store(now.Add(61 * time.Second).UnixNano())
+	if value := token(); value != "Bearer token-1" {
+		t.Errorf("Expected the current token while renewing, got %s", value)
+	}
+	for deadline := time.Now().Add(2 * time.Second); token() != "Bearer token-2" && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if value := token(); value != "Bearer token-2" {
+		t.Errorf("Expected the renewed token, got %s", value)
+	}
+
+	// Expired tokens are obtained again before the request is sent
+	clock.Store(now.Add(10 * time.Minute).UnixNano())
+	if value := token(); value != "Bearer token-3" {
+		t.Errorf("Expected a new token once expired, got %s", value)
+	}
+
+	// Rejections drop the token, unless it was obtained moments ago
+	source.Rejected("Bearer token-3")
+	if value := token(); value != "Bearer token-3" {
+		t.Errorf("Expected a fresh token kept after a rejection, got %s", value)
+	}
+	clock.Store(now.Add(10*time.Minute + credentialsRejectAge).UnixNano())
+	source.Rejected("Bearer token-3")
+	if value := token(); value != "Bearer token-4" {
+		t.Errorf("Expected a new token after a rejection, got %s", value)
+	}
+
+	// File tokens are re-read once the refresh interval passed
+	file := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(file, []byte("first\n"), 0600)
+	source = newTokenSource("orders", config.CredentialsConfig{Type: credentialsFile, File: file, Header: "X-Api-Key", RefreshInterval: 30})
+	source.now = func() time.Time { return time.Unix(0, clock.Load()) }
+	if value := token(); value != "first" {
+		t.Errorf("Expected the token from the file, got %s", value)
+	}
+	os.WriteFile(file, []byte("second\n"), 0600)
+	if value := token(); value != "first" {
+		t.Errorf("Expected the token kept until the refresh interval passed, got %s", value)
+	}
+	clock.Add(int64(30 * time.Second))
+	if value := token(); value != "second" {
+		t.Errorf("Expected the rotated token, got %s", value)
+	}
+}
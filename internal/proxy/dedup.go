@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// errDedupLeaderFailed is shared with the callers waiting on a call that panicked
+var errDedupLeaderFailed = errors.New("coalesced request failed")
+
+// dedupCall is an upstream call shared by concurrent duplicate requests
+type dedupCall struct {
+	done    chan struct{}
+	result  *serviceResult
+	failure error
+}
+
+// requestDeduper coalesces concurrent requests carrying the same idempotency key into a
+// single upstream call whose outcome is shared by every caller. Only identical requests
+// from the same client share a call: the key also covers who sent the request, its
+// method, path, query and body. Only requests in flight at the same time are coalesced,
+// nothing is cached once the call completes.
+type requestDeduper struct {
+	mu       sync.Mutex
+	header   string
+	identity *clientIdentity
+	calls    map[string]*dedupCall
+}
+
+// newRequestDeduper creates a deduper keyed on the configured header and client identity
+func newRequestDeduper(cfg config.DedupConfig, auth config.AuthConfig) (*requestDeduper, error) {
+	identity, err := newClientIdentity(cfg.Identity, auth)
+	if err != nil {
+		return nil, err
+	}
+	return &requestDeduper{
+		header:   cfg.Header,
+		identity: identity,
+		calls:    make(map[string]*dedupCall),
+	}, nil
+}
+
+// Key returns the deduplication key for a request, or an empty string if the request
+// carries no idempotency key or its body cannot be read. Clients without verified
+// credentials are told apart by their address, so a client cannot be handed the response
+// to another client's request by reusing its idempotency key.
+func (d *requestDeduper) Key(r *http.Request, body *requestBody) string {
+	id := r.Header.Get(d.header)
+	if id == "" {
+		return ""
+	}
+	client := "address " + clientAddress(r)
+	if principal, ok := d.identity.Identify(r); ok {
+		client = "principal " + principal
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body.Reader()); err != nil {
+		return ""
+	}
+	return strings.Join([]string{client, r.Method, r.URL.RequestURI(), id, hex.EncodeToString(hash.Sum(nil))}, "\n")
+}
+
+// Do runs fn for the first caller with a given key and makes concurrent callers with the
+// same key wait for its outcome. leader reports whether fn ran for this caller. If fn
+// panics, the waiting callers fail and the key is released before the panic goes on.
+func (d *requestDeduper) Do(key string, fn func() (*serviceResult, error)) (result *serviceResult, failure error, leader bool) {
+	d.mu.Lock()
+	if call, ok := d.calls[key]; ok {
+		d.mu.Unlock()
+		<-call.done
+		return call.result, call.failure, false
+	}
+
+	call := &dedupCall{done: make(chan struct{}), failure: errDedupLeaderFailed}
+	d.calls[key] = call
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.calls, key)
+		d.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.result, call.failure = fn()
+	return call.result, call.failure, true
+}
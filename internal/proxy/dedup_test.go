@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// gatedTransport counts outgoing requests and holds them until released
+type gatedTransport struct {
+	calls   int32
+	release chan struct{}
+}
+
+func (g *gatedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := atomic.AddInt32(&g.calls, 1)
+	<-g.release
+	return &http.Response{
+		StatusCode: 201,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("created " + string(rune('0'+n)))),
+	}, nil
+}
+
+// TestRequestDedup tests that concurrent requests with the same idempotency key share one upstream call
+func TestRequestDedup(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{
+				Name:       "orders",
+				URL:        "http://orders.example.com",
+				PathPrefix: "/orders",
+				Primary:    true,
+			},
+		},
+		Dedup: config.DedupConfig{Enabled: true, Header: "Idempotency-Key"},
+	}
+	conductor := NewConductor(cfg)
+	transport := &gatedTransport{release: make(chan struct{})}
+	conductor.client = &http.Client{Transport: transport}
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "http://example.com/orders", strings.NewReader(`{"item":1}`))
+		req.Header.Set("Idempotency-Key", key)
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 4)
+	for i := range recorders {
+		key := "order-1"
+		if i == len(recorders)-1 {
+			key = "order-2"
+		}
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			recorders[i] = send(key)
+		}(i, key)
+	}
+
+	// Give every request time to reach the upstream call or join it
+	time.Sleep(100 * time.Millisecond)
+	close(transport.release)
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&transport.calls); calls != 2 {
+		t.Errorf("Expected 2 upstream calls for 2 distinct keys, got %d", calls)
+	}
+
+	for i := 1; i < len(recorders)-1; i++ {
+		if recorders[i].Code != 201 || recorders[i].Body.String() != recorders[0].Body.String() {
+			t.Errorf("Expected duplicate %d to share the response %q, got %d %q",
+				i, recorders[0].Body.String(), recorders[i].Code, recorders[i].Body.String())
+		}
+	}
+}
+
+// TestDedupKey tests that only identical requests from the same client share a key
+func TestDedupKey(t *testing.T) {
+	secret := []byte("sso-secret")
+	deduper, err := newRequestDeduper(config.DedupConfig{
+		Header:   "Idempotency-Key",
+		Identity: config.IdentityConfig{Auth: "sso", Claim: "sub"},
+	}, config.AuthConfig{Methods: map[string]config.AuthMethodConfig{
+		"sso": {Type: "jwt", Secret: string(secret)},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create deduper: %v", err)
+	}
+	alice := signJWT(t, "HS256", secret, map[string]interface{}{"sub": "alice"})
+	bob := signJWT(t, "HS256", secret, map[string]interface{}{"sub": "bob"})
+
+	type request struct {
+		method, target, body, token, addr, key string
+	}
+	keyOf := func(req request) string {
+		r := httptest.NewRequest(req.method, "http://example.com"+req.target, nil)
+		r.RemoteAddr = req.addr
+		if req.key != "" {
+			r.Header.Set("Idempotency-Key", req.key)
+		}
+		if req.token != "" {
+			r.Header.Set("Authorization", "Bearer "+req.token)
+		}
+		body, _ := spoolBody(strings.NewReader(req.body), 0, "")
+		return deduper.Key(r, body)
+	}
+
+	base := request{method: "POST", target: "/orders", body: `{"item":1}`, token: alice, addr: "192.0.2.1:1000", key: "order-1"}
+	tests := []struct {
+		name     string
+		change   func(r *request)
+		wantSame bool
+	}{
+		{name: "same client from another address", change: func(r *request) { r.addr = "192.0.2.2:2000" }, wantSame: true},
+		{name: "other principal", change: func(r *request) { r.token = bob }},
+		{name: "other body", change: func(r *request) { r.body = `{"item":2}` }},
+		{name: "other method", change: func(r *request) { r.method = "PUT" }},
+		{name: "other query", change: func(r *request) { r.target = "/orders?dry=1" }},
+		{name: "unidentified client", change: func(r *request) { r.token = "" }},
+	}
+
+	want := keyOf(base)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base
+			tt.change(&req)
+			if got := keyOf(req); (got == want) != tt.wantSame {
+				t.Errorf("Expected same key=%v", tt.wantSame)
+			}
+		})
+	}
+
+	// Unidentified clients are told apart by address
+	anonymous := base
+	anonymous.token = ""
+	elsewhere := anonymous
+	elsewhere.addr = "192.0.2.2:2000"
+	if keyOf(anonymous) == keyOf(elsewhere) {
+		t.Error("Expected unidentified clients at different addresses to have different keys")
+	}
+	if keyOf(request{method: "POST", target: "/orders", addr: "192.0.2.1:1000"}) != "" {
+		t.Error("Expected no key without an idempotency key")
+	}
+}
+
+// TestDedupLeaderPanic tests that callers waiting on a call that panics fail instead of
+// waiting forever, and that the key can be used again
+func TestDedupLeaderPanic(t *testing.T) {
+	deduper := &requestDeduper{calls: make(map[string]*dedupCall)}
+	running, release := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer func() { recover() }()
+		deduper.Do("key", func() (*serviceResult, error) {
+			close(running)
+			<-release
+			panic("handler bug")
+		})
+	}()
+	<-running
+
+	followed := make(chan error, 1)
+	go func() {
+		_, failure, leader := deduper.Do("key", func() (*serviceResult, error) { return nil, nil })
+		if leader {
+			failure = nil
+		}
+		followed <- failure
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	select {
+	case failure := <-followed:
+		if failure != errDedupLeaderFailed {
+			t.Errorf("Expected the waiting caller to fail, got %v", failure)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the waiting caller to be released")
+	}
+	if _, _, leader := deduper.Do("key", func() (*serviceResult, error) { return nil, nil }); !leader {
+		t.Error("Expected the key to be released")
+	}
+}
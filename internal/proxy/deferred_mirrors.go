@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// deferredMirrorJob holds the shadow requests of a client request whose primary answered
+type deferredMirrorJob struct {
+	ctx      context.Context // Context of the client request, without its cancellation
+	route    string
+	services []*Service // Shadows and mirrors still to be sent
+	req      *http.Request
+	body     *requestBody     // Released once every deferred request finished
+	results  []*serviceResult // Results of the services sent at once, the primary's among them
+}
+
+// deferredMirrors sends shadow requests on background workers once the primary answered.
+// Jobs are queued without blocking and dropped when the queue is full, so mirroring never
+// adds latency to client requests.
+type deferredMirrors struct {
+	mu     sync.RWMutex
+	closed bool
+	queue  chan deferredMirrorJob
+	wg     sync.WaitGroup
+	send   func(job deferredMirrorJob)
+}
+
+// newDeferredMirrors starts the workers sending deferred requests with the given function
+func newDeferredMirrors(cfg config.DeferredMirrorsConfig, send func(job deferredMirrorJob)) *deferredMirrors {
+	m := &deferredMirrors{
+		queue: make(chan deferredMirrorJob, cfg.QueueSize),
+		send:  send,
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	return m
+}
+
+// Submit queues a job, reporting false if the queue was full or closed and the job was dropped
+func (m *deferredMirrors) Submit(job deferredMirrorJob) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return false
+	}
+
+	select {
+	case m.queue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting jobs and waits for queued jobs to be sent
+func (m *deferredMirrors) Close() {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// work sends jobs until the queue is closed
+func (m *deferredMirrors) work() {
+	defer m.wg.Done()
+	for job := range m.queue {
+		m.send(job)
+	}
+}
+
+// deferMirrors splits the services of a request with a primary into those sent at once and
+// the shadows and mirrors deferred until the primary answered. On-demand mirrors are sent
+// at once, as the client waits for their summary.
+func deferMirrors(services []*Service, originalReq *http.Request) ([]*Service, []*Service) {
+	request := onDemandOf(originalReq)
+	var now, deferred []*Service
+	for _, svc := range services {
+		if svc.Primary || (request != nil && request.service == svc) {
+			now = append(now, svc)
+		} else {
+			deferred = append(deferred, svc)
+		}
+	}
+	return now, deferred
+}
+
+// submitDeferredMirrors queues a job's deferred requests, reporting false if they were
+// dropped because the queue is full
+func (c *Conductor) submitDeferredMirrors(job deferredMirrorJob) bool {
+	if c.deferredMirrors.Submit(job) {
+		return true
+	}
+
+	logger.WarnWithFields("Deferred mirror queue full, dropping shadow requests", map[string]interface{}{
+		"route":    job.route,
+		"method":   job.req.Method,
+		"path":     job.req.URL.Path,
+		"services": getServiceNames(job.services),
+	})
+	if c.prometheusMetrics != nil {
+		for _, svc := range job.services {
+			c.prometheusMetrics.RecordMirrorDropped(svc.Name, dropReasonQueueFull)
+		}
+	}
+	return false
+}
+
+// sendDeferredMirrors sends a job's deferred requests, taking turns as the route's fan-out
+// allows, then compares their responses with the primary's and releases the request body
+func (c *Conductor) sendDeferredMirrors(job deferredMirrorJob) {
+	gate := c.newFanOutGate(job.route)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := job.results
+	for _, service := range job.services {
+		wg.Add(1)
+		go func(svc *Service) {
+			defer wg.Done()
+			ctx, cancel := c.mirrorContext(job.ctx, svc)
+			defer cancel()
+			if !c.enterFanOut(ctx, gate, svc, job.req, false) {
+				return
+			}
+			defer gate.Leave()
+			if !c.admitMirror(ctx, svc, job.req, true) {
+				return
+			}
+
+			result := c.makeServiceRequest(ctx, svc, job.req, job.body)
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(service)
+	}
+	wg.Wait()
+
+	if err := job.body.Close(); err != nil {
+		logger.Error("Failed to remove spooled request body", err)
+	}
+	if revalidating(job.req.Context()) == nil {
+		c.submitComparison(job.route, job.req.Method, job.req.URL.Path, results)
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestDeferredMirrors tests that shadows are only sent once the primary answered, run to
+// completion after the client is answered and are dropped when the queue is full
+func TestDeferredMirrors(t *testing.T) {
+	var answered atomic.Bool
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		answered.Store(true)
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	var calls, early, completed atomic.Int32
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !answered.Load() {
+			early.Add(1)
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+			completed.Add(1)
+		case <-r.Context().Done():
+		}
+	}))
+	defer shadow.Close()
+
+	tests := []struct {
+		name          string
+		deferred      config.DeferredMirrorsConfig
+		wantCalls     int32
+		wantCompleted int32
+	}{
+		{name: "sent after the primary", deferred: config.DeferredMirrorsConfig{Enabled: true, Workers: 1, QueueSize: 10}, wantCalls: 2, wantCompleted: 2},
+		{name: "dropped when the queue is full", deferred: config.DeferredMirrorsConfig{Enabled: true}, wantCalls: 0, wantCompleted: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answered.Store(false)
+			calls.Store(0)
+			early.Store(0)
+			completed.Store(0)
+			conductor := NewConductor(&config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "api", URL: primary.URL, PathPrefix: "/api", Primary: true},
+					{Name: "api-shadow", URL: shadow.URL, PathPrefix: "/api"},
+					{Name: "api-next", URL: shadow.URL, PathPrefix: "/api", Mirror: true},
+				},
+				DeferredMirrors: tt.deferred,
+			})
+
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/users", nil))
+			if recorder.Code != http.StatusOK || recorder.Body.String() != "primary" {
+				t.Errorf("Expected the primary's response, got %d %q", recorder.Code, recorder.Body.String())
+			}
+
+			// Shadows are queued once the primary's request finished, and closing waits for them
+			for deadline := time.Now().Add(2 * time.Second); calls.Load() < tt.wantCalls && time.Now().Before(deadline); {
+				time.Sleep(5 * time.Millisecond)
+			}
+			conductor.Close()
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("Expected %d shadow requests, got %d", tt.wantCalls, got)
+			}
+			if got := completed.Load(); got != tt.wantCompleted {
+				t.Errorf("Expected %d shadow requests to complete, got %d", tt.wantCompleted, got)
+			}
+			if got := early.Load(); got != 0 {
+				t.Errorf("Expected no shadow request before the primary answered, got %d", got)
+			}
+		})
+	}
+}
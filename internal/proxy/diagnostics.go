@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/version"
+)
+
+// Diagnostics summarizes how a configuration is served, so deployments can be verified
+// from a single report
+type Diagnostics struct {
+	Version    string                `json:"version"`
+	Listeners  []ListenerDiagnostics `json:"listeners"`
+	Routes     map[string]int        `json:"routes"` // Routes by kind: exact, regex, prefix or path
+	Backends   []BackendDiagnostics  `json:"backends"`
+	TLS        TLSDiagnostics        `json:"tls"`
+	Subsystems []string              `json:"subsystems"` // Enabled subsystems, by configuration key
+}
+
+// ListenerDiagnostics is an address the conductor listens on
+type ListenerDiagnostics struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// BackendDiagnostics is a backend service and the addresses its host resolved to
+type BackendDiagnostics struct {
+	Service   string   `json:"service"`
+	Route     string   `json:"route"`
+	URL       string   `json:"url"`
+	TLS       bool     `json:"tls"`
+	Addresses []string `json:"addresses,omitempty"`
+	Error     string   `json:"error,omitempty"` // Why the host could not be resolved
+}
+
+// TLSDiagnostics summarizes the TLS configuration. Listeners without a certificate serve
+// plain HTTP, so TLS toward clients is terminated in front of the conductor.
+type TLSDiagnostics struct {
+	Listeners         bool     `json:"listeners"`                     // Listeners serve HTTPS
+	MinVersion        string   `json:"min_version,omitempty"`         // Oldest protocol version accepted by the listeners
+	Backends          int      `json:"backends"`                      // Backends reached over HTTPS
+	PlaintextBackends int      `json:"plaintext_backends"`            // Backends reached over plain HTTP
+	ClientCertMethods []string `json:"client_cert_methods,omitempty"` // Auth methods verifying client certificates
+}
+
+// NewDiagnostics builds the diagnostics of a configuration, resolving every backend host
+// at once within the context's deadline
+func NewDiagnostics(ctx context.Context, cfg *config.Config) *Diagnostics {
+	d := &Diagnostics{
+		Version:    version.Version,
+		Listeners:  []ListenerDiagnostics{{Name: DefaultListener, Address: cfg.Listen}},
+		Routes:     make(map[string]int),
+		Backends:   make([]BackendDiagnostics, len(cfg.Services)),
+		Subsystems: enabledSubsystems(cfg),
+	}
+	for _, listener := range cfg.Listeners {
+		d.Listeners = append(d.Listeners, ListenerDiagnostics{Name: listener.Name, Address: listener.Address})
+	}
+
+	routes := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i, svcConfig := range cfg.Services {
+		kind, pattern := routeKind(svcConfig)
+		if kind != "" && !routes[kind+" "+pattern] {
+			routes[kind+" "+pattern] = true
+			d.Routes[kind]++
+		}
+
+		// Templated URLs are resolved with their variables' defaults, as for health checks
+		defaults := make(map[string]string)
+		for _, variable := range svcConfig.Variables {
+			defaults[variable.Name] = variable.Default
+		}
+		backend := &d.Backends[i]
+		*backend = BackendDiagnostics{Service: svcConfig.Name, Route: routeName(svcConfig), URL: svcConfig.URL}
+		target, err := url.Parse(expandTemplate(svcConfig.URL, defaults, nil))
+		if err != nil {
+			backend.Error = err.Error()
+			continue
+		}
+		backend.TLS = target.Scheme == "https"
+		if backend.TLS {
+			d.TLS.Backends++
+		} else {
+			d.TLS.PlaintextBackends++
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addresses, err := net.DefaultResolver.LookupHost(ctx, target.Hostname())
+			if err != nil {
+				backend.Error = err.Error()
+				return
+			}
+			backend.Addresses = addresses
+		}()
+	}
+	wg.Wait()
+
+	d.TLS.Listeners = cfg.TLS.CertFile != ""
+	if d.TLS.Listeners {
+		d.TLS.MinVersion = cfg.TLS.MinVersion
+	}
+	for name, method := range cfg.Auth.Methods {
+		if method.Type == authTypeMTLS {
+			d.TLS.ClientCertMethods = append(d.TLS.ClientCertMethods, name)
+		}
+	}
+	sort.Strings(d.TLS.ClientCertMethods)
+	return d
+}
+
+// Unresolved returns the names of the services whose backend could not be resolved
+func (d *Diagnostics) Unresolved() []string {
+	var services []string
+	for _, backend := range d.Backends {
+		if backend.Error != "" {
+			services = append(services, backend.Service)
+		}
+	}
+	return services
+}
+
+// routeKind returns the kind of route a service registers and its pattern, following the
+// precedence of the router
+func routeKind(svcConfig config.Service) (string, string) {
+	switch {
+	case svcConfig.PathExact != "":
+		return "exact", svcConfig.PathExact
+	case svcConfig.PathRegex != "":
+		return "regex", svcConfig.PathRegex
+	case svcConfig.PathPrefix != "":
+		return "prefix", svcConfig.PathPrefix
+	case svcConfig.Path != "":
+		return "path", svcConfig.Path
+	default:
+		return "", ""
+	}
+}
+
+// enabledSubsystems returns the configuration keys of the enabled subsystems
+func enabledSubsystems(cfg *config.Config) []string {
+	subsystems := []struct {
+		name    string
+		enabled bool
+	}{
+		{"metrics", cfg.Metrics.Enabled},
+		{"metrics.prometheus", cfg.Metrics.Enabled && cfg.Metrics.EnablePrometheus},
+		{"metrics.push", cfg.Metrics.Push.URL != ""},
+		{"dns", cfg.DNS.Enabled},
+		{"bodySpool", cfg.BodySpool.ThresholdMB > 0},
+		{"slo", cfg.SLO.Enabled},
+		{"dedup", cfg.Dedup.Enabled},
+		{"bandwidth", len(cfg.Bandwidth) > 0},
+		{"health", cfg.Health.FailureThreshold > 0},
+		{"failover", len(cfg.Failover) > 0},
+		{"comparison", cfg.Comparison.Enabled},
+		{"admin", cfg.Admin.Enabled},
+		{"budgets", len(cfg.Budgets) > 0},
+		{"overload", cfg.Overload.MaxInFlight > 0},
+		{"headerLimits", cfg.HeaderLimits.MaxBytes > 0 || cfg.HeaderLimits.MaxCount > 0},
+		{"quota", cfg.Quota.Enabled},
+		{"compression", cfg.Compression.Enabled},
+		{"loopDetection", cfg.LoopDetection.Enabled},
+		{"auth", len(cfg.Auth.Routes) > 0},
+		{"cache", cfg.Cache.Enabled},
+		{"methodOverride", cfg.MethodOverride.Enabled},
+		{"readiness", cfg.Readiness.Enabled},
+		{"cors", len(cfg.CORS) > 0},
+		{"signatures", len(cfg.Signatures) > 0},
+		{"faults", cfg.Faults.Enabled},
+		{"mirrorGuard", cfg.MirrorGuard.Enabled},
+		{"selectionHints", cfg.SelectionHints.Enabled},
+		{"onDemandMirror", cfg.OnDemandMirror.Enabled},
+		{"contentTypes", len(cfg.ContentTypes) > 0},
+		{"mirrorShaping", len(cfg.MirrorShaping) > 0},
+		{"readYourWrites", cfg.ReadYourWrites.Enabled},
+		{"assertions", len(cfg.Assertions) > 0},
+		{"streaming", cfg.Streaming.Enabled},
+		{"partialResults", cfg.PartialResults.Enabled},
+		{"reload", cfg.Reload.Watch},
+		{"flags", cfg.Flags.Provider != ""},
+		{"postProcessing", len(cfg.PostProcessing.Processors) > 0},
+		{"fanOut", len(cfg.FanOut) > 0},
+		{"deferredMirrors", cfg.DeferredMirrors.Enabled},
+		{"routeCache", cfg.RouteCache.Enabled},
+		{"accessLog", cfg.AccessLog.Enabled},
+		{"authz", len(cfg.Authz) > 0},
+		{"annotations", cfg.Annotations.Backend || cfg.Annotations.Client},
+		{"capture", cfg.Capture.Enabled},
+		{"adaptiveTimeout", cfg.AdaptiveTimeout.Enabled},
+	}
+
+	enabled := []string{}
+	for _, subsystem := range subsystems {
+		if subsystem.enabled {
+			enabled = append(enabled, subsystem.name)
+		}
+	}
+	return enabled
+}
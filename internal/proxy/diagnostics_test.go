@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestDiagnostics tests that the report counts routes by kind, resolves backends and
+// lists the TLS configuration and enabled subsystems
+func TestDiagnostics(t *testing.T) {
+	cfg := &config.Config{
+		Listen:    ":8080",
+		Listeners: []config.ListenerConfig{{Name: "internal", Address: "10.0.0.5:8081"}},
+		Services: []config.Service{
+			{Name: "api", URL: "https://127.0.0.1:8443", PathPrefix: "/api", Primary: true},
+			{Name: "api-next", URL: "http://127.0.0.2:8080", PathPrefix: "/api", Mirror: true},
+			{Name: "health", URL: "http://127.0.0.1:9000", PathExact: "/health"},
+			{Name: "tenants", URL: "http://${host}:9000", PathRegex: "/tenants/[0-9]+", Variables: []config.VariableConfig{
+				{Name: "host", From: "header", Key: "X-Tenant-Host", Default: "127.0.0.3"},
+			}},
+			{Name: "broken", URL: "http://%zz", Path: "/broken"},
+		},
+		Auth: config.AuthConfig{Methods: map[string]config.AuthMethodConfig{
+			"internal": {Type: "mtls", Subjects: []string{"billing"}},
+			"partners": {Type: "apiKey"},
+		}},
+		Cache: config.CacheConfig{Enabled: true},
+	}
+
+	d := NewDiagnostics(context.Background(), cfg)
+
+	wantListeners := []ListenerDiagnostics{{Name: "default", Address: ":8080"}, {Name: "internal", Address: "10.0.0.5:8081"}}
+	if !reflect.DeepEqual(d.Listeners, wantListeners) {
+		t.Errorf("Expected listeners %v, got %v", wantListeners, d.Listeners)
+	}
+	wantRoutes := map[string]int{"exact": 1, "regex": 1, "prefix": 1, "path": 1}
+	if !reflect.DeepEqual(d.Routes, wantRoutes) {
+		t.Errorf("Expected routes %v, got %v", wantRoutes, d.Routes)
+	}
+
+	wantAddresses := map[string]string{"api": "127.0.0.1", "api-next": "127.0.0.2", "health": "127.0.0.1", "tenants": "127.0.0.3"}
+	for _, backend := range d.Backends {
+		want, ok := wantAddresses[backend.Service]
+		if !ok {
+			continue
+		}
+		if !reflect.DeepEqual(backend.Addresses, []string{want}) || backend.Error != "" {
+			t.Errorf("Expected %s to resolve to %s, got %v (%s)", backend.Service, want, backend.Addresses, backend.Error)
+		}
+	}
+	if unresolved := d.Unresolved(); !reflect.DeepEqual(unresolved, []string{"broken"}) {
+		t.Errorf("Expected only broken to be unresolved, got %v", unresolved)
+	}
+
+	wantTLS := TLSDiagnostics{Backends: 1, PlaintextBackends: 3, ClientCertMethods: []string{"internal"}}
+	if !reflect.DeepEqual(d.TLS, wantTLS) {
+		t.Errorf("Expected TLS %+v, got %+v", wantTLS, d.TLS)
+	}
+	if !reflect.DeepEqual(d.Subsystems, []string{"cache"}) {
+		t.Errorf("Expected subsystems [cache], got %v", d.Subsystems)
+	}
+}
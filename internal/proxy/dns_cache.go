@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsLookupTimeout bounds background refreshes, which are not tied to any request
+const dnsLookupTimeout = 5 * time.Second
+
+// dnsEntry is a cached resolution result for a single hostname
+type dnsEntry struct {
+	addrs      []string
+	err        error
+	expires    time.Time
+	refreshing bool
+}
+
+// dnsCache resolves backend hostnames with TTL-bounded caching. Expired entries are
+// served for up to one more TTL while being refreshed in the background, and failed
+// lookups are cached for a shorter negative TTL.
+type dnsCache struct {
+	mu          sync.Mutex
+	entries     map[string]*dnsEntry
+	ttl         time.Duration
+	negativeTTL time.Duration
+	lookup      func(ctx context.Context, host string) ([]string, error)
+	onFailure   func(host string, err error)
+}
+
+// newDNSCache creates a DNS cache backed by the system resolver
+func newDNSCache(ttl, negativeTTL time.Duration, onFailure func(host string, err error)) *dnsCache {
+	return &dnsCache{
+		entries:     make(map[string]*dnsEntry),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		lookup:      net.DefaultResolver.LookupHost,
+		onFailure:   onFailure,
+	}
+}
+
+// Resolve returns the addresses for host, using the cache when possible
+func (d *dnsCache) Resolve(ctx context.Context, host string) ([]string, error) {
+	now := time.Now()
+
+	d.mu.Lock()
+	entry, ok := d.entries[host]
+	if ok {
+		// Fresh positive or negative entry
+		if now.Before(entry.expires) {
+			d.mu.Unlock()
+			return entry.addrs, entry.err
+		}
+
+		// Recently expired positive entry: serve it while refreshing in the background
+		if entry.err == nil && now.Before(entry.expires.Add(d.ttl)) {
+			if !entry.refreshing {
+				entry.refreshing = true
+				go d.refresh(host)
+			}
+			d.mu.Unlock()
+			return entry.addrs, nil
+		}
+	}
+	d.mu.Unlock()
+
+	return d.resolveAndStore(ctx, host)
+}
+
+// refresh re-resolves a host in the background
+func (d *dnsCache) refresh(host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		d.recordFailure(host, err)
+
+		// Keep serving the previous addresses until they become too stale
+		d.mu.Lock()
+		if entry, ok := d.entries[host]; ok {
+			entry.refreshing = false
+		}
+		d.mu.Unlock()
+		return
+	}
+
+	d.store(host, addrs, nil)
+}
+
+// resolveAndStore performs a synchronous lookup and caches the outcome
+func (d *dnsCache) resolveAndStore(ctx context.Context, host string) ([]string, error) {
+	addrs, err := d.lookup(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: "no addresses found", Name: host, IsNotFound: true}
+	}
+
+	// Don't cache failures caused by the caller giving up
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+
+	if err != nil {
+		d.recordFailure(host, err)
+	}
+	d.store(host, addrs, err)
+	return addrs, err
+}
+
+// store caches a lookup result with the TTL matching its outcome
+func (d *dnsCache) store(host string, addrs []string, err error) {
+	ttl := d.ttl
+	if err != nil {
+		ttl = d.negativeTTL
+	}
+
+	d.mu.Lock()
+	d.entries[host] = &dnsEntry{
+		addrs:   addrs,
+		err:     err,
+		expires: time.Now().Add(ttl),
+	}
+	d.mu.Unlock()
+}
+
+// recordFailure reports a failed resolution
+func (d *dnsCache) recordFailure(host string, err error) {
+	if d.onFailure != nil {
+		d.onFailure(host, err)
+	}
+}
+
+// DialContext returns a dial function that resolves hostnames through the cache and
+// tries each resolved address in turn
+func (d *dnsCache) DialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// Literal IPs need no resolution
+		if net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := d.Resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var dialErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = err
+		}
+
+		if dialErr == nil {
+			dialErr = errors.New("no addresses to dial for " + host)
+		}
+		return nil, dialErr
+	}
+}
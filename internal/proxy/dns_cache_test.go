@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver counts lookups and returns configurable results
+type fakeResolver struct {
+	mu    sync.Mutex
+	calls int
+	addrs []string
+	err   error
+}
+
+func (f *fakeResolver) lookup(ctx context.Context, host string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return f.addrs, f.err
+}
+
+func (f *fakeResolver) set(addrs []string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addrs = addrs
+	f.err = err
+}
+
+func (f *fakeResolver) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestDNSCachePositive(t *testing.T) {
+	resolver := &fakeResolver{addrs: []string{"10.0.0.1"}}
+	cache := newDNSCache(50*time.Millisecond, 10*time.Millisecond, nil)
+	cache.lookup = resolver.lookup
+
+	// Repeated lookups within the TTL hit the cache
+	for i := 0; i < 3; i++ {
+		addrs, err := cache.Resolve(context.Background(), "backend.example.com")
+		if err != nil || len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+			t.Fatalf("Unexpected resolution result: %v, %v", addrs, err)
+		}
+	}
+	if calls := resolver.callCount(); calls != 1 {
+		t.Errorf("Expected 1 lookup, got %d", calls)
+	}
+
+	// After expiry the stale address is served while refreshing in the background
+	resolver.set([]string{"10.0.0.2"}, nil)
+	time.Sleep(60 * time.Millisecond)
+
+	addrs, err := cache.Resolve(context.Background(), "backend.example.com")
+	if err != nil || addrs[0] != "10.0.0.1" {
+		t.Errorf("Expected stale address while refreshing, got %v, %v", addrs, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		addrs, _ = cache.Resolve(context.Background(), "backend.example.com")
+		if addrs[0] == "10.0.0.2" {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if addrs[0] != "10.0.0.2" {
+		t.Errorf("Expected refreshed address, got %v", addrs)
+	}
+}
+
+func TestDNSCacheNegative(t *testing.T) {
+	resolver := &fakeResolver{err: errors.New("no such host")}
+	var failures int
+	cache := newDNSCache(time.Minute, 50*time.Millisecond, func(host string, err error) {
+		failures++
+	})
+	cache.lookup = resolver.lookup
+
+	// Failures are cached for the negative TTL
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Resolve(context.Background(), "missing.example.com"); err == nil {
+			t.Fatalf("Expected resolution error")
+		}
+	}
+	if calls := resolver.callCount(); calls != 1 {
+		t.Errorf("Expected 1 lookup, got %d", calls)
+	}
+	if failures != 1 {
+		t.Errorf("Expected 1 recorded failure, got %d", failures)
+	}
+
+	// Once the negative entry expires the host is resolved again
+	resolver.set([]string{"10.0.0.3"}, nil)
+	time.Sleep(60 * time.Millisecond)
+
+	addrs, err := cache.Resolve(context.Background(), "missing.example.com")
+	if err != nil || len(addrs) != 1 || addrs[0] != "10.0.0.3" {
+		t.Errorf("Expected recovered resolution, got %v, %v", addrs, err)
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Error codes returned in conductor-generated error responses
+const (
+	ErrCodeNoRoute              = "no_route"
+	ErrCodeReadBodyFailed       = "read_body_failed"
+	ErrCodeUpstreamFailed       = "upstream_failed"
+	ErrCodeUpstreamTimeout      = "upstream_timeout"
+	ErrCodeRateLimited          = "rate_limited"
+	ErrCodePayloadTooLarge      = "payload_too_large"
+	ErrCodeOverloaded           = "overloaded"
+	ErrCodeHeadersTooLarge      = "headers_too_large"
+	ErrCodeQuotaExceeded        = "quota_exceeded"
+	ErrCodeLoopDetected         = "loop_detected"
+	ErrCodeUnauthorized         = "unauthorized"
+	ErrCodeForbidden            = "forbidden"
+	ErrCodeInvalidSignature     = "invalid_signature"
+	ErrCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrCodeAssertionFailed      = "assertion_failed"
+	ErrCodeRequestTimeout       = "request_timeout"
+	ErrCodeHandlerTimeout       = "handler_timeout"
+)
+
+// ErrorResponse is the JSON envelope for errors generated by the conductor itself
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Status    int    `json:"status"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeError writes a JSON error response carrying a machine-readable code and the request ID
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID != "" {
+		w.Header().Set(requestIDHeader, requestID)
+	}
+	w.WriteHeader(status)
+
+	data := ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Status:    status,
+		RequestID: requestID,
+	}
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.ErrorWithFields("Failed to encode error response", err, map[string]interface{}{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"code":   code,
+		})
+	}
+}
+
+// isTimeoutError reports whether an upstream error was caused by an exceeded deadline
+func isTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// failureStatus maps an upstream error to the status code returned to the client
+func (c *Conductor) failureStatus(err error) int {
+	mapping := c.config.ErrorMapping
+
+	if isTimeoutError(err) {
+		if mapping.Timeout != 0 {
+			return mapping.Timeout
+		}
+		return http.StatusGatewayTimeout
+	}
+
+	if mapping.Connection != 0 {
+		return mapping.Connection
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// boolExpr is a parsed boolean expression over named terms, evaluated against a T
+type boolExpr[T any] interface {
+	Eval(v T) bool
+}
+
+// exprAll requires every operand
+type exprAll[T any] []boolExpr[T]
+
+// Eval implements boolExpr
+func (e exprAll[T]) Eval(v T) bool {
+	for _, expr := range e {
+		if !expr.Eval(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// exprAny requires at least one operand
+type exprAny[T any] []boolExpr[T]
+
+// Eval implements boolExpr
+func (e exprAny[T]) Eval(v T) bool {
+	for _, expr := range e {
+		if expr.Eval(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// exprParser parses expressions such as "a OR (b AND c)". AND binds tighter than OR, and
+// && and || may be used in place of the keywords. Terms are resolved by name.
+type exprParser[T any] struct {
+	tokens  []string
+	pos     int
+	kind    string // What the expression is, for error messages
+	resolve func(name string) (boolExpr[T], error)
+}
+
+// parseBoolExpr parses an expression, resolving each term with resolve
+func parseBoolExpr[T any](expr string, kind string, resolve func(name string) (boolExpr[T], error)) (boolExpr[T], error) {
+	replacer := strings.NewReplacer("(", " ( ", ")", " ) ", "&&", " AND ", "||", " OR ")
+	p := &exprParser[T]{tokens: strings.Fields(replacer.Replace(expr)), kind: kind, resolve: resolve}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty %s", kind)
+	}
+
+	result, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in %s %q", p.tokens[p.pos], kind, expr)
+	}
+	return result, nil
+}
+
+// peek returns the next token, or an empty string at the end
+func (p *exprParser[T]) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// parseOr parses operands separated by OR
+func (p *exprParser[T]) parseOr() (boolExpr[T], error) {
+	var operands exprAny[T]
+	for {
+		operand, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if !strings.EqualFold(p.peek(), "OR") {
+			break
+		}
+		p.pos++
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return operands, nil
+}
+
+// parseAnd parses operands separated by AND
+func (p *exprParser[T]) parseAnd() (boolExpr[T], error) {
+	var operands exprAll[T]
+	for {
+		operand, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if !strings.EqualFold(p.peek(), "AND") {
+			break
+		}
+		p.pos++
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return operands, nil
+}
+
+// parseOperand parses a term or a parenthesized expression
+func (p *exprParser[T]) parseOperand() (boolExpr[T], error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "":
+		return nil, errors.New(p.kind + " ends unexpectedly")
+	case token == "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("missing ) in " + p.kind)
+		}
+		p.pos++
+		return inner, nil
+	case token == ")" || strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR"):
+		return nil, fmt.Errorf("unexpected %q in %s", token, p.kind)
+	}
+	return p.resolve(token)
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// backendHealth passively tracks a backend's health from the outcome of proxied requests.
+// A backend becomes unhealthy after a run of consecutive failures and is tried again once
+// the retry delay has passed; a success then marks it healthy.
+type backendHealth struct {
+	mu             sync.Mutex
+	threshold      int
+	retryAfter     time.Duration
+	failures       int
+	unhealthySince time.Time
+}
+
+// newBackendHealth creates a tracker for a healthy backend
+func newBackendHealth(threshold int, retryAfter time.Duration) *backendHealth {
+	return &backendHealth{threshold: threshold, retryAfter: retryAfter}
+}
+
+// Healthy reports whether the backend should receive traffic
+func (h *backendHealth) Healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failures < h.threshold || time.Since(h.unhealthySince) >= h.retryAfter
+}
+
+// Record updates the health from a request outcome and reports whether the backend's
+// healthy state changed
+func (h *backendHealth) Record(success bool) (changed bool, healthy bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	wasHealthy := h.failures < h.threshold
+	if success {
+		h.failures = 0
+	} else {
+		h.failures++
+		if h.failures >= h.threshold {
+			// Restart the retry delay on every failure, including a failed retry
+			h.unhealthySince = time.Now()
+		}
+	}
+
+	healthy = h.failures < h.threshold
+	return healthy != wasHealthy, healthy
+}
+
+// recordHealth updates the service's health from the outcome of a request. Requests
+// abandoned by the client say nothing about the backend and are ignored.
+func (c *Conductor) recordHealth(svc *Service, result *serviceResult) {
+	if svc.health == nil || errors.Is(result.err, context.Canceled) {
+		return
+	}
+
+	c.updateHealth(svc, result.err == nil && result.resp.StatusCode < 500)
+}
+
+// updateHealth records a passive or active health check outcome for the service, logging
+// and reporting any change in its healthy state
+func (c *Conductor) updateHealth(svc *Service, success bool) {
+	changed, healthy := svc.health.Record(success)
+	if !changed {
+		return
+	}
+
+	fields := map[string]interface{}{"service": svc.Name}
+	if healthy {
+		logger.ForService(svc.Name).InfoWithFields("Service is healthy again", fields)
+	} else {
+		logger.ForService(svc.Name).WarnWithFields("Service marked unhealthy", fields)
+	}
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.SetServiceHealth(svc.Name, healthy)
+	}
+}
+
+// initializeFailover builds the remote cluster services for each route with failover.
+// Remote services copy the route's local primary configuration with the remote base URL,
+// and the first remote URL is primary.
+func (c *Conductor) initializeFailover(failovers []config.FailoverConfig) error {
+	for _, failover := range failovers {
+		var template *Service
+		for _, svc := range c.services {
+			if svc.Route == failover.Route && (template == nil || svc.Primary && !template.Primary) {
+				template = svc
+			}
+		}
+		if template == nil {
+			logger.WarnWithFields("Ignoring failover for unknown route", map[string]interface{}{
+				"route": failover.Route,
+			})
+			continue
+		}
+
+		for i, rawURL := range failover.URLs {
+			targetURL, err := url.Parse(rawURL)
+			if err != nil {
+				return fmt.Errorf("invalid failover URL %s: %w", rawURL, err)
+			}
+
+			svcConfig := template.Config
+			svcConfig.Name = fmt.Sprintf("%s-failover-%d", template.Name, i)
+			svcConfig.URL = rawURL
+			svcConfig.Primary = i == 0
+
+			client, err := newServiceClient(svcConfig, c.transport, c.dnsCache, c.timeout)
+			if err != nil {
+				return fmt.Errorf("invalid transport for service %s: %w", svcConfig.Name, err)
+			}
+
+			c.failover[failover.Route] = append(c.failover[failover.Route], &Service{
+				Name:      svcConfig.Name,
+				URL:       targetURL,
+				Path:      template.Path,
+				Primary:   svcConfig.Primary,
+				Route:     template.Route,
+				Config:    svcConfig,
+				client:    client,
+				headers:   template.headers,
+				variables: template.variables,
+			})
+		}
+	}
+	return nil
+}
+
+// applyFailover returns the remote cluster for the route, filtered for the request method,
+// when none of the matched local services is healthy, otherwise the local services unchanged
+func (c *Conductor) applyFailover(route string, method string, services []*Service) []*Service {
+	c.routesMu.RLock()
+	remote, ok := c.failover[route]
+	c.routesMu.RUnlock()
+	if !ok {
+		return services
+	}
+
+	for _, svc := range services {
+		if svc.health == nil || svc.health.Healthy() {
+			return services
+		}
+	}
+
+	logger.WarnWithFields("All local services unhealthy, failing over to remote cluster", map[string]interface{}{
+		"route":    route,
+		"services": getServiceNames(remote),
+	})
+	return filterForMethod(remote, method)
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// hostTransport answers requests per backend host, failing hosts marked as down
+type hostTransport struct {
+	down map[string]bool
+}
+
+func (h *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if h.down[req.URL.Host] {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(req.URL.Host)),
+	}, nil
+}
+
+// TestFailover tests failing over to the remote cluster and failing back once local recovers
+func TestFailover(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{
+				Name:       "api-local",
+				URL:        "http://local.example.com",
+				PathPrefix: "/api",
+				Primary:    true,
+			},
+		},
+		Health:   config.HealthConfig{FailureThreshold: 2, RetryAfter: 1},
+		Failover: []config.FailoverConfig{{Route: "/api", URLs: []string{"http://remote.example.com"}}},
+	}
+	conductor := NewConductor(cfg)
+	transport := &hostTransport{down: map[string]bool{"local.example.com": true}}
+	conductor.client = &http.Client{Transport: transport}
+
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/users", nil))
+		return recorder
+	}
+
+	// Local failures below the threshold are returned to the client
+	for i := 0; i < 2; i++ {
+		if recorder := get(); recorder.Code != http.StatusBadGateway {
+			t.Fatalf("Expected 502 while local is still considered healthy, got %d", recorder.Code)
+		}
+	}
+
+	// Once local is unhealthy, requests go to the remote cluster
+	if recorder := get(); recorder.Code != 200 || recorder.Body.String() != "remote.example.com" {
+		t.Fatalf("Expected response from remote cluster, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	// After the retry delay local is tried again and takes traffic back when it succeeds
+	delete(transport.down, "local.example.com")
+	time.Sleep(1100 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if recorder := get(); recorder.Body.String() != "local.example.com" {
+			t.Fatalf("Expected response from local after failback, got %q", recorder.Body.String())
+		}
+	}
+}
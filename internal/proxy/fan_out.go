@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// newFanOutLimits returns the fan-out limits of the configured routes, which must exist
+func newFanOutLimits(cfg []config.RouteFanOut, services []*Service) (map[string]config.RouteFanOut, error) {
+	known := make(map[string]bool)
+	for _, svc := range services {
+		known[svc.Route] = true
+	}
+
+	limits := make(map[string]config.RouteFanOut)
+	for _, fanOut := range cfg {
+		if !known[fanOut.Route] {
+			return nil, fmt.Errorf("fan-out limit for unknown route %q", fanOut.Route)
+		}
+		limits[fanOut.Route] = fanOut
+	}
+	return limits, nil
+}
+
+// fanOutGate holds a request's shadow and mirror requests until their turn: until one of
+// a bounded number of slots is free, and for background mirrors, until the primary answered
+type fanOutGate struct {
+	slots    chan struct{} // One per request in flight, nil if unbounded
+	primary  chan struct{} // Closed once the primary answered, nil if mirrors do not wait for it
+	answered sync.Once
+}
+
+// newFanOutGate creates the gate of a request to the route, or nil if its fan-out is not limited
+func (c *Conductor) newFanOutGate(route string) *fanOutGate {
+	limit, ok := c.currentFanOut(route)
+	if !ok {
+		return nil
+	}
+
+	g := &fanOutGate{}
+	if limit.MaxParallel > 0 {
+		g.slots = make(chan struct{}, limit.MaxParallel)
+	}
+	if limit.AfterPrimary {
+		g.primary = make(chan struct{})
+	}
+	return g
+}
+
+// Enter waits for the request's turn, reporting false if the context ended first. Callers
+// that entered must Leave once their request finished.
+func (g *fanOutGate) Enter(ctx context.Context, detached bool) bool {
+	if g == nil {
+		return true
+	}
+	if detached && g.primary != nil {
+		select {
+		case <-g.primary:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// Leave frees the slot of a request that entered
+func (g *fanOutGate) Leave() {
+	if g != nil && g.slots != nil {
+		<-g.slots
+	}
+}
+
+// PrimaryAnswered releases the background mirrors waiting for the primary
+func (g *fanOutGate) PrimaryAnswered() {
+	if g != nil && g.primary != nil {
+		g.answered.Do(func() { close(g.primary) })
+	}
+}
+
+// fanOutGateFor returns the gate a service's request waits at. On-demand mirrors are
+// always sent at once, as the client waits for their summary.
+func fanOutGateFor(gate *fanOutGate, svc *Service, originalReq *http.Request) *fanOutGate {
+	if request := onDemandOf(originalReq); request != nil && request.service == svc {
+		return nil
+	}
+	return gate
+}
+
+// enterFanOut waits for a shadow or mirror request's turn, reporting false if it is skipped
+// because the request ended first, such as a shadow still waiting when the client was
+// answered. Skipped requests are counted as dropped.
+func (c *Conductor) enterFanOut(ctx context.Context, gate *fanOutGate, svc *Service, originalReq *http.Request, detached bool) bool {
+	if gate.Enter(ctx, detached) {
+		return true
+	}
+	logger.ForService(svc.Name).DebugWithFields("Skipping shadow request that did not get its turn", map[string]interface{}{
+		"service": svc.Name,
+		"method":  originalReq.Method,
+		"path":    originalReq.URL.Path,
+	})
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordMirrorDropped(svc.Name, dropReasonNoTurn)
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestFanOutLimits tests that a route's mirrors take turns and wait for the primary
+func TestFanOutLimits(t *testing.T) {
+	const primaryDelay = 50 * time.Millisecond
+	var answered atomic.Int64 // When the primary answered, in Unix nanoseconds
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(primaryDelay)
+		answered.Store(time.Now().UnixNano())
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	var early bool // A mirror started before the primary answered
+	done := make(chan struct{}, 2)
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		early = early || answered.Load() == 0
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		done <- struct{}{}
+	}))
+	defer mirror.Close()
+
+	tests := []struct {
+		name            string
+		fanOut          []config.RouteFanOut
+		wantMaxInFlight int
+		wantEarly       bool
+	}{
+		{name: "unlimited", wantMaxInFlight: 2, wantEarly: true},
+		{name: "in series after the primary", fanOut: []config.RouteFanOut{{Route: "/api", MaxParallel: 1, AfterPrimary: true}}, wantMaxInFlight: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answered.Store(0)
+			inFlight, maxInFlight, early = 0, 0, false
+			conductor := NewConductor(&config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "api", URL: primary.URL, PathPrefix: "/api", Primary: true},
+					{Name: "api-next", URL: mirror.URL, PathPrefix: "/api", Mirror: true},
+					{Name: "api-audit", URL: mirror.URL, PathPrefix: "/api", Mirror: true},
+				},
+				FanOut: tt.fanOut,
+			})
+
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/users", nil))
+			if recorder.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", recorder.Code)
+			}
+			for i := 0; i < 2; i++ {
+				select {
+				case <-done:
+				case <-time.After(2 * time.Second):
+					t.Fatal("Mirror request never arrived")
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if maxInFlight != tt.wantMaxInFlight {
+				t.Errorf("Expected at most %d mirror requests at once, got %d", tt.wantMaxInFlight, maxInFlight)
+			}
+			if early != tt.wantEarly {
+				t.Errorf("Expected a mirror to start before the primary answered: %v, got %v", tt.wantEarly, early)
+			}
+		})
+	}
+}
+
+// TestFanOutDroppedShadows tests that shadows still waiting for their turn when the client
+// is answered are counted as dropped
+func TestFanOutDroppedShadows(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	release := make(chan struct{})
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer shadow.Close()
+	defer close(release)
+
+	conductor := NewConductor(&config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: primary.URL, PathPrefix: "/api", Primary: true},
+			{Name: "api-next", URL: shadow.URL, PathPrefix: "/api"},
+			{Name: "api-audit", URL: shadow.URL, PathPrefix: "/api"},
+		},
+		FanOut: []config.RouteFanOut{{Route: "/api", MaxParallel: 1}},
+	})
+	registry := prometheus.NewRegistry()
+	conductor.prometheusMetrics = NewPrometheusMetrics(registry)
+
+	recorder := httptest.NewRecorder()
+	conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/users", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+
+	// One shadow holds the only slot, so the other is dropped once the client is answered
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather metrics: %v", err)
+		}
+		var dropped float64
+		for _, family := range families {
+			if family.GetName() != "go_conductor_mirror_requests_dropped_total" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "reason" && label.GetValue() == dropReasonNoTurn {
+						dropped += metric.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		if dropped == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 1 shadow dropped for lack of a turn, got %v", dropped)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Faults injected into backend requests
+const (
+	faultLatency = "latency"
+	faultStatus  = "status"
+	faultDrop    = "drop"
+)
+
+// errFaultDropped is the error of a backend request whose response was dropped on purpose
+var errFaultDropped = errors.New("fault injection: response dropped")
+
+// faultInjector injects configured faults into requests to chosen services while the
+// faults are active, so selection and fallback can be rehearsed before a real incident
+type faultInjector struct {
+	mu     sync.RWMutex
+	rules  map[string]config.FaultRule // Faults by service name
+	active map[string]bool             // Services whose faults are injected
+	random func() float64
+}
+
+// faultReport is one entry of the faults admin endpoints' response body
+type faultReport struct {
+	Service   string  `json:"service"`
+	Active    bool    `json:"active"`
+	Rate      float64 `json:"rate"`
+	LatencyMs int     `json:"latency_ms,omitempty"`
+	Status    int     `json:"status,omitempty"`
+	Drop      bool    `json:"drop,omitempty"`
+}
+
+// newFaultInjector creates an injector for the configured rules, active from startup if
+// the faults are enabled. Rules must name a configured service.
+func newFaultInjector(cfg config.FaultConfig, services []*Service) (*faultInjector, error) {
+	known := make(map[string]bool)
+	for _, svc := range services {
+		known[svc.Name] = true
+	}
+
+	f := &faultInjector{
+		rules:  make(map[string]config.FaultRule),
+		active: make(map[string]bool),
+		random: rand.Float64,
+	}
+	for _, rule := range cfg.Rules {
+		if !known[rule.Service] {
+			return nil, fmt.Errorf("fault rule for unknown service %q", rule.Service)
+		}
+		f.rules[rule.Service] = rule
+		f.active[rule.Service] = cfg.Enabled
+	}
+	return f, nil
+}
+
+// carry keeps whether the faults of services that remain were active, so a reload does
+// not start or stop faults set through the admin endpoints
+func (f *faultInjector) carry(previous *faultInjector) *faultInjector {
+	if previous == nil {
+		return f
+	}
+	previous.mu.RLock()
+	defer previous.mu.RUnlock()
+	for name := range f.rules {
+		if active, ok := previous.active[name]; ok {
+			f.active[name] = active
+		}
+	}
+	return f
+}
+
+// Pick returns the rule of a service if its faults are active and the request is among
+// the affected fraction
+func (f *faultInjector) Pick(service string) (config.FaultRule, bool) {
+	f.mu.RLock()
+	rule, ok := f.rules[service]
+	active := f.active[service]
+	f.mu.RUnlock()
+	if !ok || !active || f.random() >= rule.Rate {
+		return config.FaultRule{}, false
+	}
+	return rule, true
+}
+
+// Set activates or deactivates the faults of a service, or of every service if none is given
+func (f *faultInjector) Set(service string, active bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if service == "" {
+		for name := range f.rules {
+			f.active[name] = active
+		}
+		return nil
+	}
+	if _, ok := f.rules[service]; !ok {
+		return fmt.Errorf("no fault rule for service %q", service)
+	}
+	f.active[service] = active
+	return nil
+}
+
+// Status returns the rules and whether they are active, sorted by service
+func (f *faultInjector) Status() []faultReport {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	status := make([]faultReport, 0, len(f.rules))
+	for name, rule := range f.rules {
+		status = append(status, faultReport{
+			Service:   name,
+			Active:    f.active[name],
+			Rate:      rule.Rate,
+			LatencyMs: rule.LatencyMs,
+			Status:    rule.Status,
+			Drop:      rule.Drop,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Service < status[j].Service })
+	return status
+}
+
+// sendWithFaults sends a backend request, first injecting the service's faults if they
+// are active and picked for this request
+func (c *Conductor) sendWithFaults(ctx context.Context, svc *Service, req *http.Request, targetURL string) *serviceResult {
+	faults := c.currentFaults()
+	if faults == nil {
+		return c.sendRequest(svc, req, targetURL)
+	}
+	rule, ok := faults.Pick(svc.Name)
+	if !ok {
+		return c.sendRequest(svc, req, targetURL)
+	}
+
+	if rule.LatencyMs > 0 {
+		c.recordFault(svc, faultLatency)
+		timer := time.NewTimer(time.Duration(rule.LatencyMs) * time.Millisecond)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return &serviceResult{service: svc, err: ctx.Err()}
+		}
+	}
+
+	// Answer for the backend without calling it
+	if rule.Status != 0 {
+		c.recordFault(svc, faultStatus)
+		header := http.Header{}
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		return &serviceResult{
+			service: svc,
+			resp: &http.Response{
+				Status:     fmt.Sprintf("%d %s", rule.Status, http.StatusText(rule.Status)),
+				StatusCode: rule.Status,
+				Header:     header,
+				Body:       http.NoBody,
+				Request:    req,
+			},
+			body: []byte("Injected fault\n"),
+		}
+	}
+
+	// The backend handles the request, but its response never arrives
+	result := c.sendRequest(svc, req, targetURL)
+	if rule.Drop && result.err == nil {
+		result.closeStream()
+		c.recordFault(svc, faultDrop)
+		return &serviceResult{service: svc, err: errFaultDropped}
+	}
+	return result
+}
+
+// recordFault logs and counts a fault injected into a request to a service
+func (c *Conductor) recordFault(svc *Service, fault string) {
+	logger.ForService(svc.Name).DebugWithFields("Injecting fault", map[string]interface{}{
+		"service": svc.Name,
+		"fault":   fault,
+	})
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordFaultInjection(svc.Name, fault)
+	}
+}
+
+// FaultStatusHandler creates an admin handler listing the fault rules and whether they are active
+func FaultStatusHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+		faults := c.currentFaults()
+		if faults == nil {
+			http.Error(w, "Fault injection not configured", http.StatusNotFound)
+			return
+		}
+		writeFaultStatus(w, faults)
+	}
+}
+
+// FaultControlHandler creates an admin handler that activates or deactivates the faults of
+// the service given in the "service" query parameter, or of every service without one
+func FaultControlHandler(c *Conductor, active bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodPost) {
+			return
+		}
+		faults := c.currentFaults()
+		if faults == nil {
+			http.Error(w, "Fault injection not configured", http.StatusNotFound)
+			return
+		}
+
+		service := r.URL.Query().Get("service")
+		if err := faults.Set(service, active); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		message := "Stopped fault injection"
+		if active {
+			message = "Started fault injection"
+		}
+		logger.InfoWithFields(message, map[string]interface{}{
+			"service":     service,
+			"remote_addr": r.RemoteAddr,
+		})
+		writeFaultStatus(w, faults)
+	}
+}
+
+// writeFaultStatus writes the fault rules as JSON
+func writeFaultStatus(w http.ResponseWriter, faults *faultInjector) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(faults.Status()); err != nil {
+		http.Error(w, "Failed to encode fault status: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestFaultInjection tests starting and stopping injected faults through the admin endpoints
+func TestFaultInjection(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "orders", URL: "http://orders.example.com", PathPrefix: "/orders", Primary: true},
+		},
+		Admin: config.AdminConfig{Enabled: true, Endpoint: "/admin", Token: "secret"},
+		Faults: config.FaultConfig{Rules: []config.FaultRule{
+			{Service: "api", Rate: 1, Status: 503},
+			{Service: "orders", Rate: 1, Drop: true},
+		}},
+	}
+	conductor := NewConductor(cfg)
+	transport := &countingTransport{counts: make(map[string]int)}
+	conductor.client = &http.Client{Transport: transport}
+
+	mux := http.NewServeMux()
+	SetupAdminEndpoints(mux, conductor)
+	admin := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, adminRequest("POST", target))
+		return recorder
+	}
+
+	tests := []struct {
+		name       string
+		admin      string
+		path       string
+		host       string
+		wantStatus int
+		wantCode   string
+		wantCalls  int
+	}{
+		{name: "faults inactive at startup", path: "/api/users", host: "api.example.com", wantStatus: 200, wantCalls: 1},
+		{name: "status fault skips the backend", admin: "/admin/faults/start?service=api", path: "/api/users", host: "api.example.com", wantStatus: 503, wantCalls: 0},
+		{name: "other services unaffected", path: "/orders/1", host: "orders.example.com", wantStatus: 200, wantCalls: 1},
+		{name: "dropped response reaches the backend", admin: "/admin/faults/start", path: "/orders/1", host: "orders.example.com", wantCode: ErrCodeUpstreamFailed, wantCalls: 1},
+		{name: "stopped faults", admin: "/admin/faults/stop", path: "/api/users", host: "api.example.com", wantStatus: 200, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.admin != "" {
+				if recorder := admin(tt.admin); recorder.Code != 200 {
+					t.Fatalf("Expected admin request to succeed, got %d %s", recorder.Code, recorder.Body.String())
+				}
+			}
+
+			calls := transport.count(tt.host)
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com"+tt.path, nil))
+
+			if tt.wantStatus != 0 && recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantCode != "" && !strings.Contains(recorder.Body.String(), tt.wantCode) {
+				t.Errorf("Expected %s error code, got %s", tt.wantCode, recorder.Body.String())
+			}
+			if got := transport.count(tt.host) - calls; got != tt.wantCalls {
+				t.Errorf("Expected %d backend requests, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+
+	if recorder := admin("/admin/faults/start?service=missing"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a service without faults, got %d", recorder.Code)
+	}
+}
+
+// TestFaultLatency tests that injected latency respects the request deadline and the rate
+func TestFaultLatency(t *testing.T) {
+	services := []*Service{{Name: "api"}}
+	faults, err := newFaultInjector(config.FaultConfig{
+		Enabled: true,
+		Rules:   []config.FaultRule{{Service: "api", Rate: 0.25, LatencyMs: 1000}},
+	}, services)
+	if err != nil {
+		t.Fatalf("Failed to create fault injector: %v", err)
+	}
+
+	faults.random = func() float64 { return 0.5 }
+	if _, ok := faults.Pick("api"); ok {
+		t.Error("Expected requests outside the rate to be left alone")
+	}
+
+	faults.random = func() float64 { return 0.1 }
+	conductor := &Conductor{faults: faults}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result := conductor.sendWithFaults(ctx, services[0], nil, "http://api.example.com")
+	if result.err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to cut the injected latency short, got %v", result.err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected to stop waiting at the deadline, waited %v", elapsed)
+	}
+
+	if _, err := newFaultInjector(config.FaultConfig{Rules: []config.FaultRule{{Service: "missing", Rate: 1, Drop: true}}}, services); err == nil {
+		t.Error("Expected an error for a rule naming an unknown service")
+	}
+}
@@ -0,0 +1,282 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// FlagProvider evaluates feature flags held by an external flag system. Flags the system
+// does not know or fails to evaluate are left out of the values returned.
+type FlagProvider interface {
+	Evaluate(ctx context.Context, flags []string) (map[string]interface{}, error)
+}
+
+// openFeatureProvider evaluates flags through the OpenFeature Remote Evaluation Protocol
+// (OFREP), served by flagd and other OpenFeature-compatible flag systems
+type openFeatureProvider struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// ofrepBulkResponse is the response body of an OFREP bulk evaluation
+type ofrepBulkResponse struct {
+	Flags []struct {
+		Key       string      `json:"key"`
+		Value     interface{} `json:"value"`
+		ErrorCode string      `json:"errorCode"`
+	} `json:"flags"`
+}
+
+// NewOpenFeatureProvider creates a provider evaluating flags at the OFREP endpoint of the
+// given base URL, sending the given headers with every evaluation
+func NewOpenFeatureProvider(baseURL string, headers map[string]string) FlagProvider {
+	return &openFeatureProvider{
+		url:     strings.TrimSuffix(baseURL, "/") + "/ofrep/v1/evaluate/flags",
+		headers: headers,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Evaluate evaluates every flag in one bulk request. Flags are evaluated without
+// targeting context, as they apply to all of a route's traffic.
+func (p *openFeatureProvider) Evaluate(ctx context.Context, flags []string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader([]byte(`{"context":{}}`)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range p.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("flag evaluation returned status %d", resp.StatusCode)
+	}
+
+	var bulk ofrepBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&bulk); err != nil {
+		return nil, fmt.Errorf("invalid flag evaluation response: %w", err)
+	}
+	wanted := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		wanted[flag] = true
+	}
+	values := make(map[string]interface{}, len(flags))
+	for _, flag := range bulk.Flags {
+		if wanted[flag.Key] && flag.ErrorCode == "" {
+			values[flag.Key] = flag.Value
+		}
+	}
+	return values, nil
+}
+
+// routeFlags keeps the flags controlling routes' shadow traffic evaluated, refreshing
+// them in the background so requests never wait on the flag system
+type routeFlags struct {
+	provider FlagProvider
+	routes   map[string]config.RouteFlags // Flags by route name
+	keys     []string                     // Every flag evaluated
+	interval time.Duration
+	mu       sync.RWMutex
+	values   map[string]interface{}
+	updated  time.Time
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newRouteFlags creates the flags of the configured routes, which must exist
+func newRouteFlags(provider FlagProvider, cfg config.FlagsConfig, services []*Service) (*routeFlags, error) {
+	known := make(map[string]bool)
+	for _, svc := range services {
+		known[svc.Route] = true
+	}
+
+	interval := time.Duration(cfg.Interval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	f := &routeFlags{
+		provider: provider,
+		routes:   make(map[string]config.RouteFlags),
+		interval: interval,
+		values:   make(map[string]interface{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	seen := make(map[string]bool)
+	for _, route := range cfg.Routes {
+		if !known[route.Route] {
+			return nil, fmt.Errorf("flags for unknown route %q", route.Route)
+		}
+		f.routes[route.Route] = route
+		for _, key := range []string{route.Mirror, route.MirrorPercent} {
+			if key != "" && !seen[key] {
+				seen[key] = true
+				f.keys = append(f.keys, key)
+			}
+		}
+	}
+	return f, nil
+}
+
+// run evaluates the flags at once and then on every interval until stopped
+func (f *routeFlags) run() {
+	defer close(f.done)
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		f.refresh()
+		select {
+		case <-ticker.C:
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// refresh replaces the flag values with a new evaluation, keeping the last values if it fails
+func (f *routeFlags) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), f.interval)
+	defer cancel()
+
+	values, err := f.provider.Evaluate(ctx, f.keys)
+	if err != nil {
+		logger.WarnWithFields("Failed to evaluate feature flags, keeping the last values", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	f.mu.Lock()
+	changed := fmt.Sprint(values) != fmt.Sprint(f.values)
+	f.values, f.updated = values, time.Now()
+	f.mu.Unlock()
+	if changed {
+		logger.InfoWithFields("Feature flags changed", map[string]interface{}{
+			"flags": values,
+		})
+	}
+}
+
+// Stop stops refreshing the flags
+func (f *routeFlags) Stop() {
+	close(f.stop)
+	<-f.done
+}
+
+// Mirrored reports whether a request to the route is sent to its shadow services: not if
+// the route's mirror flag is off, and by chance if its flag sets a percentage
+func (f *routeFlags) Mirrored(route string) bool {
+	f.mu.RLock()
+	values := f.values
+	f.mu.RUnlock()
+	return f.MirroredBy(route, values)
+}
+
+// MirroredBy reports whether a request to the route is sent to its shadow services by the
+// given flag values. Evaluations replace the values rather than change them, so values
+// returned earlier can still be used.
+func (f *routeFlags) MirroredBy(route string, values map[string]interface{}) bool {
+	flags, ok := f.routes[route]
+	if !ok {
+		return true
+	}
+
+	mirror, mirrorSet := values[flags.Mirror].(bool)
+	percent, percentSet := values[flags.MirrorPercent].(float64)
+
+	if mirrorSet && !mirror {
+		return false
+	}
+	if percentSet {
+		return rand.Float64()*100 < percent
+	}
+	return true
+}
+
+// Values returns the current flag values and when they were evaluated
+func (f *routeFlags) Values() (map[string]interface{}, time.Time) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.values, f.updated
+}
+
+// skipFlaggedMirrors drops the non-primary services when the route's flags turn
+// mirroring off for the request
+func (c *Conductor) skipFlaggedMirrors(route string, services []*Service) []*Service {
+	if c.flags == nil || c.routeFlagsMirrored(route) {
+		return services
+	}
+
+	for _, svc := range services {
+		if svc.Primary {
+			return []*Service{svc}
+		}
+	}
+	return services
+}
+
+// WithFlagProvider drives the configured route flags from the given provider instead of
+// the configured one, such as an adapter for a flag system without an OFREP endpoint. It
+// must be called before the conductor serves requests.
+func WithFlagProvider(c *Conductor, provider FlagProvider) error {
+	flags, err := newRouteFlags(provider, c.config.Flags, c.currentServices())
+	if err != nil {
+		return err
+	}
+	if c.flags != nil {
+		c.flags.Stop()
+	}
+	c.flags = flags
+	go flags.run()
+	return nil
+}
+
+// flagsStatus is the response body of the flags admin endpoint
+type flagsStatus struct {
+	Values  map[string]interface{} `json:"values"`
+	Updated *time.Time             `json:"updated,omitempty"`
+}
+
+// FlagsHandler creates an admin handler listing the current values of the route flags
+func FlagsHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+		if c.flags == nil {
+			http.Error(w, "Feature flags not configured", http.StatusNotFound)
+			return
+		}
+
+		values, updated := c.flags.Values()
+		status := flagsStatus{Values: values}
+		if !updated.IsZero() {
+			status.Updated = &updated
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			logger.Error("Failed to encode flags status", err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// staticFlags is a flag provider answering with fixed values
+type staticFlags map[string]interface{}
+
+func (s staticFlags) Evaluate(ctx context.Context, flags []string) (map[string]interface{}, error) {
+	return s, nil
+}
+
+// TestRouteFlags tests that route flags turn mirroring off and set the share mirrored
+func TestRouteFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    staticFlags
+		wantShare float64
+	}{
+		{name: "flags not evaluated", values: staticFlags{}, wantShare: 1},
+		{name: "mirroring on", values: staticFlags{"orders-mirror": true}, wantShare: 1},
+		{name: "mirroring off", values: staticFlags{"orders-mirror": false, "orders-percent": 100.0}, wantShare: 0},
+		{name: "no share mirrored", values: staticFlags{"orders-percent": 0.0}, wantShare: 0},
+		{name: "wrong flag type", values: staticFlags{"orders-mirror": "off"}, wantShare: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "orders", URL: "http://orders.example.com", PathPrefix: "/orders", Primary: true},
+					{Name: "orders-v2", URL: "http://orders-v2.example.com", PathPrefix: "/orders"},
+				},
+				Flags: config.FlagsConfig{Routes: []config.RouteFlags{
+					{Route: "/orders", Mirror: "orders-mirror", MirrorPercent: "orders-percent"},
+				}},
+			}
+			conductor := NewConductor(cfg)
+			if err := WithFlagProvider(conductor, tt.values); err != nil {
+				t.Fatalf("Failed to set flag provider: %v", err)
+			}
+			defer conductor.Close()
+			conductor.flags.refresh()
+
+			mirrored := 0
+			for i := 0; i < 10; i++ {
+				if len(conductor.skipFlaggedMirrors("/orders", conductor.services)) == 2 {
+					mirrored++
+				}
+			}
+			if share := float64(mirrored) / 10; share != tt.wantShare {
+				t.Errorf("Expected share mirrored %v, got %v", tt.wantShare, share)
+			}
+		})
+	}
+
+	conductor := NewConductor(&config.Config{Timeout: 5, Flags: config.FlagsConfig{Routes: []config.RouteFlags{{Route: "/missing", Mirror: "flag"}}}})
+	if err := WithFlagProvider(conductor, staticFlags{}); err == nil {
+		t.Error("Expected an error for flags of an unknown route")
+	}
+}
+
+// TestOpenFeatureProvider tests bulk evaluation against an OFREP endpoint
+func TestOpenFeatureProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/ofrep/v1/evaluate/flags" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"flags": []map[string]interface{}{
+			{"key": "orders-mirror", "value": false, "reason": "STATIC"},
+			{"key": "orders-percent", "errorCode": "TYPE_MISMATCH"},
+			{"key": "unrelated", "value": true},
+		}})
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	provider := NewOpenFeatureProvider(server.URL+"/", map[string]string{"Authorization": "Bearer token"})
+	values, err := provider.Evaluate(ctx, []string{"orders-mirror", "orders-percent"})
+	if err != nil {
+		t.Fatalf("Failed to evaluate flags: %v", err)
+	}
+	if len(values) != 1 || values["orders-mirror"] != false {
+		t.Errorf("Expected only the evaluated, requested flag, got %v", values)
+	}
+
+	if _, err := NewOpenFeatureProvider(server.URL, nil).Evaluate(ctx, []string{"orders-mirror"}); err == nil {
+		t.Error("Expected an error for a refused evaluation")
+	}
+}
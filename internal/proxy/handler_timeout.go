@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// errHandlerTimeout is the cause of a request's context ending at the handler timeout
+var errHandlerTimeout = errors.New("handler timeout exceeded")
+
+// limitBodyRead bounds reading the request body by the handler timeout, so a client
+// sending it slowly cannot hold the request open. It returns a function lifting the limit
+// once the body is read, as the server's background reads must not time out.
+func (c *Conductor) limitBodyRead(w http.ResponseWriter, requestStart time.Time) func() {
+	if c.handlerTimeout <= 0 {
+		return func() {}
+	}
+	controller := http.NewResponseController(w)
+	if err := controller.SetReadDeadline(requestStart.Add(c.handlerTimeout)); err != nil {
+		// Writers that cannot set deadlines, such as test recorders, are not limited
+		return func() {}
+	}
+	return func() { controller.SetReadDeadline(time.Time{}) }
+}
+
+// withHandlerTimeout bounds the request's processing by the handler timeout, counted
+// from when the request started
+func (c *Conductor) withHandlerTimeout(ctx context.Context, requestStart time.Time) (context.Context, context.CancelFunc) {
+	if c.handlerTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithDeadlineCause(ctx, requestStart.Add(c.handlerTimeout), errHandlerTimeout)
+}
+
+// handlerTimedOut reports whether a request's processing ended at the handler timeout
+// rather than the upstream timeout
+func handlerTimedOut(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errHandlerTimeout)
+}
+
+// handleRequestTimeout answers a client that did not send its request body within the
+// handler timeout
+func (c *Conductor) handleRequestTimeout(w http.ResponseWriter, r *http.Request, route string, requestStart time.Time, traceID string) {
+	logger.WarnWithFields("Request body not received within the handler timeout", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"route":  route,
+	})
+	// The connection cannot be reused with the rest of the body unread
+	w.Header().Set("Connection", "close")
+	writeError(w, r, http.StatusRequestTimeout, ErrCodeRequestTimeout, "Request body not received in time")
+
+	// Record rejected request in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", route, "request_timeout")
+		c.prometheusMetrics.RecordRequest("conductor", route, r.Method, "408", time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, true)
+	}
+	c.recordSLO(route, http.StatusRequestTimeout, time.Since(requestStart))
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestHandlerTimeout tests that slow request bodies are answered with 408 and slow
+// handling with 503, before the upstream timeout
+func TestHandlerTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/slow") {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Timeout:        5,
+		HandlerTimeout: 1,
+		Services: []config.Service{
+			{Name: "api", URL: backend.URL, PathPrefix: "/api", Primary: true},
+		},
+	}
+	conductor := NewConductor(cfg)
+	server := httptest.NewServer(conductor)
+	defer server.Close()
+
+	t.Run("slow handling", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/api/slow")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != http.StatusServiceUnavailable || body.Code != ErrCodeHandlerTimeout {
+			t.Errorf("Expected 503 %s, got %d %s", ErrCodeHandlerTimeout, resp.StatusCode, body.Code)
+		}
+	})
+
+	t.Run("slow body", func(t *testing.T) {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		// Send part of the body and stall
+		fmt.Fprint(conn, "POST /api/items HTTP/1.1\r\nHost: example.com\r\nContent-Length: 10\r\n\r\nabc")
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestTimeout {
+			t.Errorf("Expected status 408, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("in time", func(t *testing.T) {
+		resp, err := http.Post(server.URL+"/api/items", "text/plain", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", resp.StatusCode)
+		}
+	})
+}
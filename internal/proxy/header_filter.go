@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"strings"
+)
+
+// headerFilter decides which client headers are forwarded to a backend. Patterns are
+// header names, case-insensitive, optionally ending in * to match a prefix.
+type headerFilter struct {
+	allow []string // Forward only matching headers, all if empty
+	deny  []string // Never forward matching headers
+}
+
+// newHeaderFilter creates a filter from allow and deny patterns, or nil if both are empty
+func newHeaderFilter(allow []string, deny []string) *headerFilter {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+	canonical := func(patterns []string) []string {
+		out := make([]string, len(patterns))
+		for i, pattern := range patterns {
+			out[i] = strings.ToLower(strings.TrimSpace(pattern))
+		}
+		return out
+	}
+	return &headerFilter{allow: canonical(allow), deny: canonical(deny)}
+}
+
+// matchHeader reports whether a lowercased header name matches any pattern
+func matchHeader(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Forward reports whether a client header may be sent to the backend. The request ID is
+// always forwarded so backend logs stay correlated.
+func (f *headerFilter) Forward(name string) bool {
+	if f == nil || strings.EqualFold(name, requestIDHeader) {
+		return true
+	}
+	name = strings.ToLower(name)
+	if len(f.allow) > 0 && !matchHeader(name, f.allow) {
+		return false
+	}
+	return !matchHeader(name, f.deny)
+}
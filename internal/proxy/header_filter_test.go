@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestHeaderFilter tests allowlists, denylists and prefix patterns
+func TestHeaderFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		allow  []string
+		deny   []string
+		header string
+		want   bool
+	}{
+		{name: "no filter", header: "Authorization", want: true},
+		{name: "denied", deny: []string{"authorization"}, header: "Authorization", want: false},
+		{name: "denied prefix", deny: []string{"X-Internal-*"}, header: "X-Internal-User", want: false},
+		{name: "not denied", deny: []string{"X-Internal-*"}, header: "X-Internalish", want: true},
+		{name: "allowed", allow: []string{"Accept", "Content-Type"}, header: "content-type", want: true},
+		{name: "not allowed", allow: []string{"Accept", "Content-Type"}, header: "Cookie", want: false},
+		{name: "deny wins over allow", allow: []string{"X-*"}, deny: []string{"X-Api-Key"}, header: "X-Api-Key", want: false},
+		{name: "request ID always forwarded", allow: []string{"Accept"}, deny: []string{"X-*"}, header: "X-Request-Id", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := newHeaderFilter(tt.allow, tt.deny)
+			if got := filter.Forward(tt.header); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// hostRecordingTransport records the last request sent to each backend host
+type hostRecordingTransport struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	requests map[string]*http.Request
+}
+
+func (h *hostRecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	defer h.wg.Done()
+	h.mu.Lock()
+	h.requests[req.URL.Host] = req
+	h.mu.Unlock()
+	return &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+}
+
+// TestForwardHeadersPerService tests that filters apply only to the service configuring them
+func TestForwardHeadersPerService(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "primary", URL: "http://primary.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "vendor", URL: "http://vendor.example.com", PathPrefix: "/api", DropHeaders: []string{"Authorization", "X-Internal-*"},
+				Headers: map[string]string{"X-Internal-Source": "conductor"}},
+		},
+	}
+	conductor := NewConductor(cfg)
+	transport := &hostRecordingTransport{requests: make(map[string]*http.Request)}
+	transport.wg.Add(2)
+	conductor.client = &http.Client{Transport: transport}
+
+	req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+	req.Header.Set("Authorization", "Bearer internal")
+	req.Header.Set("X-Internal-User", "alice")
+	req.Header.Set("Accept", "application/json")
+	conductor.ServeHTTP(httptest.NewRecorder(), req)
+	transport.wg.Wait()
+
+	primary, vendor := transport.requests["primary.example.com"], transport.requests["vendor.example.com"]
+	if primary == nil || vendor == nil {
+		t.Fatalf("Expected requests to both services")
+	}
+	if primary.Header.Get("Authorization") == "" || primary.Header.Get("X-Internal-User") == "" {
+		t.Errorf("Expected primary to receive every header, got %v", primary.Header)
+	}
+	if vendor.Header.Get("Authorization") != "" || vendor.Header.Get("X-Internal-User") != "" {
+		t.Errorf("Expected internal headers to be dropped for the vendor, got %v", vendor.Header)
+	}
+	if vendor.Header.Get("Accept") == "" || vendor.Header.Get("X-Internal-Source") != "conductor" {
+		t.Errorf("Expected other and configured headers to be sent to the vendor, got %v", vendor.Header)
+	}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// headerSize returns the number of header fields and their total size, counting each value
+// of a repeated header as a separate field with its name, as it would appear on the wire
+func headerSize(header http.Header) (count int, size int) {
+	for name, values := range header {
+		for _, value := range values {
+			count++
+			size += len(name) + len(value)
+		}
+	}
+	return count, size
+}
+
+// checkHeaderLimits reports whether the request headers are within the configured limits
+func (c *Conductor) checkHeaderLimits(r *http.Request) bool {
+	limits := c.config.HeaderLimits
+	if limits.MaxBytes == 0 && limits.MaxCount == 0 {
+		return true
+	}
+
+	count, size := headerSize(r.Header)
+	return (limits.MaxCount == 0 || count <= limits.MaxCount) && (limits.MaxBytes == 0 || size <= limits.MaxBytes)
+}
+
+// handleHeadersTooLarge rejects a request whose headers exceed the configured limits
+func (c *Conductor) handleHeadersTooLarge(w http.ResponseWriter, r *http.Request, requestStart time.Time, traceID string) {
+	count, size := headerSize(r.Header)
+	logger.WarnWithFields("Request headers exceed limits", map[string]interface{}{
+		"method":       r.Method,
+		"path":         r.URL.Path,
+		"header_count": count,
+		"header_bytes": size,
+	})
+	writeError(w, r, http.StatusRequestHeaderFieldsTooLarge, ErrCodeHeadersTooLarge, "Request headers exceed the configured limits")
+
+	// Record rejected request in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", "none", "headers_too_large")
+		c.prometheusMetrics.RecordRequest("conductor", "none", r.Method, "431", time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics("none", requestStart, true)
+	}
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestHeaderLimits tests that requests with too many or too large headers are rejected with 431
+func TestHeaderLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     config.HeaderLimitsConfig
+		headers    map[string][]string
+		wantStatus int
+	}{
+		{
+			name:       "no limits",
+			headers:    map[string][]string{"X-Big": {strings.Repeat("a", 4096)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "within limits",
+			limits:     config.HeaderLimitsConfig{MaxBytes: 1024, MaxCount: 10},
+			headers:    map[string][]string{"X-Small": {"value"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "too many bytes",
+			limits:     config.HeaderLimitsConfig{MaxBytes: 1024},
+			headers:    map[string][]string{"X-Big": {strings.Repeat("a", 1024)}},
+			wantStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		{
+			name:       "too many repeated values",
+			limits:     config.HeaderLimitsConfig{MaxCount: 5},
+			headers:    map[string][]string{"X-Repeated": {"1", "2", "3", "4", "5"}},
+			wantStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+				},
+				HeaderLimits: tt.limits,
+			}
+			conductor := NewConductor(cfg)
+			transport := &recordingTransport{}
+			conductor.client = &http.Client{Transport: transport}
+
+			req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+			for name, values := range tt.headers {
+				req.Header[name] = values
+			}
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus != http.StatusOK && len(transport.requests) != 0 {
+				t.Errorf("Expected rejected request not to reach the backend")
+			}
+		})
+	}
+}
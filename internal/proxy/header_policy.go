@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// Policies reducing the values of a response header
+const (
+	headerPolicyFirst = "first" // Keep the first value
+	headerPolicyLast  = "last"  // Keep the last value
+	headerPolicyMerge = "merge" // Join the distinct list elements of every value into one value
+	headerPolicyKeep  = "keep"  // Send every value as is
+)
+
+// defaultHeaderPolicies reduce the headers a response may only carry once, and the lists
+// the conductor and backends both add to. Values set by the conductor come before the
+// backend's, so the first value is the conductor's.
+var defaultHeaderPolicies = map[string]string{
+	"Access-Control-Allow-Credentials": headerPolicyFirst,
+	"Access-Control-Allow-Origin":      headerPolicyFirst,
+	"Age":                              headerPolicyFirst,
+	"Content-Length":                   headerPolicyFirst,
+	"Content-Location":                 headerPolicyFirst,
+	"Content-Range":                    headerPolicyFirst,
+	"Content-Type":                     headerPolicyFirst,
+	"Date":                             headerPolicyFirst,
+	"Etag":                             headerPolicyFirst,
+	"Expires":                          headerPolicyFirst,
+	"Last-Modified":                    headerPolicyFirst,
+	"Location":                         headerPolicyFirst,
+	"Retry-After":                      headerPolicyFirst,
+	"Server":                           headerPolicyFirst,
+	"Cache-Control":                    headerPolicyMerge,
+	"Vary":                             headerPolicyMerge,
+}
+
+// headerPolicies reduce response headers carrying several values, by canonical header name
+type headerPolicies map[string]string
+
+// newHeaderPolicies creates the default policies overridden by the configured ones
+func newHeaderPolicies(cfg config.ResponseHeadersConfig) headerPolicies {
+	policies := make(headerPolicies, len(defaultHeaderPolicies)+len(cfg.Policies))
+	for name, policy := range defaultHeaderPolicies {
+		policies[name] = policy
+	}
+	for _, policy := range cfg.Policies {
+		policies[http.CanonicalHeaderKey(policy.Header)] = policy.Policy
+	}
+	return policies
+}
+
+// Sanitize reduces every header with several values according to its policy
+func (p headerPolicies) Sanitize(header http.Header) {
+	for name, values := range header {
+		if len(values) < 2 {
+			continue
+		}
+		switch p[name] {
+		case headerPolicyFirst:
+			header[name] = values[:1]
+		case headerPolicyLast:
+			header[name] = values[len(values)-1:]
+		case headerPolicyMerge:
+			header[name] = []string{mergeHeaderValues(values)}
+		}
+	}
+}
+
+// mergeHeaderValues joins the list elements of header values, dropping repeated ones.
+// Elements compare case-insensitively, as header tokens do.
+func mergeHeaderValues(values []string) string {
+	var merged []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, element := range splitHeaderList(value) {
+			if key := strings.ToLower(element); !seen[key] {
+				seen[key] = true
+				merged = append(merged, element)
+			}
+		}
+	}
+	return strings.Join(merged, ", ")
+}
+
+// splitHeaderList splits a comma-separated header value into its trimmed, non-empty
+// elements, leaving commas inside quoted strings alone
+func splitHeaderList(value string) []string {
+	var elements []string
+	quoted, escaped, start := false, false, 0
+	add := func(element string) {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	for i := 0; i < len(value); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && value[i] == '\\':
+			escaped = true
+		case value[i] == '"':
+			quoted = !quoted
+		case value[i] == ',' && !quoted:
+			add(value[start:i])
+			start = i + 1
+		}
+	}
+	add(value[start:])
+	return elements
+}
+
+// bodyAllowed reports whether a response with the status code carries a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
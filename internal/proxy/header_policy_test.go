@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestSanitizeHeaders tests that headers with several values are reduced by their policy
+func TestSanitizeHeaders(t *testing.T) {
+	policies := newHeaderPolicies(config.ResponseHeadersConfig{Policies: []config.HeaderPolicy{
+		{Header: "x-trace", Policy: headerPolicyLast},
+		{Header: "Server", Policy: headerPolicyKeep},
+	}})
+
+	tests := []struct {
+		name   string
+		header string
+		values []string
+		want   []string
+	}{
+		{name: "first by default", header: "Content-Type", values: []string{"application/json", "text/plain"}, want: []string{"application/json"}},
+		{name: "configured last", header: "X-Trace", values: []string{"a", "b"}, want: []string{"b"}},
+		{name: "merged list", header: "Vary", values: []string{"Origin, Accept-Encoding", "accept-encoding"}, want: []string{"Origin, Accept-Encoding"}},
+		{name: "quoted commas", header: "Cache-Control", values: []string{`no-cache="Set-Cookie, Age"`, "max-age=60"}, want: []string{`no-cache="Set-Cookie, Age", max-age=60`}},
+		{name: "default overridden", header: "Server", values: []string{"conductor", "nginx"}, want: []string{"conductor", "nginx"}},
+		{name: "no policy", header: "Set-Cookie", values: []string{"a=1", "b=2"}, want: []string{"a=1", "b=2"}},
+		{name: "single value", header: "Date", values: []string{"Mon, 02 Jan 2006 15:04:05 GMT"}, want: []string{"Mon, 02 Jan 2006 15:04:05 GMT"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{tt.header: tt.values}
+			policies.Sanitize(header)
+			if got := header[tt.header]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// duplicateHeaderTransport answers with repeated headers and a Content-Length that does
+// not match the body
+type duplicateHeaderTransport struct{}
+
+func (duplicateHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: 200,
+		Header: http.Header{
+			"Content-Type":   {"application/json", "application/json; charset=utf-8"},
+			"Content-Length": {"100", "100"},
+			"Date":           {"Mon, 02 Jan 2006 15:04:05 GMT", "Tue, 03 Jan 2006 15:04:05 GMT"},
+			"Vary":           {"Accept", "Accept"},
+		},
+		Body: io.NopCloser(strings.NewReader(`{"ok":true}`)),
+	}, nil
+}
+
+// TestDuplicateResponseHeaders tests that clients receive one value of headers allowed once
+func TestDuplicateResponseHeaders(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: duplicateHeaderTransport{}}
+
+	recorder := httptest.NewRecorder()
+	conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/users", nil))
+
+	want := http.Header{
+		"Content-Type":   {"application/json"},
+		"Content-Length": {"11"},
+		"Date":           {"Mon, 02 Jan 2006 15:04:05 GMT"},
+		"Vary":           {"Accept"},
+	}
+	for name, values := range want {
+		if got := recorder.Header()[name]; !reflect.DeepEqual(got, values) {
+			t.Errorf("Expected %s %q, got %q", name, values, got)
+		}
+	}
+	if recorder.Body.String() != `{"ok":true}` {
+		t.Errorf("Expected the backend body, got %q", recorder.Body.String())
+	}
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkResult is the outcome of one active health check
+type checkResult struct {
+	Time      time.Time `json:"time"`
+	LatencyMs float64   `json:"latency_ms"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// checkHistory keeps a rolling window of a service's most recent health check results
+type checkHistory struct {
+	mu      sync.Mutex
+	results []checkResult
+	next    int // Index the next result is written to once the window is full
+}
+
+// newCheckHistory creates a history holding up to size results
+func newCheckHistory(size int) *checkHistory {
+	return &checkHistory{results: make([]checkResult, 0, size)}
+}
+
+// Record adds a result, replacing the oldest one once the window is full
+func (h *checkHistory) Record(result checkResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.results) < cap(h.results) {
+		h.results = append(h.results, result)
+		return
+	}
+	h.results[h.next] = result
+	h.next = (h.next + 1) % len(h.results)
+}
+
+// Results returns the recorded results, oldest first
+func (h *checkHistory) Results() []checkResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	results := make([]checkResult, 0, len(h.results))
+	results = append(results, h.results[h.next:]...)
+	return append(results, h.results[:h.next]...)
+}
+
+// serviceHealthReport is a service's health and check history in the health admin endpoint
+type serviceHealthReport struct {
+	Service     string        `json:"service"`
+	Healthy     bool          `json:"healthy"`
+	Transitions int           `json:"transitions"` // Changes between success and failure in the window
+	Checks      []checkResult `json:"checks"`
+}
+
+// HealthHistoryHandler creates an admin handler reporting the recent health check results
+// of every actively checked service, or of the one named by the service query parameter
+func HealthHistoryHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+
+		name := r.URL.Query().Get("service")
+		reports := []serviceHealthReport{}
+		for _, svc := range c.currentServices() {
+			if svc.checks == nil || (name != "" && svc.Name != name) {
+				continue
+			}
+
+			checks := svc.checks.Results()
+			report := serviceHealthReport{Service: svc.Name, Healthy: svc.health.Healthy(), Checks: checks}
+			for i := 1; i < len(checks); i++ {
+				if checks[i].Success != checks[i-1].Success {
+					report.Transitions++
+				}
+			}
+			reports = append(reports, report)
+		}
+		if name != "" && len(reports) == 0 {
+			http.Error(w, "No health checks for service "+name, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(reports); err != nil {
+			http.Error(w, "Failed to encode health history: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestCheckHistory tests that only the most recent results are kept, oldest first
+func TestCheckHistory(t *testing.T) {
+	history := newCheckHistory(3)
+	for i := 0; i < 5; i++ {
+		history.Record(checkResult{LatencyMs: float64(i)})
+	}
+
+	results := history.Results()
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for i, want := range []float64{2, 3, 4} {
+		if results[i].LatencyMs != want {
+			t.Errorf("Expected result %d to be %v, got %v", i, want, results[i].LatencyMs)
+		}
+	}
+}
+
+// TestHealthHistoryHandler tests reporting health check history through the admin endpoint
+func TestHealthHistoryHandler(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Health:  config.HealthConfig{FailureThreshold: 3, RetryAfter: 30},
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "search", URL: "http://search.example.com", PathPrefix: "/search", Primary: true},
+		},
+		Admin: config.AdminConfig{Enabled: true, Endpoint: "/admin", Token: "secret"},
+	}
+	conductor := NewConductor(cfg)
+	api := conductor.services[0]
+	api.checks = newCheckHistory(10)
+	now := time.Now()
+	api.checks.Record(checkResult{Time: now, LatencyMs: 1.5, Success: true})
+	api.checks.Record(checkResult{Time: now, LatencyMs: 2000, Success: false, Error: "context deadline exceeded"})
+	api.checks.Record(checkResult{Time: now, LatencyMs: 1.2, Success: true})
+
+	mux := http.NewServeMux()
+	SetupAdminEndpoints(mux, conductor)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, adminRequest("GET", "/admin/health"))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+
+	var reports []serviceHealthReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &reports); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Service != "api" {
+		t.Fatalf("Expected only the checked service, got %+v", reports)
+	}
+	if !reports[0].Healthy || reports[0].Transitions != 2 || len(reports[0].Checks) != 3 {
+		t.Errorf("Unexpected report %+v", reports[0])
+	}
+	if reports[0].Checks[1].Error != "context deadline exceeded" {
+		t.Errorf("Expected failure reason, got %q", reports[0].Checks[1].Error)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, adminRequest("GET", "/admin/health?service=search"))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a service without health checks, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Active health check types
+const (
+	healthCheckHTTP = "http"
+	healthCheckGRPC = "grpc"
+)
+
+// grpcHealthCheckPath is the method path of the standard gRPC health checking protocol
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// grpcServing is the SERVING value of grpc.health.v1.HealthCheckResponse.ServingStatus
+const grpcServing = 1
+
+// healthChecker actively probes services that configure a health check and feeds the
+// results into the same health state used by passive tracking
+type healthChecker struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startHealthChecks starts a prober for every service with an active health check
+func (c *Conductor) startHealthChecks() {
+	var checker *healthChecker
+	for _, svc := range c.currentServices() {
+		check := svc.Config.HealthCheck
+		if check == nil || svc.health == nil {
+			continue
+		}
+
+		probe, err := c.newProbe(svc, *check)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("Invalid health check for service %s", svc.Name), err)
+		}
+
+		if checker == nil {
+			checker = &healthChecker{stop: make(chan struct{})}
+		}
+		// Services kept across a reload keep their history
+		if svc.checks == nil {
+			svc.checks = newCheckHistory(check.History)
+		}
+		checker.wg.Add(1)
+		go checker.run(time.Duration(check.Interval)*time.Second, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(check.Timeout)*time.Second)
+			defer cancel()
+
+			start := time.Now()
+			err := probe(ctx)
+			result := checkResult{Time: start, LatencyMs: float64(time.Since(start).Microseconds()) / 1000, Success: err == nil}
+			if err != nil {
+				result.Error = err.Error()
+				logger.ForService(svc.Name).DebugWithFields("Health check failed", map[string]interface{}{
+					"service": svc.Name,
+					"type":    check.Type,
+					"error":   err.Error(),
+				})
+			}
+			svc.checks.Record(result)
+			c.updateHealth(svc, err == nil)
+		})
+	}
+	c.healthChecker = checker
+}
+
+// run calls probe on every interval until the checker is stopped
+func (h *healthChecker) run(interval time.Duration, probe func()) {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	probe()
+	for {
+		select {
+		case <-ticker.C:
+			probe()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// Stop stops every prober and waits for them to exit
+func (h *healthChecker) Stop() {
+	close(h.stop)
+	h.wg.Wait()
+}
+
+// newProbe builds the probe function for a service's health check type
+func (c *Conductor) newProbe(svc *Service, check config.HealthCheckConfig) (func(ctx context.Context) error, error) {
+	switch check.Type {
+	case healthCheckHTTP:
+		client := c.clientFor(svc)
+		target := svc.URL.Scheme + "://" + svc.URL.Host + check.Path
+		return func(ctx context.Context) error {
+			return probeHTTP(ctx, client, target)
+		}, nil
+	case healthCheckGRPC:
+		client := newGRPCClient(svc)
+		target := svc.URL.Scheme + "://" + svc.URL.Host + grpcHealthCheckPath
+		return func(ctx context.Context) error {
+			return probeGRPC(ctx, client, target, check.Service)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown health check type %q", check.Type)
+	}
+}
+
+// probeHTTP checks that a GET of the target returns a 2xx or 3xx status
+func probeHTTP(ctx context.Context, client *http.Client, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newGRPCClient builds an HTTP/2 client for gRPC probes, using prior knowledge HTTP/2 for
+// plaintext backends and negotiated HTTP/2 for TLS backends
+func newGRPCClient(svc *Service) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if base := svc.client; base != nil {
+		if t, ok := base.Transport.(*http.Transport); ok {
+			transport = t.Clone()
+		}
+	}
+
+	var protocols http.Protocols
+	if svc.URL.Scheme == "https" {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	transport.Protocols = &protocols
+	transport.ForceAttemptHTTP2 = true
+
+	return &http.Client{Transport: transport}
+}
+
+// probeGRPC runs grpc.health.v1.Health/Check for the given service name and checks that
+// the backend reports SERVING
+func probeGRPC(ctx context.Context, client *http.Client, target string, service string) error {
+	// HealthCheckRequest has a single string field, service = 1
+	var message bytes.Buffer
+	if service != "" {
+		message.WriteByte(0x0a)
+		writeVarint(&message, uint64(len(service)))
+		message.WriteString(service)
+	}
+
+	// gRPC length-prefixed message: compressed flag, 4-byte length, message
+	var frame bytes.Buffer
+	frame.WriteByte(0)
+	binary.Write(&frame, binary.BigEndian, uint32(message.Len()))
+	frame.Write(message.Bytes())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, &frame)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// The status is normally in the trailers, or in the headers for trailers-only responses
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != "0" {
+		return fmt.Errorf("health check failed with grpc-status %q: %s",
+			status, resp.Trailer.Get("Grpc-Message")+resp.Header.Get("Grpc-Message"))
+	}
+
+	servingStatus, err := parseHealthCheckResponse(body)
+	if err != nil {
+		return err
+	}
+	if servingStatus != grpcServing {
+		return fmt.Errorf("backend reported serving status %d", servingStatus)
+	}
+	return nil
+}
+
+// parseHealthCheckResponse extracts the status = 1 enum field from a framed
+// HealthCheckResponse
+func parseHealthCheckResponse(body []byte) (uint64, error) {
+	if len(body) < 5 {
+		return 0, errors.New("short gRPC health check response")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if body[0] != 0 || int(length) > len(body)-5 {
+		return 0, errors.New("invalid gRPC health check response frame")
+	}
+	message := body[5 : 5+length]
+
+	// An empty message means the default enum value, UNKNOWN
+	var status uint64
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, errors.New("invalid gRPC health check response")
+		}
+		message = message[n:]
+		if key&0x7 != 0 {
+			return 0, errors.New("unexpected field in gRPC health check response")
+		}
+		value, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, errors.New("invalid gRPC health check response")
+		}
+		message = message[n:]
+		if key>>3 == 1 {
+			status = value
+		}
+	}
+	return status, nil
+}
+
+// writeVarint writes a protobuf base 128 varint
+func writeVarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
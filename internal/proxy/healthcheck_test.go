@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// grpcHealthServer serves grpc.health.v1.Health/Check over plaintext HTTP/2, replying with
+// the given serving status and grpc-status
+func grpcHealthServer(t *testing.T, servingStatus byte, grpcStatus string) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != grpcHealthCheckPath || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("Unexpected probe %s %s %s", r.Proto, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		// The request carries the service name in field 1
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "\x00\x00\x00\x00\x07\x0a\x05users" {
+			t.Errorf("Unexpected request message %q", body)
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte{0, 0, 0, 0, 2, 0x08, servingStatus})
+		w.Header().Set("Grpc-Status", grpcStatus)
+	}))
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	server.Config.Protocols = &protocols
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestProbeGRPC tests the gRPC health check against serving, not serving and failing backends
+func TestProbeGRPC(t *testing.T) {
+	tests := []struct {
+		name          string
+		servingStatus byte
+		grpcStatus    string
+		wantHealthy   bool
+	}{
+		{name: "serving", servingStatus: 1, grpcStatus: "0", wantHealthy: true},
+		{name: "not serving", servingStatus: 2, grpcStatus: "0", wantHealthy: false},
+		{name: "unimplemented", servingStatus: 1, grpcStatus: "12", wantHealthy: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := grpcHealthServer(t, tt.servingStatus, tt.grpcStatus)
+			serverURL, _ := url.Parse(server.URL)
+
+			client := newGRPCClient(&Service{URL: serverURL})
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			err := probeGRPC(ctx, client, server.URL+grpcHealthCheckPath, "users")
+			if (err == nil) != tt.wantHealthy {
+				t.Errorf("Expected healthy=%v, got error %v", tt.wantHealthy, err)
+			}
+		})
+	}
+}
+
+// TestParseHealthCheckResponse tests decoding the serving status from a response frame
+func TestParseHealthCheckResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    []byte
+		want    uint64
+		wantErr bool
+	}{
+		{name: "serving", body: []byte{0, 0, 0, 0, 2, 0x08, 1}, want: 1},
+		{name: "empty message is unknown", body: []byte{0, 0, 0, 0, 0}, want: 0},
+		{name: "short frame", body: []byte{0, 0, 0}, wantErr: true},
+		{name: "truncated message", body: []byte{0, 0, 0, 0, 4, 0x08, 1}, wantErr: true},
+		{name: "compressed", body: []byte{1, 0, 0, 0, 2, 0x08, 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHealthCheckResponse(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
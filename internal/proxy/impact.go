@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// Roles a backend plays on a route
+const (
+	rolePrimary = "primary" // Answers the route's clients
+	rolePeer    = "peer"    // Answers the route's clients along with the other peers, as the route has no primary
+	roleShadow  = "shadow"  // Receives copies of requests, answering clients only when the primary fails
+	roleMirror  = "mirror"  // Receives copies of requests in the background, never answering clients
+)
+
+// How losing a backend affects a route
+const (
+	impactUnavailable = "unavailable" // No other backend can answer the route's clients
+	impactDegraded    = "degraded"    // Other backends answer the route's clients instead
+	impactShadow      = "shadow"      // Clients are unaffected, only comparisons stop
+)
+
+// DependencyGraph records which backends every route depends on, as configured
+type DependencyGraph struct {
+	Routes []RouteDependencies `json:"routes"`
+}
+
+// RouteDependencies are the backends the requests of a route are sent to. Services with
+// match predicates form their own entry, as they replace the route's other services.
+type RouteDependencies struct {
+	Route    string              `json:"route"`
+	Match    string              `json:"match,omitempty"`
+	Backends []BackendDependency `json:"backends"`
+	Failover []string            `json:"failover,omitempty"` // Remote cluster used when every backend is unhealthy
+}
+
+// BackendDependency is a backend service of a route and the role it plays
+type BackendDependency struct {
+	Service      string `json:"service"`
+	Host         string `json:"host"`
+	Role         string `json:"role"`
+	AnswersWrite bool   `json:"answers_writes"` // Receives non-idempotent requests
+}
+
+// RouteImpact is how losing a backend affects a route
+type RouteImpact struct {
+	Route     string   `json:"route"`
+	Match     string   `json:"match,omitempty"`
+	Role      string   `json:"role"`
+	Impact    string   `json:"impact"`
+	Fallback  []string `json:"fallback,omitempty"`   // Services or failover URLs answering instead
+	ReadsOnly bool     `json:"reads_only,omitempty"` // Only safe requests fall back, writes fail
+}
+
+// NewDependencyGraph builds the dependency graph of a configuration
+func NewDependencyGraph(cfg *config.Config) *DependencyGraph {
+	type groupKey struct{ route, match string }
+	groups := make(map[groupKey]*RouteDependencies)
+	var keys []groupKey
+	for _, svcConfig := range cfg.Services {
+		key := groupKey{routeName(svcConfig), svcConfig.MatchCondition()}
+		group, ok := groups[key]
+		if !ok {
+			group = &RouteDependencies{Route: key.route, Match: key.match}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		backend := BackendDependency{Service: svcConfig.Name, Role: roleShadow, AnswersWrite: svcConfig.Primary || svcConfig.MirrorUnsafeMethods}
+		if parsed, err := url.Parse(svcConfig.URL); err == nil {
+			backend.Host = parsed.Host
+		}
+		switch {
+		case svcConfig.Primary:
+			backend.Role = rolePrimary
+		case svcConfig.Mirror:
+			backend.Role = roleMirror
+		}
+		group.Backends = append(group.Backends, backend)
+	}
+
+	failover := make(map[string][]string)
+	for _, f := range cfg.Failover {
+		failover[f.Route] = f.URLs
+	}
+
+	graph := &DependencyGraph{Routes: make([]RouteDependencies, 0, len(keys))}
+	for _, key := range keys {
+		group := groups[key]
+		group.Failover = failover[group.Route]
+
+		// Without a primary every service answers, and mirrors are not detached
+		hasPrimary := false
+		for _, backend := range group.Backends {
+			hasPrimary = hasPrimary || backend.Role == rolePrimary
+		}
+		if !hasPrimary {
+			for i := range group.Backends {
+				group.Backends[i].Role = rolePeer
+			}
+			// Unsafe requests only go to the first service when none is primary
+			group.Backends[0].AnswersWrite = true
+		}
+		graph.Routes = append(graph.Routes, *group)
+	}
+
+	sort.SliceStable(graph.Routes, func(i, j int) bool {
+		if graph.Routes[i].Route != graph.Routes[j].Route {
+			return graph.Routes[i].Route < graph.Routes[j].Route
+		}
+		return graph.Routes[i].Match < graph.Routes[j].Match
+	})
+	if cfg.Streaming.DrainShadows {
+		graph.drainShadows()
+	}
+	return graph
+}
+
+// drainShadows marks shadows as unable to answer clients, since their bodies are discarded
+func (g *DependencyGraph) drainShadows() {
+	for i := range g.Routes {
+		for j := range g.Routes[i].Backends {
+			if backend := &g.Routes[i].Backends[j]; backend.Role == roleShadow {
+				backend.Role = roleMirror
+			}
+		}
+	}
+}
+
+// Impact returns how losing a backend, named by service name or host, affects each route
+// depending on it, or false if no route does
+func (g *DependencyGraph) Impact(backend string) ([]RouteImpact, bool) {
+	impacts := []RouteImpact{}
+	for _, route := range g.Routes {
+		var role string
+		var fallback []string
+		readsOnly := true
+		for _, dependency := range route.Backends {
+			if dependency.Service == backend || dependency.Host == backend {
+				// A backend serving several roles on a route is as critical as its main one
+				if role == "" || rank(dependency.Role) < rank(role) {
+					role = dependency.Role
+				}
+				continue
+			}
+			if dependency.Role != roleMirror {
+				fallback = append(fallback, dependency.Service)
+				readsOnly = readsOnly && !dependency.AnswersWrite
+			}
+		}
+		if role == "" {
+			continue
+		}
+
+		impact := RouteImpact{Route: route.Route, Match: route.Match, Role: role, Impact: impactShadow}
+		if role == rolePrimary || role == rolePeer {
+			switch {
+			case len(fallback) > 0:
+				impact.Impact, impact.Fallback, impact.ReadsOnly = impactDegraded, fallback, readsOnly
+			case len(route.Failover) > 0:
+				impact.Impact, impact.Fallback = impactDegraded, route.Failover
+			default:
+				impact.Impact = impactUnavailable
+			}
+		}
+		impacts = append(impacts, impact)
+	}
+	return impacts, len(impacts) > 0
+}
+
+// rank orders roles by how much the route's clients depend on them
+func rank(role string) int {
+	switch role {
+	case rolePrimary:
+		return 0
+	case rolePeer:
+		return 1
+	case roleShadow:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// impactReport is the response body of the impact admin endpoint
+type impactReport struct {
+	Backend string        `json:"backend"`
+	Routes  []RouteImpact `json:"routes"`
+}
+
+// DependencyGraphHandler creates an admin handler reporting which backends every route
+// depends on
+func DependencyGraphHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(NewDependencyGraph(c.servedConfig())); err != nil {
+			http.Error(w, "Failed to encode dependency graph: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// ImpactHandler creates an admin handler reporting which routes are affected if the
+// backend given in the "backend" query parameter goes down
+func ImpactHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+
+		backend := r.URL.Query().Get("backend")
+		if backend == "" {
+			http.Error(w, "Missing backend parameter", http.StatusBadRequest)
+			return
+		}
+		routes, ok := NewDependencyGraph(c.servedConfig()).Impact(backend)
+		if !ok {
+			http.Error(w, "No route depends on backend "+backend, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(impactReport{Backend: backend, Routes: routes}); err != nil {
+			http.Error(w, "Failed to encode impact report: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestDependencyImpact tests which routes are affected when a backend goes down
+func TestDependencyImpact(t *testing.T) {
+	cfg := &config.Config{
+		Services: []config.Service{
+			{Name: "users", URL: "http://users.internal:8080", PathPrefix: "/users", Primary: true},
+			{Name: "users-v2", URL: "http://users-v2.internal", PathPrefix: "/users"},
+			{Name: "users-audit", URL: "http://audit.internal", PathPrefix: "/users", Mirror: true},
+			{Name: "orders", URL: "http://orders.internal", PathPrefix: "/orders", Primary: true},
+			{Name: "orders-audit", URL: "http://audit.internal", PathPrefix: "/orders", Mirror: true},
+			{Name: "search-a", URL: "http://search-a.internal", PathPrefix: "/search"},
+			{Name: "search-b", URL: "http://search-b.internal", PathPrefix: "/search", MirrorUnsafeMethods: true},
+			{Name: "billing", URL: "http://billing.internal", PathPrefix: "/billing", Primary: true},
+		},
+		Failover: []config.FailoverConfig{{Route: "/billing", URLs: []string{"https://billing.dr.example.com"}}},
+	}
+	graph := NewDependencyGraph(cfg)
+
+	tests := []struct {
+		name    string
+		backend string
+		want    []RouteImpact
+	}{
+		{name: "primary with a shadow", backend: "users", want: []RouteImpact{
+			{Route: "/users", Role: rolePrimary, Impact: impactDegraded, Fallback: []string{"users-v2"}, ReadsOnly: true},
+		}},
+		{name: "by host", backend: "users.internal:8080", want: []RouteImpact{
+			{Route: "/users", Role: rolePrimary, Impact: impactDegraded, Fallback: []string{"users-v2"}, ReadsOnly: true},
+		}},
+		{name: "shadow", backend: "users-v2", want: []RouteImpact{
+			{Route: "/users", Role: roleShadow, Impact: impactShadow},
+		}},
+		{name: "mirror host shared by routes", backend: "audit.internal", want: []RouteImpact{
+			{Route: "/orders", Role: roleMirror, Impact: impactShadow},
+			{Route: "/users", Role: roleMirror, Impact: impactShadow},
+		}},
+		{name: "primary with only a mirror", backend: "orders", want: []RouteImpact{
+			{Route: "/orders", Role: rolePrimary, Impact: impactUnavailable},
+		}},
+		{name: "peer", backend: "search-a", want: []RouteImpact{
+			{Route: "/search", Role: rolePeer, Impact: impactDegraded, Fallback: []string{"search-b"}},
+		}},
+		{name: "failover", backend: "billing", want: []RouteImpact{
+			{Route: "/billing", Role: rolePrimary, Impact: impactDegraded, Fallback: []string{"https://billing.dr.example.com"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := graph.Impact(tt.backend)
+			if !ok {
+				t.Fatalf("Expected routes to depend on %s", tt.backend)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	if _, ok := graph.Impact("unknown"); ok {
+		t.Error("Expected no route to depend on an unknown backend")
+	}
+
+	// Drained shadows never answer clients
+	cfg.Streaming.DrainShadows = true
+	got, _ := NewDependencyGraph(cfg).Impact("users")
+	if want := impactUnavailable; got[0].Impact != want {
+		t.Errorf("Expected %s with drained shadows, got %s", want, got[0].Impact)
+	}
+}
+
+// TestImpactHandler tests the impact admin endpoint
+func TestImpactHandler(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://primary.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "api-shadow", URL: "http://shadow.example.com", PathPrefix: "/api"},
+		},
+		Admin: config.AdminConfig{Enabled: true, Endpoint: "/admin", Token: "secret"},
+	}
+	mux := http.NewServeMux()
+	SetupAdminEndpoints(mux, NewConductor(cfg))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, adminRequest(http.MethodGet, "/admin/impact?backend=api"))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+	var report impactReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid impact report: %v", err)
+	}
+	if len(report.Routes) != 1 || report.Routes[0].Impact != impactDegraded {
+		t.Errorf("Expected /api to be degraded, got %+v", report.Routes)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, adminRequest(http.MethodGet, "/admin/impact?backend=unknown"))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown backend, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, adminRequest(http.MethodGet, "/admin/dependencies"))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for the dependency graph, got %d", recorder.Code)
+	}
+}
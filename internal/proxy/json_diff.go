@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// maxDiffPaths bounds the differing paths reported for one comparison, so a body that
+// differs everywhere does not flood the logs
+const maxDiffPaths = 10
+
+// jsonIdentifier matches member names that need no brackets in a JSONPath
+var jsonIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$-]*$`)
+
+// diffBodies returns the JSONPath of every node that differs between two JSON bodies, up
+// to maxDiffPaths, and whether more differ. Bodies are compared after normalization, so
+// ignored fields and array order never show up. It returns nil if either body is not JSON.
+func diffBodies(primary []byte, shadow []byte) ([]string, bool) {
+	primaryDocument, err := jsonCodec{}.Decode(primary)
+	if err != nil {
+		return nil, false
+	}
+	shadowDocument, err := jsonCodec{}.Decode(shadow)
+	if err != nil {
+		return nil, false
+	}
+
+	var paths []string
+	truncated := diffDocuments(primaryDocument, shadowDocument, "$", &paths)
+	return paths, truncated
+}
+
+// diffDocuments appends the paths below path where two decoded documents differ,
+// reporting true once more than maxDiffPaths were found. Members present on one side
+// only and array elements past the shorter array are reported as differing.
+func diffDocuments(primary interface{}, shadow interface{}, path string, paths *[]string) bool {
+	report := func(path string) bool {
+		if len(*paths) == maxDiffPaths {
+			return true
+		}
+		*paths = append(*paths, path)
+		return false
+	}
+
+	switch primaryValue := primary.(type) {
+	case map[string]interface{}:
+		shadowValue, ok := shadow.(map[string]interface{})
+		if !ok {
+			return report(path)
+		}
+		keys := make([]string, 0, len(primaryValue)+len(shadowValue))
+		for key := range primaryValue {
+			keys = append(keys, key)
+		}
+		for key := range shadowValue {
+			if _, ok := primaryValue[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			primaryChild, inPrimary := primaryValue[key]
+			shadowChild, inShadow := shadowValue[key]
+			childPath := memberPath(path, key)
+			if !inPrimary || !inShadow {
+				if report(childPath) {
+					return true
+				}
+			} else if diffDocuments(primaryChild, shadowChild, childPath, paths) {
+				return true
+			}
+		}
+	case []interface{}:
+		shadowValue, ok := shadow.([]interface{})
+		if !ok {
+			return report(path)
+		}
+		for i := 0; i < len(primaryValue) || i < len(shadowValue); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			if i >= len(primaryValue) || i >= len(shadowValue) {
+				if report(childPath) {
+					return true
+				}
+			} else if diffDocuments(primaryValue[i], shadowValue[i], childPath, paths) {
+				return true
+			}
+		}
+	default:
+		// Scalars decode to comparable values: strings, json.Number, booleans and nil
+		if !comparableScalar(shadow) || primary != shadow {
+			return report(path)
+		}
+	}
+	return false
+}
+
+// comparableScalar reports whether a decoded JSON value is a scalar, which compares with ==
+func comparableScalar(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// memberPath appends an object member to a JSONPath, bracketing names that need it
+func memberPath(path string, key string) string {
+	if jsonIdentifier.MatchString(key) {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s[%q]", path, key)
+}
+
+// logBodyDiff adds the paths where differing JSON bodies differ to mismatch log fields
+func logBodyDiff(fields map[string]interface{}, primaryBody []byte, shadowBody []byte) {
+	paths, truncated := diffBodies(primaryBody, shadowBody)
+	if len(paths) == 0 {
+		return
+	}
+	fields["body_paths"] = paths
+	if truncated {
+		fields["body_paths_truncated"] = true
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDiffBodies tests that the paths of differing JSON fields are reported
+func TestDiffBodies(t *testing.T) {
+	tests := []struct {
+		name          string
+		primary       string
+		shadow        string
+		want          []string
+		wantTruncated bool
+	}{
+		{name: "equal", primary: `{"a":1}`, shadow: `{"a":1}`},
+		{name: "changed member", primary: `{"user":{"name":"Ada","id":1}}`, shadow: `{"user":{"name":"Bob","id":1}}`, want: []string{"$.user.name"}},
+		{name: "missing and extra members", primary: `{"a":1,"b":2}`, shadow: `{"b":2,"c":3}`, want: []string{"$.a", "$.c"}},
+		{name: "array elements", primary: `{"items":[1,2]}`, shadow: `{"items":[1,3,4]}`, want: []string{"$.items[1]", "$.items[2]"}},
+		{name: "changed type", primary: `{"id":"1"}`, shadow: `{"id":1}`, want: []string{"$.id"}},
+		{name: "object replaced by scalar", primary: `{"meta":{"v":1}}`, shadow: `{"meta":null}`, want: []string{"$.meta"}},
+		{name: "bracketed names", primary: `{"request id":"a"}`, shadow: `{"request id":"b"}`, want: []string{`$["request id"]`}},
+		{name: "not JSON", primary: `<a/>`, shadow: `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := diffBodies([]byte(tt.primary), []byte(tt.shadow))
+			if !reflect.DeepEqual(got, tt.want) || truncated != tt.wantTruncated {
+				t.Errorf("Expected %q (truncated=%v), got %q (truncated=%v)", tt.want, tt.wantTruncated, got, truncated)
+			}
+		})
+	}
+
+	// Bodies differing everywhere report a bounded number of paths
+	primary := "[" + strings.TrimSuffix(strings.Repeat("1,", 20), ",") + "]"
+	shadow := "[" + strings.TrimSuffix(strings.Repeat("2,", 20), ",") + "]"
+	got, truncated := diffBodies([]byte(primary), []byte(shadow))
+	if len(got) != maxDiffPaths || !truncated {
+		t.Errorf("Expected %d paths and truncation, got %d paths (truncated=%v)", maxDiffPaths, len(got), truncated)
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultListener is the name of the listener configured by the top-level listen address
+const DefaultListener = "default"
+
+// listenerKey carries the name of the listener a request was received on
+type listenerKey struct{}
+
+// WithListener returns a context marking requests as received on the named listener, for
+// use as the base context of that listener's server
+func WithListener(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, listenerKey{}, name)
+}
+
+// listenerOf returns the name of the listener a request was received on
+func listenerOf(r *http.Request) string {
+	if name, ok := r.Context().Value(listenerKey{}).(string); ok {
+		return name
+	}
+	return DefaultListener
+}
+
+// newListenerSet returns the listeners a service is bound to, or nil if it is served on all
+func newListenerSet(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	listeners := make(map[string]bool, len(names))
+	for _, name := range names {
+		listeners[name] = true
+	}
+	return listeners
+}
+
+// servedOn returns the services served on a listener. The slice is returned unchanged
+// when every service is.
+func servedOn(services []*Service, listener string) []*Service {
+	for i, svc := range services {
+		if svc.listeners == nil || svc.listeners[listener] {
+			continue
+		}
+
+		// Copy the services served so far, then keep filtering
+		served := append([]*Service(nil), services[:i]...)
+		for _, svc := range services[i+1:] {
+			if svc.listeners == nil || svc.listeners[listener] {
+				served = append(served, svc)
+			}
+		}
+		return served
+	}
+	return services
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestListenerRouting tests that services are only routed on the listeners they are bound to
+func TestListenerRouting(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "internal", URL: "http://internal.example.com", PathPrefix: "/internal", Primary: true, Listeners: []string{"private"}},
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true, Listeners: []string{"default", "public"}},
+			{Name: "api-audit", URL: "http://audit.example.com", PathPrefix: "/api", Listeners: []string{"private"}},
+			{Name: "site", URL: "http://site.example.com", PathPrefix: "/", Primary: true},
+		},
+	}
+	conductor := NewConductor(cfg)
+
+	tests := []struct {
+		name     string
+		listener string
+		path     string
+		want     []string
+	}{
+		{name: "bound listener", listener: "private", path: "/internal/jobs", want: []string{"internal"}},
+		{name: "other listener falls back to shorter prefix", listener: "public", path: "/internal/jobs", want: []string{"site"}},
+		{name: "default listener", path: "/api/users", want: []string{"api"}},
+		{name: "services of a route filtered by listener", listener: "private", path: "/api/users", want: []string{"api-audit"}},
+		{name: "unbound service on every listener", listener: "public", path: "/about", want: []string{"site"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com"+tt.path, nil)
+			if tt.listener != "" {
+				req = req.WithContext(WithListener(req.Context(), tt.listener))
+			}
+			if got := getServiceNames(conductor.findMatchingServices(req)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected services %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// loopDetector marks outgoing requests with this conductor's token and recognizes
+// requests that already carry it
+type loopDetector struct {
+	header  string
+	token   string
+	maxHops int
+}
+
+// newLoopDetector creates a detector with a token identifying this conductor instance.
+// With a secret the token is an HMAC of the instance ID, so backends never see the ID
+// and markers cannot be forged without the secret.
+func newLoopDetector(cfg config.LoopDetectionConfig) *loopDetector {
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		buf := make([]byte, 8)
+		rand.Read(buf)
+		instanceID = hex.EncodeToString(buf)
+	}
+
+	token := instanceID
+	if cfg.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.Secret))
+		mac.Write([]byte(instanceID))
+		token = hex.EncodeToString(mac.Sum(nil))[:32]
+	}
+
+	return &loopDetector{header: cfg.Header, token: token, maxHops: cfg.MaxHops}
+}
+
+// Looped reports whether the request already passed through this conductor, or through
+// more go-conductor hops than allowed according to its Via header
+func (l *loopDetector) Looped(r *http.Request) bool {
+	for _, value := range r.Header.Values(l.header) {
+		for _, token := range strings.Split(value, ",") {
+			if hmac.Equal([]byte(strings.TrimSpace(token)), []byte(l.token)) {
+				return true
+			}
+		}
+	}
+
+	if l.maxHops <= 0 {
+		return false
+	}
+	hops := 0
+	for _, value := range r.Header.Values("Via") {
+		for _, hop := range strings.Split(value, ",") {
+			// Each hop is "<protocol> <pseudonym>/<version> [comment]"
+			fields := strings.Fields(hop)
+			if len(fields) >= 2 && strings.HasPrefix(fields[1], viaPseudonym+"/") {
+				hops++
+			}
+		}
+	}
+	return hops >= l.maxHops
+}
+
+// Mark adds this conductor's token to an outgoing request
+func (l *loopDetector) Mark(header http.Header) {
+	header.Add(l.header, l.token)
+}
+
+// handleLoopDetected rejects a request that looped back to this conductor
+func (c *Conductor) handleLoopDetected(w http.ResponseWriter, r *http.Request, requestStart time.Time, traceID string) {
+	logger.ErrorWithFields("Request loop detected, check for routes pointing back at the conductor", nil, map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"via":    r.Header.Values("Via"),
+	})
+	writeError(w, r, http.StatusLoopDetected, ErrCodeLoopDetected, "Request has already passed through this conductor")
+
+	// Record rejected request in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", "none", "loop_detected")
+		c.prometheusMetrics.RecordRequest("conductor", "none", r.Method, "508", time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics("none", requestStart, true)
+	}
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestLoopDetection tests that a route pointing back at the conductor is stopped after one hop
+func TestLoopDetection(t *testing.T) {
+	cfg := &config.Config{
+		Timeout:       5,
+		LoopDetection: config.LoopDetectionConfig{Enabled: true, Header: "X-Conductor-Loop", Secret: "s3cret", MaxHops: 10},
+	}
+	conductor := NewConductor(cfg)
+	server := httptest.NewServer(conductor)
+	defer server.Close()
+
+	// Route back at the conductor itself, as a misconfigured service would
+	cfg.Services = []config.Service{{Name: "self", URL: server.URL, PathPrefix: "/api", Primary: true}}
+	conductor.services = make([]*Service, 1)
+	conductor.initializeServices(cfg.Services, nil)
+
+	resp, err := http.Get(server.URL + "/api/users")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusLoopDetected {
+		t.Fatalf("Expected 508 from the looped hop, got %d", resp.StatusCode)
+	}
+}
+
+// TestLoopDetectorViaHops tests detection from go-conductor hops in the Via header
+func TestLoopDetectorViaHops(t *testing.T) {
+	detector := newLoopDetector(config.LoopDetectionConfig{Header: "X-Conductor-Loop", MaxHops: 2})
+
+	tests := []struct {
+		name   string
+		via    []string
+		marker string
+		want   bool
+	}{
+		{name: "no headers", want: false},
+		{name: "one hop", via: []string{"1.1 go-conductor/dev"}, want: false},
+		{name: "too many hops", via: []string{"1.1 go-conductor/dev, 1.1 cdn", "1.1 go-conductor/1.2"}, want: true},
+		{name: "other proxies", via: []string{"1.1 cdn, 1.1 edge, 2 lb"}, want: false},
+		{name: "own marker", marker: "other, " + detector.token, want: true},
+		{name: "foreign marker", marker: "0123456789abcdef", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			for _, via := range tt.via {
+				req.Header.Add("Via", via)
+			}
+			if tt.marker != "" {
+				req.Header.Set("X-Conductor-Loop", tt.marker)
+			}
+			if got := detector.Looped(req); got != tt.want {
+				t.Errorf("Expected looped=%v for Via %s, got %v", tt.want, strings.Join(tt.via, " | "), got)
+			}
+		})
+	}
+}
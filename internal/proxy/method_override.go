@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// methodOverride lets clients that can only send POST declare the method they intend
+type methodOverride struct {
+	header  string
+	allowed map[string]bool
+}
+
+// newMethodOverride creates an override for the configured header and methods
+func newMethodOverride(cfg config.MethodOverrideConfig) *methodOverride {
+	m := &methodOverride{header: cfg.Header, allowed: make(map[string]bool)}
+	for _, method := range cfg.Methods {
+		m.allowed[strings.ToUpper(method)] = true
+	}
+	return m
+}
+
+// Apply rewrites a POST request carrying the override header to the intended method when
+// it is allowed. The header is removed either way so backends never apply it a second time.
+func (m *methodOverride) Apply(r *http.Request) {
+	value := r.Header.Get(m.header)
+	if value == "" {
+		return
+	}
+	r.Header.Del(m.header)
+
+	method := strings.ToUpper(strings.TrimSpace(value))
+	if r.Method != http.MethodPost || !m.allowed[method] {
+		logger.WarnWithFields("Ignoring method override", map[string]interface{}{
+			"method":   r.Method,
+			"override": value,
+			"path":     r.URL.Path,
+		})
+		return
+	}
+
+	logger.DebugWithFields("Applying method override", map[string]interface{}{
+		"method": method,
+		"path":   r.URL.Path,
+	})
+	r.Method = method
+}
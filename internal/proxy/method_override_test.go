@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestMethodOverride tests routing and mirroring overridden POST requests as the intended method
+func TestMethodOverride(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "primary", URL: "http://primary.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "shadow", URL: "http://shadow.example.com", PathPrefix: "/api"},
+		},
+		MethodOverride: config.MethodOverrideConfig{
+			Enabled: true,
+			Header:  "X-HTTP-Method-Override",
+			Methods: []string{"GET", "delete"},
+		},
+	}
+	conductor := NewConductor(cfg)
+
+	tests := []struct {
+		name       string
+		method     string
+		override   string
+		wantMethod string
+		wantMirror bool
+	}{
+		{name: "no override", method: "POST", wantMethod: "POST"},
+		{name: "override to unsafe method", method: "POST", override: "DELETE", wantMethod: "DELETE"},
+		{name: "override to safe method is mirrored", method: "POST", override: "get", wantMethod: "GET", wantMirror: true},
+		{name: "method not allowed", method: "POST", override: "PUT", wantMethod: "POST"},
+		{name: "only POST is overridden", method: "GET", override: "DELETE", wantMethod: "GET", wantMirror: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &hostRecordingTransport{requests: make(map[string]*http.Request)}
+			transport.wg.Add(1)
+			if tt.wantMirror {
+				transport.wg.Add(1)
+			}
+			conductor.client = &http.Client{Transport: transport}
+
+			req := httptest.NewRequest(tt.method, "http://example.com/api/items/1", nil)
+			if tt.override != "" {
+				req.Header.Set("X-HTTP-Method-Override", tt.override)
+			}
+			conductor.ServeHTTP(httptest.NewRecorder(), req)
+			transport.wg.Wait()
+
+			primary := transport.requests["primary.example.com"]
+			if primary == nil {
+				t.Fatalf("Expected a request to the primary")
+			}
+			if primary.Method != tt.wantMethod {
+				t.Errorf("Expected method %s, got %s", tt.wantMethod, primary.Method)
+			}
+			if primary.Header.Get("X-HTTP-Method-Override") != "" {
+				t.Errorf("Expected the override header to be removed")
+			}
+			if mirrored := transport.requests["shadow.example.com"] != nil; mirrored != tt.wantMirror {
+				t.Errorf("Expected mirrored=%v, got %v", tt.wantMirror, mirrored)
+			}
+		})
+	}
+}
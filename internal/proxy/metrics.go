@@ -1,52 +1,176 @@
 package proxy
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
 
-// MetricsCollector collects metrics about proxy operations
-type MetricsCollector struct {
-	mu              sync.RWMutex
+// metricsSeries accumulates the requests of a route, a service or all of them
+type metricsSeries struct {
 	requestCount    int64
 	errorCount      int64
 	requestDuration time.Duration
-	lastRequest     time.Time
+	digest          *tdigest // Latencies in milliseconds
+}
+
+// newMetricsSeries creates an empty series
+func newMetricsSeries() *metricsSeries {
+	return &metricsSeries{digest: newTDigest(defaultCompression)}
+}
+
+// record adds a request to the series
+func (s *metricsSeries) record(duration time.Duration, isError bool) {
+	s.requestCount++
+	s.requestDuration += duration
+	s.digest.Add(float64(duration) / float64(time.Millisecond))
+	if isError {
+		s.errorCount++
+	}
+}
+
+// copy returns a copy of the series whose digest can be queried without the collector's lock
+func (s *metricsSeries) copy() metricsSeries {
+	c := *s
+	c.digest = newTDigest(defaultCompression)
+	c.digest.Merge(s.digest)
+	return c
+}
+
+// breakdown summarizes the series under the given name
+func (s *metricsSeries) breakdown(name string) MetricsBreakdown {
+	b := MetricsBreakdown{
+		Name:         name,
+		RequestCount: s.requestCount,
+		ErrorCount:   s.errorCount,
+		SuccessCount: s.requestCount - s.errorCount,
+	}
+	if s.requestCount > 0 {
+		b.ErrorRate = float64(s.errorCount) / float64(s.requestCount)
+		b.AverageRequestTimeMs = float64(s.requestDuration/time.Duration(s.requestCount)) / float64(time.Millisecond)
+		b.P50Ms = s.digest.Quantile(0.5)
+		b.P95Ms = s.digest.Quantile(0.95)
+		b.P99Ms = s.digest.Quantile(0.99)
+	}
+	return b
+}
+
+// MetricsBreakdown summarizes the requests of a route, a service or all of them
+type MetricsBreakdown struct {
+	Name                 string  `json:"name,omitempty"`
+	RequestCount         int64   `json:"request_count"`
+	ErrorCount           int64   `json:"error_count"`
+	SuccessCount         int64   `json:"success_count"`
+	ErrorRate            float64 `json:"error_rate"`
+	AverageRequestTimeMs float64 `json:"avg_request_time_ms"`
+	P50Ms                float64 `json:"p50_ms"`
+	P95Ms                float64 `json:"p95_ms"`
+	P99Ms                float64 `json:"p99_ms"`
+}
+
+// MetricsSnapshot is the state of a collector captured at a single point, so its totals,
+// routes and services always agree with each other
+type MetricsSnapshot struct {
+	Total       MetricsBreakdown
+	Routes      []MetricsBreakdown // Sorted by route name
+	Services    []MetricsBreakdown // Sorted by service name
+	LastRequest time.Time
+}
+
+// MetricsCollector collects metrics about proxy operations. Client requests are counted
+// in total and per route; the requests sent to each service, including shadows and
+// retries, are counted per service.
+type MetricsCollector struct {
+	mu          sync.RWMutex
+	total       *metricsSeries
+	routes      map[string]*metricsSeries
+	services    map[string]*metricsSeries
+	lastRequest time.Time
 }
 
 // NewMetricsCollector creates a new metrics collector
 func NewMetricsCollector() *MetricsCollector {
 	return &MetricsCollector{
+		total:       newMetricsSeries(),
+		routes:      make(map[string]*metricsSeries),
+		services:    make(map[string]*metricsSeries),
 		lastRequest: time.Now(),
 	}
 }
 
-// RecordRequest records metrics for a request
-func (m *MetricsCollector) RecordRequest(duration time.Duration, isError bool) {
+// RecordRequest records metrics for a client request to the given route
+func (m *MetricsCollector) RecordRequest(route string, duration time.Duration, isError bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.requestCount++
-	m.requestDuration += duration
+	m.total.record(duration, isError)
+	series, ok := m.routes[route]
+	if !ok {
+		series = newMetricsSeries()
+		m.routes[route] = series
+	}
+	series.record(duration, isError)
 	m.lastRequest = time.Now()
+}
 
-	if isError {
-		m.errorCount++
+// RecordServiceRequest records metrics for a request sent to the given service
+func (m *MetricsCollector) RecordServiceRequest(service string, duration time.Duration, isError bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.services[service]
+	if !ok {
+		series = newMetricsSeries()
+		m.services[service] = series
+	}
+	series.record(duration, isError)
+}
+
+// Snapshot captures the collector's metrics under a single lock. Percentiles are computed
+// from copies afterwards, so recording is only held up while the series are copied.
+func (m *MetricsCollector) Snapshot() MetricsSnapshot {
+	m.mu.RLock()
+	total := m.total.copy()
+	routes := make(map[string]metricsSeries, len(m.routes))
+	for route, series := range m.routes {
+		routes[route] = series.copy()
+	}
+	services := make(map[string]metricsSeries, len(m.services))
+	for service, series := range m.services {
+		services[service] = series.copy()
+	}
+	lastRequest := m.lastRequest
+	m.mu.RUnlock()
+
+	snapshot := MetricsSnapshot{
+		Total:       total.breakdown(""),
+		Routes:      make([]MetricsBreakdown, 0, len(routes)),
+		Services:    make([]MetricsBreakdown, 0, len(services)),
+		LastRequest: lastRequest,
+	}
+	for route, series := range routes {
+		snapshot.Routes = append(snapshot.Routes, series.breakdown(route))
+	}
+	for service, series := range services {
+		snapshot.Services = append(snapshot.Services, series.breakdown(service))
 	}
+	sort.Slice(snapshot.Routes, func(i, j int) bool { return snapshot.Routes[i].Name < snapshot.Routes[j].Name })
+	sort.Slice(snapshot.Services, func(i, j int) bool { return snapshot.Services[i].Name < snapshot.Services[j].Name })
+	return snapshot
 }
 
 // GetRequestCount returns the total number of requests processed
 func (m *MetricsCollector) GetRequestCount() int64 {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.requestCount
+	return m.total.requestCount
 }
 
 // GetErrorCount returns the total number of errors encountered
 func (m *MetricsCollector) GetErrorCount() int64 {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.errorCount
+	return m.total.errorCount
 }
 
 // GetAverageRequestDuration returns the average duration of requests
@@ -54,11 +178,11 @@ func (m *MetricsCollector) GetAverageRequestDuration() time.Duration {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if m.requestCount == 0 {
+	if m.total.requestCount == 0 {
 		return 0
 	}
 
-	return m.requestDuration / time.Duration(m.requestCount)
+	return m.total.requestDuration / time.Duration(m.total.requestCount)
 }
 
 // GetLastRequestTime returns the time of the last request
@@ -8,17 +8,23 @@ import (
 
 // MetricsData represents the metrics data structure for JSON output
 type MetricsData struct {
-	RequestCount         int64     `json:"request_count"`
-	ErrorCount           int64     `json:"error_count"`
-	SuccessCount         int64     `json:"success_count"`
-	ErrorRate            float64   `json:"error_rate"`
-	AverageRequestTimeMs float64   `json:"avg_request_time_ms"`
-	LastRequestTimestamp time.Time `json:"last_request_time"`
-	UptimeSeconds        float64   `json:"uptime_seconds"`
-	StartTime            time.Time `json:"start_time"`
+	RequestCount         int64              `json:"request_count"`
+	ErrorCount           int64              `json:"error_count"`
+	SuccessCount         int64              `json:"success_count"`
+	ErrorRate            float64            `json:"error_rate"`
+	AverageRequestTimeMs float64            `json:"avg_request_time_ms"`
+	P50Ms                float64            `json:"p50_ms"`
+	P95Ms                float64            `json:"p95_ms"`
+	P99Ms                float64            `json:"p99_ms"`
+	LastRequestTimestamp time.Time          `json:"last_request_time"`
+	UptimeSeconds        float64            `json:"uptime_seconds"`
+	StartTime            time.Time          `json:"start_time"`
+	Routes               []MetricsBreakdown `json:"routes"`
+	Services             []MetricsBreakdown `json:"services"`
 }
 
-// MetricsHandler creates an HTTP handler for exposing conductor metrics
+// MetricsHandler creates an HTTP handler for exposing conductor metrics. Totals, routes
+// and services are taken from one snapshot, so they add up even while requests are served.
 func MetricsHandler(c *Conductor) http.HandlerFunc {
 	startTime := time.Now()
 
@@ -29,37 +35,21 @@ func MetricsHandler(c *Conductor) http.HandlerFunc {
 			return
 		}
 
-		// Get metrics data
-		reqCount := metrics.GetRequestCount()
-		errCount := metrics.GetErrorCount()
-		successCount := reqCount - errCount
-
-		// Calculate error rate
-		var errorRate float64
-		if reqCount > 0 {
-			errorRate = float64(errCount) / float64(reqCount)
-		}
-
-		// Get average duration in milliseconds
-		avgDuration := metrics.GetAverageRequestDuration()
-		avgDurationMs := float64(avgDuration) / float64(time.Millisecond)
-
-		// Last request time
-		lastReq := metrics.GetLastRequestTime()
-
-		// Calculate uptime
-		uptime := time.Since(startTime).Seconds()
-
-		// Create response
+		snapshot := metrics.Snapshot()
 		data := MetricsData{
-			RequestCount:         reqCount,
-			ErrorCount:           errCount,
-			SuccessCount:         successCount,
-			ErrorRate:            errorRate,
-			AverageRequestTimeMs: avgDurationMs,
-			LastRequestTimestamp: lastReq,
-			UptimeSeconds:        uptime,
+			RequestCount:         snapshot.Total.RequestCount,
+			ErrorCount:           snapshot.Total.ErrorCount,
+			SuccessCount:         snapshot.Total.SuccessCount,
+			ErrorRate:            snapshot.Total.ErrorRate,
+			AverageRequestTimeMs: snapshot.Total.AverageRequestTimeMs,
+			P50Ms:                snapshot.Total.P50Ms,
+			P95Ms:                snapshot.Total.P95Ms,
+			P99Ms:                snapshot.Total.P99Ms,
+			LastRequestTimestamp: snapshot.LastRequest,
+			UptimeSeconds:        time.Since(startTime).Seconds(),
 			StartTime:            startTime,
+			Routes:               snapshot.Routes,
+			Services:             snapshot.Services,
 		}
 
 		// Set content type
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// metricsPusher periodically pushes the gathered metrics to a Prometheus Pushgateway
+type metricsPusher struct {
+	pusher   *push.Pusher
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// StartMetricsPush starts pushing Prometheus metrics to the configured Pushgateway, for
+// deployments that cannot be scraped. It returns a function that stops pushing after a
+// final push, or nil if pushing is not configured.
+func StartMetricsPush(c *Conductor) func() {
+	cfg := c.config.Metrics
+	if !cfg.Enabled || !cfg.EnablePrometheus || cfg.Push.URL == "" {
+		return nil
+	}
+
+	p := newMetricsPusher(cfg.Push.URL, cfg.Push.Job, cfg.Push.Instance,
+		time.Duration(cfg.Push.Interval)*time.Second, prometheus.DefaultGatherer)
+
+	logger.InfoWithFields("Pushing metrics to Pushgateway", map[string]interface{}{
+		"url":      cfg.Push.URL,
+		"job":      cfg.Push.Job,
+		"interval": cfg.Push.Interval,
+	})
+	go p.run()
+	return p.Stop
+}
+
+// newMetricsPusher creates a pusher for the given gatherer
+func newMetricsPusher(url string, job string, instance string, interval time.Duration, gatherer prometheus.Gatherer) *metricsPusher {
+	pusher := push.New(url, job).Gatherer(gatherer)
+	if instance != "" {
+		pusher = pusher.Grouping("instance", instance)
+	}
+
+	return &metricsPusher{
+		pusher:   pusher,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// run pushes on every interval until stopped, then pushes once more
+func (p *metricsPusher) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.push()
+		case <-p.stop:
+			p.push()
+			return
+		}
+	}
+}
+
+// push replaces this instance's metrics on the Pushgateway
+func (p *metricsPusher) push() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+
+	if err := p.pusher.PushContext(ctx); err != nil {
+		logger.Error("Failed to push metrics to Pushgateway", err)
+	}
+}
+
+// Stop stops the periodic push after a final push of the latest values
+func (p *metricsPusher) Stop() {
+	close(p.stop)
+	<-p.done
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestMetricsPush tests that metrics are pushed on stop with the job and instance grouping
+func TestMetricsPush(t *testing.T) {
+	type pushed struct {
+		method string
+		path   string
+		body   string
+	}
+	received := make(chan pushed, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- pushed{method: r.Method, path: r.URL.Path, body: string(body)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	metrics := NewPrometheusMetrics(registry)
+	metrics.RecordRequest("test-service", "test-route", "GET", "200", 100*time.Millisecond, "")
+
+	pusher := newMetricsPusher(server.URL, "go-conductor", "host-1", time.Hour, registry)
+	go pusher.run()
+	pusher.Stop()
+
+	select {
+	case p := <-received:
+		if p.method != http.MethodPut {
+			t.Errorf("Expected PUT, got %s", p.method)
+		}
+		if p.path != "/metrics/job/go-conductor/instance/host-1" {
+			t.Errorf("Expected grouping path for job and instance, got %s", p.path)
+		}
+		if !strings.Contains(p.body, "go_conductor_requests_total") {
+			t.Errorf("Expected pushed body to contain request metrics")
+		}
+	default:
+		t.Fatal("Expected a final push on stop")
+	}
+}
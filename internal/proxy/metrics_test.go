@@ -1,8 +1,13 @@
 package proxy
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
 )
 
 func TestMetricsCollector(t *testing.T) {
@@ -22,7 +27,7 @@ func TestMetricsCollector(t *testing.T) {
 	}
 
 	// Record successful request
-	collector.RecordRequest(100*time.Millisecond, false)
+	collector.RecordRequest("/api", 100*time.Millisecond, false)
 
 	if count := collector.GetRequestCount(); count != 1 {
 		t.Errorf("Request count should be 1, got %d", count)
@@ -37,7 +42,7 @@ func TestMetricsCollector(t *testing.T) {
 	}
 
 	// Record error request
-	collector.RecordRequest(200*time.Millisecond, true)
+	collector.RecordRequest("/api", 200*time.Millisecond, true)
 
 	if count := collector.GetRequestCount(); count != 2 {
 		t.Errorf("Request count should be 2, got %d", count)
@@ -76,7 +81,7 @@ func TestConductorWithMetrics(t *testing.T) {
 
 	// Record a request using helper method
 	start := time.Now().Add(-100 * time.Millisecond) // Simulate request started 100ms ago
-	conductor.RecordMetrics(start, false)
+	conductor.RecordMetrics("/api", start, false)
 
 	// Verify metrics were recorded
 	metrics := conductor.GetMetrics()
@@ -90,7 +95,7 @@ func TestConductorWithMetrics(t *testing.T) {
 
 	// Test with error
 	start = time.Now().Add(-200 * time.Millisecond)
-	conductor.RecordMetrics(start, true)
+	conductor.RecordMetrics("/api", start, true)
 
 	if count := metrics.GetRequestCount(); count != 2 {
 		t.Errorf("Request count should be 2, got %d", count)
@@ -100,3 +105,91 @@ func TestConductorWithMetrics(t *testing.T) {
 		t.Errorf("Error count should be 1, got %d", errCount)
 	}
 }
+
+// TestMetricsSnapshot tests that a snapshot breaks the totals down by route and service
+func TestMetricsSnapshot(t *testing.T) {
+	collector := NewMetricsCollector()
+	for i := 1; i <= 100; i++ {
+		collector.RecordRequest("/users", time.Duration(i)*time.Millisecond, false)
+	}
+	collector.RecordRequest("/orders", 10*time.Millisecond, true)
+	collector.RecordRequest("/orders", 30*time.Millisecond, false)
+	collector.RecordServiceRequest("users", 50*time.Millisecond, false)
+	collector.RecordServiceRequest("orders-v2", 20*time.Millisecond, true)
+	collector.RecordServiceRequest("orders", 20*time.Millisecond, false)
+
+	snapshot := collector.Snapshot()
+	if snapshot.Total.RequestCount != 102 || snapshot.Total.ErrorCount != 1 || snapshot.Total.SuccessCount != 101 {
+		t.Errorf("Unexpected totals %+v", snapshot.Total)
+	}
+
+	if len(snapshot.Routes) != 2 || snapshot.Routes[0].Name != "/orders" || snapshot.Routes[1].Name != "/users" {
+		t.Fatalf("Expected routes sorted by name, got %+v", snapshot.Routes)
+	}
+	orders, users := snapshot.Routes[0], snapshot.Routes[1]
+	if orders.RequestCount != 2 || orders.ErrorRate != 0.5 || orders.AverageRequestTimeMs != 20 {
+		t.Errorf("Unexpected /orders breakdown %+v", orders)
+	}
+	if users.P50Ms < 45 || users.P50Ms > 55 || users.P99Ms < 95 || users.P99Ms > 100 {
+		t.Errorf("Unexpected /users percentiles %+v", users)
+	}
+
+	var names []string
+	for _, service := range snapshot.Services {
+		names = append(names, service.Name)
+	}
+	if len(names) != 3 || names[0] != "orders" || names[1] != "orders-v2" || names[2] != "users" {
+		t.Fatalf("Expected services sorted by name, got %v", names)
+	}
+	if snapshot.Services[1].ErrorRate != 1 {
+		t.Errorf("Unexpected orders-v2 breakdown %+v", snapshot.Services[1])
+	}
+
+	// Requests recorded after the snapshot do not change it
+	collector.RecordRequest("/users", time.Millisecond, false)
+	if snapshot.Total.RequestCount != 102 || snapshot.Routes[1].RequestCount != 100 {
+		t.Errorf("Expected the snapshot unchanged by later requests")
+	}
+}
+
+// TestMetricsHandlerBreakdowns tests that the JSON endpoint reports each route and each
+// service a request was sent to
+func TestMetricsHandlerBreakdowns(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "users", URL: backend.URL, PathPrefix: "/users", Primary: true},
+			{Name: "orders", URL: failing.URL, PathPrefix: "/orders", Primary: true},
+		},
+	}
+	conductor := WithMetrics(NewConductor(cfg))
+	defer conductor.Close()
+
+	for _, target := range []string{"/users/1", "/users/2", "/orders/1"} {
+		conductor.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	recorder := httptest.NewRecorder()
+	MetricsHandler(conductor)(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	var data MetricsData
+	if err := json.NewDecoder(recorder.Body).Decode(&data); err != nil {
+		t.Fatalf("Failed to decode metrics: %v", err)
+	}
+
+	if data.RequestCount != 3 || len(data.Routes) != 2 || len(data.Services) != 2 {
+		t.Fatalf("Unexpected metrics %+v", data)
+	}
+	if route := data.Routes[1]; route.Name != "/users" || route.RequestCount != 2 || route.ErrorCount != 0 {
+		t.Errorf("Unexpected /users breakdown %+v", route)
+	}
+	if service := data.Services[0]; service.Name != "orders" || service.RequestCount != 1 || service.ErrorRate != 1 {
+		t.Errorf("Unexpected orders breakdown %+v", service)
+	}
+}
@@ -0,0 +1,321 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Mirror guard events
+const (
+	mirrorDisabled = "mirror_disabled"
+	mirrorEnabled  = "mirror_enabled"
+)
+
+// mirrorGuard disables mirroring to shadow services whose failures or latency exceed their
+// budget over a whole window, and re-enables them after a cool-down or manual action
+type mirrorGuard struct {
+	mu          sync.Mutex
+	errorRate   float64
+	latency     time.Duration // Zero if latency is not budgeted
+	window      time.Duration
+	minRequests int
+	coolDown    time.Duration
+	windows     map[string]*mirrorWindow // Current window by service
+	disabled    map[string]mirrorTrip    // Disabled services
+	notify      func(event mirrorGuardEvent)
+	now         func() time.Time
+}
+
+// mirrorWindow accumulates the outcomes of a shadow service's requests over one window
+type mirrorWindow struct {
+	start    time.Time
+	requests int
+	failures int
+	latency  time.Duration
+}
+
+// mirrorTrip records why and until when a shadow service is disabled
+type mirrorTrip struct {
+	Service string    `json:"service"`
+	Reason  string    `json:"reason"`
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+}
+
+// mirrorGuardEvent is logged and sent to the webhook when mirroring is disabled or resumes
+type mirrorGuardEvent struct {
+	Event     string     `json:"event"`
+	Service   string     `json:"service"`
+	Reason    string     `json:"reason"`
+	ErrorRate float64    `json:"error_rate,omitempty"`
+	LatencyMs int64      `json:"latency_ms,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	Time      time.Time  `json:"time"`
+}
+
+// newMirrorGuard creates a guard for the configured budget, reporting events to notify
+func newMirrorGuard(cfg config.MirrorGuardConfig, notify func(event mirrorGuardEvent)) *mirrorGuard {
+	return &mirrorGuard{
+		errorRate:   cfg.ErrorRate,
+		latency:     time.Duration(cfg.LatencyMs) * time.Millisecond,
+		window:      time.Duration(cfg.Window) * time.Second,
+		minRequests: cfg.MinRequests,
+		coolDown:    time.Duration(cfg.CoolDown) * time.Second,
+		windows:     make(map[string]*mirrorWindow),
+		disabled:    make(map[string]mirrorTrip),
+		notify:      notify,
+		now:         time.Now,
+	}
+}
+
+// Record adds the outcome of a shadow request. Once a window is over it is judged against
+// the budget, and the service is disabled if the window exceeded it.
+func (g *mirrorGuard) Record(service string, failed bool, latency time.Duration) {
+	g.mu.Lock()
+	now := g.now()
+	var event *mirrorGuardEvent
+	w := g.windows[service]
+	if w == nil || now.Sub(w.start) >= g.window {
+		if w != nil {
+			event = g.judge(service, w, now)
+		}
+		w = &mirrorWindow{start: now}
+		g.windows[service] = w
+	}
+	w.requests++
+	if failed {
+		w.failures++
+	}
+	w.latency += latency
+	g.mu.Unlock()
+
+	if event != nil {
+		g.notify(*event)
+	}
+}
+
+// judge disables a service whose completed window exceeded the budget, returning the event
+func (g *mirrorGuard) judge(service string, w *mirrorWindow, now time.Time) *mirrorGuardEvent {
+	if w.requests < g.minRequests {
+		return nil
+	}
+	errorRate := float64(w.failures) / float64(w.requests)
+	latency := w.latency / time.Duration(w.requests)
+
+	var reason string
+	switch {
+	case errorRate > g.errorRate:
+		reason = fmt.Sprintf("error rate %.2f over budget %.2f", errorRate, g.errorRate)
+	case g.latency > 0 && latency > g.latency:
+		reason = fmt.Sprintf("average latency %dms over budget %dms", latency.Milliseconds(), g.latency.Milliseconds())
+	default:
+		return nil
+	}
+
+	until := now.Add(g.coolDown)
+	g.disabled[service] = mirrorTrip{Service: service, Reason: reason, Since: now, Until: until}
+	delete(g.windows, service)
+	return &mirrorGuardEvent{
+		Event:     mirrorDisabled,
+		Service:   service,
+		Reason:    reason,
+		ErrorRate: errorRate,
+		LatencyMs: latency.Milliseconds(),
+		Until:     &until,
+		Time:      now,
+	}
+}
+
+// Allowed reports whether mirroring to a service is enabled, re-enabling it once its
+// cool-down is over
+func (g *mirrorGuard) Allowed(service string) bool {
+	g.mu.Lock()
+	trip, ok := g.disabled[service]
+	if !ok {
+		g.mu.Unlock()
+		return true
+	}
+	now := g.now()
+	if now.Before(trip.Until) {
+		g.mu.Unlock()
+		return false
+	}
+	delete(g.disabled, service)
+	g.mu.Unlock()
+
+	g.notify(mirrorGuardEvent{Event: mirrorEnabled, Service: service, Reason: "cool-down over", Time: now})
+	return true
+}
+
+// Enable re-enables a disabled service before its cool-down is over
+func (g *mirrorGuard) Enable(service string) error {
+	g.mu.Lock()
+	if _, ok := g.disabled[service]; !ok {
+		g.mu.Unlock()
+		return fmt.Errorf("mirroring to service %q is not disabled", service)
+	}
+	delete(g.disabled, service)
+	now := g.now()
+	g.mu.Unlock()
+
+	g.notify(mirrorGuardEvent{Event: mirrorEnabled, Service: service, Reason: "enabled by admin", Time: now})
+	return nil
+}
+
+// Forget drops the windows and trips of services no longer routed, so a service added
+// back later under the same name starts afresh
+func (g *mirrorGuard) Forget(services []string) {
+	if g == nil || len(services) == 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, service := range services {
+		delete(g.windows, service)
+		delete(g.disabled, service)
+	}
+}
+
+// Disabled returns the disabled services, sorted by name
+func (g *mirrorGuard) Disabled() []mirrorTrip {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	trips := make([]mirrorTrip, 0, len(g.disabled))
+	for _, trip := range g.disabled {
+		trips = append(trips, trip)
+	}
+	sort.Slice(trips, func(i, j int) bool { return trips[i].Service < trips[j].Service })
+	return trips
+}
+
+// skipDisabledMirrors drops the non-primary services the mirror guard has disabled
+func (c *Conductor) skipDisabledMirrors(services []*Service) []*Service {
+	if c.mirrorGuard == nil {
+		return services
+	}
+
+	allowed := make([]*Service, 0, len(services))
+	for _, svc := range services {
+		if svc.Primary || c.mirrorGuard.Allowed(svc.Name) {
+			allowed = append(allowed, svc)
+		}
+	}
+	return allowed
+}
+
+// recordMirror reports the outcome of a shadow request to the mirror guard. Requests the
+// client canceled say nothing about the service, and shadows of frozen routes are not
+// judged so they are not disabled.
+func (c *Conductor) recordMirror(svc *Service, result *serviceResult, latency time.Duration) {
+	if c.mirrorGuard == nil || svc.Primary || errors.Is(result.err, context.Canceled) {
+		return
+	}
+	if _, frozen := c.freezes.Frozen(svc.Route); frozen {
+		return
+	}
+	c.mirrorGuard.Record(svc.Name, result.err != nil || result.resp.StatusCode >= 500, latency)
+}
+
+// mirrorGuardNotifier returns the function logging mirror guard events and posting them
+// to the webhook, if one is configured
+func mirrorGuardNotifier(webhook string) func(event mirrorGuardEvent) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(event mirrorGuardEvent) {
+		fields := map[string]interface{}{
+			"service": event.Service,
+			"reason":  event.Reason,
+		}
+		if event.Event == mirrorDisabled {
+			fields["until"] = event.Until
+			logger.ForService(event.Service).WarnWithFields("Disabling mirroring to service over its error budget", fields)
+		} else {
+			logger.ForService(event.Service).InfoWithFields("Resuming mirroring to service", fields)
+		}
+		if webhook == "" {
+			return
+		}
+
+		// Notify in the background, as events are raised on the request path
+		go func() {
+			body, err := json.Marshal(event)
+			if err != nil {
+				logger.Error("Failed to encode mirror guard event", err)
+				return
+			}
+			resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+			if err != nil {
+				logger.Error("Failed to notify mirror guard webhook", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				logger.WarnWithFields("Mirror guard webhook rejected notification", map[string]interface{}{
+					"status_code": resp.StatusCode,
+					"event":       event.Event,
+					"service":     event.Service,
+				})
+			}
+		}()
+	}
+}
+
+// MirrorGuardStatusHandler creates an admin handler listing the shadow services the mirror
+// guard has disabled
+func MirrorGuardStatusHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+		if c.mirrorGuard == nil {
+			http.Error(w, "Mirror guard not enabled", http.StatusNotFound)
+			return
+		}
+		c.writeMirrorGuardStatus(w)
+	}
+}
+
+// MirrorGuardEnableHandler creates an admin handler re-enabling mirroring to the service
+// given in the "service" query parameter
+func MirrorGuardEnableHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodPost) {
+			return
+		}
+		if c.mirrorGuard == nil {
+			http.Error(w, "Mirror guard not enabled", http.StatusNotFound)
+			return
+		}
+
+		service := r.URL.Query().Get("service")
+		if service == "" {
+			http.Error(w, "Missing service parameter", http.StatusBadRequest)
+			return
+		}
+		if err := c.mirrorGuard.Enable(service); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.writeMirrorGuardStatus(w)
+	}
+}
+
+// writeMirrorGuardStatus writes the disabled services as JSON
+func (c *Conductor) writeMirrorGuardStatus(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	status := struct {
+		Disabled []mirrorTrip `json:"disabled"`
+	}{Disabled: c.mirrorGuard.Disabled()}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, "Failed to encode mirror guard status: "+err.Error(), http.StatusInternalServerError)
+	}
+}
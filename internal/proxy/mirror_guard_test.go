@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestMirrorGuard tests disabling shadow services whose windows exceed the budget, and
+// re-enabling them after the cool-down or by hand
+func TestMirrorGuard(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		latency      time.Duration
+		requests     int
+		wantDisabled bool
+	}{
+		{name: "within budget", requests: 20, failures: 5, latency: 50 * time.Millisecond},
+		{name: "error rate over budget", requests: 20, failures: 15, latency: 50 * time.Millisecond, wantDisabled: true},
+		{name: "latency over budget", requests: 20, latency: 900 * time.Millisecond, wantDisabled: true},
+		{name: "too few requests to judge", requests: 5, failures: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []mirrorGuardEvent
+			guard := newMirrorGuard(config.MirrorGuardConfig{
+				ErrorRate:   0.5,
+				LatencyMs:   500,
+				Window:      60,
+				MinRequests: 10,
+				CoolDown:    300,
+			}, func(event mirrorGuardEvent) { events = append(events, event) })
+			now := time.Unix(1700000000, 0)
+			guard.now = func() time.Time { return now }
+
+			for i := 0; i < tt.requests; i++ {
+				guard.Record("shadow", i < tt.failures, tt.latency)
+			}
+
+			// The window is only judged once it is over
+			if !guard.Allowed("shadow") {
+				t.Fatal("Expected the service to stay enabled during its first window")
+			}
+			now = now.Add(61 * time.Second)
+			guard.Record("shadow", false, tt.latency)
+
+			if allowed := guard.Allowed("shadow"); allowed == tt.wantDisabled {
+				t.Fatalf("Expected disabled=%v, got %v", tt.wantDisabled, !allowed)
+			}
+			if !tt.wantDisabled {
+				if len(events) != 0 {
+					t.Errorf("Expected no events, got %v", events)
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Event != mirrorDisabled || events[0].Service != "shadow" {
+				t.Fatalf("Expected a disabled event, got %v", events)
+			}
+
+			now = now.Add(299 * time.Second)
+			if guard.Allowed("shadow") {
+				t.Error("Expected the service to stay disabled during the cool-down")
+			}
+			now = now.Add(2 * time.Second)
+			if !guard.Allowed("shadow") {
+				t.Error("Expected the service to be enabled after the cool-down")
+			}
+			if len(events) != 2 || events[1].Event != mirrorEnabled {
+				t.Errorf("Expected an enabled event, got %v", events)
+			}
+		})
+	}
+}
+
+// TestMirrorGuardEnable tests re-enabling a disabled service by hand
+func TestMirrorGuardEnable(t *testing.T) {
+	guard := newMirrorGuard(config.MirrorGuardConfig{ErrorRate: 0.5, Window: 60, MinRequests: 1, CoolDown: 300},
+		func(mirrorGuardEvent) {})
+	now := time.Unix(1700000000, 0)
+	guard.now = func() time.Time { return now }
+
+	guard.Record("shadow", true, time.Millisecond)
+	now = now.Add(time.Minute)
+	guard.Record("shadow", true, time.Millisecond)
+	if trips := guard.Disabled(); len(trips) != 1 || trips[0].Service != "shadow" {
+		t.Fatalf("Expected shadow to be disabled, got %v", trips)
+	}
+
+	if err := guard.Enable("shadow"); err != nil {
+		t.Fatalf("Expected enable to succeed, got %v", err)
+	}
+	if !guard.Allowed("shadow") {
+		t.Error("Expected the service to be enabled")
+	}
+	if err := guard.Enable("shadow"); err == nil {
+		t.Error("Expected an error enabling a service that is not disabled")
+	}
+}
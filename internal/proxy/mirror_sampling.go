@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+)
+
+// sampled reports whether a request is sent to a non-primary service configured with a
+// mirror percentage. Services without one receive every request and services set to 0
+// none. Requests carrying the service's sample header are picked by hashing its value, so
+// every request of a user or tenant is mirrored or none is; others by chance.
+func sampled(svc *Service, r *http.Request) bool {
+	if svc.Primary || svc.Config.MirrorPercent == nil {
+		return true
+	}
+	percent := *svc.Config.MirrorPercent
+	switch {
+	case percent <= 0:
+		return false
+	case percent >= 100:
+		return true
+	}
+
+	if header := svc.Config.MirrorSampleHeader; header != "" {
+		if value := r.Header.Get(header); value != "" {
+			hash := fnv.New32a()
+			hash.Write([]byte(value))
+			// Buckets of a hundredth of a percent
+			return float64(hash.Sum32()%10000) < percent*100
+		}
+	}
+	return rand.Float64()*100 < percent
+}
+
+// skipUnsampledMirrors leaves out the non-primary services whose mirror percentage did not
+// select the request
+func skipUnsampledMirrors(r *http.Request, services []*Service) []*Service {
+	for i, svc := range services {
+		if sampled(svc, r) {
+			continue
+		}
+
+		// Copy the services on the first one left out, as most requests keep them all
+		kept := append(make([]*Service, 0, len(services)-1), services[:i]...)
+		for _, svc := range services[i+1:] {
+			if sampled(svc, r) {
+				kept = append(kept, svc)
+			}
+		}
+		return kept
+	}
+	return services
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestSkipUnsampledMirrors tests that shadows receive their percentage of the requests,
+// always the same ones for a given sample header value, that shadows set to 0 receive
+// none, and that primaries and shadows without a percentage receive all
+func TestSkipUnsampledMirrors(t *testing.T) {
+	quarter, none := 25.0, 0.0
+	primary := &Service{Name: "api", Primary: true, Config: config.Service{Name: "api", Primary: true}}
+	staging := &Service{Name: "api-staging", Config: config.Service{Name: "api-staging", MirrorPercent: &quarter, MirrorSampleHeader: "X-User-ID"}}
+	paused := &Service{Name: "api-paused", Config: config.Service{Name: "api-paused", MirrorPercent: &none}}
+	audit := &Service{Name: "api-audit", Config: config.Service{Name: "api-audit"}}
+	services := []*Service{primary, staging, paused, audit}
+
+	mirrored := 0
+	const users = 2000
+	for i := 0; i < users; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/api/items", nil)
+		req.Header.Set("X-User-ID", fmt.Sprintf("user-%d", i))
+
+		kept := skipUnsampledMirrors(req, services)
+		if kept[0] != primary || kept[len(kept)-1] != audit {
+			t.Fatalf("Expected the primary and unsampled shadow to be kept, got %v", getServiceNames(kept))
+		}
+		for _, svc := range kept {
+			if svc == paused {
+				t.Fatal("Expected the shadow set to 0% to receive no requests")
+			}
+		}
+		sampled := len(kept) == 3
+		if sampled {
+			mirrored++
+		}
+
+		// The same user is always mirrored or never
+		for j := 0; j < 5; j++ {
+			if again := len(skipUnsampledMirrors(req, services)) == 3; again != sampled {
+				t.Fatalf("Expected user-%d to be sampled consistently", i)
+			}
+		}
+	}
+
+	if percent := float64(mirrored) * 100 / users; percent < 20 || percent > 30 {
+		t.Errorf("Expected about 25%% of users to be mirrored, got %.1f%%", percent)
+	}
+}
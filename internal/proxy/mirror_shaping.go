@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// mirrorShaper smooths bursts of shadow traffic toward lower-capacity services with a
+// token bucket per service. Requests wait for a token up to a bounded queue delay and are
+// dropped beyond it, so excess mirror traffic never reaches the service.
+type mirrorShaper struct {
+	buckets  map[string]*byteLimiter  // Token buckets by service name
+	maxQueue map[string]time.Duration // Longest wait for a token by service name
+}
+
+// newMirrorShaper creates the buckets for the configured services, which must exist
+func newMirrorShaper(shapes []config.MirrorShape, services []*Service) (*mirrorShaper, error) {
+	known := make(map[string]bool)
+	for _, svc := range services {
+		known[svc.Name] = true
+	}
+
+	m := &mirrorShaper{
+		buckets:  make(map[string]*byteLimiter),
+		maxQueue: make(map[string]time.Duration),
+	}
+	for _, shape := range shapes {
+		if !known[shape.Service] {
+			return nil, fmt.Errorf("mirror shaping for unknown service %q", shape.Service)
+		}
+		m.buckets[shape.Service] = newTokenBucket(shape.RequestsPerSecond, float64(shape.Burst))
+		m.maxQueue[shape.Service] = time.Duration(shape.MaxQueueMs) * time.Millisecond
+	}
+	return m, nil
+}
+
+// carry keeps the buckets of services that remain, so a reload does not refill them
+func (m *mirrorShaper) carry(previous *mirrorShaper) *mirrorShaper {
+	if previous == nil {
+		return m
+	}
+	for name := range m.buckets {
+		if bucket, ok := previous.buckets[name]; ok {
+			m.buckets[name] = bucket
+		}
+	}
+	return m
+}
+
+// Admit waits for the service's token, returning false if the request must be dropped
+// because the queue is full or the context ended while it waited
+func (m *mirrorShaper) Admit(ctx context.Context, service string) bool {
+	bucket, ok := m.buckets[service]
+	if !ok {
+		return true
+	}
+	wait, ok := bucket.Reserve(1, m.maxQueue[service])
+	if !ok {
+		return false
+	}
+	return sleepCtx(ctx, wait) == nil
+}
+
+// admitMirror reports whether a request may be sent to a service, delaying shadow requests
+// to shaped services until their turn. Only shadows of requests with a primary service are
+// shaped, so the response sent to the client never waits on the shaper, and on-demand
+// mirrors are always sent.
+func (c *Conductor) admitMirror(ctx context.Context, svc *Service, originalReq *http.Request, mirrored bool) bool {
+	shaper := c.currentMirrorShaper()
+	if shaper == nil || svc.Primary || !mirrored {
+		return true
+	}
+	if request := onDemandOf(originalReq); request != nil && request.service == svc {
+		return true
+	}
+	if shaper.Admit(ctx, svc.Name) {
+		return true
+	}
+
+	logger.ForService(svc.Name).DebugWithFields("Dropping shadow request over the service's rate", map[string]interface{}{
+		"service": svc.Name,
+		"method":  originalReq.Method,
+		"path":    originalReq.URL.Path,
+	})
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordMirrorDropped(svc.Name, dropReasonShaping)
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestMirrorShaper tests admitting shadow requests at the configured rate, queueing or
+// dropping the excess
+func TestMirrorShaper(t *testing.T) {
+	tests := []struct {
+		name      string
+		shape     config.MirrorShape
+		requests  int
+		wantAdmit int
+		wantWait  time.Duration // Least time the requests take to be admitted
+	}{
+		{name: "burst admitted at once", shape: config.MirrorShape{RequestsPerSecond: 1, Burst: 3}, requests: 3, wantAdmit: 3},
+		{name: "excess dropped without a queue", shape: config.MirrorShape{RequestsPerSecond: 1, Burst: 2}, requests: 5, wantAdmit: 2},
+		{name: "excess queued", shape: config.MirrorShape{RequestsPerSecond: 20, Burst: 1, MaxQueueMs: 200}, requests: 3, wantAdmit: 3, wantWait: 90 * time.Millisecond},
+		{name: "queue overflow dropped", shape: config.MirrorShape{RequestsPerSecond: 20, Burst: 1, MaxQueueMs: 60}, requests: 4, wantAdmit: 2, wantWait: 40 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.shape.Service = "shadow"
+			shaper, err := newMirrorShaper([]config.MirrorShape{tt.shape}, []*Service{{Name: "shadow"}})
+			if err != nil {
+				t.Fatalf("Failed to create shaper: %v", err)
+			}
+
+			// Send the requests at once, as a burst from the primary path would
+			start := time.Now()
+			var admitted atomic.Int32
+			var wg sync.WaitGroup
+			wg.Add(tt.requests)
+			for i := 0; i < tt.requests; i++ {
+				go func() {
+					defer wg.Done()
+					if shaper.Admit(context.Background(), "shadow") {
+						admitted.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if got := int(admitted.Load()); got != tt.wantAdmit {
+				t.Errorf("Expected %d requests admitted, got %d", tt.wantAdmit, got)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wantWait {
+				t.Errorf("Expected admission to take at least %v, took %v", tt.wantWait, elapsed)
+			}
+			if !shaper.Admit(context.Background(), "unshaped") {
+				t.Error("Expected services without shaping to be admitted")
+			}
+		})
+	}
+
+	if _, err := newMirrorShaper([]config.MirrorShape{{Service: "missing", RequestsPerSecond: 1, Burst: 1}}, nil); err == nil {
+		t.Error("Expected an error shaping an unknown service")
+	}
+}
+
+// TestAdmitMirror tests that only shadows of requests answered by a primary are shaped
+func TestAdmitMirror(t *testing.T) {
+	primary := &Service{Name: "api", Primary: true}
+	shadow := &Service{Name: "shadow"}
+	shaper, err := newMirrorShaper([]config.MirrorShape{{Service: "shadow", RequestsPerSecond: 0.001, Burst: 1}}, []*Service{primary, shadow})
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+	conductor := &Conductor{mirrorShaper: shaper}
+	req := httptest.NewRequest("GET", "http://example.com/api", nil)
+
+	if !conductor.admitMirror(context.Background(), shadow, req, true) {
+		t.Fatal("Expected the first shadow request to be admitted")
+	}
+	if conductor.admitMirror(context.Background(), shadow, req, true) {
+		t.Error("Expected the second shadow request to be dropped")
+	}
+	if !conductor.admitMirror(context.Background(), primary, req, true) {
+		t.Error("Expected primary requests to be admitted")
+	}
+	if !conductor.admitMirror(context.Background(), shadow, req, false) {
+		t.Error("Expected requests without a primary to be admitted")
+	}
+}
@@ -0,0 +1,327 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// jsonPathStep is one step of a JSONPath expression
+type jsonPathStep struct {
+	key       string // Object member name, empty for wildcards and indexes
+	index     int    // Array index, -1 for none
+	wildcard  bool   // Matches every member or element
+	recursive bool   // Also matches at any depth below the current node ("..")
+}
+
+// parseJSONPath parses the JSONPath subset used to ignore fields: $, .name, ['name'],
+// [n], [*], .* and ..name
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid JSONPath %q: must start with $", path)
+	}
+
+	var steps []jsonPathStep
+	for rest != "" {
+		step := jsonPathStep{index: -1}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "["):
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q", path, rest)
+		}
+
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q: unclosed bracket", path)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case selector == "*":
+				step.wildcard = true
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				step.key = selector[1 : len(selector)-1]
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid JSONPath %q: bad selector [%s]", path, selector)
+				}
+				step.index = index
+			}
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			step.key = rest[:end]
+			rest = rest[end:]
+			if step.key == "*" {
+				step.key, step.wildcard = "", true
+			}
+			if step.key == "" && !step.wildcard {
+				return nil, fmt.Errorf("invalid JSONPath %q: empty member name", path)
+			}
+		}
+		steps = append(steps, step)
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("invalid JSONPath %q: selects the whole document", path)
+	}
+	return steps, nil
+}
+
+// removePath deletes every node selected by steps below node
+func removePath(node interface{}, steps []jsonPathStep) {
+	step, last := steps[0], len(steps) == 1
+
+	// A recursive step applies again to every descendant
+	if step.recursive {
+		switch value := node.(type) {
+		case map[string]interface{}:
+			for _, child := range value {
+				removePath(child, steps)
+			}
+		case []interface{}:
+			for _, child := range value {
+				removePath(child, steps)
+			}
+		}
+	}
+
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if step.index >= 0 || (!step.wildcard && key != step.key) {
+				continue
+			}
+			if last {
+				delete(value, key)
+			} else {
+				removePath(child, steps[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			if step.key != "" || (!step.wildcard && i != step.index) {
+				continue
+			}
+			if last {
+				// Elements are blanked rather than removed so later indexes still line up
+				value[i] = nil
+			} else {
+				removePath(child, steps[1:])
+			}
+		}
+	}
+}
+
+// bodyNormalizer rewrites response bodies so that differences the comparison should not
+// report, such as key order, timestamps or float noise, disappear
+type bodyNormalizer struct {
+	sortKeys   bool
+	unordered  bool // Sort array elements so their order does not matter
+	ignore     [][]jsonPathStep
+	precision  int // Decimal places, -1 for exact
+	whitespace bool
+	xml        *xmlConverter  // Converts XML bodies to their JSON equivalent, nil if disabled
+	codecs     *codecRegistry // Decodes bodies by content type
+}
+
+// newBodyNormalizer creates a normalizer for the configured rules, or nil if none are set
+func newBodyNormalizer(cfg config.NormalizeConfig) (*bodyNormalizer, error) {
+	n := &bodyNormalizer{sortKeys: cfg.SortKeys, unordered: cfg.IgnoreArrayOrder, precision: -1, whitespace: cfg.Whitespace}
+	if cfg.FloatPrecision != nil {
+		n.precision = *cfg.FloatPrecision
+	}
+	for _, path := range cfg.IgnorePaths {
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			return nil, err
+		}
+		n.ignore = append(n.ignore, steps)
+	}
+	if cfg.XML.Enabled {
+		converter, err := newXMLConverter(cfg.XML)
+		if err != nil {
+			return nil, err
+		}
+		n.xml = converter
+	}
+	codecs, err := newCodecRegistry(cfg.Codecs, n.xml)
+	if err != nil {
+		return nil, err
+	}
+	n.codecs = codecs
+
+	if !n.structural() && !n.whitespace {
+		return nil, nil
+	}
+	return n, nil
+}
+
+// structural reports whether bodies are decoded and compared in canonical JSON form
+func (n *bodyNormalizer) structural() bool {
+	return n.sortKeys || n.unordered || len(n.ignore) > 0 || n.precision >= 0 || n.xml != nil || n.codecs.configured
+}
+
+// Normalize returns the normalized form of a body whose content type is unknown
+func (n *bodyNormalizer) Normalize(body []byte) []byte {
+	return n.NormalizeAs(body, "")
+}
+
+// NormalizeAs returns the normalized form of a body. Structural rules re-encode bodies
+// the codec of their content type decodes, or JSON and, when enabled, XML bodies if no
+// codec is registered for it, as canonical JSON, which also sorts keys; other bodies only
+// have whitespace collapsed.
+func (n *bodyNormalizer) NormalizeAs(body []byte, contentType string) []byte {
+	if n == nil {
+		return body
+	}
+	return n.normalizeIgnoring(body, contentType, n.ignore)
+}
+
+// normalizeIgnoring normalizes a body removing the given paths in place of the configured
+// ones, for bodies that are part of a larger document
+func (n *bodyNormalizer) normalizeIgnoring(body []byte, contentType string, ignore [][]jsonPathStep) []byte {
+	if n == nil || len(body) == 0 {
+		return body
+	}
+
+	if n.structural() {
+		if document, ok := n.decode(body, contentType); ok {
+			for _, steps := range ignore {
+				removePath(document, steps)
+			}
+			if n.precision >= 0 {
+				document = n.roundNumbers(document)
+			}
+			if n.unordered {
+				sortArrays(document)
+			}
+			if canonical, err := (jsonCodec{}).Encode(document); err == nil {
+				return canonical
+			}
+		}
+	}
+
+	if !n.whitespace {
+		return body
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, body) == nil {
+		return compact.Bytes()
+	}
+	return []byte(strings.Join(strings.Fields(string(body)), " "))
+}
+
+// Equal reports whether two normalized bodies are the same. Under structural rules,
+// bodies that differ byte for byte are compared as documents by the codec of their
+// content type when both share one, or as JSON otherwise, so numbers such as 1.0 and 1
+// are equal and protobuf fields set to their default equal fields left out.
+func (n *bodyNormalizer) Equal(a []byte, aType string, b []byte, bType string) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	if n == nil || !n.structural() {
+		return false
+	}
+	documentA, errA := jsonCodec{}.Decode(a)
+	documentB, errB := jsonCodec{}.Decode(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	codec := n.codecs.Lookup(aType)
+	if codec == nil || codec != n.codecs.Lookup(bType) {
+		codec = jsonCodec{}
+	}
+	return codec.Compare(documentA, documentB)
+}
+
+// decode parses a body with the codec of its content type. Without one, it parses a JSON
+// body, or an XML body when XML comparison is enabled.
+func (n *bodyNormalizer) decode(body []byte, contentType string) (interface{}, bool) {
+	if codec := n.codecs.Lookup(contentType); codec != nil {
+		document, err := codec.Decode(body)
+		return document, err == nil
+	}
+	if n.xml != nil && bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) {
+		document, err := n.xml.Convert(body)
+		return document, err == nil
+	}
+
+	document, err := jsonCodec{}.Decode(body)
+	return document, err == nil
+}
+
+// roundNumbers rounds every fractional number in a decoded JSON document to the
+// configured precision. Integers are left as is so large IDs keep every digit.
+func (n *bodyNormalizer) roundNumbers(node interface{}) interface{} {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			value[key] = n.roundNumbers(child)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = n.roundNumbers(child)
+		}
+	case json.Number:
+		if !strings.ContainsAny(string(value), ".eE") {
+			return value
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return value
+		}
+		scale := math.Pow10(n.precision)
+		return json.Number(strconv.FormatFloat(math.Round(f*scale)/scale, 'f', -1, 64))
+	}
+	return node
+}
+
+// sortArrays orders the elements of every array in a decoded JSON document by their
+// canonical encoding, innermost arrays first, so arrays holding the same elements in a
+// different order encode the same
+func sortArrays(node interface{}) {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for _, child := range value {
+			sortArrays(child)
+		}
+	case []interface{}:
+		keys := make([]string, len(value))
+		for i, child := range value {
+			sortArrays(child)
+			encoded, _ := json.Marshal(child)
+			keys[i] = string(encoded)
+		}
+		sort.Sort(byKey{keys: keys, items: value})
+	}
+}
+
+// byKey sorts array elements by their canonical encodings
+type byKey struct {
+	keys  []string
+	items []interface{}
+}
+
+func (b byKey) Len() int           { return len(b.items) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.items[i], b.items[j] = b.items[j], b.items[i]
+}
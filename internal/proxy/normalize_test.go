@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestBodyNormalizer tests that normalized bodies differing only in ignored ways compare equal
+func TestBodyNormalizer(t *testing.T) {
+	two := 2
+
+	tests := []struct {
+		name      string
+		config    config.NormalizeConfig
+		primary   string
+		shadow    string
+		wantEqual bool
+	}{
+		{
+			name:      "key order with sortKeys",
+			config:    config.NormalizeConfig{SortKeys: true},
+			primary:   `{"a":1,"b":{"c":true,"d":null}}`,
+			shadow:    `{"b": {"d": null, "c": true}, "a": 1}`,
+			wantEqual: true,
+		},
+		{
+			name:      "whitespace keeps key order",
+			config:    config.NormalizeConfig{Whitespace: true},
+			primary:   `{"a":1,"b":2}`,
+			shadow:    `{"b": 2, "a": 1}`,
+			wantEqual: false,
+		},
+		{
+			name:      "whitespace in JSON",
+			config:    config.NormalizeConfig{Whitespace: true},
+			primary:   `{"a":[1,2]}`,
+			shadow:    "{\n  \"a\": [1, 2]\n}\n",
+			wantEqual: true,
+		},
+		{
+			name:      "whitespace in text",
+			config:    config.NormalizeConfig{Whitespace: true},
+			primary:   "<p>hello world</p>",
+			shadow:    "<p>hello\n\t world</p>\n",
+			wantEqual: true,
+		},
+		{
+			name:      "ignored fields at any depth",
+			config:    config.NormalizeConfig{IgnorePaths: []string{"$..timestamp", "$.items[*].id"}},
+			primary:   `{"timestamp":1,"items":[{"id":"a1","name":"x","meta":{"timestamp":5}}]}`,
+			shadow:    `{"timestamp":2,"items":[{"id":"b7","name":"x","meta":{"timestamp":6}}]}`,
+			wantEqual: true,
+		},
+		{
+			name:      "other fields still compared",
+			config:    config.NormalizeConfig{IgnorePaths: []string{"$['request-id']"}},
+			primary:   `{"request-id":"a","total":3}`,
+			shadow:    `{"request-id":"b","total":4}`,
+			wantEqual: false,
+		},
+		{
+			name:      "array order with ignoreArrayOrder",
+			config:    config.NormalizeConfig{IgnoreArrayOrder: true},
+			primary:   `{"tags":["b","a"],"items":[{"id":2,"roles":["x","y"]},{"id":1}]}`,
+			shadow:    `{"items":[{"id":1},{"roles":["y","x"],"id":2}],"tags":["a","b"]}`,
+			wantEqual: true,
+		},
+		{
+			name:      "array order still counts repeated elements",
+			config:    config.NormalizeConfig{IgnoreArrayOrder: true},
+			primary:   `{"tags":["a","a","b"]}`,
+			shadow:    `{"tags":["a","b","b"]}`,
+			wantEqual: false,
+		},
+		{
+			name:      "float precision",
+			config:    config.NormalizeConfig{FloatPrecision: &two},
+			primary:   `{"price":19.990000001,"qty":1.0,"id":12345678901234567890}`,
+			shadow:    `{"price":19.99,"qty":1,"id":12345678901234567890}`,
+			wantEqual: true,
+		},
+		{
+			name:      "float precision still detects changes",
+			config:    config.NormalizeConfig{FloatPrecision: &two},
+			primary:   `{"price":19.99}`,
+			shadow:    `{"price":19.98}`,
+			wantEqual: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizer, err := newBodyNormalizer(tt.config)
+			if err != nil {
+				t.Fatalf("Failed to create normalizer: %v", err)
+			}
+			primary := string(normalizer.Normalize([]byte(tt.primary)))
+			shadow := string(normalizer.Normalize([]byte(tt.shadow)))
+			if (primary == shadow) != tt.wantEqual {
+				t.Errorf("Expected equal=%v, got %q and %q", tt.wantEqual, primary, shadow)
+			}
+		})
+	}
+}
+
+// TestParseJSONPath tests validation of ignored field paths
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "$.meta.timestamp"},
+		{path: "$..uuid"},
+		{path: "$.items[0]['created-at']"},
+		{path: "$.*.id"},
+		{path: "meta.timestamp", wantErr: true},
+		{path: "$", wantErr: true},
+		{path: "$.items[x]", wantErr: true},
+		{path: "$.items[0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := parseJSONPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if normalizer, err := newBodyNormalizer(config.NormalizeConfig{}); normalizer != nil || err != nil {
+		t.Errorf("Expected no normalizer without rules, got %v (err: %v)", normalizer, err)
+	}
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// onDemandMirror lets authorized clients mirror a single request to a named service and
+// get the comparison summary back in a response header
+type onDemandMirror struct {
+	header        string
+	summaryHeader string
+	require       authExpr
+}
+
+// onDemandKey carries the on-demand mirror of a request
+type onDemandKey struct{}
+
+// onDemandRequest is the on-demand mirror of one request
+type onDemandRequest struct {
+	service *Service
+	result  chan *serviceResult // Receives the mirror's result once it arrives
+}
+
+// newOnDemandMirror creates the on-demand mirror for the configuration, which must name
+// the authentication requirement clients have to satisfy
+func newOnDemandMirror(cfg config.OnDemandMirrorConfig, authCfg config.AuthConfig) (*onDemandMirror, error) {
+	methods, err := newAuthMethods(authCfg)
+	if err != nil {
+		return nil, err
+	}
+	require, err := parseAuthExpr(cfg.Require, methods)
+	if err != nil {
+		return nil, err
+	}
+
+	return &onDemandMirror{
+		header:        cfg.Header,
+		summaryHeader: cfg.SummaryHeader,
+		require:       require,
+	}, nil
+}
+
+// applyOnDemandMirror adds the service named by the request's mirror header to the services
+// the request is sent to, as a non-primary service. Requests that are not authorized, name
+// an unknown service, or would write twice are proxied as usual, with the problem in the
+// summary header. Only safe methods are mirrored, unless the named service opted in to
+// unsafe methods with mirrorUnsafeMethods.
+func (c *Conductor) applyOnDemandMirror(w http.ResponseWriter, r *http.Request, services []*Service) (*http.Request, []*Service) {
+	if c.onDemand == nil {
+		return r, services
+	}
+	name := r.Header.Get(c.onDemand.header)
+	if name == "" {
+		return r, services
+	}
+	r.Header.Del(c.onDemand.header)
+
+	svc, ok := c.serviceNamed(name)
+	switch {
+	case !c.onDemand.require.Eval(r):
+		logger.WarnWithFields("Rejecting unauthorized on-demand mirror", map[string]interface{}{
+			"service":     name,
+			"path":        r.URL.Path,
+			"remote_addr": r.RemoteAddr,
+		})
+		w.Header().Set(c.onDemand.summaryHeader, "outcome=error; error=unauthorized")
+		return r, services
+	case !ok:
+		w.Header().Set(c.onDemand.summaryHeader, "outcome=error; error=unknown service")
+		return r, services
+	case !isSafeMethod(r.Method) && !svc.Config.MirrorUnsafeMethods:
+		w.Header().Set(c.onDemand.summaryHeader, "outcome=error; error=unsafe method")
+		return r, services
+	}
+
+	// Mirror to a copy, so a primary service of another route is not selected here
+	mirror := *svc
+	mirror.Primary = false
+	mirrored := make([]*Service, 0, len(services)+1)
+	for _, existing := range services {
+		if existing.Name != name {
+			mirrored = append(mirrored, existing)
+		}
+	}
+	mirrored = append(mirrored, &mirror)
+
+	logger.InfoWithFields("Mirroring request on demand", map[string]interface{}{
+		"service": name,
+		"method":  r.Method,
+		"path":    r.URL.Path,
+	})
+	request := &onDemandRequest{service: &mirror, result: make(chan *serviceResult, 1)}
+	return r.WithContext(context.WithValue(r.Context(), onDemandKey{}, request)), mirrored
+}
+
+// onDemandOf returns the on-demand mirror of a request, or nil if it has none
+func onDemandOf(r *http.Request) *onDemandRequest {
+	request, _ := r.Context().Value(onDemandKey{}).(*onDemandRequest)
+	return request
+}
+
+// deliverOnDemand hands a result to the request's on-demand mirror if it is the mirror's
+func deliverOnDemand(r *http.Request, result *serviceResult) {
+	if request := onDemandOf(r); request != nil && request.service == result.service {
+		request.result <- result
+	}
+}
+
+// reportOnDemandMirror waits for the on-demand mirror's result and sets the summary header
+// comparing it with the response sent to the client
+func (c *Conductor) reportOnDemandMirror(ctx context.Context, w http.ResponseWriter, r *http.Request, selected *serviceResult) {
+	request := onDemandOf(r)
+	if request == nil {
+		return
+	}
+
+	var mirror *serviceResult
+	select {
+	case mirror = <-request.result:
+	case <-ctx.Done():
+		w.Header().Set(c.onDemand.summaryHeader, fmt.Sprintf("outcome=error; service=%s; error=timeout", request.service.Name))
+		return
+	}
+	w.Header().Set(c.onDemand.summaryHeader, c.onDemandSummary(selected, mirror))
+}
+
+// onDemandSummary describes how the mirror's response compared with the selected one
+func (c *Conductor) onDemandSummary(selected *serviceResult, mirror *serviceResult) string {
+	name := mirror.service.Name
+	if mirror.err != nil {
+		return fmt.Sprintf("outcome=error; service=%s; error=request failed", name)
+	}
+	if selected == nil || selected.stream != nil {
+		return fmt.Sprintf("outcome=error; service=%s; error=no response to compare; status=%d", name, mirror.resp.StatusCode)
+	}
+
+	rules := c.comparison.rulesFor(selected.service.Name, name)
+	selectedType, mirrorType := responseContentType(selected), responseContentType(mirror)
+	sameBody := rules.normalizer.Equal(rules.normalizer.NormalizeAs(selected.body, selectedType), selectedType,
+		rules.normalizer.NormalizeAs(mirror.body, mirrorType), mirrorType)
+	outcome, differences := compareResults(selected, mirror, sameBody, rules.comparedHeaders(selected.resp.Header, mirror.resp.Header))
+	summary := fmt.Sprintf("outcome=%s; service=%s; compared=%s; status=%d,%d; bytes=%d,%d", outcome, name,
+		selected.service.Name, selected.resp.StatusCode, mirror.resp.StatusCode, len(selected.body), len(mirror.body))
+	if len(differences) > 0 {
+		summary += "; differs=" + strings.Join(differences, ",")
+	}
+	return summary
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestOnDemandMirror tests mirroring single requests to a named service and reporting the
+// comparison to the client
+func TestOnDemandMirror(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://primary.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "api-v2", URL: "http://v2.example.com", PathPrefix: "/v2"},
+		},
+		Auth: config.AuthConfig{
+			Methods: map[string]config.AuthMethodConfig{
+				"developers": {Type: "apiKey", Keys: []string{"dev-key"}},
+			},
+		},
+		OnDemandMirror: config.OnDemandMirrorConfig{
+			Enabled:       true,
+			Header:        "X-Conductor-Mirror-To",
+			SummaryHeader: "X-Conductor-Mirror-Diff",
+			Require:       "developers",
+		},
+	}
+	conductor := NewConductor(cfg)
+	transport := &countingTransport{counts: make(map[string]int)}
+	conductor.client = &http.Client{Transport: transport}
+
+	tests := []struct {
+		name        string
+		method      string
+		apiKey      string
+		mirrorTo    string
+		wantSummary string
+		wantMirror  int
+	}{
+		{name: "no header", apiKey: "dev-key"},
+		{name: "authorized", apiKey: "dev-key", mirrorTo: "api-v2", wantSummary: "outcome=match; service=api-v2; compared=api; status=200,200; bytes=2,2", wantMirror: 1},
+		{name: "unauthorized", apiKey: "guess", mirrorTo: "api-v2", wantSummary: "outcome=error; error=unauthorized"},
+		{name: "unknown service", apiKey: "dev-key", mirrorTo: "missing", wantSummary: "outcome=error; error=unknown service"},
+		{name: "unsafe method", method: "POST", apiKey: "dev-key", mirrorTo: "api-v2", wantSummary: "outcome=error; error=unsafe method"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport.counts = make(map[string]int)
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, "http://example.com/api/users", nil)
+			req.Header.Set("X-API-Key", tt.apiKey)
+			if tt.mirrorTo != "" {
+				req.Header.Set("X-Conductor-Mirror-To", tt.mirrorTo)
+			}
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", recorder.Code)
+			}
+			if summary := recorder.Header().Get("X-Conductor-Mirror-Diff"); summary != tt.wantSummary {
+				t.Errorf("Expected summary %q, got %q", tt.wantSummary, summary)
+			}
+			if count := transport.count("primary.example.com"); count != 1 {
+				t.Errorf("Expected 1 primary request, got %d", count)
+			}
+			if count := transport.count("v2.example.com"); count != tt.wantMirror {
+				t.Errorf("Expected %d mirrored requests, got %d", tt.wantMirror, count)
+			}
+		})
+	}
+}
+
+// TestOnDemandMirrorConfig tests that the mirror refuses requirements naming unknown methods
+func TestOnDemandMirrorConfig(t *testing.T) {
+	_, err := newOnDemandMirror(config.OnDemandMirrorConfig{Enabled: true, Require: "nobody"}, config.AuthConfig{})
+	if err == nil || !strings.Contains(err.Error(), "nobody") {
+		t.Errorf("Expected an error naming the unknown method, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// admit reserves an in-flight slot for a request, reporting false if the global cap is
+// reached. Admitted requests must release their slot by decrementing c.inFlight.
+func (c *Conductor) admit() bool {
+	limit := int64(c.config.Overload.MaxInFlight)
+	if c.inFlight.Add(1) > limit && limit > 0 {
+		c.inFlight.Add(-1)
+		return false
+	}
+	return true
+}
+
+// handleOverloaded rejects a request shed because too many requests are in flight
+func (c *Conductor) handleOverloaded(w http.ResponseWriter, r *http.Request, requestStart time.Time, traceID string) {
+	logger.WarnWithFields("Too many requests in flight, shedding request", map[string]interface{}{
+		"method":       r.Method,
+		"path":         r.URL.Path,
+		"max_inflight": c.config.Overload.MaxInFlight,
+	})
+
+	w.Header().Set("Retry-After", strconv.Itoa(c.config.Overload.RetryAfter))
+	writeError(w, r, http.StatusServiceUnavailable, ErrCodeOverloaded, "Too many requests in flight")
+
+	// Record shed request in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", "none", "overloaded")
+		c.prometheusMetrics.RecordRequest("conductor", "none", r.Method, "503", time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics("none", requestStart, true)
+	}
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestMaxInFlight tests that requests beyond the in-flight cap are shed with 503
+func TestMaxInFlight(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+		Overload: config.OverloadConfig{MaxInFlight: 1, RetryAfter: 2},
+	}
+	conductor := NewConductor(cfg)
+	transport := &gatedTransport{release: make(chan struct{})}
+	conductor.client = &http.Client{Transport: transport}
+
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/users", nil))
+		return recorder
+	}
+
+	// Hold the only slot with a request waiting on the backend
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- get() }()
+	for atomic.LoadInt32(&transport.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	recorder := get()
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") != "2" {
+		t.Fatalf("Expected 503 with Retry-After 2, got %d %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+
+	// Once the first request completes its slot is free again
+	close(transport.release)
+	if recorder := <-done; recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected the admitted request to succeed, got %d", recorder.Code)
+	}
+	if recorder := get(); recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 after the slot was released, got %d", recorder.Code)
+	}
+	if n := conductor.inFlight.Load(); n != 0 {
+		t.Errorf("Expected no requests in flight, got %d", n)
+	}
+}
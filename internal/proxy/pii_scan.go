@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"regexp"
+	"strings"
+)
+
+// piiPatterns find personal data by kind. Card numbers must also pass the Luhn check.
+var piiPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{kind: "email", pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{kind: "card_number", pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)},
+	{kind: "ssn", pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+}
+
+// piiScanner reports personal data in responses: in the string values of JSON bodies by
+// their path, or anywhere in text bodies
+type piiScanner struct{}
+
+// Process implements responseProcessor. Responses of every status are scanned, as error
+// bodies can leak personal data too; bodies that are neither JSON nor text are skipped.
+func (piiScanner) Process(status int, body []byte, contentType string) []processorFinding {
+	var findings []processorFinding
+	seen := make(map[string]bool)
+	scan := func(text string, path string) {
+		for _, kind := range piiKinds(text) {
+			if !seen[kind+" "+path] {
+				seen[kind+" "+path] = true
+				findings = append(findings, processorFinding{Kind: kind, Path: path})
+			}
+		}
+	}
+
+	if document, err := (jsonCodec{}).Decode(body); err == nil {
+		var walk func(node interface{}, path string)
+		walk = func(node interface{}, path string) {
+			switch value := node.(type) {
+			case map[string]interface{}:
+				for key, member := range value {
+					walk(member, memberPath(path, key))
+				}
+			case []interface{}:
+				for _, item := range value {
+					walk(item, path+"[*]")
+				}
+			case string:
+				scan(value, path)
+			}
+		}
+		walk(document, "$")
+		return findings
+	}
+	if strings.HasPrefix(contentType, "text/") {
+		scan(string(body), "")
+	}
+	return findings
+}
+
+// piiKinds returns the kinds of personal data found in a text
+func piiKinds(text string) []string {
+	var kinds []string
+	for _, pii := range piiPatterns {
+		for _, match := range pii.pattern.FindAllString(text, -1) {
+			if pii.kind != "card_number" || luhnValid(match) {
+				kinds = append(kinds, pii.kind)
+				break
+			}
+		}
+	}
+	return kinds
+}
+
+// luhnValid reports whether the digits of a number pass the Luhn checksum
+func luhnValid(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if digit < 0 || digit > 9 {
+			continue
+		}
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
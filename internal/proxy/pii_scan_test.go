@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestPIIScanner tests finding personal data in JSON and text bodies
+func TestPIIScanner(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        []string
+	}{
+		{name: "json", body: `{"user":{"contact":"jane@example.com"},"cards":[{"pan":"4111 1111 1111 1111"}],"ref":"123-45-6789"}`,
+			contentType: "application/json", want: []string{"card_number $.cards[*].pan", "email $.user.contact", "ssn $.ref"}},
+		{name: "invalid card number", body: `{"order":"4111111111111112"}`, contentType: "application/json", want: nil},
+		{name: "text", body: "Contact jane@example.com", contentType: "text/plain", want: []string{"email "}},
+		{name: "binary", body: "jane@example.com", contentType: "application/octet-stream", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, finding := range (piiScanner{}).Process(http.StatusOK, []byte(tt.body), tt.contentType) {
+				got = append(got, finding.Kind+" "+finding.Path)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected findings %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// readPinning pins a client's reads to the backend that handled its last write for a
+// while, so reads see the write while replicas of other backends lag. The pin travels in
+// a signed token set as a cookie and a response header.
+type readPinning struct {
+	cookie string
+	header string
+	ttl    time.Duration
+	secret []byte
+	routes map[string]bool // Pinned routes, nil for all
+	now    func() time.Time
+}
+
+// pinKey carries the service a read is pinned to
+type pinKey struct{}
+
+// newReadPinning creates the pinning for the configuration
+func newReadPinning(cfg config.ReadYourWritesConfig) *readPinning {
+	p := &readPinning{
+		cookie: cfg.Cookie,
+		header: cfg.Header,
+		ttl:    time.Duration(cfg.TTL) * time.Second,
+		secret: []byte(cfg.Secret),
+		now:    time.Now,
+	}
+	if len(cfg.Routes) > 0 {
+		p.routes = make(map[string]bool, len(cfg.Routes))
+		for _, route := range cfg.Routes {
+			p.routes[route] = true
+		}
+	}
+	return p
+}
+
+// covers reports whether reads on a route are pinned
+func (p *readPinning) covers(route string) bool {
+	return p.routes == nil || p.routes[route]
+}
+
+// Token returns a token pinning reads on a route to a service until the TTL is over
+func (p *readPinning) Token(route string, service string) string {
+	expires := strconv.FormatInt(p.now().Add(p.ttl).Unix(), 10)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(route + "\n" + service + "\n" + expires))
+	return payload + "." + p.sign(payload)
+}
+
+// Pinned returns the service the request's token pins reads on the route to, preferring
+// the header to the cookie. Forged, expired and other routes' tokens are ignored.
+func (p *readPinning) Pinned(r *http.Request, route string) (string, bool) {
+	token := r.Header.Get(p.header)
+	if token == "" {
+		cookie, err := r.Cookie(p.cookie)
+		if err != nil {
+			return "", false
+		}
+		token = cookie.Value
+	}
+
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(p.sign(payload))) {
+		return "", false
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", false
+	}
+	fields := strings.Split(string(decoded), "\n")
+	if len(fields) != 3 || fields[0] != route {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || !p.now().Before(time.Unix(expires, 0)) {
+		return "", false
+	}
+	return fields[1], true
+}
+
+// sign returns the signature of a token payload
+func (p *readPinning) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// applyPin makes the service a read is pinned to the primary of the request, sending the
+// route's other services the request as shadows. Pins to services the request would not
+// be sent to are ignored.
+func (c *Conductor) applyPin(route string, r *http.Request, services []*Service) (*http.Request, []*Service) {
+	if c.pinning == nil || !isSafeMethod(r.Method) || !c.pinning.covers(route) {
+		return r, services
+	}
+	name, ok := c.pinning.Pinned(r, route)
+	if !ok {
+		return r, services
+	}
+
+	pinned := make([]*Service, 0, len(services))
+	found := false
+	for _, svc := range services {
+		if svc.Name == name {
+			found = true
+		}
+		if (svc.Name == name) != svc.Primary {
+			// Copy the service, so other requests keep the configured primary
+			swapped := *svc
+			swapped.Primary = svc.Name == name
+			svc = &swapped
+		}
+		pinned = append(pinned, svc)
+	}
+	if !found {
+		return r, services
+	}
+
+	logger.DebugWithFields("Pinning read to the service of the client's last write", map[string]interface{}{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"service": name,
+	})
+	return r.WithContext(context.WithValue(r.Context(), pinKey{}, name)), pinned
+}
+
+// pinnedTo returns the service a read is pinned to, or an empty string if it is not
+func pinnedTo(r *http.Request) string {
+	name, _ := r.Context().Value(pinKey{}).(string)
+	return name
+}
+
+// pinWrite pins the client's reads on the route to the service that handled a successful
+// write, setting the token as a cookie and a response header
+func (c *Conductor) pinWrite(w http.ResponseWriter, r *http.Request, route string, result *serviceResult) {
+	if c.pinning == nil || isSafeMethod(r.Method) || !c.pinning.covers(route) || result.resp.StatusCode >= 400 {
+		return
+	}
+
+	token := c.pinning.Token(route, result.service.Name)
+	w.Header().Set(c.pinning.header, token)
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.pinning.cookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(c.pinning.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestReadPinningToken tests that only valid tokens for the route pin reads
+func TestReadPinningToken(t *testing.T) {
+	pinning := newReadPinning(config.ReadYourWritesConfig{TTL: 5, Cookie: "conductor_pin", Header: "X-Conductor-Pin", Secret: "s3cret"})
+	now := time.Unix(1700000000, 0)
+	pinning.now = func() time.Time { return now }
+	token := pinning.Token("/api", "api-v2")
+
+	forger := newReadPinning(config.ReadYourWritesConfig{TTL: 5, Secret: "guess"})
+	forger.now = pinning.now
+
+	tests := []struct {
+		name    string
+		route   string
+		header  string
+		cookie  string
+		elapsed time.Duration
+		want    string
+	}{
+		{name: "header", route: "/api", header: token, want: "api-v2"},
+		{name: "cookie", route: "/api", cookie: token, want: "api-v2"},
+		{name: "header preferred", route: "/api", header: token, cookie: pinning.Token("/api", "api"), want: "api-v2"},
+		{name: "expired", route: "/api", header: token, elapsed: 5 * time.Second},
+		{name: "other route", route: "/search", header: token},
+		{name: "forged", route: "/api", header: forger.Token("/api", "api-v2")},
+		{name: "malformed", route: "/api", header: "not-a-token"},
+		{name: "none", route: "/api"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinning.now = func() time.Time { return now.Add(tt.elapsed) }
+			req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Conductor-Pin", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "conductor_pin", Value: tt.cookie})
+			}
+
+			service, ok := pinning.Pinned(req, tt.route)
+			if ok != (tt.want != "") || service != tt.want {
+				t.Errorf("Expected pin to %q, got %q (ok=%v)", tt.want, service, ok)
+			}
+		})
+	}
+}
+
+// pinTransport answers with the backend's host, failing writes to failHost
+type pinTransport struct {
+	failHost string
+}
+
+func (pt *pinTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == pt.failHost && req.Method != http.MethodGet {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(req.URL.Host)),
+	}, nil
+}
+
+// TestReadYourWrites tests that reads after a write go to the backend that handled it
+func TestReadYourWrites(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://primary.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "api-v2", URL: "http://v2.example.com", PathPrefix: "/api", MirrorUnsafeMethods: true},
+		},
+		ReadYourWrites: config.ReadYourWritesConfig{Enabled: true, TTL: 5, Cookie: "conductor_pin", Header: "X-Conductor-Pin", Secret: "s3cret"},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: &pinTransport{failHost: "primary.example.com"}}
+
+	// The primary fails the write, so the secondary handles it and reads are pinned there
+	write := httptest.NewRequest("POST", "http://example.com/api/users", strings.NewReader(`{}`))
+	recorder := httptest.NewRecorder()
+	conductor.ServeHTTP(recorder, write)
+	if recorder.Body.String() != "v2.example.com" {
+		t.Fatalf("Expected the write to be handled by v2, got %q", recorder.Body.String())
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "conductor_pin" || recorder.Header().Get("X-Conductor-Pin") == "" {
+		t.Fatalf("Expected a pin cookie and header, got %v", recorder.Header())
+	}
+
+	tests := []struct {
+		name     string
+		cookie   *http.Cookie
+		wantHost string
+	}{
+		{name: "pinned read", cookie: cookies[0], wantHost: "v2.example.com"},
+		{name: "unpinned read", wantHost: "primary.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+			if tt.cookie != nil {
+				read.AddCookie(tt.cookie)
+			}
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, read)
+
+			if recorder.Body.String() != tt.wantHost {
+				t.Errorf("Expected the read to be answered by %s, got %q", tt.wantHost, recorder.Body.String())
+			}
+			if recorder.Header().Get("Set-Cookie") != "" {
+				t.Error("Expected reads not to set a pin")
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Outcomes of post-processing a response
+const (
+	postProcessClean    = "clean"
+	postProcessFindings = "findings"
+	postProcessDropped  = "dropped"
+)
+
+// postProcessFinding is reported for each finding of a post-processor
+const postProcessFinding = "post_process_finding"
+
+// Reasons a response is not queued for post-processing
+var (
+	errPostProcessQueueFull = errors.New("post-processing queue full")
+	errPostProcessClosed    = errors.New("post-processing pipeline closed")
+)
+
+// responseProcessor checks a sampled response body. Findings name what was found and
+// where, never the content itself.
+type responseProcessor interface {
+	Process(status int, body []byte, contentType string) []processorFinding
+}
+
+// processorFinding is something a post-processor found in a response
+type processorFinding struct {
+	Kind string // What was found, such as field_added or email
+	Path string // JSONPath where it was found, empty for the whole body
+}
+
+// routeProcessor is a post-processor configured for a route
+type routeProcessor struct {
+	name       string
+	sampleRate float64
+	processor  responseProcessor
+}
+
+// postProcessJob is a response queued for the processors sampled to check it
+type postProcessJob struct {
+	route       string
+	service     string
+	status      int
+	body        []byte
+	contentType string
+	processors  []*routeProcessor
+}
+
+// postProcessEvent is logged and posted to the webhook for each finding
+type postProcessEvent struct {
+	Event     string    `json:"event"`
+	Processor string    `json:"processor"`
+	Route     string    `json:"route"`
+	Service   string    `json:"service"`
+	Kind      string    `json:"kind"`
+	Path      string    `json:"path,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// postProcessPipeline runs post-processors on sampled responses on background workers.
+// Jobs are queued without blocking and dropped when the queue is full, so checks never
+// add latency to client requests.
+type postProcessPipeline struct {
+	mu         sync.RWMutex
+	closed     bool
+	queue      chan postProcessJob
+	wg         sync.WaitGroup
+	processors map[string][]*routeProcessor // Processors by route name
+	onResult   func(route string, processor string, outcome string, findings []processorFinding)
+	onFinding  func(event postProcessEvent)
+}
+
+// newPostProcessPipeline creates the configured processors, whose routes must exist, and
+// starts the workers running them
+func newPostProcessPipeline(cfg config.PostProcessingConfig, services []*Service, onResult func(route string, processor string, outcome string, findings []processorFinding), onFinding func(event postProcessEvent)) (*postProcessPipeline, error) {
+	known := make(map[string]bool)
+	for _, svc := range services {
+		known[svc.Route] = true
+	}
+
+	p := &postProcessPipeline{
+		queue:      make(chan postProcessJob, cfg.QueueSize),
+		processors: make(map[string][]*routeProcessor),
+		onResult:   onResult,
+		onFinding:  onFinding,
+	}
+	for _, processor := range cfg.Processors {
+		if !known[processor.Route] {
+			return nil, fmt.Errorf("post-processor for unknown route %q", processor.Route)
+		}
+		var check responseProcessor
+		switch processor.Type {
+		case "schema":
+			check = newSchemaDriftDetector()
+		case "pii":
+			check = piiScanner{}
+		default:
+			return nil, fmt.Errorf("unknown post-processor type %q", processor.Type)
+		}
+		p.processors[processor.Route] = append(p.processors[processor.Route], &routeProcessor{
+			name:       processor.Type,
+			sampleRate: processor.SampleRate,
+			processor:  check,
+		})
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p, nil
+}
+
+// carry keeps the processors of routes that remain, so a reload does not forget the
+// schemas they learned. The processors are configured the same, as reloads keep the
+// startup post-processing settings.
+func (p *postProcessPipeline) carry(previous *postProcessPipeline) *postProcessPipeline {
+	if previous == nil {
+		return p
+	}
+	for route, processors := range p.processors {
+		if kept := previous.processors[route]; len(kept) == len(processors) {
+			p.processors[route] = kept
+		}
+	}
+	return p
+}
+
+// Sample returns the route's processors sampled to check a response, nil if none
+func (p *postProcessPipeline) Sample(route string) []*routeProcessor {
+	var sampled []*routeProcessor
+	for _, processor := range p.processors[route] {
+		if rand.Float64() < processor.sampleRate {
+			sampled = append(sampled, processor)
+		}
+	}
+	return sampled
+}
+
+// Submit queues a job, returning why it was dropped if the queue was full or the
+// pipeline closed, such as a pipeline replaced by a reload
+func (p *postProcessPipeline) Submit(job postProcessJob) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return errPostProcessClosed
+	}
+
+	select {
+	case p.queue <- job:
+		return nil
+	default:
+		return errPostProcessQueueFull
+	}
+}
+
+// Close stops accepting jobs and waits for queued jobs to be processed
+func (p *postProcessPipeline) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// work processes jobs until the queue is closed
+func (p *postProcessPipeline) work() {
+	defer p.wg.Done()
+	for job := range p.queue {
+		p.process(job)
+	}
+}
+
+// process runs every sampled processor of a job and reports what they found
+func (p *postProcessPipeline) process(job postProcessJob) {
+	for _, processor := range job.processors {
+		findings := processor.processor.Process(job.status, job.body, job.contentType)
+		outcome := postProcessClean
+		if len(findings) > 0 {
+			outcome = postProcessFindings
+		}
+		if p.onResult != nil {
+			p.onResult(job.route, processor.name, outcome, findings)
+		}
+		if p.onFinding == nil {
+			continue
+		}
+		for _, finding := range findings {
+			p.onFinding(postProcessEvent{
+				Event:     postProcessFinding,
+				Processor: processor.name,
+				Route:     job.route,
+				Service:   job.service,
+				Kind:      finding.Kind,
+				Path:      finding.Path,
+				Time:      time.Now(),
+			})
+		}
+	}
+}
+
+// submitPostProcessing queues a sample of the response sent to the client for the route's
+// post-processors, if any. Streamed responses were never held, so they are not checked.
+func (c *Conductor) submitPostProcessing(route string, result *serviceResult) {
+	pipeline := c.currentPostProcessing()
+	if pipeline == nil || result == nil || result.resp == nil || result.stream != nil || len(result.body) == 0 {
+		return
+	}
+	processors := pipeline.Sample(route)
+	if len(processors) == 0 {
+		return
+	}
+
+	job := postProcessJob{
+		route:       route,
+		service:     result.service.Name,
+		status:      result.resp.StatusCode,
+		body:        result.body,
+		contentType: responseContentType(result),
+		processors:  processors,
+	}
+	if err := pipeline.Submit(job); err != nil {
+		fields := map[string]interface{}{
+			"route":   route,
+			"service": result.service.Name,
+		}
+		if errors.Is(err, errPostProcessClosed) {
+			// The pipeline was replaced by a reload or the conductor is closing
+			logger.DebugWithFields("Post-processing pipeline closed, dropping response", fields)
+		} else {
+			logger.WarnWithFields("Post-processing queue full, dropping response", fields)
+		}
+		for _, processor := range processors {
+			c.recordPostProcess(route, processor.name, postProcessDropped, nil)
+		}
+	}
+}
+
+// recordPostProcess reports the outcome of a post-processor and what it found
+func (c *Conductor) recordPostProcess(route string, processor string, outcome string, findings []processorFinding) {
+	if c.prometheusMetrics == nil {
+		return
+	}
+	c.prometheusMetrics.RecordPostProcess(route, processor, outcome)
+	for _, finding := range findings {
+		c.prometheusMetrics.RecordPostProcessFinding(route, processor, finding.Kind)
+	}
+}
+
+// postProcessNotifier returns the function logging post-processing findings and posting
+// them to the webhook, if one is configured
+func postProcessNotifier(webhook string) func(event postProcessEvent) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(event postProcessEvent) {
+		logger.ForService(event.Service).WarnWithFields("Post-processor reported a finding", map[string]interface{}{
+			"processor": event.Processor,
+			"route":     event.Route,
+			"service":   event.Service,
+			"kind":      event.Kind,
+			"path":      event.Path,
+		})
+		if webhook == "" {
+			return
+		}
+
+		// Workers post one finding at a time, so a slow webhook only backs up the queue
+		body, err := json.Marshal(event)
+		if err != nil {
+			logger.Error("Failed to encode post-processing event", err)
+			return
+		}
+		resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			logger.Error("Failed to notify post-processing webhook", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logger.WarnWithFields("Post-processing webhook rejected notification", map[string]interface{}{
+				"status_code": resp.StatusCode,
+				"route":       event.Route,
+				"kind":        event.Kind,
+			})
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestPostProcessing tests that sampled responses sent to clients are checked in the
+// background and their findings reported
+func TestPostProcessing(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"email":"jane@example.com"}`))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "users", URL: backend.URL, PathPrefix: "/users", Primary: true},
+		},
+		PostProcessing: config.PostProcessingConfig{Workers: 1, QueueSize: 10, Processors: []config.PostProcessor{
+			{Route: "/users", Type: "pii", SampleRate: 1},
+			{Route: "/users", Type: "schema", SampleRate: 1},
+		}},
+	}
+	conductor := NewConductor(cfg)
+	var mu sync.Mutex
+	var events []postProcessEvent
+	conductor.postProcessing.onFinding = func(event postProcessEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/users/1", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", recorder.Code)
+		}
+	}
+	conductor.Close()
+
+	if len(events) != 2 {
+		t.Fatalf("Expected a PII finding for each response, got %v", events)
+	}
+	for _, event := range events {
+		if event.Processor != "pii" || event.Kind != "email" || event.Path != "$.email" || event.Service != "users" || event.Route != "/users" {
+			t.Errorf("Unexpected finding %+v", event)
+		}
+	}
+
+	cfg.PostProcessing.Processors[0].Route = "/missing"
+	if _, err := newPostProcessPipeline(cfg.PostProcessing, conductor.services, nil, nil); err == nil {
+		t.Error("Expected an error for a post-processor of an unknown route")
+	}
+}
+
+// TestPostProcessSubmit tests that jobs dropped for a full queue and for a closed
+// pipeline are told apart
+func TestPostProcessSubmit(t *testing.T) {
+	pipeline, err := newPostProcessPipeline(config.PostProcessingConfig{QueueSize: 1}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create pipeline: %v", err)
+	}
+
+	// Without workers, the second job finds the queue full
+	if err := pipeline.Submit(postProcessJob{}); err != nil {
+		t.Fatalf("Expected the first job to be queued, got %v", err)
+	}
+	if err := pipeline.Submit(postProcessJob{}); !errors.Is(err, errPostProcessQueueFull) {
+		t.Errorf("Expected a full queue, got %v", err)
+	}
+	pipeline.Close()
+	if err := pipeline.Submit(postProcessJob{}); !errors.Is(err, errPostProcessClosed) {
+		t.Errorf("Expected a closed pipeline, got %v", err)
+	}
+}
@@ -7,20 +7,45 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/zeek-r/go-conductor/internal/logger"
 )
 
 var (
 	// Default namespace for all metrics
 	namespace = "go_conductor"
+
+	// Service and route label values used for requests the conductor answers itself
+	internalServiceLabels = []string{"none", "conductor", "all"}
 )
 
 // PrometheusMetrics holds all the Prometheus metrics for the conductor
 type PrometheusMetrics struct {
-	requestsTotal      *prometheus.CounterVec
-	requestDuration    *prometheus.HistogramVec
-	errorsTotal        *prometheus.CounterVec
-	inFlightRequests   prometheus.Gauge
-	serviceHealthGauge *prometheus.GaugeVec
+	requestsTotal       *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	errorsTotal         *prometheus.CounterVec
+	inFlightRequests    prometheus.Gauge
+	serviceHealthGauge  *prometheus.GaugeVec
+	dnsFailuresTotal    *prometheus.CounterVec
+	comparisonsTotal    *prometheus.CounterVec
+	budgetViolations    *prometheus.CounterVec
+	compressionRatio    *prometheus.HistogramVec
+	cacheLookups        *prometheus.CounterVec
+	openConnections     *prometheus.GaugeVec
+	connectionsTotal    *prometheus.CounterVec
+	connectionPhases    *prometheus.HistogramVec
+	connectionAges      *prometheus.HistogramVec
+	connectionsRecycled *prometheus.CounterVec
+	retries             *prometheus.CounterVec
+	postProcessed       *prometheus.CounterVec
+	postProcessFindings *prometheus.CounterVec
+	faultsInjected      *prometheus.CounterVec
+	mirrorsDropped      *prometheus.CounterVec
+	assertionFailures   *prometheus.CounterVec
+	shadowMismatches    *prometheus.CounterVec
+	registry            prometheus.Registerer // Registry for collectors added after creation
+	serviceLabels       *labelGuard           // Bounds the service label
+	routeLabels         *labelGuard           // Bounds the route label
+	hostLabels          *labelGuard           // Bounds the host label
 }
 
 // NewPrometheusMetrics creates a new set of Prometheus metrics
@@ -35,13 +60,17 @@ func NewPrometheusMetrics(registry ...prometheus.Registerer) *PrometheusMetrics
 	factory := promauto.With(reg)
 
 	return &PrometheusMetrics{
+		registry:      reg,
+		serviceLabels: newLabelGuard(defaultMaxLabelValues, internalServiceLabels...),
+		routeLabels:   newLabelGuard(defaultMaxLabelValues, internalServiceLabels...),
+		hostLabels:    newLabelGuard(defaultMaxLabelValues),
 		requestsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "requests_total",
 				Help:      "Total number of requests processed by the conductor",
 			},
-			[]string{"service", "method", "status"},
+			[]string{"service", "route", "method", "status"},
 		),
 		requestDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
@@ -50,7 +79,7 @@ func NewPrometheusMetrics(registry ...prometheus.Registerer) *PrometheusMetrics
 				Help:      "Duration of requests to backend services in seconds",
 				Buckets:   prometheus.DefBuckets,
 			},
-			[]string{"service", "method"},
+			[]string{"service", "route", "method"},
 		),
 		errorsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
@@ -58,7 +87,7 @@ func NewPrometheusMetrics(registry ...prometheus.Registerer) *PrometheusMetrics
 				Name:      "errors_total",
 				Help:      "Total number of errors encountered during requests",
 			},
-			[]string{"service", "error_type"},
+			[]string{"service", "route", "error_type"},
 		),
 		inFlightRequests: factory.NewGauge(
 			prometheus.GaugeOpts{
@@ -75,18 +104,165 @@ func NewPrometheusMetrics(registry ...prometheus.Registerer) *PrometheusMetrics
 			},
 			[]string{"service"},
 		),
+		dnsFailuresTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "dns_resolution_failures_total",
+				Help:      "Total number of failed backend hostname resolutions",
+			},
+			[]string{"host"},
+		),
+		comparisonsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "shadow_comparisons_total",
+				Help:      "Total number of shadow responses compared against the primary response, by outcome",
+			},
+			[]string{"service", "route", "result"},
+		),
+		budgetViolations: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "budget_violations_total",
+				Help:      "Total number of requests exceeding a route's size or latency budget",
+			},
+			[]string{"service", "route", "budget"},
+		),
+		compressionRatio: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "compression_ratio",
+				Help:      "Compressed size as a fraction of the uncompressed size of gzip responses, by direction",
+				Buckets:   prometheus.LinearBuckets(0.1, 0.1, 10),
+			},
+			[]string{"service", "direction"},
+		),
+		cacheLookups: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "cache_lookups_total",
+				Help:      "Total number of response cache lookups, by result",
+			},
+			[]string{"route", "result"},
+		),
+		openConnections: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "backend_open_connections",
+				Help:      "Number of open connections to backend services, by the service they were dialed for",
+			},
+			[]string{"service"},
+		),
+		connectionsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "backend_connections_total",
+				Help:      "Total number of connections used for backend requests, by whether they were reused or newly dialed",
+			},
+			[]string{"service", "state"},
+		),
+		connectionPhases: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "backend_connection_phase_duration_seconds",
+				Help:      "Duration of DNS resolution, TCP connect and TLS handshake when dialing backend services",
+				Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+			},
+			[]string{"service", "phase"},
+		),
+		connectionAges: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "backend_connection_age_seconds",
+				Help:      "Age of backend connections when they are closed",
+				Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+			},
+			[]string{"service"},
+		),
+		connectionsRecycled: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "backend_connections_recycled_total",
+				Help:      "Total number of keep-alive backend connections closed for reaching their request or age limit",
+			},
+			[]string{"service", "reason"},
+		),
+		retries: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "backend_retries_total",
+				Help:      "Total number of backend requests retried, by the failure or status code retried",
+			},
+			[]string{"service", "reason"},
+		),
+		postProcessed: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "post_process_total",
+				Help:      "Total number of sampled responses checked by post-processors, by outcome",
+			},
+			[]string{"route", "processor", "outcome"},
+		),
+		postProcessFindings: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "post_process_findings_total",
+				Help:      "Total number of findings reported by post-processors, by kind",
+			},
+			[]string{"route", "processor", "kind"},
+		),
+		faultsInjected: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "faults_injected_total",
+				Help:      "Total number of artificial faults injected into backend requests, by service and fault",
+			},
+			[]string{"service", "fault"},
+		),
+		mirrorsDropped: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "mirror_requests_dropped_total",
+				Help:      "Total number of shadow requests dropped before being sent, by service and reason",
+			},
+			[]string{"service", "reason"},
+		),
+		assertionFailures: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "response_assertion_failures_total",
+				Help:      "Total number of selected responses failing a route assertion, by route and assertion",
+			},
+			[]string{"route", "assertion"},
+		),
+		shadowMismatches: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "shadow_mismatches_total",
+				Help:      "Total number of shadow responses differing from the primary response, by the part that differs",
+			},
+			[]string{"service", "route", "difference"},
+		),
 	}
 }
 
-// RecordRequest records metrics for a completed request
-func (p *PrometheusMetrics) RecordRequest(serviceName string, method string, status string, duration time.Duration) {
-	p.requestsTotal.WithLabelValues(serviceName, method, status).Inc()
-	p.requestDuration.WithLabelValues(serviceName, method).Observe(duration.Seconds())
+// RecordRequest records metrics for a completed request. A non-empty trace ID is attached
+// to the latency observation as an exemplar.
+func (p *PrometheusMetrics) RecordRequest(serviceName string, route string, method string, status string, duration time.Duration, traceID string) {
+	serviceName, route, method = p.serviceLabels.Value(serviceName), p.routeLabels.Value(route), methodLabel(method)
+	p.requestsTotal.WithLabelValues(serviceName, route, method, statusLabel(status)).Inc()
+
+	observer := p.requestDuration.WithLabelValues(serviceName, route, method)
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && traceID != "" {
+		exemplarObserver.ObserveWithExemplar(duration.Seconds(), prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	observer.Observe(duration.Seconds())
 }
 
 // RecordError records an error encountered during a request
-func (p *PrometheusMetrics) RecordError(serviceName string, errorType string) {
-	p.errorsTotal.WithLabelValues(serviceName, errorType).Inc()
+func (p *PrometheusMetrics) RecordError(serviceName string, route string, errorType string) {
+	p.errorsTotal.WithLabelValues(p.serviceLabels.Value(serviceName), p.routeLabels.Value(route), errorType).Inc()
 }
 
 // RequestStarted increments the gauge for in-flight requests
@@ -105,12 +281,153 @@ func (p *PrometheusMetrics) SetServiceHealth(serviceName string, healthy bool) {
 	if healthy {
 		value = 1.0
 	}
-	p.serviceHealthGauge.WithLabelValues(serviceName).Set(value)
+	p.serviceHealthGauge.WithLabelValues(p.serviceLabels.Value(serviceName)).Set(value)
+}
+
+// RecordDNSFailure records a failed backend hostname resolution
+func (p *PrometheusMetrics) RecordDNSFailure(host string) {
+	p.dnsFailuresTotal.WithLabelValues(p.hostLabels.Value(host)).Inc()
+}
+
+// RegisterSLOTracker exposes rolling route latency percentiles and SLO burn rates
+func (p *PrometheusMetrics) RegisterSLOTracker(tracker *sloTracker) {
+	if err := p.registry.Register(newSLOCollector(tracker)); err != nil {
+		logger.Error("Failed to register SLO metrics", err)
+	}
+}
+
+// limitLabels bounds label values to the configured services and routes, collapsing
+// anything beyond limit other values into "other"
+func (p *PrometheusMetrics) limitLabels(limit int, services []*Service) {
+	p.serviceLabels = newLabelGuard(limit, internalServiceLabels...)
+	p.routeLabels = newLabelGuard(limit, internalServiceLabels...)
+	p.hostLabels = newLabelGuard(limit)
+	p.allowServices(services)
+}
+
+// allowServices marks the names, routes and hosts of configured services as known label
+// values, so they are never collapsed into "other"
+func (p *PrometheusMetrics) allowServices(services []*Service) {
+	for _, svc := range services {
+		if svc == nil {
+			continue
+		}
+		p.serviceLabels.Allow(svc.Name)
+		p.routeLabels.Allow(svc.Route)
+		p.hostLabels.Allow(svc.URL.Hostname())
+	}
+}
+
+// RecordComparison records the outcome of comparing a shadow response with the primary
+func (p *PrometheusMetrics) RecordComparison(serviceName string, route string, result string) {
+	p.comparisonsTotal.WithLabelValues(p.serviceLabels.Value(serviceName), p.routeLabels.Value(route), result).Inc()
+}
+
+// RecordBudgetViolation records a request exceeding one of its route's budgets
+func (p *PrometheusMetrics) RecordBudgetViolation(serviceName string, route string, budget string) {
+	p.budgetViolations.WithLabelValues(p.serviceLabels.Value(serviceName), p.routeLabels.Value(route), budget).Inc()
+}
+
+// RecordCompression records the compression ratio of a response body
+func (p *PrometheusMetrics) RecordCompression(serviceName string, direction string, compressed int, uncompressed int) {
+	if uncompressed == 0 {
+		return
+	}
+	ratio := float64(compressed) / float64(uncompressed)
+	p.compressionRatio.WithLabelValues(p.serviceLabels.Value(serviceName), direction).Observe(ratio)
+}
+
+// RecordCacheLookup records the result of looking up a request in the response cache
+func (p *PrometheusMetrics) RecordCacheLookup(route string, result string) {
+	p.cacheLookups.WithLabelValues(p.routeLabels.Value(route), result).Inc()
+}
+
+// ConnectionOpened records a new connection to a backend service
+func (p *PrometheusMetrics) ConnectionOpened(serviceName string) {
+	p.openConnections.WithLabelValues(p.serviceLabels.Value(serviceName)).Inc()
+}
+
+// ConnectionClosed records a backend connection being closed and how long it was open
+func (p *PrometheusMetrics) ConnectionClosed(serviceName string, age time.Duration) {
+	service := p.serviceLabels.Value(serviceName)
+	p.openConnections.WithLabelValues(service).Dec()
+	p.connectionAges.WithLabelValues(service).Observe(age.Seconds())
+}
+
+// RecordConnectionRecycled records a keep-alive connection closed for reaching a limit
+func (p *PrometheusMetrics) RecordConnectionRecycled(serviceName string, reason string) {
+	p.connectionsRecycled.WithLabelValues(p.serviceLabels.Value(serviceName), reason).Inc()
+}
+
+// RecordConnection records whether a backend request reused a connection or dialed a new one
+func (p *PrometheusMetrics) RecordConnection(serviceName string, reused bool) {
+	state := "new"
+	if reused {
+		state = "reused"
+	}
+	p.connectionsTotal.WithLabelValues(p.serviceLabels.Value(serviceName), state).Inc()
+}
+
+// RecordConnectionPhase records how long a phase of dialing a backend service took
+func (p *PrometheusMetrics) RecordConnectionPhase(serviceName string, phase string, duration time.Duration) {
+	p.connectionPhases.WithLabelValues(p.serviceLabels.Value(serviceName), phase).Observe(duration.Seconds())
+}
+
+// RecordRetry records a backend request retried after a failure or status code
+func (p *PrometheusMetrics) RecordRetry(serviceName string, reason string) {
+	p.retries.WithLabelValues(p.serviceLabels.Value(serviceName), reason).Inc()
+}
+
+// RecordPostProcess records the outcome of a post-processor checking a sampled response
+func (p *PrometheusMetrics) RecordPostProcess(route string, processor string, outcome string) {
+	p.postProcessed.WithLabelValues(p.routeLabels.Value(route), processor, outcome).Inc()
+}
+
+// RecordPostProcessFinding records a finding reported by a post-processor
+func (p *PrometheusMetrics) RecordPostProcessFinding(route string, processor string, kind string) {
+	p.postProcessFindings.WithLabelValues(p.routeLabels.Value(route), processor, kind).Inc()
+}
+
+// RecordFaultInjection records an artificial fault injected into a backend request
+func (p *PrometheusMetrics) RecordFaultInjection(serviceName string, fault string) {
+	p.faultsInjected.WithLabelValues(p.serviceLabels.Value(serviceName), fault).Inc()
+}
+
+// Reasons shadow requests are dropped before being sent
+const (
+	dropReasonShaping   = "shaping"    // Over the service's mirror traffic shaping rate
+	dropReasonQueueFull = "queue_full" // The deferred mirror queue was full
+	dropReasonNoTurn    = "no_turn"    // Still waiting for a fan-out turn when the request ended
+)
+
+// RecordMirrorDropped records a shadow request dropped before being sent
+func (p *PrometheusMetrics) RecordMirrorDropped(serviceName string, reason string) {
+	p.mirrorsDropped.WithLabelValues(p.serviceLabels.Value(serviceName), reason).Inc()
+}
+
+// RecordAssertionFailure records a selected response failing a route assertion
+func (p *PrometheusMetrics) RecordAssertionFailure(route string, assertion string) {
+	p.assertionFailures.WithLabelValues(p.routeLabels.Value(route), assertion).Inc()
+}
+
+// RecordMismatch records a part of a shadow response differing from the primary response
+func (p *PrometheusMetrics) RecordMismatch(serviceName string, route string, difference string) {
+	p.shadowMismatches.WithLabelValues(p.serviceLabels.Value(serviceName), p.routeLabels.Value(route), difference).Inc()
 }
 
 // WithPrometheusMetrics adds Prometheus metrics collection capability to a conductor
 func WithPrometheusMetrics(c *Conductor, registry ...prometheus.Registerer) *Conductor {
 	c.prometheusMetrics = NewPrometheusMetrics(registry...)
+
+	limit := defaultMaxLabelValues
+	if c.config != nil && c.config.Metrics.MaxLabelValues > 0 {
+		limit = c.config.Metrics.MaxLabelValues
+	}
+	services := c.currentServices()
+	for _, remote := range c.currentFailover() {
+		services = append(services[:len(services):len(services)], remote...)
+	}
+	c.prometheusMetrics.limitLabels(limit, services)
 	return c
 }
 
@@ -121,6 +438,9 @@ func RegisterPrometheusEndpoint(mux *http.ServeMux, c *Conductor, endpoint strin
 		endpoint = "/metrics"
 	}
 
-	// Register the Prometheus handler
-	mux.Handle(endpoint, promhttp.Handler())
+	// Register the Prometheus handler, negotiating OpenMetrics so exemplars are exposed
+	mux.Handle(endpoint, promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	))
 }
@@ -18,11 +18,11 @@ func TestPrometheusMetrics(t *testing.T) {
 	metrics := NewPrometheusMetrics(registry)
 
 	// Test recording a request
-	metrics.RecordRequest("test-service", "GET", "200", 100*time.Millisecond)
-	metrics.RecordRequest("test-service", "POST", "201", 200*time.Millisecond)
+	metrics.RecordRequest("test-service", "test-route", "GET", "200", 100*time.Millisecond, "")
+	metrics.RecordRequest("test-service", "test-route", "POST", "201", 200*time.Millisecond, "")
 
 	// Test recording an error
-	metrics.RecordError("test-service", "timeout")
+	metrics.RecordError("test-service", "test-route", "timeout")
 
 	// Test in-flight requests
 	metrics.RequestStarted()
@@ -32,6 +32,9 @@ func TestPrometheusMetrics(t *testing.T) {
 	// Test service health
 	metrics.SetServiceHealth("test-service", true)
 	metrics.SetServiceHealth("down-service", false)
+
+	// Test DNS failures
+	metrics.RecordDNSFailure("backend.example.com")
 }
 
 func TestPrometheusEndpoint(t *testing.T) {
@@ -75,8 +78,8 @@ func TestPrometheusEndpoint(t *testing.T) {
 
 	// Record some test metrics
 	if conductor.prometheusMetrics != nil {
-		conductor.prometheusMetrics.RecordRequest("test-service", "GET", "200", 100*time.Millisecond)
-		conductor.prometheusMetrics.RecordError("test-service", "test_error")
+		conductor.prometheusMetrics.RecordRequest("test-service", "test-route", "GET", "200", 100*time.Millisecond, "")
+		conductor.prometheusMetrics.RecordError("test-service", "test-route", "test_error")
 	}
 
 	// Serve the request
@@ -95,6 +98,7 @@ func TestPrometheusEndpoint(t *testing.T) {
 		"go_conductor_requests_total",
 		"go_conductor_errors_total",
 		"go_conductor_request_duration_seconds",
+		`route="test-route"`,
 	}
 
 	for _, metric := range expectedMetrics {
@@ -103,3 +107,41 @@ func TestPrometheusEndpoint(t *testing.T) {
 		}
 	}
 }
+
+// TestPrometheusExemplars tests that trace IDs from traceparent are attached to latency observations
+func TestPrometheusExemplars(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api", nil)
+	req.Header.Set("traceparent", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")
+	traceID := traceIDFromRequest(req)
+	if traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("Expected trace ID from traceparent, got %q", traceID)
+	}
+
+	req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	if id := traceIDFromRequest(req); id != "" {
+		t.Errorf("Expected no trace ID for an invalid traceparent, got %q", id)
+	}
+
+	registry := prometheus.NewRegistry()
+	metrics := NewPrometheusMetrics(registry)
+	metrics.RecordRequest("test-service", "test-route", "GET", "200", 100*time.Millisecond, traceID)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "go_conductor_request_duration_seconds" {
+			continue
+		}
+		for _, bucket := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			if exemplar := bucket.GetExemplar(); exemplar != nil {
+				if label := exemplar.GetLabel()[0]; label.GetName() != "trace_id" || label.GetValue() != traceID {
+					t.Errorf("Expected trace_id exemplar %s, got %s=%s", traceID, label.GetName(), label.GetValue())
+				}
+				return
+			}
+		}
+	}
+	t.Error("Expected an exemplar on the request duration histogram")
+}
@@ -0,0 +1,393 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Quota modes
+const (
+	quotaModeTrack   = "track"   // Account usage only
+	quotaModeEnforce = "enforce" // Reject requests from tenants over quota
+)
+
+// maxTrackedTenants bounds how many unconfigured tenants are accounted separately before
+// the rest are collapsed into "other", since tenant IDs come from clients
+const maxTrackedTenants = 10000
+
+// tenantUsage holds a tenant's usage in the current day and month
+type tenantUsage struct {
+	day             string
+	month           string
+	dailyRequests   int64
+	monthlyRequests int64
+	dailyBytes      int64
+	monthlyBytes    int64
+}
+
+// roll resets the counters of periods that have ended
+func (u *tenantUsage) roll(now time.Time) {
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	if u.day != day {
+		u.day, u.dailyRequests, u.dailyBytes = day, 0, 0
+	}
+	if u.month != month {
+		u.month, u.monthlyRequests, u.monthlyBytes = month, 0, 0
+	}
+}
+
+// quotaTracker accounts requests and bytes per tenant against daily and monthly quotas.
+// Periods are UTC calendar days and months, and usage is kept in memory only.
+type quotaTracker struct {
+	mu       sync.Mutex
+	config   config.QuotaConfig
+	identity *clientIdentity               // Identifies tenants from verified credentials, nil to use the header
+	limits   map[string]config.TenantQuota // By tenant
+	usage    map[string]*tenantUsage
+	tenants  *labelGuard
+	now      func() time.Time
+}
+
+// newQuotaTracker creates a tracker for the configured tenants
+func newQuotaTracker(cfg config.QuotaConfig, auth config.AuthConfig) (*quotaTracker, error) {
+	q := &quotaTracker{
+		config:  cfg,
+		limits:  make(map[string]config.TenantQuota),
+		usage:   make(map[string]*tenantUsage),
+		tenants: newLabelGuard(maxTrackedTenants, cfg.DefaultTenant),
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+	if cfg.Identity != nil {
+		identity, err := newClientIdentity(*cfg.Identity, auth)
+		if err != nil {
+			return nil, err
+		}
+		q.identity = identity
+	}
+	for _, quota := range cfg.Tenants {
+		q.limits[quota.Tenant] = quota
+		q.tenants.Allow(quota.Tenant)
+	}
+	return q, nil
+}
+
+// Tenant returns the tenant a request is accounted to: the identity of its verified
+// credentials if tenants are identified so, otherwise the tenant header
+func (q *quotaTracker) Tenant(r *http.Request) string {
+	var tenant string
+	if q.identity != nil {
+		tenant, _ = q.identity.Identify(r)
+	} else {
+		tenant = r.Header.Get(q.config.Header)
+	}
+	if tenant == "" {
+		return q.config.DefaultTenant
+	}
+	return q.tenants.Value(tenant)
+}
+
+// usageFor returns the tenant's current usage. Callers must hold q.mu.
+func (q *quotaTracker) usageFor(tenant string) *tenantUsage {
+	usage, ok := q.usage[tenant]
+	if !ok {
+		usage = &tenantUsage{}
+		q.usage[tenant] = usage
+	}
+	usage.roll(q.now())
+	return usage
+}
+
+// exceeded reports whether usage has reached any non-zero limit
+func exceeded(limit config.TenantQuota, usage *tenantUsage) bool {
+	over := func(used int64, max int64) bool { return max > 0 && used >= max }
+	return over(usage.dailyRequests, limit.DailyRequests) ||
+		over(usage.monthlyRequests, limit.MonthlyRequests) ||
+		over(usage.dailyBytes, limit.DailyBytes) ||
+		over(usage.monthlyBytes, limit.MonthlyBytes)
+}
+
+// Reserve counts a request against the tenant's usage before it is proxied and reports
+// whether the tenant had already used up any of its quotas. When quotas are enforced,
+// requests of tenants over quota are rejected, so they are not counted. Checking and
+// counting under one lock keeps concurrent requests from all being admitted on the last
+// request a quota has left.
+func (q *quotaTracker) Reserve(tenant string) (over bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage := q.usageFor(tenant)
+	if limit, ok := q.limits[tenant]; ok && exceeded(limit, usage) {
+		if q.config.Mode == quotaModeEnforce {
+			return true
+		}
+		over = true
+	}
+	usage.dailyRequests++
+	usage.monthlyRequests++
+	return over
+}
+
+// Record adds the request and response bytes of a reserved request to the tenant's usage
+// once it completed
+func (q *quotaTracker) Record(tenant string, bytes int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage := q.usageFor(tenant)
+	usage.dailyBytes += bytes
+	usage.monthlyBytes += bytes
+}
+
+// requestAllowance is what is left of a tenant's request quota
+type requestAllowance struct {
+	limit     int64
+	remaining int64
+	reset     time.Time // End of the quota's period
+}
+
+// Allowance returns the tenant's request quota with the fewest requests left, or false if
+// the tenant has no request quota
+func (q *quotaTracker) Allowance(tenant string) (requestAllowance, bool) {
+	limit, ok := q.limits[tenant]
+	if !ok {
+		return requestAllowance{}, false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	usage, now := q.usageFor(tenant), q.now()
+
+	var allowance requestAllowance
+	found := false
+	for _, quota := range []requestAllowance{
+		{limit: limit.DailyRequests, remaining: limit.DailyRequests - usage.dailyRequests, reset: nextDay(now)},
+		{limit: limit.MonthlyRequests, remaining: limit.MonthlyRequests - usage.monthlyRequests, reset: nextMonth(now)},
+	} {
+		if quota.limit <= 0 {
+			continue
+		}
+		quota.remaining = max(quota.remaining, 0)
+		if !found || quota.remaining < allowance.remaining {
+			allowance, found = quota, true
+		}
+	}
+	return allowance, found
+}
+
+// Reset returns when every quota the tenant has used up starts over
+func (q *quotaTracker) Reset(tenant string) time.Time {
+	limit := q.limits[tenant]
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	usage, now := q.usageFor(tenant), q.now()
+
+	over := func(used int64, max int64) bool { return max > 0 && used >= max }
+	if over(usage.monthlyRequests, limit.MonthlyRequests) || over(usage.monthlyBytes, limit.MonthlyBytes) {
+		return nextMonth(now)
+	}
+	return nextDay(now)
+}
+
+// nextDay returns the start of the UTC day after t
+func nextDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// nextMonth returns the start of the UTC month after t
+func nextMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// tenantReport is a tenant's usage and quotas in the quota report
+type tenantReport struct {
+	Tenant          string              `json:"tenant"`
+	Day             string              `json:"day"`
+	Month           string              `json:"month"`
+	DailyRequests   int64               `json:"daily_requests"`
+	MonthlyRequests int64               `json:"monthly_requests"`
+	DailyBytes      int64               `json:"daily_bytes"`
+	MonthlyBytes    int64               `json:"monthly_bytes"`
+	Quota           *config.TenantQuota `json:"quota,omitempty"`
+	Exceeded        bool                `json:"exceeded"`
+}
+
+// quotaReport is the response body of the quota admin endpoint
+type quotaReport struct {
+	Mode    string         `json:"mode"`
+	Tenants []tenantReport `json:"tenants"`
+}
+
+// Snapshot returns every tenant's usage in the current periods, sorted by tenant
+func (q *quotaTracker) Snapshot() quotaReport {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	report := quotaReport{Mode: q.config.Mode, Tenants: []tenantReport{}}
+	for tenant := range q.usage {
+		usage := q.usageFor(tenant)
+		entry := tenantReport{
+			Tenant:          tenant,
+			Day:             usage.day,
+			Month:           usage.month,
+			DailyRequests:   usage.dailyRequests,
+			MonthlyRequests: usage.monthlyRequests,
+			DailyBytes:      usage.dailyBytes,
+			MonthlyBytes:    usage.monthlyBytes,
+		}
+		if limit, ok := q.limits[tenant]; ok {
+			entry.Quota = &limit
+			entry.Exceeded = exceeded(limit, usage)
+		}
+		report.Tenants = append(report.Tenants, entry)
+	}
+
+	sort.Slice(report.Tenants, func(i, j int) bool { return report.Tenants[i].Tenant < report.Tenants[j].Tenant })
+	return report
+}
+
+// countingReadCloser counts the bytes read from a request body
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read implements io.Reader
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingResponseWriter counts the bytes written to a response body
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+// Write implements io.Writer
+func (c *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (c *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// accountQuota reserves the request against its tenant's quotas and starts counting its
+// bytes. It returns the writer to use and a function recording the bytes once the request
+// is done, or a nil function if the request was rejected.
+func (c *Conductor) accountQuota(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	if c.quotas == nil {
+		return w, func() {}
+	}
+
+	tenant := c.quotas.Tenant(r)
+	if c.quotas.Reserve(tenant) {
+		logger.WarnWithFields("Tenant quota exceeded", map[string]interface{}{
+			"tenant": tenant,
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"mode":   c.config.Quota.Mode,
+		})
+		if c.config.Quota.Mode == quotaModeEnforce {
+			c.setRateLimitHeaders(w, tenant, true)
+			return w, nil
+		}
+	}
+	c.setRateLimitHeaders(w, tenant, false)
+
+	var body *countingReadCloser
+	if r.Body != nil {
+		body = &countingReadCloser{ReadCloser: r.Body}
+		r.Body = body
+	}
+	counter := &countingResponseWriter{ResponseWriter: w}
+
+	return counter, func() {
+		bytes := counter.n
+		if body != nil {
+			bytes += body.n
+		}
+		c.quotas.Record(tenant, bytes)
+	}
+}
+
+// setRateLimitHeaders tells the client what is left of its tenant's request quota in the
+// RateLimit headers and their legacy X-RateLimit variants, if enabled while quotas are
+// enforced. Rejected requests are also told when to retry.
+func (c *Conductor) setRateLimitHeaders(w http.ResponseWriter, tenant string, rejected bool) {
+	if !c.config.Quota.RateLimitHeaders || c.config.Quota.Mode != quotaModeEnforce {
+		return
+	}
+
+	now := c.quotas.now()
+	allowance, ok := c.quotas.Allowance(tenant)
+	if rejected {
+		reset := c.quotas.Reset(tenant)
+		w.Header().Set("Retry-After", strconv.FormatInt(secondsUntil(now, reset), 10))
+		allowance.remaining, allowance.reset = 0, reset
+	}
+	if !ok {
+		return
+	}
+
+	limit := strconv.FormatInt(allowance.limit, 10)
+	remaining := strconv.FormatInt(allowance.remaining, 10)
+	w.Header().Set("RateLimit-Limit", limit)
+	w.Header().Set("RateLimit-Remaining", remaining)
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(secondsUntil(now, allowance.reset), 10))
+	w.Header().Set("X-RateLimit-Limit", limit)
+	w.Header().Set("X-RateLimit-Remaining", remaining)
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(allowance.reset.Unix(), 10))
+}
+
+// secondsUntil returns the whole seconds from now until t, rounded up
+func secondsUntil(now time.Time, t time.Time) int64 {
+	return int64((t.Sub(now) + time.Second - 1) / time.Second)
+}
+
+// handleQuotaExceeded rejects a request from a tenant over quota
+func (c *Conductor) handleQuotaExceeded(w http.ResponseWriter, r *http.Request, requestStart time.Time, traceID string) {
+	writeError(w, r, http.StatusTooManyRequests, ErrCodeQuotaExceeded, "Tenant quota exceeded")
+
+	// Record rejected request in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", "none", "quota_exceeded")
+		c.prometheusMetrics.RecordRequest("conductor", "none", r.Method, "429", time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics("none", requestStart, true)
+	}
+}
+
+// QuotaReportHandler creates an admin handler reporting per-tenant usage and quotas
+func QuotaReportHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+		if c.quotas == nil {
+			http.Error(w, "Quota accounting not enabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.quotas.Snapshot()); err != nil {
+			http.Error(w, "Failed to encode quota report: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
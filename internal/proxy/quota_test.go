@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestQuotaTracker tests per-tenant accounting and the reset of daily and monthly usage
+func TestQuotaTracker(t *testing.T) {
+	tracker, err := newQuotaTracker(config.QuotaConfig{
+		Header:        "X-Tenant-ID",
+		DefaultTenant: "anonymous",
+		Mode:          "enforce",
+		Tenants:       []config.TenantQuota{{Tenant: "billing", DailyRequests: 2, MonthlyBytes: 100}},
+	}, config.AuthConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	now := time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if tracker.Reserve("billing") {
+			t.Fatalf("Expected billing to be within quota for request %d", i+1)
+		}
+		tracker.Record("billing", 10)
+	}
+	if !tracker.Reserve("billing") {
+		t.Fatalf("Expected billing to exceed its daily request quota")
+	}
+
+	// Tenants without quotas are tracked but never exceed
+	tracker.Record("search", 1000)
+	if tracker.Reserve("search") {
+		t.Errorf("Expected unconfigured tenant to be unlimited")
+	}
+
+	// A new day resets the daily requests, a new month resets the monthly bytes
+	now = now.Add(2 * time.Hour)
+	if tracker.Reserve("billing") {
+		t.Errorf("Expected daily quota to reset on a new day")
+	}
+	tracker.Record("billing", 100)
+	if !tracker.Reserve("billing") {
+		t.Errorf("Expected billing to exceed its monthly byte quota")
+	}
+
+	report := tracker.Snapshot()
+	if len(report.Tenants) != 2 || report.Tenants[0].Tenant != "billing" || report.Tenants[0].Month != "2024-02" ||
+		report.Tenants[0].MonthlyBytes != 100 || report.Tenants[0].DailyRequests != 1 || !report.Tenants[0].Exceeded {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+// TestQuotaReservation tests that concurrent requests cannot all be admitted on the last
+// request a quota has left
+func TestQuotaReservation(t *testing.T) {
+	tracker, err := newQuotaTracker(config.QuotaConfig{
+		Mode:    "enforce",
+		Tenants: []config.TenantQuota{{Tenant: "billing", DailyRequests: 5}},
+	}, config.AuthConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+
+	var admitted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !tracker.Reserve("billing") {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := admitted.Load(); got != 5 {
+		t.Errorf("Expected 5 requests admitted, got %d", got)
+	}
+}
+
+// TestQuotaTenantIdentity tests that tenants are taken from verified credentials, so a
+// client cannot spend another tenant's quota by naming it in a header
+func TestQuotaTenantIdentity(t *testing.T) {
+	secret := []byte("sso-secret")
+	tracker, err := newQuotaTracker(config.QuotaConfig{
+		Identity:      &config.IdentityConfig{Auth: "sso", Claim: "tenant"},
+		Header:        "X-Tenant-ID",
+		DefaultTenant: "anonymous",
+	}, config.AuthConfig{Methods: map[string]config.AuthMethodConfig{
+		"sso": {Type: "jwt", Secret: string(secret)},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		clientCN string
+		want     string
+	}{
+		{name: "verified claim", token: signJWT(t, "HS256", secret, map[string]interface{}{"tenant": "billing"}), want: "billing"},
+		{name: "forged claim", token: signJWT(t, "HS256", []byte("guess"), map[string]interface{}{"tenant": "billing"}), want: "anonymous"},
+		{name: "client certificate", clientCN: "reports", want: "reports"},
+		{name: "header only", want: "anonymous"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+			req.Header.Set("X-Tenant-ID", "search")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.clientCN != "" {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.clientCN}}
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
+			if got := tracker.Tenant(req); got != tt.want {
+				t.Errorf("Expected tenant %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestQuotaEnforcement tests rejecting tenants over quota and reporting usage
+func TestQuotaEnforcement(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+		Quota: config.QuotaConfig{
+			Enabled:       true,
+			Header:        "X-Tenant-ID",
+			DefaultTenant: "anonymous",
+			Mode:          "enforce",
+			Tenants:       []config.TenantQuota{{Tenant: "billing", DailyRequests: 1}},
+		},
+		Admin: config.AdminConfig{Enabled: true, Endpoint: "/admin", Token: "secret"},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: &recordingTransport{}}
+
+	post := func(tenant string) int {
+		req := httptest.NewRequest("POST", "http://example.com/api/users", strings.NewReader("hello"))
+		req.Header.Set("X-Tenant-ID", tenant)
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if code := post("billing"); code != http.StatusOK {
+		t.Fatalf("Expected first request to succeed, got %d", code)
+	}
+	if code := post("billing"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once over quota, got %d", code)
+	}
+	if code := post("search"); code != http.StatusOK {
+		t.Fatalf("Expected other tenants to be unaffected, got %d", code)
+	}
+
+	// Rejected requests are not accounted; bytes include the request and response bodies
+	mux := http.NewServeMux()
+	SetupAdminEndpoints(mux, conductor)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, adminRequest("GET", "/admin/quotas"))
+
+	var report quotaReport
+	if err := json.NewDecoder(recorder.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode quota report: %v", err)
+	}
+	if len(report.Tenants) != 2 || report.Tenants[0].DailyRequests != 1 || report.Tenants[0].DailyBytes != 7 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
+
+// TestRateLimitHeaders tests that clients are told what is left of their request quota
+func TestRateLimitHeaders(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+		},
+		Quota: config.QuotaConfig{
+			Enabled:          true,
+			Header:           "X-Tenant-ID",
+			DefaultTenant:    "anonymous",
+			Mode:             "enforce",
+			RateLimitHeaders: true,
+			Tenants: []config.TenantQuota{
+				{Tenant: "billing", DailyRequests: 10, MonthlyRequests: 2},
+				{Tenant: "reports", DailyBytes: 1},
+			},
+		},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: &recordingTransport{}}
+	now := time.Date(2024, 5, 31, 23, 0, 0, 0, time.UTC)
+	conductor.quotas.now = func() time.Time { return now }
+
+	get := func(tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	tests := []struct {
+		name          string
+		tenant        string
+		wantStatus    int
+		wantHeaders   map[string]string
+		wantNoHeaders []string
+	}{
+		{name: "monthly quota left", tenant: "billing", wantStatus: http.StatusOK, wantHeaders: map[string]string{
+			"RateLimit-Limit": "2", "RateLimit-Remaining": "1", "RateLimit-Reset": "3600",
+			"X-RateLimit-Limit": "2", "X-RateLimit-Remaining": "1", "X-RateLimit-Reset": "1717200000",
+		}},
+		{name: "last request", tenant: "billing", wantStatus: http.StatusOK, wantHeaders: map[string]string{
+			"RateLimit-Remaining": "0",
+		}},
+		{name: "rejected", tenant: "billing", wantStatus: http.StatusTooManyRequests, wantHeaders: map[string]string{
+			"RateLimit-Remaining": "0", "RateLimit-Reset": "3600", "Retry-After": "3600",
+		}},
+		{name: "byte quota only", tenant: "reports", wantStatus: http.StatusOK, wantNoHeaders: []string{"RateLimit-Limit", "Retry-After"}},
+		{name: "byte quota used up", tenant: "reports", wantStatus: http.StatusTooManyRequests, wantHeaders: map[string]string{
+			"Retry-After": "3600",
+		}, wantNoHeaders: []string{"RateLimit-Limit"}},
+		{name: "unlimited tenant", tenant: "search", wantStatus: http.StatusOK, wantNoHeaders: []string{"RateLimit-Limit"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := get(tt.tenant)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := recorder.Header().Get(name); got != want {
+					t.Errorf("Expected %s %q, got %q", name, want, got)
+				}
+			}
+			for _, name := range tt.wantNoHeaders {
+				if got := recorder.Header().Get(name); got != "" {
+					t.Errorf("Expected no %s, got %q", name, got)
+				}
+			}
+		})
+	}
+}
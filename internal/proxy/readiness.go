@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Which of a route's services a readiness term requires to be healthy
+const (
+	readyPrimary = "primary" // The route's primary service
+	readyAny     = "any"     // At least one of the route's services
+	readyAll     = "all"     // Every service of the route
+)
+
+// readinessTerm requires services of a route to be healthy
+type readinessTerm struct {
+	term     string
+	route    string
+	mode     string
+	services []*Service
+}
+
+// Eval implements boolExpr
+func (t *readinessTerm) Eval(*Conductor) bool {
+	healthy := 0
+	for _, svc := range t.services {
+		if !serviceHealthy(svc) {
+			continue
+		}
+		healthy++
+		if t.mode == readyPrimary && svc.Primary || t.mode == readyAny {
+			return true
+		}
+	}
+	return t.mode == readyAll && healthy == len(t.services)
+}
+
+// readiness decides whether the conductor is ready to receive traffic from the health of
+// the routes it depends on
+type readiness struct {
+	require string
+	expr    boolExpr[*Conductor]
+	terms   []*readinessTerm // In order of appearance in the expression
+}
+
+// newReadiness parses the readiness requirement over the configured routes. Terms name a
+// route, requiring its primary to be healthy, or prefix it with any: or all:. Without a
+// requirement every route's primary must be healthy; those terms are built directly, as
+// route names may contain operators or parentheses that would not parse.
+func newReadiness(cfg config.ReadinessConfig, services []*Service) (*readiness, error) {
+	byRoute := make(map[string][]*Service)
+	var routes []string
+	for _, svc := range services {
+		if _, ok := byRoute[svc.Route]; !ok {
+			routes = append(routes, svc.Route)
+		}
+		byRoute[svc.Route] = append(byRoute[svc.Route], svc)
+	}
+
+	if cfg.Require == "" {
+		r := &readiness{require: strings.Join(routes, " AND ")}
+		all := make(exprAll[*Conductor], 0, len(routes))
+		for _, route := range routes {
+			term := &readinessTerm{term: route, route: route, mode: readyPrimary, services: byRoute[route]}
+			r.terms = append(r.terms, term)
+			all = append(all, term)
+		}
+		r.expr = all
+		return r, nil
+	}
+
+	r := &readiness{require: cfg.Require}
+	expr, err := parseBoolExpr(cfg.Require, "readiness requirement", func(name string) (boolExpr[*Conductor], error) {
+		mode, route := readyPrimary, name
+		if prefix, rest, ok := strings.Cut(name, ":"); ok && (prefix == readyAny || prefix == readyAll) {
+			mode, route = prefix, rest
+		}
+		routeServices, ok := byRoute[route]
+		if !ok {
+			return nil, fmt.Errorf("unknown route %q in readiness requirement", route)
+		}
+		term := &readinessTerm{term: name, route: route, mode: mode, services: routeServices}
+		r.terms = append(r.terms, term)
+		return term, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.expr = expr
+	return r, nil
+}
+
+// serviceHealthy reports whether a service is healthy, counting untracked services as healthy
+func serviceHealthy(svc *Service) bool {
+	return svc.health == nil || svc.health.Healthy()
+}
+
+// ReadinessService is the health of one service in a readiness check
+type ReadinessService struct {
+	Name    string `json:"name"`
+	Primary bool   `json:"primary"`
+	Healthy bool   `json:"healthy"`
+}
+
+// ReadinessCheck is the outcome of one term of the readiness requirement
+type ReadinessCheck struct {
+	Term     string             `json:"term"`
+	Route    string             `json:"route"`
+	Mode     string             `json:"mode"`
+	Healthy  bool               `json:"healthy"`
+	Services []ReadinessService `json:"services"`
+}
+
+// ReadinessReport is the JSON document served by the readiness endpoint
+type ReadinessReport struct {
+	Ready   bool             `json:"ready"`
+	Require string           `json:"require"`
+	Checks  []ReadinessCheck `json:"checks"`
+}
+
+// Report evaluates the requirement and breaks it down by term
+func (r *readiness) Report(c *Conductor) ReadinessReport {
+	report := ReadinessReport{Ready: r.expr.Eval(c), Require: r.require}
+	for _, term := range r.terms {
+		check := ReadinessCheck{Term: term.term, Route: term.route, Mode: term.mode, Healthy: term.Eval(c)}
+		for _, svc := range term.services {
+			check.Services = append(check.Services, ReadinessService{
+				Name:    svc.Name,
+				Primary: svc.Primary,
+				Healthy: serviceHealthy(svc),
+			})
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	return report
+}
+
+// ReadinessHandler serves the readiness report, with 503 while the conductor is not ready
+func ReadinessHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		readiness := c.currentReadiness()
+		if readiness == nil {
+			http.Error(w, "Readiness endpoint not enabled", http.StatusNotFound)
+			return
+		}
+
+		report := readiness.Report(c)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.Error("Failed to encode readiness report", err)
+		}
+	}
+}
+
+// SetupReadinessEndpoint registers the readiness endpoint if it is enabled
+func SetupReadinessEndpoint(mux *http.ServeMux, c *Conductor) {
+	if c.readiness == nil {
+		return
+	}
+
+	endpoint := c.config.Readiness.Endpoint
+	logger.InfoWithFields("Enabling readiness endpoint", map[string]interface{}{
+		"endpoint": endpoint,
+		"require":  c.readiness.require,
+	})
+	mux.HandleFunc(endpoint, ReadinessHandler(c))
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestReadiness tests readiness requirements combining the health of several routes
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		require    string
+		unhealthy  []string
+		wantReady  bool
+		wantChecks map[string]bool
+	}{
+		{name: "default all primaries healthy", wantReady: true, wantChecks: map[string]bool{"/api": true, "/search": true}},
+		{name: "default with a primary down", unhealthy: []string{"search"}, wantReady: false, wantChecks: map[string]bool{"/api": true, "/search": false}},
+		{name: "default ignores mirrors", unhealthy: []string{"api-shadow"}, wantReady: true},
+		{name: "any service of a route", require: "/api AND any:/search", unhealthy: []string{"search"}, wantReady: true, wantChecks: map[string]bool{"/api": true, "any:/search": true}},
+		{name: "all services of a route", require: "all:/api", unhealthy: []string{"api-shadow"}, wantReady: false, wantChecks: map[string]bool{"all:/api": false}},
+		{name: "either route", require: "/api || /search", unhealthy: []string{"api"}, wantReady: true},
+		{name: "grouping", require: "/search AND (/api OR all:/api)", unhealthy: []string{"api"}, wantReady: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{
+					{Name: "api", URL: "http://api.example.com", PathPrefix: "/api", Primary: true},
+					{Name: "api-shadow", URL: "http://api-shadow.example.com", PathPrefix: "/api"},
+					{Name: "search", URL: "http://search.example.com", PathPrefix: "/search", Primary: true},
+					{Name: "search-shadow", URL: "http://search-shadow.example.com", PathPrefix: "/search"},
+				},
+				Health:    config.HealthConfig{FailureThreshold: 1, RetryAfter: 60},
+				Readiness: config.ReadinessConfig{Enabled: true, Endpoint: "/readyz", Require: tt.require},
+			}
+			conductor := NewConductor(cfg)
+			for _, svc := range conductor.services {
+				for _, name := range tt.unhealthy {
+					if svc.Name == name {
+						svc.health.Record(false)
+					}
+				}
+			}
+
+			recorder := httptest.NewRecorder()
+			ReadinessHandler(conductor)(recorder, httptest.NewRequest("GET", "/readyz", nil))
+
+			wantStatus := http.StatusOK
+			if !tt.wantReady {
+				wantStatus = http.StatusServiceUnavailable
+			}
+			if recorder.Code != wantStatus {
+				t.Errorf("Expected status %d, got %d", wantStatus, recorder.Code)
+			}
+
+			var report ReadinessReport
+			if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+				t.Fatalf("Failed to decode report: %v", err)
+			}
+			if report.Ready != tt.wantReady {
+				t.Errorf("Expected ready=%v, got %v", tt.wantReady, report.Ready)
+			}
+			for _, check := range report.Checks {
+				if want, ok := tt.wantChecks[check.Term]; ok && check.Healthy != want {
+					t.Errorf("Expected term %s healthy=%v, got %v", check.Term, want, check.Healthy)
+				}
+			}
+		})
+	}
+}
+
+// TestReadinessRequirementErrors tests rejecting requirements over unknown routes or with bad syntax
+func TestReadinessRequirementErrors(t *testing.T) {
+	services := []*Service{{Name: "api", Route: "/api", Primary: true}}
+	for _, require := range []string{"/missing", "any:/missing", "/api AND", "(/api", "/api OR OR /api"} {
+		if _, err := newReadiness(config.ReadinessConfig{Require: require}, services); err == nil {
+			t.Errorf("Expected an error for %q", require)
+		}
+	}
+
+	// The default requirement never parses route names, so any name is accepted
+	services = append(services, &Service{Name: "legacy", Route: "legacy (v1) AND OR", Primary: true})
+	r, err := newReadiness(config.ReadinessConfig{}, services)
+	if err != nil {
+		t.Fatalf("Expected the default requirement to accept any route name: %v", err)
+	}
+	if len(r.terms) != 2 || r.terms[1].route != "legacy (v1) AND OR" || !r.expr.Eval(nil) {
+		t.Errorf("Expected a term per route, got %+v", r.terms)
+	}
+}
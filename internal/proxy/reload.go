@@ -0,0 +1,410 @@
+package proxy
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Reload applies the services and failover clusters of a new configuration without a
+// restart. The routing table is built aside and swapped in at once, so requests already
+// routed finish on the services they were sent to and connections are not dropped.
+// Services whose configuration did not change are kept as they are, changed ones keep
+// their health state. Routes frozen through the admin endpoints keep their services and
+// failover clusters. Readiness, faults, authorizers, fan-out limits, mirror shaping and
+// post-processing are rebuilt for the new services from their startup settings. Other
+// settings are built into the conductor at startup and only take effect on restart. An
+// error leaves the current routing table in place. Removed services keep answering
+// requests no remaining service matches for the reload's grace period.
+func (c *Conductor) Reload(cfg *config.Config) error {
+	return c.reload(cfg, true, snapshotReload)
+}
+
+// reload applies a new configuration, keeping the frozen routes as they are unless the
+// configuration is a change made through the admin endpoints. The applied configuration
+// is kept as a snapshot from the given source.
+func (c *Conductor) reload(cfg *config.Config, keepFrozen bool, source string) error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	return c.reloadLocked(cfg, keepFrozen, source)
+}
+
+// reloadLocked applies a new configuration with reloadMu held, so callers deriving it
+// from the served configuration cannot overwrite a reload made in between
+func (c *Conductor) reloadLocked(cfg *config.Config, keepFrozen bool, source string) error {
+	if keepFrozen {
+		var frozen []string
+		if cfg, frozen = c.keepFrozenRoutes(cfg); len(frozen) > 0 {
+			if err := cfg.Validate(); err != nil {
+				return fmt.Errorf("configuration conflicts with frozen routes: %w", err)
+			}
+			logger.InfoWithFields("Keeping frozen routes as they are", map[string]interface{}{
+				"routes": frozen,
+			})
+		}
+	}
+
+	served := *c.config
+	served.Services, served.Failover = cfg.Services, cfg.Failover
+
+	current := c.currentServices()
+	previous := make(map[string]*Service, len(current))
+	for _, svc := range current {
+		previous[svc.Name] = svc
+	}
+
+	// Build the new table on a scratch conductor sharing the backend transport
+	next := &Conductor{
+		services:       make([]*Service, len(served.Services)),
+		transport:      c.transport,
+		dnsCache:       c.dnsCache,
+		timeout:        c.timeout,
+		routesByPrefix: make(map[string][]*Service),
+		routesByExact:  make(map[string][]*Service),
+		routesByPath:   make(map[string][]*Service),
+		failover:       make(map[string][]*Service),
+		config:         &served,
+	}
+	if err := next.initializeServices(served.Services, previous); err != nil {
+		return err
+	}
+	if err := next.initializeFailover(served.Failover); err != nil {
+		return err
+	}
+	features, err := c.rebuildFeatures(next)
+	if err != nil {
+		return err
+	}
+	added, changed, removed := diffServices(previous, next.services)
+	retired := c.retire(current, removed, next.services)
+
+	c.routesMu.Lock()
+	previousPipeline := c.postProcessing
+	c.services = next.services
+	c.routesByExact, c.routesByPrefix, c.routesByPath = next.routesByExact, next.routesByPrefix, next.routesByPath
+	c.routesByRegex = next.routesByRegex
+	if c.routeCache != nil {
+		c.routeCache.Purge()
+	}
+	c.failover = next.failover
+	c.served = &served
+	c.readiness, c.faults, c.authorizers = features.readiness, features.faults, features.authorizers
+	c.fanOut, c.mirrorShaper, c.postProcessing = features.fanOut, features.mirrorShaper, features.postProcessing
+	c.retired = retired
+	c.routesMu.Unlock()
+
+	// Finish the checks queued on the replaced pipeline
+	if previousPipeline != nil && previousPipeline != features.postProcessing {
+		previousPipeline.Close()
+	}
+
+	// Probe the new set of services, keeping the history of those that were kept
+	if c.healthChecker != nil {
+		c.healthChecker.Stop()
+	}
+	c.startHealthChecks()
+
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.allowServices(next.services)
+		for _, remote := range next.failover {
+			c.prometheusMetrics.allowServices(remote)
+		}
+	}
+
+	c.mirrorGuard.Forget(removed)
+	c.snapshots.Record(&served, source)
+	logger.InfoWithFields("Configuration reloaded", map[string]interface{}{
+		"services": len(next.services),
+		"added":    added,
+		"changed":  changed,
+		"removed":  removed,
+	})
+	if unapplied := unappliedSections(c.config, cfg); len(unapplied) > 0 {
+		logger.WarnWithFields("Configuration changes outside services and failover require a restart", map[string]interface{}{
+			"sections": unapplied,
+		})
+	}
+	return nil
+}
+
+// retiredRoutes routes requests to services removed by reloads while their grace period
+// lasts, so clients still arriving for a removed route are answered rather than refused
+type retiredRoutes struct {
+	table *Conductor             // Route tables of the retired services
+	until map[*Service]time.Time // End of each service's grace period
+}
+
+// retire returns the routing table of the services removed by a reload, together with
+// those removed earlier whose grace period has not ended and that were not routed again.
+// It returns nil without a grace period or retired services.
+func (c *Conductor) retire(current []*Service, removed []string, services []*Service) *retiredRoutes {
+	grace := time.Duration(c.config.Reload.GracePeriod) * time.Second
+	if grace <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	routed := make(map[string]bool, len(services))
+	for _, svc := range services {
+		routed[svc.Name] = true
+	}
+	var retired []*Service
+	until := make(map[*Service]time.Time)
+	c.routesMu.RLock()
+	if c.retired != nil {
+		for _, svc := range c.retired.table.services {
+			if end := c.retired.until[svc]; end.After(now) && !routed[svc.Name] {
+				retired = append(retired, svc)
+				until[svc] = end
+			}
+		}
+	}
+	c.routesMu.RUnlock()
+	for _, svc := range current {
+		if slices.Contains(removed, svc.Name) {
+			retired = append(retired, svc)
+			until[svc] = now.Add(grace)
+		}
+	}
+	if len(retired) == 0 {
+		return nil
+	}
+
+	// Rebuild the route tables from the retired services themselves, in the order they
+	// were configured, so requests reach the same services in-flight requests are using
+	configs := make([]config.Service, 0, len(retired))
+	kept := make(map[string]*Service, len(retired))
+	for _, svc := range retired {
+		configs = append(configs, svc.Config)
+		kept[svc.Name] = svc
+	}
+	table := &Conductor{
+		services:       make([]*Service, len(configs)),
+		routesByPrefix: make(map[string][]*Service),
+		routesByExact:  make(map[string][]*Service),
+		routesByPath:   make(map[string][]*Service),
+		config:         c.config,
+	}
+	if err := table.initializeServices(configs, kept); err != nil {
+		logger.Error("Failed to route retired services, removing them at once", err)
+		return nil
+	}
+	return &retiredRoutes{table: table, until: until}
+}
+
+// match returns the retired services matching a path whose grace period has not ended
+func (r *retiredRoutes) match(path string, listener string) []*Service {
+	if r == nil {
+		return nil
+	}
+	now := time.Now()
+	var matched []*Service
+	for _, svc := range r.table.matchServices(path, listener) {
+		if r.until[svc].After(now) {
+			matched = append(matched, svc)
+		}
+	}
+	return matched
+}
+
+// routedFeatures are the features bound to the names of the routed services and routes,
+// rebuilt with the routing table on reload. Features not configured are kept as they
+// are, such as authorizers installed with WithAuthorizer.
+type routedFeatures struct {
+	readiness      *readiness
+	faults         *faultInjector
+	authorizers    map[string]Authorizer
+	fanOut         map[string]config.RouteFanOut
+	mirrorShaper   *mirrorShaper
+	postProcessing *postProcessPipeline
+}
+
+// rebuildFeatures builds the features bound to a new routing table, refusing a table
+// they could not use as startup would have. State worth keeping is carried over for the
+// services and routes that remain: active faults, shaping buckets, authorizers and the
+// post-processors' learned baselines.
+func (c *Conductor) rebuildFeatures(next *Conductor) (*routedFeatures, error) {
+	for _, svc := range next.services {
+		if check := svc.Config.HealthCheck; check != nil && svc.health != nil {
+			if _, err := c.newProbe(svc, *check); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	c.routesMu.RLock()
+	f := &routedFeatures{
+		readiness:      c.readiness,
+		faults:         c.faults,
+		authorizers:    c.authorizers,
+		fanOut:         c.fanOut,
+		mirrorShaper:   c.mirrorShaper,
+		postProcessing: c.postProcessing,
+	}
+	c.routesMu.RUnlock()
+
+	if len(c.config.MirrorShaping) > 0 {
+		shaper, err := newMirrorShaper(c.config.MirrorShaping, next.services)
+		if err != nil {
+			return nil, err
+		}
+		f.mirrorShaper = shaper.carry(f.mirrorShaper)
+	}
+	if len(c.config.FanOut) > 0 {
+		fanOut, err := newFanOutLimits(c.config.FanOut, next.services)
+		if err != nil {
+			return nil, err
+		}
+		f.fanOut = fanOut
+	}
+	if len(c.config.Authz) > 0 {
+		authorizers, err := newRouteAuthorizers(c.config.Authz, c.config.Auth, next.services)
+		if err != nil {
+			return nil, err
+		}
+		f.authorizers = carryAuthorizers(authorizers, f.authorizers, next.services)
+	}
+	if len(c.config.Faults.Rules) > 0 {
+		faults, err := newFaultInjector(c.config.Faults, next.services)
+		if err != nil {
+			return nil, err
+		}
+		f.faults = faults.carry(f.faults)
+	}
+	if c.config.Readiness.Enabled {
+		readiness, err := newReadiness(c.config.Readiness, next.services)
+		if err != nil {
+			return nil, err
+		}
+		f.readiness = readiness
+	}
+
+	// Built last, as its workers start with it
+	if len(c.config.PostProcessing.Processors) > 0 {
+		pipeline, err := newPostProcessPipeline(c.config.PostProcessing, next.services,
+			c.recordPostProcess, postProcessNotifier(c.config.PostProcessing.Webhook))
+		if err != nil {
+			return nil, err
+		}
+		f.postProcessing = pipeline.carry(f.postProcessing)
+	}
+	return f, nil
+}
+
+// currentServices returns the services currently routed
+func (c *Conductor) currentServices() []*Service {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	return c.services
+}
+
+// currentFailover returns the remote cluster services currently routed, by route
+func (c *Conductor) currentFailover() map[string][]*Service {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	return c.failover
+}
+
+// currentReadiness returns the readiness requirement over the routed services
+func (c *Conductor) currentReadiness() *readiness {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	return c.readiness
+}
+
+// currentFaults returns the fault injector of the routed services
+func (c *Conductor) currentFaults() *faultInjector {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	return c.faults
+}
+
+// currentAuthorizer returns the authorizer of a route, if any
+func (c *Conductor) currentAuthorizer(route string) (Authorizer, bool) {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	authorizer, ok := c.authorizers[route]
+	return authorizer, ok
+}
+
+// currentFanOut returns the fan-out limit of a route, if any
+func (c *Conductor) currentFanOut(route string) (config.RouteFanOut, bool) {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	limit, ok := c.fanOut[route]
+	return limit, ok
+}
+
+// currentMirrorShaper returns the shaper of the routed services
+func (c *Conductor) currentMirrorShaper() *mirrorShaper {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	return c.mirrorShaper
+}
+
+// currentPostProcessing returns the post-processing pipeline of the routed routes
+func (c *Conductor) currentPostProcessing() *postProcessPipeline {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	return c.postProcessing
+}
+
+// serviceNamed returns the currently routed service with the given name
+func (c *Conductor) serviceNamed(name string) (*Service, bool) {
+	for _, svc := range c.currentServices() {
+		if svc.Name == name {
+			return svc, true
+		}
+	}
+	return nil, false
+}
+
+// servedConfig returns the configuration with the services currently routed
+func (c *Conductor) servedConfig() *config.Config {
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+	return c.served
+}
+
+// diffServices returns the names of services added, changed and removed by a reload
+func diffServices(previous map[string]*Service, services []*Service) (added []string, changed []string, removed []string) {
+	kept := make(map[string]bool, len(services))
+	for _, svc := range services {
+		kept[svc.Name] = true
+		switch old, ok := previous[svc.Name]; {
+		case !ok:
+			added = append(added, svc.Name)
+		case old != svc:
+			changed = append(changed, svc.Name)
+		}
+	}
+	for name := range previous {
+		if !kept[name] {
+			removed = append(removed, name)
+		}
+	}
+	return added, changed, removed
+}
+
+// unappliedSections returns the configuration sections, by their YAML names, that differ
+// from the running configuration but are not applied by a reload
+func unappliedSections(current *config.Config, next *config.Config) []string {
+	a, b := reflect.ValueOf(*current), reflect.ValueOf(*next)
+	var sections []string
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if field.Name == "Services" || field.Name == "Failover" {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			sections = append(sections, name)
+		}
+	}
+	return sections
+}
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestReload tests that reloaded services are routed while unchanged ones are kept
+func TestReload(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "users", URL: "http://users.example.com", PathPrefix: "/users", Primary: true},
+			{Name: "orders", URL: "http://orders.example.com", PathPrefix: "/orders", Primary: true},
+			{Name: "legacy", URL: "http://legacy.example.com", PathPrefix: "/legacy", Primary: true},
+		},
+		Health: config.HealthConfig{FailureThreshold: 1, RetryAfter: 60},
+	}
+	conductor := NewConductor(cfg)
+	transport := &countingTransport{counts: make(map[string]int)}
+	conductor.client = &http.Client{Transport: transport}
+	users, orders := conductor.services[0], conductor.services[1]
+	orders.health.Record(false)
+
+	reloaded := &config.Config{
+		Timeout: 10,
+		Services: []config.Service{
+			{Name: "users", URL: "http://users.example.com", PathPrefix: "/users", Primary: true},
+			{Name: "orders", URL: "http://orders-v2.example.com", PathPrefix: "/orders", Primary: true},
+			{Name: "search", URL: "http://search.example.com", PathPrefix: "/search", Primary: true},
+		},
+	}
+	if err := conductor.Reload(reloaded); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	if conductor.services[0] != users {
+		t.Error("Expected the unchanged service to be kept")
+	}
+	if conductor.services[1] == orders || conductor.services[1].health != orders.health {
+		t.Error("Expected the changed service to be replaced with its health state")
+	}
+	if conductor.timeout != 5*time.Second || conductor.servedConfig().Timeout != 5 {
+		t.Error("Expected settings outside services to be kept until restart")
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/search/items", wantStatus: http.StatusOK},
+		{path: "/legacy/items", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com"+tt.path, nil))
+		if recorder.Code != tt.wantStatus {
+			t.Errorf("Expected status %d for %s, got %d", tt.wantStatus, tt.path, recorder.Code)
+		}
+	}
+	if transport.count("search.example.com") != 1 {
+		t.Error("Expected the added service to receive the request")
+	}
+
+	// Invalid configurations leave the routing table in place
+	invalid := &config.Config{Services: []config.Service{
+		{Name: "users", URL: "http://users.example.com", PathPrefix: "/users", Primary: true, Match: "body.id =="},
+	}}
+	if err := conductor.Reload(invalid); err == nil {
+		t.Error("Expected an error for an invalid match predicate")
+	}
+	if len(conductor.services) != 3 {
+		t.Errorf("Expected the previous services to stay routed, got %d", len(conductor.services))
+	}
+}
+
+// TestReloadFeatures tests that features bound to the services follow a reload, keeping
+// the state of the services that remain
+func TestReloadFeatures(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "users", URL: "http://users.example.com", PathPrefix: "/users", Primary: true},
+			{Name: "users-v2", URL: "http://users-v2.example.com", PathPrefix: "/users"},
+			{Name: "legacy", URL: "http://legacy.example.com", PathPrefix: "/legacy", Primary: true},
+		},
+		Health:      config.HealthConfig{FailureThreshold: 1, RetryAfter: 60},
+		Readiness:   config.ReadinessConfig{Enabled: true, Endpoint: "/readyz"},
+		Faults:      config.FaultConfig{Rules: []config.FaultRule{{Service: "users-v2", Rate: 1, Status: 503}}},
+		MirrorGuard: config.MirrorGuardConfig{Enabled: true, ErrorRate: 0.5, Window: 60, MinRequests: 1, CoolDown: 300},
+	}
+	conductor := NewConductor(cfg)
+	defer conductor.Close()
+	conductor.faults.Set("users-v2", true)
+	conductor.mirrorGuard.disabled["legacy"] = mirrorTrip{Service: "legacy", Until: time.Now().Add(time.Hour)}
+
+	reloaded := &config.Config{Services: []config.Service{
+		{Name: "users", URL: "http://users.example.com", PathPrefix: "/users"},
+		{Name: "users-v2", URL: "http://users-v2.example.com", PathPrefix: "/users", Primary: true},
+		{Name: "search", URL: "http://search.example.com", PathPrefix: "/search", Primary: true},
+	}}
+	if err := conductor.Reload(reloaded); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	// Readiness requires the primaries of the reloaded routes
+	report := conductor.currentReadiness().Report(conductor)
+	if report.Require != "/users AND /search" {
+		t.Errorf("Expected readiness over the reloaded routes, got %q", report.Require)
+	}
+	search, _ := conductor.serviceNamed("search")
+	search.health.Record(false)
+	if conductor.currentReadiness().Report(conductor).Ready {
+		t.Error("Expected readiness to follow the health of an added service")
+	}
+
+	if status := conductor.currentFaults().Status(); len(status) != 1 || !status[0].Active {
+		t.Errorf("Expected the active fault kept, got %+v", status)
+	}
+	if trips := conductor.mirrorGuard.Disabled(); len(trips) != 0 {
+		t.Errorf("Expected the removed service's trip forgotten, got %+v", trips)
+	}
+
+	// Features refusing the new services leave the routing table in place
+	if err := conductor.Reload(&config.Config{Services: reloaded.Services[:1]}); err == nil {
+		t.Error("Expected an error for a fault rule of a removed service")
+	}
+	if len(conductor.currentServices()) != 3 {
+		t.Errorf("Expected the previous services to stay routed, got %d", len(conductor.currentServices()))
+	}
+}
+
+// TestReloadGracePeriod tests that removed services keep answering routes no remaining
+// service serves until their grace period ends
+func TestReloadGracePeriod(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "users", URL: "http://users.example.com", PathPrefix: "/users", Primary: true},
+			{Name: "users-old", URL: "http://users-old.example.com", PathPrefix: "/users"},
+			{Name: "legacy", URL: "http://legacy.example.com", PathPrefix: "/legacy", Primary: true},
+		},
+		Reload: config.ReloadConfig{GracePeriod: 30},
+	}
+	conductor := NewConductor(cfg)
+	transport := &countingTransport{counts: make(map[string]int)}
+	conductor.client = &http.Client{Transport: transport}
+	legacy := conductor.services[2]
+
+	if err := conductor.Reload(&config.Config{Services: cfg.Services[:1]}); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	get := func(path string) int {
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com"+path, nil))
+		return recorder.Code
+	}
+	if status := get("/legacy/items"); status != http.StatusOK || transport.count("legacy.example.com") != 1 {
+		t.Errorf("Expected the removed route answered by its service, got %d", status)
+	}
+	if status := get("/users/1"); status != http.StatusOK || transport.count("users-old.example.com") != 0 {
+		t.Errorf("Expected routes left with services not to reach removed ones, got %d", status)
+	}
+
+	// A later reload keeps the retired service until its own period ends
+	if err := conductor.Reload(&config.Config{Services: cfg.Services[:1]}); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	conductor.routesMu.Lock()
+	conductor.retired.until[legacy] = time.Now().Add(-time.Second)
+	conductor.routesMu.Unlock()
+	if status := get("/legacy/items"); status != http.StatusNotFound {
+		t.Errorf("Expected the removed route refused after its grace period, got %d", status)
+	}
+}
@@ -1,72 +1,221 @@
 package proxy
 
 import (
-	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/zeek-r/go-conductor/internal/logger"
+	"github.com/zeek-r/go-conductor/internal/version"
 )
 
-// readRequestBody reads the request body and returns it as a byte slice
-func (c *Conductor) readRequestBody(r *http.Request) ([]byte, error) {
-	var requestBody []byte
-	if r.Body != nil {
-		var err error
-		requestBody, err = io.ReadAll(r.Body)
-		r.Body.Close()
-		if err != nil {
-			return nil, err
-		}
+// requestIDHeader carries the request ID to backends and back to the client
+const requestIDHeader = "X-Request-ID"
+
+// traceparentHeader carries the W3C trace context of the request
+const traceparentHeader = "traceparent"
+
+// ensureRequestID makes sure the request carries an ID, generating one if the client sent none
+func ensureRequestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(buf)
+	r.Header.Set(requestIDHeader, id)
+	return id
+}
+
+// traceIDFromRequest returns the trace ID from a W3C traceparent header, as propagated by
+// OpenTelemetry, or an empty string if the request is not part of a valid trace
+func traceIDFromRequest(r *http.Request) string {
+	// traceparent is version-traceid-parentid-flags, e.g. 00-<32 hex>-<16 hex>-01
+	parts := strings.Split(r.Header.Get(traceparentHeader), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 {
+		return ""
+	}
+
+	traceID := strings.ToLower(parts[1])
+	if _, err := hex.DecodeString(traceID); err != nil || traceID == strings.Repeat("0", 32) {
+		return ""
+	}
+	return traceID
+}
+
+// readRequestBody reads the request body so it can be replayed to every service,
+// spooling it to disk when it exceeds the configured threshold
+func (c *Conductor) readRequestBody(r *http.Request) (*requestBody, error) {
+	if r.Body == nil {
+		return &requestBody{}, nil
+	}
+	defer r.Body.Close()
+
+	spool := c.config.BodySpool
+	body, err := spoolBody(r.Body, int64(spool.ThresholdMB)<<20, spool.Dir)
+	if err != nil {
+		return nil, err
 	}
-	return requestBody, nil
+
+	if body.Spooled() {
+		logger.DebugWithFields("Spooled request body to disk", map[string]interface{}{
+			"method":   r.Method,
+			"path":     r.URL.Path,
+			"body_len": body.Len(),
+		})
+	}
+	return body, nil
+}
+
+// withAcceptEncoding returns a copy of the request with its Accept-Encoding replaced
+func withAcceptEncoding(r *http.Request, encoding string) *http.Request {
+	forced := r.WithContext(r.Context())
+	forced.Header = r.Header.Clone()
+	forced.Header.Set("Accept-Encoding", encoding)
+	return forced
 }
 
-// copyAndAugmentHeaders copies the original request headers and adds service-specific headers
-func (c *Conductor) copyAndAugmentHeaders(req *http.Request, originalReq *http.Request, svc *Service) {
-	// Copy original headers
+// copyAndAugmentHeaders copies the original request headers and adds service-specific headers,
+// substituting the request's variables into their values
+func (c *Conductor) copyAndAugmentHeaders(req *http.Request, originalReq *http.Request, svc *Service, vars map[string]string) {
+	// Copy original headers the service may receive
 	for k, values := range originalReq.Header {
+		if !svc.headers.Forward(k) {
+			continue
+		}
 		for _, v := range values {
 			req.Header.Add(k, v)
 		}
 	}
 
+	// Identify conducted traffic so backends can tell it apart and loops can be detected
+	if !c.config.DisableVia {
+		appendVia(req.Header, originalReq.ProtoMajor, originalReq.ProtoMinor)
+	}
+	if c.loops != nil {
+		c.loops.Mark(req.Header)
+	}
+	if svc.Config.UserAgent != "" {
+		req.Header.Set("User-Agent", svc.Config.UserAgent)
+	}
+
 	// Add custom headers for this service
 	for k, v := range svc.Config.Headers {
-		req.Header.Set(k, v)
+		req.Header.Set(k, expandTemplate(v, vars, nil))
+	}
+}
+
+// setDeadlineHeader advertises the time the backend has for this attempt in milliseconds:
+// the remaining request budget, bounded by the route's latency budget, minus the margin
+// reserved for getting the response back
+func (c *Conductor) setDeadlineHeader(ctx context.Context, req *http.Request, svc *Service) {
+	header := svc.Config.DeadlineHeader
+	if header == "" {
+		header = c.config.DeadlineHeader
+	}
+	if header == "" {
+		return
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
 	}
+	remaining := time.Until(deadline)
+
+	// Latency budgets apply to every attempt, so they bound the backend even when only logged
+	if budget, ok := c.budgetFor(svc.Route); ok && budget.MaxLatencyMs > 0 {
+		remaining = min(remaining, time.Duration(budget.MaxLatencyMs)*time.Millisecond)
+	}
+
+	remaining -= time.Duration(c.config.DeadlineMarginMs) * time.Millisecond
+	req.Header.Set(header, strconv.FormatInt(max(remaining.Milliseconds(), 0), 10))
 }
 
 // sendRequest sends the HTTP request and returns the result
 func (c *Conductor) sendRequest(svc *Service, req *http.Request, targetURL string) *serviceResult {
+	streaming := c.streams(svc)
+	client := c.clientFor(svc)
+	// Streams and background mirrors are bounded by their context instead
+	if streaming || svc.Config.Mirror {
+		client = withoutTimeout(client)
+	}
+
 	requestStart := time.Now()
-	resp, err := c.client.Do(req)
+	resp, err := client.Do(req)
 	requestDuration := time.Since(requestStart)
 
 	if err != nil {
-		logger.ErrorWithFields("Request to service failed", err, map[string]interface{}{
+		logger.ForService(svc.Name).ErrorWithFields("Request to service failed", err, map[string]interface{}{
 			"service":     svc.Name,
 			"target_url":  targetURL,
 			"duration_ms": requestDuration.Milliseconds(),
 		})
 		return &serviceResult{service: svc, err: err}
 	}
+
+	// Hand a streamed body over unread, the client receives it as it arrives
+	if streaming {
+		logger.ForService(svc.Name).DebugWithFields("Streaming service response", map[string]interface{}{
+			"service":     svc.Name,
+			"status_code": resp.StatusCode,
+			"duration_ms": requestDuration.Milliseconds(),
+		})
+		return &serviceResult{service: svc, resp: resp, stream: resp.Body}
+	}
 	defer resp.Body.Close()
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	// Discard a drained shadow body without holding it in memory
+	if c.drains(svc) {
+		if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+			return &serviceResult{service: svc, resp: resp, err: err}
+		}
+		return &serviceResult{service: svc, resp: resp, drained: true}
+	}
+
+	// Give up on a response declaring a size over the service's limit without reading it
+	if err := c.checkResponseSize(svc, resp, resp.ContentLength); err != nil {
+		return &serviceResult{service: svc, resp: resp, err: err}
+	}
+
+	// Read response body, stopping early if it exceeds the service's size limit or an
+	// enforced size budget
+	limit := c.readLimit(svc)
+	var reader io.Reader = resp.Body
+	if limit > 0 {
+		reader = io.LimitReader(resp.Body, limit)
+	}
+	body, err := io.ReadAll(reader)
 	if err != nil {
 		return &serviceResult{service: svc, resp: resp, err: err}
 	}
+	body, err = c.decompressResponse(svc, resp, body, limit)
+	if err != nil {
+		return &serviceResult{service: svc, resp: resp, err: err}
+	}
+	if err := c.checkResponseSize(svc, resp, int64(len(body))); err != nil {
+		return &serviceResult{service: svc, resp: resp, err: err}
+	}
+	if err := c.checkResponseBudget(svc, int64(len(body))); err != nil {
+		return &serviceResult{service: svc, resp: resp, err: err}
+	}
 
-	logger.DebugWithFields("Service response received", map[string]interface{}{
+	logger.ForService(svc.Name).DebugWithFields("Service response received", map[string]interface{}{
 		"service":      svc.Name,
 		"status_code":  resp.StatusCode,
 		"duration_ms":  requestDuration.Milliseconds(),
 		"response_len": len(body),
+		"headers":      logger.RedactHeaders(resp.Header),
 	})
 
 	return &serviceResult{
@@ -77,49 +226,279 @@ func (c *Conductor) sendRequest(svc *Service, req *http.Request, targetURL strin
 	}
 }
 
-// makeServiceRequest makes a request to a single service and returns the result
-func (c *Conductor) makeServiceRequest(ctx context.Context, svc *Service, originalReq *http.Request, requestBody []byte) *serviceResult {
+// attemptServiceRequest makes one attempt of a request to a single service and returns the
+// result, counting attempts from 1
+func (c *Conductor) attemptServiceRequest(ctx context.Context, svc *Service, originalReq *http.Request, requestBody *requestBody, attempt int) *serviceResult {
+	// Bound this attempt separately from the overall request budget
+	if timeout := c.attemptTimeoutFor(svc); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Abort requests exceeding the route's latency budget when it is enforced
+	if limit := c.latencyLimit(svc); limit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
+
+	// Bound only the wait for the headers of a streamed response, not the download
+	streaming := c.streams(svc)
+	var headersReceived, release func()
+	if streaming {
+		ctx, headersReceived, release = streamContext(ctx, originalReq.Context())
+		defer func() {
+			if release != nil {
+				release()
+			}
+		}()
+	}
+
 	// Create a new request for this service
-	targetURL := c.createTargetURL(svc, originalReq)
+	vars := svc.variables.Extract(originalReq)
+	targetURL := c.createTargetURL(svc, originalReq, vars)
 
-	logger.DebugWithFields("Proxying request", map[string]interface{}{
+	logger.ForService(svc.Name).DebugWithFields("Proxying request", map[string]interface{}{
 		"service":     svc.Name,
 		"target_url":  targetURL,
 		"source_path": originalReq.URL.Path,
+		"headers":     logger.RedactHeaders(originalReq.Header),
 	})
 
+	// Trace connection reuse and dial timings for the service
+	ctx = c.withConnTrace(ctx, svc)
+
 	// Create request with provided body
-	req, err := http.NewRequestWithContext(ctx, originalReq.Method, targetURL, bytes.NewReader(requestBody))
+	req, err := http.NewRequestWithContext(ctx, originalReq.Method, targetURL, requestBody.Reader())
 	if err != nil {
 		return &serviceResult{service: svc, err: err}
 	}
+	if requestBody.Spooled() {
+		req.ContentLength = requestBody.Len()
+	}
 
 	// Copy headers and add custom ones
-	c.copyAndAugmentHeaders(req, originalReq, svc)
+	c.copyAndAugmentHeaders(req, originalReq, svc, vars)
+	c.annotations.annotateRequest(req, svc, attempt)
+
+	// Send the token the service requires, replacing any the client sent
+	if err := c.setCredentials(ctx, req, svc); err != nil {
+		return &serviceResult{service: svc, err: err}
+	}
+
+	// Forward the client's Host header for backends that route virtual hosts internally
+	if svc.Config.PreserveHost {
+		req.Host = originalReq.Host
+	}
+
+	// Revalidate a stale cached response with the service that produced it
+	if stale := revalidating(originalReq.Context()); stale != nil && stale.service == svc {
+		stale.setConditions(req.Header)
+	}
+
+	// Ask for gzip explicitly so compressed responses can be decompressed before use.
+	// Streamed responses are passed through as the client asked for them.
+	if c.config.Compression.Enabled && !streaming {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	// Propagate the remaining budget so backends can give up early
+	c.setDeadlineHeader(ctx, req, svc)
+
+	// Close the connection after this request if it has served its share
+	req = c.withConnRecycling(req, svc)
 
 	// Send request and process response
-	return c.sendRequest(svc, req, targetURL)
+	requestStart := time.Now()
+	result := c.sendWithFaults(ctx, svc, req, targetURL)
+	if result.stream != nil {
+		// The stream now releases the context once the client has read it
+		headersReceived()
+		result.stream, release = &streamBody{ReadCloser: result.stream, release: release}, nil
+	}
+	result.duration = time.Since(requestStart)
+	c.checkLatencyBudget(svc, result.duration)
+	c.recordAttemptLatency(svc, result)
+	c.checkCredentials(svc, req, result)
+	c.recordHealth(svc, result)
+	c.recordServiceMetrics(svc, result)
+	c.recordMirror(svc, result, time.Since(requestStart))
+	c.captureMirror(svc, req, requestBody, result, requestStart)
+	return result
+}
+
+// proxyRequest fans the request out to all services and selects the response to use.
+// Concurrent requests sharing an idempotency key are coalesced into one upstream call.
+func (c *Conductor) proxyRequest(ctx context.Context, services []*Service, r *http.Request, requestBody *requestBody) (*serviceResult, error) {
+	// On-demand mirrors wait for their own service, pinned reads need their own primary and
+	// streamed bodies can only be read once, so they never share a call
+	var key string
+	if c.deduper != nil && onDemandOf(r) == nil && pinnedTo(r) == "" && !c.streamsAny(services) {
+		key = c.deduper.Key(r, requestBody)
+	}
+	if key == "" {
+		return c.processResults(ctx, c.fanOutRequests(ctx, services, r, requestBody), r)
+	}
+
+	// The shared call must not be abandoned when the client that started it goes away
+	shared := r.WithContext(context.WithoutCancel(r.Context()))
+	sharedCtx, cancel := context.WithTimeout(shared.Context(), c.timeout)
+	defer cancel()
+
+	result, failure, leader := c.deduper.Do(key, func() (*serviceResult, error) {
+		return c.processResults(sharedCtx, c.fanOutRequests(sharedCtx, services, shared, requestBody), shared)
+	})
+	if !leader {
+		requestBody.Close()
+		logger.DebugWithFields("Coalesced duplicate request", map[string]interface{}{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		})
+	}
+	return result, failure
 }
 
-// fanOutRequests sends the request to all services and returns a channel for the results
-func (c *Conductor) fanOutRequests(ctx context.Context, services []*Service, originalReq *http.Request, requestBody []byte) <-chan *serviceResult {
+// fanOutRequests sends the request to all services and returns a channel for the results.
+// The request body is released once every service request has finished.
+func (c *Conductor) fanOutRequests(ctx context.Context, services []*Service, originalReq *http.Request, requestBody *requestBody) <-chan *serviceResult {
 	resultChan := make(chan *serviceResult, len(services))
 	var wg sync.WaitGroup
 
+	// Keep every result so shadow responses can be compared once all have arrived
+	var mu sync.Mutex
+	results := make([]*serviceResult, 0, len(services))
+	route, method, path := services[0].Route, originalReq.Method, originalReq.URL.Path
+
+	// Ask every service of a mirrored request for the same encoding, so responses compare
+	// regardless of what the client accepts. The primary answers the client, so it is only
+	// asked for the encoding when the client accepts it. Streamed responses are not compared.
+	shadowReq := originalReq
+	if encoding := c.config.Comparison.AcceptEncoding; encoding != "" && len(services) > 1 && !c.streamsAny(services) {
+		shadowReq = withAcceptEncoding(originalReq, encoding)
+		if acceptsEncoding(originalReq, encoding) {
+			originalReq = shadowReq
+		}
+	}
+
+	// Shadow requests are only shaped, and mirrors only run in the background, when a
+	// primary answers the client
+	mirrored := false
+	for _, service := range services {
+		mirrored = mirrored || service.Primary
+	}
+
+	// Shadows and mirrors of hot routes take turns, so they do not all hit backends at once
+	var gate *fanOutGate
+	if mirrored {
+		gate = c.newFanOutGate(route)
+	}
+
+	// Deferred shadows and mirrors are only sent once the primary answered
+	var deferred []*Service
+	if mirrored && c.deferredMirrors != nil {
+		services, deferred = deferMirrors(services, shadowReq)
+	}
+
+	// Background mirrors are only waited for to compare their responses
+	var background sync.WaitGroup
 	for _, service := range services {
-		wg.Add(1)
+		detached := mirrored && !service.Primary && service.Config.Mirror
+		group := &wg
+		if detached {
+			group = &background
+		}
+		group.Add(1)
 		go func(svc *Service) {
-			defer wg.Done()
-			result := c.makeServiceRequest(ctx, svc, originalReq, requestBody)
-			resultChan <- result
+			defer group.Done()
+			ctx := ctx
+			if detached {
+				var cancel context.CancelFunc
+				ctx, cancel = c.mirrorContext(ctx, svc)
+				defer cancel()
+			}
+			if svc.Primary {
+				defer gate.PrimaryAnswered()
+			} else {
+				gate := fanOutGateFor(gate, svc, originalReq)
+				if !c.enterFanOut(ctx, gate, svc, originalReq, detached) {
+					return
+				}
+				defer gate.Leave()
+			}
+			if !c.admitMirror(ctx, svc, originalReq, mirrored) {
+				return
+			}
+			req := originalReq
+			if !svc.Primary {
+				req = shadowReq
+			}
+			result := c.makeServiceRequest(ctx, svc, req, requestBody)
+			deliverOnDemand(originalReq, result)
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+			if !detached {
+				resultChan <- result
+			}
 		}(service)
 	}
 
-	// Close the channel once all goroutines are done
+	// Close the channel once the services answering the client are done, and release the
+	// body once background mirrors are done too
 	go func() {
 		wg.Wait()
 		close(resultChan)
+		background.Wait()
+		// Deferred requests take over the body and the comparison
+		if len(deferred) > 0 && c.submitDeferredMirrors(deferredMirrorJob{
+			ctx:      context.WithoutCancel(ctx),
+			route:    route,
+			services: deferred,
+			req:      shadowReq,
+			body:     requestBody,
+			results:  results,
+		}) {
+			return
+		}
+		if err := requestBody.Close(); err != nil {
+			logger.Error("Failed to remove spooled request body", err)
+		}
+		// A revalidated primary may answer with a bare 304, which cannot be compared
+		if revalidating(originalReq.Context()) == nil {
+			c.submitComparison(route, method, path, results)
+		}
 	}()
 
 	return resultChan
-} 
\ No newline at end of file
+}
+
+// mirrorContext detaches a background mirror request from the client's request, so it
+// completes after the response was sent, bounding it by the service's mirror timeout
+func (c *Conductor) mirrorContext(ctx context.Context, svc *Service) (context.Context, context.CancelFunc) {
+	timeout := c.timeout
+	if svc.Config.MirrorTimeout > 0 {
+		timeout = time.Duration(svc.Config.MirrorTimeout) * time.Second
+	}
+	return context.WithTimeout(context.WithoutCancel(ctx), timeout)
+}
+
+// viaPseudonym identifies this conductor in Via headers
+const viaPseudonym = "go-conductor"
+
+// appendVia appends this hop to the Via header, given the protocol version of the message
+// received. Existing entries are kept, as every proxy on the path appends its own.
+func appendVia(header http.Header, protoMajor int, protoMinor int) {
+	if protoMajor == 0 {
+		protoMajor, protoMinor = 1, 1
+	}
+	hop := fmt.Sprintf("%d.%d %s/%s", protoMajor, protoMinor, viaPseudonym, version.Version)
+	if protoMajor > 1 {
+		hop = fmt.Sprintf("%d %s/%s", protoMajor, viaPseudonym, version.Version)
+	}
+
+	if existing := header.Values("Via"); len(existing) > 0 {
+		hop = strings.Join(existing, ", ") + ", " + hop
+	}
+	header.Set("Via", hop)
+}
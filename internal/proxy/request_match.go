@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// requestMatch is a predicate over request headers and cookies. Every listed header and
+// cookie must carry its value, or any value for "*".
+type requestMatch struct {
+	headers map[string]string // Values by canonical header name
+	cookies map[string]string // Values by cookie name
+}
+
+// newRequestMatch creates the predicate over the given headers and cookies, or nil if
+// there are none
+func newRequestMatch(headers map[string]string, cookies map[string]string) *requestMatch {
+	if len(headers) == 0 && len(cookies) == 0 {
+		return nil
+	}
+	m := &requestMatch{headers: make(map[string]string, len(headers)), cookies: cookies}
+	for name, value := range headers {
+		m.headers[http.CanonicalHeaderKey(name)] = value
+	}
+	return m
+}
+
+// Matches reports whether the request carries every header and cookie of the predicate
+func (m *requestMatch) Matches(r *http.Request) bool {
+	for name, want := range m.headers {
+		matched := false
+		for _, value := range r.Header.Values(name) {
+			matched = matched || want == "*" || value == want
+		}
+		if !matched {
+			return false
+		}
+	}
+	for name, want := range m.cookies {
+		cookie, err := r.Cookie(name)
+		if err != nil || (want != "*" && cookie.Value != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestMatchKey is the request context key marking requests routed by header or cookie
+type requestMatchKey struct{}
+
+// routedByRequestMatch reports whether the request was routed to services by its headers
+// or cookies
+func routedByRequestMatch(r *http.Request) bool {
+	routed, _ := r.Context().Value(requestMatchKey{}).(bool)
+	return routed
+}
+
+// routeByMatch narrows the matching services by their predicates over the request's
+// headers, cookies and body. When any service with predicates matches, the request goes
+// to those services only; otherwise it goes to the services without any. Requests routed
+// by header or cookie are marked, as their responses differ from the route's usual ones.
+// A request matching the predicates of several primaries goes to the first configured.
+func (c *Conductor) routeByMatch(r *http.Request, services []*Service) (*http.Request, []*Service) {
+	conditional, byBody := false, false
+	for _, svc := range services {
+		conditional = conditional || svc.match != nil || svc.requestMatch != nil
+		byBody = byBody || svc.match != nil
+	}
+	if !conditional {
+		return r, services
+	}
+
+	var doc *bodyDocument
+	if byBody {
+		doc = c.peekJSONBody(r)
+	}
+	var matched, unconditional []*Service
+	byRequest := false
+	for _, svc := range services {
+		switch {
+		case svc.match == nil && svc.requestMatch == nil:
+			unconditional = append(unconditional, svc)
+		case (svc.requestMatch == nil || svc.requestMatch.Matches(r)) && (svc.match == nil || svc.match.Eval(doc)):
+			matched = append(matched, svc)
+			byRequest = byRequest || svc.requestMatch != nil
+		}
+	}
+	if len(matched) == 0 {
+		return r, unconditional
+	}
+	matched = firstPrimary(r, matched)
+
+	logger.DebugWithFields("Routing request by match predicates", map[string]interface{}{
+		"method":   r.Method,
+		"path":     r.URL.Path,
+		"services": getServiceNames(matched),
+	})
+	if byRequest {
+		r = r.WithContext(context.WithValue(r.Context(), requestMatchKey{}, true))
+	}
+	return r, matched
+}
+
+// firstPrimary keeps the first configured primary among services whose predicates all
+// matched the request, dropping the others so a write never reaches two primaries
+func firstPrimary(r *http.Request, matched []*Service) []*Service {
+	var primary *Service
+	kept := matched[:0:0]
+	var dropped []string
+	for _, svc := range matched {
+		switch {
+		case !svc.Primary:
+			kept = append(kept, svc)
+		case primary == nil:
+			primary = svc
+			kept = append(kept, svc)
+		default:
+			dropped = append(dropped, svc.Name)
+		}
+	}
+	if len(dropped) == 0 {
+		return matched
+	}
+	logger.DebugWithFields("Request matched several primaries, using the first configured", map[string]interface{}{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"primary": primary.Name,
+		"dropped": dropped,
+	})
+	return kept
+}
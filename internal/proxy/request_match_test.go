@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestRequestMatchRouting tests that services whose header or cookie predicates match
+// replace the route's others, and that requests routed by them bypass the cache
+func TestRequestMatchRouting(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://stable.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "api-beta", URL: "http://beta.example.com", PathPrefix: "/api", Primary: true, MatchHeaders: map[string]string{"x-beta": "true"}},
+			{Name: "api-canary", URL: "http://canary.example.com", PathPrefix: "/api", Primary: true, MatchCookies: map[string]string{"canary": "*"}},
+		},
+		Cache: config.CacheConfig{Enabled: true, MaxEntries: 10, MaxBodyBytes: 1024, DefaultTTL: 60},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	tests := []struct {
+		name     string
+		method   string
+		header   map[string]string
+		wantHost string // Empty when answered from the cache
+	}{
+		{name: "no predicate matches", wantHost: "stable.example.com"},
+		{name: "cached for unmatched requests", header: map[string]string{"X-Beta": "false"}},
+		{name: "header matches", header: map[string]string{"X-Beta": "true"}, wantHost: "beta.example.com"},
+		{name: "cookie present", header: map[string]string{"Cookie": "session=1; canary=group-a"}, wantHost: "canary.example.com"},
+		{name: "other cookie", header: map[string]string{"Cookie": "session=1"}},
+		{name: "both match", method: "POST", header: map[string]string{"X-Beta": "true", "Cookie": "canary=group-a"}, wantHost: "beta.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport.requests = nil
+			method := "GET"
+			if tt.method != "" {
+				method = tt.method
+			}
+			req := httptest.NewRequest(method, "http://example.com/api/items", nil)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", recorder.Code)
+			}
+			if tt.wantHost == "" {
+				if len(transport.requests) != 0 {
+					t.Errorf("Expected an answer from the cache, got a request to %s", transport.requests[0].URL.Host)
+				}
+				return
+			}
+			if len(transport.requests) != 1 {
+				t.Fatalf("Expected 1 backend request, got %d", len(transport.requests))
+			}
+			if host := transport.requests[0].URL.Host; host != tt.wantHost {
+				t.Errorf("Expected request to %s, got %s", tt.wantHost, host)
+			}
+		})
+	}
+}
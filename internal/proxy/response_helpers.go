@@ -1,7 +1,11 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zeek-r/go-conductor/internal/logger"
@@ -13,21 +17,90 @@ func (c *Conductor) handleNoServiceFound(w http.ResponseWriter, r *http.Request)
 		"method": r.Method,
 		"path":   r.URL.Path,
 	})
-	http.Error(w, "No service found for request", http.StatusNotFound)
+	writeError(w, r, http.StatusNotFound, ErrCodeNoRoute, "No service found for request")
 }
 
-// processResults processes the results from all services and returns the one to use
-func (c *Conductor) processResults(resultChan <-chan *serviceResult, r *http.Request) *serviceResult {
+// handleClientCanceled records a request abandoned by the client before a response was written
+func (c *Conductor) handleClientCanceled(r *http.Request, route string, requestStart time.Time) {
+	logger.WarnWithFields("Client canceled request", map[string]interface{}{
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"route":       route,
+		"duration_ms": time.Since(requestStart).Milliseconds(),
+	})
+
+	// Record cancellation in Prometheus metrics using the de facto 499 status
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError("conductor", route, "client_canceled")
+		c.prometheusMetrics.RecordRequest("conductor", route, r.Method, "499", time.Since(requestStart), traceIDFromRequest(r))
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, true)
+	}
+}
+
+// processResults processes the results from all services and returns the one to use.
+// When every service fails, the returned error is the primary service's failure if there
+// was one, otherwise the first failure seen. Responses their backend demoted with a
+// selection hint are only used when no other service responded. With partial results
+// enabled, a deadline expiring before the primary responds selects the best response
+// received instead.
+func (c *Conductor) processResults(ctx context.Context, resultChan <-chan *serviceResult, r *http.Request) (*serviceResult, error) {
 	var primaryResult *serviceResult
 	var anyResult *serviceResult
+	var demotedResult *serviceResult
+	var bestResult *serviceResult
+	var failure error
+
+	// Close the streamed bodies of responses that are not selected
+	var selected *serviceResult
+	defer func() {
+		for _, held := range []*serviceResult{primaryResult, anyResult, demotedResult, bestResult} {
+			if held != selected {
+				held.closeStream()
+			}
+		}
+	}()
 
 	for result := range resultChan {
+		// Outstanding requests are canceled along with the client, stop waiting for them
+		if r.Context().Err() != nil {
+			result.closeStream()
+			return nil, r.Context().Err()
+		}
+
 		if result.err != nil {
-			logger.ErrorWithFields("Error from service", result.err, map[string]interface{}{
+			logger.ForService(result.service.Name).ErrorWithFields("Error from service", result.err, map[string]interface{}{
 				"service": result.service.Name,
 				"method":  r.Method,
 				"path":    r.URL.Path,
 			})
+			if failure == nil || result.service.Primary {
+				failure = result.err
+			}
+			continue
+		}
+
+		// Drained responses have no body to send
+		if result.drained {
+			continue
+		}
+
+		// Keep the best response in case the deadline expires before the primary's arrives
+		if c.partialHeader != "" && (bestResult == nil || c.partialRank(result) < c.partialRank(bestResult)) {
+			bestResult = result
+		}
+
+		// Keep a demoted response as a last resort, preferring the primary's
+		if c.demoted(result) {
+			if demotedResult == nil || result.service.Primary {
+				demotedResult = result
+			}
+			if result.service.Primary && anyResult != nil {
+				break
+			}
 			continue
 		}
 
@@ -41,20 +114,45 @@ func (c *Conductor) processResults(resultChan <-chan *serviceResult, r *http.Req
 			primaryResult = result
 			break
 		}
+
+		// The primary demoted its response, so the first healthy peer's is used
+		if demotedResult != nil && demotedResult.service.Primary {
+			break
+		}
+	}
+
+	// The deadline expired before the primary responded, use the best response received
+	if primaryResult == nil && bestResult != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.ForService(bestResult.service.Name).WarnWithFields("Deadline expired before the primary service responded, using the best response received",
+			map[string]interface{}{
+				"service":      bestResult.service.Name,
+				"status_code":  bestResult.resp.StatusCode,
+				"response_len": len(bestResult.body),
+				"method":       r.Method,
+				"path":         r.URL.Path,
+			})
+		bestResult.partial = true
+		selected = bestResult
+		return bestResult, nil
 	}
 
 	// Use primary result if available, otherwise use any successful result
 	if primaryResult != nil {
-		logger.InfoWithFields("Using response from primary service", map[string]interface{}{
+		logger.ForService(primaryResult.service.Name).InfoWithFields("Using response from primary service", map[string]interface{}{
 			"service":      primaryResult.service.Name,
 			"status_code":  primaryResult.resp.StatusCode,
 			"response_len": len(primaryResult.body),
 			"method":       r.Method,
 			"path":         r.URL.Path,
 		})
-		return primaryResult
+		selected = primaryResult
+		return primaryResult, nil
 	} else if anyResult != nil {
-		logger.WarnWithFields("Primary service did not respond, using response from secondary service",
+		message := "Primary service did not respond, using response from secondary service"
+		if demotedResult != nil && demotedResult.service.Primary {
+			message = "Primary service demoted its response, using response from secondary service"
+		}
+		logger.ForService(anyResult.service.Name).WarnWithFields(message,
 			map[string]interface{}{
 				"service":      anyResult.service.Name,
 				"status_code":  anyResult.resp.StatusCode,
@@ -62,10 +160,48 @@ func (c *Conductor) processResults(resultChan <-chan *serviceResult, r *http.Req
 				"method":       r.Method,
 				"path":         r.URL.Path,
 			})
-		return anyResult
+		selected = anyResult
+		return anyResult, nil
+	} else if demotedResult != nil {
+		logger.ForService(demotedResult.service.Name).WarnWithFields("Only demoted responses available, using one",
+			map[string]interface{}{
+				"service":      demotedResult.service.Name,
+				"status_code":  demotedResult.resp.StatusCode,
+				"response_len": len(demotedResult.body),
+				"method":       r.Method,
+				"path":         r.URL.Path,
+			})
+		selected = demotedResult
+		return demotedResult, nil
+	}
+
+	return nil, failure
+}
+
+// partialRank orders the responses a partial selection picks from, lower ranks first:
+// responses without a server error before the rest, and demoted responses last
+func (c *Conductor) partialRank(result *serviceResult) int {
+	rank := 0
+	if result.resp.StatusCode >= 500 {
+		rank++
+	}
+	if c.demoted(result) {
+		rank += 2
 	}
+	return rank
+}
 
-	return nil
+// demoted reports whether a backend demoted its response with the selection hint header,
+// for example while it serves from a stale cache in degraded mode
+func (c *Conductor) demoted(result *serviceResult) bool {
+	if c.selectionHint == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(result.resp.Header.Get(c.selectionHint))) {
+	case "false", "0", "no":
+		return true
+	}
+	return false
 }
 
 // writeResponse writes the service response back to the client
@@ -77,14 +213,52 @@ func (c *Conductor) writeResponse(w http.ResponseWriter, result *serviceResult,
 		}
 	}
 
+	// Selection hints are meant for the conductor, not the client
+	if c.selectionHint != "" {
+		w.Header().Del(c.selectionHint)
+	}
+
+	// Tell the client the response was selected before every service responded
+	if result.partial {
+		w.Header().Set(c.partialHeader, "deadline-exceeded")
+	}
+
+	// Echo the request ID unless the backend already returned one
+	if w.Header().Get(requestIDHeader) == "" && r.Header.Get(requestIDHeader) != "" {
+		w.Header().Set(requestIDHeader, r.Header.Get(requestIDHeader))
+	}
+
+	// Record this hop in the response's Via header
+	if !c.config.DisableVia {
+		appendVia(w.Header(), result.resp.ProtoMajor, result.resp.ProtoMinor)
+	}
+
+	// Tell the client which service answered and whether the cache did
+	c.annotations.annotateResponse(w.Header(), result)
+
+	// Compress toward clients that accept gzip if enabled
+	body := c.compressForClient(w, r, result)
+
+	// Resolve headers the conductor and the backend both set, or the backend sent twice
+	c.headerPolicies.Sanitize(w.Header())
+
+	// A buffered body rewritten on the way no longer has the backend's length
+	if result.stream == nil && r.Method != http.MethodHead && bodyAllowed(result.resp.StatusCode) &&
+		w.Header().Get("Content-Length") != "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
 	// Set status code
+	noteAccessResult(r, result)
 	w.WriteHeader(result.resp.StatusCode)
 
-	// Copy response body
-	if result.body != nil {
-		_, err := w.Write(result.body)
+	// Copy response body, or a streamed body as it arrives
+	if result.stream != nil {
+		copyStream(w, r, result)
+	} else if body != nil {
+		_, err := w.Write(body)
 		if err != nil {
-			logger.ErrorWithFields("Failed to write response body", err, map[string]interface{}{
+			logger.ForService(result.service.Name).ErrorWithFields("Failed to write response body", err, map[string]interface{}{
 				"method":       r.Method,
 				"path":         r.URL.Path,
 				"status_code":  result.resp.StatusCode,
@@ -94,7 +268,7 @@ func (c *Conductor) writeResponse(w http.ResponseWriter, result *serviceResult,
 	}
 
 	// Log request completion
-	logger.DebugWithFields("Request completed", map[string]interface{}{
+	logger.ForService(result.service.Name).DebugWithFields("Request completed", map[string]interface{}{
 		"method":       r.Method,
 		"path":         r.URL.Path,
 		"status_code":  result.resp.StatusCode,
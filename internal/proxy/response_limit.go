@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// errResponseTooLarge is returned for backend responses larger than the service's maxResponseBytes
+var errResponseTooLarge = errors.New("response exceeds the service's size limit")
+
+// readLimit returns how many response bytes to read from a service before giving up: one
+// past the smaller of its size limit and the route's enforced budget, or zero to read the
+// whole response
+func (c *Conductor) readLimit(svc *Service) int64 {
+	limit := c.responseReadLimit(svc)
+	if maxBytes := svc.Config.MaxResponseBytes; maxBytes > 0 && (limit == 0 || maxBytes+1 < limit) {
+		// Read one byte past the limit so an oversized response can be detected
+		limit = maxBytes + 1
+	}
+	return limit
+}
+
+// checkResponseSize reports a response body larger than the service's size limit, returning
+// an error as the response must be discarded. A declared Content-Length is checked before
+// the body is read.
+func (c *Conductor) checkResponseSize(svc *Service, resp *http.Response, size int64) error {
+	maxBytes := svc.Config.MaxResponseBytes
+	if maxBytes == 0 || size <= maxBytes {
+		return nil
+	}
+
+	logger.ForService(svc.Name).ErrorWithFields("Service response exceeds its size limit, discarding it", errResponseTooLarge, map[string]interface{}{
+		"service":        svc.Name,
+		"route":          svc.Route,
+		"status_code":    resp.StatusCode,
+		"response_len":   size,
+		"content_length": resp.ContentLength,
+		"max_bytes":      maxBytes,
+	})
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError(svc.Name, svc.Route, "response_too_large")
+	}
+	return errResponseTooLarge
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestResponseSizeLimit tests that responses over a service's size limit fail the request,
+// whether their size is declared upfront or only found while reading them
+func TestResponseSizeLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		if r.URL.Query().Get("chunked") != "" {
+			// Flushing before writing the body leaves its size undeclared
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(strings.Repeat("x", size)))
+	}))
+	defer backend.Close()
+
+	conductor := NewConductor(&config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: backend.URL, PathPrefix: "/api", Primary: true, MaxResponseBytes: 64},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "within the limit", query: "size=64", wantStatus: http.StatusOK},
+		{name: "declared over the limit", query: "size=65", wantStatus: http.StatusBadGateway},
+		{name: "read over the limit", query: "size=4096&chunked=1", wantStatus: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/api/export?"+tt.query, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Failures retried besides status codes
+const (
+	retryOnConnection = "connection"
+	retryOnTimeout    = "timeout"
+)
+
+// retryPolicy decides which failed attempts of a service are repeated and how long to
+// wait before each
+type retryPolicy struct {
+	retries  int
+	backoff  time.Duration
+	statuses map[int]bool // Status codes retried
+	classes  map[int]bool // Status classes retried, 5 for 5xx
+	failures map[string]bool
+}
+
+// newRetryPolicy creates the retry policy of a service, nil if it does not retry
+func newRetryPolicy(svcConfig config.Service) *retryPolicy {
+	if svcConfig.Retries <= 0 {
+		return nil
+	}
+	policy := &retryPolicy{
+		retries:  svcConfig.Retries,
+		backoff:  time.Duration(svcConfig.RetryBackoff) * time.Millisecond,
+		statuses: make(map[int]bool),
+		classes:  make(map[int]bool),
+		failures: make(map[string]bool),
+	}
+	for _, failure := range svcConfig.RetryOn {
+		if code, err := strconv.Atoi(failure); err == nil {
+			policy.statuses[code] = true
+		} else if len(failure) == 3 && failure[1:] == "xx" {
+			policy.classes[int(failure[0]-'0')] = true
+		} else {
+			policy.failures[failure] = true
+		}
+	}
+	return policy
+}
+
+// Reason returns why an attempt should be retried, the failure or status code, or empty
+// if its result stands. Errors after a response arrived, such as an oversized body, are
+// not retried.
+func (p *retryPolicy) Reason(result *serviceResult) string {
+	if result.resp == nil {
+		if result.err == nil {
+			return ""
+		}
+		failure := retryOnConnection
+		if isTimeoutError(result.err) {
+			failure = retryOnTimeout
+		}
+		if p.failures[failure] {
+			return failure
+		}
+		return ""
+	}
+	if result.err != nil {
+		return ""
+	}
+	code := result.resp.StatusCode
+	if p.statuses[code] || p.classes[code/100] {
+		return strconv.Itoa(code)
+	}
+	return ""
+}
+
+// Backoff returns the wait before a retry, counted from 1, doubling the base backoff for
+// each retry and picking at random in its upper half so retrying clients spread out
+func (p *retryPolicy) Backoff(retry int) time.Duration {
+	backoff := p.backoff << min(retry-1, 16)
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// isIdempotentMethod reports whether repeating a request has the same effect as sending it once
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	default:
+		return isSafeMethod(method)
+	}
+}
+
+// makeServiceRequest makes a request to a single service and returns the result, retrying
+// failed attempts of idempotent requests as the service's retry policy allows
+func (c *Conductor) makeServiceRequest(ctx context.Context, svc *Service, originalReq *http.Request, requestBody *requestBody) *serviceResult {
+	result := c.attemptServiceRequest(ctx, svc, originalReq, requestBody, 1)
+	if svc.retries == nil || !isIdempotentMethod(originalReq.Method) {
+		return result
+	}
+
+	for retry := 1; retry <= svc.retries.retries; retry++ {
+		reason := svc.retries.Reason(result)
+		if reason == "" {
+			return result
+		}
+
+		backoff := svc.retries.Backoff(retry)
+		logger.ForService(svc.Name).WarnWithFields("Retrying request to service", map[string]interface{}{
+			"service":    svc.Name,
+			"path":       originalReq.URL.Path,
+			"retry":      retry,
+			"reason":     reason,
+			"backoff_ms": backoff.Milliseconds(),
+		})
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			// The last result stands when the request's budget runs out
+			timer.Stop()
+			return result
+		}
+
+		// A streamed response that is replaced was never read
+		if result.stream != nil {
+			result.stream.Close()
+		}
+		if c.prometheusMetrics != nil {
+			c.prometheusMetrics.RecordRetry(svc.Name, reason)
+		}
+		result = c.attemptServiceRequest(ctx, svc, originalReq, requestBody, retry+1)
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestRetries tests that retryable failures of idempotent requests are retried
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		retries    int
+		wantStatus int
+		wantCalls  int32
+	}{
+		{name: "recovers within retries", method: "GET", retries: 2, wantStatus: http.StatusOK, wantCalls: 3},
+		{name: "gives up after retries", method: "GET", retries: 1, wantStatus: http.StatusServiceUnavailable, wantCalls: 2},
+		{name: "no retries", method: "GET", retries: 0, wantStatus: http.StatusServiceUnavailable, wantCalls: 1},
+		{name: "non-idempotent method", method: "POST", retries: 2, wantStatus: http.StatusServiceUnavailable, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			cfg := &config.Config{
+				Timeout: 5,
+				Services: []config.Service{{
+					Name: "api", URL: backend.URL, PathPrefix: "/api", Primary: true,
+					Retries: tt.retries, RetryBackoff: 1, RetryOn: []string{"5xx"},
+				}},
+			}
+			conductor := NewConductor(cfg)
+
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, httptest.NewRequest(tt.method, "http://example.com/api/items", nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("Expected %d calls to the backend, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+}
+
+// TestRetryPolicy tests which results are retried and the backoff before each retry
+func TestRetryPolicy(t *testing.T) {
+	policy := newRetryPolicy(config.Service{Retries: 3, RetryBackoff: 100, RetryOn: []string{"connection", "502", "4xx"}})
+
+	tests := []struct {
+		name   string
+		result *serviceResult
+		want   string
+	}{
+		{name: "connection error", result: &serviceResult{err: syscall.ECONNREFUSED}, want: "connection"},
+		{name: "timeout not listed", result: &serviceResult{err: context.DeadlineExceeded}, want: ""},
+		{name: "listed status", result: &serviceResult{resp: &http.Response{StatusCode: 502}}, want: "502"},
+		{name: "listed class", result: &serviceResult{resp: &http.Response{StatusCode: 429}}, want: "429"},
+		{name: "unlisted status", result: &serviceResult{resp: &http.Response{StatusCode: 503}}, want: ""},
+		{name: "error after response", result: &serviceResult{resp: &http.Response{StatusCode: 502}, err: errResponseBudgetExceeded}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Reason(tt.result); got != tt.want {
+				t.Errorf("Expected reason %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	for retry, base := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond} {
+		if backoff := policy.Backoff(retry); backoff < base/2 || backoff > base {
+			t.Errorf("Expected retry %d to back off between %v and %v, got %v", retry, base/2, base, backoff)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"container/list"
+	"sync"
+)
+
+// routeCacheKey identifies the inputs of route matching. The method and host of a request
+// do not take part in it, so requests differing only in those share an entry.
+type routeCacheKey struct {
+	listener string
+	path     string
+}
+
+// routeCacheEntry holds the services matched for a path on a listener
+type routeCacheEntry struct {
+	key      routeCacheKey
+	services []*Service // Shared by the requests the entry answers, never modified
+}
+
+// routeCache is a size-bounded LRU cache of route matches. It is purged whenever the
+// route tables are replaced, under the same lock, so a match is never served from a
+// previous configuration.
+type routeCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[routeCacheKey]*list.Element
+	lru        *list.List // Most recently used at the front
+}
+
+// newRouteCache creates a route cache holding up to maxEntries matches
+func newRouteCache(maxEntries int) *routeCache {
+	return &routeCache{
+		maxEntries: maxEntries,
+		entries:    make(map[routeCacheKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get returns the services cached for a key
+func (rc *routeCache) Get(key routeCacheKey) ([]*Service, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	element, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	rc.lru.MoveToFront(element)
+	return element.Value.(*routeCacheEntry).services, true
+}
+
+// Add caches the services matched for a key, evicting the least recently used matches
+// past the size limit
+func (rc *routeCache) Add(key routeCacheKey, services []*Service) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if element, ok := rc.entries[key]; ok {
+		element.Value.(*routeCacheEntry).services = services
+		rc.lru.MoveToFront(element)
+		return
+	}
+	rc.entries[key] = rc.lru.PushFront(&routeCacheEntry{key: key, services: services})
+	for rc.lru.Len() > rc.maxEntries {
+		oldest := rc.lru.Back()
+		rc.lru.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*routeCacheEntry).key)
+	}
+}
+
+// Purge removes every cached match
+func (rc *routeCache) Purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.entries = make(map[routeCacheKey]*list.Element)
+	rc.lru.Init()
+}
+
+// Len returns the number of cached matches
+func (rc *routeCache) Len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.lru.Len()
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestRouteCache tests that cached matches are bounded to the most recent paths and are
+// purged when the services are reloaded
+func TestRouteCache(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "users", URL: "http://users.example.com", PathRegex: `/users/(?P<id>[0-9]+)`, Primary: true},
+			{Name: "orders", URL: "http://orders.example.com", PathPrefix: "/orders", Primary: true},
+		},
+		RouteCache: config.RouteCacheConfig{Enabled: true, MaxEntries: 2},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	serve := func(path string) int {
+		recorder := httptest.NewRecorder()
+		conductor.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com"+path, nil))
+		return recorder.Code
+	}
+
+	for _, path := range []string{"/users/1", "/users/1", "/orders/1", "/missing"} {
+		serve(path)
+	}
+	if got := conductor.routeCache.Len(); got != 2 {
+		t.Errorf("Expected 2 cached matches, got %d", got)
+	}
+	if _, ok := conductor.routeCache.Get(routeCacheKey{listener: DefaultListener, path: "/users/1"}); ok {
+		t.Error("Expected the least recently requested path to be evicted")
+	}
+	if services, ok := conductor.routeCache.Get(routeCacheKey{listener: DefaultListener, path: "/orders/1"}); !ok || len(services) != 1 || services[0].Name != "orders" {
+		t.Errorf("Expected /orders/1 to be cached as routed to orders, got %v", getServiceNames(services))
+	}
+
+	// A reload must not serve matches of the previous services
+	reloaded := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "orders-v2", URL: "http://orders-v2.example.com", PathPrefix: "/orders", Primary: true},
+		},
+	}
+	if err := conductor.Reload(reloaded); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if got := conductor.routeCache.Len(); got != 0 {
+		t.Errorf("Expected the reload to purge cached matches, got %d", got)
+	}
+
+	transport.requests = nil
+	if code := serve("/orders/1"); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if len(transport.requests) != 1 || transport.requests[0].URL.Host != "orders-v2.example.com" {
+		t.Error("Expected the request to reach the reloaded service")
+	}
+}
@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// routeFreeze is a route whose traffic topology is kept stable during an incident
+type routeFreeze struct {
+	since time.Time
+	flags map[string]interface{} // Flag values when the route was frozen, nil without flags
+}
+
+// routeFreezes tracks the routes frozen at runtime. Automated changes leave frozen routes
+// as they are: reloads keep their services and failover clusters, their flags keep the
+// values they had, and the mirror guard does not disable their shadows. Changes made
+// through the admin endpoints still apply.
+type routeFreezes struct {
+	mu     sync.RWMutex
+	frozen map[string]routeFreeze
+}
+
+// newRouteFreezes creates a tracker with no route frozen
+func newRouteFreezes() *routeFreezes {
+	return &routeFreezes{frozen: make(map[string]routeFreeze)}
+}
+
+// Freeze freezes the route with the given flag values, keeping an earlier freeze as it is
+func (f *routeFreezes) Freeze(route string, flags map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.frozen[route]; !ok {
+		f.frozen[route] = routeFreeze{since: time.Now(), flags: flags}
+	}
+}
+
+// Unfreeze lets automated changes apply to the route again
+func (f *routeFreezes) Unfreeze(route string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.frozen, route)
+}
+
+// Frozen returns the freeze of the route, if it is frozen
+func (f *routeFreezes) Frozen(route string) (routeFreeze, bool) {
+	if f == nil {
+		return routeFreeze{}, false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	freeze, ok := f.frozen[route]
+	return freeze, ok
+}
+
+// Routes returns the frozen routes in sorted order
+func (f *routeFreezes) Routes() []string {
+	if f == nil {
+		return nil
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	routes := make([]string, 0, len(f.frozen))
+	for route := range f.frozen {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// keepFrozenRoutes returns the configuration with the services and failover clusters of
+// frozen routes replaced by those currently served, and the frozen routes. Frozen routes
+// keep their place among the routes, or come last if the configuration dropped them.
+func (c *Conductor) keepFrozenRoutes(cfg *config.Config) (*config.Config, []string) {
+	routes := c.freezes.Routes()
+	if len(routes) == 0 {
+		return cfg, nil
+	}
+	frozen := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		frozen[route] = true
+	}
+
+	served := c.servedConfig()
+	current := make(map[string][]config.Service)
+	for _, service := range served.Services {
+		if route := routeName(service); frozen[route] {
+			current[route] = append(current[route], service)
+		}
+	}
+
+	kept := *cfg
+	kept.Services = nil
+	placed := make(map[string]bool)
+	for _, service := range cfg.Services {
+		route := routeName(service)
+		if !frozen[route] {
+			kept.Services = append(kept.Services, service)
+			continue
+		}
+		if !placed[route] {
+			placed[route] = true
+			kept.Services = append(kept.Services, current[route]...)
+		}
+	}
+	for _, route := range routes {
+		if !placed[route] {
+			kept.Services = append(kept.Services, current[route]...)
+		}
+	}
+
+	kept.Failover = nil
+	for _, failover := range cfg.Failover {
+		if !frozen[failover.Route] {
+			kept.Failover = append(kept.Failover, failover)
+		}
+	}
+	for _, failover := range served.Failover {
+		if frozen[failover.Route] {
+			kept.Failover = append(kept.Failover, failover)
+		}
+	}
+	return &kept, routes
+}
+
+// routeFlagsMirrored reports whether a request to the route is sent to its shadow services
+// by the route's flags, as they were when the route was frozen
+func (c *Conductor) routeFlagsMirrored(route string) bool {
+	if freeze, ok := c.freezes.Frozen(route); ok {
+		return c.flags.MirroredBy(route, freeze.flags)
+	}
+	return c.flags.Mirrored(route)
+}
+
+// RouteFreezeHandler creates an admin handler freezing or unfreezing the route given in the
+// "route" query parameter, which must be routed to be frozen
+func RouteFreezeHandler(c *Conductor, frozen bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodPost) {
+			return
+		}
+
+		route := r.URL.Query().Get("route")
+		if route == "" {
+			http.Error(w, "Missing route parameter", http.StatusBadRequest)
+			return
+		}
+
+		message := "Unfroze route"
+		if frozen {
+			routed := false
+			for _, svc := range c.currentServices() {
+				routed = routed || svc.Route == route
+			}
+			if !routed {
+				http.Error(w, fmt.Sprintf("Unknown route %s", route), http.StatusNotFound)
+				return
+			}
+
+			var flags map[string]interface{}
+			if c.flags != nil {
+				flags, _ = c.flags.Values()
+			}
+			c.freezes.Freeze(route, flags)
+			message = "Froze route"
+		} else {
+			c.freezes.Unfreeze(route)
+		}
+
+		logger.InfoWithFields(message, map[string]interface{}{
+			"route":       route,
+			"remote_addr": r.RemoteAddr,
+		})
+		c.writeRoutesStatus(w)
+	}
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestRouteFreeze tests that frozen routes keep their services across reloads and their
+// flag values, while changes made through the admin endpoints still apply
+func TestRouteFreeze(t *testing.T) {
+	services := func(ordersURL string, webURL string) []config.Service {
+		return []config.Service{
+			{Name: "orders", URL: ordersURL, PathPrefix: "/orders", Primary: true},
+			{Name: "orders-v2", URL: "http://orders-v2.example.com", PathPrefix: "/orders"},
+			{Name: "web", URL: webURL, PathPrefix: "/", Primary: true},
+		}
+	}
+	cfg := &config.Config{
+		Timeout:  5,
+		Services: services("http://orders.example.com", "http://web.example.com"),
+		Flags: config.FlagsConfig{Routes: []config.RouteFlags{
+			{Route: "/orders", Mirror: "orders-mirror"},
+		}},
+		Admin: config.AdminConfig{Enabled: true, Endpoint: "/admin", Token: "secret"},
+	}
+	conductor := NewConductor(cfg)
+	if err := WithFlagProvider(conductor, staticFlags{"orders-mirror": true}); err != nil {
+		t.Fatalf("Failed to set flag provider: %v", err)
+	}
+	defer conductor.Close()
+	conductor.flags.refresh()
+
+	mux := http.NewServeMux()
+	SetupAdminEndpoints(mux, conductor)
+	admin := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, adminRequest("POST", target))
+		return recorder
+	}
+	urlOf := func(name string) string {
+		svc, ok := conductor.serviceNamed(name)
+		if !ok {
+			return ""
+		}
+		return svc.URL.String()
+	}
+
+	if recorder := admin("/admin/routes/freeze?route=/missing"); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 freezing an unknown route, got %d", recorder.Code)
+	}
+	recorder := admin("/admin/routes/freeze?route=/orders")
+	var status routesStatus
+	if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil || status.Routes[0].FrozenSince == nil || status.Routes[1].FrozenSince != nil {
+		t.Fatalf("Expected only /orders frozen, got %d %+v", recorder.Code, status)
+	}
+
+	// Reloads leave the frozen route as it is
+	next := *cfg
+	next.Services = services("http://orders-new.example.com", "http://web-new.example.com")
+	if err := conductor.Reload(&next); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if urlOf("orders") != "http://orders.example.com" || urlOf("web") != "http://web-new.example.com" {
+		t.Errorf("Expected only web changed, got orders %s and web %s", urlOf("orders"), urlOf("web"))
+	}
+
+	// Flags keep the values the route was frozen with
+	if err := WithFlagProvider(conductor, staticFlags{"orders-mirror": false}); err != nil {
+		t.Fatalf("Failed to set flag provider: %v", err)
+	}
+	conductor.flags.refresh()
+	if len(conductor.skipFlaggedMirrors("/orders", conductor.currentServices()[:2])) != 2 {
+		t.Errorf("Expected the frozen route to stay mirrored")
+	}
+
+	// Changes made by hand apply
+	if recorder := admin("/admin/services/disable?service=orders-v2"); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected disabling a service of a frozen route to succeed, got %d", recorder.Code)
+	}
+	if _, ok := conductor.serviceNamed("orders-v2"); ok {
+		t.Errorf("Expected orders-v2 disabled")
+	}
+	admin("/admin/services/enable?service=orders-v2")
+
+	admin("/admin/routes/unfreeze?route=/orders")
+	if err := conductor.Reload(&next); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if urlOf("orders") != "http://orders-new.example.com" {
+		t.Errorf("Expected orders changed once unfrozen, got %s", urlOf("orders"))
+	}
+	if len(conductor.skipFlaggedMirrors("/orders", conductor.currentServices()[:2])) != 1 {
+		t.Errorf("Expected the current flags to apply once unfrozen")
+	}
+}
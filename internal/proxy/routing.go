@@ -2,25 +2,104 @@ package proxy
 
 import (
 	"net/http"
+	"net/url"
+	"regexp"
 	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
 )
 
-// findMatchingServices returns all services that match the request path
+// regexRoute is a route matched by a path regular expression and the services it reaches
+type regexRoute struct {
+	pattern  *regexp.Regexp
+	services []*Service
+}
+
+// compilePathRegex compiles a service's path regular expression, anchored so it must match
+// the whole path, or returns nil if the service has none
+func compilePathRegex(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// addRegexRoute registers a service routed by regular expression, alongside the services
+// sharing its expression
+func (c *Conductor) addRegexRoute(service *Service) {
+	for _, route := range c.routesByRegex {
+		if route.pattern.String() == service.pathRegex.String() {
+			route.services = append(route.services, service)
+			return
+		}
+	}
+	c.routesByRegex = append(c.routesByRegex, &regexRoute{pattern: service.pathRegex, services: []*Service{service}})
+}
+
+// findMatchingServices returns all services that match the request path. Services bound
+// to other listeners than the one the request was received on are not considered.
 func (c *Conductor) findMatchingServices(r *http.Request) []*Service {
 	path := r.URL.Path
+	listener := listenerOf(r)
+
+	c.routesMu.RLock()
+	defer c.routesMu.RUnlock()
+
+	// Matches are cached while the route tables are locked, so reloads purge them all
+	var services []*Service
+	if c.routeCache == nil {
+		services = c.matchServices(path, listener)
+	} else {
+		key := routeCacheKey{listener: listener, path: path}
+		var ok bool
+		if services, ok = c.routeCache.Get(key); !ok {
+			services = c.matchServices(path, listener)
+			c.routeCache.Add(key, services)
+		}
+	}
+
+	// Services removed by a reload answer what no routed service does until their grace
+	// period ends. They are never cached, as the period ends without a reload.
+	if len(services) == 0 {
+		if services = c.retired.match(path, listener); len(services) > 0 {
+			logger.DebugWithFields("Routing request to services removed by a reload", map[string]interface{}{
+				"path":     path,
+				"services": getServiceNames(services),
+			})
+		}
+	}
+	return services
+}
+
+// matchServices evaluates the route tables for a path on a listener. The caller holds the
+// routes lock.
+func (c *Conductor) matchServices(path string, listener string) []*Service {
 	var matches []*Service
 
 	// First, check for exact path matches
 	if services, ok := c.routesByExact[path]; ok {
-		return services
+		if services = servedOn(services, listener); len(services) > 0 {
+			return services
+		}
+	}
+
+	// Then, check for regular expression matches (first configured wins)
+	for _, route := range c.routesByRegex {
+		if route.pattern.MatchString(path) {
+			if services := servedOn(route.services, listener); len(services) > 0 {
+				return services
+			}
+		}
 	}
 
 	// Then, check for prefix matches (longest prefix wins)
 	var bestPrefix string
 	for prefix, services := range c.routesByPrefix {
 		if strings.HasPrefix(path, prefix) && len(prefix) > len(bestPrefix) {
-			bestPrefix = prefix
-			matches = services
+			if services = servedOn(services, listener); len(services) > 0 {
+				bestPrefix = prefix
+				matches = services
+			}
 		}
 	}
 
@@ -31,20 +110,36 @@ func (c *Conductor) findMatchingServices(r *http.Request) []*Service {
 	// Finally, check for normal path matches
 	for basePath, services := range c.routesByPath {
 		if strings.HasPrefix(path, basePath) {
-			matches = append(matches, services...)
+			matches = append(matches, servedOn(services, listener)...)
 		}
 	}
 
 	return matches
 }
 
-// createTargetURL creates the target URL for the proxy request
-func (c *Conductor) createTargetURL(svc *Service, originalReq *http.Request) string {
-	targetURL := svc.URL.String()
+// createTargetURL creates the target URL for the proxy request, substituting the request's
+// variables into a templated service URL and rewrite path
+func (c *Conductor) createTargetURL(svc *Service, originalReq *http.Request, vars map[string]string) string {
+	base := svc.URL
+	if strings.Contains(svc.Config.URL, "${") {
+		expanded, valid := expandURLTemplate(svc.Config.URL, vars)
+		if !valid {
+			// Keep the default URL rather than let the client pick the host
+			logger.WarnWithFields("Refused request variable in service URL", map[string]interface{}{
+				"service": svc.Name,
+				"path":    originalReq.URL.Path,
+			})
+		} else if resolved, err := url.Parse(expanded); err == nil && resolved.Host != "" {
+			base = resolved
+		}
+	}
+	targetURL := base.String()
 
 	// Determine path to use based on route type
 	path := originalReq.URL.Path
-	if svc.Config.PathPrefix != "" && strings.HasPrefix(path, svc.Config.PathPrefix) {
+	if svc.Config.RewritePath != "" {
+		path = expandTemplate(svc.Config.RewritePath, vars, url.PathEscape)
+	} else if svc.Config.PathPrefix != "" && strings.HasPrefix(path, svc.Config.PathPrefix) {
 		// Strip the prefix from the path
 		path = strings.TrimPrefix(path, svc.Config.PathPrefix)
 		if !strings.HasPrefix(path, "/") {
@@ -59,9 +154,9 @@ func (c *Conductor) createTargetURL(svc *Service, originalReq *http.Request) str
 
 	// Build the final target URL
 	if strings.HasPrefix(path, "/") {
-		targetURL = svc.URL.Scheme + "://" + svc.URL.Host + path
+		targetURL = base.Scheme + "://" + base.Host + path
 	} else if path != "" {
-		targetURL = svc.URL.Scheme + "://" + svc.URL.Host + "/" + path
+		targetURL = base.Scheme + "://" + base.Host + "/" + path
 	}
 
 	// Add query parameters if any
@@ -70,4 +165,4 @@ func (c *Conductor) createTargetURL(svc *Service, originalReq *http.Request) str
 	}
 
 	return targetURL
-}
\ No newline at end of file
+}
@@ -0,0 +1,295 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// Sampling modes for large bodies
+const (
+	samplePrefix    = "prefix"    // The first maxBytes bytes and the total length
+	sampleStructure = "structure" // The first items of every JSON array in full, the shape of the rest
+)
+
+// bodySampler reduces bodies too large to compare in full to a bounded sample, so a few
+// huge responses cannot monopolize the comparison workers or their memory
+type bodySampler struct {
+	maxBytes       int
+	mode           string
+	items          int             // Array items compared in full in structure mode
+	maxDecodeBytes int             // Larger bodies are sampled by prefix as received
+	normalizer     *bodyNormalizer // Applied to prefixes and sampled array items
+}
+
+// bodySample is the compared part of a sampled body, with a hash of the content left out
+type bodySample struct {
+	data     []byte
+	tailHash string // Hex SHA-256 of the content not compared in full, for the logs
+}
+
+// newBodySampler creates a sampler for the configuration, or nil if sampling is disabled
+func newBodySampler(cfg config.ComparisonSampling, normalizer *bodyNormalizer) *bodySampler {
+	if cfg.MaxBytes <= 0 {
+		return nil
+	}
+	return &bodySampler{maxBytes: cfg.MaxBytes, mode: cfg.Mode, items: cfg.SampleItems, maxDecodeBytes: cfg.MaxDecodeBytes, normalizer: normalizer}
+}
+
+// Exceeds reports whether a body is too large to compare in full
+func (s *bodySampler) Exceeds(body []byte) bool {
+	return s != nil && len(body) > s.maxBytes
+}
+
+// Sample reduces a body to its compared sample. Bodies that are not JSON are sampled by
+// prefix in structure mode. Bodies larger than maxDecodeBytes are never decoded, so their
+// prefix is sampled as received.
+func (s *bodySampler) Sample(body []byte, contentType string) bodySample {
+	if s.maxDecodeBytes > 0 && len(body) > s.maxDecodeBytes {
+		return s.samplePrefix(body)
+	}
+	if s.mode == sampleStructure {
+		if sample, err := s.sampleStructure(body); err == nil {
+			return sample
+		}
+	}
+	return s.samplePrefix(s.normalizer.NormalizeAs(body, contentType))
+}
+
+// samplePrefix keeps the first maxBytes bytes and the total length, so truncated or
+// grossly different bodies still mismatch
+func (s *bodySampler) samplePrefix(body []byte) bodySample {
+	prefix, tail := body, []byte(nil)
+	if len(body) > s.maxBytes {
+		prefix, tail = body[:s.maxBytes], body[s.maxBytes:]
+	}
+	sum := sha256.Sum256(tail)
+
+	data := make([]byte, 0, len(prefix)+24)
+	data = append(data, prefix...)
+	data = append(data, "\x00length="...)
+	data = strconv.AppendInt(data, int64(len(body)), 10)
+	return bodySample{data: data, tailHash: hex.EncodeToString(sum[:])}
+}
+
+// sampleStructure streams a JSON body, keeping scalars, object members and the first items
+// of every array. Later array items are reduced to their count and the sequence of their
+// shapes, so missing items or schema drift still mismatch without comparing every value.
+func (s *bodySampler) sampleStructure(body []byte) (bodySample, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var states []ignoreState
+	if s.normalizer != nil {
+		for _, steps := range s.normalizer.ignore {
+			states = append(states, ignoreState{steps: steps})
+		}
+	}
+
+	var out bytes.Buffer
+	tail := sha256.New()
+	if err := s.writeValue(dec, &out, tail, states); err != nil {
+		return bodySample{}, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return bodySample{}, errors.New("trailing data after JSON value")
+	}
+	return bodySample{data: out.Bytes(), tailHash: hex.EncodeToString(tail.Sum(nil))}, nil
+}
+
+// ignoreState is how far an ignored path matched the path of the value being sampled
+type ignoreState struct {
+	steps []jsonPathStep
+	next  int // Index of the first step not matched yet
+}
+
+// advanceIgnored returns the states of the ignored paths at an object member, or an array
+// item when index is not negative, and whether the value there is ignored itself. The
+// states follow removePath, a recursive step matching again at every depth.
+func advanceIgnored(states []ignoreState, key string, index int) ([]ignoreState, bool) {
+	var next []ignoreState
+	add := func(state ignoreState) {
+		for _, existing := range next {
+			if &existing.steps[0] == &state.steps[0] && existing.next == state.next {
+				return
+			}
+		}
+		next = append(next, state)
+	}
+
+	for _, state := range states {
+		step := state.steps[state.next]
+		if step.recursive {
+			add(state)
+		}
+		matches := step.index < 0 && (step.wildcard || step.key == key)
+		if index >= 0 {
+			matches = step.key == "" && (step.wildcard || step.index == index)
+		}
+		if !matches {
+			continue
+		}
+		if state.next+1 == len(state.steps) {
+			return nil, true
+		}
+		add(ignoreState{steps: state.steps, next: state.next + 1})
+	}
+	return next, false
+}
+
+// remainingIgnored returns the steps of the ignored paths left to match below a value
+func remainingIgnored(states []ignoreState) [][]jsonPathStep {
+	remaining := make([][]jsonPathStep, 0, len(states))
+	for _, state := range states {
+		remaining = append(remaining, state.steps[state.next:])
+	}
+	return remaining
+}
+
+// writeValue writes the sample of the next JSON value of the decoder. states track the
+// ignored paths, so values they select are left out like in a normalized body.
+func (s *bodySampler) writeValue(dec *json.Decoder, out *bytes.Buffer, tail hash.Hash, states []ignoreState) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		var members [][]byte
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			memberStates, ignored := advanceIgnored(states, key.(string), -1)
+			if ignored {
+				var skipped json.RawMessage
+				if err := dec.Decode(&skipped); err != nil {
+					return err
+				}
+				continue
+			}
+			var member bytes.Buffer
+			encoded, _ := json.Marshal(key)
+			member.Write(encoded)
+			member.WriteByte(':')
+			if err := s.writeValue(dec, &member, tail, memberStates); err != nil {
+				return err
+			}
+			members = append(members, member.Bytes())
+		}
+		if s.normalizer != nil && s.normalizer.sortKeys {
+			sort.Slice(members, func(i, j int) bool { return bytes.Compare(members[i], members[j]) < 0 })
+		}
+		out.WriteByte('{')
+		for _, member := range members {
+			out.Write(member)
+			out.WriteByte(',')
+		}
+		_, err := dec.Token()
+		out.WriteByte('}')
+		return err
+
+	case json.Delim('['):
+		out.WriteByte('[')
+		shapes := sha256.New()
+		count := 0
+		for ; dec.More(); count++ {
+			var item json.RawMessage
+			if err := dec.Decode(&item); err != nil {
+				return err
+			}
+			itemStates, ignored := advanceIgnored(states, "", count)
+			if ignored {
+				// Ignored items are blanked, as removePath does
+				item = json.RawMessage("null")
+			}
+			if count < s.items {
+				out.Write(s.normalizer.normalizeIgnoring(item, "", remainingIgnored(itemStates)))
+				out.WriteByte(',')
+				continue
+			}
+			tail.Write(item)
+			shape, err := jsonShape(item, remainingIgnored(itemStates))
+			if err != nil {
+				return err
+			}
+			shapes.Write(shape)
+			shapes.Write([]byte{0})
+		}
+		if count > s.items {
+			fmt.Fprintf(out, "...%d items, shapes %x", count, shapes.Sum(nil))
+		}
+		_, err := dec.Token()
+		out.WriteByte(']')
+		return err
+
+	default:
+		encoded, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		out.Write(encoded)
+		return nil
+	}
+}
+
+// jsonShape describes the structure of a JSON value without its values or the ignored
+// paths: object keys in sorted order with the shape of their values, the shape of an
+// array's first item, and the type of scalars
+func jsonShape(raw json.RawMessage, ignore [][]jsonPathStep) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	for _, steps := range ignore {
+		removePath(value, steps)
+	}
+	var out bytes.Buffer
+	writeShape(&out, value)
+	return out.Bytes(), nil
+}
+
+// writeShape writes the shape of a decoded JSON value
+func writeShape(out *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out.WriteByte('{')
+		for _, key := range keys {
+			out.WriteString(strconv.Quote(key))
+			out.WriteByte(':')
+			writeShape(out, v[key])
+			out.WriteByte(',')
+		}
+		out.WriteByte('}')
+	case []interface{}:
+		out.WriteByte('[')
+		if len(v) > 0 {
+			writeShape(out, v[0])
+		}
+		out.WriteByte(']')
+	case string:
+		out.WriteString("string")
+	case float64:
+		out.WriteString("number")
+	case bool:
+		out.WriteString("bool")
+	default:
+		out.WriteString("null")
+	}
+}
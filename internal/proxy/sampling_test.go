@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestBodySampler tests that sampled bodies ignore differences outside the sample but
+// still mismatch on gross differences
+func TestBodySampler(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      config.ComparisonSampling
+		normalize   config.NormalizeConfig
+		primary     string
+		shadow      string
+		wantMatch   bool
+		tailDiffers bool // The logged tail hashes of matching samples must differ
+	}{
+		{
+			name:        "prefix ignores the tail",
+			config:      config.ComparisonSampling{MaxBytes: 8, Mode: "prefix"},
+			primary:     "abcdefgh-tail-one",
+			shadow:      "abcdefgh-tail-two",
+			wantMatch:   true,
+			tailDiffers: true,
+		},
+		{
+			name:    "prefix detects a different length",
+			config:  config.ComparisonSampling{MaxBytes: 8, Mode: "prefix"},
+			primary: "abcdefgh-tail",
+			shadow:  "abcdefgh-truncated",
+		},
+		{
+			name:    "prefix detects a different start",
+			config:  config.ComparisonSampling{MaxBytes: 8, Mode: "prefix"},
+			primary: "abcdefgh-tail",
+			shadow:  "xbcdefgh-tail",
+		},
+		{
+			name:        "structure ignores values of later items",
+			config:      config.ComparisonSampling{MaxBytes: 8, Mode: "structure", SampleItems: 1},
+			primary:     `{"total":3,"items":[{"id":1},{"id":2},{"id":3}]}`,
+			shadow:      `{"total":3,"items":[{"id":1},{"id":7},{"id":9}]}`,
+			wantMatch:   true,
+			tailDiffers: true,
+		},
+		{
+			name:    "structure compares sampled items",
+			config:  config.ComparisonSampling{MaxBytes: 8, Mode: "structure", SampleItems: 1},
+			primary: `{"items":[{"id":1},{"id":2}]}`,
+			shadow:  `{"items":[{"id":5},{"id":2}]}`,
+		},
+		{
+			name:    "structure detects missing items",
+			config:  config.ComparisonSampling{MaxBytes: 8, Mode: "structure", SampleItems: 1},
+			primary: `{"items":[{"id":1},{"id":2},{"id":3}]}`,
+			shadow:  `{"items":[{"id":1},{"id":2}]}`,
+		},
+		{
+			name:    "structure detects schema drift in later items",
+			config:  config.ComparisonSampling{MaxBytes: 8, Mode: "structure", SampleItems: 1},
+			primary: `[{"id":1},{"id":2,"name":"a"}]`,
+			shadow:  `[{"id":1},{"id":2,"name":null}]`,
+		},
+		{
+			name:      "structure sorts keys when normalizing",
+			config:    config.ComparisonSampling{MaxBytes: 8, Mode: "structure", SampleItems: 1},
+			normalize: config.NormalizeConfig{SortKeys: true},
+			primary:   `{"a":1,"items":[{"x":1,"y":2}]}`,
+			shadow:    `{"items":[{"y":2,"x":1}],"a":1}`,
+			wantMatch: true,
+		},
+		{
+			name:      "prefix samples the normalized body",
+			config:    config.ComparisonSampling{MaxBytes: 8, Mode: "prefix", MaxDecodeBytes: 1024},
+			normalize: config.NormalizeConfig{SortKeys: true, IgnorePaths: []string{"$.ts"}},
+			primary:   `{"ts":1,"b":1,"a":2}`,
+			shadow:    `{"a":2,"b":1,"ts":2}`,
+			wantMatch: true,
+		},
+		{
+			name:      "structure ignores root paths at the root only",
+			config:    config.ComparisonSampling{MaxBytes: 8, Mode: "structure", SampleItems: 1},
+			normalize: config.NormalizeConfig{IgnorePaths: []string{"$.id"}},
+			primary:   `{"id":1,"items":[{"id":1}]}`,
+			shadow:    `{"id":2,"items":[{"id":1}]}`,
+			wantMatch: true,
+		},
+		{
+			name:      "structure compares item fields named like ignored root paths",
+			config:    config.ComparisonSampling{MaxBytes: 8, Mode: "structure", SampleItems: 1},
+			normalize: config.NormalizeConfig{IgnorePaths: []string{"$.id"}},
+			primary:   `{"items":[{"id":1}]}`,
+			shadow:    `{"items":[{"id":2}]}`,
+		},
+		{
+			name:        "structure ignores paths into items",
+			config:      config.ComparisonSampling{MaxBytes: 8, Mode: "structure", SampleItems: 1},
+			normalize:   config.NormalizeConfig{IgnorePaths: []string{"$.items[*].ts", "$..etag"}},
+			primary:     `{"items":[{"id":1,"ts":1,"etag":"a"},{"id":2,"ts":2}]}`,
+			shadow:      `{"items":[{"id":1,"ts":5},{"id":2}],"etag":"b"}`,
+			wantMatch:   true,
+			tailDiffers: true,
+		},
+		{
+			name:      "bodies past maxDecodeBytes are sampled as received",
+			config:    config.ComparisonSampling{MaxBytes: 8, Mode: "structure", SampleItems: 1, MaxDecodeBytes: 10},
+			normalize: config.NormalizeConfig{SortKeys: true},
+			primary:   `{"b":1,"a":2}`,
+			shadow:    `{"a":2,"b":1}`,
+		},
+		{
+			name:        "structure falls back to prefix for other bodies",
+			config:      config.ComparisonSampling{MaxBytes: 8, Mode: "structure"},
+			primary:     "<html>..one",
+			shadow:      "<html>..two",
+			wantMatch:   true,
+			tailDiffers: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizer, err := newBodyNormalizer(tt.normalize)
+			if err != nil {
+				t.Fatalf("Failed to create normalizer: %v", err)
+			}
+			sampler := newBodySampler(tt.config, normalizer)
+			if !sampler.Exceeds([]byte(tt.primary)) {
+				t.Fatalf("Expected %q to be sampled", tt.primary)
+			}
+
+			primary, shadow := sampler.Sample([]byte(tt.primary), ""), sampler.Sample([]byte(tt.shadow), "")
+			if match := bytes.Equal(primary.data, shadow.data); match != tt.wantMatch {
+				t.Errorf("Expected match=%v, got %v (%q vs %q)", tt.wantMatch, match, primary.data, shadow.data)
+			}
+			if tailDiffers := primary.tailHash != shadow.tailHash; tt.wantMatch && tailDiffers != tt.tailDiffers {
+				t.Errorf("Expected tail hashes to differ=%v, got %v", tt.tailDiffers, tailDiffers)
+			}
+		})
+	}
+
+	if newBodySampler(config.ComparisonSampling{}, nil).Exceeds([]byte("anything")) {
+		t.Error("Expected bodies to be compared in full without maxBytes")
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Kinds of schema drift
+const (
+	driftFieldAdded   = "field_added"
+	driftFieldMissing = "field_missing"
+	driftTypeChanged  = "type_changed"
+)
+
+// jsonField is a field of a JSON document's shape
+type jsonField struct {
+	kind   string // object, array, string, number, boolean or null
+	parent string // Path of the enclosing field, empty for the root
+}
+
+// schemaDriftDetector learns the shape of a route's JSON responses from the first
+// successful one it checks, and reports fields that appear, disappear or change type in
+// later successful responses. Error responses have shapes of their own, so they are not
+// checked. Each difference is reported once, so a lasting change does not flood the findings.
+type schemaDriftDetector struct {
+	mu       sync.Mutex
+	baseline map[string]jsonField // Nil until the first successful response is learned
+	reported map[string]bool      // Kind and path of differences already reported
+}
+
+// newSchemaDriftDetector creates a detector that has not learned a shape yet
+func newSchemaDriftDetector() *schemaDriftDetector {
+	return &schemaDriftDetector{reported: make(map[string]bool)}
+}
+
+// Process implements responseProcessor. Non-2xx responses and bodies that are not JSON
+// are skipped.
+func (d *schemaDriftDetector) Process(status int, body []byte, contentType string) []processorFinding {
+	if status < 200 || status > 299 {
+		return nil
+	}
+	document, err := jsonCodec{}.Decode(body)
+	if err != nil {
+		return nil
+	}
+	shape := make(map[string]jsonField)
+	documentFields(document, "$", "", shape)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.baseline == nil {
+		d.baseline = shape
+		return nil
+	}
+
+	var findings []processorFinding
+	report := func(kind string, path string) {
+		if !d.reported[kind+" "+path] {
+			d.reported[kind+" "+path] = true
+			findings = append(findings, processorFinding{Kind: kind, Path: path})
+		}
+	}
+	for path, field := range shape {
+		learned, ok := d.baseline[path]
+		switch {
+		case !ok:
+			// Only the outermost added field is reported, its members come with it
+			if _, parentKnown := d.baseline[field.parent]; field.parent == "" || parentKnown {
+				report(driftFieldAdded, path)
+			}
+		case learned.kind != field.kind && learned.kind != "null" && field.kind != "null":
+			report(driftTypeChanged, path)
+		}
+	}
+	for path, field := range d.baseline {
+		// Array items are absent from empty arrays, which is not drift
+		if _, ok := shape[path]; ok || strings.HasSuffix(path, "[*]") {
+			continue
+		}
+		if _, parentSeen := shape[field.parent]; field.parent == "" || parentSeen {
+			report(driftFieldMissing, path)
+		}
+	}
+	return findings
+}
+
+// documentFields records the kind of every field of a decoded document by JSONPath. The
+// items of an array share the path of the array followed by [*].
+func documentFields(node interface{}, path string, parent string, shape map[string]jsonField) {
+	field := jsonField{parent: parent}
+	switch value := node.(type) {
+	case map[string]interface{}:
+		field.kind = "object"
+		for key, member := range value {
+			documentFields(member, memberPath(path, key), path, shape)
+		}
+	case []interface{}:
+		field.kind = "array"
+		for _, item := range value {
+			documentFields(item, path+"[*]", path, shape)
+		}
+	case string:
+		field.kind = "string"
+	case json.Number:
+		field.kind = "number"
+	case bool:
+		field.kind = "boolean"
+	default:
+		field.kind = "null"
+	}
+
+	// Items of differing kinds keep the first, items of objects merge their members
+	if _, ok := shape[path]; !ok {
+		shape[path] = field
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestSchemaDriftDetector tests that fields appearing, disappearing or changing type are
+// reported once against the first successful response's shape, and that error responses
+// are neither learned nor checked
+func TestSchemaDriftDetector(t *testing.T) {
+	detector := newSchemaDriftDetector()
+	if findings := detector.Process(http.StatusInternalServerError, []byte(`{"error":"unavailable"}`), "application/json"); findings != nil {
+		t.Fatalf("Expected the error response to be skipped, got %v", findings)
+	}
+	if findings := detector.Process(http.StatusOK, []byte(`{"id":1,"name":"a","tags":["x"],"address":{"city":"b"},"note":null}`), "application/json"); findings != nil {
+		t.Fatalf("Expected the first successful response to be learned, got %v", findings)
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []string
+	}{
+		{name: "same shape", status: http.StatusOK, body: `{"id":2,"name":"c","tags":[],"address":{"city":"d"},"note":"n"}`, want: nil},
+		{name: "error response", status: http.StatusNotFound, body: `{"error":"not found"}`, want: nil},
+		{name: "drift", status: http.StatusCreated, body: `{"id":"3","name":"e","tags":["y"],"email":{"primary":"f"},"note":null}`,
+			want: []string{"field_added $.email", "field_missing $.address", "type_changed $.id"}},
+		{name: "reported once", status: http.StatusOK, body: `{"id":"4","name":"g","tags":["z"],"note":null}`, want: nil},
+		{name: "not JSON", status: http.StatusOK, body: `<html>`, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, finding := range detector.Process(tt.status, []byte(tt.body), "application/json") {
+				got = append(got, finding.Kind+" "+finding.Path)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected findings %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and its key as PEM
+// files, returning their paths and the certificate
+func writeTestCertificate(t *testing.T) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "conductor.test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile, certificate
+}
+
+// TestServerTLS tests serving HTTPS with the configured certificate and oldest version
+func TestServerTLS(t *testing.T) {
+	certFile, keyFile, certificate := writeTestCertificate(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+
+	tests := []struct {
+		name       string
+		minVersion string
+		clientMax  uint16
+		wantErr    bool
+	}{
+		{name: "TLS 1.3 client", minVersion: "1.2", clientMax: tls.VersionTLS13},
+		{name: "TLS 1.2 client", minVersion: "1.2", clientMax: tls.VersionTLS12},
+		{name: "TLS 1.2 client refused", minVersion: "1.3", clientMax: tls.VersionTLS12, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := NewServerTLSConfig(config.TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: tt.minVersion})
+			if err != nil {
+				t.Fatalf("Failed to build TLS config: %v", err)
+			}
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}))
+			server.TLS = tlsConfig
+			server.StartTLS()
+			defer server.Close()
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MaxVersion: tt.clientMax}}}
+			resp, err := client.Get(server.URL)
+			if tt.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("Expected the handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.TLS == nil || resp.TLS.Version != tt.clientMax {
+				t.Errorf("Expected TLS version %x, got %+v", tt.clientMax, resp.TLS)
+			}
+		})
+	}
+
+	if tlsConfig, err := NewServerTLSConfig(config.TLSConfig{}); tlsConfig != nil || err != nil {
+		t.Errorf("Expected plain HTTP without a certificate, got %v %v", tlsConfig, err)
+	}
+	if _, err := NewServerTLSConfig(config.TLSConfig{CertFile: keyFile, KeyFile: certFile}); err == nil {
+		t.Error("Expected an error for a mismatched certificate and key")
+	}
+}
+
+// TestHTTPSRedirect tests that plain HTTP requests are redirected to the HTTPS listener
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name   string
+		listen string
+		host   string
+		want   string
+	}{
+		{name: "default port", listen: ":443", host: "example.com", want: "https://example.com/api/items?page=2"},
+		{name: "other port", listen: ":8443", host: "example.com:8080", want: "https://example.com:8443/api/items?page=2"},
+		{name: "IPv6 host", listen: "[::]:8443", host: "[::1]", want: "https://[::1]:8443/api/items?page=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/items?page=2", nil)
+			req.Host = tt.host
+			recorder := httptest.NewRecorder()
+			HTTPSRedirectHandler(tt.listen).ServeHTTP(recorder, req)
+			if recorder.Code != http.StatusPermanentRedirect || recorder.Header().Get("Location") != tt.want {
+				t.Errorf("Expected a permanent redirect to %s, got %d %s", tt.want, recorder.Code, recorder.Header().Get("Location"))
+			}
+		})
+	}
+}
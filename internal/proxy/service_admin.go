@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Runtime service changes made through the admin endpoints
+const (
+	serviceActionEnable  = "enable"
+	serviceActionDisable = "disable"
+	serviceActionPrimary = "primary"
+)
+
+// errUnknownService is returned for admin changes naming a service that is not configured
+var errUnknownService = errors.New("unknown service")
+
+// disabledService is a service taken out of routing at runtime
+type disabledService struct {
+	config   config.Service
+	position int // Index among the services when it was disabled, so route precedence is restored
+}
+
+// serviceOverrides holds the services disabled at runtime, so they can be enabled again
+type serviceOverrides struct {
+	mu       sync.Mutex // Serializes runtime changes, each reading and replacing the services
+	disabled map[string]disabledService
+}
+
+// newServiceOverrides creates an empty set of runtime changes
+func newServiceOverrides() *serviceOverrides {
+	return &serviceOverrides{disabled: make(map[string]disabledService)}
+}
+
+// changeServices applies a runtime change to the routed services. The changed services
+// are validated like a configuration file and applied as a reload, so they last until
+// the next reload or restart. Changes apply to frozen routes too, as they are made by hand.
+func (c *Conductor) changeServices(action string, name string) error {
+	o := c.serviceOverrides
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Hold the reload lock from reading the served services to applying the change, so a
+	// reload of the configuration file in between is not overwritten
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	served := *c.servedConfig()
+	services := append([]config.Service(nil), served.Services...)
+	index := -1
+	for i, service := range services {
+		if service.Name == name {
+			index = i
+		}
+	}
+
+	switch action {
+	case serviceActionEnable:
+		disabled, ok := o.disabled[name]
+		if !ok {
+			if index >= 0 {
+				return nil
+			}
+			return errUnknownService
+		}
+		if index >= 0 {
+			// A reload added the service back
+			delete(o.disabled, name)
+			return nil
+		}
+		position := min(disabled.position, len(services))
+		services = append(services[:position], append([]config.Service{disabled.config}, services[position:]...)...)
+
+	case serviceActionDisable:
+		if index < 0 {
+			if _, ok := o.disabled[name]; ok {
+				return nil
+			}
+			return errUnknownService
+		}
+		services = append(services[:index], services[index+1:]...)
+
+	case serviceActionPrimary:
+		if index < 0 {
+			return errUnknownService
+		}
+		// The service replaces the primary of the services sharing its route and predicates
+		kind, pattern := routeKind(services[index])
+		match := services[index].MatchCondition()
+		for i := range services {
+			if k, p := routeKind(services[i]); k == kind && p == pattern && services[i].MatchCondition() == match {
+				services[i].Primary = false
+			}
+		}
+		services[index].Primary = true
+
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+
+	next := served
+	next.Services = services
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if err := c.reloadLocked(&next, false, snapshotAdmin); err != nil {
+		return err
+	}
+
+	switch action {
+	case serviceActionEnable:
+		delete(o.disabled, name)
+	case serviceActionDisable:
+		o.disabled[name] = disabledService{config: served.Services[index], position: index}
+	}
+	return nil
+}
+
+// routeStatus describes a route and the services it reaches
+type routeStatus struct {
+	Route             string          `json:"route"`
+	Kind              string          `json:"kind"`    // exact, regex, prefix or path
+	Pattern           string          `json:"pattern"` // Path, prefix or regular expression matched
+	FrozenSince       *time.Time      `json:"frozen_since,omitempty"`
+	AdaptiveTimeoutMs int64           `json:"adaptive_timeout_ms,omitempty"` // Attempt timeout of the primaries once adapted
+	Services          []serviceStatus `json:"services"`
+}
+
+// serviceStatus describes a routed or disabled service
+type serviceStatus struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Primary bool   `json:"primary"`
+	Mirror  bool   `json:"mirror,omitempty"`
+	Match   string `json:"match,omitempty"` // Predicates selecting the service, empty if it takes every request
+	Route   string `json:"route,omitempty"` // Only set for disabled services
+}
+
+// routesStatus is the response body of the routes admin endpoints
+type routesStatus struct {
+	Routes   []routeStatus   `json:"routes"`
+	Disabled []serviceStatus `json:"disabled"`
+}
+
+// routesStatus lists the routed services by route, in configuration order, and the
+// services disabled at runtime
+func (c *Conductor) routesStatus() routesStatus {
+	status := routesStatus{Routes: []routeStatus{}, Disabled: []serviceStatus{}}
+	index := make(map[string]int)
+	routed := make(map[string]bool)
+	for _, svc := range c.currentServices() {
+		routed[svc.Name] = true
+		kind, pattern := routeKind(svc.Config)
+		i, ok := index[svc.Route]
+		if !ok {
+			i = len(status.Routes)
+			index[svc.Route] = i
+			status.Routes = append(status.Routes, routeStatus{Route: svc.Route, Kind: kind, Pattern: pattern})
+			if freeze, ok := c.freezes.Frozen(svc.Route); ok {
+				status.Routes[i].FrozenSince = &freeze.since
+			}
+			status.Routes[i].AdaptiveTimeoutMs = c.adaptiveTimeouts.Timeout(svc.Route).Milliseconds()
+		}
+		status.Routes[i].Services = append(status.Routes[i].Services, newServiceStatus(svc.Config))
+	}
+
+	c.serviceOverrides.mu.Lock()
+	defer c.serviceOverrides.mu.Unlock()
+	for name, disabled := range c.serviceOverrides.disabled {
+		if routed[name] {
+			// A reload added the service back
+			continue
+		}
+		service := newServiceStatus(disabled.config)
+		service.Route = routeName(disabled.config)
+		status.Disabled = append(status.Disabled, service)
+	}
+	sort.Slice(status.Disabled, func(i, j int) bool { return status.Disabled[i].Name < status.Disabled[j].Name })
+	return status
+}
+
+// newServiceStatus describes a service's configuration
+func newServiceStatus(svcConfig config.Service) serviceStatus {
+	return serviceStatus{
+		Name:    svcConfig.Name,
+		URL:     svcConfig.URL,
+		Primary: svcConfig.Primary,
+		Mirror:  svcConfig.Mirror,
+		Match:   svcConfig.MatchCondition(),
+	}
+}
+
+// RoutesHandler creates an admin handler listing the routes, the services they reach and
+// the services disabled at runtime
+func RoutesHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+		c.writeRoutesStatus(w)
+	}
+}
+
+// ServiceControlHandler creates an admin handler applying a runtime change to the service
+// named in the "service" query parameter: enabling, disabling or making it its route's
+// primary, or setting the weight given in the "weight" query parameter
+func ServiceControlHandler(c *Conductor, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodPost) {
+			return
+		}
+
+		name := r.URL.Query().Get("service")
+		if name == "" {
+			http.Error(w, "Missing service parameter", http.StatusBadRequest)
+			return
+		}
+		if err := c.changeServices(action, name); err != nil {
+			status := http.StatusConflict
+			if errors.Is(err, errUnknownService) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, fmt.Sprintf("Failed to %s service %s: %v", action, name, err), status)
+			return
+		}
+
+		logger.InfoWithFields("Changed service at runtime", map[string]interface{}{
+			"action":      action,
+			"service":     name,
+			"remote_addr": r.RemoteAddr,
+		})
+		c.writeRoutesStatus(w)
+	}
+}
+
+// writeRoutesStatus writes the routes and disabled services as JSON
+func (c *Conductor) writeRoutesStatus(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.routesStatus()); err != nil {
+		http.Error(w, "Failed to encode routes: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestServiceControl tests listing routes and changing services at runtime through the
+// admin endpoints, authenticated with basic auth
+func TestServiceControl(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: "http://primary.example.com", PathPrefix: "/api", Primary: true},
+			{Name: "api-v2", URL: "http://v2.example.com", PathPrefix: "/api"},
+			{Name: "web", URL: "http://web.example.com", PathPrefix: "/", Primary: true},
+			{Name: "web-shadow", URL: "http://shadow.example.com", PathPrefix: "/", Mirror: true},
+		},
+		Admin: config.AdminConfig{Enabled: true, Endpoint: "/admin", Username: "ops", Password: "secret"},
+	}
+	conductor := NewConductor(cfg)
+	transport := &countingTransport{counts: make(map[string]int)}
+	conductor.client = &http.Client{Transport: transport}
+
+	mux := http.NewServeMux()
+	SetupAdminEndpoints(mux, conductor)
+
+	admin := func(method string, target string) (*httptest.ResponseRecorder, routesStatus) {
+		req := httptest.NewRequest(method, target, nil)
+		req.SetBasicAuth("ops", "secret")
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		var status routesStatus
+		if recorder.Code == http.StatusOK {
+			if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+				t.Fatalf("Failed to decode routes: %v", err)
+			}
+		}
+		return recorder, status
+	}
+	primaryOf := func(status routesStatus, route string) string {
+		for _, r := range status.Routes {
+			if r.Route != route {
+				continue
+			}
+			for _, service := range r.Services {
+				if service.Primary {
+					return service.Name
+				}
+			}
+		}
+		return ""
+	}
+
+	// Credentials are required, and challenged for
+	req := httptest.NewRequest("GET", "/admin/routes", nil)
+	req.SetBasicAuth("ops", "wrong")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnauthorized || recorder.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("Expected a 401 challenge for wrong credentials, got %d", recorder.Code)
+	}
+
+	recorder, status := admin("GET", "/admin/routes")
+	if recorder.Code != http.StatusOK || len(status.Routes) != 2 || primaryOf(status, "/api") != "api" {
+		t.Fatalf("Expected routes /api and / with api as primary, got %d %+v", recorder.Code, status)
+	}
+
+	// Making a service primary demotes the route's previous primary
+	_, status = admin("POST", "/admin/services/primary?service=api-v2")
+	if primaryOf(status, "/api") != "api-v2" {
+		t.Fatalf("Expected api-v2 as primary, got %+v", status)
+	}
+	conductor.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users", nil))
+	if transport.count("v2.example.com") != 1 {
+		t.Errorf("Expected the request to reach the new primary")
+	}
+
+	// Disabled services stop receiving requests until enabled again
+	_, status = admin("POST", "/admin/services/disable?service=api")
+	if len(status.Disabled) != 1 || status.Disabled[0].Name != "api" || status.Disabled[0].Route != "/api" {
+		t.Fatalf("Expected api to be listed as disabled, got %+v", status.Disabled)
+	}
+	conductor.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users", nil))
+	if transport.count("primary.example.com") != 1 {
+		t.Errorf("Expected only the mirror request sent before api was disabled, got %d", transport.count("primary.example.com"))
+	}
+	_, status = admin("POST", "/admin/services/enable?service=api")
+	if len(status.Disabled) != 0 || len(status.Routes[0].Services) != 2 || status.Routes[0].Services[0].Name != "api" {
+		t.Fatalf("Expected api back in its place, got %+v", status)
+	}
+
+	// Changes are refused like the configuration they would result in
+	if recorder, _ := admin("POST", "/admin/services/primary?service=web-shadow"); recorder.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when making a mirror primary, got %d", recorder.Code)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{name: "wrong method", method: "GET", target: "/admin/services/disable?service=web", wantStatus: http.StatusMethodNotAllowed},
+		{name: "missing service", method: "POST", target: "/admin/services/disable", wantStatus: http.StatusBadRequest},
+		{name: "unknown service", method: "POST", target: "/admin/services/disable?service=nope", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if recorder, _ := admin(tt.method, tt.target); recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
@@ -2,44 +2,62 @@ package proxy
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"reflect"
+	"regexp"
+	"time"
 
 	"github.com/zeek-r/go-conductor/internal/config"
-	"github.com/zeek-r/go-conductor/internal/logger"
 )
 
 // Service represents a backend service with its configuration
 type Service struct {
-	Name    string
-	URL     *url.URL
-	Path    string
-	Primary bool
-	Config  config.Service
+	Name         string
+	URL          *url.URL
+	Path         string
+	Primary      bool
+	Route        string // Route name used in metric labels
+	Config       config.Service
+	pathRegex    *regexp.Regexp     // Pattern the whole request path must match, nil if not routed by regex
+	client       *http.Client       // Dedicated client when the service overrides the egress proxy
+	recycler     *connRecycler      // Retires keep-alive connections past their limits, nil to keep them
+	retries      *retryPolicy       // Failed attempts repeated, nil if the service does not retry
+	health       *backendHealth     // Passive health tracking, nil if not tracked
+	checks       *checkHistory      // Recent active health check results, nil without a health check
+	headers      *headerFilter      // Client headers forwarded to the service, nil to forward all
+	variables    *variableExtractor // Request-scoped template variables, nil if none are declared
+	listeners    map[string]bool    // Listeners the service is served on, nil for all
+	match        bodyMatch          // Predicate over JSON body fields, nil if the service is unconditional
+	requestMatch *requestMatch      // Predicate over request headers and cookies, nil if the service is unconditional
+	credentials  *tokenSource       // Token sent to the service, nil if it requires none
 }
 
 // serviceResult holds the result from a service request
 type serviceResult struct {
-	service *Service
-	resp    *http.Response
-	body    []byte
-	err     error
+	service  *Service
+	resp     *http.Response
+	body     []byte
+	stream   io.ReadCloser // Unread body streamed to the client instead of body, nil if buffered
+	drained  bool          // The body was discarded, so the response cannot be compared or served
+	partial  bool          // Selected when the deadline expired before the primary responded
+	duration time.Duration // Time the service took to respond, zero if not requested from it
+	cache    string        // Result of the response cache lookup that produced it, empty if the cache was not used
+	err      error
 }
 
-// initializeServices sets up service routing based on configuration
-func (c *Conductor) initializeServices(servicesConfig []config.Service) {
+// initializeServices sets up service routing based on configuration. Services of a previous
+// configuration with the same name keep their health state, and are reused as they are if
+// their configuration did not change.
+func (c *Conductor) initializeServices(servicesConfig []config.Service, previous map[string]*Service) error {
 	for i, svcConfig := range servicesConfig {
-		targetURL, err := url.Parse(svcConfig.URL)
-		if err != nil {
-			logger.Fatal(fmt.Sprintf("Invalid target URL %s", svcConfig.URL), err)
-		}
-
-		service := &Service{
-			Name:    svcConfig.Name,
-			URL:     targetURL,
-			Path:    svcConfig.Path,
-			Primary: svcConfig.Primary,
-			Config:  svcConfig,
+		service, ok := previous[svcConfig.Name]
+		if !ok || !reflect.DeepEqual(service.Config, svcConfig) {
+			var err error
+			if service, err = c.newService(svcConfig, service); err != nil {
+				return err
+			}
 		}
 
 		c.services[i] = service
@@ -48,6 +66,8 @@ func (c *Conductor) initializeServices(servicesConfig []config.Service) {
 		if svcConfig.PathExact != "" {
 			c.routesByExact[svcConfig.PathExact] = append(
 				c.routesByExact[svcConfig.PathExact], service)
+		} else if svcConfig.PathRegex != "" {
+			c.addRegexRoute(service)
 		} else if svcConfig.PathPrefix != "" {
 			c.routesByPrefix[svcConfig.PathPrefix] = append(
 				c.routesByPrefix[svcConfig.PathPrefix], service)
@@ -56,6 +76,91 @@ func (c *Conductor) initializeServices(servicesConfig []config.Service) {
 				c.routesByPath[svcConfig.Path], service)
 		}
 	}
+	return nil
+}
+
+// newService creates the service of a configuration, carrying over the health state of
+// the service it replaces, if any
+func (c *Conductor) newService(svcConfig config.Service, replaced *Service) (*Service, error) {
+	pathRegex, err := compilePathRegex(svcConfig.PathRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path regex for service %s: %w", svcConfig.Name, err)
+	}
+
+	variables, err := newVariableExtractor(svcConfig, pathRegex, c.config.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid variables for service %s: %w", svcConfig.Name, err)
+	}
+
+	var match bodyMatch
+	if svcConfig.Match != "" {
+		if match, err = parseBodyMatch(svcConfig.Match); err != nil {
+			return nil, fmt.Errorf("invalid match predicate for service %s: %w", svcConfig.Name, err)
+		}
+	}
+
+	// Templated URLs are resolved per request; the defaults stand in for health checks and labels
+	targetURL, err := url.Parse(expandTemplate(svcConfig.URL, variables.Defaults(), nil))
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL %s: %w", svcConfig.URL, err)
+	}
+
+	client, err := newServiceClient(svcConfig, c.transport, c.dnsCache, c.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transport for service %s: %w", svcConfig.Name, err)
+	}
+
+	service := &Service{
+		Name:         svcConfig.Name,
+		URL:          targetURL,
+		Path:         svcConfig.Path,
+		Primary:      svcConfig.Primary,
+		Route:        routeName(svcConfig),
+		Config:       svcConfig,
+		pathRegex:    pathRegex,
+		client:       client,
+		recycler:     newConnRecycler(svcConfig.Dial),
+		retries:      newRetryPolicy(svcConfig),
+		headers:      newHeaderFilter(svcConfig.ForwardHeaders, svcConfig.DropHeaders),
+		variables:    variables,
+		listeners:    newListenerSet(svcConfig.Listeners),
+		match:        match,
+		requestMatch: newRequestMatch(svcConfig.MatchHeaders, svcConfig.MatchCookies),
+	}
+	if svcConfig.Credentials != nil {
+		service.credentials = newTokenSource(svcConfig.Name, *svcConfig.Credentials)
+	}
+	if replaced != nil {
+		service.health = replaced.health
+		if reflect.DeepEqual(replaced.Config.HealthCheck, svcConfig.HealthCheck) {
+			service.checks = replaced.checks
+		}
+		// Keep the token obtained for unchanged credentials
+		if replaced.credentials != nil && reflect.DeepEqual(replaced.Config.Credentials, svcConfig.Credentials) {
+			service.credentials = replaced.credentials
+		}
+	}
+	if service.health == nil && c.config.Health.FailureThreshold > 0 {
+		service.health = newBackendHealth(c.config.Health.FailureThreshold,
+			time.Duration(c.config.Health.RetryAfter)*time.Second)
+	}
+	return service, nil
+}
+
+// routeName returns the configured route name for a service, defaulting to its path pattern
+func routeName(svcConfig config.Service) string {
+	switch {
+	case svcConfig.Route != "":
+		return svcConfig.Route
+	case svcConfig.PathExact != "":
+		return svcConfig.PathExact
+	case svcConfig.PathRegex != "":
+		return svcConfig.PathRegex
+	case svcConfig.PathPrefix != "":
+		return svcConfig.PathPrefix
+	default:
+		return svcConfig.Path
+	}
 }
 
 // Helper function to get a list of service names
@@ -65,4 +170,36 @@ func getServiceNames(services []*Service) []string {
 		names[i] = svc.Name
 	}
 	return names
-} 
\ No newline at end of file
+}
+
+// isSafeMethod reports whether a method can be mirrored without risk of duplicate writes
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// filterForMethod drops non-primary services that have not opted in to receiving
+// non-idempotent requests. If no primary service matched, only the first service
+// receives the request so that a write is never performed twice.
+func filterForMethod(services []*Service, method string) []*Service {
+	if isSafeMethod(method) {
+		return services
+	}
+
+	var filtered []*Service
+	for _, svc := range services {
+		if svc.Primary || svc.Config.MirrorUnsafeMethods {
+			filtered = append(filtered, svc)
+		}
+	}
+
+	if len(filtered) == 0 && len(services) > 0 {
+		filtered = services[:1]
+	}
+
+	return filtered
+}
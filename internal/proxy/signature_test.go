@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// hmacHex returns the hex HMAC-SHA256 of a message
+func hmacHex(secret string, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TestSignatureVerifier tests the supported signature schemes
+func TestSignatureVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	stamp := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	body := `{"event":"push"}`
+
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	edSignature := hex.EncodeToString(ed25519.Sign(privateKey, []byte(stamp+body)))
+
+	tests := []struct {
+		name    string
+		config  config.SignatureConfig
+		header  map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "github",
+			config: config.SignatureConfig{Scheme: "github", Secret: "s3cret", Header: "X-Hub-Signature-256"},
+			header: map[string]string{"X-Hub-Signature-256": "sha256=" + hmacHex("s3cret", body)},
+		},
+		{
+			name:    "github wrong secret",
+			config:  config.SignatureConfig{Scheme: "github", Secret: "s3cret", Header: "X-Hub-Signature-256"},
+			header:  map[string]string{"X-Hub-Signature-256": "sha256=" + hmacHex("other", body)},
+			wantErr: true,
+		},
+		{
+			name:    "github missing header",
+			config:  config.SignatureConfig{Scheme: "github", Secret: "s3cret", Header: "X-Hub-Signature-256"},
+			wantErr: true,
+		},
+		{
+			name:   "stripe with rolled secret",
+			config: config.SignatureConfig{Scheme: "stripe", Secret: "whsec", Header: "Stripe-Signature", Tolerance: 300},
+			header: map[string]string{"Stripe-Signature": "t=" + stamp + ",v1=" + hmacHex("old", stamp+"."+body) + ",v1=" + hmacHex("whsec", stamp+"."+body)},
+		},
+		{
+			name:    "stripe replayed",
+			config:  config.SignatureConfig{Scheme: "stripe", Secret: "whsec", Header: "Stripe-Signature", Tolerance: 300},
+			header:  map[string]string{"Stripe-Signature": "t=" + stale + ",v1=" + hmacHex("whsec", stale+"."+body)},
+			wantErr: true,
+		},
+		{
+			name:   "hmac base64",
+			config: config.SignatureConfig{Scheme: "hmac", Secret: "key", Header: "X-Signature"},
+			header: map[string]string{"X-Signature": func() string {
+				raw, _ := hex.DecodeString(hmacHex("key", body))
+				return base64.StdEncoding.EncodeToString(raw)
+			}()},
+		},
+		{
+			name:   "hmac with timestamp",
+			config: config.SignatureConfig{Scheme: "hmac", Secret: "key", Header: "X-Signature", TimestampHeader: "X-Timestamp", Tolerance: 300},
+			header: map[string]string{"X-Signature": hmacHex("key", stamp+"."+body), "X-Timestamp": stamp},
+		},
+		{
+			name:   "ed25519 with timestamp",
+			config: config.SignatureConfig{Scheme: "ed25519", PublicKey: hex.EncodeToString(publicKey), Header: "X-Signature-Ed25519", TimestampHeader: "X-Signature-Timestamp", Tolerance: 300},
+			header: map[string]string{"X-Signature-Ed25519": edSignature, "X-Signature-Timestamp": stamp},
+		},
+		{
+			name:    "ed25519 tampered timestamp",
+			config:  config.SignatureConfig{Scheme: "ed25519", PublicKey: hex.EncodeToString(publicKey), Header: "X-Signature-Ed25519", TimestampHeader: "X-Signature-Timestamp", Tolerance: 300},
+			header:  map[string]string{"X-Signature-Ed25519": edSignature, "X-Signature-Timestamp": strconv.FormatInt(now.Unix()+1, 10)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := newSignatureVerifier(tt.config)
+			if err != nil {
+				t.Fatalf("Failed to create verifier: %v", err)
+			}
+			verifier.now = func() time.Time { return now }
+
+			header := http.Header{}
+			for name, value := range tt.header {
+				header.Set(name, value)
+			}
+			if err := verifier.Verify(header, []byte(body)); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestSignedRoute tests that forged requests to a signed route never reach the backend
+func TestSignedRoute(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "hooks", URL: "http://hooks.example.com", PathPrefix: "/hooks", Primary: true},
+		},
+		Signatures: []config.SignatureConfig{{Route: "/hooks", Scheme: "github", Secret: "s3cret", Header: "X-Hub-Signature-256"}},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	body := `{"action":"opened"}`
+	tests := []struct {
+		name         string
+		signature    string
+		wantStatus   int
+		wantUpstream int
+	}{
+		{name: "forged", signature: "sha256=" + hmacHex("guess", body), wantStatus: 401, wantUpstream: 0},
+		{name: "valid", signature: "sha256=" + hmacHex("s3cret", body), wantStatus: 200, wantUpstream: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com/hooks/github", strings.NewReader(body))
+			req.Header.Set("X-Hub-Signature-256", tt.signature)
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if tt.wantStatus == 401 && !strings.Contains(recorder.Body.String(), ErrCodeInvalidSignature) {
+				t.Errorf("Expected %s error code, got %s", ErrCodeInvalidSignature, recorder.Body.String())
+			}
+			if len(transport.requests) != tt.wantUpstream {
+				t.Errorf("Expected %d backend requests, got %d", tt.wantUpstream, len(transport.requests))
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// sloWindowBuckets is the number of sub-windows a rolling window is divided into.
+// Samples age out one sub-window at a time.
+const sloWindowBuckets = 10
+
+// sloBucket holds the samples for one sub-window of a route
+type sloBucket struct {
+	start  time.Time
+	digest *tdigest
+	total  int64
+	bad    int64
+}
+
+// routeWindow tracks a route's latency and good/bad request counts over a rolling window
+type routeWindow struct {
+	target  *config.SLOTarget // Nil if the route has no SLO
+	buckets [sloWindowBuckets]sloBucket
+}
+
+// sloTracker computes rolling latency percentiles and SLO burn rates per route
+type sloTracker struct {
+	mu             sync.Mutex
+	window         time.Duration
+	bucketDuration time.Duration
+	routes         map[string]*routeWindow
+	targets        map[string]*config.SLOTarget
+	now            func() time.Time
+}
+
+// RouteSLO is the rolling latency and SLO status of a single route
+type RouteSLO struct {
+	Route           string   `json:"route"`
+	Requests        int64    `json:"requests"`
+	BadRequests     int64    `json:"bad_requests"`
+	P50Ms           float64  `json:"p50_ms"`
+	P95Ms           float64  `json:"p95_ms"`
+	P99Ms           float64  `json:"p99_ms"`
+	Objective       float64  `json:"objective,omitempty"`
+	LatencyMs       int      `json:"latency_ms,omitempty"`
+	BurnRate        *float64 `json:"burn_rate,omitempty"`
+	BudgetExhausted bool     `json:"budget_exhausted,omitempty"`
+}
+
+// SLOReport is the JSON document served by the SLO endpoint
+type SLOReport struct {
+	WindowSeconds float64    `json:"window_seconds"`
+	Routes        []RouteSLO `json:"routes"`
+}
+
+// newSLOTracker creates a tracker for the given configuration
+func newSLOTracker(cfg config.SLOConfig) *sloTracker {
+	window := time.Duration(cfg.Window) * time.Second
+	t := &sloTracker{
+		window:         window,
+		bucketDuration: window / sloWindowBuckets,
+		routes:         make(map[string]*routeWindow),
+		targets:        make(map[string]*config.SLOTarget),
+		now:            time.Now,
+	}
+	for i := range cfg.Targets {
+		t.targets[cfg.Targets[i].Route] = &cfg.Targets[i]
+	}
+	return t
+}
+
+// Record adds a completed request to the route's rolling window. A request counts
+// against the SLO if it failed with a 5xx status or exceeded the latency target.
+func (t *sloTracker) Record(route string, status int, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rw, ok := t.routes[route]
+	if !ok {
+		rw = &routeWindow{target: t.targets[route]}
+		t.routes[route] = rw
+	}
+
+	now := t.now()
+	start := now.Truncate(t.bucketDuration)
+	bucket := &rw.buckets[(start.UnixNano()/int64(t.bucketDuration))%sloWindowBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = sloBucket{start: start, digest: newTDigest(defaultCompression)}
+	}
+
+	bucket.digest.Add(float64(duration) / float64(time.Millisecond))
+	bucket.total++
+	if status >= 500 || (rw.target != nil && rw.target.LatencyMs > 0 &&
+		duration > time.Duration(rw.target.LatencyMs)*time.Millisecond) {
+		bucket.bad++
+	}
+}
+
+// Snapshot returns the current status of every route, sorted by route name
+func (t *sloTracker) Snapshot() SLOReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := SLOReport{WindowSeconds: t.window.Seconds(), Routes: []RouteSLO{}}
+	cutoff := t.now().Add(-t.window)
+	for route, rw := range t.routes {
+		digest := newTDigest(defaultCompression)
+		status := RouteSLO{Route: route}
+		for i := range rw.buckets {
+			bucket := &rw.buckets[i]
+			if bucket.digest == nil || !bucket.start.After(cutoff) {
+				continue
+			}
+			digest.Merge(bucket.digest)
+			status.Requests += bucket.total
+			status.BadRequests += bucket.bad
+		}
+
+		status.P50Ms = digest.Quantile(0.5)
+		status.P95Ms = digest.Quantile(0.95)
+		status.P99Ms = digest.Quantile(0.99)
+
+		// Burn rate is the observed bad fraction relative to the allowed error budget,
+		// so 1 means the budget is spent exactly over the SLO period
+		if rw.target != nil {
+			status.Objective = rw.target.Objective
+			status.LatencyMs = rw.target.LatencyMs
+			var burnRate float64
+			if status.Requests > 0 {
+				badFraction := float64(status.BadRequests) / float64(status.Requests)
+				burnRate = badFraction / (1 - rw.target.Objective)
+			}
+			status.BurnRate = &burnRate
+			status.BudgetExhausted = burnRate > 1
+		}
+
+		report.Routes = append(report.Routes, status)
+	}
+
+	sort.Slice(report.Routes, func(i, j int) bool { return report.Routes[i].Route < report.Routes[j].Route })
+	return report
+}
+
+// recordSLO records a completed request in the SLO tracker, if enabled
+func (c *Conductor) recordSLO(route string, status int, duration time.Duration) {
+	if c.sloTracker != nil {
+		c.sloTracker.Record(route, status, duration)
+	}
+}
+
+// SLOHandler creates an HTTP handler exposing rolling latency percentiles and SLO burn rates
+func SLOHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.sloTracker == nil {
+			http.Error(w, "SLO tracking not enabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.sloTracker.Snapshot()); err != nil {
+			http.Error(w, "Failed to encode SLO report: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// SetupSLOEndpoint registers the SLO endpoint if SLO tracking is enabled
+func SetupSLOEndpoint(mux *http.ServeMux, c *Conductor) {
+	if c.sloTracker == nil {
+		return
+	}
+
+	endpoint := c.config.SLO.Endpoint
+	logger.InfoWithFields("Enabling SLO endpoint", map[string]interface{}{
+		"endpoint": endpoint,
+	})
+	mux.HandleFunc(endpoint, SLOHandler(c))
+}
+
+// sloCollector exposes the tracker's percentiles and burn rates as Prometheus gauges,
+// computed at scrape time
+type sloCollector struct {
+	tracker  *sloTracker
+	latency  *prometheus.Desc
+	burnRate *prometheus.Desc
+}
+
+// newSLOCollector creates a collector for the given tracker
+func newSLOCollector(tracker *sloTracker) *sloCollector {
+	return &sloCollector{
+		tracker: tracker,
+		latency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "route_latency_seconds"),
+			"Rolling request latency percentiles per route",
+			[]string{"route", "quantile"}, nil,
+		),
+		burnRate: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "slo_burn_rate"),
+			"Rate at which the route's error budget is being spent over the rolling window (1 = on budget)",
+			[]string{"route"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (s *sloCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.latency
+	ch <- s.burnRate
+}
+
+// Collect implements prometheus.Collector
+func (s *sloCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, route := range s.tracker.Snapshot().Routes {
+		ch <- prometheus.MustNewConstMetric(s.latency, prometheus.GaugeValue, route.P50Ms/1000, route.Route, "0.5")
+		ch <- prometheus.MustNewConstMetric(s.latency, prometheus.GaugeValue, route.P95Ms/1000, route.Route, "0.95")
+		ch <- prometheus.MustNewConstMetric(s.latency, prometheus.GaugeValue, route.P99Ms/1000, route.Route, "0.99")
+		if route.BurnRate != nil {
+			ch <- prometheus.MustNewConstMetric(s.burnRate, prometheus.GaugeValue, *route.BurnRate, route.Route)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestTDigestQuantiles tests quantile estimates against a uniform distribution
+func TestTDigestQuantiles(t *testing.T) {
+	digest := newTDigest(defaultCompression)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		digest.Add(rng.Float64() * 1000)
+	}
+
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		got := digest.Quantile(q)
+		if math.Abs(got-q*1000) > 10 {
+			t.Errorf("Expected quantile %v near %v, got %v", q, q*1000, got)
+		}
+	}
+
+	// Merging into an empty digest must preserve the distribution
+	merged := newTDigest(defaultCompression)
+	merged.Merge(digest)
+	if got := merged.Quantile(0.5); math.Abs(got-500) > 10 {
+		t.Errorf("Expected merged median near 500, got %v", got)
+	}
+}
+
+// TestSLOTracker tests rolling burn rates and window expiry
+func TestSLOTracker(t *testing.T) {
+	tracker := newSLOTracker(config.SLOConfig{
+		Window:  60,
+		Targets: []config.SLOTarget{{Route: "/api", Objective: 0.9, LatencyMs: 100}},
+	})
+	now := time.Unix(1000, 0)
+	tracker.now = func() time.Time { return now }
+
+	// 10 requests: one 5xx, one too slow
+	for i := 0; i < 8; i++ {
+		tracker.Record("/api", 200, 10*time.Millisecond)
+	}
+	tracker.Record("/api", 502, 10*time.Millisecond)
+	tracker.Record("/api", 200, 200*time.Millisecond)
+	tracker.Record("/web", 200, 10*time.Millisecond)
+
+	report := tracker.Snapshot()
+	if len(report.Routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(report.Routes))
+	}
+
+	api := report.Routes[0]
+	if api.Requests != 10 || api.BadRequests != 2 {
+		t.Errorf("Expected 10 requests with 2 bad, got %d with %d bad", api.Requests, api.BadRequests)
+	}
+	// 20% bad against a 10% budget burns at twice the sustainable rate
+	if api.BurnRate == nil || math.Abs(*api.BurnRate-2) > 1e-9 || !api.BudgetExhausted {
+		t.Errorf("Expected burn rate 2 with budget exhausted, got %v", api.BurnRate)
+	}
+	if report.Routes[1].BurnRate != nil {
+		t.Errorf("Expected no burn rate for route without a target")
+	}
+
+	// Samples age out once the window has passed
+	now = now.Add(2 * time.Minute)
+	if report := tracker.Snapshot(); report.Routes[0].Requests != 0 {
+		t.Errorf("Expected expired samples to be dropped, got %d requests", report.Routes[0].Requests)
+	}
+}
+
+// TestSLOEndpoint tests that requests through the conductor appear in the SLO report
+func TestSLOEndpoint(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{
+				Name:       "api-service",
+				URL:        "http://backend.example.com",
+				PathPrefix: "/api",
+				Primary:    true,
+			},
+		},
+		SLO: config.SLOConfig{Enabled: true, Endpoint: "/slo", Window: 60},
+	}
+	conductor := NewConductor(cfg)
+	conductor.client = &http.Client{Transport: &recordingTransport{}}
+
+	conductor.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users", nil))
+
+	mux := http.NewServeMux()
+	SetupSLOEndpoint(mux, conductor)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/slo", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, `"route":"/api","requests":1`) {
+		t.Errorf("Expected report for route /api, got: %s", body)
+	}
+}
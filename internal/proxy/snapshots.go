@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Where an applied configuration came from
+const (
+	snapshotStartup  = "startup"  // The configuration the conductor started with
+	snapshotReload   = "reload"   // A reload of the configuration file
+	snapshotAdmin    = "admin"    // A runtime service change made through the admin endpoints
+	snapshotRollback = "rollback" // A rollback to an earlier snapshot
+)
+
+// errUnknownSnapshot is returned for rollbacks naming a snapshot that is not kept
+var errUnknownSnapshot = errors.New("unknown snapshot")
+
+// configSnapshot is a configuration applied to the routing table: the services and
+// failover clusters a reload applies, with when and how it was applied
+type configSnapshot struct {
+	ID       int                     `yaml:"id"`
+	Applied  time.Time               `yaml:"applied"`
+	Source   string                  `yaml:"source"`
+	Services []config.Service        `yaml:"services"`
+	Failover []config.FailoverConfig `yaml:"failover,omitempty"`
+}
+
+// configSnapshots keeps the last configurations applied, so a bad one can be rolled back.
+// Each snapshot is also written to the directory if one is configured, and the snapshots
+// found there are kept across restarts.
+type configSnapshots struct {
+	mu      sync.Mutex
+	limit   int
+	dir     string
+	nextID  int
+	entries []*configSnapshot // Oldest first
+}
+
+// newConfigSnapshots creates the snapshot history for the configuration, loading the
+// snapshots written to its directory by earlier runs
+func newConfigSnapshots(cfg config.ReloadConfig) (*configSnapshots, error) {
+	s := &configSnapshots{limit: cfg.History, dir: cfg.SnapshotDirectory, nextID: 1}
+	if s.dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "snapshot-*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var snapshot configSnapshot
+		if err := yaml.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("invalid snapshot %s: %w", file, err)
+		}
+		s.entries = append(s.entries, &snapshot)
+		s.nextID = max(s.nextID, snapshot.ID+1)
+	}
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].ID < s.entries[j].ID })
+	s.trim()
+	return s, nil
+}
+
+// Record adds an applied configuration to the history, dropping the oldest snapshots past
+// the limit. Failing to write it to the directory is logged, as it was applied already.
+func (s *configSnapshots) Record(cfg *config.Config, source string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := &configSnapshot{
+		ID:       s.nextID,
+		Applied:  time.Now().UTC(),
+		Source:   source,
+		Services: cfg.Services,
+		Failover: cfg.Failover,
+	}
+	s.nextID++
+	s.entries = append(s.entries, snapshot)
+	s.trim()
+
+	if s.dir != "" {
+		if err := s.write(snapshot); err != nil {
+			logger.ErrorWithFields("Failed to write configuration snapshot", err, map[string]interface{}{
+				"directory": s.dir,
+				"snapshot":  snapshot.ID,
+			})
+		}
+	}
+}
+
+// trim drops the oldest snapshots past the limit, with their files
+func (s *configSnapshots) trim() {
+	for len(s.entries) > s.limit {
+		if s.dir != "" {
+			os.Remove(s.path(s.entries[0]))
+		}
+		s.entries = s.entries[1:]
+	}
+}
+
+// path returns the file a snapshot is written to
+func (s *configSnapshots) path(snapshot *configSnapshot) string {
+	return filepath.Join(s.dir, fmt.Sprintf("snapshot-%d-%s.yaml", snapshot.ID, snapshot.Applied.Format("20060102T150405Z")))
+}
+
+// write writes a snapshot readable by its owner only, as services may carry secrets in
+// their headers, renaming it into place once complete
+func (s *configSnapshots) write(snapshot *configSnapshot) error {
+	data, err := yaml.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	path := s.path(snapshot)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Get returns the snapshot with the given ID
+func (s *configSnapshots) Get(id int) (*configSnapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, snapshot := range s.entries {
+		if snapshot.ID == id {
+			return snapshot, true
+		}
+	}
+	return nil, false
+}
+
+// snapshotStatus describes a kept snapshot
+type snapshotStatus struct {
+	ID       int       `json:"id"`
+	Applied  time.Time `json:"applied"`
+	Source   string    `json:"source"`
+	Services []string  `json:"services"`
+	Current  bool      `json:"current"` // The snapshot last applied
+}
+
+// List describes the kept snapshots, newest first
+func (s *configSnapshots) List() []snapshotStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]snapshotStatus, 0, len(s.entries))
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		snapshot := s.entries[i]
+		names := make([]string, 0, len(snapshot.Services))
+		for _, svc := range snapshot.Services {
+			names = append(names, svc.Name)
+		}
+		list = append(list, snapshotStatus{
+			ID:       snapshot.ID,
+			Applied:  snapshot.Applied,
+			Source:   snapshot.Source,
+			Services: names,
+			Current:  i == len(s.entries)-1,
+		})
+	}
+	return list
+}
+
+// rollback applies the services and failover clusters of a snapshot as a reload. Frozen
+// routes are rolled back too, as rollbacks are made by hand.
+func (c *Conductor) rollback(id int) error {
+	snapshot, ok := c.snapshots.Get(id)
+	if !ok {
+		return errUnknownSnapshot
+	}
+
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	next := *c.servedConfig()
+	next.Services, next.Failover = snapshot.Services, snapshot.Failover
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	return c.reloadLocked(&next, false, snapshotRollback)
+}
+
+// SnapshotsHandler creates an admin handler listing the kept configuration snapshots
+func SnapshotsHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodGet) {
+			return
+		}
+		if c.snapshots == nil {
+			http.Error(w, "Configuration snapshots are not enabled", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.snapshots.List()); err != nil {
+			http.Error(w, "Failed to encode snapshots: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// RollbackHandler creates an admin handler rolling the services and failover clusters
+// back to the snapshot named in the "snapshot" query parameter
+func RollbackHandler(c *Conductor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.checkAdminRequest(w, r, http.MethodPost) {
+			return
+		}
+		if c.snapshots == nil {
+			http.Error(w, "Configuration snapshots are not enabled", http.StatusNotFound)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("snapshot"))
+		if err != nil {
+			http.Error(w, "Invalid snapshot parameter: must be a snapshot ID", http.StatusBadRequest)
+			return
+		}
+		if err := c.rollback(id); err != nil {
+			status := http.StatusConflict
+			if errors.Is(err, errUnknownSnapshot) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, fmt.Sprintf("Failed to roll back to snapshot %d: %v", id, err), status)
+			return
+		}
+
+		logger.InfoWithFields("Rolled configuration back", map[string]interface{}{
+			"snapshot":    id,
+			"remote_addr": r.RemoteAddr,
+		})
+		c.writeRoutesStatus(w)
+	}
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestConfigRollback tests that applied configurations are kept as snapshots, written
+// owner-only, and that rolling back to one routes its services again
+func TestConfigRollback(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "orders", URL: "http://orders.example.com", PathPrefix: "/orders", Primary: true},
+		},
+		Reload: config.ReloadConfig{History: 2, SnapshotDirectory: dir},
+		Admin:  config.AdminConfig{Enabled: true, Endpoint: "/admin", Token: "secret"},
+	}
+	conductor := NewConductor(cfg)
+	mux := http.NewServeMux()
+	SetupAdminEndpoints(mux, conductor)
+	urlOf := func(name string) string {
+		svc, ok := conductor.serviceNamed(name)
+		if !ok {
+			return ""
+		}
+		return svc.URL.String()
+	}
+	list := func() []snapshotStatus {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, adminRequest("GET", "/admin/config/snapshots"))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected 200 listing snapshots, got %d", recorder.Code)
+		}
+		var snapshots []snapshotStatus
+		if err := json.NewDecoder(recorder.Body).Decode(&snapshots); err != nil {
+			t.Fatalf("Failed to decode snapshots: %v", err)
+		}
+		return snapshots
+	}
+
+	for _, url := range []string{"http://orders-v2.example.com", "http://orders-v3.example.com"} {
+		if err := conductor.Reload(&config.Config{Services: []config.Service{
+			{Name: "orders", URL: url, PathPrefix: "/orders", Primary: true},
+		}}); err != nil {
+			t.Fatalf("Failed to reload: %v", err)
+		}
+	}
+
+	snapshots := list()
+	if len(snapshots) != 2 || snapshots[0].ID != 3 || !snapshots[0].Current || snapshots[1].ID != 2 || snapshots[1].Source != snapshotReload {
+		t.Fatalf("Expected the last 2 snapshots newest first, got %+v", snapshots)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "snapshot-*.yaml"))
+	if len(files) != 2 {
+		t.Errorf("Expected the files of dropped snapshots to be removed, got %v", files)
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Failed to stat snapshot: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected snapshot %s to be owner-only, got %v", file, info.Mode().Perm())
+		}
+	}
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantURL    string
+	}{
+		{target: "/admin/config/rollback?snapshot=1", wantStatus: http.StatusNotFound, wantURL: "http://orders-v3.example.com"},
+		{target: "/admin/config/rollback?snapshot=x", wantStatus: http.StatusBadRequest, wantURL: "http://orders-v3.example.com"},
+		{target: "/admin/config/rollback?snapshot=2", wantStatus: http.StatusOK, wantURL: "http://orders-v2.example.com"},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, adminRequest("POST", tt.target))
+		if recorder.Code != tt.wantStatus {
+			t.Errorf("%s: expected %d, got %d", tt.target, tt.wantStatus, recorder.Code)
+		}
+		if got := urlOf("orders"); got != tt.wantURL {
+			t.Errorf("%s: expected orders at %s, got %s", tt.target, tt.wantURL, got)
+		}
+	}
+	if snapshots := list(); snapshots[0].ID != 4 || snapshots[0].Source != snapshotRollback {
+		t.Errorf("Expected the rollback to be kept as a snapshot, got %+v", snapshots[0])
+	}
+
+	// The history survives a restart
+	restarted := NewConductor(cfg)
+	if snapshot, ok := restarted.snapshots.Get(4); !ok || len(snapshot.Services) != 1 || snapshot.Services[0].URL != "http://orders-v2.example.com" {
+		t.Errorf("Expected the snapshots to be loaded on startup, got %+v", snapshot)
+	}
+}
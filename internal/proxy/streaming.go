@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// streamChunkSize is how many bytes of a streamed body are copied before flushing
+const streamChunkSize = 32 * 1024
+
+// streams reports whether a service's responses are streamed to the client instead of
+// buffered. Only the primary's response can be, as it is the one sent to the client.
+func (c *Conductor) streams(svc *Service) bool {
+	return svc.Primary && (c.config.Streaming.Enabled || svc.Config.Stream)
+}
+
+// streamsAny reports whether the response of any of the services is streamed
+func (c *Conductor) streamsAny(services []*Service) bool {
+	for _, svc := range services {
+		if c.streams(svc) {
+			return true
+		}
+	}
+	return false
+}
+
+// drains reports whether a service's response bodies are read and discarded instead of
+// buffered, so its responses cannot be compared or served
+func (c *Conductor) drains(svc *Service) bool {
+	return !svc.Primary && c.config.Streaming.DrainShadows
+}
+
+// streamContext returns the context of a streamed request. The request deadline only
+// bounds the wait for the response headers, calling headersReceived lifts it, so long
+// downloads are not cut off; afterwards only the client going away cancels the stream.
+// release must be called once the stream is done.
+func streamContext(ctx context.Context, client context.Context) (streamCtx context.Context, headersReceived func(), release func()) {
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopClient := context.AfterFunc(client, cancel)
+
+	var timer *time.Timer
+	if deadline, ok := ctx.Deadline(); ok {
+		timer = time.AfterFunc(time.Until(deadline), cancel)
+	}
+	headersReceived = func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	release = func() {
+		headersReceived()
+		stopClient()
+		cancel()
+	}
+	return streamCtx, headersReceived, release
+}
+
+// streamBody is a streamed response body releasing its request's context once closed
+type streamBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close implements io.Closer
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// withoutTimeout returns a copy of the client without its overall timeout, which would
+// otherwise include reading a streamed body
+func withoutTimeout(client *http.Client) *http.Client {
+	if client.Timeout == 0 {
+		return client
+	}
+	streaming := *client
+	streaming.Timeout = 0
+	return &streaming
+}
+
+// closeStream closes the result's streamed body, if it has one that was not sent
+func (result *serviceResult) closeStream() {
+	if result != nil && result.stream != nil {
+		result.stream.Close()
+	}
+}
+
+// copyStream copies a streamed body to the client as it arrives, flushing every chunk so
+// slow streams reach the client without delay. Flushing goes through a response
+// controller, so the writers wrapping the client's connection pass it on.
+func copyStream(w http.ResponseWriter, r *http.Request, result *serviceResult) {
+	defer result.stream.Close()
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	buf := make([]byte, streamChunkSize)
+	var written int64
+	for {
+		n, err := result.stream.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				logger.ForService(result.service.Name).ErrorWithFields("Failed to write streamed response body", writeErr, map[string]interface{}{
+					"method":  r.Method,
+					"path":    r.URL.Path,
+					"written": written,
+				})
+				return
+			}
+			written += int64(n)
+			// Writers that cannot flush still receive the whole body
+			controller.Flush()
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			logger.ForService(result.service.Name).ErrorWithFields("Failed to read streamed response body", err, map[string]interface{}{
+				"method":  r.Method,
+				"path":    r.URL.Path,
+				"written": written,
+			})
+			return
+		}
+	}
+}
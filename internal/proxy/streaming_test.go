@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestStreamingResponse tests that a streamed body reaches the client in full and flushed,
+// even when it takes longer than the request timeout to arrive or the route wraps the
+// client's writer
+func TestStreamingResponse(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("first chunk,"))
+		w.(http.Flusher).Flush()
+		time.Sleep(1200 * time.Millisecond)
+		w.Write([]byte("last chunk"))
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name string
+		cors []config.CORSConfig
+	}{
+		{name: "plain route"},
+		{name: "CORS route", cors: []config.CORSConfig{{Route: "/downloads", AllowOrigins: []string{"https://app.example.com"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Timeout: 1,
+				Services: []config.Service{
+					{Name: "downloads", URL: backend.URL, PathPrefix: "/downloads", Primary: true, Stream: true},
+				},
+				CORS: tt.cors,
+			}
+			conductor := NewConductor(cfg)
+
+			req := httptest.NewRequest("GET", "http://example.com/downloads/archive.tar", nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			recorder := httptest.NewRecorder()
+			conductor.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", recorder.Code)
+			}
+			if body := recorder.Body.String(); body != "first chunk,last chunk" {
+				t.Errorf("Expected the whole streamed body, got %q", body)
+			}
+			if !recorder.Flushed {
+				t.Error("Expected streamed chunks to be flushed")
+			}
+			if tt.cors != nil && recorder.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+				t.Errorf("Expected the CORS policy to apply, got headers %v", recorder.Header())
+			}
+		})
+	}
+}
+
+// TestDrainShadows tests that drained shadow bodies are read but not kept
+func TestDrainShadows(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1<<16)))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "api", URL: backend.URL, PathPrefix: "/api", Primary: true},
+			{Name: "api-shadow", URL: backend.URL, PathPrefix: "/api"},
+		},
+		Streaming: config.StreamingConfig{Enabled: true, DrainShadows: true},
+	}
+	conductor := NewConductor(cfg)
+	req := httptest.NewRequest("GET", "http://example.com/api/users", nil)
+
+	tests := []struct {
+		name        string
+		service     *Service
+		wantStream  bool
+		wantDrained bool
+	}{
+		{name: "primary streamed", service: conductor.services[0], wantStream: true},
+		{name: "shadow drained", service: conductor.services[1], wantDrained: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := conductor.makeServiceRequest(context.Background(), tt.service, req, &requestBody{})
+			defer result.closeStream()
+			if result.err != nil {
+				t.Fatalf("Request failed: %v", result.err)
+			}
+			if (result.stream != nil) != tt.wantStream || result.drained != tt.wantDrained {
+				t.Errorf("Expected stream=%v drained=%v, got stream=%v drained=%v",
+					tt.wantStream, tt.wantDrained, result.stream != nil, result.drained)
+			}
+			if len(result.body) != 0 {
+				t.Errorf("Expected no buffered body, got %d bytes", len(result.body))
+			}
+		})
+	}
+}
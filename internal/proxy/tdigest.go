@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"math"
+	"sort"
+)
+
+// defaultCompression bounds the number of centroids a digest keeps, roughly trading
+// memory for accuracy at the tails
+const defaultCompression = 100
+
+// centroid is a cluster of samples summarized by their mean and count
+type centroid struct {
+	mean  float64
+	count float64
+}
+
+// tdigest is a merging t-digest, a compact sketch for estimating quantiles of a stream.
+// Samples are buffered and periodically merged into centroids that are small near the
+// tails and large near the median, keeping p99 accurate at a fixed memory cost.
+type tdigest struct {
+	compression float64
+	centroids   []centroid // Sorted by mean
+	buffer      []centroid // Unmerged samples
+	count       float64
+}
+
+// newTDigest creates an empty digest
+func newTDigest(compression float64) *tdigest {
+	return &tdigest{compression: compression}
+}
+
+// Add records a single sample
+func (t *tdigest) Add(x float64) {
+	t.buffer = append(t.buffer, centroid{mean: x, count: 1})
+	t.count++
+	if len(t.buffer) >= int(t.compression)*5 {
+		t.compress()
+	}
+}
+
+// Merge adds every sample summarized by other into t
+func (t *tdigest) Merge(other *tdigest) {
+	t.buffer = append(t.buffer, other.centroids...)
+	t.buffer = append(t.buffer, other.buffer...)
+	t.count += other.count
+	t.compress()
+}
+
+// Count returns the number of samples recorded
+func (t *tdigest) Count() float64 {
+	return t.count
+}
+
+// Quantile estimates the value below which a fraction q of samples fall
+func (t *tdigest) Quantile(q float64) float64 {
+	t.compress()
+	if len(t.centroids) == 0 {
+		return 0
+	}
+	if len(t.centroids) == 1 {
+		return t.centroids[0].mean
+	}
+
+	// Interpolate between the centers of the two centroids surrounding the target rank
+	target := q * t.count
+	var cumulative float64
+	for i := 0; i < len(t.centroids)-1; i++ {
+		cur, next := t.centroids[i], t.centroids[i+1]
+		left := cumulative + cur.count/2
+		right := cumulative + cur.count + next.count/2
+		if target <= left {
+			return cur.mean
+		}
+		if target <= right {
+			fraction := (target - left) / (right - left)
+			return cur.mean + fraction*(next.mean-cur.mean)
+		}
+		cumulative += cur.count
+	}
+	return t.centroids[len(t.centroids)-1].mean
+}
+
+// compress merges buffered samples into the centroid list
+func (t *tdigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+
+	all := append(t.centroids, t.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	cur := all[0]
+	var soFar float64
+	kLeft := t.scale(0)
+	for _, c := range all[1:] {
+		q := (soFar + cur.count + c.count) / t.count
+		if t.scale(q)-kLeft <= 1 {
+			// Still within the size limit for this part of the distribution
+			cur.mean += (c.mean - cur.mean) * c.count / (cur.count + c.count)
+			cur.count += c.count
+			continue
+		}
+		merged = append(merged, cur)
+		soFar += cur.count
+		kLeft = t.scale(soFar / t.count)
+		cur = c
+	}
+	merged = append(merged, cur)
+
+	t.centroids = merged
+	t.buffer = t.buffer[:0]
+}
+
+// scale maps a quantile to the k-scale, which changes fastest near the tails
+func (t *tdigest) scale(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*math.Min(q, 1)-1)
+}
@@ -0,0 +1,252 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// throttleChunkSize bounds how many bytes are written or read per limiter reservation
+const throttleChunkSize = 32 * 1024
+
+// throttleIdleTimeout is how long an unused per-client limiter is kept
+const throttleIdleTimeout = time.Minute
+
+// byteLimiter is a token bucket limiting throughput in bytes per second. Callers reserve
+// bytes up front and sleep off any debt, so concurrent streams share the rate fairly.
+type byteLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // Bytes per second
+	burst    float64 // Maximum accumulated tokens
+	tokens   float64
+	last     time.Time
+	lastUsed time.Time
+}
+
+// newByteLimiter creates a limiter allowing rate bytes per second with a one second burst
+func newByteLimiter(rate int) *byteLimiter {
+	return newTokenBucket(float64(rate), float64(rate))
+}
+
+// newTokenBucket creates a limiter allowing rate tokens per second, accumulating up to
+// burst tokens while idle
+func newTokenBucket(rate float64, burst float64) *byteLimiter {
+	now := time.Now()
+	return &byteLimiter{
+		rate:     rate,
+		burst:    burst,
+		tokens:   burst,
+		last:     now,
+		lastUsed: now,
+	}
+}
+
+// WaitN blocks until n bytes may be transferred or the context is done
+func (l *byteLimiter) WaitN(ctx context.Context, n int) error {
+	wait, _ := l.Reserve(n, -1)
+	return sleepCtx(ctx, wait)
+}
+
+// Reserve takes n tokens and returns how long the caller must wait before using them. If
+// maxWait is not negative and the wait would exceed it, no tokens are taken and false is
+// returned.
+func (l *byteLimiter) Reserve(n int, maxWait time.Duration) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.lastUsed = now
+
+	wait := time.Duration((float64(n) - l.tokens) / l.rate * float64(time.Second))
+	if maxWait >= 0 && wait > maxWait {
+		return 0, false
+	}
+	l.tokens -= float64(n)
+	return wait, true
+}
+
+// sleepCtx waits for d unless the context is done first
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// idleSince reports whether the limiter has not been used since t
+func (l *byteLimiter) idleSince(t time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastUsed.Before(t)
+}
+
+// bandwidthLimiters holds the byte-rate limiters for throttled routes, shared by all
+// clients of a route or kept per client address
+type bandwidthLimiters struct {
+	mu        sync.Mutex
+	limits    map[string]config.BandwidthLimit // By route name
+	limiters  map[string]*byteLimiter
+	lastSweep time.Time
+}
+
+// newBandwidthLimiters creates limiters for the configured routes
+func newBandwidthLimiters(limits []config.BandwidthLimit) *bandwidthLimiters {
+	b := &bandwidthLimiters{
+		limits:    make(map[string]config.BandwidthLimit),
+		limiters:  make(map[string]*byteLimiter),
+		lastSweep: time.Now(),
+	}
+	for _, limit := range limits {
+		b.limits[limit.Route] = limit
+	}
+	return b
+}
+
+// For returns the request and response limiters for a request on the given route,
+// either of which is nil when that direction is not throttled
+func (b *bandwidthLimiters) For(route string, r *http.Request) (request *byteLimiter, response *byteLimiter) {
+	limit, ok := b.limits[route]
+	if !ok {
+		return nil, nil
+	}
+
+	key := route
+	if limit.PerClient {
+		key += " " + clientAddress(r)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sweep()
+
+	if limit.RequestBytesPerSecond > 0 {
+		request = b.limiter(key+" request", limit.RequestBytesPerSecond)
+	}
+	if limit.ResponseBytesPerSecond > 0 {
+		response = b.limiter(key+" response", limit.ResponseBytesPerSecond)
+	}
+	return request, response
+}
+
+// limiter returns the limiter for key, creating it if needed. Callers must hold b.mu.
+func (b *bandwidthLimiters) limiter(key string, rate int) *byteLimiter {
+	l, ok := b.limiters[key]
+	if !ok {
+		l = newByteLimiter(rate)
+		b.limiters[key] = l
+	}
+	return l
+}
+
+// sweep drops limiters that have been idle for a while, so per-client limiters do not
+// accumulate. Callers must hold b.mu.
+func (b *bandwidthLimiters) sweep() {
+	now := time.Now()
+	if now.Sub(b.lastSweep) < throttleIdleTimeout {
+		return
+	}
+	b.lastSweep = now
+
+	cutoff := now.Add(-throttleIdleTimeout)
+	for key, l := range b.limiters {
+		if l.idleSince(cutoff) {
+			delete(b.limiters, key)
+		}
+	}
+}
+
+// clientAddress returns the client's IP address without the port
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// throttledReadCloser limits the rate at which a request body is read
+type throttledReadCloser struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *byteLimiter
+}
+
+// Read implements io.Reader
+func (t *throttledReadCloser) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// throttledResponseWriter limits the rate at which a response body is written
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *byteLimiter
+}
+
+// Write implements io.Writer, writing in chunks so the rate is smooth
+func (t *throttledResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > throttleChunkSize {
+			chunk = chunk[:throttleChunkSize]
+		}
+		if err := t.limiter.WaitN(t.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := t.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (t *throttledResponseWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// throttle applies the route's bandwidth limits to the request body and response writer
+func (c *Conductor) throttle(w http.ResponseWriter, r *http.Request, route string) http.ResponseWriter {
+	if c.bandwidth == nil {
+		return w
+	}
+
+	requestLimiter, responseLimiter := c.bandwidth.For(route, r)
+	if requestLimiter != nil && r.Body != nil {
+		r.Body = &throttledReadCloser{ReadCloser: r.Body, ctx: r.Context(), limiter: requestLimiter}
+	}
+	if responseLimiter != nil {
+		w = &throttledResponseWriter{ResponseWriter: w, ctx: r.Context(), limiter: responseLimiter}
+	}
+	return w
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestThrottledResponseWriter tests that response bodies are written at the configured rate
+func TestThrottledResponseWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/export", nil)
+	w := &throttledResponseWriter{ResponseWriter: recorder, ctx: req.Context(), limiter: newByteLimiter(10000)}
+
+	// The first second's worth is the burst, the remaining 5000 bytes take half a second
+	start := time.Now()
+	n, err := w.Write(bytes.Repeat([]byte("x"), 15000))
+	elapsed := time.Since(start)
+
+	if err != nil || n != 15000 {
+		t.Fatalf("Expected 15000 bytes written, got %d (err: %v)", n, err)
+	}
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("Expected write to be throttled to about 500ms, took %v", elapsed)
+	}
+	if recorder.Body.Len() != 15000 {
+		t.Errorf("Expected full body to reach the client, got %d bytes", recorder.Body.Len())
+	}
+}
+
+// TestBandwidthLimiters tests route and per-client limiter selection
+func TestBandwidthLimiters(t *testing.T) {
+	limiters := newBandwidthLimiters([]config.BandwidthLimit{
+		{Route: "/export", ResponseBytesPerSecond: 1000, PerClient: true},
+		{Route: "/upload", RequestBytesPerSecond: 1000},
+	})
+
+	clientA := httptest.NewRequest("GET", "/export", nil)
+	clientA.RemoteAddr = "10.0.0.1:1234"
+	clientB := httptest.NewRequest("GET", "/export", nil)
+	clientB.RemoteAddr = "10.0.0.2:1234"
+
+	reqA, respA := limiters.For("/export", clientA)
+	_, respA2 := limiters.For("/export", clientA)
+	_, respB := limiters.For("/export", clientB)
+	if reqA != nil || respA == nil {
+		t.Fatalf("Expected only a response limiter for /export")
+	}
+	if respA != respA2 {
+		t.Errorf("Expected the same limiter for the same client")
+	}
+	if respA == respB {
+		t.Errorf("Expected separate limiters per client")
+	}
+
+	uploadA, _ := limiters.For("/upload", clientA)
+	uploadB, _ := limiters.For("/upload", clientB)
+	if uploadA == nil || uploadA != uploadB {
+		t.Errorf("Expected one shared request limiter for /upload")
+	}
+
+	if req, resp := limiters.For("/other", clientA); req != nil || resp != nil {
+		t.Errorf("Expected no limiters for an unthrottled route")
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// Egress proxy modes for a service
+const (
+	proxyModeEnvironment = "environment" // Honor HTTP_PROXY, HTTPS_PROXY and NO_PROXY (default)
+	proxyModeNone        = "none"        // Always connect directly
+)
+
+// newCachingTransport builds a transport that resolves hostnames through the DNS cache
+func newCachingTransport(cache *dnsCache) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = cache.DialContext(newDialer(nil))
+	return transport
+}
+
+// newDialer builds a dialer from a service's dial settings, using the same defaults as the
+// standard library's default transport for anything not configured
+func newDialer(dial *config.DialConfig) *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if dial == nil {
+		return dialer
+	}
+
+	if dial.ConnectTimeoutMs > 0 {
+		dialer.Timeout = time.Duration(dial.ConnectTimeoutMs) * time.Millisecond
+	}
+	// Negative values disable keep-alive probes and the dual-stack fallback respectively
+	if dial.KeepAlive != 0 {
+		dialer.KeepAlive = time.Duration(dial.KeepAlive) * time.Second
+	}
+	if dial.FallbackDelayMs != 0 {
+		dialer.FallbackDelay = time.Duration(dial.FallbackDelayMs) * time.Millisecond
+	}
+	return dialer
+}
+
+// newServiceClient builds a dedicated HTTP client for a service that overrides the egress
+// proxy or dial settings, starting from the given base transport (nil for the default
+// transport) and resolving through the DNS cache if one is given. It returns nil when the
+// service can use the conductor's shared client.
+func newServiceClient(svcConfig config.Service, base *http.Transport, cache *dnsCache, timeout time.Duration) (*http.Client, error) {
+	mode := strings.TrimSpace(svcConfig.Proxy)
+	environmentProxy := mode == "" || strings.EqualFold(mode, proxyModeEnvironment)
+	if environmentProxy && svcConfig.Dial == nil {
+		return nil, nil
+	}
+
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	transport := base.Clone()
+	if strings.EqualFold(mode, proxyModeNone) {
+		transport.Proxy = nil
+	} else if !environmentProxy {
+		proxyURL, err := url.Parse(mode)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q for service %s", mode, svcConfig.Name)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if svcConfig.Dial != nil {
+		dialer := newDialer(svcConfig.Dial)
+		if cache != nil {
+			transport.DialContext = cache.DialContext(dialer)
+		} else {
+			transport.DialContext = dialer.DialContext
+		}
+		if newConnRecycler(svcConfig.Dial) != nil {
+			transport.DialContext = recycledDial(transport.DialContext)
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+// clientFor returns the HTTP client used to reach the given service
+func (c *Conductor) clientFor(svc *Service) *http.Client {
+	if svc.client != nil {
+		return svc.client
+	}
+	return c.client
+}
+
+// recordDNSFailure reports a failed backend hostname resolution
+func (c *Conductor) recordDNSFailure(host string, err error) {
+	logger.WarnWithFields("Failed to resolve backend host", map[string]interface{}{
+		"host":  host,
+		"error": err.Error(),
+	})
+
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordDNSFailure(host)
+	}
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestNewServiceClient tests per-service egress proxy configuration
+func TestNewServiceClient(t *testing.T) {
+	tests := []struct {
+		name         string
+		proxy        string
+		expectClient bool
+		expectProxy  string
+		expectError  bool
+	}{
+		{
+			name:         "shared client by default",
+			proxy:        "",
+			expectClient: false,
+		},
+		{
+			name:         "shared client for environment",
+			proxy:        "environment",
+			expectClient: false,
+		},
+		{
+			name:         "direct connection",
+			proxy:        "none",
+			expectClient: true,
+		},
+		{
+			name:         "forced proxy",
+			proxy:        "http://proxy.corp.example.com:3128",
+			expectClient: true,
+			expectProxy:  "http://proxy.corp.example.com:3128",
+		},
+		{
+			name:        "invalid proxy",
+			proxy:       "not a url",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := newServiceClient(config.Service{Name: "svc", Proxy: test.proxy}, nil, nil, 0)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got: %v", err)
+			}
+
+			if (client != nil) != test.expectClient {
+				t.Fatalf("Expected dedicated client: %v, got %v", test.expectClient, client != nil)
+			}
+			if client == nil {
+				return
+			}
+
+			transport := client.Transport.(*http.Transport)
+			if test.expectProxy == "" {
+				if transport.Proxy != nil {
+					t.Errorf("Expected no proxy function for direct connections")
+				}
+				return
+			}
+
+			req, _ := http.NewRequest("GET", "http://backend.example.com", nil)
+			proxyURL, err := transport.Proxy(req)
+			if err != nil || proxyURL == nil || proxyURL.String() != test.expectProxy {
+				t.Errorf("Expected proxy %s, got %v (err: %v)", test.expectProxy, proxyURL, err)
+			}
+		})
+	}
+}
+
+// TestNewDialer tests dial settings and their defaults
+func TestNewDialer(t *testing.T) {
+	tests := []struct {
+		name              string
+		dial              *config.DialConfig
+		wantTimeout       time.Duration
+		wantKeepAlive     time.Duration
+		wantFallbackDelay time.Duration
+	}{
+		{
+			name:          "defaults",
+			dial:          nil,
+			wantTimeout:   30 * time.Second,
+			wantKeepAlive: 30 * time.Second,
+		},
+		{
+			name:              "configured",
+			dial:              &config.DialConfig{ConnectTimeoutMs: 250, KeepAlive: 15, FallbackDelayMs: 50},
+			wantTimeout:       250 * time.Millisecond,
+			wantKeepAlive:     15 * time.Second,
+			wantFallbackDelay: 50 * time.Millisecond,
+		},
+		{
+			name:              "disabled keep-alive and fallback",
+			dial:              &config.DialConfig{KeepAlive: -1, FallbackDelayMs: -1},
+			wantTimeout:       30 * time.Second,
+			wantKeepAlive:     -time.Second,
+			wantFallbackDelay: -time.Millisecond,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dialer := newDialer(test.dial)
+			if dialer.Timeout != test.wantTimeout || dialer.KeepAlive != test.wantKeepAlive || dialer.FallbackDelay != test.wantFallbackDelay {
+				t.Errorf("Expected timeout %v, keep-alive %v, fallback %v, got %v, %v, %v",
+					test.wantTimeout, test.wantKeepAlive, test.wantFallbackDelay,
+					dialer.Timeout, dialer.KeepAlive, dialer.FallbackDelay)
+			}
+		})
+	}
+
+	// Dial settings alone give the service its own client
+	client, err := newServiceClient(config.Service{Name: "svc", Dial: &config.DialConfig{ConnectTimeoutMs: 250}}, nil, nil, 0)
+	if err != nil || client == nil {
+		t.Fatalf("Expected a dedicated client for dial settings, got %v (err: %v)", client, err)
+	}
+	if transport := client.Transport.(*http.Transport); transport.DialContext == nil || transport.Proxy == nil {
+		t.Errorf("Expected a custom dialer and the environment proxy")
+	}
+}
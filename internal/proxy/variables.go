@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// templateReference matches ${name} variable references in templates
+var templateReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// variableSource extracts one variable from a request
+type variableSource struct {
+	config config.VariableConfig
+	jwt    *jwtAuth // Verifies tokens for claim variables, nil otherwise
+}
+
+// variableExtractor extracts a service's request-scoped variables: segments named by its
+// path pattern, named groups of its path regex, headers, query parameters and verified
+// JWT claims
+type variableExtractor struct {
+	pattern  []string       // Path pattern segments, "{name}" capturing a segment
+	regex    *regexp.Regexp // Path regex whose named groups capture variables, nil if none
+	sources  []variableSource
+	defaults map[string]string
+}
+
+// newVariableExtractor builds the extractor for a service, or nil if the service declares
+// no variables. Templates referencing undeclared variables are rejected.
+func newVariableExtractor(svcConfig config.Service, pathRegex *regexp.Regexp, auth config.AuthConfig) (*variableExtractor, error) {
+	e := &variableExtractor{defaults: make(map[string]string)}
+	if pathRegex != nil {
+		for _, name := range pathRegex.SubexpNames() {
+			if name != "" {
+				e.regex = pathRegex
+				e.defaults[name] = ""
+			}
+		}
+	}
+	if svcConfig.PathParams != "" {
+		e.pattern = strings.Split(strings.Trim(svcConfig.PathParams, "/"), "/")
+		for _, segment := range e.pattern {
+			if name, ok := pathParam(segment); ok {
+				e.defaults[name] = ""
+			}
+		}
+	}
+	for _, variable := range svcConfig.Variables {
+		source := variableSource{config: variable}
+		if variable.From == "claim" {
+			jwt, err := newJWTMethod(variable.Auth, auth)
+			if err != nil {
+				return nil, fmt.Errorf("variable %q: %w", variable.Name, err)
+			}
+			source.jwt = jwt
+		}
+		e.sources = append(e.sources, source)
+		e.defaults[variable.Name] = variable.Default
+	}
+
+	templates := []string{svcConfig.URL, svcConfig.RewritePath}
+	for _, value := range svcConfig.Headers {
+		templates = append(templates, value)
+	}
+	for _, template := range templates {
+		for _, match := range templateReference.FindAllStringSubmatch(template, -1) {
+			if _, ok := e.defaults[match[1]]; !ok {
+				return nil, fmt.Errorf("template %q references undeclared variable %q", template, match[1])
+			}
+		}
+	}
+
+	if len(e.defaults) == 0 {
+		return nil, nil
+	}
+	return e, nil
+}
+
+// pathParam returns the variable named by a "{name}" pattern segment
+func pathParam(segment string) (string, bool) {
+	if len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}' {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+// Defaults returns every variable set to its default value
+func (e *variableExtractor) Defaults() map[string]string {
+	if e == nil {
+		return nil
+	}
+	vars := make(map[string]string, len(e.defaults))
+	for name, value := range e.defaults {
+		vars[name] = value
+	}
+	return vars
+}
+
+// Extract returns the variables of a request. Variables the request does not carry keep
+// their default value.
+func (e *variableExtractor) Extract(r *http.Request) map[string]string {
+	if e == nil {
+		return nil
+	}
+	vars := e.Defaults()
+
+	// Path parameters only bind when every literal segment of the pattern matches
+	if e.pattern != nil {
+		segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+		params := make(map[string]string)
+		matched := len(segments) >= len(e.pattern)
+		for i := 0; matched && i < len(e.pattern); i++ {
+			if name, ok := pathParam(e.pattern[i]); ok {
+				params[name], _ = url.PathUnescape(segments[i])
+			} else if segments[i] != e.pattern[i] {
+				matched = false
+			}
+		}
+		if matched {
+			for name, value := range params {
+				vars[name] = value
+			}
+		}
+	}
+
+	if e.regex != nil {
+		if match := e.regex.FindStringSubmatch(r.URL.Path); match != nil {
+			for i, name := range e.regex.SubexpNames() {
+				if name != "" {
+					vars[name] = match[i]
+				}
+			}
+		}
+	}
+
+	for _, source := range e.sources {
+		var value string
+		switch source.config.From {
+		case "header":
+			value = r.Header.Get(source.config.Key)
+		case "query":
+			value = r.URL.Query().Get(source.config.Key)
+		case "claim":
+			value, _ = source.jwt.Claim(r, source.config.Key)
+		}
+		if value != "" {
+			vars[source.config.Name] = value
+		}
+	}
+	return vars
+}
+
+// expandURLTemplate substitutes variables into a templated service URL. The values come
+// from the request, so a value with anything other than hostname label characters is
+// refused instead of being allowed to move the URL's host, port, user info or fragment.
+func expandURLTemplate(template string, vars map[string]string) (string, bool) {
+	valid := true
+	expanded := expandTemplate(template, vars, func(value string) string {
+		if !isLabelValue(value) {
+			valid = false
+		}
+		return value
+	})
+	return expanded, valid
+}
+
+// isLabelValue reports whether a value only holds letters, digits, hyphens, underscores
+// and dots, so it cannot end or extend the part of the URL it is substituted into
+func isLabelValue(value string) bool {
+	for _, r := range value {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// expandTemplate substitutes variables for their ${name} references, passing values
+// through escape first unless it is nil
+func expandTemplate(template string, vars map[string]string, escape func(string) string) string {
+	if vars == nil || !strings.Contains(template, "${") {
+		return template
+	}
+	return templateReference.ReplaceAllStringFunc(template, func(reference string) string {
+		value := vars[reference[2:len(reference)-1]]
+		if escape != nil {
+			value = escape(value)
+		}
+		return value
+	})
+}
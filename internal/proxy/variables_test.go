@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// TestRequestVariables tests extracting variables from the path, headers, query and JWT
+// claims and substituting them into the target URL, rewrite path and headers
+func TestRequestVariables(t *testing.T) {
+	secret := []byte("secret")
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{
+				Name:        "users",
+				URL:         "http://${region}.users.example.com",
+				PathPrefix:  "/api/users",
+				Primary:     true,
+				PathParams:  "/api/users/{id}",
+				RewritePath: "/v2/accounts/${id}",
+				Headers:     map[string]string{"X-Tenant": "${tenant}", "X-Plan": "plan-${plan}"},
+				Variables: []config.VariableConfig{
+					{Name: "region", From: "header", Key: "X-Region", Default: "eu"},
+					{Name: "plan", From: "query", Key: "plan", Default: "free"},
+					{Name: "tenant", From: "claim", Key: "tenant", Auth: "token"},
+				},
+			},
+		},
+		Auth: config.AuthConfig{
+			Methods: map[string]config.AuthMethodConfig{"token": {Type: "jwt", Secret: string(secret)}},
+		},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	if got := conductor.services[0].URL.Host; got != "eu.users.example.com" {
+		t.Errorf("Expected default host eu.users.example.com, got %s", got)
+	}
+
+	validToken := signJWT(t, "HS256", secret, map[string]interface{}{"tenant": "acme", "exp": time.Now().Add(time.Hour).Unix()})
+	forgedToken := signJWT(t, "HS256", []byte("other"), map[string]interface{}{"tenant": "evil"})
+
+	tests := []struct {
+		name       string
+		target     string
+		header     map[string]string
+		wantURL    string
+		wantTenant string
+		wantPlan   string
+	}{
+		{
+			name:       "defaults",
+			target:     "/api/users/42",
+			wantURL:    "http://eu.users.example.com/v2/accounts/42",
+			wantPlan:   "plan-free",
+			wantTenant: "",
+		},
+		{
+			name:       "extracted values",
+			target:     "/api/users/a%2Fb/orders?plan=pro",
+			header:     map[string]string{"X-Region": "us", "Authorization": "Bearer " + validToken},
+			wantURL:    "http://us.users.example.com/v2/accounts/a%2Fb?plan=pro",
+			wantPlan:   "plan-pro",
+			wantTenant: "acme",
+		},
+		{
+			name:       "unverified claim ignored",
+			target:     "/api/users/7",
+			header:     map[string]string{"Authorization": "Bearer " + forgedToken},
+			wantURL:    "http://eu.users.example.com/v2/accounts/7",
+			wantPlan:   "plan-free",
+			wantTenant: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com"+tt.target, nil)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			conductor.ServeHTTP(httptest.NewRecorder(), req)
+
+			upstream := transport.requests[len(transport.requests)-1]
+			if got := upstream.URL.String(); got != tt.wantURL {
+				t.Errorf("Expected target URL %s, got %s", tt.wantURL, got)
+			}
+			if got := upstream.Header.Get("X-Tenant"); got != tt.wantTenant {
+				t.Errorf("Expected X-Tenant %q, got %q", tt.wantTenant, got)
+			}
+			if got := upstream.Header.Get("X-Plan"); got != tt.wantPlan {
+				t.Errorf("Expected X-Plan %q, got %q", tt.wantPlan, got)
+			}
+		})
+	}
+}
+
+// TestURLTemplateInjection tests that request variables cannot move a templated service
+// URL to another host
+func TestURLTemplateInjection(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{{
+			Name:       "users",
+			URL:        "http://${region}.users.example.com:8080/${tenant}",
+			PathPrefix: "/api",
+			Primary:    true,
+			Variables: []config.VariableConfig{
+				{Name: "region", From: "header", Key: "X-Region", Default: "eu"},
+				{Name: "tenant", From: "header", Key: "X-Tenant", Default: "shared"},
+			},
+		}},
+	}
+	conductor := NewConductor(cfg)
+	svc := conductor.services[0]
+
+	for _, value := range []string{"attacker.example#", "attacker.example/", "user@attacker.example", "attacker.example:80", "a?b", "a b"} {
+		for _, name := range []string{"region", "tenant"} {
+			req := httptest.NewRequest("GET", "/api/users", nil)
+			vars := map[string]string{"region": "us", "tenant": "acme", name: value}
+			resolved, err := url.Parse(conductor.createTargetURL(svc, req, vars))
+			if err != nil {
+				t.Fatalf("Invalid target URL for %s=%q: %v", name, value, err)
+			}
+			if resolved.Host != "eu.users.example.com:8080" {
+				t.Errorf("Expected %s=%q refused, got host %s", name, value, resolved.Host)
+			}
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/users", nil)
+	if target := conductor.createTargetURL(svc, req, map[string]string{"region": "us-east_1", "tenant": "acme"}); target != "http://us-east_1.users.example.com:8080/users" {
+		t.Errorf("Expected label values substituted, got %s", target)
+	}
+}
+
+// TestPathRegexRouting tests routing by path regular expression ahead of prefixes and
+// rewriting with the expression's named groups
+func TestPathRegexRouting(t *testing.T) {
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "users", URL: "http://users.example.com", PathPrefix: "/users", Primary: true},
+			{
+				Name:        "orders",
+				URL:         "http://orders.example.com",
+				PathRegex:   `/users/(?P<id>[0-9]+)/orders`,
+				Primary:     true,
+				RewritePath: "/v2/orders/${id}",
+			},
+		},
+	}
+	conductor := NewConductor(cfg)
+	transport := &recordingTransport{}
+	conductor.client = &http.Client{Transport: transport}
+
+	tests := []struct {
+		target  string
+		wantURL string
+	}{
+		{target: "/users/42/orders?page=2", wantURL: "http://orders.example.com/v2/orders/42?page=2"},
+		{target: "/users/42", wantURL: "http://users.example.com/42"},
+		{target: "/users/abc/orders", wantURL: "http://users.example.com/abc/orders"},
+		{target: "/users/42/orders/7", wantURL: "http://users.example.com/42/orders/7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			conductor.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com"+tt.target, nil))
+
+			upstream := transport.requests[len(transport.requests)-1]
+			if got := upstream.URL.String(); got != tt.wantURL {
+				t.Errorf("Expected target URL %s, got %s", tt.wantURL, got)
+			}
+		})
+	}
+}
+
+// TestVariableTemplateValidation tests rejecting templates that reference undeclared variables
+func TestVariableTemplateValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		service config.Service
+		wantErr bool
+	}{
+		{name: "no variables", service: config.Service{URL: "http://a.example.com"}},
+		{name: "declared path param", service: config.Service{URL: "http://a.example.com", PathParams: "/users/{id}", RewritePath: "/u/${id}"}},
+		{name: "undeclared in rewrite", service: config.Service{URL: "http://a.example.com", RewritePath: "/u/${id}"}, wantErr: true},
+		{name: "undeclared in header", service: config.Service{URL: "http://a.example.com", Headers: map[string]string{"X-A": "${a}"}}, wantErr: true},
+		{name: "undeclared in url", service: config.Service{URL: "http://${zone}.example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newVariableExtractor(tt.service, nil, config.AuthConfig{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/logger"
+)
+
+// isWebSocketUpgrade reports whether the request asks to switch the connection to WebSocket
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+// headerHasToken reports whether a comma-separated header lists the token, ignoring case
+func headerHasToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyWebSocket tunnels a WebSocket connection to the route's primary. The handshake is
+// sent to the primary alone and, once it switched protocols, the client's connection is
+// hijacked and frames are copied both ways until either side closes. Shadows and mirrors
+// are not sent the handshake, since frames are not mirrored.
+func (c *Conductor) proxyWebSocket(w http.ResponseWriter, r *http.Request, route string, services []*Service, requestStart time.Time, traceID string) {
+	svc := services[0]
+	for _, candidate := range services {
+		if candidate.Primary {
+			svc = candidate
+			break
+		}
+	}
+
+	// Bound the handshake by the request timeout, but not the tunnel that follows
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), c.timeout)
+	defer cancel()
+
+	vars := svc.variables.Extract(r)
+	targetURL := c.createTargetURL(svc, r, vars)
+	req, err := http.NewRequestWithContext(ctx, r.Method, targetURL, nil)
+	if err != nil {
+		c.handleWebSocketFailure(w, r, svc, route, err, requestStart, traceID)
+		return
+	}
+	c.copyAndAugmentHeaders(req, r, svc, vars)
+	c.annotations.annotateRequest(req, svc, 1)
+	if err := c.setCredentials(ctx, req, svc); err != nil {
+		c.handleWebSocketFailure(w, r, svc, route, err, requestStart, traceID)
+		return
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	if svc.Config.PreserveHost {
+		req.Host = r.Host
+	}
+
+	// The transport rather than the client sends the handshake, so its timeout does not
+	// cut the tunnel short
+	transport := c.clientFor(svc).Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		c.handleWebSocketFailure(w, r, svc, route, err, requestStart, traceID)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Backends refusing the upgrade answer like any other request
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		c.recordWebSocket(r, svc, route, resp.StatusCode, requestStart, traceID)
+		return
+	}
+	backend, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		c.handleWebSocketFailure(w, r, svc, route, fmt.Errorf("backend connection is not writable"), requestStart, traceID)
+		return
+	}
+
+	conn, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		c.handleWebSocketFailure(w, r, svc, route, fmt.Errorf("failed to hijack connection: %w", err), requestStart, traceID)
+		return
+	}
+	defer conn.Close()
+	// Deadlines of the server and the handler timeout no longer apply to the tunnel
+	conn.SetDeadline(time.Time{})
+	markSwitched(w)
+
+	fmt.Fprintf(buffered, "HTTP/1.1 %d %s\r\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+	resp.Header.Write(buffered)
+	buffered.WriteString("\r\n")
+	if err := buffered.Flush(); err != nil {
+		return
+	}
+	c.recordWebSocket(r, svc, route, resp.StatusCode, requestStart, traceID)
+
+	logger.DebugWithFields("Tunneling WebSocket connection", map[string]interface{}{
+		"service": svc.Name,
+		"route":   route,
+		"path":    r.URL.Path,
+	})
+	idleTimeout := time.Duration(c.config.WebSocket.IdleTimeout) * time.Second
+	sent, received := tunnel(buffered.Reader, conn, backend, idleTimeout)
+	logger.DebugWithFields("WebSocket connection closed", map[string]interface{}{
+		"service":        svc.Name,
+		"route":          route,
+		"bytes_sent":     sent,
+		"bytes_received": received,
+		"duration_ms":    time.Since(requestStart).Milliseconds(),
+	})
+}
+
+// tunnel copies bytes between the client and the backend until either side closes or,
+// with an idle timeout, nothing crossed the tunnel for that long. It returns the bytes
+// sent to the backend and received from it.
+func tunnel(client io.Reader, clientConn io.WriteCloser, backend io.ReadWriteCloser, idleTimeout time.Duration) (int64, int64) {
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+	active := func() { lastActive.Store(time.Now().UnixNano()) }
+
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			clientConn.Close()
+			backend.Close()
+		})
+	}
+
+	done := make(chan struct{})
+	if idleTimeout > 0 {
+		go func() {
+			ticker := time.NewTicker(min(idleTimeout/4, time.Second))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if time.Since(time.Unix(0, lastActive.Load())) >= idleTimeout {
+						closeBoth()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	var sent int64
+	copied := make(chan struct{})
+	go func() {
+		sent, _ = io.Copy(activityWriter{backend, active}, client)
+		closeBoth()
+		close(copied)
+	}()
+	received, _ := io.Copy(activityWriter{clientConn, active}, backend)
+	closeBoth()
+	<-copied
+	close(done)
+	return sent, received
+}
+
+// activityWriter notes each write, so idle tunnels can be told apart from busy ones
+type activityWriter struct {
+	io.Writer
+	active func()
+}
+
+// Write implements io.Writer
+func (w activityWriter) Write(p []byte) (int, error) {
+	w.active()
+	return w.Writer.Write(p)
+}
+
+// markSwitched records the switch of protocols in the access log, since hijacked
+// connections are answered without the response writer
+func markSwitched(w http.ResponseWriter) {
+	for {
+		if writer, ok := w.(*accessLogWriter); ok {
+			writer.status = http.StatusSwitchingProtocols
+			return
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// recordWebSocket records the answer to a WebSocket handshake in the metrics
+func (c *Conductor) recordWebSocket(r *http.Request, svc *Service, route string, status int, requestStart time.Time, traceID string) {
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordRequest(svc.Name, route, r.Method, fmt.Sprintf("%d", status), time.Since(requestStart), traceID)
+	}
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, status >= 500)
+	}
+}
+
+// handleWebSocketFailure answers a WebSocket handshake the primary could not be reached for
+func (c *Conductor) handleWebSocketFailure(w http.ResponseWriter, r *http.Request, svc *Service, route string, err error, requestStart time.Time, traceID string) {
+	logger.ErrorWithFields("WebSocket handshake failed", err, map[string]interface{}{
+		"service": svc.Name,
+		"route":   route,
+		"path":    r.URL.Path,
+	})
+
+	status, code, message := http.StatusBadGateway, ErrCodeUpstreamFailed, "WebSocket handshake failed"
+	if isTimeoutError(err) {
+		status, code, message = http.StatusGatewayTimeout, ErrCodeUpstreamTimeout, "WebSocket handshake timed out"
+	}
+	writeError(w, r, status, code, message)
+
+	// Record error in Prometheus metrics
+	if c.prometheusMetrics != nil {
+		c.prometheusMetrics.RecordError(svc.Name, route, "websocket_handshake_failed")
+		c.prometheusMetrics.RecordRequest(svc.Name, route, r.Method, fmt.Sprintf("%d", status), time.Since(requestStart), traceID)
+	}
+
+	// Record metrics for legacy collector
+	if c.metrics != nil {
+		c.RecordMetrics(route, requestStart, true)
+	}
+	c.recordSLO(route, status, time.Since(requestStart))
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// echoWebSocketServer switches requests to WebSocket and echoes what it receives, refusing
+// requests without a token. Frames are not parsed, since the conductor tunnels bytes.
+func echoWebSocketServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.URL.Path != "/socket" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		if r.URL.Query().Get("token") == "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		conn, buffered, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack backend connection: %v", err)
+			return
+		}
+		defer conn.Close()
+		buffered.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: accepted\r\n\r\n")
+		buffered.Flush()
+		io.Copy(conn, buffered)
+	}))
+}
+
+// dialWebSocket sends a WebSocket handshake to the server and returns the connection and
+// the response
+func dialWebSocket(t *testing.T, server *httptest.Server, target string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to dial conductor: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET "+target+" HTTP/1.1\r\nHost: conductor.test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	return conn, reader, resp
+}
+
+// TestWebSocketProxy tests that upgrade requests are tunneled to the primary only, and
+// that refused upgrades are answered as sent
+func TestWebSocketProxy(t *testing.T) {
+	backend := echoWebSocketServer(t)
+	defer backend.Close()
+	var shadowed atomic.Int32
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shadowed.Add(1)
+	}))
+	defer shadow.Close()
+
+	cfg := &config.Config{
+		Timeout: 5,
+		Services: []config.Service{
+			{Name: "chat-shadow", URL: shadow.URL, PathPrefix: "/chat"},
+			{Name: "chat", URL: backend.URL, PathPrefix: "/chat", Primary: true},
+		},
+	}
+	conductor := NewConductor(cfg)
+	defer conductor.Close()
+	server := httptest.NewServer(conductor)
+	defer server.Close()
+
+	conn, reader, resp := dialWebSocket(t, server, "/chat/socket?token=secret")
+	defer conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "accepted" {
+		t.Fatalf("Expected the backend's switch of protocols, got %d %v", resp.StatusCode, resp.Header)
+	}
+	for _, message := range []string{"hello", "world"} {
+		io.WriteString(conn, message)
+		echoed := make([]byte, len(message))
+		if _, err := io.ReadFull(reader, echoed); err != nil || string(echoed) != message {
+			t.Errorf("Expected %q echoed through the tunnel, got %q %v", message, echoed, err)
+		}
+	}
+	if shadowed.Load() != 0 {
+		t.Errorf("Expected the shadow not to receive the handshake, got %d requests", shadowed.Load())
+	}
+
+	refused, _, resp := dialWebSocket(t, server, "/chat/socket")
+	defer refused.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the backend's refusal, got %d", resp.StatusCode)
+	}
+}
+
+// TestWebSocketIdleTimeout tests that tunnels without traffic are closed after the idle
+// timeout
+func TestWebSocketIdleTimeout(t *testing.T) {
+	backend := echoWebSocketServer(t)
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Timeout:   5,
+		Services:  []config.Service{{Name: "chat", URL: backend.URL, PathPrefix: "/", Primary: true}},
+		WebSocket: config.WebSocketConfig{IdleTimeout: 1},
+	}
+	conductor := NewConductor(cfg)
+	defer conductor.Close()
+	server := httptest.NewServer(conductor)
+	defer server.Close()
+
+	conn, reader, resp := dialWebSocket(t, server, "/socket?token=secret")
+	defer conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected a switch of protocols, got %d", resp.StatusCode)
+	}
+	start := time.Now()
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Fatalf("Expected the tunnel closed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 3*time.Second {
+		t.Errorf("Expected the tunnel closed after the idle timeout, took %v", elapsed)
+	}
+}
@@ -0,0 +1,457 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// xmlElement is a parsed XML element before conversion
+type xmlElement struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmlElement
+	text     strings.Builder
+}
+
+// xmlConverter converts XML bodies, such as SOAP responses, into the JSON document they
+// are equivalent to, so they can be compared structurally with XML or JSON bodies.
+// Elements become objects keyed by local name, attributes become "@name" members,
+// repeated elements become arrays and text becomes numbers, booleans or strings.
+type xmlConverter struct {
+	ignore     [][]jsonPathStep
+	root       []jsonPathStep // Selects the element compared, nil for the whole document
+	namespaces bool           // Key elements by "{namespace}local" instead of the local name
+	arrays     map[string]bool
+}
+
+// newXMLConverter creates a converter for the configured XML comparison
+func newXMLConverter(cfg config.XMLCompareConfig) (*xmlConverter, error) {
+	x := &xmlConverter{namespaces: cfg.Namespaces, arrays: make(map[string]bool)}
+	for _, path := range cfg.IgnorePaths {
+		steps, err := parseXPath(path)
+		if err != nil {
+			return nil, err
+		}
+		x.ignore = append(x.ignore, steps)
+	}
+	if cfg.Root != "" {
+		steps, err := parseXPath(cfg.Root)
+		if err != nil {
+			return nil, err
+		}
+		x.root = steps
+	}
+	for _, name := range cfg.Arrays {
+		x.arrays[name] = true
+	}
+	return x, nil
+}
+
+// parseXPath parses the XPath subset used to select XML nodes: /a/b, //name at any depth,
+// * for any element, @attr for attributes and name[n] for the nth repeated element.
+// Namespace prefixes are ignored, since elements are matched by local name.
+func parseXPath(path string) ([]jsonPathStep, error) {
+	rest := strings.TrimSpace(path)
+	if !strings.HasPrefix(rest, "/") {
+		return nil, fmt.Errorf("invalid XPath %q: must start with /", path)
+	}
+
+	var steps []jsonPathStep
+	for rest != "" {
+		step := jsonPathStep{index: -1}
+		if strings.HasPrefix(rest, "//") {
+			step.recursive = true
+			rest = rest[2:]
+		} else {
+			rest = strings.TrimPrefix(rest, "/")
+		}
+
+		end := strings.Index(rest, "/")
+		if end < 0 {
+			end = len(rest)
+		}
+		name := rest[:end]
+		rest = rest[end:]
+
+		if open := strings.Index(name, "["); open >= 0 {
+			position, err := strconv.Atoi(strings.TrimSuffix(name[open+1:], "]"))
+			if err != nil || position < 1 || !strings.HasSuffix(name, "]") {
+				return nil, fmt.Errorf("invalid XPath %q: bad position in %q", path, name)
+			}
+			step.index = position - 1
+			name = name[:open]
+		}
+		attribute := strings.HasPrefix(name, "@")
+		name = strings.TrimPrefix(name, "@")
+		if colon := strings.LastIndex(name, ":"); colon >= 0 {
+			name = name[colon+1:]
+		}
+		if attribute && name != "" {
+			name = "@" + name
+		}
+		switch name {
+		case "":
+			return nil, fmt.Errorf("invalid XPath %q: empty step", path)
+		case "*":
+			step.wildcard = true
+		default:
+			step.key = name
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// Convert parses an XML body into its JSON equivalent, removing ignored nodes and
+// selecting the root element if configured
+func (x *xmlConverter) Convert(body []byte) (interface{}, error) {
+	root, err := parseXML(body)
+	if err != nil {
+		return nil, err
+	}
+
+	document := map[string]interface{}{x.key(root.name): x.value(root)}
+	for _, steps := range x.ignore {
+		removeXMLPath(document, steps)
+	}
+	collapseXML(document)
+	if x.root == nil {
+		return document, nil
+	}
+
+	selected, ok := selectXMLPath(document, x.root)
+	if !ok {
+		return nil, fmt.Errorf("root element not found")
+	}
+	return selected, nil
+}
+
+// parseXML reads the root element of an XML document
+func parseXML(body []byte) (*xmlElement, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			element := &xmlElement{name: token.Name, attrs: token.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, element)
+			} else if root == nil {
+				root = element
+			}
+			stack = append(stack, element)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(token)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	return root, nil
+}
+
+// key returns the object member name of an element or attribute
+func (x *xmlConverter) key(name xml.Name) string {
+	if x.namespaces && name.Space != "" {
+		return "{" + name.Space + "}" + name.Local
+	}
+	return name.Local
+}
+
+// value converts an element to its JSON equivalent
+func (x *xmlConverter) value(element *xmlElement) interface{} {
+	object := make(map[string]interface{})
+	for _, attr := range element.attrs {
+		// Namespace declarations only bind prefixes, they are not data
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		object["@"+x.key(attr.Name)] = xmlScalar(attr.Value)
+	}
+
+	for _, child := range element.children {
+		key := x.key(child.name)
+		value := x.value(child)
+		// Element values are never arrays themselves, so an array holds repetitions
+		existing, seen := object[key]
+		if repeated, ok := existing.([]interface{}); ok {
+			object[key] = append(repeated, value)
+		} else if seen {
+			object[key] = []interface{}{existing, value}
+		} else if x.arrays[child.name.Local] {
+			object[key] = []interface{}{value}
+		} else {
+			object[key] = value
+		}
+	}
+
+	text := strings.TrimSpace(element.text.String())
+	if len(object) == 0 {
+		if text == "" {
+			return nil
+		}
+		return xmlScalar(text)
+	}
+	if text != "" {
+		object["#text"] = xmlScalar(text)
+	}
+	return object
+}
+
+// collapseXML simplifies objects left with only text or nothing after ignored nodes were
+// removed, so they compare equal to elements that never had the removed nodes
+func collapseXML(node interface{}) interface{} {
+	switch value := node.(type) {
+	case []interface{}:
+		for i, child := range value {
+			value[i] = collapseXML(child)
+		}
+	case map[string]interface{}:
+		for key, child := range value {
+			value[key] = collapseXML(child)
+		}
+		if len(value) == 0 {
+			return nil
+		}
+		if text, ok := value["#text"]; ok && len(value) == 1 {
+			return text
+		}
+	}
+	return node
+}
+
+// xmlScalar converts element text or an attribute value to the JSON value it most likely
+// stands for
+func xmlScalar(text string) interface{} {
+	switch text {
+	case "":
+		return ""
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if (text[0] == '-' || (text[0] >= '0' && text[0] <= '9')) && json.Valid([]byte(text)) {
+		return json.Number(text)
+	}
+	return text
+}
+
+// xmlStepMatches reports whether an object member matches a name step
+func xmlStepMatches(step jsonPathStep, key string) bool {
+	if step.wildcard {
+		return !strings.HasPrefix(key, "@") && key != "#text"
+	}
+	if key == step.key {
+		return true
+	}
+	if strings.HasPrefix(key, "@") != strings.HasPrefix(step.key, "@") {
+		return false
+	}
+	// Steps name local names, which also match namespace-qualified keys
+	_, local, qualified := strings.Cut(strings.TrimPrefix(key, "@"), "}")
+	return qualified && local == strings.TrimPrefix(step.key, "@")
+}
+
+// removeXMLPath deletes every node selected by XPath steps below node. Arrays of repeated
+// elements are transparent, since XPath addresses each repetition by the element name.
+func removeXMLPath(node interface{}, steps []jsonPathStep) {
+	step, last := steps[0], len(steps) == 1
+
+	switch value := node.(type) {
+	case []interface{}:
+		for _, child := range value {
+			removeXMLPath(child, steps)
+		}
+	case map[string]interface{}:
+		for key, child := range value {
+			if step.recursive {
+				removeXMLPath(child, steps)
+			}
+			if !xmlStepMatches(step, key) {
+				continue
+			}
+
+			if step.index >= 0 {
+				repeated, ok := child.([]interface{})
+				if !ok {
+					repeated = []interface{}{child}
+				}
+				if step.index >= len(repeated) {
+					continue
+				}
+				if last {
+					remaining := append(repeated[:step.index:step.index], repeated[step.index+1:]...)
+					value[key] = remaining
+				} else {
+					removeXMLPath(repeated[step.index], steps[1:])
+				}
+				continue
+			}
+
+			if last {
+				delete(value, key)
+			} else {
+				removeXMLPath(child, steps[1:])
+			}
+		}
+	}
+}
+
+// selectXMLPath returns the first node selected by XPath steps below node
+func selectXMLPath(node interface{}, steps []jsonPathStep) (interface{}, bool) {
+	if len(steps) == 0 {
+		return node, true
+	}
+	step := steps[0]
+
+	switch value := node.(type) {
+	case []interface{}:
+		for _, child := range value {
+			if selected, ok := selectXMLPath(child, steps); ok {
+				return selected, true
+			}
+		}
+	case map[string]interface{}:
+		for key, child := range value {
+			if !xmlStepMatches(step, key) {
+				continue
+			}
+			if step.index >= 0 {
+				repeated, ok := child.([]interface{})
+				if !ok {
+					repeated = []interface{}{child}
+				}
+				if step.index >= len(repeated) {
+					continue
+				}
+				child = repeated[step.index]
+			}
+			if selected, ok := selectXMLPath(child, steps[1:]); ok {
+				return selected, true
+			}
+		}
+		if step.recursive {
+			for _, child := range value {
+				if selected, ok := selectXMLPath(child, steps); ok {
+					return selected, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// encodeXML writes a document in the form Convert produces back as XML. The document must
+// be an object with a single member, the root element; members are written in key order.
+func encodeXML(document interface{}) ([]byte, error) {
+	object, ok := document.(map[string]interface{})
+	if !ok || len(object) != 1 {
+		return nil, fmt.Errorf("XML documents must be an object with a single root element")
+	}
+
+	var buf bytes.Buffer
+	encoder := xml.NewEncoder(&buf)
+	for key, value := range object {
+		if err := encodeXMLElement(encoder, key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeXMLElement writes a member as an element, or as one element per item of an array
+// of repetitions
+func encodeXMLElement(encoder *xml.Encoder, key string, value interface{}) error {
+	if repeated, ok := value.([]interface{}); ok {
+		for _, item := range repeated {
+			if err := encodeXMLElement(encoder, key, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xmlName(key)}
+	var text interface{}
+	var children []string
+	if object, ok := value.(map[string]interface{}); ok {
+		keys := make([]string, 0, len(object))
+		for member := range object {
+			keys = append(keys, member)
+		}
+		sort.Strings(keys)
+		for _, member := range keys {
+			switch {
+			case member == "#text":
+				text = object[member]
+			case strings.HasPrefix(member, "@"):
+				start.Attr = append(start.Attr, xml.Attr{Name: xmlName(member[1:]), Value: xmlText(object[member])})
+			default:
+				children = append(children, member)
+			}
+		}
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, member := range children {
+			if err := encodeXMLElement(encoder, member, object[member]); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		text = value
+	}
+
+	if text != nil {
+		if err := encoder.EncodeToken(xml.CharData(xmlText(text))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// xmlName returns the element or attribute name of an object member, which is qualified
+// as "{namespace}local" when namespaces are compared
+func xmlName(key string) xml.Name {
+	if space, local, ok := strings.Cut(strings.TrimPrefix(key, "{"), "}"); ok && strings.HasPrefix(key, "{") {
+		return xml.Name{Space: space, Local: local}
+	}
+	return xml.Name{Local: key}
+}
+
+// xmlText returns the text of a scalar value
+func xmlText(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/zeek-r/go-conductor/internal/config"
+)
+
+// soapUser is a SOAP response from the legacy primary
+const soapUser = `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header><Timestamp>2024-01-01T00:00:00Z</Timestamp></soap:Header>
+  <soap:Body>
+    <u:GetUserResponse xmlns:u="urn:users">
+      <u:id>42</u:id>
+      <u:name>Ada</u:name>
+      <u:active>true</u:active>
+      <u:role>admin</u:role>
+      <u:address kind="home"><u:city>London</u:city></u:address>
+    </u:GetUserResponse>
+  </soap:Body>
+</soap:Envelope>`
+
+// TestXMLComparison tests structural comparison of XML bodies with XML and JSON bodies
+func TestXMLComparison(t *testing.T) {
+	root := config.XMLCompareConfig{Enabled: true, Root: "/Envelope/Body/GetUserResponse", Arrays: []string{"role"}}
+
+	tests := []struct {
+		name      string
+		config    config.XMLCompareConfig
+		primary   string
+		shadow    string
+		wantEqual bool
+	}{
+		{
+			name:      "SOAP against equivalent JSON",
+			config:    root,
+			primary:   soapUser,
+			shadow:    `{"name":"Ada","id":42,"active":true,"role":["admin"],"address":{"@kind":"home","city":"London"}}`,
+			wantEqual: true,
+		},
+		{
+			name:      "SOAP against different JSON",
+			config:    root,
+			primary:   soapUser,
+			shadow:    `{"name":"Ada","id":43,"active":true,"role":["admin"],"address":{"@kind":"home","city":"London"}}`,
+			wantEqual: false,
+		},
+		{
+			name:      "namespace prefixes do not matter",
+			config:    config.XMLCompareConfig{Enabled: true, Namespaces: true},
+			primary:   `<a:user xmlns:a="urn:users"><a:id>1</a:id></a:user>`,
+			shadow:    `<b:user xmlns:b="urn:users"><b:id>1</b:id></b:user>`,
+			wantEqual: true,
+		},
+		{
+			name:      "namespace URIs do when enabled",
+			config:    config.XMLCompareConfig{Enabled: true, Namespaces: true},
+			primary:   `<a:user xmlns:a="urn:users"><a:id>1</a:id></a:user>`,
+			shadow:    `<a:user xmlns:a="urn:people"><a:id>1</a:id></a:user>`,
+			wantEqual: false,
+		},
+		{
+			name:      "ignored elements and attributes",
+			config:    config.XMLCompareConfig{Enabled: true, IgnorePaths: []string{"//soap:Timestamp", "/order/item/@generated"}},
+			primary:   `<order><Timestamp>1</Timestamp><item generated="a">x</item><item generated="b">y</item></order>`,
+			shadow:    `<order><Timestamp>2</Timestamp><item generated="c">x</item><item>y</item></order>`,
+			wantEqual: true,
+		},
+		{
+			name:      "ignored nth element",
+			config:    config.XMLCompareConfig{Enabled: true, IgnorePaths: []string{"/order/item[2]"}},
+			primary:   `<order><item>x</item><item>y</item></order>`,
+			shadow:    `<order><item>x</item><item>z</item></order>`,
+			wantEqual: true,
+		},
+		{
+			name:      "element order within repetitions matters",
+			config:    config.XMLCompareConfig{Enabled: true},
+			primary:   `<order><item>x</item><item>y</item></order>`,
+			shadow:    `<order><item>y</item><item>x</item></order>`,
+			wantEqual: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizer, err := newBodyNormalizer(config.NormalizeConfig{XML: tt.config})
+			if err != nil {
+				t.Fatalf("Failed to create normalizer: %v", err)
+			}
+			primary := string(normalizer.Normalize([]byte(tt.primary)))
+			shadow := string(normalizer.Normalize([]byte(tt.shadow)))
+			if (primary == shadow) != tt.wantEqual {
+				t.Errorf("Expected equal=%v, got %q and %q", tt.wantEqual, primary, shadow)
+			}
+		})
+	}
+}
+
+// TestParseXPath tests validation of XML paths
+func TestParseXPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "/Envelope/Body"},
+		{path: "//soap:Timestamp"},
+		{path: "/order/item[2]/@id"},
+		{path: "/*/Body"},
+		{path: "Envelope/Body", wantErr: true},
+		{path: "/order/item[0]", wantErr: true},
+		{path: "/order//", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := parseXPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
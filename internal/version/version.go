@@ -0,0 +1,6 @@
+// Package version holds the build version of go-conductor
+package version
+
+// Version is the go-conductor version, set at build time with
+// -ldflags "-X github.com/zeek-r/go-conductor/internal/version.Version=<version>"
+var Version = "dev"